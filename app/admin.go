@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const defaultInvitationTTL = time.Hour * 24
+
+func (a *Application) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/c2s/bans", a.adminOnly(a.handleC2SAuthBans))
+	mux.HandleFunc("/admin/registration/invitations", a.adminOnly(a.handleRegistrationInvitations))
+	mux.HandleFunc("/admin/accounts", a.adminOnly(a.handleAccounts))
+	mux.HandleFunc("/admin/roster/shared_groups", a.adminOnly(a.handleRosterSharedGroups))
+	mux.HandleFunc("/admin/s2s/out", a.adminOnly(a.handleS2SOutStreams))
+	mux.HandleFunc("/admin/drain", a.adminOnly(a.handleDrain))
+
+	// prometheus metrics
+	mux.Handle("/metrics", promhttp.Handler())
+
+	// profiling handlers
+	mux.Handle("/", http.DefaultServeMux)
+	return mux
+}
+
+// adminOnly restricts access to h to requests carrying the configured admin bearer token.
+// Admin endpoints are disabled altogether when no token has been configured.
+func (a *Application) adminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(a.adminToken) == 0 {
+			http.Error(w, "admin api not enabled", http.StatusForbidden)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(a.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (a *Application) handleC2SAuthBans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, a.c2s.AuthBans())
+}
+
+func (a *Application) handleS2SOutStreams(w http.ResponseWriter, r *http.Request) {
+	if a.s2sOutProvider == nil {
+		http.Error(w, "s2s not enabled", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, a.s2sOutProvider.OutStreams())
+}
+
+func (a *Application) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	select {
+	case a.waitStopCh <- drainSignal:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "shutdown already in progress", http.StatusConflict)
+	}
+}
+
+func (a *Application) handleRegistrationInvitations(w http.ResponseWriter, r *http.Request) {
+	if a.mods == nil || a.mods.Register == nil {
+		http.Error(w, "registration module not enabled", http.StatusNotFound)
+		return
+	}
+	reg := a.mods.Register
+
+	switch r.Method {
+	case http.MethodGet:
+		invs, err := reg.Invitations(r.Context())
+		if err != nil {
+			log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, invs)
+
+	case http.MethodPost:
+		ttl := defaultInvitationTTL
+		if ttlStr := r.FormValue("ttl"); len(ttlStr) > 0 {
+			secs, err := strconv.Atoi(ttlStr)
+			if err != nil || secs <= 0 {
+				http.Error(w, "invalid ttl value", http.StatusBadRequest)
+				return
+			}
+			ttl = time.Duration(secs) * time.Second
+		}
+		inv, err := reg.IssueInvitation(r.Context(), r.FormValue("username"), ttl)
+		if err != nil {
+			log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSONStatus(w, http.StatusCreated, inv)
+
+	case http.MethodDelete:
+		ok, err := reg.RevokeInvitation(r.Context(), r.FormValue("token"))
+		if err != nil {
+			log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *Application) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	if a.mods == nil || a.router == nil {
+		http.Error(w, "modules not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	userJID, err := jid.NewWithString(r.FormValue("jid"), false)
+	if err != nil || len(userJID.Node()) == 0 || !a.router.Hosts().IsLocalHost(userJID.Domain()) {
+		http.Error(w, "invalid account jid", http.StatusBadRequest)
+		return
+	}
+	if err := a.mods.DeleteAccount(r.Context(), userJID); err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// close every session bound to the removed account
+	for _, stm := range a.router.LocalStreams(userJID) {
+		stm.Disconnect(context.Background(), streamerror.ErrNotAuthorized)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Application) handleRosterSharedGroups(w http.ResponseWriter, r *http.Request) {
+	if a.mods == nil || a.mods.Roster == nil {
+		http.Error(w, "roster module not enabled", http.StatusNotFound)
+		return
+	}
+	rst := a.mods.Roster
+
+	switch r.Method {
+	case http.MethodGet:
+		groups, err := rst.SharedGroups(r.Context())
+		if err != nil {
+			log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, groups)
+
+	case http.MethodPost:
+		var group rostermodel.SharedGroup
+		if err := json.NewDecoder(r.Body).Decode(&group); err != nil || len(group.Name) == 0 {
+			http.Error(w, "invalid shared group", http.StatusBadRequest)
+			return
+		}
+		if err := rst.UpsertSharedGroup(r.Context(), &group); err != nil {
+			log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		name := r.FormValue("name")
+		if len(name) == 0 {
+			http.Error(w, "invalid shared group name", http.StatusBadRequest)
+			return
+		}
+		if err := rst.DeleteSharedGroup(r.Context(), name); err != nil {
+			log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+func writeJSONStatus(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
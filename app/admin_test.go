@@ -0,0 +1,360 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/c2s"
+	c2srouter "github.com/ortuman/jackal/c2s/router"
+	"github.com/ortuman/jackal/component"
+	"github.com/ortuman/jackal/model"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/module/xep0077"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/router/host"
+	"github.com/ortuman/jackal/s2s"
+	"github.com/ortuman/jackal/storage"
+	memorystorage "github.com/ortuman/jackal/storage/memory"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const tAdminToken = "s3cr3t"
+
+func TestApplication_AdminAuthorization(t *testing.T) {
+	a := &Application{waitStopCh: make(chan os.Signal, 1)}
+	h := a.debugHandler()
+
+	// admin api disabled when no token has been configured
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodPost, "/admin/drain", nil))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	a.adminToken = tAdminToken
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/registration/invitations", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/registration/invitations", nil)
+	req.Header.Set("Authorization", "Bearer foo")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	require.Len(t, a.waitStopCh, 0)
+}
+
+func TestApplication_AdminC2SAuthBans(t *testing.T) {
+	c2sMng, err := c2s.New([]c2s.Config{{ID: "default"}}, &module.Modules{}, &component.Components{}, nil, nil, nil)
+	require.Nil(t, err)
+
+	a := &Application{c2s: c2sMng, adminToken: tAdminToken}
+	h := a.debugHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodGet, "/admin/c2s/bans", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var bans map[string][]c2s.AuthBan
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &bans))
+	require.Contains(t, bans, "default")
+	require.Len(t, bans["default"], 0)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodPost, "/admin/c2s/bans", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestApplication_AdminS2SOutStreams(t *testing.T) {
+	a := &Application{adminToken: tAdminToken}
+	h := a.debugHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodGet, "/admin/s2s/out", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	a.s2sOutProvider = s2s.NewOutProvider(&s2s.Config{}, nil)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodGet, "/admin/s2s/out", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var infos []s2s.OutStreamInfo
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &infos))
+	require.Len(t, infos, 0)
+}
+
+func TestApplication_AdminDrain(t *testing.T) {
+	a := &Application{waitStopCh: make(chan os.Signal, 1), adminToken: tAdminToken}
+	h := a.debugHandler()
+
+	// unauthenticated
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/drain", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Len(t, a.waitStopCh, 0)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodGet, "/admin/drain", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodPost, "/admin/drain", nil))
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	// already requested
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodPost, "/admin/drain", nil))
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	require.Equal(t, drainSignal, <-a.waitStopCh)
+}
+
+func TestApplication_Drain(t *testing.T) {
+	hosts, _ := host.New([]host.Config{{Name: "jackal.im", Certificate: tls.Certificate{}}})
+	reps, _ := storage.New(&storage.Config{Type: storage.Memory})
+	r, _ := router.New(hosts, c2srouter.New(reps.User(), reps.BlockList(), nil), nil)
+
+	c2sPort, s2sPort := freePort(t), freePort(t)
+
+	c2sMng, err := c2s.New([]c2s.Config{{
+		ID:             "default",
+		ConnectTimeout: time.Minute,
+		Timeout:        time.Minute,
+		KeepAlive:      time.Minute,
+		MaxStanzaSize:  32768,
+		Transport:      c2s.TransportConfig{Type: transport.Socket, BindAddress: "127.0.0.1", Port: c2sPort},
+	}}, &module.Modules{}, &component.Components{}, r, reps.User(), reps.BlockList())
+	require.Nil(t, err)
+	c2sMng.Start()
+
+	s2sCfg := &s2s.Config{Transport: s2s.TransportConfig{BindAddress: "127.0.0.1", Port: s2sPort}}
+	outProvider := s2s.NewOutProvider(s2sCfg, hosts)
+	s2sMng := s2s.New(s2sCfg, &module.Modules{}, outProvider, r)
+	s2sMng.Start()
+	defer s2sMng.Shutdown(context.Background())
+
+	c2sAddr := "127.0.0.1:" + strconv.Itoa(c2sPort)
+	s2sAddr := "127.0.0.1:" + strconv.Itoa(s2sPort)
+
+	conn := dialWithRetry(t, c2sAddr)
+	defer func() { _ = conn.Close() }()
+	_ = dialWithRetry(t, s2sAddr).Close()
+	time.Sleep(time.Millisecond * 100) // wait until c2s stream has been registered
+
+	a := &Application{
+		c2s:            c2sMng,
+		s2s:            s2sMng,
+		mods:           &module.Modules{},
+		s2sOutProvider: outProvider,
+		drainCfg:       drainConfig{SeeOtherHost: "xmpp2.jackal.im", Timeout: 5},
+	}
+	a.drain()
+
+	// connected client has been redirected and disconnected
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	b, err := ioutil.ReadAll(conn)
+	require.Nil(t, err)
+	require.Contains(t, string(b), "see-other-host")
+	require.Contains(t, string(b), "xmpp2.jackal.im")
+	require.Contains(t, string(b), "</stream:stream>")
+
+	// listeners have been closed
+	_, err = net.DialTimeout("tcp", c2sAddr, time.Second)
+	require.NotNil(t, err)
+	_, err = net.DialTimeout("tcp", s2sAddr, time.Second)
+	require.NotNil(t, err)
+}
+
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer func() { _ = ln.Close() }()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func dialWithRetry(t *testing.T, address string) net.Conn {
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			return conn
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	require.Fail(t, "failed to connect to "+address)
+	return nil
+}
+
+func TestApplication_AdminRegistrationInvitations(t *testing.T) {
+	a := &Application{mods: &module.Modules{}, adminToken: tAdminToken}
+	h := a.debugHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodGet, "/admin/registration/invitations", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	a.mods.Register = xep0077.New(&xep0077.Config{AllowRegistration: true, InvitationOnly: true}, nil, nil, nil, memorystorage.NewInvitations(), nil)
+	defer func() { _ = a.mods.Register.Shutdown() }()
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodPost, "/admin/registration/invitations?username=ortuman&ttl=60", nil))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, []string{"application/json"}, rec.Header()["Content-Type"])
+
+	var inv model.Invitation
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &inv))
+	require.Equal(t, "ortuman", inv.Username)
+	require.NotEmpty(t, inv.Token)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodPost, "/admin/registration/invitations?ttl=foo", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodGet, "/admin/registration/invitations", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var invs []model.Invitation
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &invs))
+	require.Len(t, invs, 1)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodDelete, "/admin/registration/invitations?token="+inv.Token, nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	invs, _ = a.mods.Register.Invitations(context.Background())
+	require.Len(t, invs, 0)
+}
+
+func TestApplication_AdminDeleteAccount(t *testing.T) {
+	hosts, _ := host.New([]host.Config{{Name: "jackal.im", Certificate: tls.Certificate{}}})
+	reps, _ := storage.New(&storage.Config{Type: storage.Memory})
+	r, _ := router.New(hosts, c2srouter.New(reps.User(), reps.BlockList(), nil), nil)
+
+	mods := module.New(&module.Config{Enabled: map[string]struct{}{"roster": {}}}, r, reps, "alloc-1234")
+	defer func() { _ = mods.Shutdown(context.Background()) }()
+
+	_ = reps.User().UpsertUser(context.Background(), &model.User{Username: "ortuman", Domain: "jackal.im", Password: "1234"})
+
+	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	r.Bind(context.Background(), stm)
+
+	a := &Application{adminToken: tAdminToken}
+	h := a.debugHandler()
+
+	// modules not yet initialized
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodDelete, "/admin/accounts?jid=ortuman@jackal.im", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	a.router = r
+	a.mods = mods
+
+	// unauthenticated
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/accounts?jid=ortuman@jackal.im", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.False(t, stm.IsDisconnected())
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodGet, "/admin/accounts?jid=ortuman@jackal.im", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodDelete, "/admin/accounts?jid=ortuman@example.org", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodDelete, "/admin/accounts?jid=ortuman@jackal.im", nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.True(t, stm.IsDisconnected())
+
+	usr, _ := reps.User().FetchUser(context.Background(), "ortuman@jackal.im")
+	require.Nil(t, usr)
+}
+
+func TestApplication_AdminRosterSharedGroups(t *testing.T) {
+	hosts, _ := host.New([]host.Config{{Name: "jackal.im", Certificate: tls.Certificate{}}})
+	reps, _ := storage.New(&storage.Config{Type: storage.Memory})
+	r, _ := router.New(hosts, c2srouter.New(reps.User(), reps.BlockList(), nil), nil)
+
+	a := &Application{router: r, mods: &module.Modules{}, adminToken: tAdminToken}
+	h := a.debugHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodGet, "/admin/roster/shared_groups", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	mods := module.New(&module.Config{Enabled: map[string]struct{}{"roster": {}}}, r, reps, "alloc-1234")
+	defer func() { _ = mods.Shutdown(context.Background()) }()
+	a.mods = mods
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodPost, "/admin/roster/shared_groups", strings.NewReader(`{"description":"Staff"}`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodPost, "/admin/roster/shared_groups", strings.NewReader(`{"name":"staff","hosts":["jackal.im"]}`)))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodGet, "/admin/roster/shared_groups", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var groups []rostermodel.SharedGroup
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &groups))
+	require.Len(t, groups, 1)
+	require.Equal(t, "staff", groups[0].Name)
+	require.Equal(t, []string{"jackal.im"}, groups[0].Hosts)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, tUtilAdminRequest(http.MethodDelete, "/admin/roster/shared_groups?name=staff", nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	groups, _ = mods.Roster.SharedGroups(context.Background())
+	require.Len(t, groups, 0)
+}
+
+func TestApplication_Metrics(t *testing.T) {
+	rep, err := storage.New(&storage.Config{Type: storage.Memory})
+	require.Nil(t, err)
+	_, _ = rep.User().FetchUser(context.Background(), "ortuman@jackal.im")
+
+	a := &Application{}
+	h := a.debugHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `jackal_storage_operation_duration_seconds_count{method="FetchUser",repository="user"}`)
+}
+
+func tUtilAdminRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Authorization", "Bearer "+tAdminToken)
+	return req
+}
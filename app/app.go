@@ -10,6 +10,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	_ "net/http/pprof" // http profile handlers
@@ -18,12 +19,14 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/ortuman/jackal/c2s"
 	c2srouter "github.com/ortuman/jackal/c2s/router"
+	"github.com/ortuman/jackal/cluster"
 	"github.com/ortuman/jackal/component"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/module"
@@ -39,9 +42,15 @@ import (
 const (
 	envAllocationID = "JACKAL_ALLOCATION_ID"
 
+	defaultAllocationIDPath = "jackal.alloc"
+
 	darwinOpenMax = 10240
 
 	defaultShutDownWaitTime = time.Duration(5) * time.Second
+
+	defaultDrainTimeout = time.Duration(60) * time.Second
+
+	defaultDrainFlushTimeout = time.Duration(10) * time.Second
 )
 
 var logoStr = []string{
@@ -68,17 +77,24 @@ type Application struct {
 	output           io.Writer
 	args             []string
 	logger           log.Logger
+	hosts            *host.Hosts
 	router           router.Router
 	mods             *module.Modules
 	comps            *component.Components
 	s2sOutProvider   *s2s.OutProvider
 	s2s              *s2s.S2S
 	c2s              *c2s.C2S
+	cluster          *cluster.Cluster
 	debugSrv         *http.Server
+	adminToken       string
 	waitStopCh       chan os.Signal
 	shutDownWaitSecs time.Duration
+	drainCfg         drainConfig
 }
 
+// drainSignal triggers drain mode before shutting down.
+const drainSignal = syscall.SIGUSR2
+
 // New returns a runnable application given an output and a command line arguments array.
 func New(output io.Writer, args []string) *Application {
 	return &Application{
@@ -134,6 +150,8 @@ func (a *Application) Run() error {
 	if err := a.createPIDFile(cfg.PIDFile); err != nil {
 		return err
 	}
+	a.drainCfg = cfg.Drain
+
 	// initialize logger
 	err = a.initLogger(&cfg.Logger, a.output)
 	if err != nil {
@@ -141,9 +159,14 @@ func (a *Application) Run() error {
 	}
 
 	// set allocation identifier
-	allocID := os.Getenv(envAllocationID)
-	if len(allocID) == 0 {
-		allocID = uuid.New().String()
+	allocIDPath := cfg.AllocationIDPath
+	if len(allocIDPath) == 0 && cfg.Cluster != nil {
+		// clustered nodes must keep their identifier across restarts to clean up their own stale presences
+		allocIDPath = defaultAllocationIDPath
+	}
+	allocID, err := loadAllocationID(allocIDPath)
+	if err != nil {
+		return err
 	}
 
 	// show jackal's fancy logo
@@ -154,7 +177,15 @@ func (a *Application) Run() error {
 	if err != nil {
 		return err
 	}
-	if err := repContainer.Presences().ClearPresences(context.Background()); err != nil {
+	if cfg.Cluster != nil {
+		if !repContainer.IsClusterCompatible() {
+			return errors.New("storage type is not cluster compatible")
+		}
+		// presences stored by other cluster nodes must be preserved
+		if err := repContainer.Presences().DeleteAllocationPresences(context.Background(), allocID); err != nil {
+			return err
+		}
+	} else if err := repContainer.Presences().ClearPresences(context.Background()); err != nil {
 		return err
 	}
 
@@ -163,22 +194,40 @@ func (a *Application) Run() error {
 	if err != nil {
 		return err
 	}
+	if err := hosts.Start(cfg.Certificates); err != nil {
+		return err
+	}
+	a.hosts = hosts
+
 	// initialize router
 	var s2sRouter router.S2SRouter
 
 	if cfg.S2S != nil {
 		a.s2sOutProvider = s2s.NewOutProvider(cfg.S2S, hosts)
-		s2sRouter = s2srouter.New(a.s2sOutProvider)
+		s2sRouter = s2srouter.New(a.s2sOutProvider, &cfg.S2S.Federation)
+	}
+	var clusterRouter router.ClusterRouter
+
+	if cfg.Cluster != nil {
+		a.cluster = cluster.New(cfg.Cluster, allocID)
+		clusterRouter = a.cluster
 	}
 	a.router, err = router.New(
 		hosts,
-		c2srouter.New(repContainer.User(), repContainer.BlockList()),
+		c2srouter.New(repContainer.User(), repContainer.BlockList(), clusterRouter),
 		s2sRouter,
 	)
 	if err != nil {
 		return err
 	}
 
+	// join cluster...
+	if a.cluster != nil {
+		if err := a.cluster.Start(); err != nil {
+			return err
+		}
+	}
+
 	// initialize modules & components...
 	a.mods = module.New(&cfg.Modules, a.router, repContainer, allocID)
 	a.comps = component.New(&cfg.Components, a.mods.DiscoInfo)
@@ -200,6 +249,7 @@ func (a *Application) Run() error {
 
 	// initialize debug server...
 	if cfg.Debug.Port > 0 {
+		a.adminToken = cfg.Debug.AdminToken
 		if err := a.initDebugServer(cfg.Debug.Port); err != nil {
 			return err
 		}
@@ -207,6 +257,10 @@ func (a *Application) Run() error {
 
 	// ...wait for stop signal to shutdown
 	sig := a.waitForStopSignal()
+	if sig == drainSignal {
+		log.Infof("received %s signal... draining...", sig.String())
+		a.drain()
+	}
 	log.Infof("received %s signal... shutting down...", sig.String())
 
 	return a.gracefullyShutdown()
@@ -236,6 +290,34 @@ func (a *Application) createPIDFile(pidFile string) error {
 	return nil
 }
 
+// loadAllocationID returns the node allocation identifier, either taken from the environment,
+// or read from allocIDPath, in which case a new one is generated and persisted the first time.
+func loadAllocationID(allocIDPath string) (string, error) {
+	if allocID := os.Getenv(envAllocationID); len(allocID) > 0 {
+		return allocID, nil
+	}
+	if len(allocIDPath) == 0 {
+		return uuid.New().String(), nil
+	}
+	b, err := ioutil.ReadFile(allocIDPath)
+	switch {
+	case err == nil:
+		if allocID := strings.TrimSpace(string(b)); len(allocID) > 0 {
+			return allocID, nil
+		}
+	case !os.IsNotExist(err):
+		return "", err
+	}
+	allocID := uuid.New().String()
+	if err := os.MkdirAll(filepath.Dir(allocIDPath), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(allocIDPath, []byte(allocID), 0644); err != nil {
+		return "", err
+	}
+	return allocID, nil
+}
+
 func (a *Application) initLogger(config *loggerConfig, output io.Writer) error {
 	var logFiles []io.WriteCloser
 	if len(config.LogPath) > 0 {
@@ -287,7 +369,7 @@ func (a *Application) setRLimit() error {
 }
 
 func (a *Application) initDebugServer(port int) error {
-	a.debugSrv = &http.Server{}
+	a.debugSrv = &http.Server{Handler: a.debugHandler()}
 	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
@@ -298,10 +380,50 @@ func (a *Application) initDebugServer(port int) error {
 }
 
 func (a *Application) waitForStopSignal() os.Signal {
-	signal.Notify(a.waitStopCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(a.waitStopCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, drainSignal)
 	return <-a.waitStopCh
 }
 
+// drain stops accepting new c2s and s2s connections and redirects connected clients to the configured
+// alternate host, flushing s2s and offline pending queues afterwards.
+func (a *Application) drain() {
+	timeout := defaultDrainTimeout
+	if a.drainCfg.Timeout > 0 {
+		timeout = time.Duration(a.drainCfg.Timeout) * time.Second
+	}
+	flushTimeout := defaultDrainFlushTimeout
+	if a.drainCfg.FlushTimeout > 0 {
+		flushTimeout = time.Duration(a.drainCfg.FlushTimeout) * time.Second
+	}
+	if a.s2s != nil {
+		if err := a.s2s.Drain(); err != nil {
+			log.Warnf("failed to stop s2s listener: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	if err := a.c2s.Drain(ctx, a.drainCfg.SeeOtherHost); err != nil {
+		log.Warnf("failed to drain c2s connections: %v", err)
+	}
+	cancel()
+
+	// pending queues are flushed even if client streams took the whole drain timeout to close
+	if a.s2sOutProvider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		if err := a.s2sOutProvider.Flush(ctx); err != nil {
+			log.Warnf("failed to flush s2s pending queues: %v", err)
+		}
+		cancel()
+	}
+	if a.mods != nil && a.mods.Offline != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		if err := a.mods.Offline.Flush(ctx); err != nil {
+			log.Warnf("failed to flush offline queue: %v", err)
+		}
+		cancel()
+	}
+	log.Infof("drain completed")
+}
+
 func (a *Application) gracefullyShutdown() error {
 	// wait until application has been shut down
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.shutDownWaitSecs))
@@ -334,6 +456,12 @@ func (a *Application) doShutdown(ctx context.Context) error {
 	}
 	a.c2s.Shutdown(ctx)
 
+	if a.cluster != nil {
+		if err := a.cluster.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
 	if err := a.comps.Shutdown(ctx); err != nil {
 		return err
 	}
@@ -346,6 +474,11 @@ func (a *Application) doShutdown(ctx context.Context) error {
 			return err
 		}
 	}
+	if a.hosts != nil {
+		if err := a.hosts.Close(); err != nil {
+			return err
+		}
+	}
 	log.Unset()
 	return nil
 }
@@ -8,7 +8,9 @@ package app
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"testing"
@@ -91,3 +93,27 @@ func expectedUsageString() string {
 	r += fmt.Sprintf("%s\n", usageStr)
 	return r
 }
+
+func TestApplication_LoadAllocationID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jackal")
+	require.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	allocIDPath := filepath.Join(dir, "data", "jackal.alloc")
+
+	allocID, err := loadAllocationID(allocIDPath)
+	require.Nil(t, err)
+	require.NotEmpty(t, allocID)
+
+	// identifier is kept across restarts
+	allocID2, err := loadAllocationID(allocIDPath)
+	require.Nil(t, err)
+	require.Equal(t, allocID, allocID2)
+
+	_ = os.Setenv(envAllocationID, "alloc-1234")
+	defer func() { _ = os.Unsetenv(envAllocationID) }()
+
+	allocID, err = loadAllocationID(allocIDPath)
+	require.Nil(t, err)
+	require.Equal(t, "alloc-1234", allocID)
+}
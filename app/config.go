@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 
 	"github.com/ortuman/jackal/c2s"
+	"github.com/ortuman/jackal/cluster"
 	"github.com/ortuman/jackal/component"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router/host"
@@ -20,7 +21,8 @@ import (
 
 // debugConfig represents debug server configuration.
 type debugConfig struct {
-	Port int `yaml:"port"`
+	Port       int    `yaml:"port"`
+	AdminToken string `yaml:"admin_token"`
 }
 
 type loggerConfig struct {
@@ -28,17 +30,28 @@ type loggerConfig struct {
 	LogPath string `yaml:"log_path"`
 }
 
+// drainConfig represents drain mode configuration.
+type drainConfig struct {
+	SeeOtherHost string `yaml:"see_other_host"`
+	Timeout      int    `yaml:"timeout"`
+	FlushTimeout int    `yaml:"flush_timeout"`
+}
+
 // Config represents a global configuration.
 type Config struct {
-	PIDFile    string           `yaml:"pid_path"`
-	Debug      debugConfig      `yaml:"debug"`
-	Logger     loggerConfig     `yaml:"logger"`
-	Storage    storage.Config   `yaml:"storage"`
-	Hosts      []host.Config    `yaml:"hosts"`
-	Modules    module.Config    `yaml:"modules"`
-	Components component.Config `yaml:"components"`
-	C2S        []c2s.Config     `yaml:"c2s"`
-	S2S        *s2s.Config      `yaml:"s2s"`
+	PIDFile          string                   `yaml:"pid_path"`
+	AllocationIDPath string                   `yaml:"allocation_id_path"`
+	Debug            debugConfig              `yaml:"debug"`
+	Logger           loggerConfig             `yaml:"logger"`
+	Drain            drainConfig              `yaml:"drain"`
+	Storage          storage.Config           `yaml:"storage"`
+	Hosts            []host.Config            `yaml:"hosts"`
+	Certificates     *host.CertificatesConfig `yaml:"certificates"`
+	Modules          module.Config            `yaml:"modules"`
+	Components       component.Config         `yaml:"components"`
+	C2S              []c2s.Config             `yaml:"c2s"`
+	S2S              *s2s.Config              `yaml:"s2s"`
+	Cluster          *cluster.Config          `yaml:"cluster"`
 }
 
 // FromFile loads default global configuration from a specified file.
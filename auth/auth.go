@@ -60,6 +60,9 @@ var (
 	// ErrSASLIncorrectEncoding represents a 'incorrect-encoding' authentication error.
 	ErrSASLIncorrectEncoding = newSASLError("incorrect-encoding")
 
+	// ErrSASLInvalidAuthzid represents a 'invalid-authzid' authentication error.
+	ErrSASLInvalidAuthzid = newSASLError("invalid-authzid")
+
 	// ErrSASLMalformedRequest represents a 'malformed-request' authentication error.
 	ErrSASLMalformedRequest = newSASLError("malformed-request")
 
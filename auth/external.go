@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"strings"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// ExternalMechanism represents SASL EXTERNAL mechanism name.
+const ExternalMechanism = "EXTERNAL"
+
+var (
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidXMPPAddr       = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 5}
+)
+
+type otherName struct {
+	TypeID asn1.ObjectIdentifier
+	Value  asn1.RawValue
+}
+
+// External represents a SASL EXTERNAL authenticator backed by TLS client certificates.
+type External struct {
+	stm           stream.C2S
+	tr            transport.Transport
+	roots         *x509.CertPool
+	userRep       repository.User
+	username      string
+	authenticated bool
+}
+
+// NewExternal returns a new external authenticator instance.
+// Client certificates will be validated against roots certificate pool.
+func NewExternal(stm stream.C2S, tr transport.Transport, roots *x509.CertPool, userRep repository.User) *External {
+	return &External{stm: stm, tr: tr, roots: roots, userRep: userRep}
+}
+
+// Mechanism returns authenticator mechanism name.
+func (e *External) Mechanism() string {
+	return ExternalMechanism
+}
+
+// Username returns authenticated username in case
+// authentication process has been completed.
+func (e *External) Username() string {
+	return e.username
+}
+
+// Authenticated returns whether or not user has been authenticated.
+func (e *External) Authenticated() bool {
+	return e.authenticated
+}
+
+// UsesChannelBinding returns whether or not external authenticator
+// requires channel binding bytes.
+func (e *External) UsesChannelBinding() bool {
+	return false
+}
+
+// ProcessElement process an incoming authenticator element.
+func (e *External) ProcessElement(ctx context.Context, elem xmpp.XElement) error {
+	if e.authenticated {
+		return nil
+	}
+	certs := e.tr.PeerCertificates()
+	if len(certs) == 0 || !e.verifyCertificate(certs) {
+		return ErrSASLNotAuthorized
+	}
+	identities := certIdentities(certs[0], e.stm.Domain())
+	if len(identities) == 0 {
+		return ErrSASLNotAuthorized
+	}
+	// an empty response ('=') means no authorization identity has been provided
+	var authzid string
+	if txt := elem.Text(); len(txt) > 0 && txt != "=" {
+		b, err := base64.StdEncoding.DecodeString(txt)
+		if err != nil {
+			return ErrSASLIncorrectEncoding
+		}
+		authzid = string(b)
+	}
+	var username string
+	switch {
+	case len(authzid) > 0:
+		authzJID, err := jid.NewWithString(authzid, false)
+		if err != nil || !authzJID.IsBare() || authzJID.Domain() != e.stm.Domain() {
+			return ErrSASLInvalidAuthzid
+		}
+		for _, identity := range identities {
+			if identity == authzJID.Node() {
+				username = identity
+				break
+			}
+		}
+		if len(username) == 0 {
+			return ErrSASLInvalidAuthzid
+		}
+
+	case len(identities) == 1:
+		username = identities[0]
+
+	default:
+		// ambiguous certificate identity... authorization identity is required
+		return ErrSASLInvalidAuthzid
+	}
+	user, err := e.userRep.FetchUser(ctx, model.BareJID(username, e.stm.Domain()))
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrSASLNotAuthorized
+	}
+	e.username = username
+	e.authenticated = true
+
+	e.stm.SendElement(ctx, xmpp.NewElementNamespace("success", saslNamespace))
+	return nil
+}
+
+// Reset resets external authenticator internal state.
+func (e *External) Reset() {
+	e.username = ""
+	e.authenticated = false
+}
+
+func (e *External) verifyCertificate(certs []*x509.Certificate) bool {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         e.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err == nil
+}
+
+// certIdentities returns all usernames a certificate is bound to within domain.
+// xmppAddr subject alternative names take precedence over subject common name.
+func certIdentities(cert *x509.Certificate, domain string) []string {
+	var usernames []string
+	for _, addr := range xmppAddrs(cert) {
+		if j, err := jid.NewWithString(addr, false); err == nil && j.IsBare() && len(j.Node()) > 0 && j.Domain() == domain {
+			usernames = append(usernames, j.Node())
+		}
+	}
+	if len(usernames) > 0 {
+		return usernames
+	}
+	cn := cert.Subject.CommonName
+	if len(cn) == 0 {
+		return nil
+	}
+	if strings.Contains(cn, "@") {
+		if j, err := jid.NewWithString(cn, false); err == nil && j.IsBare() && len(j.Node()) > 0 && j.Domain() == domain {
+			return []string{j.Node()}
+		}
+		return nil
+	}
+	if j, err := jid.New(cn, domain, "", false); err == nil {
+		return []string{j.Node()}
+	}
+	return nil
+}
+
+func xmppAddrs(cert *x509.Certificate) []string {
+	var addrs []string
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var seq asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &seq); err != nil {
+			return nil
+		}
+		rest := seq.Bytes
+		for len(rest) > 0 {
+			var gn asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &gn); err != nil {
+				return addrs
+			}
+			// otherName [0]
+			if gn.Class != asn1.ClassContextSpecific || gn.Tag != 0 {
+				continue
+			}
+			var on otherName
+			if _, err := asn1.UnmarshalWithParams(gn.FullBytes, &on, "tag:0"); err != nil || !on.TypeID.Equal(oidXMPPAddr) {
+				continue
+			}
+			var addr string
+			if _, err := asn1.Unmarshal(on.Value.Bytes, &addr); err != nil {
+				continue
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	memorystorage "github.com/ortuman/jackal/storage/memory"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "jackal test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	p := x509.NewCertPool()
+	p.AddCert(ca.cert)
+	return p
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, xmppAddrs ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if len(xmppAddrs) > 0 {
+		var gns []byte
+		for _, addr := range xmppAddrs {
+			val, err := asn1.MarshalWithParams(addr, "utf8")
+			require.Nil(t, err)
+			gn, err := asn1.MarshalWithParams(otherName{
+				TypeID: oidXMPPAddr,
+				Value:  asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: val},
+			}, "tag:0")
+			require.Nil(t, err)
+			gns = append(gns, gn...)
+		}
+		san, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: gns})
+		require.Nil(t, err)
+		tmpl.ExtraExtensions = []pkix.Extension{{Id: oidSubjectAltName, Value: san}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return cert
+}
+
+func TestAuthExternal_XMPPAddr(t *testing.T) {
+	ca := newTestCA(t)
+
+	testStm, s := authTestSetup(&model.User{Username: "mariana", Domain: "localhost", Password: "1234"})
+	_ = s.UpsertUser(context.Background(), &model.User{Username: "noelia", Domain: "localhost", Password: "1234"})
+
+	tr := &fakeTransport{}
+	authr := NewExternal(testStm, tr, ca.pool(), s)
+	require.Equal(t, "EXTERNAL", authr.Mechanism())
+	require.False(t, authr.UsesChannelBinding())
+
+	elem := xmpp.NewElementNamespace("auth", "urn:ietf:params:xml:ns:xmpp-sasl")
+	elem.SetAttribute("mechanism", "EXTERNAL")
+	elem.SetText("=")
+
+	// no client certificate
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(context.Background(), elem))
+
+	// untrusted issuer
+	tr.peerCerts = []*x509.Certificate{newTestCA(t).issue(t, "mariana", "mariana@localhost")}
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(context.Background(), elem))
+
+	// single identity
+	tr.peerCerts = []*x509.Certificate{ca.issue(t, "ignored", "mariana@localhost")}
+	require.Nil(t, authr.ProcessElement(context.Background(), elem))
+	require.True(t, authr.Authenticated())
+	require.Equal(t, "mariana", authr.Username())
+
+	// multiple identities... authzid required
+	authr.Reset()
+	tr.peerCerts = []*x509.Certificate{ca.issue(t, "", "mariana@localhost", "noelia@localhost", "ortuman@jackal.im")}
+	require.Equal(t, ErrSASLInvalidAuthzid, authr.ProcessElement(context.Background(), elem))
+
+	elem.SetText(base64.StdEncoding.EncodeToString([]byte("ortuman@localhost")))
+	require.Equal(t, ErrSASLInvalidAuthzid, authr.ProcessElement(context.Background(), elem))
+
+	elem.SetText(base64.StdEncoding.EncodeToString([]byte("noelia@localhost")))
+	require.Nil(t, authr.ProcessElement(context.Background(), elem))
+	require.Equal(t, "noelia", authr.Username())
+
+	// incorrect encoding
+	authr.Reset()
+	elem.SetText("bad?encoding")
+	require.Equal(t, ErrSASLIncorrectEncoding, authr.ProcessElement(context.Background(), elem))
+}
+
+func TestAuthExternal_CommonName(t *testing.T) {
+	ca := newTestCA(t)
+
+	testStm, s := authTestSetup(&model.User{Username: "mariana", Domain: "localhost", Password: "1234"})
+
+	tr := &fakeTransport{}
+	authr := NewExternal(testStm, tr, ca.pool(), s)
+
+	elem := xmpp.NewElementNamespace("auth", "urn:ietf:params:xml:ns:xmpp-sasl")
+	elem.SetAttribute("mechanism", "EXTERNAL")
+
+	tr.peerCerts = []*x509.Certificate{ca.issue(t, "mariana")}
+	require.Nil(t, authr.ProcessElement(context.Background(), elem))
+	require.Equal(t, "mariana", authr.Username())
+
+	// foreign domain
+	authr.Reset()
+	tr.peerCerts = []*x509.Certificate{ca.issue(t, "mariana@jackal.im")}
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(context.Background(), elem))
+
+	// unknown user
+	tr.peerCerts = []*x509.Certificate{ca.issue(t, "ortuman")}
+	require.Equal(t, ErrSASLNotAuthorized, authr.ProcessElement(context.Background(), elem))
+
+	// storage error
+	tr.peerCerts = []*x509.Certificate{ca.issue(t, "mariana")}
+	memorystorage.EnableMockedError()
+	require.Equal(t, memorystorage.ErrMocked, authr.ProcessElement(context.Background(), elem))
+	memorystorage.DisableMockedError()
+}
@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/base64"
 
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/storage/repository"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
@@ -70,7 +71,7 @@ func (p *Plain) ProcessElement(ctx context.Context, elem xmpp.XElement) error {
 	password := string(s[2])
 
 	// validate user and password
-	user, err := p.userRep.FetchUser(ctx, username)
+	user, err := p.userRep.FetchUser(ctx, model.BareJID(username, p.stm.Domain()))
 	if err != nil {
 		return err
 	}
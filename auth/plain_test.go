@@ -20,7 +20,7 @@ import (
 func TestAuthPlainAuthentication(t *testing.T) {
 	var err error
 
-	testStm, s := authTestSetup(&model.User{Username: "mariana", Password: "1234"})
+	testStm, s := authTestSetup(&model.User{Username: "mariana", Domain: "localhost", Password: "1234"})
 
 	authr := NewPlain(testStm, s)
 	require.Equal(t, authr.Mechanism(), "PLAIN")
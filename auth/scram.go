@@ -200,7 +200,7 @@ func (s *Scram) handleStart(ctx context.Context, elem xmpp.XElement) error {
 	if len(username) == 0 || len(cNonce) == 0 {
 		return ErrSASLMalformedRequest
 	}
-	user, err := s.userRep.FetchUser(ctx, username)
+	user, err := s.userRep.FetchUser(ctx, model.BareJID(username, s.stm.Domain()))
 	if err != nil {
 		return err
 	}
@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"hash"
 	"math/rand"
+	"net"
 	"strconv"
 	"strings"
 	"testing"
@@ -41,7 +42,8 @@ func randomBytes(l int) []byte {
 }
 
 type fakeTransport struct {
-	cbBytes []byte
+	cbBytes   []byte
+	peerCerts []*x509.Certificate
 }
 
 func (ft *fakeTransport) Read(p []byte) (n int, err error)        { return 0, nil }
@@ -56,7 +58,8 @@ func (ft *fakeTransport) EnableCompression(compress.Level)        { return }
 func (ft *fakeTransport) ChannelBindingBytes(transport.ChannelBindingMechanism) []byte {
 	return ft.cbBytes
 }
-func (ft *fakeTransport) PeerCertificates() []*x509.Certificate { return nil }
+func (ft *fakeTransport) PeerCertificates() []*x509.Certificate { return ft.peerCerts }
+func (ft *fakeTransport) RemoteAddr() net.Addr                  { return nil }
 
 type scramAuthTestCase struct {
 	id          int
@@ -210,7 +213,7 @@ var tt = []scramAuthTestCase{
 
 func TestScramMechanisms(t *testing.T) {
 	testTr := &fakeTransport{}
-	testStm, s := authTestSetup(&model.User{Username: "ortuman", Password: "1234"})
+	testStm, s := authTestSetup(&model.User{Username: "ortuman", Domain: "localhost", Password: "1234"})
 
 	authr := NewScram(testStm, testTr, ScramSHA1, false, s)
 	require.Equal(t, authr.Mechanism(), "SCRAM-SHA-1")
@@ -234,7 +237,7 @@ func TestScramMechanisms(t *testing.T) {
 
 func TestScramBadPayload(t *testing.T) {
 	testTr := &fakeTransport{}
-	testStm, s := authTestSetup(&model.User{Username: "ortuman", Password: "1234"})
+	testStm, s := authTestSetup(&model.User{Username: "ortuman", Domain: "localhost", Password: "1234"})
 
 	authr := NewScram(testStm, testTr, ScramSHA1, false, s)
 
@@ -265,7 +268,7 @@ func processScramTestCase(t *testing.T, tc *scramAuthTestCase) error {
 	if tc.usesCb {
 		tr.cbBytes = tc.cbBytes
 	}
-	testStm, s := authTestSetup(&model.User{Username: "ortuman", Password: "1234"})
+	testStm, s := authTestSetup(&model.User{Username: "ortuman", Domain: "localhost", Password: "1234"})
 
 	authr := NewScram(testStm, tr, tc.scramType, tc.usesCb, s)
 
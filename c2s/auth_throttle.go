@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package c2s
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage/repository"
+)
+
+const (
+	ipThrottleKind       = "ip"
+	usernameThrottleKind = "username"
+)
+
+const authThrottleSweepInterval = time.Minute
+
+var errAuthThrottled = errors.New("c2s: authentication temporarily locked")
+
+// AuthBan represents an active authentication lockout.
+type AuthBan struct {
+	Kind     string    `json:"kind"`
+	Value    string    `json:"value"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+type authFailures struct {
+	count       int
+	lastFailure time.Time
+	retryAt     time.Time
+	bannedUntil time.Time
+}
+
+// authThrottler keeps track of failed authentication attempts
+// applying an exponential back-off and temporary bans to offending peers.
+type authThrottler struct {
+	cfg     *AuthThrottleConfig
+	mu      sync.Mutex
+	entries map[string]*authFailures
+	nowFn   func() time.Time
+	closeCh chan struct{}
+	stopped uint32
+}
+
+func newAuthThrottler(cfg *AuthThrottleConfig) *authThrottler {
+	return &authThrottler{
+		cfg:     cfg,
+		entries: make(map[string]*authFailures),
+		nowFn:   time.Now,
+		closeCh: make(chan struct{}),
+	}
+}
+
+// start periodically evicts expired entries, so that failures coming from
+// addresses that never show up again don't pile up in memory.
+func (t *authThrottler) start() {
+	go t.sweepLoop(authThrottleSweepInterval)
+}
+
+func (t *authThrottler) stop() {
+	if atomic.CompareAndSwapUint32(&t.stopped, 0, 1) {
+		close(t.closeCh)
+	}
+}
+
+func (t *authThrottler) sweepLoop(interval time.Duration) {
+	tc := time.NewTicker(interval)
+	defer tc.Stop()
+	for {
+		select {
+		case <-tc.C:
+			t.sweep()
+		case <-t.closeCh:
+			return
+		}
+	}
+}
+
+// sweep removes every expired entry.
+func (t *authThrottler) sweep() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.nowFn()
+	for k, f := range t.entries {
+		if t.expired(f, now) {
+			delete(t.entries, k)
+		}
+	}
+}
+
+// delay returns the remaining time before a new authentication attempt
+// can be made for a given key, and whether or not it is currently banned.
+func (t *authThrottler) delay(kind, value string) (time.Duration, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.nowFn()
+	f := t.entry(kind, value, now)
+	if f == nil {
+		return 0, false
+	}
+	if now.Before(f.bannedUntil) {
+		return f.bannedUntil.Sub(now), true
+	}
+	if now.Before(f.retryAt) {
+		return f.retryAt.Sub(now), false
+	}
+	return 0, false
+}
+
+// fail registers a failed authentication attempt.
+func (t *authThrottler) fail(kind, value string) {
+	if len(value) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.nowFn()
+	f := t.entry(kind, value, now)
+	if f == nil {
+		f = &authFailures{}
+		t.entries[throttleKey(kind, value)] = f
+	}
+	f.count++
+	f.lastFailure = now
+
+	backoff := t.cfg.Backoff << uint(f.count-1)
+	if backoff <= 0 || backoff > t.cfg.MaxBackoff {
+		backoff = t.cfg.MaxBackoff
+	}
+	f.retryAt = now.Add(backoff)
+
+	if f.count >= t.cfg.MaxFailures && !now.Before(f.bannedUntil) {
+		f.bannedUntil = now.Add(t.cfg.BanDuration)
+		log.Warnf("c2s: authentication locked out... (%s: %s, failures: %d, until: %v)", kind, value, f.count, f.bannedUntil)
+	}
+}
+
+// succeed clears failure history associated to a given key.
+func (t *authThrottler) succeed(kind, value string) {
+	if len(value) == 0 {
+		return
+	}
+	t.mu.Lock()
+	delete(t.entries, throttleKey(kind, value))
+	t.mu.Unlock()
+}
+
+// bans returns currently active authentication bans.
+func (t *authThrottler) bans() []AuthBan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ret []AuthBan
+	now := t.nowFn()
+	for k, f := range t.entries {
+		if t.expired(f, now) {
+			delete(t.entries, k)
+			continue
+		}
+		if !now.Before(f.bannedUntil) {
+			continue
+		}
+		kind, value := splitThrottleKey(k)
+		ret = append(ret, AuthBan{Kind: kind, Value: value, Failures: f.count, Until: f.bannedUntil})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Until.Before(ret[j].Until) })
+	return ret
+}
+
+func (t *authThrottler) entry(kind, value string, now time.Time) *authFailures {
+	k := throttleKey(kind, value)
+	f := t.entries[k]
+	if f == nil {
+		return nil
+	}
+	if t.expired(f, now) {
+		delete(t.entries, k)
+		return nil
+	}
+	return f
+}
+
+func (t *authThrottler) expired(f *authFailures, now time.Time) bool {
+	// forget failures once a ban has been served or after a quiet period
+	if !f.bannedUntil.IsZero() {
+		return !now.Before(f.bannedUntil)
+	}
+	return now.Sub(f.lastFailure) > t.cfg.BanDuration
+}
+
+func throttleKey(kind, value string) string {
+	return kind + ":" + value
+}
+
+func splitThrottleKey(key string) (kind, value string) {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// throttledUserRep wraps a user repository denying user lookups
+// for those usernames currently locked out by the authentication throttler.
+type throttledUserRep struct {
+	repository.User
+	throttler *authThrottler
+	username  string
+}
+
+func (r *throttledUserRep) FetchUser(ctx context.Context, userJID string) (*model.User, error) {
+	r.username = userJID
+	if d, _ := r.throttler.delay(usernameThrottleKind, userJID); d > 0 {
+		return nil, errAuthThrottled
+	}
+	return r.User.FetchUser(ctx, userJID)
+}
+
+func hostFromAddr(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
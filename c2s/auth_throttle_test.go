@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package c2s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthThrottler_Backoff(t *testing.T) {
+	th, now := tUtilAuthThrottler()
+
+	d, banned := th.delay(ipThrottleKind, "127.0.0.1")
+	require.Equal(t, time.Duration(0), d)
+	require.False(t, banned)
+
+	th.fail(ipThrottleKind, "127.0.0.1")
+	d, banned = th.delay(ipThrottleKind, "127.0.0.1")
+	require.Equal(t, time.Second, d)
+	require.False(t, banned)
+
+	th.fail(ipThrottleKind, "127.0.0.1")
+	d, _ = th.delay(ipThrottleKind, "127.0.0.1")
+	require.Equal(t, time.Second*2, d)
+
+	th.fail(ipThrottleKind, "127.0.0.1")
+	d, _ = th.delay(ipThrottleKind, "127.0.0.1")
+	require.Equal(t, time.Second*3, d) // capped by max back-off
+
+	*now = now.Add(time.Second * 3)
+	d, _ = th.delay(ipThrottleKind, "127.0.0.1")
+	require.Equal(t, time.Duration(0), d)
+
+	// other keys are not affected
+	d, _ = th.delay(usernameThrottleKind, "127.0.0.1")
+	require.Equal(t, time.Duration(0), d)
+
+	th.succeed(ipThrottleKind, "127.0.0.1")
+	require.Len(t, th.entries, 0)
+}
+
+func TestAuthThrottler_Ban(t *testing.T) {
+	th, now := tUtilAuthThrottler()
+
+	for i := 0; i < 4; i++ {
+		th.fail(usernameThrottleKind, "ortuman")
+	}
+	d, banned := th.delay(usernameThrottleKind, "ortuman")
+	require.True(t, banned)
+	require.Equal(t, time.Minute, d)
+
+	bans := th.bans()
+	require.Len(t, bans, 1)
+	require.Equal(t, usernameThrottleKind, bans[0].Kind)
+	require.Equal(t, "ortuman", bans[0].Value)
+	require.Equal(t, 4, bans[0].Failures)
+
+	// ban expiration
+	*now = now.Add(time.Minute)
+	_, banned = th.delay(usernameThrottleKind, "ortuman")
+	require.False(t, banned)
+	require.Len(t, th.bans(), 0)
+}
+
+func TestAuthThrottler_Sweep(t *testing.T) {
+	th, now := tUtilAuthThrottler()
+
+	th.fail(ipThrottleKind, "192.0.2.1")
+	for i := 0; i < 4; i++ {
+		th.fail(ipThrottleKind, "192.0.2.2")
+	}
+	*now = now.Add(time.Second * 30)
+	th.fail(ipThrottleKind, "192.0.2.3")
+
+	// addresses never showing up again must be evicted as well
+	*now = now.Add(time.Second * 31)
+	th.sweep()
+	require.Len(t, th.entries, 1)
+	require.NotNil(t, th.entries[throttleKey(ipThrottleKind, "192.0.2.3")])
+
+	*now = now.Add(time.Minute)
+	th.sweep()
+	require.Len(t, th.entries, 0)
+}
+
+func TestAuthThrottler_UserRep(t *testing.T) {
+	r, userRep, blockListRep := setupTest("localhost")
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "ortuman", Domain: "localhost", Password: "1234"})
+
+	th, _ := tUtilAuthThrottler()
+
+	rep := &throttledUserRep{User: userRep, throttler: th}
+	usr, err := rep.FetchUser(context.Background(), "ortuman@localhost")
+	require.Nil(t, err)
+	require.NotNil(t, usr)
+	require.Equal(t, "ortuman@localhost", rep.username)
+
+	th.fail(usernameThrottleKind, "ortuman@localhost")
+	usr, err = rep.FetchUser(context.Background(), "ortuman@localhost")
+	require.Equal(t, errAuthThrottled, err)
+	require.Nil(t, usr)
+
+	// lock out stream after exceeding max attempts
+	cfg := tUtilInStreamDefaultConfig()
+	cfg.authThrottler = th
+
+	stm, conn := tUtilStreamInitWithConfig(r, userRep, blockListRep, cfg)
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	for i := 0; i < th.cfg.MaxAttempts; i++ {
+		_, _ = conn.inboundWrite([]byte(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="PLAIN">AG9ydHVtYW4AMTIzNA==</auth>`))
+
+		elem := conn.outboundRead()
+		require.Equal(t, "failure", elem.Name())
+		require.NotNil(t, elem.Elements().Child("temporary-auth-failure"))
+	}
+	_, _ = conn.inboundWrite([]byte(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="PLAIN">AG9ydHVtYW4AMTIzNA==</auth>`))
+	require.True(t, conn.waitClose())
+	require.Equal(t, disconnected, stm.getState())
+}
+
+func tUtilAuthThrottler() (*authThrottler, *time.Time) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	th := newAuthThrottler(&AuthThrottleConfig{
+		MaxAttempts: 3,
+		MaxFailures: 4,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Second * 3,
+		BanDuration: time.Minute,
+	})
+	th.nowFn = func() time.Time { return now }
+	return th, &now
+}
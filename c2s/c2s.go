@@ -7,6 +7,9 @@ package c2s
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -31,6 +34,9 @@ const (
 type c2sServer interface {
 	start()
 	shutdown(ctx context.Context) error
+	stopListening() error
+	drain(ctx context.Context, seeOtherHost string) error
+	authBans() []AuthBan
 }
 
 var createC2SServer = newC2SServer
@@ -64,6 +70,58 @@ func (c *C2S) Start() {
 	}
 }
 
+// AuthBans returns currently active authentication bans indexed by c2s listener identifier.
+func (c *C2S) AuthBans() map[string][]AuthBan {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ret := make(map[string][]AuthBan, len(c.servers))
+	for id, srv := range c.servers {
+		ret[id] = srv.authBans()
+	}
+	return ret
+}
+
+// Drain stops accepting new connections and redirects connected clients to seeOtherHost
+// (if not empty) by means of a 'see-other-host' stream error, waiting until every stream
+// has been closed or ctx is done.
+func (c *C2S) Drain(ctx context.Context, seeOtherHost string) error {
+	if atomic.LoadUint32(&c.started) == 0 {
+		return nil
+	}
+	var mu sync.Mutex
+	var errs []string
+	addErr := func(id string, err error) {
+		mu.Lock()
+		errs = append(errs, fmt.Sprintf("%s: %v", id, err))
+		mu.Unlock()
+	}
+	// stop accepting connections on every listener before draining any of them
+	for id, srv := range c.servers {
+		if err := srv.stopListening(); err != nil {
+			addErr(id, err)
+		}
+	}
+	// ...and drain every server concurrently, even if some of them fail
+	var wg sync.WaitGroup
+	for id, srv := range c.servers {
+		wg.Add(1)
+		go func(id string, srv c2sServer) {
+			defer wg.Done()
+			if err := srv.drain(ctx, seeOtherHost); err != nil {
+				addErr(id, err)
+			}
+		}(id, srv)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.Errorf("c2s: failed to drain %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 // Shutdown gracefully shuts down c2s manager.
 func (c *C2S) Shutdown(ctx context.Context) {
 	if atomic.CompareAndSwapUint32(&c.started, 1, 0) {
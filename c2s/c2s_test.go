@@ -11,6 +11,7 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -161,7 +162,7 @@ func setupTest(domain string) (router.Router, repository.User, repository.BlockL
 	blockListRep := memorystorage.NewBlockList()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(userRep, blockListRep),
+		c2srouter.New(userRep, blockListRep, nil),
 		nil,
 	)
 	return r, userRep, blockListRep
@@ -170,12 +171,19 @@ func setupTest(domain string) (router.Router, repository.User, repository.BlockL
 type fakeC2SServer struct {
 	startCh    chan struct{}
 	shutdownCh chan struct{}
+	drainCh    chan string
+	drainErr   error
+
+	mu      sync.Mutex
+	events  []string
+	barrier *sync.WaitGroup
 }
 
 func newFakeC2SServer() *fakeC2SServer {
 	return &fakeC2SServer{
 		startCh:    make(chan struct{}, 1),
 		shutdownCh: make(chan struct{}, 1),
+		drainCh:    make(chan string, 2),
 	}
 }
 
@@ -188,6 +196,36 @@ func (s *fakeC2SServer) shutdown(ctx context.Context) error {
 	return nil
 }
 
+func (s *fakeC2SServer) stopListening() error {
+	s.addEvent("stop")
+	return nil
+}
+
+func (s *fakeC2SServer) drain(ctx context.Context, seeOtherHost string) error {
+	s.addEvent("drain")
+	s.drainCh <- seeOtherHost
+	if s.barrier != nil {
+		// wait until every server is being drained
+		s.barrier.Done()
+		doneCh := make(chan struct{})
+		go func() { s.barrier.Wait(); close(doneCh) }()
+		select {
+		case <-doneCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return s.drainErr
+}
+
+func (s *fakeC2SServer) addEvent(event string) {
+	s.mu.Lock()
+	s.events = append(s.events, event)
+	s.mu.Unlock()
+}
+
+func (s *fakeC2SServer) authBans() []AuthBan { return nil }
+
 func TestC2S_StartAndShutdown(t *testing.T) {
 	c2s, fakeSrv := setupTestC2S("localhost")
 
@@ -208,6 +246,52 @@ func TestC2S_StartAndShutdown(t *testing.T) {
 	}
 }
 
+func TestC2S_Drain(t *testing.T) {
+	c2s, fakeSrv := setupTestC2S("localhost")
+
+	// not started
+	require.Nil(t, c2s.Drain(context.Background(), "xmpp2.localhost"))
+
+	c2s.Start()
+	<-fakeSrv.startCh
+
+	require.Nil(t, c2s.Drain(context.Background(), "xmpp2.localhost"))
+	select {
+	case seeOtherHost := <-fakeSrv.drainCh:
+		require.Equal(t, "xmpp2.localhost", seeOtherHost)
+	case <-time.After(time.Millisecond * 250):
+		require.Fail(t, "c2s drain timeout")
+	}
+	c2s.Shutdown(context.Background())
+}
+
+func TestC2S_DrainErrors(t *testing.T) {
+	srv := newFakeC2SServer()
+	srv.drainErr = errors.New("foo")
+	srv.barrier = &sync.WaitGroup{}
+	srv.barrier.Add(2)
+	createC2SServer = func(_ *Config, _ *module.Modules, _ *component.Components, _ router.Router, _ repository.User, _ repository.BlockList) c2sServer {
+		return srv
+	}
+	c2s, _ := New([]Config{{ID: "c2s-1"}, {ID: "c2s-2"}}, &module.Modules{}, &component.Components{}, nil, nil, nil)
+
+	c2s.Start()
+	<-srv.startCh
+	<-srv.startCh
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// every server is drained concurrently, regardless of previous failures
+	err := c2s.Drain(ctx, "")
+	require.NotNil(t, err)
+	require.Equal(t, "c2s: failed to drain c2s-1: foo; c2s-2: foo", err.Error())
+	require.Len(t, srv.drainCh, 2)
+
+	// all listeners are stopped before draining connections
+	require.Equal(t, []string{"stop", "stop", "drain", "drain"}, srv.events)
+}
+
 func setupTestC2S(domain string) (*C2S, *fakeC2SServer) {
 	srv := newFakeC2SServer()
 	createC2SServer = func(_ *Config, _ *module.Modules, _ *component.Components, _ router.Router, _ repository.User, _ repository.BlockList) c2sServer {
@@ -220,7 +304,7 @@ func setupTestC2S(domain string) (*C2S, *fakeC2SServer) {
 	blockListRep := memorystorage.NewBlockList()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(userRep, blockListRep),
+		c2srouter.New(userRep, blockListRep, nil),
 		nil,
 	)
 
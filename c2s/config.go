@@ -6,6 +6,9 @@
 package c2s
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -13,6 +16,9 @@ import (
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/transport/compress"
+	"github.com/ortuman/jackal/util/proxyproto"
+	"github.com/ortuman/jackal/util/ratelimit"
+	utiltls "github.com/ortuman/jackal/util/tls"
 )
 
 const (
@@ -22,6 +28,12 @@ const (
 	defaultTransportPort      = 5222
 	defaultTransportKeepAlive = time.Duration(120) * time.Second
 	defaultTransportURLPath   = "/xmpp/ws"
+
+	defaultAuthMaxAttempts = 5
+	defaultAuthMaxFailures = 10
+	defaultAuthBackoff     = time.Second
+	defaultAuthMaxBackoff  = time.Duration(60) * time.Second
+	defaultAuthBanDuration = time.Duration(15) * time.Minute
 )
 
 // ResourceConflictPolicy represents a resource conflict policy.
@@ -38,6 +50,72 @@ const (
 	Replace
 )
 
+// ClientCertPolicy represents a client certificate request policy.
+type ClientCertPolicy int
+
+const (
+	// NoClientCert represents 'none' client certificate policy.
+	NoClientCert ClientCertPolicy = iota
+
+	// OptionalClientCert represents 'optional' client certificate policy.
+	OptionalClientCert
+
+	// RequiredClientCert represents 'required' client certificate policy.
+	RequiredClientCert
+)
+
+// ClientCertConfig represents a client certificate authentication configuration.
+type ClientCertConfig struct {
+	Policy ClientCertPolicy
+	CAFile string
+	CAs    *x509.CertPool
+}
+
+type clientCertProxyType struct {
+	Policy string `yaml:"policy"`
+	CAFile string `yaml:"ca_path"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *ClientCertConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := clientCertProxyType{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	switch strings.ToLower(p.Policy) {
+	case "", "none":
+		c.Policy = NoClientCert
+		return nil
+	case "optional":
+		c.Policy = OptionalClientCert
+	case "required":
+		c.Policy = RequiredClientCert
+	default:
+		return fmt.Errorf("c2s.ClientCertConfig: unrecognized client certificate policy: %s", p.Policy)
+	}
+	if len(p.CAFile) == 0 {
+		return errors.New("c2s.ClientCertConfig: must specify a CA bundle")
+	}
+	cas, err := utiltls.LoadCertPool(p.CAFile)
+	if err != nil {
+		return err
+	}
+	c.CAFile = p.CAFile
+	c.CAs = cas
+	return nil
+}
+
+func (c *ClientCertConfig) clientAuthType() tls.ClientAuthType {
+	switch c.Policy {
+	case OptionalClientCert:
+		return tls.VerifyClientCertIfGiven
+	case RequiredClientCert:
+		return tls.RequireAndVerifyClientCert
+	default:
+		return tls.NoClientCert
+	}
+}
+
 // CompressConfig represents a server Stream compression configuration.
 type CompressConfig struct {
 	Level compress.Level
@@ -70,18 +148,20 @@ func (c *CompressConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 
 // TransportConfig represents an XMPP stream transport configuration.
 type TransportConfig struct {
-	Type        transport.Type
-	BindAddress string
-	Port        int
-	URLPath     string
+	Type          transport.Type
+	BindAddress   string
+	Port          int
+	URLPath       string
+	ProxyProtocol *proxyproto.Config
 }
 
 type transportProxyType struct {
-	Type        string `yaml:"type"`
-	BindAddress string `yaml:"bind_addr"`
-	Port        int    `yaml:"port"`
-	KeepAlive   int    `yaml:"keep_alive"`
-	URLPath     string `yaml:"url_path"`
+	Type          string             `yaml:"type"`
+	BindAddress   string             `yaml:"bind_addr"`
+	Port          int                `yaml:"port"`
+	KeepAlive     int                `yaml:"keep_alive"`
+	URLPath       string             `yaml:"url_path"`
+	ProxyProtocol *proxyproto.Config `yaml:"proxy_protocol"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -98,8 +178,13 @@ func (t *TransportConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	default:
 		return fmt.Errorf("c2s.TransportConfig: unrecognized transport type: %s", p.Type)
 	}
+	// PROXY protocol headers are only read from raw socket connections
+	if p.ProxyProtocol != nil && t.Type != transport.Socket {
+		return fmt.Errorf("c2s.TransportConfig: proxy_protocol not supported by %s transport", t.Type)
+	}
 	t.BindAddress = p.BindAddress
 	t.Port = p.Port
+	t.ProxyProtocol = p.ProxyProtocol
 
 	t.URLPath = p.URLPath
 	if len(t.URLPath) == 0 {
@@ -113,6 +198,56 @@ func (t *TransportConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	return nil
 }
 
+// AuthThrottleConfig represents a c2s authentication throttling configuration.
+type AuthThrottleConfig struct {
+	MaxAttempts int
+	MaxFailures int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	BanDuration time.Duration
+}
+
+type authThrottleProxyType struct {
+	MaxAttempts int `yaml:"max_attempts"`
+	MaxFailures int `yaml:"max_failures"`
+	Backoff     int `yaml:"backoff"`
+	MaxBackoff  int `yaml:"max_backoff"`
+	BanDuration int `yaml:"ban_duration"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (a *AuthThrottleConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := authThrottleProxyType{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	a.MaxAttempts = p.MaxAttempts
+	a.MaxFailures = p.MaxFailures
+	a.Backoff = time.Duration(p.Backoff) * time.Second
+	a.MaxBackoff = time.Duration(p.MaxBackoff) * time.Second
+	a.BanDuration = time.Duration(p.BanDuration) * time.Second
+	a.setDefaults()
+	return nil
+}
+
+func (a *AuthThrottleConfig) setDefaults() {
+	if a.MaxAttempts == 0 {
+		a.MaxAttempts = defaultAuthMaxAttempts
+	}
+	if a.MaxFailures == 0 {
+		a.MaxFailures = defaultAuthMaxFailures
+	}
+	if a.Backoff == 0 {
+		a.Backoff = defaultAuthBackoff
+	}
+	if a.MaxBackoff == 0 {
+		a.MaxBackoff = defaultAuthMaxBackoff
+	}
+	if a.BanDuration == 0 {
+		a.BanDuration = defaultAuthBanDuration
+	}
+}
+
 // TLSConfig represents a server TLS configuration.
 type TLSConfig struct {
 	CertFile    string `yaml:"cert_path"`
@@ -129,21 +264,29 @@ type Config struct {
 	ResourceConflict ResourceConflictPolicy
 	Transport        TransportConfig
 	SASL             []string
+	ClientCert       ClientCertConfig
 	Compression      CompressConfig
+	AuthThrottle     AuthThrottleConfig
+	RateLimit        *ratelimit.Config
+	UserRateLimit    *ratelimit.Config
 }
 
 type configProxy struct {
-	ID               string          `yaml:"id"`
-	Domain           string          `yaml:"domain"`
-	TLS              TLSConfig       `yaml:"tls"`
-	ConnectTimeout   int             `yaml:"connect_timeout"`
-	Timeout          int             `yaml:"timeout"`
-	KeepAlive        int             `yaml:"keep_alive"`
-	MaxStanzaSize    int             `yaml:"max_stanza_size"`
-	ResourceConflict string          `yaml:"resource_conflict"`
-	Transport        TransportConfig `yaml:"transport"`
-	SASL             []string        `yaml:"sasl"`
-	Compression      CompressConfig  `yaml:"compression"`
+	ID               string              `yaml:"id"`
+	Domain           string              `yaml:"domain"`
+	TLS              TLSConfig           `yaml:"tls"`
+	ConnectTimeout   int                 `yaml:"connect_timeout"`
+	Timeout          int                 `yaml:"timeout"`
+	KeepAlive        int                 `yaml:"keep_alive"`
+	MaxStanzaSize    int                 `yaml:"max_stanza_size"`
+	ResourceConflict string              `yaml:"resource_conflict"`
+	Transport        TransportConfig     `yaml:"transport"`
+	SASL             []string            `yaml:"sasl"`
+	ClientCert       ClientCertConfig    `yaml:"client_cert"`
+	Compression      CompressConfig      `yaml:"compression"`
+	AuthThrottle     *AuthThrottleConfig `yaml:"auth_throttle"`
+	RateLimit        *ratelimit.Config   `yaml:"rate_limit"`
+	UserRateLimit    *ratelimit.Config   `yaml:"user_rate_limit"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -187,13 +330,26 @@ func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		switch sasl {
 		case "plain", "digest_md5", "scram_sha_1", "scram_sha_256", "scram_sha_512":
 			continue
+		case "external":
+			if p.ClientCert.Policy == NoClientCert {
+				return errors.New("c2s.Config: external SASL mechanism requires client certificates")
+			}
 		default:
 			return fmt.Errorf("c2s.Config: unrecognized SASL mechanism: %s", sasl)
 		}
 	}
 	cfg.Transport = p.Transport
 	cfg.SASL = p.SASL
+	cfg.ClientCert = p.ClientCert
 	cfg.Compression = p.Compression
+
+	if p.AuthThrottle != nil {
+		cfg.AuthThrottle = *p.AuthThrottle
+	} else {
+		cfg.AuthThrottle.setDefaults()
+	}
+	cfg.RateLimit = p.RateLimit
+	cfg.UserRateLimit = p.UserRateLimit
 	return nil
 }
 
@@ -204,6 +360,10 @@ type streamConfig struct {
 	maxStanzaSize    int
 	resourceConflict ResourceConflictPolicy
 	sasl             []string
+	clientCert       ClientCertConfig
 	compression      CompressConfig
+	authThrottler    *authThrottler
+	rateLimit        *ratelimit.Config
+	userLimiters     *ratelimit.Registry
 	onDisconnect     func(s stream.C2S)
 }
@@ -6,8 +6,10 @@
 package c2s
 
 import (
+	"crypto/tls"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/transport/compress"
@@ -36,6 +38,35 @@ func TestCompressionConfig(t *testing.T) {
 	require.NotNil(t, err)
 }
 
+func TestClientCertConfig(t *testing.T) {
+	cc := ClientCertConfig{}
+	err := yaml.Unmarshal([]byte("{policy: none}"), &cc)
+	require.Nil(t, err)
+	require.Equal(t, NoClientCert, cc.Policy)
+	require.Equal(t, tls.NoClientCert, cc.clientAuthType())
+
+	err = yaml.Unmarshal([]byte("{policy: optional, ca_path: ../testdata/cert/test.server.crt}"), &cc)
+	require.Nil(t, err)
+	require.Equal(t, OptionalClientCert, cc.Policy)
+	require.NotNil(t, cc.CAs)
+	require.Equal(t, tls.VerifyClientCertIfGiven, cc.clientAuthType())
+
+	err = yaml.Unmarshal([]byte("{policy: required, ca_path: ../testdata/cert/test.server.crt}"), &cc)
+	require.Nil(t, err)
+	require.Equal(t, RequiredClientCert, cc.Policy)
+	require.Equal(t, tls.RequireAndVerifyClientCert, cc.clientAuthType())
+
+	// missing CA bundle
+	err = yaml.Unmarshal([]byte("{policy: required}"), &cc)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{policy: required, ca_path: ../testdata/cert/missing.crt}"), &cc)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{policy: unknown}"), &cc)
+	require.NotNil(t, err)
+}
+
 func TestTransportConfig(t *testing.T) {
 	s := TransportConfig{}
 
@@ -73,10 +104,61 @@ sasl: [plain, digest_md5, scram_sha_1, scram_sha_256, scram_sha_512]
 	require.Nil(t, err)
 	require.Equal(t, 5, len(s.SASL))
 
+	// external auth mechanism...
+	err = yaml.Unmarshal([]byte("{id: default, sasl: [external]}"), &s)
+	require.NotNil(t, err)
+
+	externalCfg := `
+id: default
+sasl: [external]
+client_cert:
+  policy: optional
+  ca_path: ../testdata/cert/test.server.crt
+`
+	err = yaml.Unmarshal([]byte(externalCfg), &s)
+	require.Nil(t, err)
+	require.Equal(t, OptionalClientCert, s.ClientCert.Policy)
+
 	// invalid auth mechanism...
 	err = yaml.Unmarshal([]byte("{id: default, type: c2s, sasl: [invalid]}"), &s)
 	require.NotNil(t, err)
 
+	// auth throttling...
+	require.Equal(t, defaultAuthMaxAttempts, s.AuthThrottle.MaxAttempts)
+	require.Equal(t, defaultAuthBanDuration, s.AuthThrottle.BanDuration)
+
+	throttleCfg := `
+connect_timeout: 5
+auth_throttle:
+  max_attempts: 2
+  max_failures: 4
+  backoff: 2
+  ban_duration: 60
+`
+	err = yaml.Unmarshal([]byte(throttleCfg), &s)
+	require.Nil(t, err)
+	require.Equal(t, 2, s.AuthThrottle.MaxAttempts)
+	require.Equal(t, 4, s.AuthThrottle.MaxFailures)
+	require.Equal(t, time.Second*2, s.AuthThrottle.Backoff)
+	require.Equal(t, defaultAuthMaxBackoff, s.AuthThrottle.MaxBackoff)
+	require.Equal(t, time.Minute, s.AuthThrottle.BanDuration)
+
+	// rate limiting...
+	rateLimitCfg := `
+rate_limit:
+  bytes_per_sec: 8192
+  stanzas_per_sec: 50
+  max_throttle: 10
+user_rate_limit:
+  stanzas_per_sec: 100
+`
+	err = yaml.Unmarshal([]byte(rateLimitCfg), &s)
+	require.Nil(t, err)
+	require.Equal(t, 8192, s.RateLimit.BytesPerSec)
+	require.Equal(t, 50, s.RateLimit.StanzasPerSec)
+	require.Equal(t, time.Second*10, s.RateLimit.MaxThrottle)
+	require.Equal(t, 100, s.UserRateLimit.StanzasPerSec)
+
 	// invalid yaml
 	err = yaml.Unmarshal([]byte("type"), &s)
 	require.NotNil(t, err)
@@ -8,6 +8,7 @@ package c2s
 import (
 	"context"
 	"crypto/tls"
+	"net"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -24,6 +25,7 @@ import (
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/transport/compress"
+	"github.com/ortuman/jackal/util/ratelimit"
 	"github.com/ortuman/jackal/util/runqueue"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
@@ -54,6 +56,10 @@ type inStream struct {
 	state          uint32
 	authenticators []auth.Authenticator
 	activeAuth     auth.Authenticator
+	authUserRep    *throttledUserRep
+	authAttempts   int
+	limiter        *ratelimit.Limiter
+	userLimiter    *ratelimit.Limiter
 	runQueue       *runqueue.RunQueue
 	jid            *jid.JID
 	secured        bool
@@ -80,6 +86,11 @@ func newStream(id string, config *streamConfig, tr transport.Transport, mods *mo
 		ctx:          ctx,
 		ctxCancelFn:  ctxCancelFn,
 	}
+	// shape inbound traffic
+	if config.rateLimit != nil {
+		s.limiter = ratelimit.New(config.rateLimit)
+		s.tr = transport.NewRateLimitedTransport(tr, s.limiter)
+	}
 
 	// initialize stream context
 	secured := !(tr.Type() == transport.Socket)
@@ -145,6 +156,11 @@ func (s *inStream) JID() *jid.JID {
 	return s.jid
 }
 
+// RemoteAddr returns the network address of the connected peer.
+func (s *inStream) RemoteAddr() net.Addr {
+	return s.tr.RemoteAddr()
+}
+
 // IsAuthenticated returns whether or not the XMPP stream has successfully authenticated.
 func (s *inStream) IsAuthenticated() bool {
 	s.mu.RLock()
@@ -190,23 +206,32 @@ func (s *inStream) Disconnect(ctx context.Context, err error) {
 func (s *inStream) initializeAuthenticators() {
 	tr := s.tr
 	hasChannelBinding := len(tr.ChannelBindingBytes(transport.TLSUnique)) > 0
+
+	userRep := s.userRep
+	if th := s.cfg.authThrottler; th != nil {
+		s.authUserRep = &throttledUserRep{User: s.userRep, throttler: th}
+		userRep = s.authUserRep
+	}
 	var authenticators []auth.Authenticator
 	for _, a := range s.cfg.sasl {
 		switch a {
 		case "plain":
-			authenticators = append(authenticators, auth.NewPlain(s, s.userRep))
+			authenticators = append(authenticators, auth.NewPlain(s, userRep))
 
 		case "scram_sha_1":
-			authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA1, false, s.userRep))
+			authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA1, false, userRep))
 			if hasChannelBinding {
-				authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA1, true, s.userRep))
+				authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA1, true, userRep))
 			}
 
 		case "scram_sha_256":
-			authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA256, false, s.userRep))
+			authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA256, false, userRep))
 			if hasChannelBinding {
-				authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA256, true, s.userRep))
+				authenticators = append(authenticators, auth.NewScram(s, tr, auth.ScramSHA256, true, userRep))
 			}
+
+		case "external":
+			authenticators = append(authenticators, auth.NewExternal(s, tr, s.cfg.clientCert.CAs, userRep))
 		}
 	}
 	s.authenticators = authenticators
@@ -282,6 +307,9 @@ func (s *inStream) unauthenticatedFeatures() []xmpp.XElement {
 		mechanisms := xmpp.NewElementName("mechanisms")
 		mechanisms.SetNamespace(saslNamespace)
 		for _, ath := range s.authenticators {
+			if ath.Mechanism() == auth.ExternalMechanism && len(s.tr.PeerCertificates()) == 0 {
+				continue // no client certificate presented
+			}
 			mechanism := xmpp.NewElementName("mechanism")
 			mechanism.SetText(ath.Mechanism())
 			mechanisms.AppendElement(mechanism)
@@ -292,7 +320,7 @@ func (s *inStream) unauthenticatedFeatures() []xmpp.XElement {
 	// allow In-band registration over encrypted stream only
 	allowRegistration := s.IsSecured()
 
-	if reg := s.mods.Register; reg != nil && allowRegistration {
+	if reg := s.mods.Register; reg != nil && allowRegistration && s.isModuleEnabled("registration") {
 		registerFeature := xmpp.NewElementNamespace("register", "http://jabber.org/features/iq-register")
 		features = append(features, registerFeature)
 	}
@@ -322,9 +350,13 @@ func (s *inStream) authenticatedFeatures() []xmpp.XElement {
 	sessElem := xmpp.NewElementNamespace("session", "urn:ietf:params:xml:ns:xmpp-session")
 	features = append(features, sessElem)
 
-	if s.mods.Roster != nil {
+	if s.mods.Roster != nil && s.isModuleEnabled("roster") {
 		ver := xmpp.NewElementNamespace("ver", "urn:xmpp:features:rosterver")
 		features = append(features, ver)
+
+		// [rfc6121] subscription pre-approval
+		sub := xmpp.NewElementNamespace("sub", "urn:xmpp:features:pre-approval")
+		features = append(features, sub)
 	}
 	return features
 }
@@ -339,7 +371,7 @@ func (s *inStream) handleConnected(ctx context.Context, elem xmpp.XElement) {
 
 	case "iq":
 		iq := elem.(*xmpp.IQ)
-		if reg := s.mods.Register; reg != nil && reg.MatchesIQ(iq) {
+		if reg := s.mods.Register; reg != nil && s.isModuleEnabled("registration") && reg.MatchesIQ(iq) {
 			if s.IsSecured() {
 				reg.ProcessIQWithStream(ctx, iq, s)
 			} else {
@@ -444,7 +476,12 @@ func (s *inStream) proceedStartTLS(ctx context.Context, elem xmpp.XElement) {
 	s.setSecured(true)
 	s.writeElement(ctx, xmpp.NewElementNamespace("proceed", tlsNamespace))
 
-	s.tr.StartTLS(&tls.Config{Certificates: s.router.Hosts().Certificates()}, false)
+	tlsCfg := &tls.Config{GetCertificate: s.router.Hosts().GetCertificate}
+	if cc := s.cfg.clientCert; cc.Policy != NoClientCert {
+		tlsCfg.ClientAuth = cc.clientAuthType()
+		tlsCfg.ClientCAs = cc.CAs
+	}
+	s.tr.StartTLS(tlsCfg, false)
 
 	log.Infof("secured stream... id: %s", s.id)
 	s.restartSession()
@@ -483,6 +520,9 @@ func (s *inStream) startAuthentication(ctx context.Context, elem xmpp.XElement)
 		s.disconnectWithStreamError(ctx, streamerror.ErrInvalidNamespace)
 		return
 	}
+	if !s.allowAuthAttempt(ctx) {
+		return
+	}
 	mechanism := elem.Attributes().Get("mechanism")
 	for _, authenticator := range s.authenticators {
 		if authenticator.Mechanism() == mechanism {
@@ -506,7 +546,12 @@ func (s *inStream) startAuthentication(ctx context.Context, elem xmpp.XElement)
 
 func (s *inStream) continueAuthentication(ctx context.Context, elem xmpp.XElement, authr auth.Authenticator) error {
 	err := authr.ProcessElement(ctx, elem)
-	if saslErr, ok := err.(*auth.SASLError); ok {
+	authentications.WithLabelValues(authr.Mechanism(), authOutcome(authr, err)).Inc()
+
+	if err == errAuthThrottled {
+		s.failAuthentication(ctx, auth.ErrSASLTemporaryAuthFailure.(*auth.SASLError).Element())
+	} else if saslErr, ok := err.(*auth.SASLError); ok {
+		s.registerAuthFailure()
 		s.failAuthentication(ctx, saslErr.Element())
 	} else if err != nil {
 		log.Error(err)
@@ -515,12 +560,32 @@ func (s *inStream) continueAuthentication(ctx context.Context, elem xmpp.XElemen
 	return err
 }
 
+func authOutcome(authr auth.Authenticator, err error) string {
+	if err == errAuthThrottled {
+		return "throttled"
+	} else if _, ok := err.(*auth.SASLError); ok {
+		return "failure"
+	} else if err != nil {
+		return "error"
+	} else if authr.Authenticated() {
+		return "success"
+	}
+	return "challenge"
+}
+
 func (s *inStream) finishAuthentication(_ context.Context, username string) {
 	if s.activeAuth != nil {
 		s.activeAuth.Reset()
 		s.activeAuth = nil
 	}
 	j, _ := jid.New(username, s.Domain(), "", true)
+	if th := s.cfg.authThrottler; th != nil {
+		th.succeed(ipThrottleKind, s.remoteIP())
+		th.succeed(usernameThrottleKind, j.String())
+	}
+	if ul := s.cfg.userLimiters; ul != nil {
+		s.userLimiter = ul.Acquire(j.String())
+	}
 	s.setJID(j)
 	s.setAuthenticated(true)
 
@@ -539,6 +604,49 @@ func (s *inStream) failAuthentication(ctx context.Context, elem xmpp.XElement) {
 	s.setState(connected)
 }
 
+func (s *inStream) allowAuthAttempt(ctx context.Context) bool {
+	th := s.cfg.authThrottler
+	if th == nil {
+		return true
+	}
+	s.authAttempts++
+	if s.authAttempts > th.cfg.MaxAttempts {
+		log.Infof("too many authentication attempts... id: %s", s.id)
+		s.disconnectWithStreamError(ctx, streamerror.ErrPolicyViolation)
+		return false
+	}
+	d, banned := th.delay(ipThrottleKind, s.remoteIP())
+	if banned {
+		s.disconnectWithStreamError(ctx, streamerror.ErrPolicyViolation)
+		return false
+	}
+	if d > 0 {
+		s.failAuthentication(ctx, auth.ErrSASLTemporaryAuthFailure.(*auth.SASLError).Element())
+		return false
+	}
+	return true
+}
+
+func (s *inStream) registerAuthFailure() {
+	th := s.cfg.authThrottler
+	if th == nil {
+		return
+	}
+	th.fail(ipThrottleKind, s.remoteIP())
+	if s.authUserRep != nil {
+		th.fail(usernameThrottleKind, s.authUserRep.username)
+		s.authUserRep.username = ""
+	}
+}
+
+func (s *inStream) remoteIP() string {
+	addr := s.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	return hostFromAddr(addr)
+}
+
 func (s *inStream) bindResource(ctx context.Context, iq *xmpp.IQ) {
 	bind := iq.Elements().ChildNamespace("bind", bindNamespace)
 	if bind == nil {
@@ -553,7 +661,7 @@ func (s *inStream) bindResource(ctx context.Context, iq *xmpp.IQ) {
 	}
 	// try binding...
 	var stm stream.C2S
-	streams := s.router.LocalStreams(s.JID().Node())
+	streams := s.router.LocalStreams(s.JID())
 	for _, s := range streams {
 		if s.Resource() == resource {
 			stm = s
@@ -652,18 +760,23 @@ func (s *inStream) processPresence(ctx context.Context, presence *xmpp.Presence)
 	}
 	replyOnBehalf := s.JID().MatchesWithOptions(presence.ToJID(), jid.MatchesBare)
 
+	// announce avatar hash
+	if av := s.mods.Avatar; av != nil && s.isModuleEnabled("avatar") {
+		av.UpdatePresence(ctx, presence)
+	}
 	// update presence
 	if replyOnBehalf && (presence.IsAvailable() || presence.IsUnavailable()) {
 		s.setPresence(presence)
+		s.router.UpdatePresence(ctx, s)
 	}
 	// process presence
-	if r := s.mods.Roster; r != nil {
+	if r := s.mods.Roster; r != nil && s.isModuleEnabled("roster") {
 		r.ProcessPresence(ctx, presence)
 	}
 
 	// deliver offline messages
 	if replyOnBehalf && presence.IsAvailable() && presence.Priority() >= 0 {
-		if off := s.mods.Offline; off != nil {
+		if off := s.mods.Offline; off != nil && s.isModuleEnabled("offline") {
 			off.DeliverOfflineMessages(ctx, s)
 		}
 	}
@@ -682,7 +795,7 @@ sendMessage:
 		msg, _ = xmpp.NewMessageFromElement(msg, msg.FromJID(), msg.ToJID().ToBareJID())
 		goto sendMessage
 	case router.ErrNotAuthenticated:
-		if off := s.mods.Offline; off != nil {
+		if off := s.mods.Offline; off != nil && s.isModuleEnabled("offline") {
 			off.ArchiveMessage(ctx, message)
 			return
 		}
@@ -702,6 +815,12 @@ func (s *inStream) doRead() {
 	elem, sErr := s.sess.Receive()
 	s.cancelReadTimeout()
 
+	if sErr == nil && elem != nil && elem.IsStanza() {
+		if err := s.waitStanza(); err != nil {
+			log.Infof("stanza rate limit exceeded... id: %s", s.id)
+			sErr = &session.Error{UnderlyingErr: streamerror.ErrPolicyViolation}
+		}
+	}
 	ctx, _ := context.WithTimeout(context.Background(), s.cfg.timeout)
 	if sErr == nil {
 		s.runQueue.Run(func() { s.readElement(ctx, elem) })
@@ -715,6 +834,18 @@ func (s *inStream) doRead() {
 	}
 }
 
+func (s *inStream) waitStanza() error {
+	if s.limiter != nil {
+		if err := s.limiter.WaitStanza(); err != nil {
+			return err
+		}
+	}
+	if s.userLimiter != nil {
+		return s.userLimiter.WaitStanza()
+	}
+	return nil
+}
+
 func (s *inStream) handleSessionError(ctx context.Context, sErr *session.Error) {
 	switch err := sErr.UnderlyingErr.(type) {
 	case nil:
@@ -770,6 +901,11 @@ func (s *inStream) disconnect(ctx context.Context, err error) {
 	}
 }
 
+// isModuleEnabled tells whether a module is enabled for the stream domain.
+func (s *inStream) isModuleEnabled(mod string) bool {
+	return s.mods.IsEnabledForHost(mod, s.Domain())
+}
+
 func (s *inStream) disconnectWithStreamError(ctx context.Context, err *streamerror.Error) {
 	if s.getState() == connecting {
 		_ = s.sess.Open(ctx, nil)
@@ -787,7 +923,7 @@ func (s *inStream) disconnectClosingSession(ctx context.Context, closeSession, u
 	}
 	// send 'unavailable' presence when disconnecting
 	if presence := s.Presence(); presence != nil && presence.IsAvailable() {
-		if r := s.mods.Roster; r != nil {
+		if r := s.mods.Roster; r != nil && s.isModuleEnabled("roster") {
 			r.ProcessPresence(ctx, xmpp.NewPresence(s.JID(), s.JID().ToBareJID(), xmpp.UnavailableType))
 		}
 	}
@@ -798,6 +934,9 @@ func (s *inStream) disconnectClosingSession(ctx context.Context, closeSession, u
 	if unbind {
 		s.router.Unbind(ctx, s.JID())
 	}
+	if s.userLimiter != nil {
+		s.cfg.userLimiters.Release(s.JID().ToBareJID().String())
+	}
 	s.ctxCancelFn()
 
 	// notify disconnection
@@ -811,7 +950,7 @@ func (s *inStream) disconnectClosingSession(ctx context.Context, closeSession, u
 }
 
 func (s *inStream) isBlockedJID(ctx context.Context, j *jid.JID) bool {
-	blockList, err := s.blockListRep.FetchBlockListItems(ctx, s.Username())
+	blockList, err := s.blockListRep.FetchBlockListItems(ctx, s.JID().ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		return false
@@ -14,14 +14,17 @@ import (
 	"github.com/ortuman/jackal/component"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/module/xep0077"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/storage/repository"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/transport/compress"
+	"github.com/ortuman/jackal/util/ratelimit"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -73,10 +76,80 @@ func TestStream_Features(t *testing.T) {
 	require.NotNil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
 }
 
+func TestStream_RegistrationDisabledForHost(t *testing.T) {
+	r, userRep, blockListRep := setupTest("localhost")
+
+	repContainer, _ := storage.New(&storage.Config{Type: storage.Memory})
+	newRegStream := func(hostEnabled map[string]map[string]struct{}) (*inStream, *fakeSocketConn) {
+		mods := module.New(&module.Config{
+			Enabled:      map[string]struct{}{"registration": {}, "roster": {}},
+			HostEnabled:  hostEnabled,
+			Registration: xep0077.Config{AllowRegistration: true},
+		}, r, repContainer, "alloc-1234")
+
+		conn := newFakeSocketConn()
+		stm := newStream("abcd1234", tUtilInStreamDefaultConfig(), transport.NewSocketTransport(conn), mods, &component.Components{}, r, userRep, blockListRep)
+		stm.(*inStream).setSecured(true)
+		return stm.(*inStream), conn
+	}
+	regIQ := `<iq type="get" id="reg1"><query xmlns="jabber:iq:register"/></iq>`
+
+	// registration enabled
+	_, conn := newRegStream(nil)
+	tUtilStreamOpen(conn)
+
+	_ = conn.outboundRead() // read stream opening...
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+	require.NotNil(t, elem.Elements().ChildNamespace("register", "http://jabber.org/features/iq-register"))
+
+	_, _ = conn.inboundWrite([]byte(regIQ))
+	elem = conn.outboundRead()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// registration disabled for localhost
+	stm, conn := newRegStream(map[string]map[string]struct{}{"localhost": {"roster": {}}})
+	tUtilStreamOpen(conn)
+
+	_ = conn.outboundRead() // read stream opening...
+	elem = conn.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+	require.Nil(t, elem.Elements().ChildNamespace("register", "http://jabber.org/features/iq-register"))
+
+	// register IQ is treated as any other unauthenticated stanza
+	_, _ = conn.inboundWrite([]byte(regIQ))
+	require.True(t, conn.waitClose())
+	require.Equal(t, disconnected, stm.getState())
+}
+
+func TestStream_ExternalMechanism(t *testing.T) {
+	r, userRep, blockListRep := setupTest("localhost")
+
+	cfg := tUtilInStreamDefaultConfig()
+	cfg.sasl = []string{"plain", "external"}
+	cfg.clientCert = ClientCertConfig{Policy: OptionalClientCert}
+
+	stm, conn := tUtilStreamInitWithConfig(r, userRep, blockListRep, cfg)
+	stm.setSecured(true)
+
+	tUtilStreamOpen(conn)
+
+	_ = conn.outboundRead() // read stream opening...
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+
+	// no client certificate presented... EXTERNAL mechanism shouldn't be offered
+	mechanisms := elem.Elements().ChildNamespace("mechanisms", saslNamespace)
+	require.NotNil(t, mechanisms)
+	require.Equal(t, 1, mechanisms.Elements().Count())
+	require.Equal(t, "PLAIN", mechanisms.Elements().All()[0].Text())
+}
+
 func TestStream_TLS(t *testing.T) {
 	r, userRep, blockListRep := setupTest("localhost")
 
-	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Domain: "localhost", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r, userRep, blockListRep)
 	tUtilStreamOpen(conn)
@@ -97,13 +170,15 @@ func TestStream_TLS(t *testing.T) {
 func TestStream_FailAuthenticate(t *testing.T) {
 	r, userRep, blockListRep := setupTest("localhost")
 
-	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Domain: "localhost", Password: "pencil"})
 
 	_, conn := tUtilStreamInit(r, userRep, blockListRep)
 	tUtilStreamOpen(conn)
 	_ = conn.outboundRead() // read stream opening...
 	_ = conn.outboundRead() // read stream features...
 
+	failures := testutil.ToFloat64(authentications.WithLabelValues("PLAIN", "failure"))
+
 	// wrong mechanism
 	_, _ = conn.inboundWrite([]byte(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="FOO"/>`))
 
@@ -114,6 +189,7 @@ func TestStream_FailAuthenticate(t *testing.T) {
 
 	elem = conn.outboundRead()
 	require.Equal(t, "failure", elem.Name())
+	require.Equal(t, failures+1, testutil.ToFloat64(authentications.WithLabelValues("PLAIN", "failure")))
 
 	// non-SASL
 	_, _ = conn.inboundWrite([]byte(`<iq type='set' id='auth2'><query xmlns='jabber:iq:auth'>
@@ -131,7 +207,7 @@ func TestStream_FailAuthenticate(t *testing.T) {
 func TestStream_Compression(t *testing.T) {
 	r, userRep, blockListRep := setupTest("localhost")
 
-	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Domain: "localhost", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r, userRep, blockListRep)
 	tUtilStreamOpen(conn)
@@ -175,7 +251,7 @@ func TestStream_Compression(t *testing.T) {
 func TestStream_StartSession(t *testing.T) {
 	r, userRep, blockListRep := setupTest("localhost")
 
-	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Domain: "localhost", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r, userRep, blockListRep)
 	tUtilStreamOpen(conn)
@@ -194,10 +270,42 @@ func TestStream_StartSession(t *testing.T) {
 	require.Equal(t, bound, stm.getState())
 }
 
+func TestStream_RateLimit(t *testing.T) {
+	r, userRep, blockListRep := setupTest("localhost")
+
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Domain: "localhost", Password: "pencil"})
+
+	cfg := tUtilInStreamDefaultConfig()
+	cfg.rateLimit = &ratelimit.Config{StanzasPerSec: 1, MaxThrottle: time.Millisecond}
+	cfg.userLimiters = ratelimit.NewRegistry(&ratelimit.Config{StanzasPerSec: 100, MaxThrottle: time.Second})
+
+	stm, conn := tUtilStreamInitWithConfig(r, userRep, blockListRep, cfg)
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamAuthenticate(conn, t)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamBind(conn, t)
+	require.NotNil(t, stm.userLimiter)
+
+	// flood
+	for i := 0; i < 3; i++ {
+		_, _ = conn.inboundWrite([]byte(`<message to="noelia@localhost" type="chat"><body>flood</body></message>`))
+	}
+	require.True(t, conn.waitClose())
+	require.Equal(t, disconnected, stm.getState())
+	require.False(t, cfg.userLimiters.Acquire("user") == stm.userLimiter) // released on disconnect
+}
+
 func TestStream_SendIQ(t *testing.T) {
 	r, userRep, blockListRep := setupTest("localhost")
 
-	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Domain: "localhost", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r, userRep, blockListRep)
 	tUtilStreamOpen(conn)
@@ -234,7 +342,7 @@ func TestStream_SendIQ(t *testing.T) {
 func TestStream_SendPresence(t *testing.T) {
 	r, userRep, blockListRep := setupTest("localhost")
 
-	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Domain: "localhost", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r, userRep, blockListRep)
 	tUtilStreamOpen(conn)
@@ -278,7 +386,7 @@ func TestStream_SendPresence(t *testing.T) {
 func TestStream_SendMessage(t *testing.T) {
 	r, userRep, blockListRep := setupTest("localhost")
 
-	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Domain: "localhost", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r, userRep, blockListRep)
 	tUtilStreamOpen(conn)
@@ -330,7 +438,7 @@ func TestStream_SendMessage(t *testing.T) {
 func TestStream_SendToBlockedJID(t *testing.T) {
 	r, userRep, blockListRep := setupTest("localhost")
 
-	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "user", Domain: "localhost", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r, userRep, blockListRep)
 	tUtilStreamOpen(conn)
@@ -350,6 +458,7 @@ func TestStream_SendToBlockedJID(t *testing.T) {
 
 	_ = blockListRep.InsertBlockListItem(context.Background(), &model.BlockListItem{
 		Username: "user",
+		Domain:   "localhost",
 		JID:      "hamlet@localhost",
 	})
 
@@ -404,11 +513,15 @@ func tUtilStreamStartSession(conn *fakeSocketConn, t *testing.T) {
 }
 
 func tUtilStreamInit(r router.Router, userRep repository.User, blockListRep repository.BlockList) (*inStream, *fakeSocketConn) {
+	return tUtilStreamInitWithConfig(r, userRep, blockListRep, tUtilInStreamDefaultConfig())
+}
+
+func tUtilStreamInitWithConfig(r router.Router, userRep repository.User, blockListRep repository.BlockList, cfg *streamConfig) (*inStream, *fakeSocketConn) {
 	conn := newFakeSocketConn()
 	tr := transport.NewSocketTransport(conn)
 	stm := newStream(
 		"abcd1234",
-		tUtilInStreamDefaultConfig(),
+		cfg,
 		tr,
 		tUtilInitModules(r),
 		&component.Components{},
@@ -0,0 +1,30 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package c2s
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	connectedStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "jackal",
+		Subsystem: "c2s",
+		Name:      "connected_streams",
+		Help:      "Number of connected c2s streams per listener.",
+	}, []string{"listener"})
+
+	authentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "jackal",
+		Subsystem: "c2s",
+		Name:      "authentications_total",
+		Help:      "Number of c2s authentication attempts by mechanism and outcome.",
+	}, []string{"mechanism", "outcome"})
+)
+
+func init() {
+	prometheus.MustRegister(connectedStreams, authentications)
+}
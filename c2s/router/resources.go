@@ -108,3 +108,12 @@ broadcast:
 	}
 	return nil
 }
+
+// routeNonNegative delivers a bare JID stanza to every available stream whose priority is not negative.
+func (r *resources) routeNonNegative(ctx context.Context, stanza xmpp.Stanza) {
+	for _, stm := range r.allStreams() {
+		if p := stm.Presence(); p != nil && p.IsAvailable() && p.Priority() >= 0 {
+			stm.SendElement(ctx, stanza)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package c2srouter
 
 import (
 	"context"
+	"strconv"
 	"testing"
 
 	"github.com/google/uuid"
@@ -84,4 +85,26 @@ func TestResources_Route(t *testing.T) {
 	require.Equal(t, "message", elem1.Name())
 	require.Equal(t, elem1.ID(), elem2.ID())
 	require.Equal(t, elem1.Name(), elem2.Name())
+
+	// non clustered routing still delivers to negative priority streams
+	stm1.SetPresence(presenceWithPriority(j1, -1))
+	stm2.SetPresence(presenceWithPriority(j2, -1))
+
+	err = res.route(context.Background(), msg)
+	require.Nil(t, err)
+	require.Equal(t, msgID, stm1.ReceiveElement().ID())
+	require.Equal(t, msgID, stm2.ReceiveElement().ID())
+
+	// ...while cluster wide routing skips them
+	stm1.SetPresence(presenceWithPriority(j1, 0))
+
+	res.routeNonNegative(context.Background(), msg)
+	require.Equal(t, msgID, stm1.ReceiveElement().ID())
+}
+
+func presenceWithPriority(j *jid.JID, priority int) *xmpp.Presence {
+	e := xmpp.NewElementName("presence")
+	e.AppendElement(xmpp.NewElementName("priority").SetText(strconv.Itoa(priority)))
+	p, _ := xmpp.NewPresenceFromElement(e, j, j.ToBareJID())
+	return p
 }
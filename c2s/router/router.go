@@ -22,14 +22,22 @@ type c2sRouter struct {
 	tbl          map[string]*resources
 	userRep      repository.User
 	blockListRep repository.BlockList
+	cluster      router.ClusterRouter
 }
 
-func New(userRep repository.User, blockListRep repository.BlockList) router.C2SRouter {
-	return &c2sRouter{
+// New returns a new c2s router instance.
+// In case cluster is not nil, stanzas addressed to resources bound on remote nodes will be forwarded through it.
+func New(userRep repository.User, blockListRep repository.BlockList, cluster router.ClusterRouter) router.C2SRouter {
+	r := &c2sRouter{
 		tbl:          make(map[string]*resources),
 		userRep:      userRep,
 		blockListRep: blockListRep,
+		cluster:      cluster,
 	}
+	if cluster != nil {
+		cluster.SetLocalDeliverer(r)
+	}
+	return r
 }
 
 func (r *c2sRouter) Route(ctx context.Context, stanza xmpp.Stanza, validateStanza bool) error {
@@ -37,16 +45,20 @@ func (r *c2sRouter) Route(ctx context.Context, stanza xmpp.Stanza, validateStanz
 	toJID := stanza.ToJID()
 
 	// validate if sender JID is blocked
-	if validateStanza && r.isBlockedJID(ctx, toJID, fromJID.Node()) {
+	if validateStanza && r.isBlockedJID(ctx, toJID, fromJID.ToBareJID().String()) {
 		return router.ErrBlockedJID
 	}
-	username := stanza.ToJID().Node()
+	userJID := toJID.ToBareJID().String()
 	r.mu.RLock()
-	rs := r.tbl[username]
+	rs := r.tbl[userJID]
 	r.mu.RUnlock()
 
-	if rs == nil {
-		exists, err := r.userRep.UserExists(ctx, username)
+	var remotes []router.ClusterResource
+	if r.cluster != nil {
+		remotes = r.cluster.Resources(toJID)
+	}
+	if rs == nil && len(remotes) == 0 {
+		exists, err := r.userRep.UserExists(ctx, userJID)
 		if err != nil {
 			return err
 		}
@@ -55,61 +67,90 @@ func (r *c2sRouter) Route(ctx context.Context, stanza xmpp.Stanza, validateStanz
 		}
 		return router.ErrNotExistingAccount
 	}
+	if len(remotes) == 0 {
+		return rs.route(ctx, stanza)
+	}
+	return r.routeClustered(ctx, stanza, rs, remotes)
+}
+
+// DeliverLocal routes a stanza to local streams exclusively.
+func (r *c2sRouter) DeliverLocal(ctx context.Context, stanza xmpp.Stanza) error {
+	r.mu.RLock()
+	rs := r.tbl[stanza.ToJID().ToBareJID().String()]
+	r.mu.RUnlock()
+
+	if rs == nil {
+		return router.ErrNotAuthenticated
+	}
 	return rs.route(ctx, stanza)
 }
 
 func (r *c2sRouter) Bind(stm stream.C2S) {
-	user := stm.Username()
+	userJID := stm.JID().ToBareJID().String()
 	r.mu.RLock()
-	rs := r.tbl[user]
+	rs := r.tbl[userJID]
 	r.mu.RUnlock()
 
 	if rs == nil {
 		r.mu.Lock()
-		rs = r.tbl[user] // avoid double initialization
+		rs = r.tbl[userJID] // avoid double initialization
 		if rs == nil {
 			rs = &resources{}
-			r.tbl[user] = rs
+			r.tbl[userJID] = rs
 		}
 		r.mu.Unlock()
 	}
 	rs.bind(stm)
 
-	log.Infof("bound c2s stream... (%s/%s)", stm.Username(), stm.Resource())
+	if r.cluster != nil {
+		r.cluster.BindResource(clusterResource(stm))
+	}
+	log.Infof("bound c2s stream... (%s)", stm.JID().String())
 }
 
-func (r *c2sRouter) Unbind(user, resource string) {
+func (r *c2sRouter) Unbind(j *jid.JID) {
+	userJID := j.ToBareJID().String()
 	r.mu.RLock()
-	rs := r.tbl[user]
+	rs := r.tbl[userJID]
 	r.mu.RUnlock()
 
 	if rs == nil {
 		return
 	}
 	r.mu.Lock()
-	rs.unbind(resource)
+	rs.unbind(j.Resource())
 	if rs.len() == 0 {
-		delete(r.tbl, user)
+		delete(r.tbl, userJID)
 	}
 	r.mu.Unlock()
 
-	log.Infof("unbound c2s stream... (%s/%s)", user, resource)
+	if r.cluster != nil {
+		r.cluster.UnbindResource(j)
+	}
+	log.Infof("unbound c2s stream... (%s)", j.String())
+}
+
+func (r *c2sRouter) UpdatePresence(stm stream.C2S) {
+	if r.cluster == nil || r.Stream(stm.JID()) != stm {
+		return
+	}
+	r.cluster.BindResource(clusterResource(stm))
 }
 
-func (r *c2sRouter) Stream(username, resource string) stream.C2S {
+func (r *c2sRouter) Stream(j *jid.JID) stream.C2S {
 	r.mu.RLock()
-	rs := r.tbl[username]
+	rs := r.tbl[j.ToBareJID().String()]
 	r.mu.RUnlock()
 
 	if rs == nil {
 		return nil
 	}
-	return rs.stream(resource)
+	return rs.stream(j.Resource())
 }
 
-func (r *c2sRouter) Streams(username string) []stream.C2S {
+func (r *c2sRouter) Streams(j *jid.JID) []stream.C2S {
 	r.mu.RLock()
-	rs := r.tbl[username]
+	rs := r.tbl[j.ToBareJID().String()]
 	r.mu.RUnlock()
 
 	if rs == nil {
@@ -118,8 +159,130 @@ func (r *c2sRouter) Streams(username string) []stream.C2S {
 	return rs.allStreams()
 }
 
-func (r *c2sRouter) isBlockedJID(ctx context.Context, j *jid.JID, username string) bool {
-	blockList, err := r.blockListRep.FetchBlockListItems(ctx, username)
+func (r *c2sRouter) AllStreams() []stream.C2S {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var stms []stream.C2S
+	for _, rs := range r.tbl {
+		stms = append(stms, rs.allStreams()...)
+	}
+	return stms
+}
+
+func (r *c2sRouter) ClusterResources() []router.ClusterResource {
+	if r.cluster == nil {
+		return nil
+	}
+	return r.cluster.AllResources()
+}
+
+func (r *c2sRouter) routeClustered(ctx context.Context, stanza xmpp.Stanza, rs *resources, remotes []router.ClusterResource) error {
+	toJID := stanza.ToJID()
+	if toJID.IsFullWithUser() {
+		if rs != nil {
+			if stm := rs.stream(toJID.Resource()); stm != nil {
+				return rs.route(ctx, stanza)
+			}
+		}
+		for _, res := range remotes {
+			if res.Available && res.Resource == toJID.Resource() {
+				return r.cluster.Route(ctx, stanza, res.Node)
+			}
+		}
+		return router.ErrResourceNotFound
+	}
+	if _, ok := stanza.(*xmpp.Message); ok {
+		return r.routeClusteredMessage(ctx, stanza, rs, remotes)
+	}
+	// broadcast to all available resources
+	if rs != nil {
+		if err := rs.route(ctx, stanza); err != nil {
+			return err
+		}
+	}
+	nodes := make(map[string]struct{})
+	for _, res := range remotes {
+		if !res.Available {
+			continue
+		}
+		if _, ok := nodes[res.Node]; ok {
+			continue
+		}
+		nodes[res.Node] = struct{}{}
+		if err := r.cluster.Route(ctx, stanza, res.Node); err != nil {
+			log.Warnf("failed to forward stanza to cluster node %s: %v", res.Node, err)
+		}
+	}
+	return nil
+}
+
+// routeClusteredMessage sends a message to the highest priority resource across all cluster nodes.
+// Messages are never delivered to negative priority resources (RFC 6121, 8.5.2.1.1).
+func (r *c2sRouter) routeClusteredMessage(ctx context.Context, stanza xmpp.Stanza, rs *resources, remotes []router.ClusterResource) error {
+	highestPriority := int8(-1)
+	var recipientNode string
+	var localRecipient bool
+
+	if rs != nil {
+		for _, stm := range rs.allStreams() {
+			if p := stm.Presence(); p != nil && p.IsAvailable() && p.Priority() > highestPriority {
+				highestPriority = p.Priority()
+				localRecipient = true
+			}
+		}
+	}
+	for _, res := range remotes {
+		if res.Available && res.Priority > highestPriority {
+			highestPriority = res.Priority
+			recipientNode = res.Node
+			localRecipient = false
+		}
+	}
+	switch {
+	case highestPriority < 0:
+		return router.ErrNotAuthenticated
+
+	case highestPriority > 0:
+		if localRecipient {
+			return rs.route(ctx, stanza)
+		}
+		return r.cluster.Route(ctx, stanza, recipientNode)
+	}
+	// deliver to every zero priority resource
+	if rs != nil && localRecipient {
+		rs.routeNonNegative(ctx, stanza)
+	}
+	nodes := make(map[string]struct{})
+	for _, res := range remotes {
+		if !res.Available || res.Priority < 0 {
+			continue
+		}
+		if _, ok := nodes[res.Node]; ok {
+			continue
+		}
+		nodes[res.Node] = struct{}{}
+		if err := r.cluster.Route(ctx, stanza, res.Node); err != nil {
+			log.Warnf("failed to forward stanza to cluster node %s: %v", res.Node, err)
+		}
+	}
+	return nil
+}
+
+func clusterResource(stm stream.C2S) router.ClusterResource {
+	res := router.ClusterResource{
+		JID:      stm.JID().ToBareJID().String(),
+		Resource: stm.Resource(),
+	}
+	if p := stm.Presence(); p != nil {
+		res.Available = p.IsAvailable()
+		res.Priority = p.Priority()
+	}
+	return res
+}
+
+func (r *c2sRouter) isBlockedJID(ctx context.Context, j *jid.JID, userJID string) bool {
+	blockList, err := r.blockListRep.FetchBlockListItems(ctx, userJID)
 	if err != nil {
 		log.Error(err)
 		return false
@@ -33,21 +33,48 @@ func TestRouter_Binding(t *testing.T) {
 	stm1.SetPresence(xmpp.NewPresence(j1.ToBareJID(), j1, xmpp.AvailableType))
 	stm2.SetPresence(xmpp.NewPresence(j2.ToBareJID(), j2, xmpp.AvailableType))
 
-	require.Len(t, r.Streams("ortuman"), 2)
+	require.Len(t, r.Streams(j1.ToBareJID()), 2)
+	require.Len(t, r.AllStreams(), 2)
 
-	require.NotNil(t, r.Stream("ortuman", "yard"))
-	require.NotNil(t, r.Stream("ortuman", "balcony"))
+	require.NotNil(t, r.Stream(j1))
+	require.NotNil(t, r.Stream(j2))
 
-	r.Unbind("ortuman", "yard")
-	r.Unbind("ortuman", "balcony")
+	r.Unbind(j1)
+	r.Unbind(j2)
 
-	require.Len(t, r.Streams("ortuman"), 0)
+	require.Len(t, r.Streams(j1.ToBareJID()), 0)
+	require.Len(t, r.AllStreams(), 0)
 
 	r.(*c2sRouter).mu.RLock()
 	require.Len(t, r.(*c2sRouter).tbl, 0)
 	r.(*c2sRouter).mu.RUnlock()
 }
 
+func TestRouter_DomainIsolation(t *testing.T) {
+	j1, _ := jid.NewWithString("alice@a.example/yard", true)
+	j2, _ := jid.NewWithString("alice@b.example/yard", true)
+
+	stm1 := stream.NewMockC2S("id-1", j1)
+	stm2 := stream.NewMockC2S("id-2", j2)
+
+	r, userRep, _ := setupTest()
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "alice", Domain: "a.example"})
+
+	r.Bind(stm1)
+	r.Bind(stm2)
+
+	require.Len(t, r.Streams(j1.ToBareJID()), 1)
+	require.Equal(t, stm1, r.Stream(j1))
+	require.Equal(t, stm2, r.Stream(j2))
+
+	r.Unbind(j2)
+	require.Len(t, r.Streams(j1.ToBareJID()), 1)
+	require.Len(t, r.Streams(j2.ToBareJID()), 0)
+
+	err := r.Route(context.Background(), xmpp.NewPresence(j1, j2, xmpp.AvailableType), true)
+	require.Equal(t, router.ErrNotExistingAccount, err)
+}
+
 func TestRouter_Routing(t *testing.T) {
 	j1, _ := jid.NewWithString("ortuman@jackal.im/yard", true)
 	j2, _ := jid.NewWithString("romeo@jackal.im/deadlyresource", true)
@@ -59,8 +86,8 @@ func TestRouter_Routing(t *testing.T) {
 	err := r.Route(context.Background(), xmpp.NewPresence(j1, j1, xmpp.AvailableType), true)
 	require.Equal(t, router.ErrNotExistingAccount, err)
 
-	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "ortuman"})
-	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "romeo"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "ortuman", Domain: "jackal.im"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "romeo", Domain: "jackal.im"})
 
 	err = r.Route(context.Background(), xmpp.NewPresence(j1, j1, xmpp.AvailableType), true)
 	require.Equal(t, router.ErrNotAuthenticated, err)
@@ -77,6 +104,7 @@ func TestRouter_Routing(t *testing.T) {
 
 	_ = blockListRep.InsertBlockListItem(context.Background(), &model.BlockListItem{
 		Username: "ortuman",
+		Domain:   "jackal.im",
 		JID:      "jackal.im/deadlyresource",
 	})
 
@@ -84,8 +112,101 @@ func TestRouter_Routing(t *testing.T) {
 	require.Equal(t, router.ErrBlockedJID, err)
 }
 
+type fakeCluster struct {
+	remotes   []router.ClusterResource
+	bound     []router.ClusterResource
+	unbound   []string
+	routed    map[string][]xmpp.Stanza
+	deliverer router.LocalDeliverer
+}
+
+func (c *fakeCluster) Route(_ context.Context, stanza xmpp.Stanza, node string) error {
+	c.routed[node] = append(c.routed[node], stanza)
+	return nil
+}
+
+func (c *fakeCluster) Resources(_ *jid.JID) []router.ClusterResource { return c.remotes }
+func (c *fakeCluster) AllResources() []router.ClusterResource        { return c.remotes }
+func (c *fakeCluster) BindResource(res router.ClusterResource)       { c.bound = append(c.bound, res) }
+func (c *fakeCluster) UnbindResource(j *jid.JID) {
+	c.unbound = append(c.unbound, j.Resource())
+}
+func (c *fakeCluster) SetLocalDeliverer(d router.LocalDeliverer) { c.deliverer = d }
+
+func TestRouter_ClusterRouting(t *testing.T) {
+	j1, _ := jid.NewWithString("ortuman@jackal.im/yard", true)
+	j2, _ := jid.NewWithString("noelia@jackal.im/garden", true)
+	stm1 := stream.NewMockC2S("id-1", j1)
+
+	cl := &fakeCluster{routed: make(map[string][]xmpp.Stanza)}
+	r := New(memorystorage.NewUser(), memorystorage.NewBlockList(), cl)
+	require.Equal(t, r, cl.deliverer)
+
+	// resources bound on remote nodes only
+	cl.remotes = []router.ClusterResource{
+		{Node: "node-b", JID: "ortuman@jackal.im", Resource: "balcony", Available: true, Priority: 1},
+		{Node: "node-c", JID: "ortuman@jackal.im", Resource: "hall", Available: true, Priority: 2},
+	}
+	balconyJID, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	msg, _ := xmpp.NewMessageFromElement(xmpp.NewElementName("message"), j2, balconyJID)
+	require.Nil(t, r.Route(context.Background(), msg, true))
+	require.Len(t, cl.routed["node-b"], 1)
+
+	// highest priority resource
+	msg, _ = xmpp.NewMessageFromElement(xmpp.NewElementName("message"), j2, j1.ToBareJID())
+	require.Nil(t, r.Route(context.Background(), msg, true))
+	require.Len(t, cl.routed["node-c"], 1)
+
+	// remote resource with higher priority than the local one
+	r.Bind(stm1)
+	require.Len(t, cl.bound, 1)
+	require.False(t, cl.bound[0].Available)
+
+	stm1.SetPresence(xmpp.NewPresence(j1, j1, xmpp.AvailableType))
+	r.UpdatePresence(stm1)
+	require.Len(t, cl.bound, 2)
+	require.True(t, cl.bound[1].Available)
+
+	require.Nil(t, r.Route(context.Background(), msg, true))
+	require.Len(t, cl.routed["node-c"], 2)
+
+	// presence broadcast reaches every node
+	pr := xmpp.NewPresence(j2, j1.ToBareJID(), xmpp.AvailableType)
+	require.Nil(t, r.Route(context.Background(), pr, true))
+	require.Len(t, cl.routed["node-b"], 2)
+	require.Len(t, cl.routed["node-c"], 3)
+	require.Equal(t, "presence", stm1.ReceiveElement().Name())
+
+	// unknown remote resource
+	unknownJID, _ := jid.NewWithString("ortuman@jackal.im/attic", true)
+	msg, _ = xmpp.NewMessageFromElement(xmpp.NewElementName("message"), j2, unknownJID)
+	require.Equal(t, router.ErrResourceNotFound, r.Route(context.Background(), msg, true))
+
+	// local delivery never forwards
+	require.Nil(t, r.(router.LocalDeliverer).DeliverLocal(context.Background(), pr))
+	require.Len(t, cl.routed["node-b"], 2)
+
+	// zero priority resources share the message, negative priority ones never get it
+	stm1.SetPresence(presenceWithPriority(j1, -1))
+	cl.remotes = []router.ClusterResource{
+		{Node: "node-b", JID: "ortuman@jackal.im", Resource: "balcony", Available: true, Priority: 0},
+		{Node: "node-c", JID: "ortuman@jackal.im", Resource: "hall", Available: true, Priority: -1},
+	}
+	msg, _ = xmpp.NewMessageFromElement(xmpp.NewElementName("message"), j2, j1.ToBareJID())
+	require.Nil(t, r.Route(context.Background(), msg, true))
+	require.Len(t, cl.routed["node-b"], 3)
+	require.Len(t, cl.routed["node-c"], 3)
+
+	cl.remotes[0].Priority = -5
+	require.Equal(t, router.ErrNotAuthenticated, r.Route(context.Background(), msg, true))
+	require.Len(t, cl.routed["node-b"], 3)
+
+	r.Unbind(j1)
+	require.Equal(t, []string{"yard"}, cl.unbound)
+}
+
 func setupTest() (router.C2SRouter, repository.User, repository.BlockList) {
 	userRep := memorystorage.NewUser()
 	blockListRep := memorystorage.NewBlockList()
-	return New(userRep, blockListRep), userRep, blockListRep
+	return New(userRep, blockListRep, nil), userRep, blockListRep
 }
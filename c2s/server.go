@@ -22,10 +22,14 @@ import (
 	"github.com/ortuman/jackal/storage/repository"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/util/proxyproto"
+	"github.com/ortuman/jackal/util/ratelimit"
 )
 
 var listenerProvider = net.Listen
 
+const drainCheckInterval = time.Millisecond * 50
+
 type server struct {
 	cfg             *Config
 	mods            *module.Modules
@@ -33,6 +37,8 @@ type server struct {
 	router          router.Router
 	userRep         repository.User
 	blockListRep    repository.BlockList
+	authThrottler   *authThrottler
+	userLimiters    *ratelimit.Registry
 	inConnectionsMu sync.Mutex
 	inConnections   map[string]stream.C2S
 	ln              net.Listener
@@ -41,6 +47,10 @@ type server struct {
 }
 
 func newC2SServer(config *Config, mods *module.Modules, comps *component.Components, router router.Router, userRep repository.User, blockListRep repository.BlockList) c2sServer {
+	var userLimiters *ratelimit.Registry
+	if config.UserRateLimit != nil {
+		userLimiters = ratelimit.NewRegistry(config.UserRateLimit)
+	}
 	return &server{
 		cfg:           config,
 		mods:          mods,
@@ -48,6 +58,8 @@ func newC2SServer(config *Config, mods *module.Modules, comps *component.Compone
 		router:        router,
 		userRep:       userRep,
 		blockListRep:  blockListRep,
+		authThrottler: newAuthThrottler(&config.AuthThrottle),
+		userLimiters:  userLimiters,
 		inConnections: make(map[string]stream.C2S),
 	}
 }
@@ -59,6 +71,10 @@ func (s *server) start() {
 
 	log.Infof("%s: listening at %s [transport: %v]", s.cfg.ID, address, s.cfg.Transport.Type)
 
+	if s.authThrottler != nil {
+		s.authThrottler.start()
+	}
+
 	var err error
 	switch s.cfg.Transport.Type {
 	case transport.Socket:
@@ -80,33 +96,81 @@ func (s *server) listenSocketConn(address string) error {
 	for atomic.LoadUint32(&s.listening) == 1 {
 		conn, err := ln.Accept()
 		if err == nil {
-			go s.startStream(transport.NewSocketTransport(conn), s.cfg.KeepAlive)
+			go s.acceptConn(conn)
 			continue
 		}
 	}
 	return nil
 }
 
+func (s *server) acceptConn(conn net.Conn) {
+	pConn, err := proxyproto.Accept(conn, s.cfg.Transport.ProxyProtocol)
+	if err != nil {
+		log.Warnf("%s: failed to read proxy protocol header from %s: %v", s.cfg.ID, conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	s.startStream(transport.NewSocketTransport(pConn), s.cfg.KeepAlive)
+}
+
 func (s *server) shutdown(ctx context.Context) error {
+	if err := s.stopListening(); err != nil {
+		return err
+	}
+	if s.authThrottler != nil {
+		s.authThrottler.stop()
+	}
+	// close all remaining connections
+	c, err := s.closeConnections(ctx, streamerror.ErrSystemShutdown)
+	if err != nil {
+		return err
+	}
+	log.Infof("%s: closed %d connection(s)", s.cfg.ID, c)
+	return nil
+}
+
+// drain redirects every connected stream to an alternate host, waiting until all of them have been closed.
+// Listener is expected to have been stopped beforehand by means of stopListening.
+func (s *server) drain(ctx context.Context, seeOtherHost string) error {
+	stmErr := streamerror.ErrSystemShutdown
+	if len(seeOtherHost) > 0 {
+		stmErr = streamerror.NewSeeOtherHost(seeOtherHost)
+	}
+	c, err := s.closeConnections(ctx, stmErr)
+	if err != nil {
+		return err
+	}
+	log.Infof("%s: drained %d connection(s)", s.cfg.ID, c)
+
+	// wait until streams have been unregistered
+	tc := time.NewTicker(drainCheckInterval)
+	defer tc.Stop()
+	for s.connectionCount() > 0 {
+		select {
+		case <-tc.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (s *server) stopListening() error {
 	if atomic.CompareAndSwapUint32(&s.listening, 1, 0) {
-		// stop listening
 		switch s.cfg.Transport.Type {
 		case transport.Socket:
-			if err := s.ln.Close(); err != nil {
-				return err
-			}
-		}
-		// close all connections
-		c, err := s.closeConnections(ctx)
-		if err != nil {
-			return err
+			return s.ln.Close()
 		}
-		log.Infof("%s: closed %d connection(s)", s.cfg.ID, c)
 	}
 	return nil
 }
 
 func (s *server) startStream(tr transport.Transport, keepAlive time.Duration) {
+	// banned peers are rejected regardless of the transport they're connecting through
+	if s.isBannedAddr(tr.RemoteAddr()) {
+		_ = tr.Close()
+		return
+	}
 	cfg := &streamConfig{
 		resourceConflict: s.cfg.ResourceConflict,
 		connectTimeout:   s.cfg.ConnectTimeout,
@@ -114,26 +178,52 @@ func (s *server) startStream(tr transport.Transport, keepAlive time.Duration) {
 		timeout:          s.cfg.Timeout,
 		maxStanzaSize:    s.cfg.MaxStanzaSize,
 		sasl:             s.cfg.SASL,
+		clientCert:       s.cfg.ClientCert,
 		compression:      s.cfg.Compression,
+		authThrottler:    s.authThrottler,
+		rateLimit:        s.cfg.RateLimit,
+		userLimiters:     s.userLimiters,
 		onDisconnect:     s.unregisterStream,
 	}
 	stm := newStream(s.nextID(), cfg, tr, s.mods, s.comps, s.router, s.userRep, s.blockListRep)
 	s.registerStream(stm)
 }
 
+func (s *server) authBans() []AuthBan {
+	if s.authThrottler == nil {
+		return nil
+	}
+	return s.authThrottler.bans()
+}
+
+func (s *server) isBannedAddr(addr net.Addr) bool {
+	if s.authThrottler == nil || addr == nil {
+		return false
+	}
+	_, banned := s.authThrottler.delay(ipThrottleKind, hostFromAddr(addr))
+	return banned
+}
+
 func (s *server) registerStream(stm stream.C2S) {
 	s.inConnectionsMu.Lock()
 	s.inConnections[stm.ID()] = stm
 	s.inConnectionsMu.Unlock()
 
+	connectedStreams.WithLabelValues(s.cfg.ID).Inc()
+
 	log.Infof("registered c2s stream... (id: %s)", stm.ID())
 }
 
 func (s *server) unregisterStream(stm stream.C2S) {
 	s.inConnectionsMu.Lock()
+	_, ok := s.inConnections[stm.ID()]
 	delete(s.inConnections, stm.ID())
 	s.inConnectionsMu.Unlock()
 
+	if ok {
+		connectedStreams.WithLabelValues(s.cfg.ID).Dec()
+	}
+
 	log.Infof("unregistered c2s stream... (id: %s)", stm.ID())
 }
 
@@ -141,24 +231,35 @@ func (s *server) nextID() string {
 	return fmt.Sprintf("c2s:%s:%d", s.cfg.ID, atomic.AddUint64(&s.stmSeq, 1))
 }
 
-func (s *server) closeConnections(ctx context.Context) (count int, err error) {
+func (s *server) connectionCount() int {
 	s.inConnectionsMu.Lock()
+	defer s.inConnectionsMu.Unlock()
+	return len(s.inConnections)
+}
+
+func (s *server) closeConnections(ctx context.Context, stmErr *streamerror.Error) (count int, err error) {
+	s.inConnectionsMu.Lock()
+	stms := make([]stream.C2S, 0, len(s.inConnections))
 	for _, stm := range s.inConnections {
+		stms = append(stms, stm)
+	}
+	s.inConnectionsMu.Unlock()
+
+	for _, stm := range stms {
 		select {
-		case <-closeConn(ctx, stm):
+		case <-closeConn(ctx, stm, stmErr):
 			count++
 		case <-ctx.Done():
 			return 0, ctx.Err()
 		}
 	}
-	s.inConnectionsMu.Unlock()
 	return count, nil
 }
 
-func closeConn(ctx context.Context, stm stream.InStream) <-chan bool {
+func closeConn(ctx context.Context, stm stream.InStream, stmErr *streamerror.Error) <-chan bool {
 	c := make(chan bool, 1)
 	go func() {
-		stm.Disconnect(ctx, streamerror.ErrSystemShutdown)
+		stm.Disconnect(ctx, stmErr)
 		c <- true
 	}()
 	return c
@@ -11,10 +11,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/ortuman/jackal/component"
+	streamerror "github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/util/proxyproto"
+	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/stretchr/testify/require"
 )
 
@@ -69,3 +73,129 @@ func TestC2SSocketServer(t *testing.T) {
 	err := <-errCh
 	require.Nil(t, err)
 }
+
+func TestC2SSocketServer_ProxyProtocol(t *testing.T) {
+	r, _, _ := setupTest("localhost")
+
+	_, trusted, _ := net.ParseCIDR("127.0.0.0/8")
+	cfg := Config{
+		ID:               "srv-1234",
+		ConnectTimeout:   time.Second * time.Duration(5),
+		KeepAlive:        time.Second * time.Duration(5),
+		MaxStanzaSize:    8192,
+		ResourceConflict: Reject,
+		Transport: TransportConfig{
+			Type:          transport.Socket,
+			Port:          9997,
+			ProxyProtocol: &proxyproto.Config{TrustedCIDRs: []*net.IPNet{trusted}, HeaderTimeout: time.Second},
+		},
+	}
+	srv := &server{
+		cfg:           &cfg,
+		router:        r,
+		mods:          &module.Modules{},
+		comps:         &component.Components{},
+		inConnections: make(map[string]stream.C2S),
+	}
+	go srv.start()
+	time.Sleep(time.Millisecond * 150)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:9997")
+	require.Nil(t, err)
+	defer func() { _ = conn.Close() }()
+
+	_, err = conn.Write([]byte("PROXY TCP4 192.0.2.1 127.0.0.1 56324 9997\r\n"))
+	require.Nil(t, err)
+	time.Sleep(time.Millisecond * 150) // wait until registered
+
+	srv.inConnectionsMu.Lock()
+	var addrs []string
+	for _, stm := range srv.inConnections {
+		addrs = append(addrs, stm.RemoteAddr().String())
+	}
+	srv.inConnectionsMu.Unlock()
+	require.Equal(t, []string{"192.0.2.1:56324"}, addrs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_ = srv.shutdown(ctx)
+}
+
+// drainedStream records the error a stream has been disconnected with.
+type drainedStream struct {
+	*stream.MockC2S
+	errCh chan error
+	srv   *server
+}
+
+func (s *drainedStream) Disconnect(ctx context.Context, err error) {
+	s.MockC2S.Disconnect(ctx, err)
+	s.errCh <- err
+	if s.srv != nil {
+		s.srv.unregisterStream(s)
+	}
+}
+
+func TestC2SServer_Drain(t *testing.T) {
+	srv := &server{
+		cfg:           &Config{ID: "srv-1234"},
+		inConnections: make(map[string]stream.C2S),
+	}
+	j, _ := jid.NewWithString("ortuman@localhost/balcony", true)
+	stm := &drainedStream{
+		MockC2S: stream.NewMockC2S(uuid.New().String(), j),
+		errCh:   make(chan error, 1),
+		srv:     srv,
+	}
+	srv.registerStream(stm)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	require.Nil(t, srv.drain(ctx, "xmpp2.localhost:5222"))
+	require.True(t, stm.IsDisconnected())
+	require.Equal(t, 0, srv.connectionCount())
+
+	err := <-stm.errCh
+	stmErr, ok := err.(*streamerror.Error)
+	require.True(t, ok)
+	require.Equal(t, "see-other-host", stmErr.Error())
+	require.Equal(t, "xmpp2.localhost:5222", stmErr.Element().Elements().All()[0].Text())
+}
+
+func TestC2SServer_DrainTimeout(t *testing.T) {
+	srv := &server{
+		cfg:           &Config{ID: "srv-1234"},
+		inConnections: make(map[string]stream.C2S),
+	}
+	j, _ := jid.NewWithString("ortuman@localhost/balcony", true)
+	stm := &drainedStream{
+		MockC2S: stream.NewMockC2S(uuid.New().String(), j),
+		errCh:   make(chan error, 1),
+	}
+	srv.registerStream(stm) // never unregistered
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+
+	require.Equal(t, context.DeadlineExceeded, srv.drain(ctx, ""))
+	require.Equal(t, streamerror.ErrSystemShutdown, <-stm.errCh)
+	require.Equal(t, 1, srv.connectionCount())
+}
+
+func TestC2SServer_BannedAddress(t *testing.T) {
+	th, _ := tUtilAuthThrottler()
+	for i := 0; i < th.cfg.MaxFailures; i++ {
+		th.fail(ipThrottleKind, hostFromAddr(remoteAddr))
+	}
+	srv := &server{
+		cfg:           &Config{ID: "srv-1234"},
+		authThrottler: th,
+		inConnections: make(map[string]stream.C2S),
+	}
+	conn := newFakeSocketConn()
+	srv.startStream(transport.NewSocketTransport(conn), 0)
+
+	require.True(t, conn.waitClose())
+	require.Equal(t, 0, srv.connectionCount())
+}
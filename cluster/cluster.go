@@ -0,0 +1,376 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/util/runqueue"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	syncPath  = "/cluster/sync"
+	routePath = "/cluster/route"
+
+	maxRequestSize = 1 << 20
+)
+
+// memberTTLFactor represents the number of heartbeat intervals after which a silent member is considered gone.
+const memberTTLFactor = 3
+
+type routeMessage struct {
+	Node   string `json:"node"`
+	Stanza string `json:"stanza"`
+}
+
+// Cluster represents a jackal cluster node.
+type Cluster struct {
+	cfg       *Config
+	node      string
+	addr      string
+	client    *http.Client
+	srv       *http.Server
+	members   *members
+	mu        sync.RWMutex
+	local     map[string]router.ClusterResource
+	deliverer router.LocalDeliverer
+	queues    map[string]*runqueue.RunQueue
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+}
+
+// New returns a new cluster node instance identified by node name.
+func New(config *Config, node string) *Cluster {
+	return &Cluster{
+		cfg:     config,
+		node:    node,
+		client:  &http.Client{Timeout: config.RequestTimeout},
+		members: newMembers(),
+		local:   make(map[string]router.ClusterResource),
+		queues:  make(map[string]*runqueue.RunQueue),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Start starts listening for cluster peer connections and joins the configured peers.
+func (c *Cluster) Start() error {
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", c.cfg.BindAddr, c.cfg.Port))
+	if err != nil {
+		return err
+	}
+	c.addr = c.cfg.AdvertiseAddr
+	if len(c.addr) == 0 {
+		c.addr = ln.Addr().String()
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(syncPath, c.handleSync)
+	mux.HandleFunc(routePath, c.handleRoute)
+	c.srv = &http.Server{Handler: mux}
+
+	go func() { _ = c.srv.Serve(ln) }()
+	go c.loop()
+
+	log.Infof("cluster node %s listening at %s...", c.node, c.addr)
+	return nil
+}
+
+// Shutdown announces node departure and stops serving cluster peers.
+func (c *Cluster) Shutdown(ctx context.Context) error {
+	var err error
+	c.stopOnce.Do(func() {
+		err = c.shutdown(ctx)
+	})
+	return err
+}
+
+func (c *Cluster) shutdown(ctx context.Context) error {
+	close(c.stopCh)
+
+	msg := &syncMessage{Node: c.node, Addr: c.addr, Leaving: true}
+	for _, addr := range c.peerAddrs() {
+		if err := c.post(ctx, addr, syncPath, msg, nil); err != nil {
+			log.Warnf("cluster: failed to notify departure to %s: %v", addr, err)
+		}
+	}
+	c.mu.Lock()
+	for _, q := range c.queues {
+		q.Stop(func() {})
+	}
+	c.mu.Unlock()
+
+	if c.srv != nil {
+		return c.srv.Shutdown(ctx)
+	}
+	return nil
+}
+
+// Node returns cluster node name.
+func (c *Cluster) Node() string {
+	return c.node
+}
+
+// Addr returns the address cluster peers use to reach this node.
+func (c *Cluster) Addr() string {
+	return c.addr
+}
+
+// SetLocalDeliverer sets the deliverer used to route stanzas forwarded by other cluster nodes.
+func (c *Cluster) SetLocalDeliverer(d router.LocalDeliverer) {
+	c.mu.Lock()
+	c.deliverer = d
+	c.mu.Unlock()
+}
+
+// Resources returns all resources bound to a given bare JID on remote cluster nodes.
+func (c *Cluster) Resources(j *jid.JID) []router.ClusterResource {
+	return c.members.resources(j.ToBareJID().String())
+}
+
+// AllResources returns every resource bound on remote cluster nodes.
+func (c *Cluster) AllResources() []router.ClusterResource {
+	return c.members.allResources()
+}
+
+// BindResource announces a locally bound resource (or its presence update) to the rest of the cluster.
+func (c *Cluster) BindResource(res router.ClusterResource) {
+	res.Node = c.node
+
+	c.mu.Lock()
+	c.local[resourceKey(res.JID, res.Resource)] = res
+	c.mu.Unlock()
+
+	c.broadcast(&syncMessage{Node: c.node, Addr: c.addr, Bound: []router.ClusterResource{res}})
+}
+
+// UnbindResource announces a locally unbound resource to the rest of the cluster.
+func (c *Cluster) UnbindResource(j *jid.JID) {
+	res := router.ClusterResource{Node: c.node, JID: j.ToBareJID().String(), Resource: j.Resource()}
+
+	c.mu.Lock()
+	delete(c.local, resourceKey(res.JID, res.Resource))
+	c.mu.Unlock()
+
+	c.broadcast(&syncMessage{Node: c.node, Addr: c.addr, Unbound: []router.ClusterResource{res}})
+}
+
+// Route forwards a stanza to a cluster node in order to be delivered to its locally bound streams.
+func (c *Cluster) Route(ctx context.Context, stanza xmpp.Stanza, node string) error {
+	addr := c.members.addr(node)
+	if len(addr) == 0 {
+		return router.ErrNotAuthenticated
+	}
+	msg := &routeMessage{Node: c.node, Stanza: stanza.String()}
+
+	var errMsg string
+	if err := c.post(ctx, addr, routePath, msg, &errMsg); err != nil {
+		return err
+	}
+	if len(errMsg) > 0 {
+		return routeError(errMsg)
+	}
+	return nil
+}
+
+func (c *Cluster) loop() {
+	tc := time.NewTicker(c.cfg.HeartbeatInterval)
+	defer tc.Stop()
+
+	c.heartbeat()
+	for {
+		select {
+		case <-tc.C:
+			c.heartbeat()
+			for _, node := range c.members.expire(time.Now().Add(-c.cfg.HeartbeatInterval * memberTTLFactor)) {
+				log.Warnf("cluster: member %s expired", node)
+			}
+
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// heartbeat sends a full resource table snapshot to every peer.
+func (c *Cluster) heartbeat() {
+	c.mu.RLock()
+	bound := make([]router.ClusterResource, 0, len(c.local))
+	for _, res := range c.local {
+		bound = append(bound, res)
+	}
+	c.mu.RUnlock()
+
+	c.broadcast(&syncMessage{Node: c.node, Addr: c.addr, Full: true, Bound: bound})
+}
+
+func (c *Cluster) broadcast(msg *syncMessage) {
+	for _, addr := range c.peerAddrs() {
+		addr := addr
+		c.peerQueue(addr).Run(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), c.cfg.RequestTimeout)
+			defer cancel()
+			if err := c.post(ctx, addr, syncPath, msg, nil); err != nil {
+				log.Warnf("cluster: failed to sync with %s: %v", addr, err)
+			}
+		})
+	}
+}
+
+// peerAddrs returns the union of configured peers and all known member addresses.
+func (c *Cluster) peerAddrs() []string {
+	set := make(map[string]struct{})
+	var addrs []string
+	for _, addr := range append(c.cfg.Peers, c.members.addrs()...) {
+		if _, ok := set[addr]; ok || addr == c.addr {
+			continue
+		}
+		set[addr] = struct{}{}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// peerQueue returns the queue used to keep announcements to a given peer in order.
+func (c *Cluster) peerQueue(addr string) *runqueue.RunQueue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	q := c.queues[addr]
+	if q == nil {
+		q = runqueue.New("cluster:" + addr)
+		c.queues[addr] = q
+	}
+	return q
+}
+
+func (c *Cluster) post(ctx context.Context, addr, path string, body interface{}, errMsg *string) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.cfg.Secret)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		if errMsg != nil {
+			b, _ := ioutil.ReadAll(resp.Body)
+			*errMsg = strings.TrimSpace(string(b))
+			return nil
+		}
+	}
+	return fmt.Errorf("cluster: unexpected response status from %s: %d", addr, resp.StatusCode)
+}
+
+func (c *Cluster) handleSync(w http.ResponseWriter, r *http.Request) {
+	var msg syncMessage
+	if !c.decodeRequest(w, r, &msg) {
+		return
+	}
+	if msg.Node == c.node {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	c.members.sync(&msg, time.Now())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Cluster) handleRoute(w http.ResponseWriter, r *http.Request) {
+	var msg routeMessage
+	if !c.decodeRequest(w, r, &msg) {
+		return
+	}
+	stanza, err := parseStanza(msg.Stanza)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.RLock()
+	d := c.deliverer
+	c.mu.RUnlock()
+
+	if d == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if err := d.DeliverLocal(r.Context(), stanza); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Cluster) decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return false
+	}
+	if !c.isAuthorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (c *Cluster) isAuthorized(r *http.Request) bool {
+	secret := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(c.cfg.Secret)) == 1
+}
+
+func parseStanza(s string) (xmpp.Stanza, error) {
+	p := xmpp.NewParser(strings.NewReader(s), xmpp.DefaultMode, maxRequestSize)
+	elem, err := p.ParseElement()
+	if err != nil {
+		return nil, err
+	}
+	if elem == nil {
+		return nil, errors.New("cluster: empty stanza")
+	}
+	return xmpp.NewStanzaFromElement(elem)
+}
+
+func routeError(msg string) error {
+	for _, err := range []error{router.ErrNotAuthenticated, router.ErrResourceNotFound, router.ErrBlockedJID} {
+		if err.Error() == msg {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+func resourceKey(bareJID, resource string) string {
+	return bareJID + "/" + resource
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDeliverer struct {
+	mu      sync.Mutex
+	stanzas []xmpp.Stanza
+	err     error
+}
+
+func (d *fakeDeliverer) DeliverLocal(_ context.Context, stanza xmpp.Stanza) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	d.stanzas = append(d.stanzas, stanza)
+	return nil
+}
+
+func (d *fakeDeliverer) delivered() []xmpp.Stanza {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stanzas
+}
+
+func TestCluster_ResourceTable(t *testing.T) {
+	a, _ := tUtilStartNode(t, "node-a", nil)
+	defer func() { _ = a.Shutdown(context.Background()) }()
+
+	b, _ := tUtilStartNode(t, "node-b", []string{a.Addr()})
+
+	ortumanJID, _ := jid.NewWithString("ortuman@jackal.im", true)
+	noeliaJID, _ := jid.NewWithString("noelia@jackal.im", true)
+	balconyJID, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+
+	// node-a learns about node-b through its initial sync
+	b.BindResource(router.ClusterResource{JID: "ortuman@jackal.im", Resource: "balcony", Available: true, Priority: 5})
+
+	require.Eventually(t, func() bool { return len(a.Resources(ortumanJID)) == 1 }, time.Second*5, time.Millisecond*10)
+
+	res := a.Resources(ortumanJID)[0]
+	require.Equal(t, "node-b", res.Node)
+	require.Equal(t, "balcony", res.Resource)
+	require.True(t, res.Available)
+	require.Equal(t, int8(5), res.Priority)
+
+	// local resources are not reported as remote ones
+	require.Len(t, b.Resources(ortumanJID), 0)
+
+	// node-b learns about node-a once a has announced anything
+	a.BindResource(router.ClusterResource{JID: "noelia@jackal.im", Resource: "yard"})
+	require.Eventually(t, func() bool { return len(b.Resources(noeliaJID)) == 1 }, time.Second*5, time.Millisecond*10)
+
+	b.UnbindResource(balconyJID)
+	require.Eventually(t, func() bool { return len(a.Resources(ortumanJID)) == 0 }, time.Second*5, time.Millisecond*10)
+
+	// leaving node resources are gone
+	b.BindResource(router.ClusterResource{JID: "ortuman@jackal.im", Resource: "garden"})
+	require.Eventually(t, func() bool { return len(a.Resources(ortumanJID)) == 1 }, time.Second*5, time.Millisecond*10)
+
+	require.Nil(t, b.Shutdown(context.Background()))
+	require.Len(t, a.Resources(ortumanJID), 0)
+
+	// shutting down twice is harmless
+	require.Nil(t, b.Shutdown(context.Background()))
+}
+
+func TestCluster_Route(t *testing.T) {
+	a, _ := tUtilStartNode(t, "node-a", nil)
+	defer func() { _ = a.Shutdown(context.Background()) }()
+
+	b, d := tUtilStartNode(t, "node-b", []string{a.Addr()})
+	defer func() { _ = b.Shutdown(context.Background()) }()
+
+	from, _ := jid.NewWithString("noelia@jackal.im/yard", true)
+	to, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+
+	b.BindResource(router.ClusterResource{JID: "ortuman@jackal.im", Resource: "balcony", Available: true})
+	require.Eventually(t, func() bool { return len(a.Resources(to)) == 1 }, time.Second*5, time.Millisecond*10)
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+
+	require.Nil(t, a.Route(context.Background(), msg, "node-b"))
+
+	delivered := d.delivered()
+	require.Len(t, delivered, 1)
+	require.Equal(t, msg.ID(), delivered[0].ID())
+	require.Equal(t, to.String(), delivered[0].ToJID().String())
+
+	// delivery errors are propagated
+	d.mu.Lock()
+	d.err = router.ErrResourceNotFound
+	d.mu.Unlock()
+	require.Equal(t, router.ErrResourceNotFound, a.Route(context.Background(), msg, "node-b"))
+
+	// unknown node
+	require.Equal(t, router.ErrNotAuthenticated, a.Route(context.Background(), msg, "node-c"))
+}
+
+func TestCluster_Unauthorized(t *testing.T) {
+	a, _ := tUtilStartNode(t, "node-a", nil)
+	defer func() { _ = a.Shutdown(context.Background()) }()
+
+	body := []byte(`{"node":"node-x","addr":"127.0.0.1:1","bound":[{"jid":"ortuman@jackal.im","resource":"balcony"}]}`)
+	req, _ := http.NewRequest(http.MethodPost, "http://"+a.Addr()+syncPath, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer wrong")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	ortumanJID, _ := jid.NewWithString("ortuman@jackal.im", true)
+	require.Len(t, a.Resources(ortumanJID), 0)
+}
+
+func TestMembers_Expire(t *testing.T) {
+	m := newMembers()
+	now := time.Now()
+
+	m.sync(&syncMessage{Node: "node-a", Addr: "a:5999", Bound: []router.ClusterResource{{JID: "ortuman@jackal.im", Resource: "balcony"}}}, now.Add(-time.Minute))
+	m.sync(&syncMessage{Node: "node-b", Addr: "b:5999", Bound: []router.ClusterResource{{JID: "ortuman@jackal.im", Resource: "yard"}}}, now)
+	m.sync(&syncMessage{Node: "node-b", Addr: "b:5999", Bound: []router.ClusterResource{{JID: "noelia@jackal.im", Resource: "hall"}}}, now)
+	require.Len(t, m.resources("ortuman@jackal.im"), 2)
+	require.Len(t, m.allResources(), 3)
+
+	require.Equal(t, []string{"node-a"}, m.expire(now.Add(-time.Second)))
+	require.Len(t, m.resources("ortuman@jackal.im"), 1)
+	require.Equal(t, "", m.addr("node-a"))
+	require.Equal(t, "b:5999", m.addr("node-b"))
+
+	// full snapshot replaces previously known resources
+	m.sync(&syncMessage{Node: "node-b", Addr: "b:5999", Full: true}, now)
+	require.Len(t, m.resources("ortuman@jackal.im"), 0)
+	require.Len(t, m.allResources(), 0)
+}
+
+func tUtilStartNode(t *testing.T, node string, peers []string) (*Cluster, *fakeDeliverer) {
+	c := New(&Config{
+		BindAddr:          "127.0.0.1",
+		Secret:            "s3cr3t",
+		Peers:             peers,
+		HeartbeatInterval: time.Hour,
+		RequestTimeout:    time.Second,
+	}, node)
+	d := &fakeDeliverer{}
+	c.SetLocalDeliverer(d)
+	require.Nil(t, c.Start())
+	return c, d
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultBindAddr          = "0.0.0.0"
+	defaultPort              = 5999
+	defaultHeartbeatInterval = time.Duration(5) * time.Second
+	defaultRequestTimeout    = time.Duration(5) * time.Second
+)
+
+// Config represents a cluster node configuration.
+type Config struct {
+	BindAddr          string
+	Port              int
+	AdvertiseAddr     string
+	Secret            string
+	Peers             []string
+	HeartbeatInterval time.Duration
+	RequestTimeout    time.Duration
+}
+
+type configProxy struct {
+	BindAddr          string   `yaml:"bind_addr"`
+	Port              int      `yaml:"port"`
+	AdvertiseAddr     string   `yaml:"advertise_addr"`
+	Secret            string   `yaml:"secret"`
+	Peers             []string `yaml:"peers"`
+	HeartbeatInterval int      `yaml:"heartbeat_interval"`
+	RequestTimeout    int      `yaml:"request_timeout"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if len(p.Secret) == 0 {
+		return errors.New("cluster.Config: must specify a cluster secret")
+	}
+	cfg.BindAddr = p.BindAddr
+	if len(cfg.BindAddr) == 0 {
+		cfg.BindAddr = defaultBindAddr
+	}
+	cfg.Port = p.Port
+	if cfg.Port == 0 {
+		cfg.Port = defaultPort
+	}
+	cfg.AdvertiseAddr = p.AdvertiseAddr
+	cfg.Secret = p.Secret
+	cfg.Peers = p.Peers
+	cfg.HeartbeatInterval = time.Duration(p.HeartbeatInterval) * time.Second
+	if cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	cfg.RequestTimeout = time.Duration(p.RequestTimeout) * time.Second
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = defaultRequestTimeout
+	}
+	return nil
+}
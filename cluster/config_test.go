@@ -0,0 +1,34 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte("{peers: [10.0.0.2:5999]}"), &cfg)
+	require.NotNil(t, err) // missing secret
+
+	err = yaml.Unmarshal([]byte("{secret: s3cr3t, peers: [10.0.0.2:5999, 10.0.0.3:5999]}"), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, defaultBindAddr, cfg.BindAddr)
+	require.Equal(t, defaultPort, cfg.Port)
+	require.Equal(t, defaultHeartbeatInterval, cfg.HeartbeatInterval)
+	require.Equal(t, defaultRequestTimeout, cfg.RequestTimeout)
+	require.Len(t, cfg.Peers, 2)
+
+	err = yaml.Unmarshal([]byte("{secret: s3cr3t, port: 6000, advertise_addr: 10.0.0.1:6000, heartbeat_interval: 2}"), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 6000, cfg.Port)
+	require.Equal(t, "10.0.0.1:6000", cfg.AdvertiseAddr)
+	require.Equal(t, time.Second*2, cfg.HeartbeatInterval)
+}
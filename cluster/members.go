@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/router"
+)
+
+type syncMessage struct {
+	Node    string                   `json:"node"`
+	Addr    string                   `json:"addr"`
+	Full    bool                     `json:"full,omitempty"`
+	Leaving bool                     `json:"leaving,omitempty"`
+	Bound   []router.ClusterResource `json:"bound,omitempty"`
+	Unbound []router.ClusterResource `json:"unbound,omitempty"`
+}
+
+type member struct {
+	addr      string
+	lastSeen  time.Time
+	resources map[string]map[string]router.ClusterResource
+}
+
+// members represents the cluster-wide resource table as seen by a node.
+type members struct {
+	mu  sync.RWMutex
+	tbl map[string]*member
+}
+
+func newMembers() *members {
+	return &members{tbl: make(map[string]*member)}
+}
+
+func (m *members) sync(msg *syncMessage, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if msg.Leaving {
+		delete(m.tbl, msg.Node)
+		return
+	}
+	mb := m.tbl[msg.Node]
+	if mb == nil || msg.Full {
+		mb = &member{resources: make(map[string]map[string]router.ClusterResource)}
+		m.tbl[msg.Node] = mb
+	}
+	mb.addr = msg.Addr
+	mb.lastSeen = now
+
+	for _, res := range msg.Bound {
+		res.Node = msg.Node
+		if mb.resources[res.JID] == nil {
+			mb.resources[res.JID] = make(map[string]router.ClusterResource)
+		}
+		mb.resources[res.JID][res.Resource] = res
+	}
+	for _, res := range msg.Unbound {
+		if rs := mb.resources[res.JID]; rs != nil {
+			delete(rs, res.Resource)
+			if len(rs) == 0 {
+				delete(mb.resources, res.JID)
+			}
+		}
+	}
+}
+
+func (m *members) resources(bareJID string) []router.ClusterResource {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ret []router.ClusterResource
+	for _, mb := range m.tbl {
+		for _, res := range mb.resources[bareJID] {
+			ret = append(ret, res)
+		}
+	}
+	return ret
+}
+
+func (m *members) allResources() []router.ClusterResource {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ret []router.ClusterResource
+	for _, mb := range m.tbl {
+		for _, rs := range mb.resources {
+			for _, res := range rs {
+				ret = append(ret, res)
+			}
+		}
+	}
+	return ret
+}
+
+func (m *members) addr(node string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if mb := m.tbl[node]; mb != nil {
+		return mb.addr
+	}
+	return ""
+}
+
+func (m *members) addrs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ret := make([]string, 0, len(m.tbl))
+	for _, mb := range m.tbl {
+		ret = append(ret, mb.addr)
+	}
+	return ret
+}
+
+// expire removes all members not seen since deadline, returning their names.
+func (m *members) expire(deadline time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired []string
+	for node, mb := range m.tbl {
+		if mb.lastSeen.Before(deadline) {
+			delete(m.tbl, node)
+			expired = append(expired, node)
+		}
+	}
+	return expired
+}
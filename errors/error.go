@@ -12,6 +12,7 @@ import (
 // Error represents a "stream:error" element.
 type Error struct {
 	reason string
+	text   string
 }
 
 var (
@@ -62,10 +63,19 @@ func newStreamError(reason string) *Error {
 	return &Error{reason: reason}
 }
 
+// NewSeeOtherHost returns a 'see-other-host' stream error redirecting
+// the peer to an alternate host (RFC 6120, section 4.9.3.19).
+func NewSeeOtherHost(host string) *Error {
+	return &Error{reason: "see-other-host", text: host}
+}
+
 // Element returns stream error XML node.
 func (se *Error) Element() xmpp.XElement {
 	ret := xmpp.NewElementName("stream:error")
 	reason := xmpp.NewElementNamespace(se.reason, "urn:ietf:params:xml:ns:xmpp-streams")
+	if len(se.text) > 0 {
+		reason.SetText(se.text)
+	}
 	ret.AppendElement(reason)
 	return ret
 }
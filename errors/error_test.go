@@ -44,4 +44,9 @@ func TestStreamError(t *testing.T) {
 
 	require.Equal(t, "internal-server-error", ErrInternalServerError.Error())
 	require.Equal(t, "internal-server-error", ErrInternalServerError.Element().Elements().All()[0].Name())
+
+	seeOtherHost := NewSeeOtherHost("xmpp2.jackal.im:5222")
+	require.Equal(t, "see-other-host", seeOtherHost.Error())
+	require.Equal(t, "see-other-host", seeOtherHost.Element().Elements().All()[0].Name())
+	require.Equal(t, "xmpp2.jackal.im:5222", seeOtherHost.Element().Elements().All()[0].Text())
 }
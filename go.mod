@@ -13,6 +13,8 @@ require (
 	github.com/netsec-ethz/scion-apps v0.3.0
 	github.com/pborman/uuid v1.2.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.6.0
+	github.com/prometheus/client_model v0.2.0
 	github.com/scionproto/scion v0.6.0
 	github.com/sony/gobreaker v0.4.1
 	github.com/stretchr/testify v1.5.1
@@ -13,15 +13,24 @@ import (
 // BlockListItem represents block list item storage entity.
 type BlockListItem struct {
 	Username string
+	Domain   string
 	JID      string
 }
 
+// UserJID returns block list owner bare JID string representation.
+func (bli *BlockListItem) UserJID() string {
+	return BareJID(bli.Username, bli.Domain)
+}
+
 // FromBytes deserializes a BlockListItem entity from its binary representation.
 func (bli *BlockListItem) FromBytes(buf *bytes.Buffer) error {
 	dec := gob.NewDecoder(buf)
 	if err := dec.Decode(&bli.Username); err != nil {
 		return err
 	}
+	if err := dec.Decode(&bli.Domain); err != nil {
+		return err
+	}
 	return dec.Decode(&bli.JID)
 }
 
@@ -31,5 +40,8 @@ func (bli *BlockListItem) ToBytes(buf *bytes.Buffer) error {
 	if err := enc.Encode(&bli.Username); err != nil {
 		return err
 	}
+	if err := enc.Encode(&bli.Domain); err != nil {
+		return err
+	}
 	return enc.Encode(&bli.JID)
 }
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+)
+
+// Invitation represents a pre-authenticated registration token (XEP-0401).
+type Invitation struct {
+	Token    string    `json:"token"`
+	Username string    `json:"username,omitempty"` // if not empty, the only account the token can register
+	Expires  time.Time `json:"expires"`
+}
+
+// IsExpired tells whether or not the invitation can no longer be used at a given time.
+func (inv *Invitation) IsExpired(now time.Time) bool {
+	return !now.Before(inv.Expires)
+}
+
+// FromBytes deserializes an Invitation entity from its binary representation.
+func (inv *Invitation) FromBytes(buf *bytes.Buffer) error {
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&inv.Token); err != nil {
+		return err
+	}
+	if err := dec.Decode(&inv.Username); err != nil {
+		return err
+	}
+	return dec.Decode(&inv.Expires)
+}
+
+// ToBytes converts an Invitation entity to its binary representation.
+func (inv *Invitation) ToBytes(buf *bytes.Buffer) error {
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(&inv.Token); err != nil {
+		return err
+	}
+	if err := enc.Encode(&inv.Username); err != nil {
+		return err
+	}
+	return enc.Encode(&inv.Expires)
+}
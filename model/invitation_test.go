@@ -0,0 +1,29 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelInvitation(t *testing.T) {
+	var inv1, inv2 Invitation
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	inv1 = Invitation{Token: "abcd1234", Username: "ortuman", Expires: now.Add(time.Hour)}
+
+	buf := new(bytes.Buffer)
+	require.Nil(t, inv1.ToBytes(buf))
+	require.Nil(t, inv2.FromBytes(buf))
+	require.Equal(t, inv1, inv2)
+
+	require.False(t, inv1.IsExpired(now))
+	require.True(t, inv1.IsExpired(now.Add(time.Hour)))
+}
@@ -0,0 +1,25 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import "strings"
+
+// BareJID returns the bare JID string used as storage key for user related entities.
+// An empty domain yields the username itself.
+func BareJID(username, domain string) string {
+	if len(domain) == 0 {
+		return username
+	}
+	return username + "@" + domain
+}
+
+// SplitBareJID splits a bare JID storage key into its username and domain parts.
+func SplitBareJID(bareJID string) (username, domain string) {
+	if i := strings.IndexByte(bareJID, '@'); i != -1 {
+		return bareJID[:i], bareJID[i+1:]
+	}
+	return bareJID, ""
+}
@@ -0,0 +1,25 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBareJID(t *testing.T) {
+	require.Equal(t, "ortuman@jackal.im", BareJID("ortuman", "jackal.im"))
+	require.Equal(t, "ortuman", BareJID("ortuman", ""))
+
+	username, domain := SplitBareJID("ortuman@jackal.im")
+	require.Equal(t, "ortuman", username)
+	require.Equal(t, "jackal.im", domain)
+
+	username, domain = SplitBareJID("ortuman")
+	require.Equal(t, "ortuman", username)
+	require.Equal(t, "", domain)
+}
@@ -8,15 +8,17 @@ package pubsubmodel
 import (
 	"bytes"
 	"encoding/gob"
+	"time"
 
 	"github.com/ortuman/jackal/xmpp"
 )
 
 // Item represents a pubsub node item
 type Item struct {
-	ID        string
-	Publisher string
-	Payload   xmpp.XElement
+	ID          string
+	Publisher   string
+	Payload     xmpp.XElement
+	PublishedAt time.Time
 }
 
 // FromBytes deserializes a Item entity from its binary representation.
@@ -28,6 +30,9 @@ func (i *Item) FromBytes(buf *bytes.Buffer) error {
 	if err := dec.Decode(&i.Publisher); err != nil {
 		return err
 	}
+	if err := dec.Decode(&i.PublishedAt); err != nil {
+		return err
+	}
 	var hasPayload bool
 	if err := dec.Decode(&hasPayload); err != nil {
 		return err
@@ -51,6 +56,9 @@ func (i *Item) ToBytes(buf *bytes.Buffer) error {
 	if err := enc.Encode(i.Publisher); err != nil {
 		return err
 	}
+	if err := enc.Encode(i.PublishedAt); err != nil {
+		return err
+	}
 	hasPayload := i.Payload != nil
 	if err := enc.Encode(hasPayload); err != nil {
 		return err
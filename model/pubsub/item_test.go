@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/stretchr/testify/require"
@@ -19,6 +20,7 @@ func TestItem_Serialization(t *testing.T) {
 	it.ID = "1234"
 	it.Publisher = "ortuman@jackal.im"
 	it.Payload = xmpp.NewElementName("el")
+	it.PublishedAt = time.Unix(1570000000, 0).UTC()
 
 	buf := bytes.NewBuffer(nil)
 	require.Nil(t, it.ToBytes(buf))
@@ -54,8 +54,14 @@ const (
 
 	// OnSubAndPresence represents 'on_sub_and_presence' send last published item option.
 	OnSubAndPresence = "on_sub_and_presence"
+
+	// Max represents 'max' max items option value.
+	Max = "max"
 )
 
+// MaxItemsLimit represents the number of items persisted by a node configured with 'max' max items value.
+const MaxItemsLimit = 1024
+
 // Options represents pubsub node configuration options
 type Options struct {
 	Title                 string
@@ -81,7 +87,7 @@ func NewOptionsFromMap(m map[string]string) (*Options, error) {
 	opt.DeliverNotifications, _ = strconv.ParseBool(m[deliverNotificationsFieldVar])
 	opt.DeliverPayloads, _ = strconv.ParseBool(m[deliverPayloadsFieldVar])
 	opt.PersistItems, _ = strconv.ParseBool(m[persistItemsFieldVar])
-	opt.MaxItems, _ = strconv.ParseInt(m[maxItemsFieldVar], 10, 32)
+	opt.MaxItems = parseMaxItems(m[maxItemsFieldVar])
 	opt.NotificationType = m[notificationTypeFieldVar]
 	opt.NotifyConfig, _ = strconv.ParseBool(m[notifyConfigFieldVar])
 	opt.NotifyDelete, _ = strconv.ParseBool(m[notifyDeleteFieldVar])
@@ -148,7 +154,7 @@ func NewOptionsFromSubmitForm(form *xep0004.DataForm) (*Options, error) {
 	opt.DeliverPayloads, _ = strconv.ParseBool(fields.ValueForField(deliverPayloadsFieldVar))
 	opt.PersistItems, _ = strconv.ParseBool(fields.ValueForField(persistItemsFieldVar))
 	opt.RosterGroupsAllowed = fields.ValuesForField(rosterGroupsAllowedFieldVar)
-	opt.MaxItems, _ = strconv.ParseInt(fields.ValueForField(maxItemsFieldVar), 10, 32)
+	opt.MaxItems = parseMaxItems(fields.ValueForField(maxItemsFieldVar))
 	opt.NotificationType = fields.ValueForField(notificationTypeFieldVar)
 	opt.NotifyConfig, _ = strconv.ParseBool(fields.ValueForField(notifyConfigFieldVar))
 	opt.NotifyDelete, _ = strconv.ParseBool(fields.ValueForField(notifyDeleteFieldVar))
@@ -348,3 +354,11 @@ func (opt *Options) ResultForm() *xep0004.DataForm {
 	})
 	return &form
 }
+
+func parseMaxItems(s string) int64 {
+	if s == Max {
+		return MaxItemsLimit
+	}
+	maxItems, _ := strconv.ParseInt(s, 10, 32)
+	return maxItems
+}
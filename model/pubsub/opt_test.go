@@ -106,3 +106,13 @@ func TestOptions_New(t *testing.T) {
 	require.Nil(t, err)
 	require.True(t, reflect.DeepEqual(&opt, &opt3))
 }
+
+func TestOptions_MaxItems(t *testing.T) {
+	opt := &Options{AccessModel: WhiteList, SendLastPublishedItem: Never}
+	m, _ := opt.Map()
+	m[maxItemsFieldVar] = Max
+
+	opt2, err := NewOptionsFromMap(m)
+	require.Nil(t, err)
+	require.Equal(t, int64(MaxItemsLimit), opt2.MaxItems)
+}
@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 )
@@ -27,10 +28,12 @@ const (
 // Item represents a roster item storage entity.
 type Item struct {
 	Username     string
+	Domain       string
 	JID          string
 	Name         string
 	Subscription string
 	Ask          bool
+	Approved     bool
 	Ver          int
 	Groups       []string
 }
@@ -69,6 +72,17 @@ func NewItem(elem xmpp.XElement) (*Item, error) {
 		}
 		ri.Ask = true
 	}
+	approved := elem.Attributes().Get("approved")
+	if len(approved) > 0 {
+		switch approved {
+		case "true", "1":
+			ri.Approved = true
+		case "false", "0":
+			break
+		default:
+			return nil, fmt.Errorf("unrecognized 'approved' value: %s", approved)
+		}
+	}
 	groups := elem.Elements().Children("group")
 	for _, group := range groups {
 		if group.Attributes().Count() > 0 {
@@ -95,6 +109,9 @@ func (ri *Item) Element() xmpp.XElement {
 	if ri.Ask {
 		item.SetAttribute("ask", "subscribe")
 	}
+	if ri.Approved {
+		item.SetAttribute("approved", "true")
+	}
 	for _, group := range ri.Groups {
 		gr := xmpp.NewElementName("group")
 		gr.SetText(group)
@@ -109,12 +126,20 @@ func (ri *Item) ContactJID() *jid.JID {
 	return j
 }
 
+// UserJID returns roster owner bare JID string representation.
+func (ri *Item) UserJID() string {
+	return model.BareJID(ri.Username, ri.Domain)
+}
+
 // FromBytes deserializes a RosterItem entity from its representation.
 func (ri *Item) FromBytes(buf *bytes.Buffer) error {
 	dec := gob.NewDecoder(buf)
 	if err := dec.Decode(&ri.Username); err != nil {
 		return err
 	}
+	if err := dec.Decode(&ri.Domain); err != nil {
+		return err
+	}
 	if err := dec.Decode(&ri.JID); err != nil {
 		return err
 	}
@@ -130,7 +155,10 @@ func (ri *Item) FromBytes(buf *bytes.Buffer) error {
 	if err := dec.Decode(&ri.Ver); err != nil {
 		return err
 	}
-	return dec.Decode(&ri.Groups)
+	if err := dec.Decode(&ri.Groups); err != nil {
+		return err
+	}
+	return dec.Decode(&ri.Approved)
 }
 
 // ToBytes converts a RosterItem entity to its binary representation.
@@ -139,6 +167,9 @@ func (ri *Item) ToBytes(buf *bytes.Buffer) error {
 	if err := enc.Encode(&ri.Username); err != nil {
 		return err
 	}
+	if err := enc.Encode(&ri.Domain); err != nil {
+		return err
+	}
 	if err := enc.Encode(&ri.JID); err != nil {
 		return err
 	}
@@ -154,5 +185,8 @@ func (ri *Item) ToBytes(buf *bytes.Buffer) error {
 	if err := enc.Encode(&ri.Ver); err != nil {
 		return err
 	}
-	return enc.Encode(&ri.Groups)
+	if err := enc.Encode(&ri.Groups); err != nil {
+		return err
+	}
+	return enc.Encode(&ri.Approved)
 }
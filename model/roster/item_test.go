@@ -45,8 +45,15 @@ func TestItemElement(t *testing.T) {
 	require.Nil(t, it)
 	require.NotNil(t, err)
 
-	// attach bad group
+	// bad approved
 	elem.SetAttribute("ask", "subscribe")
+	elem.SetAttribute("approved", "foo")
+	it, err = NewItem(elem)
+	require.Nil(t, it)
+	require.NotNil(t, err)
+
+	// attach bad group
+	elem.SetAttribute("approved", "true")
 	elem.AppendElement(xmpp.NewElementNamespace("group", "ns"))
 	it, err = NewItem(elem)
 	require.Nil(t, it)
@@ -67,6 +74,7 @@ func TestItemElement(t *testing.T) {
 	require.Equal(t, "ortuman@jackal.im", itElem.Attributes().Get("jid"))
 	require.Equal(t, "both", itElem.Attributes().Get("subscription"))
 	require.Equal(t, "subscribe", itElem.Attributes().Get("ask"))
+	require.Equal(t, "true", itElem.Attributes().Get("approved"))
 	require.Equal(t, 1, len(itElem.Elements().All()))
 }
 
@@ -74,8 +82,10 @@ func TestItem_Serialize(t *testing.T) {
 	var ri1 Item
 	ri1 = Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia",
 		Ask:          true,
+		Approved:     true,
 		Subscription: "none",
 		Groups:       []string{"friends", "family"},
 	}
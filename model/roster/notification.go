@@ -9,22 +9,32 @@ import (
 	"bytes"
 	"encoding/gob"
 
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xmpp"
 )
 
 // Notification represents a roster subscription pending notification.
 type Notification struct {
 	Contact  string
+	Domain   string
 	JID      string
 	Presence *xmpp.Presence
 }
 
+// ContactJID returns notified contact bare JID string representation.
+func (rn *Notification) ContactJID() string {
+	return model.BareJID(rn.Contact, rn.Domain)
+}
+
 // FromBytes deserializes a Notification entity from its binary representation.
 func (rn *Notification) FromBytes(buf *bytes.Buffer) error {
 	dec := gob.NewDecoder(buf)
 	if err := dec.Decode(&rn.Contact); err != nil {
 		return err
 	}
+	if err := dec.Decode(&rn.Domain); err != nil {
+		return err
+	}
 	if err := dec.Decode(&rn.JID); err != nil {
 		return err
 	}
@@ -42,6 +52,9 @@ func (rn *Notification) ToBytes(buf *bytes.Buffer) error {
 	if err := enc.Encode(&rn.Contact); err != nil {
 		return err
 	}
+	if err := enc.Encode(&rn.Domain); err != nil {
+		return err
+	}
 	if err := enc.Encode(&rn.JID); err != nil {
 		return err
 	}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package rostermodel
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// SharedGroup represents an administrator defined roster group.
+// Shared group members are automatically added to each other's rosters with a mutual subscription.
+type SharedGroup struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Hosts       []string `json:"hosts,omitempty"`   // every user registered on these hosts is a member
+	Members     []string `json:"members,omitempty"` // explicit members bare JIDs
+}
+
+// IsMember tells whether or not a JID belongs to the shared group.
+func (g *SharedGroup) IsMember(j *jid.JID) bool {
+	for _, host := range g.Hosts {
+		if host == j.Domain() {
+			return true
+		}
+	}
+	bareJID := j.ToBareJID().String()
+	for _, member := range g.Members {
+		if member == bareJID {
+			return true
+		}
+	}
+	return false
+}
+
+// FromBytes deserializes a SharedGroup entity from its binary representation.
+func (g *SharedGroup) FromBytes(buf *bytes.Buffer) error {
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&g.Name); err != nil {
+		return err
+	}
+	if err := dec.Decode(&g.Description); err != nil {
+		return err
+	}
+	if err := dec.Decode(&g.Hosts); err != nil {
+		return err
+	}
+	return dec.Decode(&g.Members)
+}
+
+// ToBytes converts a SharedGroup entity to its binary representation.
+func (g *SharedGroup) ToBytes(buf *bytes.Buffer) error {
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(&g.Name); err != nil {
+		return err
+	}
+	if err := enc.Encode(&g.Description); err != nil {
+		return err
+	}
+	if err := enc.Encode(&g.Hosts); err != nil {
+		return err
+	}
+	return enc.Encode(&g.Members)
+}
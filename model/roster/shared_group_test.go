@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package rostermodel
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelSharedGroup(t *testing.T) {
+	var g1, g2 SharedGroup
+
+	g1 = SharedGroup{
+		Name:        "Engineering",
+		Description: "Engineering team",
+		Hosts:       []string{"dev.jackal.im"},
+		Members:     []string{"ortuman@jackal.im", "noelia@jackal.im"},
+	}
+	buf := new(bytes.Buffer)
+	require.Nil(t, g1.ToBytes(buf))
+	require.Nil(t, g2.FromBytes(buf))
+	require.Equal(t, g1, g2)
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	j2, _ := jid.NewWithString("romeo@dev.jackal.im", true)
+	j3, _ := jid.NewWithString("romeo@jackal.im", true)
+	require.True(t, g1.IsMember(j1))
+	require.True(t, g1.IsMember(j2))
+	require.False(t, g1.IsMember(j3))
+}
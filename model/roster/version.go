@@ -12,7 +12,10 @@ import (
 
 // Version represents a roster version info.
 type Version struct {
-	Ver         int
+	Ver int
+
+	// DeletionVer is the latest version at which roster items were removed
+	// without being recorded into the roster change log.
 	DeletionVer int
 }
 
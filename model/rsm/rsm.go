@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package rsmmodel
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ortuman/jackal/xmpp"
+)
+
+// Namespace specifies XEP-0059 namespace constant value.
+const Namespace = "http://jabber.org/protocol/rsm"
+
+// ErrPageNotFound will be returned by Paginate in case the requested page is anchored to a non existing item.
+var ErrPageNotFound = errors.New("rsm: page not found")
+
+// Request represents a result set management request.
+type Request struct {
+	// Max specifies the maximum number of items to be returned.
+	// A negative value means no limit was requested.
+	Max int
+
+	// After requests the page following the item identified by this value.
+	After string
+
+	// Before requests the page preceding the item identified by this value.
+	Before string
+
+	// LastPage is set when an empty before element was requested.
+	LastPage bool
+
+	// Index requests the page starting at a given item position.
+	Index int
+}
+
+// Result represents the page information returned along a result set.
+type Result struct {
+	First      string
+	FirstIndex int
+	Last       string
+	Count      int
+}
+
+// NewRequestFromElement returns a new result set request entity reading it from it's XMPP representation.
+func NewRequestFromElement(elem xmpp.XElement) (*Request, error) {
+	if n := elem.Name(); n != "set" {
+		return nil, fmt.Errorf("invalid set name: %s", n)
+	}
+	if ns := elem.Namespace(); ns != Namespace {
+		return nil, fmt.Errorf("invalid set namespace: %s", ns)
+	}
+	req := &Request{Max: -1}
+	if maxEl := elem.Elements().Child("max"); maxEl != nil {
+		max, err := strconv.Atoi(maxEl.Text())
+		if err != nil || max < 0 {
+			return nil, fmt.Errorf("invalid max value: %s", maxEl.Text())
+		}
+		req.Max = max
+	}
+	if afterEl := elem.Elements().Child("after"); afterEl != nil {
+		if len(afterEl.Text()) == 0 {
+			return nil, errors.New("empty after value")
+		}
+		req.After = afterEl.Text()
+	}
+	if beforeEl := elem.Elements().Child("before"); beforeEl != nil {
+		req.Before = beforeEl.Text()
+		req.LastPage = len(req.Before) == 0
+	}
+	if indexEl := elem.Elements().Child("index"); indexEl != nil {
+		index, err := strconv.Atoi(indexEl.Text())
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid index value: %s", indexEl.Text())
+		}
+		req.Index = index
+	}
+	if len(req.After) > 0 && (len(req.Before) > 0 || req.LastPage) {
+		return nil, errors.New("after and before values are mutually exclusive")
+	}
+	return req, nil
+}
+
+// Element returns result set XMPP representation.
+func (r *Result) Element() xmpp.XElement {
+	elem := xmpp.NewElementNamespace("set", Namespace)
+	if len(r.First) > 0 {
+		firstEl := xmpp.NewElementName("first")
+		firstEl.SetAttribute("index", strconv.Itoa(r.FirstIndex))
+		firstEl.SetText(r.First)
+		elem.AppendElement(firstEl)
+		elem.AppendElement(xmpp.NewElementName("last").SetText(r.Last))
+	}
+	elem.AppendElement(xmpp.NewElementName("count").SetText(strconv.Itoa(r.Count)))
+	return elem
+}
+
+// Paginate applies a result set request over an ordered list of item identifiers,
+// returning the [from, to) bounds of the requested page along with its result set information.
+func Paginate(identifiers []string, req *Request) (from, to int, res *Result, err error) {
+	count := len(identifiers)
+	max := req.Max
+	if max < 0 {
+		max = count
+	}
+	switch {
+	case len(req.After) > 0:
+		pos := indexOf(identifiers, req.After)
+		if pos == -1 {
+			return 0, 0, nil, ErrPageNotFound
+		}
+		from = pos + 1
+		to = minInt(from+max, count)
+
+	case len(req.Before) > 0:
+		pos := indexOf(identifiers, req.Before)
+		if pos == -1 {
+			return 0, 0, nil, ErrPageNotFound
+		}
+		to = pos
+		from = maxInt(to-max, 0)
+
+	case req.LastPage:
+		to = count
+		from = maxInt(to-max, 0)
+
+	default:
+		from = minInt(req.Index, count)
+		to = minInt(from+max, count)
+	}
+	res = &Result{Count: count}
+	if to > from {
+		res.First = identifiers[from]
+		res.FirstIndex = from
+		res.Last = identifiers[to-1]
+	}
+	return from, to, res, nil
+}
+
+func indexOf(identifiers []string, id string) int {
+	for i, identifier := range identifiers {
+		if identifier == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package rsmmodel
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSM_NewRequestFromElement(t *testing.T) {
+	_, err := NewRequestFromElement(xmpp.NewElementNamespace("query", Namespace))
+	require.NotNil(t, err)
+
+	_, err = NewRequestFromElement(xmpp.NewElementNamespace("set", "jabber:iq:roster"))
+	require.NotNil(t, err)
+
+	set := xmpp.NewElementNamespace("set", Namespace)
+	set.AppendElement(xmpp.NewElementName("max").SetText("-1"))
+	_, err = NewRequestFromElement(set)
+	require.NotNil(t, err)
+
+	set = xmpp.NewElementNamespace("set", Namespace)
+	set.AppendElement(xmpp.NewElementName("after").SetText("a"))
+	set.AppendElement(xmpp.NewElementName("before"))
+	_, err = NewRequestFromElement(set)
+	require.NotNil(t, err)
+
+	set = xmpp.NewElementNamespace("set", Namespace)
+	req, err := NewRequestFromElement(set)
+	require.Nil(t, err)
+	require.Equal(t, -1, req.Max)
+
+	set = xmpp.NewElementNamespace("set", Namespace)
+	set.AppendElement(xmpp.NewElementName("max").SetText("10"))
+	set.AppendElement(xmpp.NewElementName("before"))
+	req, err = NewRequestFromElement(set)
+	require.Nil(t, err)
+	require.Equal(t, 10, req.Max)
+	require.True(t, req.LastPage)
+
+	set = xmpp.NewElementNamespace("set", Namespace)
+	set.AppendElement(xmpp.NewElementName("max").SetText("10"))
+	set.AppendElement(xmpp.NewElementName("index").SetText("20"))
+	req, err = NewRequestFromElement(set)
+	require.Nil(t, err)
+	require.Equal(t, 20, req.Index)
+}
+
+func TestRSM_Paginate(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e"}
+
+	from, to, res, err := Paginate(ids, &Request{Max: 2})
+	require.Nil(t, err)
+	require.Equal(t, 0, from)
+	require.Equal(t, 2, to)
+	require.Equal(t, &Result{First: "a", FirstIndex: 0, Last: "b", Count: 5}, res)
+
+	from, to, res, err = Paginate(ids, &Request{Max: 2, After: "d"})
+	require.Nil(t, err)
+	require.Equal(t, 4, from)
+	require.Equal(t, 5, to)
+	require.Equal(t, &Result{First: "e", FirstIndex: 4, Last: "e", Count: 5}, res)
+
+	from, to, _, err = Paginate(ids, &Request{Max: 2, Before: "d"})
+	require.Nil(t, err)
+	require.Equal(t, 1, from)
+	require.Equal(t, 3, to)
+
+	from, to, _, err = Paginate(ids, &Request{Max: 2, LastPage: true})
+	require.Nil(t, err)
+	require.Equal(t, 3, from)
+	require.Equal(t, 5, to)
+
+	from, to, _, err = Paginate(ids, &Request{Max: -1, Index: 3})
+	require.Nil(t, err)
+	require.Equal(t, 3, from)
+	require.Equal(t, 5, to)
+
+	// item count request
+	from, to, res, err = Paginate(ids, &Request{Max: 0})
+	require.Nil(t, err)
+	require.Equal(t, from, to)
+	require.Equal(t, &Result{Count: 5}, res)
+
+	_, _, _, err = Paginate(ids, &Request{Max: 2, After: "z"})
+	require.Equal(t, ErrPageNotFound, err)
+
+	res = &Result{First: "a", FirstIndex: 0, Last: "b", Count: 5}
+	elem := res.Element()
+	require.Equal(t, Namespace, elem.Namespace())
+	require.Equal(t, "a", elem.Elements().Child("first").Text())
+	require.Equal(t, "0", elem.Elements().Child("first").Attributes().Get("index"))
+	require.Equal(t, "b", elem.Elements().Child("last").Text())
+	require.Equal(t, "5", elem.Elements().Child("count").Text())
+}
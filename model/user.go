@@ -16,17 +16,26 @@ import (
 // User represents a user storage entity.
 type User struct {
 	Username       string
+	Domain         string
 	Password       string
 	LastPresence   *xmpp.Presence
 	LastPresenceAt time.Time
 }
 
+// BareJID returns user bare JID string representation.
+func (u *User) BareJID() string {
+	return BareJID(u.Username, u.Domain)
+}
+
 // FromBytes deserializes a User entity from it's gob binary representation.
 func (u *User) FromBytes(buf *bytes.Buffer) error {
 	dec := gob.NewDecoder(buf)
 	if err := dec.Decode(&u.Username); err != nil {
 		return err
 	}
+	if err := dec.Decode(&u.Domain); err != nil {
+		return err
+	}
 	if err := dec.Decode(&u.Password); err != nil {
 		return err
 	}
@@ -53,6 +62,9 @@ func (u *User) ToBytes(buf *bytes.Buffer) error {
 	if err := enc.Encode(&u.Username); err != nil {
 		return err
 	}
+	if err := enc.Encode(&u.Domain); err != nil {
+		return err
+	}
 	if err := enc.Encode(&u.Password); err != nil {
 		return err
 	}
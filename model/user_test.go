@@ -22,6 +22,7 @@ func TestModelUser(t *testing.T) {
 	j2, _ := jid.NewWithString("ortuman@jackal.im", true)
 
 	usr1.Username = "ortuman"
+	usr1.Domain = "jackal.im"
 	usr1.Password = "1234"
 	usr1.LastPresence = xmpp.NewPresence(j1, j2, xmpp.AvailableType)
 
@@ -30,6 +31,8 @@ func TestModelUser(t *testing.T) {
 	usr2 := User{}
 	require.Nil(t, usr2.FromBytes(buf))
 	require.Equal(t, usr1.Username, usr2.Username)
+	require.Equal(t, usr1.Domain, usr2.Domain)
+	require.Equal(t, "ortuman@jackal.im", usr2.BareJID())
 	require.Equal(t, usr1.Password, usr2.Password)
 	require.Equal(t, usr1.LastPresence.String(), usr2.LastPresence.String())
 	require.NotEqual(t, time.Time{}, usr2.LastPresenceAt)
@@ -6,32 +6,50 @@
 package module
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/ortuman/jackal/module/offline"
 	"github.com/ortuman/jackal/module/roster"
+	"github.com/ortuman/jackal/module/xep0050"
 	"github.com/ortuman/jackal/module/xep0077"
 	"github.com/ortuman/jackal/module/xep0092"
+	"github.com/ortuman/jackal/module/xep0133"
+	"github.com/ortuman/jackal/module/xep0163"
 	"github.com/ortuman/jackal/module/xep0199"
 )
 
+// HostConfig represents a per-host modules override.
+type HostConfig struct {
+	Name    string   `yaml:"name"`
+	Enabled []string `yaml:"enabled"`
+}
+
 // Config represents C2S modules configuration.
 type Config struct {
 	Enabled      map[string]struct{}
+	HostEnabled  map[string]map[string]struct{}
 	Roster       roster.Config
 	Offline      offline.Config
+	AdHoc        xep0050.Config
 	Registration xep0077.Config
 	Version      xep0092.Config
+	ServiceAdmin xep0133.Config
 	Ping         xep0199.Config
+	Pep          xep0163.Config
 }
 
 type configProxy struct {
 	Enabled      []string       `yaml:"enabled"`
+	Hosts        []HostConfig   `yaml:"hosts"`
 	Roster       roster.Config  `yaml:"mod_roster"`
 	Offline      offline.Config `yaml:"mod_offline"`
+	AdHoc        xep0050.Config `yaml:"mod_adhoc"`
 	Registration xep0077.Config `yaml:"mod_registration"`
 	Version      xep0092.Config `yaml:"mod_version"`
+	ServiceAdmin xep0133.Config `yaml:"mod_service_admin"`
 	Ping         xep0199.Config `yaml:"mod_ping"`
+	Pep          xep0163.Config `yaml:"mod_pep"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -43,20 +61,78 @@ func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// validate modules
 	enabled := make(map[string]struct{}, len(p.Enabled))
 	for _, mod := range p.Enabled {
-		switch mod {
-		case "roster", "last_activity", "private", "vcard", "registration", "pep", "version", "blocking_command",
-			"ping", "offline":
-			break
-		default:
+		if !isKnownModule(mod) {
 			return fmt.Errorf("module.Config: unrecognized module: %s", mod)
 		}
 		enabled[mod] = struct{}{}
 	}
+	// validate module dependencies
+	for mod := range enabled {
+		for _, dep := range moduleDependencies[mod] {
+			if _, ok := enabled[dep]; !ok {
+				return fmt.Errorf("module.Config: module %s requires %s module to be enabled", mod, dep)
+			}
+		}
+	}
+	// validate per-host overrides
+	hostEnabled := make(map[string]map[string]struct{}, len(p.Hosts))
+	for _, h := range p.Hosts {
+		if len(h.Name) == 0 {
+			return errors.New("module.Config: host name must be specified")
+		}
+		if _, ok := hostEnabled[h.Name]; ok {
+			return fmt.Errorf("module.Config: duplicated host: %s", h.Name)
+		}
+		mods := make(map[string]struct{}, len(h.Enabled))
+		for _, mod := range h.Enabled {
+			if !isKnownModule(mod) {
+				return fmt.Errorf("module.Config: unrecognized module: %s", mod)
+			}
+			if _, ok := enabled[mod]; !ok {
+				return fmt.Errorf("module.Config: module %s not globally enabled (host: %s)", mod, h.Name)
+			}
+			mods[mod] = struct{}{}
+		}
+		hostEnabled[h.Name] = mods
+	}
 	cfg.Enabled = enabled
+	cfg.HostEnabled = hostEnabled
 	cfg.Roster = p.Roster
 	cfg.Offline = p.Offline
+	cfg.AdHoc = p.AdHoc
 	cfg.Registration = p.Registration
 	cfg.Version = p.Version
+	cfg.ServiceAdmin = p.ServiceAdmin
 	cfg.Ping = p.Ping
+	cfg.Pep = p.Pep
 	return nil
 }
+
+// IsEnabledForHost tells whether a module is enabled for a given host.
+// Hosts with no explicit override fall back to the global enabled list.
+func (cfg *Config) IsEnabledForHost(mod, host string) bool {
+	if mods, ok := cfg.HostEnabled[host]; ok {
+		_, ok := mods[mod]
+		return ok
+	}
+	_, ok := cfg.Enabled[mod]
+	return ok
+}
+
+// moduleDependencies contains the set of modules each module relies on.
+var moduleDependencies = map[string][]string{
+	"avatar":    {"pep", "vcard"},
+	"vcard4":    {"pep", "vcard"},
+	"bookmarks": {"pep", "private"},
+
+	"service_admin": {"adhoc"},
+}
+
+func isKnownModule(mod string) bool {
+	switch mod {
+	case "roster", "last_activity", "private", "vcard", "registration", "pep", "version", "blocking_command",
+		"ping", "offline", "avatar", "vcard4", "bookmarks", "adhoc", "service_admin":
+		return true
+	}
+	return false
+}
@@ -23,4 +23,44 @@ func TestModuleConfig(t *testing.T) {
 	validMod := `enabled: [roster]`
 	err = yaml.Unmarshal([]byte(validMod), &cfg)
 	require.Nil(t, err)
+	badAvatarMod := `enabled: [avatar, vcard]`
+	err = yaml.Unmarshal([]byte(badAvatarMod), &cfg)
+	require.NotNil(t, err)
+	avatarMod := `enabled: [avatar, vcard, pep]`
+	err = yaml.Unmarshal([]byte(avatarMod), &cfg)
+	require.Nil(t, err)
+	badVCard4Mod := `enabled: [vcard4, pep]`
+	err = yaml.Unmarshal([]byte(badVCard4Mod), &cfg)
+	require.NotNil(t, err)
+	badBookmarksMod := `enabled: [bookmarks, pep]`
+	err = yaml.Unmarshal([]byte(badBookmarksMod), &cfg)
+	require.NotNil(t, err)
+	badServiceAdminMod := `enabled: [service_admin]`
+	err = yaml.Unmarshal([]byte(badServiceAdminMod), &cfg)
+	require.NotNil(t, err)
+	serviceAdminMod := `enabled: [service_admin, adhoc]`
+	err = yaml.Unmarshal([]byte(serviceAdminMod), &cfg)
+	require.Nil(t, err)
+
+	hostMod := `
+enabled: [roster, ping]
+hosts:
+  - name: jackal.im
+    enabled: [roster]
+`
+	cfg = &Config{}
+	err = yaml.Unmarshal([]byte(hostMod), &cfg)
+	require.Nil(t, err)
+	require.True(t, cfg.IsEnabledForHost("roster", "jackal.im"))
+	require.False(t, cfg.IsEnabledForHost("ping", "jackal.im"))
+	require.True(t, cfg.IsEnabledForHost("ping", "example.org"))
+
+	badHostMod := `
+enabled: [roster]
+hosts:
+  - name: jackal.im
+    enabled: [ping]
+`
+	err = yaml.Unmarshal([]byte(badHostMod), &cfg)
+	require.NotNil(t, err)
 }
@@ -14,16 +14,22 @@ import (
 	"github.com/ortuman/jackal/module/xep0012"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/module/xep0049"
+	"github.com/ortuman/jackal/module/xep0050"
 	"github.com/ortuman/jackal/module/xep0054"
 	"github.com/ortuman/jackal/module/xep0077"
+	"github.com/ortuman/jackal/module/xep0084"
 	"github.com/ortuman/jackal/module/xep0092"
 	"github.com/ortuman/jackal/module/xep0115"
+	"github.com/ortuman/jackal/module/xep0133"
 	"github.com/ortuman/jackal/module/xep0163"
 	"github.com/ortuman/jackal/module/xep0191"
 	"github.com/ortuman/jackal/module/xep0199"
+	"github.com/ortuman/jackal/module/xep0292"
+	"github.com/ortuman/jackal/module/xep0402"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage/repository"
 	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
 )
 
 // Module represents a generic XMPP module.
@@ -49,65 +55,92 @@ type Modules struct {
 	Offline      *offline.Offline
 	LastActivity *xep0012.LastActivity
 	Private      *xep0049.Private
+	AdHoc        *xep0050.AdHoc
 	DiscoInfo    *xep0030.DiscoInfo
 	VCard        *xep0054.VCard
 	Register     *xep0077.Register
+	Avatar       *xep0084.Avatar
 	Version      *xep0092.Version
+	ServiceAdmin *xep0133.ServiceAdmin
 	Pep          *xep0163.Pep
 	BlockingCmd  *xep0191.BlockingCommand
 	Ping         *xep0199.Ping
+	VCard4       *xep0292.VCard4
+	Bookmarks    *xep0402.Bookmarks
 
+	cfg        *Config
 	router     router.Router
-	iqHandlers []IQHandler
+	reps       repository.Container
+	iqHandlers []iqHandler
 	all        []Module
 }
 
+// iqHandler associates an IQ handler with the name of the module it belongs to.
+// Handlers with no module name (e.g. service discovery) are always enabled.
+type iqHandler struct {
+	mod string
+	IQHandler
+}
+
 // New returns a set of modules derived from a concrete configuration.
 func New(config *Config, router router.Router, reps repository.Container, allocationID string) *Modules {
 	var presenceHub = xep0115.New(router, reps.Presences(), allocationID)
 
-	m := &Modules{router: router}
+	m := &Modules{cfg: config, router: router, reps: reps}
 
 	// XEP-0030: Service Discovery (https://xmpp.org/extensions/xep-0030.html)
 	m.DiscoInfo = xep0030.New(router, reps.Roster())
-	m.iqHandlers = append(m.iqHandlers, m.DiscoInfo)
+	m.iqHandlers = append(m.iqHandlers, iqHandler{IQHandler: m.DiscoInfo})
 	m.all = append(m.all, m.DiscoInfo)
 
 	// XEP-0012: Last Activity (https://xmpp.org/extensions/xep-0012.html)
 	if _, ok := config.Enabled["last_activity"]; ok {
 		m.LastActivity = xep0012.New(m.DiscoInfo, router, reps.User(), reps.Roster())
-		m.iqHandlers = append(m.iqHandlers, m.LastActivity)
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "last_activity", IQHandler: m.LastActivity})
 		m.all = append(m.all, m.LastActivity)
 	}
 
 	// XEP-0049: Private XML Storage (https://xmpp.org/extensions/xep-0049.html)
 	if _, ok := config.Enabled["private"]; ok {
 		m.Private = xep0049.New(router, reps.Private())
-		m.iqHandlers = append(m.iqHandlers, m.Private)
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "private", IQHandler: m.Private})
 		m.all = append(m.all, m.Private)
 	}
 
+	// XEP-0050: Ad-Hoc Commands (https://xmpp.org/extensions/xep-0050.html)
+	if _, ok := config.Enabled["adhoc"]; ok {
+		m.AdHoc = xep0050.New(&config.AdHoc, m.DiscoInfo, router)
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "adhoc", IQHandler: m.AdHoc})
+		m.all = append(m.all, m.AdHoc)
+	}
+
 	// XEP-0054: vcard-temp (https://xmpp.org/extensions/xep-0054.html)
 	if _, ok := config.Enabled["vcard"]; ok {
 		m.VCard = xep0054.New(m.DiscoInfo, router, reps.VCard())
-		m.iqHandlers = append(m.iqHandlers, m.VCard)
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "vcard", IQHandler: m.VCard})
 		m.all = append(m.all, m.VCard)
 	}
 
 	// XEP-0077: In-band registration (https://xmpp.org/extensions/xep-0077.html)
 	if _, ok := config.Enabled["registration"]; ok {
-		m.Register = xep0077.New(&config.Registration, m.DiscoInfo, router, reps.User())
-		m.iqHandlers = append(m.iqHandlers, m.Register)
+		m.Register = xep0077.New(&config.Registration, m.DiscoInfo, router, reps.User(), reps.Invitations(), m)
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "registration", IQHandler: m.Register})
 		m.all = append(m.all, m.Register)
 	}
 
 	// XEP-0092: Software Version (https://xmpp.org/extensions/xep-0092.html)
 	if _, ok := config.Enabled["version"]; ok {
 		m.Version = xep0092.New(&config.Version, m.DiscoInfo, router)
-		m.iqHandlers = append(m.iqHandlers, m.Version)
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "version", IQHandler: m.Version})
 		m.all = append(m.all, m.Version)
 	}
 
+	// XEP-0133: Service Administration (https://xmpp.org/extensions/xep-0133.html)
+	if _, ok := config.Enabled["service_admin"]; ok {
+		m.ServiceAdmin = xep0133.New(&config.ServiceAdmin, m.AdHoc, router, reps.User(), reps.Roster(), m)
+		m.all = append(m.all, m.ServiceAdmin)
+	}
+
 	// XEP-0160: Offline message storage (https://xmpp.org/extensions/xep-0160.html)
 	if _, ok := config.Enabled["offline"]; ok {
 		m.Offline = offline.New(&config.Offline, m.DiscoInfo, router, reps.Offline())
@@ -116,39 +149,70 @@ func New(config *Config, router router.Router, reps repository.Container, alloca
 
 	// XEP-0163: Personal Eventing Protocol (https://xmpp.org/extensions/xep-0163.html)
 	if _, ok := config.Enabled["pep"]; ok {
-		m.Pep = xep0163.New(m.DiscoInfo, presenceHub, router, reps.Roster(), reps.PubSub())
-		m.iqHandlers = append(m.iqHandlers, m.Pep)
+		m.Pep = xep0163.New(&config.Pep, m.DiscoInfo, presenceHub, router, reps.Roster(), reps.PubSub())
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "pep", IQHandler: m.Pep})
 		m.all = append(m.all, m.Pep)
 	}
 
+	// XEP-0084: User Avatar (https://xmpp.org/extensions/xep-0084.html)
+	// XEP-0153: vCard-Based Avatars (https://xmpp.org/extensions/xep-0153.html)
+	if _, ok := config.Enabled["avatar"]; ok {
+		m.Avatar = xep0084.New(m.Pep, m.VCard, reps.VCard(), reps.PubSub())
+		m.all = append(m.all, m.Avatar)
+	}
+
 	// XEP-0191: Blocking Command (https://xmpp.org/extensions/xep-0191.html)
 	if _, ok := config.Enabled["blocking_command"]; ok {
 		m.BlockingCmd = xep0191.New(m.DiscoInfo, presenceHub, router, reps.Roster(), reps.BlockList())
-		m.iqHandlers = append(m.iqHandlers, m.BlockingCmd)
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "blocking_command", IQHandler: m.BlockingCmd})
 		m.all = append(m.all, m.BlockingCmd)
 	}
 
 	// XEP-0199: XMPP Ping (https://xmpp.org/extensions/xep-0199.html)
 	if _, ok := config.Enabled["ping"]; ok {
 		m.Ping = xep0199.New(&config.Ping, m.DiscoInfo, router)
-		m.iqHandlers = append(m.iqHandlers, m.Ping)
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "ping", IQHandler: m.Ping})
 		m.all = append(m.all, m.Ping)
 	}
 
+	// XEP-0292: vCard4 Over XMPP (https://xmpp.org/extensions/xep-0292.html)
+	if _, ok := config.Enabled["vcard4"]; ok {
+		m.VCard4 = xep0292.New(m.DiscoInfo, m.Pep, m.VCard, reps.VCard(), reps.PubSub())
+		m.all = append(m.all, m.VCard4)
+	}
+
+	// XEP-0402: PEP Native Bookmarks (https://xmpp.org/extensions/xep-0402.html)
+	if _, ok := config.Enabled["bookmarks"]; ok {
+		m.Bookmarks = xep0402.New(m.DiscoInfo, m.Pep, m.Private, reps.Private(), reps.PubSub())
+		m.all = append(m.all, m.Bookmarks)
+	}
+
 	// Roster (https://xmpp.org/rfcs/rfc3921.html#roster)
 	if _, ok := config.Enabled["roster"]; ok {
-		m.iqHandlers = append(m.iqHandlers, presenceHub)
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "roster", IQHandler: presenceHub})
 
-		m.Roster = roster.New(&config.Roster, presenceHub, m.Pep, router, reps.User(), reps.Roster())
-		m.iqHandlers = append(m.iqHandlers, m.Roster)
+		m.Roster = roster.New(&config.Roster, m.DiscoInfo, presenceHub, m.Pep, router, reps.User(), reps.Roster(), reps.SharedGroups())
+		m.iqHandlers = append(m.iqHandlers, iqHandler{mod: "roster", IQHandler: m.Roster})
 		m.all = append(m.all, m.Roster)
 	}
 	return m
 }
 
+// IsEnabledForHost tells whether a module is enabled for a given host.
+func (m *Modules) IsEnabledForHost(mod, host string) bool {
+	if m.cfg == nil {
+		return true
+	}
+	return m.cfg.IsEnabledForHost(mod, host)
+}
+
 // ProcessIQ process a module IQ returning 'service unavailable' in case it couldn't be properly handled.
 func (m *Modules) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
+	host := iq.ToJID().Domain()
 	for _, handler := range m.iqHandlers {
+		if len(handler.mod) > 0 && !m.cfg.IsEnabledForHost(handler.mod, host) {
+			continue
+		}
 		if !handler.MatchesIQ(iq) {
 			continue
 		}
@@ -162,6 +226,21 @@ func (m *Modules) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
 	}
 }
 
+// DeleteAccount removes a user account unsubscribing it from all its contacts
+// and deleting every associated entity from storage.
+func (m *Modules) DeleteAccount(ctx context.Context, userJID *jid.JID) error {
+	if m.Roster != nil {
+		if err := m.Roster.RemoveAll(ctx, userJID); err != nil {
+			return err
+		}
+	}
+	if err := m.reps.DeleteAccount(ctx, userJID); err != nil {
+		return err
+	}
+	log.Infof("deleted account: %s", userJID.ToBareJID())
+	return nil
+}
+
 // Shutdown gracefully shuts down modules instance.
 func (m *Modules) Shutdown(ctx context.Context) error {
 	select {
@@ -16,6 +16,8 @@ import (
 
 	"github.com/google/uuid"
 	c2srouter "github.com/ortuman/jackal/c2s/router"
+	"github.com/ortuman/jackal/model"
+	rostermodel "github.com/ortuman/jackal/model/roster"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
@@ -40,7 +42,7 @@ func TestModules_New(t *testing.T) {
 	mods := setupModules(t)
 	defer func() { _ = mods.Shutdown(context.Background()) }()
 
-	require.Equal(t, 10, len(mods.all))
+	require.Equal(t, 12, len(mods.all))
 }
 
 func TestModules_ProcessIQ(t *testing.T) {
@@ -68,6 +70,41 @@ func TestModules_ProcessIQ(t *testing.T) {
 	require.Equal(t, xmpp.ErrorType, elem.Type())
 }
 
+func TestModules_ProcessIQHostOverride(t *testing.T) {
+	mods := setupModules(t)
+	defer func() { _ = mods.Shutdown(context.Background()) }()
+
+	j0, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	srvJID, _ := jid.NewWithString("jackal.im", true)
+
+	stm := stream.NewMockC2S(uuid.New().String(), j0)
+	stm.SetPresence(xmpp.NewPresence(j0.ToBareJID(), j0, xmpp.AvailableType))
+
+	mods.router.Bind(context.Background(), stm)
+
+	pingIQ := func() *xmpp.IQ {
+		iq := xmpp.NewIQType(uuid.New().String(), xmpp.GetType)
+		iq.SetFromJID(j0)
+		iq.SetToJID(srvJID)
+		iq.AppendElement(xmpp.NewElementNamespace("ping", "urn:xmpp:ping"))
+		return iq
+	}
+	mods.ProcessIQ(context.Background(), pingIQ())
+
+	elem := stm.ReceiveElement()
+	require.NotNil(t, elem)
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// disable ping for jackal.im
+	mods.cfg.HostEnabled = map[string]map[string]struct{}{"jackal.im": {"version": {}}}
+	mods.ProcessIQ(context.Background(), pingIQ())
+
+	elem = stm.ReceiveElement()
+	require.NotNil(t, elem)
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Elements().Child("error"))
+}
+
 func TestModules_Shutdown(t *testing.T) {
 	mods := setupModules(t)
 
@@ -85,6 +122,29 @@ func TestModules_Shutdown(t *testing.T) {
 	}
 }
 
+func TestModules_DeleteAccount(t *testing.T) {
+	mods := setupModules(t)
+	defer func() { _ = mods.Shutdown(context.Background()) }()
+
+	ctx := context.Background()
+	_ = mods.reps.User().UpsertUser(ctx, &model.User{Username: "ortuman", Domain: "jackal.im", Password: "1234"})
+	_, _ = mods.reps.Roster().UpsertRosterItem(ctx, &rostermodel.Item{Username: "ortuman", Domain: "jackal.im", JID: "noelia@jackal.im", Subscription: rostermodel.SubscriptionBoth})
+	_, _ = mods.reps.Roster().UpsertRosterItem(ctx, &rostermodel.Item{Username: "noelia", Domain: "jackal.im", JID: "ortuman@jackal.im", Subscription: rostermodel.SubscriptionBoth})
+	_ = mods.reps.VCard().UpsertVCard(ctx, xmpp.NewElementNamespace("vCard", "vcard-temp"), "ortuman@jackal.im")
+
+	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	require.Nil(t, mods.DeleteAccount(ctx, j))
+
+	usr, _ := mods.reps.User().FetchUser(ctx, "ortuman@jackal.im")
+	require.Nil(t, usr)
+	ris, _, _ := mods.reps.Roster().FetchRosterItems(ctx, "ortuman@jackal.im")
+	require.Len(t, ris, 0)
+	ris, _, _ = mods.reps.Roster().FetchRosterItems(ctx, "noelia@jackal.im")
+	require.Len(t, ris, 0)
+	vCard, _ := mods.reps.VCard().FetchVCard(ctx, "ortuman@jackal.im")
+	require.Nil(t, vCard)
+}
+
 func setupModules(t *testing.T) *Modules {
 	var config Config
 	b, err := ioutil.ReadFile("../testdata/config_modules.yml")
@@ -97,7 +157,7 @@ func setupModules(t *testing.T) *Modules {
 	rep, _ := storage.New(&storage.Config{Type: storage.Memory})
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(rep.User(), rep.BlockList()),
+		c2srouter.New(rep.User(), rep.BlockList(), nil),
 		nil,
 	)
 	return New(&config, r, rep, "alloc-1234")
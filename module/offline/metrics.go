@@ -0,0 +1,21 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package offline
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var queueInserts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "jackal",
+	Subsystem: "offline",
+	Name:      "queue_inserts_total",
+	Help:      "Number of offline queue insertion attempts by result.",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(queueInserts)
+}
@@ -26,7 +26,7 @@ const offlineDeliveredCtxKey = "offline:delivered"
 // Offline represents an offline server stream module.
 type Offline struct {
 	cfg        *Config
-	runQueue   *runqueue.RunQueue
+	runQueue   *runqueue.ShardedRunQueue
 	router     router.Router
 	offlineRep repository.Offline
 }
@@ -35,7 +35,7 @@ type Offline struct {
 func New(config *Config, disco *xep0030.DiscoInfo, router router.Router, offlineRep repository.Offline) *Offline {
 	r := &Offline{
 		cfg:        config,
-		runQueue:   runqueue.New("xep0030"),
+		runQueue:   runqueue.NewSharded("offline", 0),
 		router:     router,
 		offlineRep: offlineRep,
 	}
@@ -47,13 +47,25 @@ func New(config *Config, disco *xep0030.DiscoInfo, router router.Router, offline
 
 // ArchiveMessage archives a new offline messages into the storage.
 func (x *Offline) ArchiveMessage(ctx context.Context, message *xmpp.Message) {
-	x.runQueue.Run(func() { x.archiveMessage(ctx, message) })
+	x.runQueue.Run(message.ToJID().ToBareJID().String(), func() { x.archiveMessage(ctx, message) })
 }
 
 // DeliverOfflineMessages delivers every archived offline messages to the peer
 // deleting them from storage.
 func (x *Offline) DeliverOfflineMessages(ctx context.Context, stm stream.C2S) {
-	x.runQueue.Run(func() { x.deliverOfflineMessages(ctx, stm) })
+	x.runQueue.Run(stm.JID().ToBareJID().String(), func() { x.deliverOfflineMessages(ctx, stm) })
+}
+
+// Flush waits until every enqueued offline operation has been processed.
+func (x *Offline) Flush(ctx context.Context) error {
+	c := make(chan struct{})
+	x.runQueue.Barrier(func() { close(c) })
+	select {
+	case <-c:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Shutdown shuts down offline module.
@@ -69,22 +81,25 @@ func (x *Offline) archiveMessage(ctx context.Context, message *xmpp.Message) {
 		return
 	}
 	toJID := message.ToJID()
-	queueSize, err := x.offlineRep.CountOfflineMessages(ctx, toJID.Node())
+	queueSize, err := x.offlineRep.CountOfflineMessages(ctx, toJID.ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		return
 	}
 	if queueSize >= x.cfg.QueueSize {
+		queueInserts.WithLabelValues("queue_full").Inc()
 		_ = x.router.Route(ctx, message.ServiceUnavailableError())
 		return
 	}
 	delayed, _ := xmpp.NewMessageFromElement(message, message.FromJID(), message.ToJID())
 	delayed.Delay(message.FromJID().Domain(), "Offline Storage")
-	if err := x.offlineRep.InsertOfflineMessage(ctx, delayed, toJID.Node()); err != nil {
+	if err := x.offlineRep.InsertOfflineMessage(ctx, delayed, toJID.ToBareJID().String()); err != nil {
 		log.Error(err)
+		queueInserts.WithLabelValues("error").Inc()
 		_ = x.router.Route(ctx, message.InternalServerError())
 		return
 	}
+	queueInserts.WithLabelValues("stored").Inc()
 	log.Infof("archived offline message... id: %s", message.ID())
 
 	if x.cfg.Gateway != nil {
@@ -101,7 +116,7 @@ func (x *Offline) deliverOfflineMessages(ctx context.Context, stm stream.C2S) {
 	}
 	// deliver offline messages
 	userJID := stm.JID()
-	messages, err := x.offlineRep.FetchOfflineMessages(ctx, userJID.Node())
+	messages, err := x.offlineRep.FetchOfflineMessages(ctx, userJID.ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		return
@@ -114,7 +129,7 @@ func (x *Offline) deliverOfflineMessages(ctx context.Context, stm stream.C2S) {
 	for i := 0; i < len(messages); i++ {
 		_ = x.router.Route(ctx, &messages[i])
 	}
-	if err := x.offlineRep.DeleteOfflineMessages(ctx, userJID.Node()); err != nil {
+	if err := x.offlineRep.DeleteOfflineMessages(ctx, userJID.ToBareJID().String()); err != nil {
 		log.Error(err)
 	}
 	stm.SetValue(offlineDeliveredCtxKey, true)
@@ -46,7 +46,7 @@ func TestOffline_ArchiveMessage(t *testing.T) {
 	// wait for insertion...
 	time.Sleep(time.Millisecond * 250)
 
-	msgs, err := s.FetchOfflineMessages(context.Background(), "juliet")
+	msgs, err := s.FetchOfflineMessages(context.Background(), "juliet@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, 1, len(msgs))
 
@@ -76,13 +76,35 @@ func TestOffline_ArchiveMessage(t *testing.T) {
 	require.Equal(t, msgID, elem.ID())
 }
 
+func TestOffline_Flush(t *testing.T) {
+	r, s := setupTest("jackal.im")
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+
+	x := New(&Config{QueueSize: 10}, nil, r, s)
+	defer func() { _ = x.Shutdown() }()
+
+	for i := 0; i < 5; i++ {
+		msg := xmpp.NewMessageType(uuid.New(), "normal")
+		msg.SetFromJID(j1)
+		msg.SetToJID(j2)
+		x.ArchiveMessage(context.Background(), msg)
+	}
+	require.Nil(t, x.Flush(context.Background()))
+
+	msgs, err := s.FetchOfflineMessages(context.Background(), "juliet@jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 5, len(msgs))
+}
+
 func setupTest(domain string) (router.Router, *memorystorage.Offline) {
 	hosts, _ := host.New([]host.Config{{Name: domain, Certificate: tls.Certificate{}}})
 
 	s := memorystorage.NewOffline()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList()),
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
 		nil,
 	)
 	return r, s
@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package roster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ortuman/jackal/log"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const rosterExchangeNamespace = "http://jabber.org/protocol/rosterx"
+
+const (
+	exchangeActionAdd    = "add"
+	exchangeActionDelete = "delete"
+	exchangeActionModify = "modify"
+)
+
+// exchangeItem represents a XEP-0144 roster item exchange suggestion.
+type exchangeItem struct {
+	action string
+	jid    *jid.JID
+	name   string
+	groups []string
+	elem   xmpp.XElement
+}
+
+// processRosterExchange processes a set of roster item suggestions sent by an entity to a user.
+// Suggestions coming from an entity the user trusts (XEP-0321) and targeting the entity domain get automatically applied,
+// whereas the rest of them get forwarded to the user for approval.
+func (x *Roster) processRosterExchange(ctx context.Context, iq *xmpp.IQ, rx xmpp.XElement, userJID, entityJID *jid.JID) error {
+	if !iq.IsSet() {
+		_ = x.router.Route(ctx, iq.BadRequestError())
+		return nil
+	}
+	items, err := parseExchangeItems(rx)
+	if err != nil || len(items) == 0 {
+		_ = x.router.Route(ctx, iq.BadRequestError())
+		return nil
+	}
+	trusted, err := x.isTrustedEntity(ctx, userJID, entityJID)
+	if err != nil {
+		_ = x.router.Route(ctx, iq.InternalServerError())
+		return err
+	}
+	var pending []exchangeItem
+	for _, itm := range items {
+		if !trusted || itm.jid.Domain() != entityJID.Domain() {
+			pending = append(pending, itm)
+			continue
+		}
+		if err := x.applyExchangeItem(ctx, itm, userJID); err != nil {
+			_ = x.router.Route(ctx, iq.InternalServerError())
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		log.Infof("forwarding roster item exchange suggestions - entity: %s (%s)", entityJID, userJID)
+
+		msg := xmpp.NewMessageType(uuid.New(), xmpp.NormalType)
+		msg.SetFromJID(entityJID)
+		msg.SetToJID(userJID)
+		fwd := xmpp.NewElementNamespace("x", rosterExchangeNamespace)
+		for _, itm := range pending {
+			fwd.AppendElement(itm.elem)
+		}
+		msg.AppendElement(fwd)
+		if err := x.router.Route(ctx, msg); err != nil {
+			_ = x.router.Route(ctx, iq.RecipientUnavailableError())
+			return nil
+		}
+	}
+	_ = x.router.Route(ctx, iq.ResultIQ())
+	return nil
+}
+
+func (x *Roster) applyExchangeItem(ctx context.Context, itm exchangeItem, userJID *jid.JID) error {
+	contactJID := itm.jid.ToBareJID()
+
+	log.Infof("applying roster item exchange suggestion - action: %s, contact: %s (%s)", itm.action, contactJID, userJID)
+
+	usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.String(), contactJID.String())
+	if err != nil {
+		return err
+	}
+	switch itm.action {
+	case exchangeActionAdd:
+		if usrRi != nil {
+			// item already present: just add it to the suggested groups
+			groups := mergeGroups(usrRi.Groups, itm.groups)
+			if len(groups) == len(usrRi.Groups) {
+				return nil
+			}
+			usrRi.Groups = groups
+			return x.upsertItem(ctx, usrRi, userJID)
+		}
+		usrRi = &rostermodel.Item{
+			Username:     userJID.Node(),
+			Domain:       userJID.Domain(),
+			JID:          contactJID.String(),
+			Name:         itm.name,
+			Subscription: rostermodel.SubscriptionNone,
+			Groups:       itm.groups,
+		}
+		if err := x.upsertItem(ctx, usrRi, userJID); err != nil {
+			return err
+		}
+		return x.processSubscribe(ctx, xmpp.NewPresence(userJID, contactJID, xmpp.SubscribeType))
+
+	case exchangeActionModify:
+		if usrRi == nil {
+			return nil
+		}
+		if len(itm.name) > 0 {
+			usrRi.Name = itm.name
+		}
+		usrRi.Groups = itm.groups
+		return x.upsertItem(ctx, usrRi, userJID)
+
+	case exchangeActionDelete:
+		if usrRi == nil {
+			return nil
+		}
+		if len(itm.groups) > 0 {
+			// remove item from the specified groups only
+			var groups []string
+			for _, g := range usrRi.Groups {
+				if !containsGroup(itm.groups, g) {
+					groups = append(groups, g)
+				}
+			}
+			if len(groups) > 0 {
+				usrRi.Groups = groups
+				return x.upsertItem(ctx, usrRi, userJID)
+			}
+		}
+		return x.removeItem(ctx, usrRi, userJID)
+	}
+	return nil
+}
+
+func parseExchangeItems(rx xmpp.XElement) ([]exchangeItem, error) {
+	var items []exchangeItem
+	for _, elem := range rx.Elements().Children("item") {
+		j, err := jid.NewWithString(elem.Attributes().Get("jid"), false)
+		if err != nil {
+			return nil, err
+		}
+		action := elem.Attributes().Get("action")
+		switch action {
+		case "":
+			action = exchangeActionAdd
+		case exchangeActionAdd, exchangeActionDelete, exchangeActionModify:
+			break
+		default:
+			return nil, fmt.Errorf("roster: unrecognized exchange action: %s", action)
+		}
+		var groups []string
+		for _, g := range elem.Elements().Children("group") {
+			groups = append(groups, g.Text())
+		}
+		items = append(items, exchangeItem{
+			action: action,
+			jid:    j,
+			name:   elem.Attributes().Get("name"),
+			groups: groups,
+			elem:   elem,
+		})
+	}
+	return items, nil
+}
+
+func mergeGroups(groups, newGroups []string) []string {
+	ret := append([]string(nil), groups...)
+	for _, g := range newGroups {
+		if !containsGroup(ret, g) {
+			ret = append(ret, g)
+		}
+	}
+	return ret
+}
+
+func containsGroup(groups []string, group string) bool {
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,344 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package roster
+
+import (
+	"context"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const remoteRosterNamespace = "urn:xmpp:tmp:roster-management:0"
+
+const (
+	permissionRequest  = "request"
+	permissionAllowed  = "allowed"
+	permissionRejected = "rejected"
+	permissionRemove   = "remove"
+)
+
+const permissionRequestTimeout = time.Minute
+
+// pendingPermission represents an entity request for remote roster management (XEP-0321)
+// waiting to be answered by any of the user's resources.
+type pendingPermission struct {
+	iq        *xmpp.IQ
+	userJID   *jid.JID
+	entityJID *jid.JID
+	ids       []string
+	timer     *time.Timer
+}
+
+// isRemoteManager tells whether or not an entity is allowed to request remote roster management permission.
+func (x *Roster) isRemoteManager(entityJID *jid.JID) bool {
+	_, ok := x.remoteManagers[entityJID.ToBareJID().String()]
+	if !ok {
+		_, ok = x.remoteManagers[entityJID.Domain()]
+	}
+	return ok
+}
+
+// isTrustedEntity tells whether or not a user granted an entity permission to manage its roster.
+func (x *Roster) isTrustedEntity(ctx context.Context, userJID, entityJID *jid.JID) (bool, error) {
+	if !x.isRemoteManager(entityJID) {
+		return false, nil
+	}
+	return x.rosterRep.FetchRosterPermission(ctx, userJID.String(), entityJID.ToBareJID().String())
+}
+
+func (x *Roster) isPermissionAnswer(iq *xmpp.IQ) bool {
+	if !iq.IsResult() && iq.Type() != xmpp.ErrorType {
+		return false
+	}
+	x.permMu.RLock()
+	_, ok := x.pendingPerms[iq.ID()]
+	x.permMu.RUnlock()
+	return ok
+}
+
+func (x *Roster) processEntityIQ(ctx context.Context, iq *xmpp.IQ) error {
+	userJID := iq.ToJID().ToBareJID()
+	entityJID := iq.FromJID()
+
+	if q := iq.Elements().ChildNamespace("query", remoteRosterNamespace); q != nil {
+		return x.processPermissionIQ(ctx, iq, q, userJID, entityJID)
+	}
+	if rx := iq.Elements().ChildNamespace("x", rosterExchangeNamespace); rx != nil {
+		return x.processRosterExchange(ctx, iq, rx, userJID, entityJID)
+	}
+	trusted, err := x.isTrustedEntity(ctx, userJID, entityJID)
+	if err != nil {
+		_ = x.router.Route(ctx, iq.InternalServerError())
+		return err
+	}
+	if !trusted {
+		_ = x.router.Route(ctx, iq.ForbiddenError())
+		return nil
+	}
+	q := iq.Elements().ChildNamespace("query", rosterNamespace)
+	switch {
+	case iq.IsGet():
+		return x.sendRemoteRoster(ctx, iq, userJID, entityJID)
+	case iq.IsSet():
+		return x.updateRemoteRoster(ctx, iq, q, userJID, entityJID)
+	default:
+		_ = x.router.Route(ctx, iq.BadRequestError())
+		return nil
+	}
+}
+
+func (x *Roster) processPermissionIQ(ctx context.Context, iq *xmpp.IQ, query xmpp.XElement, userJID, entityJID *jid.JID) error {
+	if !iq.IsSet() {
+		_ = x.router.Route(ctx, iq.BadRequestError())
+		return nil
+	}
+	switch query.Attributes().Get("type") {
+	case permissionRequest:
+		return x.requestPermission(ctx, iq, query, userJID, entityJID)
+
+	case permissionRemove:
+		log.Infof("remote roster management permission revoked by entity: %s (%s)", entityJID.ToBareJID(), userJID)
+
+		if err := x.rosterRep.DeleteRosterPermission(ctx, userJID.String(), entityJID.ToBareJID().String()); err != nil {
+			_ = x.router.Route(ctx, iq.InternalServerError())
+			return err
+		}
+		_ = x.router.Route(ctx, iq.ResultIQ())
+		return nil
+
+	default:
+		_ = x.router.Route(ctx, iq.BadRequestError())
+		return nil
+	}
+}
+
+func (x *Roster) requestPermission(ctx context.Context, iq *xmpp.IQ, query xmpp.XElement, userJID, entityJID *jid.JID) error {
+	if !x.isRemoteManager(entityJID) {
+		_ = x.router.Route(ctx, iq.ForbiddenError())
+		return nil
+	}
+	granted, err := x.rosterRep.FetchRosterPermission(ctx, userJID.String(), entityJID.ToBareJID().String())
+	if err != nil {
+		_ = x.router.Route(ctx, iq.InternalServerError())
+		return err
+	}
+	if granted {
+		_ = x.router.Route(ctx, permissionResultIQ(iq, permissionAllowed))
+		return nil
+	}
+	// ask every interactive user resource
+	var ids []string
+	srvJID, _ := jid.New("", userJID.Domain(), "", true)
+	for _, stm := range x.router.LocalStreams(userJID) {
+		if requested, _ := stm.Value(rosterRequestedCtxKey).(bool); !requested {
+			continue
+		}
+		fwd := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+		fwd.SetFromJID(srvJID)
+		fwd.SetToJID(stm.JID())
+		q := xmpp.NewElementNamespace("query", remoteRosterNamespace)
+		q.SetAttribute("type", permissionRequest)
+		q.SetAttribute("jid", entityJID.ToBareJID().String())
+		if reason := query.Attributes().Get("reason"); len(reason) > 0 {
+			q.SetAttribute("reason", reason)
+		}
+		fwd.AppendElement(q)
+		stm.SendElement(ctx, fwd)
+
+		ids = append(ids, fwd.ID())
+	}
+	if len(ids) == 0 {
+		_ = x.router.Route(ctx, iq.RecipientUnavailableError())
+		return nil
+	}
+	log.Infof("requesting remote roster management permission - entity: %s (%s)", entityJID.ToBareJID(), userJID)
+
+	p := &pendingPermission{iq: iq, userJID: userJID, entityJID: entityJID, ids: ids}
+	x.permMu.Lock()
+	for _, id := range ids {
+		x.pendingPerms[id] = p
+	}
+	x.permMu.Unlock()
+
+	p.timer = time.AfterFunc(permissionRequestTimeout, func() {
+		x.runQueue.Run(userJID.String(), func() {
+			if x.removePendingPermission(ids[0]) != nil {
+				_ = x.router.Route(context.Background(), iq.RemoteServerTimeoutError())
+			}
+		})
+	})
+	return nil
+}
+
+func (x *Roster) processPermissionAnswer(ctx context.Context, iq *xmpp.IQ) error {
+	x.permMu.RLock()
+	p := x.pendingPerms[iq.ID()]
+	x.permMu.RUnlock()
+	if p == nil {
+		return nil // already answered from another resource...
+	}
+	// only the requested user is allowed to answer
+	if !iq.FromJID().MatchesWithOptions(p.userJID, jid.MatchesNode|jid.MatchesDomain) {
+		log.Warnf("ignoring remote roster management permission answer from unexpected sender: %s (%s)", iq.FromJID(), p.userJID)
+		return nil
+	}
+	if x.removePendingPermission(iq.ID()) == nil {
+		return nil
+	}
+	p.timer.Stop()
+
+	answer := permissionRejected
+	if q := iq.Elements().ChildNamespace("query", remoteRosterNamespace); iq.IsResult() && q != nil {
+		if q.Attributes().Get("type") == permissionAllowed {
+			answer = permissionAllowed
+		}
+	}
+	log.Infof("remote roster management permission %s - entity: %s (%s)", answer, p.entityJID.ToBareJID(), p.userJID)
+
+	if answer == permissionAllowed {
+		if err := x.rosterRep.UpsertRosterPermission(ctx, p.userJID.String(), p.entityJID.ToBareJID().String()); err != nil {
+			_ = x.router.Route(ctx, p.iq.InternalServerError())
+			return err
+		}
+	}
+	_ = x.router.Route(ctx, permissionResultIQ(p.iq, answer))
+	return nil
+}
+
+func (x *Roster) removePendingPermission(id string) *pendingPermission {
+	x.permMu.Lock()
+	defer x.permMu.Unlock()
+	p := x.pendingPerms[id]
+	if p == nil {
+		return nil
+	}
+	for _, id := range p.ids {
+		delete(x.pendingPerms, id)
+	}
+	return p
+}
+
+// revokePermission processes a user initiated remote roster management revocation.
+func (x *Roster) revokePermission(ctx context.Context, iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S) error {
+	userJID := stm.JID().ToBareJID()
+
+	entityJID, err := jid.NewWithString(query.Attributes().Get("jid"), false)
+	if !iq.IsSet() || query.Attributes().Get("type") != permissionRemove || err != nil {
+		stm.SendElement(ctx, iq.BadRequestError())
+		return nil
+	}
+	log.Infof("remote roster management permission revoked by user: %s (%s)", entityJID.ToBareJID(), userJID)
+
+	if err := x.rosterRep.DeleteRosterPermission(ctx, userJID.String(), entityJID.ToBareJID().String()); err != nil {
+		stm.SendElement(ctx, iq.InternalServerError())
+		return err
+	}
+	stm.SendElement(ctx, iq.ResultIQ())
+
+	// let the entity know
+	notifyIQ := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	notifyIQ.SetFromJID(userJID)
+	notifyIQ.SetToJID(entityJID.ToBareJID())
+	q := xmpp.NewElementNamespace("query", remoteRosterNamespace)
+	q.SetAttribute("type", permissionRemove)
+	notifyIQ.AppendElement(q)
+	_ = x.router.Route(ctx, notifyIQ)
+	return nil
+}
+
+func (x *Roster) sendRemoteRoster(ctx context.Context, iq *xmpp.IQ, userJID, entityJID *jid.JID) error {
+	items, _, err := x.rosterRep.FetchRosterItems(ctx, userJID.String())
+	if err != nil {
+		_ = x.router.Route(ctx, iq.InternalServerError())
+		return err
+	}
+	// entities can only access those items belonging to their own domain
+	q := xmpp.NewElementNamespace("query", rosterNamespace)
+	for _, itm := range items {
+		if itm.ContactJID().Domain() == entityJID.Domain() {
+			q.AppendElement(itm.Element())
+		}
+	}
+	res := iq.ResultIQ()
+	res.AppendElement(q)
+	_ = x.router.Route(ctx, res)
+	return nil
+}
+
+func (x *Roster) updateRemoteRoster(ctx context.Context, iq *xmpp.IQ, query xmpp.XElement, userJID, entityJID *jid.JID) error {
+	var ris []*rostermodel.Item
+	for _, elem := range query.Elements().Children("item") {
+		ri, err := rostermodel.NewItem(elem)
+		if err != nil {
+			_ = x.router.Route(ctx, iq.BadRequestError())
+			return nil
+		}
+		if ri.ContactJID().Domain() != entityJID.Domain() {
+			_ = x.router.Route(ctx, iq.ForbiddenError())
+			return nil
+		}
+		ris = append(ris, ri)
+	}
+	if len(ris) == 0 {
+		_ = x.router.Route(ctx, iq.BadRequestError())
+		return nil
+	}
+	for _, ri := range ris {
+		if err := x.updateRemoteItem(ctx, ri, userJID); err != nil {
+			_ = x.router.Route(ctx, iq.InternalServerError())
+			return err
+		}
+	}
+	_ = x.router.Route(ctx, iq.ResultIQ())
+	return nil
+}
+
+func (x *Roster) updateRemoteItem(ctx context.Context, ri *rostermodel.Item, userJID *jid.JID) error {
+	log.Infof("updating remote roster item - contact: %s (%s)", ri.JID, userJID)
+
+	usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.String(), ri.JID)
+	if err != nil {
+		return err
+	}
+	if ri.Subscription == rostermodel.SubscriptionRemove {
+		if usrRi == nil {
+			return nil
+		}
+		usrRi.Subscription = rostermodel.SubscriptionRemove
+		usrRi.Ask = false
+		return x.deleteItem(ctx, usrRi, userJID)
+	}
+	if usrRi == nil {
+		usrRi = &rostermodel.Item{
+			Username:     userJID.Node(),
+			Domain:       userJID.Domain(),
+			JID:          ri.JID,
+			Subscription: rostermodel.SubscriptionNone,
+		}
+	}
+	if len(ri.Name) > 0 {
+		usrRi.Name = ri.Name
+	}
+	if len(ri.Subscription) > 0 {
+		usrRi.Subscription = ri.Subscription
+	}
+	usrRi.Groups = ri.Groups
+	return x.upsertItem(ctx, usrRi, userJID)
+}
+
+func permissionResultIQ(iq *xmpp.IQ, answer string) *xmpp.IQ {
+	res := iq.ResultIQ()
+	q := xmpp.NewElementNamespace("query", remoteRosterNamespace)
+	q.SetAttribute("type", answer)
+	res.AppendElement(q)
+	return res
+}
@@ -7,12 +7,15 @@ package roster
 
 import (
 	"context"
-	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/model"
 	rostermodel "github.com/ortuman/jackal/model/roster"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
+	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/module/xep0115"
 	"github.com/ortuman/jackal/module/xep0163"
 	"github.com/ortuman/jackal/router"
@@ -31,42 +34,89 @@ const rosterRequestedCtxKey = "roster:requested"
 // Config represents a roster configuration.
 type Config struct {
 	Versioning bool `yaml:"versioning"`
+
+	// RemoteManagers lists those entities (JIDs or domains) allowed to request
+	// remote roster management permission (XEP-0321).
+	RemoteManagers []string `yaml:"remote_managers"`
 }
 
 // Roster represents a roster server stream module.
 type Roster struct {
 	cfg        *Config
-	runQueue   *runqueue.RunQueue
+	runQueue   *runqueue.ShardedRunQueue
 	router     router.Router
 	userRep    repository.User
 	rosterRep  repository.Roster
+	shGroupRep repository.SharedGroups
+	shGroups   sharedGroupsCache
 	pep        *xep0163.Pep
 	entityCaps *xep0115.EntityCaps
+
+	remoteManagers map[string]struct{}
+	permMu         sync.RWMutex
+	pendingPerms   map[string]*pendingPermission
 }
 
 // New returns a roster server stream module.
-func New(cfg *Config, entityCaps *xep0115.EntityCaps, pep *xep0163.Pep, router router.Router, userRep repository.User, rosterRep repository.Roster) *Roster {
+func New(cfg *Config, disco *xep0030.DiscoInfo, entityCaps *xep0115.EntityCaps, pep *xep0163.Pep, router router.Router, userRep repository.User, rosterRep repository.Roster, shGroupRep repository.SharedGroups) *Roster {
 	r := &Roster{
 		cfg:        cfg,
-		runQueue:   runqueue.New("roster"),
+		runQueue:   runqueue.NewSharded("roster", 0),
 		router:     router,
 		userRep:    userRep,
 		rosterRep:  rosterRep,
+		shGroupRep: shGroupRep,
 		entityCaps: entityCaps,
 		pep:        pep,
+
+		remoteManagers: make(map[string]struct{}, len(cfg.RemoteManagers)),
+		pendingPerms:   make(map[string]*pendingPermission),
+	}
+	for _, rm := range cfg.RemoteManagers {
+		r.remoteManagers[rm] = struct{}{}
+	}
+	if disco != nil && len(r.remoteManagers) > 0 {
+		disco.RegisterServerFeature(remoteRosterNamespace)
 	}
 	return r
 }
 
 // MatchesIQ returns whether or not an IQ should be processed by the roster module.
 func (x *Roster) MatchesIQ(iq *xmpp.IQ) bool {
-	return iq.Elements().ChildNamespace("query", rosterNamespace) != nil
+	if x.isPermissionAnswer(iq) {
+		return true
+	}
+	elems := iq.Elements()
+	if elems.ChildNamespace("query", rosterNamespace) != nil {
+		return true
+	}
+	if !iq.IsGet() && !iq.IsSet() {
+		return false
+	}
+	return elems.ChildNamespace("query", remoteRosterNamespace) != nil || elems.ChildNamespace("x", rosterExchangeNamespace) != nil
 }
 
 // ProcessIQ processes a roster IQ taking according actions over the associated stream.
+// IQs addressed to another user's bare JID are processed on behalf of that user (XEP-0144, XEP-0321).
 func (x *Roster) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
-	x.runQueue.Run(func() {
-		stm := x.router.LocalStream(iq.FromJID().Node(), iq.FromJID().Resource())
+	fromJID := iq.FromJID()
+	toJID := iq.ToJID()
+	if len(toJID.Node()) > 0 && !toJID.MatchesWithOptions(fromJID, jid.MatchesBare) {
+		x.runQueue.Run(toJID.ToBareJID().String(), func() {
+			if err := x.processEntityIQ(ctx, iq); err != nil {
+				log.Error(err)
+			}
+		})
+		return
+	}
+	x.runQueue.Run(fromJID.ToBareJID().String(), func() {
+		if x.isPermissionAnswer(iq) {
+			if err := x.processPermissionAnswer(ctx, iq); err != nil {
+				log.Error(err)
+			}
+			return
+		}
+		stm := x.router.LocalStream(fromJID)
 		if stm == nil {
 			return
 		}
@@ -77,14 +127,31 @@ func (x *Roster) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
 }
 
 // ProcessPresence process an incoming roster presence.
+// Presences are sequenced by sender bare JID, while subscription changes affecting the recipient's roster
+// are further sequenced by the recipient bare JID.
 func (x *Roster) ProcessPresence(ctx context.Context, presence *xmpp.Presence) {
-	x.runQueue.Run(func() {
+	x.runQueue.Run(presence.FromJID().ToBareJID().String(), func() {
 		if err := x.processPresence(ctx, presence); err != nil {
 			log.Error(err)
 		}
 	})
 }
 
+// RemoveAll unsubscribes a user from all of its contacts prior to account deletion.
+// Local contacts get their roster items referencing the user removed.
+func (x *Roster) RemoveAll(ctx context.Context, userJID *jid.JID) error {
+	errCh := make(chan error, 1)
+	x.runQueue.Run(userJID.ToBareJID().String(), func() {
+		errCh <- x.removeAll(ctx, userJID.ToBareJID())
+	})
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Shutdown shuts down roster module.
 func (x *Roster) Shutdown() error {
 	c := make(chan struct{})
@@ -94,8 +161,15 @@ func (x *Roster) Shutdown() error {
 }
 
 func (x *Roster) processRosterIQ(ctx context.Context, iq *xmpp.IQ, stm stream.C2S) error {
-	var err error
+	if q := iq.Elements().ChildNamespace("query", remoteRosterNamespace); q != nil {
+		return x.revokePermission(ctx, iq, q, stm)
+	}
 	q := iq.Elements().ChildNamespace("query", rosterNamespace)
+	if q == nil {
+		stm.SendElement(ctx, iq.BadRequestError())
+		return nil
+	}
+	var err error
 	if iq.IsGet() {
 		err = x.sendRoster(ctx, iq, q, stm)
 	} else if iq.IsSet() {
@@ -107,7 +181,15 @@ func (x *Roster) processRosterIQ(ctx context.Context, iq *xmpp.IQ, stm stream.C2
 }
 
 func (x *Roster) sendRoster(ctx context.Context, iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S) error {
-	if query.Elements().Count() > 0 {
+	var rsmReq *rsmmodel.Request
+	if setEl := query.Elements().ChildNamespace("set", rsmmodel.Namespace); setEl != nil && query.Elements().Count() == 1 {
+		req, err := rsmmodel.NewRequestFromElement(setEl)
+		if err != nil {
+			stm.SendElement(ctx, iq.BadRequestError())
+			return nil
+		}
+		rsmReq = req
+	} else if query.Elements().Count() > 0 {
 		stm.SendElement(ctx, iq.BadRequestError())
 		return nil
 	}
@@ -115,19 +197,29 @@ func (x *Roster) sendRoster(ctx context.Context, iq *xmpp.IQ, query xmpp.XElemen
 
 	log.Infof("retrieving user roster... (%s)", userJID)
 
-	items, ver, err := x.rosterRep.FetchRosterItems(ctx, userJID.Node())
+	items, ver, err := x.rosterRep.FetchRosterItems(ctx, userJID.ToBareJID().String())
+	if err != nil {
+		stm.SendElement(ctx, iq.InternalServerError())
+		return err
+	}
+	shared, err := x.sharedContacts(ctx, userJID.ToBareJID())
 	if err != nil {
 		stm.SendElement(ctx, iq.InternalServerError())
 		return err
 	}
-	v := parseVer(query.Attributes().Get("ver"))
+	items = mergeSharedItems(items, shared, userJID.ToBareJID())
+
+	if rsmReq != nil {
+		return x.sendRosterPage(ctx, iq, items, rsmReq, stm)
+	}
+	v, digest := parseVer(query.Attributes().Get("ver"))
 
 	res := iq.ResultIQ()
-	if v == 0 || v < ver.DeletionVer {
+	if !x.cfg.Versioning || v == 0 || v < ver.DeletionVer || v > ver.Ver || digest != sharedDigest(shared) {
 		// push all roster items
 		q := xmpp.NewElementNamespace("query", rosterNamespace)
 		if x.cfg.Versioning {
-			q.SetAttribute("ver", fmt.Sprintf("v%d", ver.Ver))
+			q.SetAttribute("ver", rosterVersion(ver.Ver, shared))
 		}
 		for _, itm := range items {
 			q.AppendElement(itm.Element())
@@ -135,23 +227,54 @@ func (x *Roster) sendRoster(ctx context.Context, iq *xmpp.IQ, query xmpp.XElemen
 		res.AppendElement(q)
 		stm.SendElement(ctx, res)
 	} else {
-		// push roster changes
+		// push roster changes since requested version
+		changes, err := x.rosterRep.FetchRosterChanges(ctx, userJID.ToBareJID().String(), v)
+		if err != nil {
+			stm.SendElement(ctx, iq.InternalServerError())
+			return err
+		}
 		stm.SendElement(ctx, res)
-		for _, itm := range items {
-			if itm.Ver > v {
-				iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
-				q := xmpp.NewElementNamespace("query", rosterNamespace)
-				q.SetAttribute("ver", fmt.Sprintf("v%d", itm.Ver))
-				q.AppendElement(itm.Element())
-				iq.AppendElement(q)
-				stm.SendElement(ctx, iq)
-			}
+		for _, itm := range changes {
+			mergeSharedItem(&itm, shared[itm.JID])
+
+			iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+			iq.SetTo(userJID.String())
+			q := xmpp.NewElementNamespace("query", rosterNamespace)
+			q.SetAttribute("ver", rosterVersion(itm.Ver, shared))
+			q.AppendElement(itm.Element())
+			iq.AppendElement(q)
+			stm.SendElement(ctx, iq)
 		}
 	}
 	stm.SetValue(rosterRequestedCtxKey, true)
 	return nil
 }
 
+// sendRosterPage sends a result set page of the user roster.
+// Paged retrievals are not versioned, so no 'ver' attribute is included.
+func (x *Roster) sendRosterPage(ctx context.Context, iq *xmpp.IQ, items []rostermodel.Item, rsmReq *rsmmodel.Request, stm stream.C2S) error {
+	identifiers := make([]string, len(items))
+	for i, itm := range items {
+		identifiers[i] = itm.JID
+	}
+	from, to, rsmRes, err := rsmmodel.Paginate(identifiers, rsmReq)
+	if err != nil {
+		stm.SendElement(ctx, iq.ItemNotFoundError())
+		return nil
+	}
+	q := xmpp.NewElementNamespace("query", rosterNamespace)
+	for _, itm := range items[from:to] {
+		q.AppendElement(itm.Element())
+	}
+	q.AppendElement(rsmRes.Element())
+
+	res := iq.ResultIQ()
+	res.AppendElement(q)
+	stm.SendElement(ctx, res)
+	stm.SetValue(rosterRequestedCtxKey, true)
+	return nil
+}
+
 func (x *Roster) updateRoster(ctx context.Context, iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S) error {
 	items := query.Elements().Children("item")
 	if len(items) != 1 {
@@ -165,7 +288,7 @@ func (x *Roster) updateRoster(ctx context.Context, iq *xmpp.IQ, query xmpp.XElem
 	}
 	switch ri.Subscription {
 	case rostermodel.SubscriptionRemove:
-		if err := x.removeItem(ctx, ri, stm); err != nil {
+		if err := x.removeItem(ctx, ri, stm.JID().ToBareJID()); err != nil {
 			stm.SendElement(ctx, iq.InternalServerError())
 			return err
 		}
@@ -185,7 +308,7 @@ func (x *Roster) updateItem(ctx context.Context, ri *rostermodel.Item, stm strea
 
 	log.Infof("updating roster item - contact: %s (%s)", contactJID, userJID)
 
-	usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
+	usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contactJID.String())
 	if err != nil {
 		return err
 	}
@@ -199,6 +322,7 @@ func (x *Roster) updateItem(ctx context.Context, ri *rostermodel.Item, stm strea
 	} else {
 		usrRi = &rostermodel.Item{
 			Username:     userJID.Node(),
+			Domain:       userJID.Domain(),
 			JID:          ri.JID,
 			Name:         ri.Name,
 			Subscription: rostermodel.SubscriptionNone,
@@ -209,15 +333,14 @@ func (x *Roster) updateItem(ctx context.Context, ri *rostermodel.Item, stm strea
 	return x.upsertItem(ctx, usrRi, userJID)
 }
 
-func (x *Roster) removeItem(ctx context.Context, ri *rostermodel.Item, stm stream.C2S) error {
+func (x *Roster) removeItem(ctx context.Context, ri *rostermodel.Item, userJID *jid.JID) error {
 	var unsubscribe, unsubscribed *xmpp.Presence
 
-	userJID := stm.JID().ToBareJID()
 	contactJID := ri.ContactJID()
 
 	log.Infof("removing roster item: %v (%s)", contactJID, userJID)
 
-	usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
+	usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contactJID.String())
 	if err != nil {
 		return err
 	}
@@ -236,7 +359,7 @@ func (x *Roster) removeItem(ctx context.Context, ri *rostermodel.Item, stm strea
 		usrRi.Subscription = rostermodel.SubscriptionRemove
 		usrRi.Ask = false
 
-		_, err := x.deleteNotification(ctx, contactJID.Node(), userJID)
+		_, err := x.deleteNotification(ctx, contactJID, userJID)
 		if err != nil {
 			return err
 		}
@@ -248,7 +371,7 @@ func (x *Roster) removeItem(ctx context.Context, ri *rostermodel.Item, stm strea
 	}
 
 	if x.router.Hosts().IsLocalHost(contactJID.Domain()) {
-		cntRi, err := x.rosterRep.FetchRosterItem(ctx, contactJID.Node(), userJID.String())
+		cntRi, err := x.rosterRep.FetchRosterItem(ctx, contactJID.ToBareJID().String(), userJID.String())
 		if err != nil {
 			return err
 		}
@@ -287,6 +410,56 @@ func (x *Roster) removeItem(ctx context.Context, ri *rostermodel.Item, stm strea
 	return nil
 }
 
+func (x *Roster) removeAll(ctx context.Context, userJID *jid.JID) error {
+	log.Infof("removing all roster items: %s", userJID)
+
+	items, _, err := x.rosterRep.FetchRosterItems(ctx, userJID.ToBareJID().String())
+	if err != nil {
+		return err
+	}
+	for _, ri := range items {
+		contactJID := ri.ContactJID()
+
+		switch ri.Subscription {
+		case rostermodel.SubscriptionFrom, rostermodel.SubscriptionBoth:
+			_ = x.router.Route(ctx, xmpp.NewPresence(userJID, contactJID, xmpp.UnavailableType))
+			_ = x.router.Route(ctx, xmpp.NewPresence(userJID, contactJID, xmpp.UnsubscribedType))
+		}
+		if ri.Subscription == rostermodel.SubscriptionTo || ri.Subscription == rostermodel.SubscriptionBoth || ri.Ask {
+			_ = x.router.Route(ctx, xmpp.NewPresence(userJID, contactJID, xmpp.UnsubscribeType))
+		}
+		if !x.router.Hosts().IsLocalHost(contactJID.Domain()) {
+			continue
+		}
+		if _, err := x.deleteNotification(ctx, contactJID, userJID); err != nil {
+			return err
+		}
+		cntRi, err := x.rosterRep.FetchRosterItem(ctx, contactJID.ToBareJID().String(), userJID.String())
+		if err != nil {
+			return err
+		}
+		if cntRi != nil {
+			cntRi.Subscription = rostermodel.SubscriptionRemove
+			cntRi.Ask = false
+			if err := x.deleteItem(ctx, cntRi, contactJID); err != nil {
+				return err
+			}
+		}
+		x.unsubscribeFromVirtualNodes(ctx, contactJID.String(), userJID)
+	}
+	// decline pending subscription requests
+	rns, err := x.rosterRep.FetchRosterNotifications(ctx, userJID.ToBareJID().String())
+	if err != nil {
+		return err
+	}
+	for _, rn := range rns {
+		if contactJID, err := jid.NewWithString(rn.JID, true); err == nil {
+			_ = x.router.Route(ctx, xmpp.NewPresence(userJID, contactJID, xmpp.UnsubscribedType))
+		}
+	}
+	return nil
+}
+
 func (x *Roster) processPresence(ctx context.Context, presence *xmpp.Presence) error {
 	switch presence.Type() {
 	case xmpp.SubscribeType:
@@ -312,7 +485,7 @@ func (x *Roster) processSubscribe(ctx context.Context, presence *xmpp.Presence)
 	log.Infof("processing 'subscribe' - contact: %s (%s)", contactJID, userJID)
 
 	if x.router.Hosts().IsLocalHost(userJID.Domain()) {
-		usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
+		usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contactJID.String())
 		if err != nil {
 			return err
 		}
@@ -331,6 +504,7 @@ func (x *Roster) processSubscribe(ctx context.Context, presence *xmpp.Presence)
 			// create roster item if not previously created
 			usrRi = &rostermodel.Item{
 				Username:     userJID.Node(),
+				Domain:       userJID.Domain(),
 				JID:          contactJID.String(),
 				Subscription: rostermodel.SubscriptionNone,
 				Ask:          true,
@@ -344,13 +518,24 @@ func (x *Roster) processSubscribe(ctx context.Context, presence *xmpp.Presence)
 	p := xmpp.NewPresence(userJID, contactJID, xmpp.SubscribeType)
 	p.AppendElements(presence.Elements().All())
 
-	if x.router.Hosts().IsLocalHost(contactJID.Domain()) {
-		// archive roster approval notification
-		if err := x.upsertNotification(ctx, contactJID.Node(), userJID, p); err != nil {
-			return err
+	x.runOnRecipient(contactJID, func() error {
+		if x.router.Hosts().IsLocalHost(contactJID.Domain()) {
+			// archive roster approval notification
+			if err := x.upsertNotification(ctx, contactJID, userJID, p); err != nil {
+				return err
+			}
+			cntRi, err := x.rosterRep.FetchRosterItem(ctx, contactJID.String(), userJID.String())
+			if err != nil {
+				return err
+			}
+			if cntRi != nil && cntRi.Approved {
+				// subscription pre-approved by contact: auto-reply on its behalf
+				return x.processSubscribed(ctx, xmpp.NewPresence(contactJID, userJID, xmpp.SubscribedType))
+			}
 		}
-	}
-	_ = x.router.Route(ctx, p)
+		_ = x.router.Route(ctx, p)
+		return nil
+	})
 	return nil
 }
 
@@ -361,15 +546,20 @@ func (x *Roster) processSubscribed(ctx context.Context, presence *xmpp.Presence)
 	log.Infof("processing 'subscribed' - user: %s (%s)", userJID, contactJID)
 
 	if x.router.Hosts().IsLocalHost(contactJID.Domain()) {
-		_, err := x.deleteNotification(ctx, contactJID.Node(), userJID)
+		deleted, err := x.deleteNotification(ctx, contactJID, userJID)
 		if err != nil {
 			return err
 		}
-		cntRi, err := x.rosterRep.FetchRosterItem(ctx, contactJID.Node(), userJID.String())
+		cntRi, err := x.rosterRep.FetchRosterItem(ctx, contactJID.ToBareJID().String(), userJID.String())
 		if err != nil {
 			return err
 		}
+		if !deleted && (cntRi == nil || cntRi.Subscription == rostermodel.SubscriptionNone || cntRi.Subscription == rostermodel.SubscriptionTo) {
+			// no pending subscription request: pre-approve it (https://xmpp.org/rfcs/rfc6121.html#sub-preapproval)
+			return x.preApproveSubscription(ctx, cntRi, contactJID, userJID)
+		}
 		if cntRi != nil {
+			cntRi.Approved = false
 			switch cntRi.Subscription {
 			case rostermodel.SubscriptionTo:
 				cntRi.Subscription = rostermodel.SubscriptionBoth
@@ -380,6 +570,7 @@ func (x *Roster) processSubscribed(ctx context.Context, presence *xmpp.Presence)
 			// create roster item if not previously created
 			cntRi = &rostermodel.Item{
 				Username:     contactJID.Node(),
+				Domain:       contactJID.Domain(),
 				JID:          userJID.String(),
 				Subscription: rostermodel.SubscriptionFrom,
 				Ask:          false,
@@ -395,30 +586,49 @@ func (x *Roster) processSubscribed(ctx context.Context, presence *xmpp.Presence)
 	p := xmpp.NewPresence(contactJID, userJID, xmpp.SubscribedType)
 	p.AppendElements(presence.Elements().All())
 
-	if x.router.Hosts().IsLocalHost(userJID.Domain()) {
-		usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
-		if err != nil {
-			return err
-		}
-		if usrRi != nil {
-			switch usrRi.Subscription {
-			case rostermodel.SubscriptionFrom:
-				usrRi.Subscription = rostermodel.SubscriptionBoth
-			case rostermodel.SubscriptionNone:
-				usrRi.Subscription = rostermodel.SubscriptionTo
-			default:
-				return nil
-			}
-			usrRi.Ask = false
-			if err := x.upsertItem(ctx, usrRi, userJID); err != nil {
+	x.runOnRecipient(userJID, func() error {
+		if x.router.Hosts().IsLocalHost(userJID.Domain()) {
+			usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contactJID.String())
+			if err != nil {
 				return err
 			}
+			if usrRi != nil {
+				switch usrRi.Subscription {
+				case rostermodel.SubscriptionFrom:
+					usrRi.Subscription = rostermodel.SubscriptionBoth
+				case rostermodel.SubscriptionNone:
+					usrRi.Subscription = rostermodel.SubscriptionTo
+				default:
+					return nil
+				}
+				usrRi.Ask = false
+				if err := x.upsertItem(ctx, usrRi, userJID); err != nil {
+					return err
+				}
+			}
+		}
+		_ = x.router.Route(ctx, p)
+		x.routePresencesFrom(ctx, contactJID, userJID, xmpp.AvailableType)
+		return nil
+	})
+	return nil
+}
+
+func (x *Roster) preApproveSubscription(ctx context.Context, cntRi *rostermodel.Item, contactJID, userJID *jid.JID) error {
+	if cntRi == nil {
+		cntRi = &rostermodel.Item{
+			Username:     contactJID.Node(),
+			Domain:       contactJID.Domain(),
+			JID:          userJID.String(),
+			Subscription: rostermodel.SubscriptionNone,
 		}
+	} else if cntRi.Approved {
+		return nil // already pre-approved...
 	}
-	_ = x.router.Route(ctx, p)
-	x.routePresencesFrom(ctx, contactJID, userJID, xmpp.AvailableType)
+	log.Infof("pre-approving subscription - user: %s (%s)", userJID, contactJID)
 
-	return nil
+	cntRi.Approved = true
+	return x.upsertItem(ctx, cntRi, contactJID)
 }
 
 func (x *Roster) processUnsubscribe(ctx context.Context, presence *xmpp.Presence) error {
@@ -429,7 +639,7 @@ func (x *Roster) processUnsubscribe(ctx context.Context, presence *xmpp.Presence
 
 	var usrSub string
 	if x.router.Hosts().IsLocalHost(userJID.Domain()) {
-		usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
+		usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contactJID.String())
 		if err != nil {
 			return err
 		}
@@ -451,30 +661,33 @@ func (x *Roster) processUnsubscribe(ctx context.Context, presence *xmpp.Presence
 	p := xmpp.NewPresence(userJID, contactJID, xmpp.UnsubscribeType)
 	p.AppendElements(presence.Elements().All())
 
-	if x.router.Hosts().IsLocalHost(contactJID.Domain()) {
-		cntRi, err := x.rosterRep.FetchRosterItem(ctx, contactJID.Node(), userJID.String())
-		if err != nil {
-			return err
-		}
-		if cntRi != nil {
-			switch cntRi.Subscription {
-			case rostermodel.SubscriptionBoth:
-				cntRi.Subscription = rostermodel.SubscriptionTo
-			default:
-				cntRi.Subscription = rostermodel.SubscriptionNone
-			}
-			if err := x.upsertItem(ctx, cntRi, contactJID); err != nil {
+	x.runOnRecipient(contactJID, func() error {
+		if x.router.Hosts().IsLocalHost(contactJID.Domain()) {
+			cntRi, err := x.rosterRep.FetchRosterItem(ctx, contactJID.ToBareJID().String(), userJID.String())
+			if err != nil {
 				return err
 			}
+			if cntRi != nil {
+				switch cntRi.Subscription {
+				case rostermodel.SubscriptionBoth:
+					cntRi.Subscription = rostermodel.SubscriptionTo
+				default:
+					cntRi.Subscription = rostermodel.SubscriptionNone
+				}
+				if err := x.upsertItem(ctx, cntRi, contactJID); err != nil {
+					return err
+				}
+			}
+			// auto-unsubscribe from all contact virtual nodes
+			x.unsubscribeFromVirtualNodes(ctx, contactJID.String(), userJID)
 		}
-		// auto-unsubscribe from all contact virtual nodes
-		x.unsubscribeFromVirtualNodes(ctx, contactJID.String(), userJID)
-	}
-	_ = x.router.Route(ctx, p)
+		_ = x.router.Route(ctx, p)
 
-	if usrSub == rostermodel.SubscriptionTo || usrSub == rostermodel.SubscriptionBoth {
-		x.routePresencesFrom(ctx, contactJID, userJID, xmpp.UnavailableType)
-	}
+		if usrSub == rostermodel.SubscriptionTo || usrSub == rostermodel.SubscriptionBoth {
+			x.routePresencesFrom(ctx, contactJID, userJID, xmpp.UnavailableType)
+		}
+		return nil
+	})
 	return nil
 }
 
@@ -486,7 +699,7 @@ func (x *Roster) processUnsubscribed(ctx context.Context, presence *xmpp.Presenc
 
 	var cntSub string
 	if x.router.Hosts().IsLocalHost(contactJID.Domain()) {
-		deleted, err := x.deleteNotification(ctx, contactJID.Node(), userJID)
+		deleted, err := x.deleteNotification(ctx, contactJID, userJID)
 		if err != nil {
 			return err
 		}
@@ -494,7 +707,7 @@ func (x *Roster) processUnsubscribed(ctx context.Context, presence *xmpp.Presenc
 		if deleted {
 			goto routePresence
 		}
-		cntRi, err := x.rosterRep.FetchRosterItem(ctx, contactJID.Node(), userJID.String())
+		cntRi, err := x.rosterRep.FetchRosterItem(ctx, contactJID.ToBareJID().String(), userJID.String())
 		if err != nil {
 			return err
 		}
@@ -507,6 +720,7 @@ func (x *Roster) processUnsubscribed(ctx context.Context, presence *xmpp.Presenc
 			default:
 				cntRi.Subscription = rostermodel.SubscriptionNone
 			}
+			cntRi.Approved = false // cancel any pre-approval
 			if err := x.upsertItem(ctx, cntRi, contactJID); err != nil {
 				return err
 			}
@@ -519,31 +733,34 @@ routePresence:
 	p := xmpp.NewPresence(contactJID, userJID, xmpp.UnsubscribedType)
 	p.AppendElements(presence.Elements().All())
 
-	if x.router.Hosts().IsLocalHost(userJID.Domain()) {
-		usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
-		if err != nil {
-			return err
-		}
-		if usrRi != nil {
-			if !usrRi.Ask { // pending out...
-				switch usrRi.Subscription {
-				case rostermodel.SubscriptionBoth:
-					usrRi.Subscription = rostermodel.SubscriptionFrom
-				default:
-					usrRi.Subscription = rostermodel.SubscriptionNone
-				}
-			}
-			usrRi.Ask = false
-			if err := x.upsertItem(ctx, usrRi, userJID); err != nil {
+	x.runOnRecipient(userJID, func() error {
+		if x.router.Hosts().IsLocalHost(userJID.Domain()) {
+			usrRi, err := x.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contactJID.String())
+			if err != nil {
 				return err
 			}
+			if usrRi != nil {
+				if !usrRi.Ask { // pending out...
+					switch usrRi.Subscription {
+					case rostermodel.SubscriptionBoth:
+						usrRi.Subscription = rostermodel.SubscriptionFrom
+					default:
+						usrRi.Subscription = rostermodel.SubscriptionNone
+					}
+				}
+				usrRi.Ask = false
+				if err := x.upsertItem(ctx, usrRi, userJID); err != nil {
+					return err
+				}
+			}
 		}
-	}
-	_ = x.router.Route(ctx, p)
+		_ = x.router.Route(ctx, p)
 
-	if cntSub == rostermodel.SubscriptionFrom || cntSub == rostermodel.SubscriptionBoth {
-		x.routePresencesFrom(ctx, contactJID, userJID, xmpp.UnavailableType)
-	}
+		if cntSub == rostermodel.SubscriptionFrom || cntSub == rostermodel.SubscriptionBoth {
+			x.routePresencesFrom(ctx, contactJID, userJID, xmpp.UnavailableType)
+		}
+		return nil
+	})
 	return nil
 }
 
@@ -557,19 +774,25 @@ func (x *Roster) processProbePresence(ctx context.Context, presence *xmpp.Presen
 		_ = x.router.Route(ctx, presence)
 		return nil
 	}
-	ri, err := x.rosterRep.FetchRosterItem(ctx, contactJID.Node(), userJID.String())
+	ri, err := x.rosterRep.FetchRosterItem(ctx, contactJID.ToBareJID().String(), userJID.String())
 	if err != nil {
 		return err
 	}
 	if ri == nil || (ri.Subscription != rostermodel.SubscriptionBoth && ri.Subscription != rostermodel.SubscriptionFrom) {
-		return nil // silently ignore
+		isShared, err := x.isSharedContact(ctx, contactJID, userJID)
+		if err != nil {
+			return err
+		}
+		if !isShared {
+			return nil // silently ignore
+		}
 	}
 	availPresences, err := x.entityCaps.PresencesMatchingJID(ctx, contactJID)
 	if err != nil {
 		return err
 	}
 	if len(availPresences) == 0 { // send last known presence
-		usr, err := x.userRep.FetchUser(ctx, contactJID.Node())
+		usr, err := x.userRep.FetchUser(ctx, contactJID.ToBareJID().String())
 		if err != nil {
 			return err
 		}
@@ -629,7 +852,7 @@ func (x *Roster) processAvailablePresence(ctx context.Context, presence *xmpp.Pr
 
 func (x *Roster) deliverRosterPresences(ctx context.Context, userJID *jid.JID) error {
 	// first, deliver pending approval notifications...
-	rns, err := x.rosterRep.FetchRosterNotifications(ctx, userJID.Node())
+	rns, err := x.rosterRep.FetchRosterNotifications(ctx, userJID.ToBareJID().String())
 	if err != nil {
 		return err
 	}
@@ -641,7 +864,7 @@ func (x *Roster) deliverRosterPresences(ctx context.Context, userJID *jid.JID) e
 	}
 
 	// deliver roster online presences
-	items, _, err := x.rosterRep.FetchRosterItems(ctx, userJID.Node())
+	items, err := x.fetchRosterItems(ctx, userJID.ToBareJID())
 	if err != nil {
 		return err
 	}
@@ -661,7 +884,7 @@ func (x *Roster) deliverRosterPresences(ctx context.Context, userJID *jid.JID) e
 
 func (x *Roster) broadcastPresence(ctx context.Context, presence *xmpp.Presence) error {
 	fromJID := presence.FromJID()
-	items, _, err := x.rosterRep.FetchRosterItems(ctx, fromJID.Node())
+	items, err := x.fetchRosterItems(ctx, fromJID.ToBareJID())
 	if err != nil {
 		return err
 	}
@@ -675,11 +898,12 @@ func (x *Roster) broadcastPresence(ctx context.Context, presence *xmpp.Presence)
 	}
 
 	// update last received presence
-	if usr, err := x.userRep.FetchUser(ctx, fromJID.Node()); err != nil {
+	if usr, err := x.userRep.FetchUser(ctx, fromJID.ToBareJID().String()); err != nil {
 		return err
 	} else if usr != nil {
 		return x.userRep.UpsertUser(ctx, &model.User{
 			Username:     usr.Username,
+			Domain:       usr.Domain,
 			Password:     usr.Password,
 			LastPresence: presence,
 		})
@@ -697,7 +921,7 @@ func (x *Roster) upsertItem(ctx context.Context, ri *rostermodel.Item, pushTo *j
 }
 
 func (x *Roster) deleteItem(ctx context.Context, ri *rostermodel.Item, pushTo *jid.JID) error {
-	v, err := x.rosterRep.DeleteRosterItem(ctx, ri.Username, ri.JID)
+	v, err := x.rosterRep.DeleteRosterItem(ctx, ri.UserJID(), ri.JID)
 	if err != nil {
 		return err
 	}
@@ -706,13 +930,28 @@ func (x *Roster) deleteItem(ctx context.Context, ri *rostermodel.Item, pushTo *j
 }
 
 func (x *Roster) pushItem(ctx context.Context, ri *rostermodel.Item, to *jid.JID) error {
+	shared, err := x.sharedContacts(ctx, to.ToBareJID())
+	if err != nil {
+		return err
+	}
+	if groups := shared[ri.JID]; len(groups) > 0 {
+		merged := *ri
+		merged.Groups = append([]string(nil), ri.Groups...)
+		mergeSharedItem(&merged, groups)
+		ri = &merged
+	}
+	x.sendRosterPush(ctx, ri, to, rosterVersion(ri.Ver, shared))
+	return nil
+}
+
+func (x *Roster) sendRosterPush(ctx context.Context, ri *rostermodel.Item, to *jid.JID, ver string) {
 	query := xmpp.NewElementNamespace("query", rosterNamespace)
 	if x.cfg.Versioning {
-		query.SetAttribute("ver", fmt.Sprintf("v%d", ri.Ver))
+		query.SetAttribute("ver", ver)
 	}
 	query.AppendElement(ri.Element())
 
-	streams := x.router.LocalStreams(to.Node())
+	streams := x.router.LocalStreams(to)
 	for _, stm := range streams {
 		requested, _ := stm.Value(rosterRequestedCtxKey).(bool)
 		if !requested {
@@ -723,26 +962,26 @@ func (x *Roster) pushItem(ctx context.Context, ri *rostermodel.Item, to *jid.JID
 		pushEl.AppendElement(query)
 		stm.SendElement(ctx, pushEl)
 	}
-	return nil
 }
 
-func (x *Roster) deleteNotification(ctx context.Context, contact string, userJID *jid.JID) (deleted bool, err error) {
-	rn, err := x.rosterRep.FetchRosterNotification(ctx, contact, userJID.String())
+func (x *Roster) deleteNotification(ctx context.Context, contactJID *jid.JID, userJID *jid.JID) (deleted bool, err error) {
+	rn, err := x.rosterRep.FetchRosterNotification(ctx, contactJID.ToBareJID().String(), userJID.String())
 	if err != nil {
 		return false, err
 	}
 	if rn == nil {
 		return false, nil
 	}
-	if err := x.rosterRep.DeleteRosterNotification(ctx, contact, userJID.String()); err != nil {
+	if err := x.rosterRep.DeleteRosterNotification(ctx, contactJID.ToBareJID().String(), userJID.String()); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-func (x *Roster) upsertNotification(ctx context.Context, contact string, userJID *jid.JID, presence *xmpp.Presence) error {
+func (x *Roster) upsertNotification(ctx context.Context, contactJID *jid.JID, userJID *jid.JID, presence *xmpp.Presence) error {
 	rn := &rostermodel.Notification{
-		Contact:  contact,
+		Contact:  contactJID.Node(),
+		Domain:   contactJID.Domain(),
 		JID:      userJID.String(),
 		Presence: presence,
 	}
@@ -750,7 +989,7 @@ func (x *Roster) upsertNotification(ctx context.Context, contact string, userJID
 }
 
 func (x *Roster) routePresencesFrom(ctx context.Context, from *jid.JID, to *jid.JID, presenceType string) {
-	streams := x.router.LocalStreams(from.Node())
+	streams := x.router.LocalStreams(from)
 	for _, stm := range streams {
 		p := xmpp.NewPresence(stm.JID(), to.ToBareJID(), presenceType)
 		if presence := stm.Presence(); presence != nil && presence.IsAvailable() {
@@ -781,10 +1020,26 @@ func (x *Roster) sendVirtualNodesLastItems(ctx context.Context, jid *jid.JID) {
 	x.pep.DeliverLastItems(ctx, jid)
 }
 
-func parseVer(ver string) int {
-	if len(ver) > 0 && ver[0] == 'v' {
-		v, _ := strconv.Atoi(ver[1:])
-		return v
+// runOnRecipient processes the part of a subscription change that affects the roster of the stanza recipient,
+// sequencing it along with any other operation over the recipient's bare JID.
+func (x *Roster) runOnRecipient(recipientJID *jid.JID, fn func() error) {
+	x.runQueue.Run(recipientJID.ToBareJID().String(), func() {
+		if err := fn(); err != nil {
+			log.Error(err)
+		}
+	})
+}
+
+// parseVer parses a roster version string, returning its numeric version along with its shared contacts digest.
+func parseVer(ver string) (int, string) {
+	if len(ver) == 0 || ver[0] != 'v' {
+		return 0, ""
+	}
+	ver = ver[1:]
+	var digest string
+	if i := strings.IndexByte(ver, '-'); i != -1 {
+		ver, digest = ver[:i], ver[i+1:]
 	}
-	return 0
+	v, _ := strconv.Atoi(ver)
+	return v, digest
 }
@@ -8,12 +8,14 @@ package roster
 import (
 	"context"
 	"crypto/tls"
+	"strings"
 	"testing"
 	"time"
 
 	c2srouter "github.com/ortuman/jackal/c2s/router"
 	"github.com/ortuman/jackal/model"
 	rostermodel "github.com/ortuman/jackal/model/roster"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
 	"github.com/ortuman/jackal/module/xep0115"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/router/host"
@@ -29,7 +31,7 @@ import (
 func TestRoster_MatchesIQ(t *testing.T) {
 	rtr, userRep, presencesRep, rosterRep := setupTest("jackal.im")
 
-	r := New(&Config{}, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep)
+	r := New(&Config{}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
 	defer func() { _ = r.Shutdown() }()
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
@@ -46,7 +48,7 @@ func TestRoster_FetchRoster(t *testing.T) {
 	stm := stream.NewMockC2S(uuid.New(), j1)
 	rtr.Bind(context.Background(), stm)
 
-	r := New(&Config{}, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep)
+	r := New(&Config{}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
 	defer func() { _ = r.Shutdown() }()
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.ResultType)
@@ -76,6 +78,7 @@ func TestRoster_FetchRoster(t *testing.T) {
 
 	ri1 := &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Name:         "My Juliet",
 		Subscription: rostermodel.SubscriptionNone,
@@ -86,6 +89,7 @@ func TestRoster_FetchRoster(t *testing.T) {
 
 	ri2 := &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "romeo@jackal.im",
 		Name:         "Rome",
 		Subscription: rostermodel.SubscriptionNone,
@@ -94,7 +98,7 @@ func TestRoster_FetchRoster(t *testing.T) {
 	}
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), ri2)
 
-	r = New(&Config{Versioning: true}, xep0115.New(rtr, nil, "alloc-1234"), nil, rtr, userRep, rosterRep)
+	r = New(&Config{Versioning: true}, nil, xep0115.New(rtr, nil, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
 	defer func() { _ = r.Shutdown() }()
 
 	r.ProcessIQ(context.Background(), iq)
@@ -130,8 +134,25 @@ func TestRoster_FetchRoster(t *testing.T) {
 	item := query2.Elements().Child("item")
 	require.Equal(t, "romeo@jackal.im", item.Attributes().Get("jid"))
 
+	// removed items are pushed as well
+	_, _ = rosterRep.DeleteRosterItem(context.Background(), "ortuman@jackal.im", "noelia@jackal.im")
+
+	q.SetAttribute("ver", "v2")
+	r.ProcessIQ(context.Background(), iq)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Nil(t, elem.Elements().ChildNamespace("query", rosterNamespace))
+
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.SetType, elem.Type())
+	query2 = elem.Elements().ChildNamespace("query", rosterNamespace)
+	require.Equal(t, "v3", query2.Attributes().Get("ver"))
+	item = query2.Elements().Child("item")
+	require.Equal(t, "noelia@jackal.im", item.Attributes().Get("jid"))
+	require.Equal(t, rostermodel.SubscriptionRemove, item.Attributes().Get("subscription"))
+
 	memorystorage.EnableMockedError()
-	r = New(&Config{}, xep0115.New(rtr, nil, "alloc-1234"), nil, rtr, userRep, rosterRep)
+	r = New(&Config{}, nil, xep0115.New(rtr, nil, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
 	defer func() { _ = r.Shutdown() }()
 
 	r.ProcessIQ(context.Background(), iq)
@@ -140,6 +161,77 @@ func TestRoster_FetchRoster(t *testing.T) {
 	memorystorage.DisableMockedError()
 }
 
+func TestRoster_FetchRosterPage(t *testing.T) {
+	rtr, userRep, presencesRep, rosterRep := setupTest("jackal.im")
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j1)
+	rtr.Bind(context.Background(), stm)
+
+	for _, contact := range []string{"noelia@jackal.im", "romeo@jackal.im", "juliet@jackal.im"} {
+		_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
+			Username:     "ortuman",
+			Domain:       "jackal.im",
+			JID:          contact,
+			Subscription: rostermodel.SubscriptionNone,
+		})
+	}
+	r := New(&Config{Versioning: true}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
+	defer func() { _ = r.Shutdown() }()
+
+	fetchPage := func(setEl xmpp.XElement) xmpp.XElement {
+		iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+		iq.SetFromJID(j1)
+		iq.SetToJID(j1.ToBareJID())
+		q := xmpp.NewElementNamespace("query", rosterNamespace)
+		q.AppendElement(setEl)
+		iq.AppendElement(q)
+
+		r.ProcessIQ(context.Background(), iq)
+		return stm.ReceiveElement()
+	}
+	setEl := xmpp.NewElementNamespace("set", rsmmodel.Namespace)
+	setEl.AppendElement(xmpp.NewElementName("max").SetText("2"))
+
+	elem := fetchPage(setEl)
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	query := elem.Elements().ChildNamespace("query", rosterNamespace)
+	require.Equal(t, "", query.Attributes().Get("ver"))
+	items := query.Elements().Children("item")
+	require.Len(t, items, 2)
+	require.Equal(t, "noelia@jackal.im", items[0].Attributes().Get("jid"))
+	require.Equal(t, "romeo@jackal.im", items[1].Attributes().Get("jid"))
+
+	resSet := query.Elements().ChildNamespace("set", rsmmodel.Namespace)
+	require.NotNil(t, resSet)
+	require.Equal(t, "3", resSet.Elements().Child("count").Text())
+	require.Equal(t, "romeo@jackal.im", resSet.Elements().Child("last").Text())
+
+	requested, _ := stm.Value(rosterRequestedCtxKey).(bool)
+	require.True(t, requested)
+
+	// next page
+	setEl = xmpp.NewElementNamespace("set", rsmmodel.Namespace)
+	setEl.AppendElement(xmpp.NewElementName("max").SetText("2"))
+	setEl.AppendElement(xmpp.NewElementName("after").SetText("romeo@jackal.im"))
+
+	elem = fetchPage(setEl)
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	items = elem.Elements().ChildNamespace("query", rosterNamespace).Elements().Children("item")
+	require.Len(t, items, 1)
+	require.Equal(t, "juliet@jackal.im", items[0].Attributes().Get("jid"))
+
+	// unknown anchor
+	setEl = xmpp.NewElementNamespace("set", rsmmodel.Namespace)
+	setEl.AppendElement(xmpp.NewElementName("after").SetText("mercutio@jackal.im"))
+
+	elem = fetchPage(setEl)
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+}
+
 func TestRoster_Update(t *testing.T) {
 	rtr, userRep, presencesRep, rosterRep := setupTest("jackal.im")
 
@@ -152,7 +244,7 @@ func TestRoster_Update(t *testing.T) {
 	stm2.SetAuthenticated(true)
 	stm2.SetValue(rosterRequestedCtxKey, true)
 
-	r := New(&Config{}, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep)
+	r := New(&Config{}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
 	defer func() { _ = r.Shutdown() }()
 
 	rtr.Bind(context.Background(), stm1)
@@ -199,7 +291,7 @@ func TestRoster_Update(t *testing.T) {
 	require.Equal(t, xmpp.ResultType, elem.Type())
 	require.Equal(t, iqID, elem.ID())
 
-	ri, err := rosterRep.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
+	ri, err := rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.NotNil(t, ri)
 	require.Equal(t, "ortuman", ri.Username)
@@ -213,12 +305,14 @@ func TestRoster_RemoveItem(t *testing.T) {
 	// insert contact's roster item
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Name:         "My Juliet",
 		Subscription: rostermodel.SubscriptionBoth,
 	})
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "noelia",
+		Domain:       "jackal.im",
 		JID:          "ortuman@jackal.im",
 		Name:         "My Romeo",
 		Subscription: rostermodel.SubscriptionBoth,
@@ -230,7 +324,7 @@ func TestRoster_RemoveItem(t *testing.T) {
 
 	rtr.Bind(context.Background(), stm)
 
-	r := New(&Config{}, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep)
+	r := New(&Config{}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
 	defer func() { _ = r.Shutdown() }()
 
 	// remove item
@@ -250,7 +344,65 @@ func TestRoster_RemoveItem(t *testing.T) {
 	elem := stm.ReceiveElement()
 	require.Equal(t, iqID, elem.ID())
 
-	ri, err := rosterRep.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
+	ri, err := rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "noelia@jackal.im")
+	require.Nil(t, err)
+	require.Nil(t, ri)
+}
+
+func TestRoster_RemoveAll(t *testing.T) {
+	rtr, userRep, presencesRep, rosterRep := setupTest("jackal.im")
+
+	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
+		Username:     "ortuman",
+		Domain:       "jackal.im",
+		JID:          "noelia@jackal.im",
+		Subscription: rostermodel.SubscriptionBoth,
+	})
+	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
+		Username:     "noelia",
+		Domain:       "jackal.im",
+		JID:          "ortuman@jackal.im",
+		Subscription: rostermodel.SubscriptionBoth,
+	})
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	j3, _ := jid.New("romeo", "jackal.im", "", true)
+
+	_ = rosterRep.UpsertRosterNotification(context.Background(), &rostermodel.Notification{
+		Contact:  "ortuman",
+		Domain:   "jackal.im",
+		JID:      j3.String(),
+		Presence: xmpp.NewPresence(j3, j1.ToBareJID(), xmpp.SubscribeType),
+	})
+
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm2.SetPresence(xmpp.NewPresence(j2, j2, xmpp.AvailableType))
+	stm2.SetValue(rosterRequestedCtxKey, true)
+	rtr.Bind(context.Background(), stm2)
+
+	r := New(&Config{}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
+	defer func() { _ = r.Shutdown() }()
+
+	require.Nil(t, r.RemoveAll(context.Background(), j1))
+
+	var presenceTypes []string
+	var push xmpp.XElement
+	for i := 0; i < 4; i++ {
+		elem := stm2.ReceiveElement()
+		switch elem.Name() {
+		case "presence":
+			presenceTypes = append(presenceTypes, elem.Type())
+		case "iq":
+			push = elem
+		}
+	}
+	require.Equal(t, []string{xmpp.UnavailableType, xmpp.UnsubscribedType, xmpp.UnsubscribeType}, presenceTypes)
+	require.NotNil(t, push)
+
+	item := push.Elements().ChildNamespace("query", rosterNamespace).Elements().Child("item")
+	require.Equal(t, rostermodel.SubscriptionRemove, item.Attributes().Get("subscription"))
+
+	ri, err := rosterRep.FetchRosterItem(context.Background(), "noelia@jackal.im", "ortuman@jackal.im")
 	require.Nil(t, err)
 	require.Nil(t, ri)
 }
@@ -278,17 +430,20 @@ func TestRoster_OnlineJIDs(t *testing.T) {
 	// user entity
 	_ = userRep.UpsertUser(context.Background(), &model.User{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		LastPresence: xmpp.NewPresence(j1, j1.ToBareJID(), xmpp.UnavailableType),
 	})
 
 	// roster items
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "noelia",
+		Domain:       "jackal.im",
 		JID:          "ortuman@jackal.im",
 		Subscription: rostermodel.SubscriptionBoth,
 	})
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Subscription: rostermodel.SubscriptionBoth,
 	})
@@ -296,12 +451,13 @@ func TestRoster_OnlineJIDs(t *testing.T) {
 	// pending notification
 	_ = rosterRep.UpsertRosterNotification(context.Background(), &rostermodel.Notification{
 		Contact:  "ortuman",
+		Domain:   "jackal.im",
 		JID:      j3.ToBareJID().String(),
 		Presence: xmpp.NewPresence(j3.ToBareJID(), j1.ToBareJID(), xmpp.SubscribeType),
 	})
 
 	ph := xep0115.New(rtr, presencesRep, "alloc-1234")
-	r := New(&Config{}, ph, nil, rtr, userRep, rosterRep)
+	r := New(&Config{}, nil, ph, nil, rtr, userRep, rosterRep, nil)
 	defer func() { _ = r.Shutdown() }()
 
 	// online presence...
@@ -322,7 +478,7 @@ func TestRoster_OnlineJIDs(t *testing.T) {
 	require.Equal(t, xmpp.AvailableType, elem.Type())
 
 	// check if last presence was updated
-	usr, err := userRep.FetchUser(context.Background(), "ortuman")
+	usr, err := userRep.FetchUser(context.Background(), "ortuman@jackal.im")
 	require.Nil(t, err)
 	require.NotNil(t, usr)
 	require.NotNil(t, usr.LastPresence)
@@ -389,16 +545,18 @@ func TestRoster_Probe(t *testing.T) {
 
 	rtr.Bind(context.Background(), stm)
 
-	r := New(&Config{}, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep)
+	r := New(&Config{}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
 	defer func() { _ = r.Shutdown() }()
 
 	_ = userRep.UpsertUser(context.Background(), &model.User{
 		Username:     "noelia",
+		Domain:       "jackal.im",
 		LastPresence: xmpp.NewPresence(j2.ToBareJID(), j2.ToBareJID(), xmpp.UnavailableType),
 	})
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "noelia",
+		Domain:       "jackal.im",
 		JID:          "ortuman@jackal.im",
 		Subscription: rostermodel.SubscriptionFrom,
 	})
@@ -410,6 +568,7 @@ func TestRoster_Probe(t *testing.T) {
 	p2 := xmpp.NewPresence(j2, j2.ToBareJID(), xmpp.AvailableType)
 	_ = userRep.UpsertUser(context.Background(), &model.User{
 		Username:     "noelia",
+		Domain:       "jackal.im",
 		LastPresence: p2,
 	})
 	r.ProcessPresence(context.Background(), xmpp.NewPresence(j1, j2, xmpp.ProbeType))
@@ -424,13 +583,13 @@ func TestRoster_Subscription(t *testing.T) {
 	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
 	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
 
-	r := New(&Config{}, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep)
+	r := New(&Config{}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
 	defer func() { _ = r.Shutdown() }()
 
 	r.ProcessPresence(context.Background(), xmpp.NewPresence(j1.ToBareJID(), j2.ToBareJID(), xmpp.SubscribeType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	rns, err := rosterRep.FetchRosterNotifications(context.Background(), "noelia")
+	rns, err := rosterRep.FetchRosterNotifications(context.Background(), "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, 1, len(rns))
 
@@ -441,11 +600,11 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(context.Background(), xmpp.NewPresence(j2.ToBareJID(), j1.ToBareJID(), xmpp.UnsubscribedType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	rns, err = rosterRep.FetchRosterNotifications(context.Background(), "noelia")
+	rns, err = rosterRep.FetchRosterNotifications(context.Background(), "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, 0, len(rns))
 
-	ri, err := rosterRep.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
+	ri, err := rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionNone, ri.Subscription)
 
@@ -454,7 +613,7 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(context.Background(), xmpp.NewPresence(j2.ToBareJID(), j1.ToBareJID(), xmpp.SubscribedType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	ri, err = rosterRep.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
+	ri, err = rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionTo, ri.Subscription)
 
@@ -463,7 +622,7 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(context.Background(), xmpp.NewPresence(j1.ToBareJID(), j2.ToBareJID(), xmpp.SubscribedType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	ri, err = rosterRep.FetchRosterItem(context.Background(), "noelia", "ortuman@jackal.im")
+	ri, err = rosterRep.FetchRosterItem(context.Background(), "noelia@jackal.im", "ortuman@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionBoth, ri.Subscription)
 
@@ -471,7 +630,7 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(context.Background(), xmpp.NewPresence(j1.ToBareJID(), j2.ToBareJID(), xmpp.UnsubscribeType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	ri, err = rosterRep.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
+	ri, err = rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionFrom, ri.Subscription)
 
@@ -479,15 +638,111 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(context.Background(), xmpp.NewPresence(j1.ToBareJID(), j2.ToBareJID(), xmpp.UnsubscribedType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	ri, err = rosterRep.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
+	ri, err = rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionNone, ri.Subscription)
 
-	ri, err = rosterRep.FetchRosterItem(context.Background(), "noelia", "ortuman@jackal.im")
+	ri, err = rosterRep.FetchRosterItem(context.Background(), "noelia@jackal.im", "ortuman@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionNone, ri.Subscription)
 }
 
+func TestRoster_PreApproval(t *testing.T) {
+	rtr, userRep, presencesRep, rosterRep := setupTest("jackal.im")
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm2.SetValue(rosterRequestedCtxKey, true)
+	rtr.Bind(context.Background(), stm2)
+
+	r := New(&Config{}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
+	defer func() { _ = r.Shutdown() }()
+
+	// contact pre-approves user subscription
+	r.ProcessPresence(context.Background(), xmpp.NewPresence(j2.ToBareJID(), j1.ToBareJID(), xmpp.SubscribedType))
+
+	elem := stm2.ReceiveElement()
+	item := elem.Elements().ChildNamespace("query", rosterNamespace).Elements().Child("item")
+	require.Equal(t, "ortuman@jackal.im", item.Attributes().Get("jid"))
+	require.Equal(t, rostermodel.SubscriptionNone, item.Attributes().Get("subscription"))
+	require.Equal(t, "true", item.Attributes().Get("approved"))
+
+	ri, err := rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "noelia@jackal.im")
+	require.Nil(t, err)
+	require.Nil(t, ri) // user is not notified
+
+	// user subscription request gets automatically approved
+	r.ProcessPresence(context.Background(), xmpp.NewPresence(j1.ToBareJID(), j2.ToBareJID(), xmpp.SubscribeType))
+
+	elem = stm2.ReceiveElement()
+	item = elem.Elements().ChildNamespace("query", rosterNamespace).Elements().Child("item")
+	require.Equal(t, rostermodel.SubscriptionFrom, item.Attributes().Get("subscription"))
+	require.Equal(t, "", item.Attributes().Get("approved"))
+	time.Sleep(time.Millisecond * 150) // wait until user side has been processed...
+
+	ri, err = rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "noelia@jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, rostermodel.SubscriptionTo, ri.Subscription)
+	require.False(t, ri.Ask)
+
+	rns, _ := rosterRep.FetchRosterNotifications(context.Background(), "noelia@jackal.im")
+	require.Len(t, rns, 0)
+
+	// pre-approval cancellation
+	j3, _ := jid.New("romeo", "jackal.im", "", true)
+	r.ProcessPresence(context.Background(), xmpp.NewPresence(j2.ToBareJID(), j3, xmpp.SubscribedType))
+	_ = stm2.ReceiveElement()
+	r.ProcessPresence(context.Background(), xmpp.NewPresence(j2.ToBareJID(), j3, xmpp.UnsubscribedType))
+	_ = stm2.ReceiveElement()
+
+	ri, err = rosterRep.FetchRosterItem(context.Background(), "noelia@jackal.im", "romeo@jackal.im")
+	require.Nil(t, err)
+	require.False(t, ri.Approved)
+}
+
+func TestRoster_FetchRosterAfterAccountDeletion(t *testing.T) {
+	ctx := context.Background()
+	c, _ := memorystorage.New()
+
+	hosts, _ := host.New([]host.Config{{Name: "jackal.im", Certificate: tls.Certificate{}}})
+	rtr, _ := router.New(hosts, c2srouter.New(c.User(), c.BlockList(), nil), nil)
+
+	j1, _ := jid.New("noelia", "jackal.im", "garden", true)
+	j2, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j1)
+	rtr.Bind(ctx, stm)
+
+	_, _ = c.Roster().UpsertRosterItem(ctx, &rostermodel.Item{Username: "noelia", Domain: "jackal.im", JID: "ortuman@jackal.im", Subscription: rostermodel.SubscriptionBoth})
+	_, _ = c.Roster().UpsertRosterItem(ctx, &rostermodel.Item{Username: "noelia", Domain: "jackal.im", JID: "romeo@jackal.im", Subscription: rostermodel.SubscriptionBoth})
+
+	r := New(&Config{Versioning: true}, nil, xep0115.New(rtr, nil, "alloc-1234"), nil, rtr, c.User(), c.Roster(), nil)
+	defer func() { _ = r.Shutdown() }()
+
+	require.Nil(t, c.DeleteAccount(ctx, j2))
+
+	// requesting a delta from a version prior to the deletion must not miss the removed contact
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(j1.ToBareJID())
+	q := xmpp.NewElementNamespace("query", rosterNamespace)
+	q.SetAttribute("ver", "v2")
+	iq.AppendElement(q)
+
+	r.ProcessIQ(ctx, iq)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	query := elem.Elements().ChildNamespace("query", rosterNamespace)
+	require.NotNil(t, query)
+	require.Equal(t, "v3", query.Attributes().Get("ver"))
+	items := query.Elements().Children("item")
+	require.Len(t, items, 1)
+	require.Equal(t, "romeo@jackal.im", items[0].Attributes().Get("jid"))
+}
+
 func setupTest(domain string) (router.Router, repository.User, repository.Presences, repository.Roster) {
 	hosts, _ := host.New([]host.Config{{Name: domain, Certificate: tls.Certificate{}}})
 
@@ -496,8 +751,381 @@ func setupTest(domain string) (router.Router, repository.User, repository.Presen
 	rosterRep := memorystorage.NewRoster()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(userRep, memorystorage.NewBlockList()),
+		c2srouter.New(userRep, memorystorage.NewBlockList(), nil),
 		nil,
 	)
 	return r, userRep, presencesRep, rosterRep
 }
+
+func TestRoster_SharedGroups(t *testing.T) {
+	rtr, userRep, presencesRep, rosterRep := setupTest("jackal.im")
+	shGroupRep := memorystorage.NewSharedGroups(userRep.(*memorystorage.User))
+
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "ortuman", Domain: "jackal.im"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "noelia", Domain: "jackal.im"})
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetValue(rosterRequestedCtxKey, true)
+	rtr.Bind(context.Background(), stm1)
+
+	r := New(&Config{Versioning: true}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, shGroupRep)
+	defer func() { _ = r.Shutdown() }()
+
+	// own roster item gets merged with shared group data
+	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
+		Username:     "ortuman",
+		Domain:       "jackal.im",
+		JID:          "noelia@jackal.im",
+		Subscription: rostermodel.SubscriptionNone,
+		Groups:       []string{"friends"},
+	})
+
+	err := r.UpsertSharedGroup(context.Background(), &rostermodel.SharedGroup{Name: "staff", Hosts: []string{"jackal.im"}})
+	require.Nil(t, err)
+
+	// membership change is pushed to online members
+	elem := stm1.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xmpp.SetType, elem.Type())
+	pushItem := elem.Elements().ChildNamespace("query", rosterNamespace).Elements().Child("item")
+	require.Equal(t, "noelia@jackal.im", pushItem.Attributes().Get("jid"))
+	require.Equal(t, rostermodel.SubscriptionBoth, pushItem.Attributes().Get("subscription"))
+
+	groups, _ := r.SharedGroups(context.Background())
+	require.Len(t, groups, 1)
+
+	pushVer := elem.Elements().ChildNamespace("query", rosterNamespace).Attributes().Get("ver")
+	require.True(t, strings.HasPrefix(pushVer, "v1-"))
+
+	// full roster is sent whenever shared contacts changed since requested version
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(j1.ToBareJID())
+	q := xmpp.NewElementNamespace("query", rosterNamespace)
+	q.SetAttribute("ver", "v1")
+	iq.AppendElement(q)
+
+	r.ProcessIQ(context.Background(), iq)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	query := elem.Elements().ChildNamespace("query", rosterNamespace)
+	require.Equal(t, pushVer, query.Attributes().Get("ver"))
+	items := query.Elements().All()
+	require.Len(t, items, 1)
+	require.Equal(t, "noelia@jackal.im", items[0].Attributes().Get("jid"))
+	require.Equal(t, rostermodel.SubscriptionBoth, items[0].Attributes().Get("subscription"))
+	require.Equal(t, 2, items[0].Elements().Count()) // friends + staff
+
+	// ...otherwise only roster changes are pushed
+	q.SetAttribute("ver", pushVer)
+	r.ProcessIQ(context.Background(), iq)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Nil(t, elem.Elements().ChildNamespace("query", rosterNamespace))
+
+	// changes of shared contacts keep shared group data
+	_, _ = rosterRep.DeleteRosterItem(context.Background(), "ortuman@jackal.im", "noelia@jackal.im")
+
+	r.ProcessIQ(context.Background(), iq)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Nil(t, elem.Elements().ChildNamespace("query", rosterNamespace))
+
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.SetType, elem.Type())
+	query = elem.Elements().ChildNamespace("query", rosterNamespace)
+	require.True(t, strings.HasPrefix(query.Attributes().Get("ver"), "v2-"))
+	pushItem = query.Elements().Child("item")
+	require.Equal(t, "noelia@jackal.im", pushItem.Attributes().Get("jid"))
+	require.Equal(t, rostermodel.SubscriptionBoth, pushItem.Attributes().Get("subscription"))
+
+	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
+		Username:     "ortuman",
+		Domain:       "jackal.im",
+		JID:          "noelia@jackal.im",
+		Subscription: rostermodel.SubscriptionNone,
+		Groups:       []string{"friends"},
+	})
+
+	// shared contacts are allowed to probe each other
+	ok, err := r.isSharedContact(context.Background(), j1.ToBareJID(), j2.ToBareJID())
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	// deleting the group restores the stored item
+	require.Nil(t, r.DeleteSharedGroup(context.Background(), "staff"))
+
+	elem = stm1.ReceiveElement()
+	pushItem = elem.Elements().ChildNamespace("query", rosterNamespace).Elements().Child("item")
+	require.Equal(t, "noelia@jackal.im", pushItem.Attributes().Get("jid"))
+	require.Equal(t, rostermodel.SubscriptionNone, pushItem.Attributes().Get("subscription"))
+	require.Equal(t, "v3", elem.Elements().ChildNamespace("query", rosterNamespace).Attributes().Get("ver"))
+
+	ok, err = r.isSharedContact(context.Background(), j1.ToBareJID(), j2.ToBareJID())
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// shared groups storage not configured
+	r2 := New(&Config{}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
+	defer func() { _ = r2.Shutdown() }()
+
+	require.Equal(t, errSharedGroupsNotAvailable, r2.DeleteSharedGroup(context.Background(), "staff"))
+}
+
+func TestRoster_RemoteManagement(t *testing.T) {
+	rtr, userRep, presencesRep, rosterRep := setupTest("jackal.im")
+
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "ortuman", Domain: "jackal.im"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "gateway", Domain: "jackal.im"})
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	gwJID, _ := jid.New("gateway", "jackal.im", "bot", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetValue(rosterRequestedCtxKey, true)
+	rtr.Bind(context.Background(), stm1)
+
+	stm1.SetPresence(xmpp.NewPresence(j1, j1, xmpp.AvailableType))
+
+	gwStm := stream.NewMockC2S(uuid.New(), gwJID)
+	gwStm.SetPresence(xmpp.NewPresence(gwJID, gwJID, xmpp.AvailableType))
+	rtr.Bind(context.Background(), gwStm)
+
+	r := New(&Config{RemoteManagers: []string{"gateway@jackal.im"}}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
+	defer func() { _ = r.Shutdown() }()
+
+	// roster access requires user permission
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(gwJID)
+	iq.SetToJID(j1.ToBareJID())
+	iq.AppendElement(xmpp.NewElementNamespace("query", rosterNamespace))
+
+	r.ProcessIQ(context.Background(), iq)
+	elem := gwStm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	// request permission
+	iq = xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(gwJID)
+	iq.SetToJID(j1.ToBareJID())
+	q := xmpp.NewElementNamespace("query", remoteRosterNamespace)
+	q.SetAttribute("type", "request")
+	q.SetAttribute("reason", "ICQ transport")
+	iq.AppendElement(q)
+
+	require.True(t, r.MatchesIQ(iq))
+	r.ProcessIQ(context.Background(), iq)
+
+	req := stm1.ReceiveElement()
+	require.Equal(t, xmpp.SetType, req.Type())
+	reqQuery := req.Elements().ChildNamespace("query", remoteRosterNamespace)
+	require.NotNil(t, reqQuery)
+	require.Equal(t, "gateway@jackal.im", reqQuery.Attributes().Get("jid"))
+	require.Equal(t, "ICQ transport", reqQuery.Attributes().Get("reason"))
+
+	// answers from any other user are ignored
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	j3, _ := jid.New("noelia", "jackal.im", "yard", true)
+	forged := xmpp.NewIQType(req.ID(), xmpp.ErrorType)
+	forged.SetFromJID(j3)
+	forged.SetToJID(srvJID)
+
+	require.True(t, r.MatchesIQ(forged))
+	r.ProcessIQ(context.Background(), forged)
+	time.Sleep(time.Millisecond * 50) // wait until processed
+
+	require.True(t, r.MatchesIQ(forged))
+
+	// user grants permission
+	answer := xmpp.NewIQType(req.ID(), xmpp.ResultType)
+	answer.SetFromJID(j1)
+	answer.SetToJID(srvJID)
+	q = xmpp.NewElementNamespace("query", remoteRosterNamespace)
+	q.SetAttribute("type", "allowed")
+	answer.AppendElement(q)
+
+	require.True(t, r.MatchesIQ(answer))
+	r.ProcessIQ(context.Background(), answer)
+
+	elem = gwStm.ReceiveElement()
+	require.Equal(t, iq.ID(), elem.ID())
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, "allowed", elem.Elements().ChildNamespace("query", remoteRosterNamespace).Attributes().Get("type"))
+	require.False(t, r.MatchesIQ(answer))
+
+	granted, _ := rosterRep.FetchRosterPermission(context.Background(), "ortuman@jackal.im", "gateway@jackal.im")
+	require.True(t, granted)
+
+	// entity adds an item within its own domain
+	iq = xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(gwJID)
+	iq.SetToJID(j1.ToBareJID())
+	q = xmpp.NewElementNamespace("query", rosterNamespace)
+	item := xmpp.NewElementName("item")
+	item.SetAttribute("jid", "12345@jackal.im")
+	item.SetAttribute("name", "ICQ buddy")
+	item.SetAttribute("subscription", rostermodel.SubscriptionBoth)
+	q.AppendElement(item)
+	iq.AppendElement(q)
+
+	r.ProcessIQ(context.Background(), iq)
+	elem = gwStm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	elem = stm1.ReceiveElement() // roster push
+	pushItem := elem.Elements().ChildNamespace("query", rosterNamespace).Elements().Child("item")
+	require.Equal(t, "12345@jackal.im", pushItem.Attributes().Get("jid"))
+	require.Equal(t, rostermodel.SubscriptionBoth, pushItem.Attributes().Get("subscription"))
+
+	// ...but not any other
+	item.SetAttribute("jid", "romeo@example.org")
+	r.ProcessIQ(context.Background(), iq)
+	elem = gwStm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+
+	// entity only gets to see its own domain items
+	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
+		Username:     "ortuman",
+		Domain:       "jackal.im",
+		JID:          "romeo@example.org",
+		Subscription: rostermodel.SubscriptionBoth,
+	})
+	iq = xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(gwJID)
+	iq.SetToJID(j1.ToBareJID())
+	iq.AppendElement(xmpp.NewElementNamespace("query", rosterNamespace))
+
+	r.ProcessIQ(context.Background(), iq)
+	elem = gwStm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	items := elem.Elements().ChildNamespace("query", rosterNamespace).Elements().All()
+	require.Len(t, items, 1)
+	require.Equal(t, "12345@jackal.im", items[0].Attributes().Get("jid"))
+
+	// user revokes permission
+	iq = xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(j1.ToBareJID())
+	q = xmpp.NewElementNamespace("query", remoteRosterNamespace)
+	q.SetAttribute("type", "remove")
+	q.SetAttribute("jid", "gateway@jackal.im")
+	iq.AppendElement(q)
+
+	r.ProcessIQ(context.Background(), iq)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	elem = gwStm.ReceiveElement()
+	require.Equal(t, xmpp.SetType, elem.Type())
+	require.Equal(t, "remove", elem.Elements().ChildNamespace("query", remoteRosterNamespace).Attributes().Get("type"))
+
+	granted, _ = rosterRep.FetchRosterPermission(context.Background(), "ortuman@jackal.im", "gateway@jackal.im")
+	require.False(t, granted)
+
+	// not authorized entity
+	r2 := New(&Config{}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
+	defer func() { _ = r2.Shutdown() }()
+
+	iq = xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(gwJID)
+	iq.SetToJID(j1.ToBareJID())
+	q = xmpp.NewElementNamespace("query", remoteRosterNamespace)
+	q.SetAttribute("type", "request")
+	iq.AppendElement(q)
+
+	r2.ProcessIQ(context.Background(), iq)
+	elem = gwStm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+}
+
+func TestRoster_RosterExchange(t *testing.T) {
+	rtr, userRep, presencesRep, rosterRep := setupTest("jackal.im")
+
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "ortuman", Domain: "jackal.im"})
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "gateway", Domain: "jackal.im"})
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	gwJID, _ := jid.New("gateway", "jackal.im", "bot", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetValue(rosterRequestedCtxKey, true)
+	rtr.Bind(context.Background(), stm1)
+
+	stm1.SetPresence(xmpp.NewPresence(j1, j1, xmpp.AvailableType))
+
+	gwStm := stream.NewMockC2S(uuid.New(), gwJID)
+	gwStm.SetPresence(xmpp.NewPresence(gwJID, gwJID, xmpp.AvailableType))
+	rtr.Bind(context.Background(), gwStm)
+
+	r := New(&Config{RemoteManagers: []string{"jackal.im"}}, nil, xep0115.New(rtr, presencesRep, "alloc-1234"), nil, rtr, userRep, rosterRep, nil)
+	defer func() { _ = r.Shutdown() }()
+
+	newExchangeIQ := func(action string, groups ...string) *xmpp.IQ {
+		iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+		iq.SetFromJID(gwJID)
+		iq.SetToJID(j1.ToBareJID())
+		rx := xmpp.NewElementNamespace("x", rosterExchangeNamespace)
+		item := xmpp.NewElementName("item")
+		item.SetAttribute("action", action)
+		item.SetAttribute("jid", "12345@jackal.im")
+		item.SetAttribute("name", "ICQ buddy")
+		for _, group := range groups {
+			g := xmpp.NewElementName("group")
+			g.SetText(group)
+			item.AppendElement(g)
+		}
+		rx.AppendElement(item)
+		iq.AppendElement(rx)
+		return iq
+	}
+
+	// suggestions from a non trusted entity are forwarded for approval
+	iq := newExchangeIQ("add", "ICQ")
+	require.True(t, r.MatchesIQ(iq))
+
+	r.ProcessIQ(context.Background(), iq)
+	elem := stm1.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	require.NotNil(t, elem.Elements().ChildNamespace("x", rosterExchangeNamespace))
+
+	elem = gwStm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	ri, _ := rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "12345@jackal.im")
+	require.Nil(t, ri)
+
+	// ...whereas trusted ones get automatically applied
+	_ = rosterRep.UpsertRosterPermission(context.Background(), "ortuman@jackal.im", "gateway@jackal.im")
+
+	r.ProcessIQ(context.Background(), newExchangeIQ("add", "ICQ"))
+	elem = gwStm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	ri, _ = rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "12345@jackal.im")
+	require.NotNil(t, ri)
+	require.Equal(t, "ICQ buddy", ri.Name)
+	require.Equal(t, []string{"ICQ"}, ri.Groups)
+	require.True(t, ri.Ask)
+
+	r.ProcessIQ(context.Background(), newExchangeIQ("modify", "Friends"))
+	_ = gwStm.ReceiveElement()
+
+	ri, _ = rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "12345@jackal.im")
+	require.Equal(t, []string{"Friends"}, ri.Groups)
+
+	r.ProcessIQ(context.Background(), newExchangeIQ("delete"))
+	_ = gwStm.ReceiveElement()
+
+	ri, _ = rosterRep.FetchRosterItem(context.Background(), "ortuman@jackal.im", "12345@jackal.im")
+	require.Nil(t, ri)
+
+	// unknown action
+	r.ProcessIQ(context.Background(), newExchangeIQ("merge"))
+	elem = gwStm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+}
@@ -0,0 +1,384 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package roster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+var errSharedGroupsNotAvailable = errors.New("roster: shared groups storage not available")
+
+// sharedGroupsCacheTTL bounds how long cached shared group members are served, so that host wide
+// groups pick up newly registered users, as well as group updates performed by other cluster nodes.
+const sharedGroupsCacheTTL = time.Minute
+
+// sharedGroupsCache keeps shared group definitions along with their members in memory.
+// Cached data is invalidated whenever a shared group is updated.
+type sharedGroupsCache struct {
+	mu       sync.Mutex
+	groups   []rostermodel.SharedGroup
+	members  map[string][]string // members by group name
+	loadedAt time.Time
+}
+
+func (c *sharedGroupsCache) load(ctx context.Context, rep repository.SharedGroups) ([]rostermodel.SharedGroup, map[string][]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.members != nil && time.Since(c.loadedAt) < sharedGroupsCacheTTL {
+		return c.groups, c.members, nil
+	}
+	groups, err := rep.FetchSharedGroups(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	members := make(map[string][]string, len(groups))
+	for _, group := range groups {
+		members[group.Name], err = rep.FetchSharedGroupMembers(ctx, group.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	c.groups, c.members, c.loadedAt = groups, members, time.Now()
+	return groups, members, nil
+}
+
+func (c *sharedGroupsCache) invalidate() {
+	c.mu.Lock()
+	c.groups, c.members = nil, nil
+	c.mu.Unlock()
+}
+
+// SharedGroups returns all administrator defined shared roster groups.
+func (x *Roster) SharedGroups(ctx context.Context) ([]rostermodel.SharedGroup, error) {
+	if x.shGroupRep == nil {
+		return nil, nil
+	}
+	return x.shGroupRep.FetchSharedGroups(ctx)
+}
+
+// UpsertSharedGroup stores a shared roster group, pushing the resulting roster changes to its former and new members.
+func (x *Roster) UpsertSharedGroup(ctx context.Context, group *rostermodel.SharedGroup) error {
+	return x.runSharedGroupUpdate(ctx, group.Name, func() error {
+		return x.shGroupRep.UpsertSharedGroup(ctx, group)
+	})
+}
+
+// DeleteSharedGroup removes a shared roster group, pushing the resulting roster changes to its former members.
+func (x *Roster) DeleteSharedGroup(ctx context.Context, name string) error {
+	return x.runSharedGroupUpdate(ctx, name, func() error {
+		return x.shGroupRep.DeleteSharedGroup(ctx, name)
+	})
+}
+
+func (x *Roster) runSharedGroupUpdate(ctx context.Context, name string, update func() error) error {
+	if x.shGroupRep == nil {
+		return errSharedGroupsNotAvailable
+	}
+	errCh := make(chan error, 1)
+	x.runQueue.Run(sharedGroupQueueKey(name), func() {
+		errCh <- x.updateSharedGroup(ctx, name, update)
+	})
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (x *Roster) updateSharedGroup(ctx context.Context, name string, update func() error) error {
+	oldGroups, err := x.shGroupRep.FetchSharedGroups(ctx)
+	if err != nil {
+		return err
+	}
+	oldMembers, err := x.shGroupRep.FetchSharedGroupMembers(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := update(); err != nil {
+		return err
+	}
+	x.shGroups.invalidate()
+
+	newGroups, err := x.shGroupRep.FetchSharedGroups(ctx)
+	if err != nil {
+		return err
+	}
+	newMembers, err := x.shGroupRep.FetchSharedGroupMembers(ctx, name)
+	if err != nil {
+		return err
+	}
+	log.Infof("updated shared group: %s", name)
+
+	oldSet := make(map[string]bool, len(oldMembers))
+	for _, m := range oldMembers {
+		oldSet[m] = true
+	}
+	newSet := make(map[string]bool, len(newMembers))
+	for _, m := range newMembers {
+		newSet[m] = true
+	}
+	var all, changed []*jid.JID
+	seen := make(map[string]bool)
+	for _, members := range [][]string{oldMembers, newMembers} {
+		for _, m := range members {
+			if seen[m] {
+				continue
+			}
+			seen[m] = true
+			j, err := jid.NewWithString(m, true)
+			if err != nil {
+				continue
+			}
+			all = append(all, j)
+			if oldSet[m] != newSet[m] {
+				changed = append(changed, j)
+			}
+		}
+	}
+	// only those pairs involving a member that joined or left the group might have changed,
+	// so group them by user to fetch every affected roster just once
+	var users []*jid.JID
+	contacts := make(map[string][]*jid.JID)
+	paired := make(map[string]bool)
+	addPair := func(usrJID, cntJID *jid.JID) {
+		usr, cnt := usrJID.String(), cntJID.String()
+		if usr == cnt || paired[usr+" "+cnt] {
+			return
+		}
+		paired[usr+" "+cnt] = true
+		if _, ok := contacts[usr]; !ok {
+			users = append(users, usrJID)
+		}
+		contacts[usr] = append(contacts[usr], cntJID)
+	}
+	for _, chJID := range changed {
+		for _, mJID := range all {
+			addPair(mJID, chJID)
+			addPair(chJID, mJID)
+		}
+	}
+	for _, usrJID := range users {
+		if err := x.pushSharedItems(ctx, usrJID, contacts[usrJID.String()], oldGroups, newGroups); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushSharedItems pushes to a user the resulting roster items of those contacts whose shared groups might have changed.
+func (x *Roster) pushSharedItems(ctx context.Context, userJID *jid.JID, contacts []*jid.JID, oldGroups, newGroups []rostermodel.SharedGroup) error {
+	ris, ver, err := x.rosterRep.FetchRosterItems(ctx, userJID.String())
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]rostermodel.Item, len(ris))
+	for _, ri := range ris {
+		stored[ri.JID] = ri
+	}
+	shared, err := x.sharedContacts(ctx, userJID)
+	if err != nil {
+		return err
+	}
+	rosterVer := rosterVersion(ver.Ver, shared)
+
+	for _, cntJID := range contacts {
+		wasShared := len(sharedGroupsOf(oldGroups, userJID, cntJID)) > 0
+		groups := sharedGroupsOf(newGroups, userJID, cntJID)
+
+		ri, ok := stored[cntJID.String()]
+		if !ok {
+			ri = rostermodel.Item{
+				Username:     userJID.Node(),
+				Domain:       userJID.Domain(),
+				JID:          cntJID.String(),
+				Subscription: rostermodel.SubscriptionRemove,
+			}
+		}
+		mergeSharedItem(&ri, groups)
+		x.sendRosterPush(ctx, &ri, userJID, rosterVer)
+
+		if !x.router.Hosts().IsLocalHost(cntJID.Domain()) {
+			continue
+		}
+		switch {
+		case !wasShared && len(groups) > 0:
+			x.routePresencesFrom(ctx, cntJID, userJID, xmpp.AvailableType)
+		case wasShared && ri.Subscription != rostermodel.SubscriptionTo && ri.Subscription != rostermodel.SubscriptionBoth:
+			x.routePresencesFrom(ctx, cntJID, userJID, xmpp.UnavailableType)
+		}
+	}
+	return nil
+}
+
+// fetchRosterItems returns a user's roster items, including those derived from shared groups.
+func (x *Roster) fetchRosterItems(ctx context.Context, userJID *jid.JID) ([]rostermodel.Item, error) {
+	items, _, err := x.rosterRep.FetchRosterItems(ctx, userJID.String())
+	if err != nil {
+		return nil, err
+	}
+	shared, err := x.sharedContacts(ctx, userJID)
+	if err != nil {
+		return nil, err
+	}
+	return mergeSharedItems(items, shared, userJID), nil
+}
+
+// sharedContacts returns all contacts a user shares a group with, along with the name of the shared groups.
+func (x *Roster) sharedContacts(ctx context.Context, userJID *jid.JID) (map[string][]string, error) {
+	if x.shGroupRep == nil {
+		return nil, nil
+	}
+	groups, members, err := x.shGroups.load(ctx, x.shGroupRep)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string][]string
+	for _, group := range groups {
+		if !group.IsMember(userJID) {
+			continue
+		}
+		for _, member := range members[group.Name] {
+			if member == userJID.String() {
+				continue
+			}
+			if ret == nil {
+				ret = make(map[string][]string)
+			}
+			ret[member] = append(ret[member], group.Name)
+		}
+	}
+	return ret, nil
+}
+
+// isSharedContact tells whether or not two users share any group.
+func (x *Roster) isSharedContact(ctx context.Context, userJID, contactJID *jid.JID) (bool, error) {
+	if x.shGroupRep == nil {
+		return false, nil
+	}
+	groups, _, err := x.shGroups.load(ctx, x.shGroupRep)
+	if err != nil {
+		return false, err
+	}
+	return len(sharedGroupsOf(groups, userJID, contactJID)) > 0, nil
+}
+
+// mergeSharedItems merges shared contacts into a user's own roster items.
+func mergeSharedItems(items []rostermodel.Item, shared map[string][]string, userJID *jid.JID) []rostermodel.Item {
+	if len(shared) == 0 {
+		return items
+	}
+	merged := make(map[string]bool, len(shared))
+	for i := range items {
+		if groups, ok := shared[items[i].JID]; ok {
+			mergeSharedItem(&items[i], groups)
+			merged[items[i].JID] = true
+		}
+	}
+	var contacts []string
+	for contact := range shared {
+		if !merged[contact] {
+			contacts = append(contacts, contact)
+		}
+	}
+	sort.Strings(contacts)
+
+	for _, contact := range contacts {
+		ri := rostermodel.Item{
+			Username: userJID.Node(),
+			Domain:   userJID.Domain(),
+			JID:      contact,
+		}
+		mergeSharedItem(&ri, shared[contact])
+		items = append(items, ri)
+	}
+	return items
+}
+
+// mergeSharedItem applies a set of shared groups to a roster item.
+// Shared group members are implicitly subscribed to each other's presence.
+func mergeSharedItem(ri *rostermodel.Item, groups []string) {
+	if len(groups) == 0 {
+		return
+	}
+	ri.Subscription = rostermodel.SubscriptionBoth
+	ri.Ask = false
+	for _, group := range groups {
+		var found bool
+		for _, g := range ri.Groups {
+			if g == group {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ri.Groups = append(ri.Groups, group)
+		}
+	}
+}
+
+// rosterVersion returns the roster version advertised to a user.
+// Shared group membership is not stored along with the user's roster, so a digest of
+// the user's shared contacts is appended to let clients detect shared group changes.
+func rosterVersion(ver int, shared map[string][]string) string {
+	if len(shared) == 0 {
+		return fmt.Sprintf("v%d", ver)
+	}
+	return fmt.Sprintf("v%d-%s", ver, sharedDigest(shared))
+}
+
+func sharedDigest(shared map[string][]string) string {
+	if len(shared) == 0 {
+		return ""
+	}
+	contacts := make([]string, 0, len(shared))
+	for contact := range shared {
+		contacts = append(contacts, contact)
+	}
+	sort.Strings(contacts)
+
+	h := fnv.New64a()
+	for _, contact := range contacts {
+		groups := append([]string(nil), shared[contact]...)
+		sort.Strings(groups)
+
+		_, _ = h.Write([]byte(contact))
+		for _, group := range groups {
+			_, _ = h.Write([]byte{0})
+			_, _ = h.Write([]byte(group))
+		}
+		_, _ = h.Write([]byte{'\n'})
+	}
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+func sharedGroupQueueKey(name string) string {
+	return "sharedGroup:" + name
+}
+
+func sharedGroupsOf(groups []rostermodel.SharedGroup, j1, j2 *jid.JID) []string {
+	var ret []string
+	for _, group := range groups {
+		if group.IsMember(j1) && group.IsMember(j2) {
+			ret = append(ret, group.Name)
+		}
+	}
+	return ret
+}
@@ -28,13 +28,13 @@ type LastActivity struct {
 	userRep   repository.User
 	rosterRep repository.Roster
 	startTime time.Time
-	runQueue  *runqueue.RunQueue
+	runQueue  *runqueue.ShardedRunQueue
 }
 
 // New returns a last activity IQ handler module.
 func New(disco *xep0030.DiscoInfo, router router.Router, userRep repository.User, rosterRep repository.Roster) *LastActivity {
 	x := &LastActivity{
-		runQueue:  runqueue.New("xep0012"),
+		runQueue:  runqueue.NewSharded("xep0012", 0),
 		router:    router,
 		userRep:   userRep,
 		rosterRep: rosterRep,
@@ -54,7 +54,7 @@ func (x *LastActivity) MatchesIQ(iq *xmpp.IQ) bool {
 
 // ProcessIQ processes a last activity IQ taking according actions over the associated stream.
 func (x *LastActivity) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
-	x.runQueue.Run(func() {
+	x.runQueue.Run(iq.FromJID().ToBareJID().String(), func() {
 		x.processIQ(ctx, iq)
 	})
 }
@@ -95,11 +95,11 @@ func (x *LastActivity) sendServerUptime(ctx context.Context, iq *xmpp.IQ) {
 }
 
 func (x *LastActivity) sendUserLastActivity(ctx context.Context, iq *xmpp.IQ, to *jid.JID) {
-	if len(x.router.LocalStreams(to.Node())) > 0 { // user is online
+	if len(x.router.LocalStreams(to)) > 0 { // user is online
 		x.sendReply(ctx, iq, 0, "")
 		return
 	}
-	usr, err := x.userRep.FetchUser(ctx, to.Node())
+	usr, err := x.userRep.FetchUser(ctx, to.ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		_ = x.router.Route(ctx, iq.InternalServerError())
@@ -133,7 +133,7 @@ func (x *LastActivity) isSubscribedTo(ctx context.Context, contact *jid.JID, use
 	if contact.MatchesWithOptions(userJID, jid.MatchesBare) {
 		return true, nil
 	}
-	ri, err := x.rosterRep.FetchRosterItem(ctx, userJID.Node(), contact.ToBareJID().String())
+	ri, err := x.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contact.ToBareJID().String())
 	if err != nil {
 		return false, err
 	}
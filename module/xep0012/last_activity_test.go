@@ -117,10 +117,12 @@ func TestXEP0012_GetOnlineUserLastActivity(t *testing.T) {
 
 	_ = userRep.UpsertUser(context.Background(), &model.User{
 		Username:     "noelia",
+		Domain:       "jackal.im",
 		LastPresence: p,
 	})
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Subscription: "both",
 	})
@@ -153,7 +155,7 @@ func setupTest(domain string) (router.Router, repository.User, repository.Roster
 	rosterRep := memorystorage.NewRoster()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(userRep, memorystorage.NewBlockList()),
+		c2srouter.New(userRep, memorystorage.NewBlockList(), nil),
 		nil,
 	)
 	return r, userRep, rosterRep
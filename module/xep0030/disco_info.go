@@ -9,6 +9,7 @@ import (
 	"context"
 	"sync"
 
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage/repository"
 	"github.com/ortuman/jackal/util/runqueue"
@@ -45,6 +46,8 @@ func New(router router.Router, rosterRep repository.Roster) *DiscoInfo {
 	di.RegisterServerFeature(discoInfoNamespace)
 	di.RegisterAccountFeature(discoItemsNamespace)
 	di.RegisterAccountFeature(discoInfoNamespace)
+	di.RegisterServerFeature(rsmmodel.Namespace)
+	di.RegisterAccountFeature(rsmmodel.Namespace)
 	return di
 }
 
@@ -58,6 +61,16 @@ func (x *DiscoInfo) UnregisterServerItem(item Item) {
 	x.srvProvider.unregisterServerItem(item)
 }
 
+// RegisterServerNodeProvider registers a provider in charge of answering server disco requests targeting a node.
+func (x *DiscoInfo) RegisterServerNodeProvider(node string, provider InfoProvider) {
+	x.srvProvider.registerNodeProvider(node, provider)
+}
+
+// UnregisterServerNodeProvider unregisters a previously registered server node provider.
+func (x *DiscoInfo) UnregisterServerNodeProvider(node string) {
+	x.srvProvider.unregisterNodeProvider(node)
+}
+
 // RegisterServerFeature registers a new feature associated to server domain.
 func (x *DiscoInfo) RegisterServerFeature(feature string) {
 	x.srvProvider.registerServerFeature(feature)
@@ -143,7 +156,7 @@ func (x *DiscoInfo) processIQ(ctx context.Context, iq *xmpp.IQ) {
 			x.sendDiscoInfo(ctx, prov, toJID, fromJID, node, iq)
 			return
 		case discoItemsNamespace:
-			x.sendDiscoItems(ctx, prov, toJID, fromJID, node, iq)
+			x.sendDiscoItems(ctx, prov, toJID, fromJID, node, q, iq)
 			return
 		}
 	}
@@ -191,12 +204,35 @@ func (x *DiscoInfo) sendDiscoInfo(ctx context.Context, prov InfoProvider, toJID,
 	_ = x.router.Route(ctx, result)
 }
 
-func (x *DiscoInfo) sendDiscoItems(ctx context.Context, prov InfoProvider, toJID, fromJID *jid.JID, node string, iq *xmpp.IQ) {
+func (x *DiscoInfo) sendDiscoItems(ctx context.Context, prov InfoProvider, toJID, fromJID *jid.JID, node string, q xmpp.XElement, iq *xmpp.IQ) {
+	var rsmReq *rsmmodel.Request
+	if setEl := q.Elements().ChildNamespace("set", rsmmodel.Namespace); setEl != nil {
+		req, err := rsmmodel.NewRequestFromElement(setEl)
+		if err != nil {
+			_ = x.router.Route(ctx, iq.BadRequestError())
+			return
+		}
+		rsmReq = req
+	}
 	items, sErr := prov.Items(ctx, toJID, fromJID, node)
 	if sErr != nil {
 		_ = x.router.Route(ctx, xmpp.NewErrorStanzaFromStanza(iq, sErr, nil))
 		return
 	}
+	var rsmRes *rsmmodel.Result
+	if rsmReq != nil {
+		identifiers := make([]string, len(items))
+		for i, item := range items {
+			identifiers[i] = itemIdentifier(item)
+		}
+		from, to, res, err := rsmmodel.Paginate(identifiers, rsmReq)
+		if err != nil {
+			_ = x.router.Route(ctx, iq.ItemNotFoundError())
+			return
+		}
+		items = items[from:to]
+		rsmRes = res
+	}
 	result := iq.ResultIQ()
 	query := xmpp.NewElementNamespace("query", discoItemsNamespace)
 	for _, item := range items {
@@ -210,6 +246,17 @@ func (x *DiscoInfo) sendDiscoItems(ctx context.Context, prov InfoProvider, toJID
 		}
 		query.AppendElement(itemEl)
 	}
+	if rsmRes != nil {
+		query.AppendElement(rsmRes.Element())
+	}
 	result.AppendElement(query)
 	_ = x.router.Route(ctx, result)
 }
+
+// itemIdentifier returns the opaque identifier used to page over disco items.
+func itemIdentifier(item Item) string {
+	if len(item.Node) == 0 {
+		return item.Jid
+	}
+	return item.Jid + "#" + item.Node
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/ortuman/jackal/router/host"
 
 	c2srouter "github.com/ortuman/jackal/c2s/router"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
 	"github.com/ortuman/jackal/module/xep0004"
 	"github.com/ortuman/jackal/router"
 	memorystorage "github.com/ortuman/jackal/storage/memory"
@@ -87,7 +88,7 @@ func TestXEP0030_SendFeatures(t *testing.T) {
 	q := elem.Elements().ChildNamespace("query", discoInfoNamespace)
 
 	require.NotNil(t, q)
-	require.Equal(t, 6, q.Elements().Count())
+	require.Equal(t, 7, q.Elements().Count())
 	require.Equal(t, "identity", q.Elements().All()[0].Name())
 	require.Equal(t, "feature", q.Elements().All()[1].Name())
 
@@ -99,7 +100,7 @@ func TestXEP0030_SendFeatures(t *testing.T) {
 	q = elem.Elements().ChildNamespace("query", discoInfoNamespace)
 
 	require.NotNil(t, q)
-	require.Equal(t, 5, q.Elements().Count())
+	require.Equal(t, 6, q.Elements().Count())
 
 	iq1.SetToJID(j.ToBareJID())
 	x.ProcessIQ(context.Background(), iq1)
@@ -107,7 +108,7 @@ func TestXEP0030_SendFeatures(t *testing.T) {
 	q = elem.Elements().ChildNamespace("query", discoInfoNamespace)
 
 	require.NotNil(t, q)
-	require.Equal(t, 4, q.Elements().Count())
+	require.Equal(t, 5, q.Elements().Count())
 }
 
 func TestXEP0030_SendItems(t *testing.T) {
@@ -136,6 +137,64 @@ func TestXEP0030_SendItems(t *testing.T) {
 	require.Equal(t, 1, len(q.Elements().Children("item")))
 }
 
+func TestXEP0030_SendItemsPage(t *testing.T) {
+	r, rosterRep := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJid, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+
+	r.Bind(context.Background(), stm)
+
+	x := New(r, rosterRep)
+	defer func() { _ = x.Shutdown() }()
+
+	x.RegisterServerItem(Item{Jid: "a.jackal.im"})
+	x.RegisterServerItem(Item{Jid: "b.jackal.im"})
+	x.RegisterServerItem(Item{Jid: "c.jackal.im"})
+
+	setEl := xmpp.NewElementNamespace("set", rsmmodel.Namespace)
+	setEl.AppendElement(xmpp.NewElementName("max").SetText("2"))
+	setEl.AppendElement(xmpp.NewElementName("after").SetText("a.jackal.im"))
+
+	q := xmpp.NewElementNamespace("query", discoItemsNamespace)
+	q.AppendElement(setEl)
+
+	iq1 := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq1.SetFromJID(j)
+	iq1.SetToJID(srvJid)
+	iq1.AppendElement(q)
+
+	x.ProcessIQ(context.Background(), iq1)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	resQ := elem.Elements().ChildNamespace("query", discoItemsNamespace)
+	items := resQ.Elements().Children("item")
+	require.Len(t, items, 2)
+	require.Equal(t, "b.jackal.im", items[0].Attributes().Get("jid"))
+	require.Equal(t, "c.jackal.im", items[1].Attributes().Get("jid"))
+
+	// requester bare JID is always listed first
+	resSet := resQ.Elements().ChildNamespace("set", rsmmodel.Namespace)
+	require.NotNil(t, resSet)
+	require.Equal(t, "b.jackal.im", resSet.Elements().Child("first").Text())
+	require.Equal(t, "2", resSet.Elements().Child("first").Attributes().Get("index"))
+	require.Equal(t, "c.jackal.im", resSet.Elements().Child("last").Text())
+	require.Equal(t, "4", resSet.Elements().Child("count").Text())
+
+	// unknown anchor
+	setEl.RemoveElements("after")
+	setEl.AppendElement(xmpp.NewElementName("after").SetText("z.jackal.im"))
+
+	x.ProcessIQ(context.Background(), iq1)
+	elem = stm.ReceiveElement()
+	require.True(t, elem.IsError())
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+}
+
 type testDiscoInfoProvider struct {
 }
 
@@ -201,7 +260,7 @@ func setupTest(domain string) (router.Router, repository.Roster) {
 	rosterRep := memorystorage.NewRoster()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList()),
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
 		nil,
 	)
 	return r, rosterRep
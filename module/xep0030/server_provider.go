@@ -25,10 +25,14 @@ type serverProvider struct {
 	serverItems     []Item
 	serverFeatures  []Feature
 	accountFeatures []Feature
+	nodeProviders   map[string]InfoProvider
 }
 
-func (sp *serverProvider) Identities(_ context.Context, toJID, _ *jid.JID, node string) []Identity {
+func (sp *serverProvider) Identities(ctx context.Context, toJID, fromJID *jid.JID, node string) []Identity {
 	if node != "" {
+		if prov := sp.nodeProvider(toJID, node); prov != nil {
+			return prov.Identities(ctx, toJID, fromJID, node)
+		}
 		return nil
 	}
 	if toJID.IsServer() {
@@ -39,6 +43,9 @@ func (sp *serverProvider) Identities(_ context.Context, toJID, _ *jid.JID, node
 
 func (sp *serverProvider) Items(ctx context.Context, toJID, fromJID *jid.JID, node string) ([]Item, *xmpp.StanzaError) {
 	if node != "" {
+		if prov := sp.nodeProvider(toJID, node); prov != nil {
+			return prov.Items(ctx, toJID, fromJID, node)
+		}
 		return nil, nil
 	}
 	var items []Item
@@ -48,7 +55,7 @@ func (sp *serverProvider) Items(ctx context.Context, toJID, fromJID *jid.JID, no
 	} else {
 		// add account resources
 		if sp.isSubscribedTo(ctx, toJID, fromJID) {
-			streams := sp.router.LocalStreams(toJID.Node())
+			streams := sp.router.LocalStreams(toJID)
 			for _, stm := range streams {
 				items = append(items, Item{Jid: stm.JID().String()})
 			}
@@ -60,11 +67,14 @@ func (sp *serverProvider) Items(ctx context.Context, toJID, fromJID *jid.JID, no
 }
 
 func (sp *serverProvider) Features(ctx context.Context, toJID, fromJID *jid.JID, node string) ([]Feature, *xmpp.StanzaError) {
-	sp.mu.RLock()
-	defer sp.mu.RUnlock()
 	if node != "" {
+		if prov := sp.nodeProvider(toJID, node); prov != nil {
+			return prov.Features(ctx, toJID, fromJID, node)
+		}
 		return nil, nil
 	}
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
 	if toJID.IsServer() {
 		return sp.serverFeatures, nil
 	}
@@ -74,10 +84,39 @@ func (sp *serverProvider) Features(ctx context.Context, toJID, fromJID *jid.JID,
 	return nil, xmpp.ErrSubscriptionRequired
 }
 
-func (sp *serverProvider) Form(_ context.Context, _, _ *jid.JID, _ string) (*xep0004.DataForm, *xmpp.StanzaError) {
+func (sp *serverProvider) Form(ctx context.Context, toJID, fromJID *jid.JID, node string) (*xep0004.DataForm, *xmpp.StanzaError) {
+	if node != "" {
+		if prov := sp.nodeProvider(toJID, node); prov != nil {
+			return prov.Form(ctx, toJID, fromJID, node)
+		}
+	}
 	return nil, nil
 }
 
+func (sp *serverProvider) registerNodeProvider(node string, provider InfoProvider) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.nodeProviders == nil {
+		sp.nodeProviders = make(map[string]InfoProvider)
+	}
+	sp.nodeProviders[node] = provider
+}
+
+func (sp *serverProvider) unregisterNodeProvider(node string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	delete(sp.nodeProviders, node)
+}
+
+func (sp *serverProvider) nodeProvider(toJID *jid.JID, node string) InfoProvider {
+	if !toJID.IsServer() {
+		return nil
+	}
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.nodeProviders[node]
+}
+
 func (sp *serverProvider) registerServerItem(item Item) {
 	sp.mu.Lock()
 	defer sp.mu.Unlock()
@@ -148,7 +187,7 @@ func (sp *serverProvider) isSubscribedTo(ctx context.Context, contact *jid.JID,
 	if contact.MatchesWithOptions(userJID, jid.MatchesBare) {
 		return true
 	}
-	ri, err := sp.rosterRep.FetchRosterItem(ctx, userJID.Node(), contact.ToBareJID().String())
+	ri, err := sp.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contact.ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		return false
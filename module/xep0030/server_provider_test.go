@@ -109,6 +109,7 @@ func TestServerProvider_Items(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Subscription: "both",
 	})
@@ -120,3 +121,34 @@ func TestServerProvider_Items(t *testing.T) {
 	})
 	require.Nil(t, sErr)
 }
+
+func TestServerProvider_NodeProviders(t *testing.T) {
+	r, rosterRep := setupTest("jackal.im")
+
+	var sp = serverProvider{router: r, rosterRep: rosterRep}
+
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	accJID, _ := jid.New("ortuman", "jackal.im", "garden", true)
+
+	sp.registerNodeProvider("node", &testDiscoInfoProvider{})
+
+	features, sErr := sp.Features(context.Background(), srvJID, accJID, "node")
+	require.Nil(t, sErr)
+	require.Equal(t, []Feature{"com.jackal.im.feature"}, features)
+
+	items, sErr := sp.Items(context.Background(), srvJID, accJID, "node")
+	require.Nil(t, sErr)
+	require.Equal(t, []Item{{Jid: "test.jackal.im"}}, items)
+
+	require.Equal(t, []Identity{{Name: "test_identity"}}, sp.Identities(context.Background(), srvJID, accJID, "node"))
+
+	// node providers only apply to server entity
+	features, _ = sp.Features(context.Background(), accJID.ToBareJID(), accJID, "node")
+	require.Nil(t, features)
+
+	sp.unregisterNodeProvider("node")
+
+	features, sErr = sp.Features(context.Background(), srvJID, accJID, "node")
+	require.Nil(t, sErr)
+	require.Nil(t, features)
+}
@@ -8,33 +8,48 @@ package xep0049
 import (
 	"context"
 	"strings"
+	"sync"
 
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage/repository"
 	"github.com/ortuman/jackal/util/runqueue"
 	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
 )
 
 const privateNamespace = "jabber:iq:private"
 
+// UpdateHandler is invoked every time a user stores private XML elements qualified by a registered namespace.
+type UpdateHandler func(ctx context.Context, userJID *jid.JID, elements []xmpp.XElement)
+
 // Private represents a private storage server stream module.
 type Private struct {
-	router   router.Router
-	runQueue *runqueue.RunQueue
-	rep      repository.Private
+	router     router.Router
+	runQueue   *runqueue.ShardedRunQueue
+	rep        repository.Private
+	handlersMu sync.RWMutex
+	handlers   map[string][]UpdateHandler
 }
 
 // New returns a private storage IQ handler module.
 func New(router router.Router, privRep repository.Private) *Private {
 	x := &Private{
 		router:   router,
-		runQueue: runqueue.New("xep0049"),
+		runQueue: runqueue.NewSharded("xep0049", 0),
 		rep:      privRep,
+		handlers: make(map[string][]UpdateHandler),
 	}
 	return x
 }
 
+// RegisterUpdateHandler registers a handler to be invoked whenever a user stores private XML elements qualified by namespace.
+func (x *Private) RegisterUpdateHandler(namespace string, h UpdateHandler) {
+	x.handlersMu.Lock()
+	x.handlers[namespace] = append(x.handlers[namespace], h)
+	x.handlersMu.Unlock()
+}
+
 // MatchesIQ returns whether or not an IQ should be processed by the private storage module.
 func (x *Private) MatchesIQ(iq *xmpp.IQ) bool {
 	return iq.Elements().ChildNamespace("query", privateNamespace) != nil
@@ -42,7 +57,7 @@ func (x *Private) MatchesIQ(iq *xmpp.IQ) bool {
 
 // ProcessIQ processes a private storage IQ taking according actions over the associated stream.
 func (x *Private) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
-	x.runQueue.Run(func() {
+	x.runQueue.Run(iq.FromJID().ToBareJID().String(), func() {
 		x.processIQ(ctx, iq)
 	})
 }
@@ -90,7 +105,7 @@ func (x *Private) getPrivate(ctx context.Context, iq *xmpp.IQ, q xmpp.XElement)
 	fromJID := iq.FromJID()
 	log.Infof("retrieving private element. ns: %s... (%s/%s)", privNS, fromJID.Node(), fromJID.Resource())
 
-	privElements, err := x.rep.FetchPrivateXML(ctx, privNS, fromJID.Node())
+	privElements, err := x.rep.FetchPrivateXML(ctx, privNS, fromJID.ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		_ = x.router.Route(ctx, iq.InternalServerError())
@@ -133,15 +148,26 @@ func (x *Private) setPrivate(ctx context.Context, iq *xmpp.IQ, q xmpp.XElement)
 	for ns, elements := range nsElements {
 		log.Infof("saving private element. ns: %s... (%s/%s)", ns, fromJID.Node(), fromJID.Resource())
 
-		if err := x.rep.UpsertPrivateXML(ctx, elements, ns, fromJID.Node()); err != nil {
+		if err := x.rep.UpsertPrivateXML(ctx, elements, ns, fromJID.ToBareJID().String()); err != nil {
 			log.Error(err)
 			_ = x.router.Route(ctx, iq.InternalServerError())
 			return
 		}
+		x.runUpdateHandlers(ctx, fromJID.ToBareJID(), ns, elements)
 	}
 	_ = x.router.Route(ctx, iq.ResultIQ())
 }
 
+func (x *Private) runUpdateHandlers(ctx context.Context, userJID *jid.JID, namespace string, elements []xmpp.XElement) {
+	x.handlersMu.RLock()
+	handlers := x.handlers[namespace]
+	x.handlersMu.RUnlock()
+
+	for _, h := range handlers {
+		h(ctx, userJID, elements)
+	}
+}
+
 func (x *Private) isValidNamespace(ns string) bool {
 	return !strings.HasPrefix(ns, "jabber:") && !strings.HasPrefix(ns, "http://jabber.org/") && ns != "vcard-temp"
 }
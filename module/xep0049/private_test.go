@@ -166,12 +166,50 @@ func TestXEP0049_SetAndGetPrivate(t *testing.T) {
 	require.Equal(t, "exodus:ns:2", q3.Elements().All()[0].Namespace())
 }
 
+func TestXEP0049_UpdateHandler(t *testing.T) {
+	r, s := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+
+	r.Bind(context.Background(), stm)
+
+	x := New(r, s)
+	defer func() { _ = x.Shutdown() }()
+
+	var handledJID *jid.JID
+	var handledElements []xmpp.XElement
+	x.RegisterUpdateHandler("exodus:ns", func(_ context.Context, userJID *jid.JID, elements []xmpp.XElement) {
+		handledJID = userJID
+		handledElements = elements
+	})
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	q := xmpp.NewElementNamespace("query", privateNamespace)
+	q.AppendElement(xmpp.NewElementNamespace("exodus", "exodus:ns"))
+	q.AppendElement(xmpp.NewElementNamespace("psi", "psi:ns"))
+	iq.AppendElement(q)
+
+	x.ProcessIQ(context.Background(), iq)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	require.NotNil(t, handledJID)
+	require.Equal(t, "ortuman@jackal.im", handledJID.String())
+	require.Len(t, handledElements, 1)
+	require.Equal(t, "exodus", handledElements[0].Name())
+}
+
 func setupTest(domain string) (router.Router, repository.Private) {
 	hosts, _ := host.New([]host.Config{{Name: domain, Certificate: tls.Certificate{}}})
 	s := memorystorage.NewPrivate()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList()),
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
 		nil,
 	)
 	return r, s
@@ -0,0 +1,273 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/util/runqueue"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// Namespace specifies XEP-0050 namespace constant value.
+const Namespace = "http://jabber.org/protocol/commands"
+
+// AdHoc represents an ad-hoc commands server stream module.
+type AdHoc struct {
+	cfg      *Config
+	disco    *xep0030.DiscoInfo
+	router   router.Router
+	runQueue *runqueue.ShardedRunQueue
+	mu       sync.RWMutex
+	commands map[string]Command
+	sessions map[string]*Session
+}
+
+// New returns an ad-hoc commands IQ handler module.
+func New(config *Config, disco *xep0030.DiscoInfo, router router.Router) *AdHoc {
+	cfg := *config
+	if cfg.SessionTimeout == 0 {
+		cfg.SessionTimeout = defaultSessionTimeout
+	}
+	x := &AdHoc{
+		cfg:      &cfg,
+		disco:    disco,
+		router:   router,
+		runQueue: runqueue.NewSharded("xep0050", 0),
+		commands: make(map[string]Command),
+		sessions: make(map[string]*Session),
+	}
+	if disco != nil {
+		disco.RegisterServerFeature(Namespace)
+		disco.RegisterServerNodeProvider(Namespace, &discoInfoProvider{adHoc: x})
+	}
+	return x
+}
+
+// RegisterCommand registers a new command making it available to allowed entities.
+func (x *AdHoc) RegisterCommand(cmd Command) {
+	x.mu.Lock()
+	x.commands[cmd.Node()] = cmd
+	x.mu.Unlock()
+
+	if x.disco != nil {
+		x.disco.RegisterServerNodeProvider(cmd.Node(), &discoInfoProvider{adHoc: x})
+	}
+}
+
+// UnregisterCommand unregisters a previously registered command.
+func (x *AdHoc) UnregisterCommand(node string) {
+	x.mu.Lock()
+	delete(x.commands, node)
+	x.mu.Unlock()
+
+	if x.disco != nil {
+		x.disco.UnregisterServerNodeProvider(node)
+	}
+}
+
+// MatchesIQ returns whether or not an IQ should be processed by the ad-hoc commands module.
+func (x *AdHoc) MatchesIQ(iq *xmpp.IQ) bool {
+	return iq.IsSet() && iq.ToJID().IsServer() && iq.Elements().ChildNamespace("command", Namespace) != nil
+}
+
+// ProcessIQ processes an ad-hoc command IQ taking according actions over the associated stream.
+func (x *AdHoc) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
+	x.runQueue.Run(iq.FromJID().ToBareJID().String(), func() {
+		x.processIQ(ctx, iq)
+		x.purgeExpiredSessions()
+	})
+}
+
+// Shutdown shuts down ad-hoc commands module.
+func (x *AdHoc) Shutdown() error {
+	c := make(chan struct{})
+	x.runQueue.Stop(func() { close(c) })
+	<-c
+	return nil
+}
+
+func (x *AdHoc) processIQ(ctx context.Context, iq *xmpp.IQ) {
+	cmdEl := iq.Elements().ChildNamespace("command", Namespace)
+	node := cmdEl.Attributes().Get("node")
+	sessionID := cmdEl.Attributes().Get("sessionid")
+	action := cmdEl.Attributes().Get("action")
+	if len(action) == 0 {
+		action = Execute
+	}
+	var form *xep0004.DataForm
+	if formEl := cmdEl.Elements().ChildNamespace("x", xep0004.FormNamespace); formEl != nil {
+		f, err := xep0004.NewFormFromElement(formEl)
+		if err != nil {
+			_ = x.router.Route(ctx, commandError(iq, xmpp.ErrBadRequest, "bad-payload"))
+			return
+		}
+		form = f
+	}
+	cmd := x.command(node)
+	if cmd == nil {
+		_ = x.router.Route(ctx, iq.ItemNotFoundError())
+		return
+	}
+	if !cmd.IsAllowed(iq.FromJID(), iq.ToJID()) {
+		_ = x.router.Route(ctx, iq.ForbiddenError())
+		return
+	}
+	if len(sessionID) == 0 {
+		if action != Execute {
+			_ = x.router.Route(ctx, commandError(iq, xmpp.ErrBadRequest, "bad-action"))
+			return
+		}
+		sess := x.newSession(node, iq.FromJID(), iq.ToJID())
+		x.execute(ctx, cmd, sess, form, iq)
+		return
+	}
+	sess, expired := x.session(sessionID)
+	if expired {
+		_ = x.router.Route(ctx, commandError(iq, xmpp.ErrNotAllowed, "session-expired"))
+		return
+	}
+	if sess == nil || sess.Node != node || sess.FromJID.String() != iq.FromJID().String() {
+		_ = x.router.Route(ctx, commandError(iq, xmpp.ErrBadRequest, "bad-sessionid"))
+		return
+	}
+	switch action {
+	case Cancel:
+		x.deleteSession(sess.ID)
+
+		cmdResEl := xmpp.NewElementNamespace("command", Namespace)
+		cmdResEl.SetAttribute("node", node)
+		cmdResEl.SetAttribute("sessionid", sess.ID)
+		cmdResEl.SetAttribute("status", Canceled)
+
+		iqRes := iq.ResultIQ()
+		iqRes.AppendElement(cmdResEl)
+		_ = x.router.Route(ctx, iqRes)
+
+	case Prev:
+		if len(sess.responses) < 2 || !sess.responses[len(sess.responses)-1].allowsAction(Prev) {
+			_ = x.router.Route(ctx, commandError(iq, xmpp.ErrBadRequest, "bad-action"))
+			return
+		}
+		sess.responses = sess.responses[:len(sess.responses)-1]
+		sess.Stage--
+
+		iqRes := iq.ResultIQ()
+		iqRes.AppendElement(sess.responses[len(sess.responses)-1].element(node, sess.ID))
+		_ = x.router.Route(ctx, iqRes)
+
+	case Execute, Next, Complete:
+		if !sess.responses[len(sess.responses)-1].allowsAction(action) {
+			_ = x.router.Route(ctx, commandError(iq, xmpp.ErrBadRequest, "bad-action"))
+			return
+		}
+		sess.Stage++
+		x.execute(ctx, cmd, sess, form, iq)
+
+	default:
+		_ = x.router.Route(ctx, commandError(iq, xmpp.ErrBadRequest, "bad-action"))
+	}
+}
+
+func (x *AdHoc) execute(ctx context.Context, cmd Command, sess *Session, form *xep0004.DataForm, iq *xmpp.IQ) {
+	resp, sErr := cmd.Execute(ctx, sess, form)
+	if sErr != nil {
+		x.deleteSession(sess.ID)
+		_ = x.router.Route(ctx, xmpp.NewErrorStanzaFromStanza(iq, sErr, nil))
+		return
+	}
+	if resp.Status == Executing {
+		sess.responses = append(sess.responses, resp)
+	} else {
+		x.deleteSession(sess.ID)
+		log.Infof("xep0050: executed command (node: %s, jid: %s)", sess.Node, sess.FromJID.String())
+	}
+	iqRes := iq.ResultIQ()
+	iqRes.AppendElement(resp.element(sess.Node, sess.ID))
+	_ = x.router.Route(ctx, iqRes)
+}
+
+func (x *AdHoc) command(node string) Command {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.commands[node]
+}
+
+// allowedCommands returns all commands an entity is allowed to execute sorted by node.
+func (x *AdHoc) allowedCommands(fromJID, toJID *jid.JID) []Command {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	var cmds []Command
+	for _, cmd := range x.commands {
+		if cmd.IsAllowed(fromJID, toJID) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Node() < cmds[j].Node() })
+	return cmds
+}
+
+func (x *AdHoc) newSession(node string, fromJID, toJID *jid.JID) *Session {
+	sess := &Session{
+		ID:           uuid.New().String(),
+		Node:         node,
+		FromJID:      fromJID,
+		ToJID:        toJID,
+		Data:         make(map[string]interface{}),
+		lastActivity: time.Now(),
+	}
+	x.mu.Lock()
+	x.sessions[sess.ID] = sess
+	x.mu.Unlock()
+	return sess
+}
+
+// purgeExpiredSessions drops every session left idle for longer than the configured timeout.
+func (x *AdHoc) purgeExpiredSessions() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for id, sess := range x.sessions {
+		if time.Since(sess.lastActivity) > x.cfg.SessionTimeout {
+			delete(x.sessions, id)
+		}
+	}
+}
+
+func (x *AdHoc) session(sessionID string) (sess *Session, expired bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	sess = x.sessions[sessionID]
+	if sess == nil {
+		return nil, false
+	}
+	if time.Since(sess.lastActivity) > x.cfg.SessionTimeout {
+		delete(x.sessions, sessionID)
+		return nil, true
+	}
+	sess.lastActivity = time.Now()
+	return sess, false
+}
+
+func (x *AdHoc) deleteSession(sessionID string) {
+	x.mu.Lock()
+	delete(x.sessions, sessionID)
+	x.mu.Unlock()
+}
+
+func commandError(stanza xmpp.Stanza, stanzaErr *xmpp.StanzaError, condition string) xmpp.Stanza {
+	errorElements := []xmpp.XElement{xmpp.NewElementNamespace(condition, Namespace)}
+	return xmpp.NewErrorStanzaFromStanza(stanza, stanzaErr, errorElements)
+}
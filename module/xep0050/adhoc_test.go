@@ -0,0 +1,353 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	c2srouter "github.com/ortuman/jackal/c2s/router"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/router/host"
+	memorystorage "github.com/ortuman/jackal/storage/memory"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const testCommandNode = "http://jackal.im/commands#greet"
+
+type testCommand struct{}
+
+func (c *testCommand) Node() string { return testCommandNode }
+func (c *testCommand) Name() string { return "Greet" }
+
+func (c *testCommand) IsAllowed(fromJID, _ *jid.JID) bool {
+	return fromJID.Node() == "ortuman"
+}
+
+func (c *testCommand) Execute(_ context.Context, sess *Session, form *xep0004.DataForm) (*Response, *xmpp.StanzaError) {
+	switch sess.Stage {
+	case 0:
+		return &Response{
+			Status:        Executing,
+			Actions:       []string{Next},
+			DefaultAction: Next,
+			Form: &xep0004.DataForm{
+				Type:   xep0004.Form,
+				Fields: xep0004.Fields{{Var: "name", Type: xep0004.TextSingle}},
+			},
+		}, nil
+	case 1:
+		if form == nil {
+			return nil, xmpp.ErrBadRequest
+		}
+		sess.Data["name"] = form.Fields.ValueForField("name")
+		return &Response{
+			Status:        Executing,
+			Actions:       []string{Prev, Complete},
+			DefaultAction: Complete,
+			Form: &xep0004.DataForm{
+				Type:   xep0004.Form,
+				Fields: xep0004.Fields{{Var: "greeting", Type: xep0004.TextSingle}},
+			},
+		}, nil
+	default:
+		return &Response{
+			Status: Completed,
+			Notes:  []Note{{Type: InfoNote, Text: form.Fields.ValueForField("greeting") + " " + sess.Data["name"].(string)}},
+		}, nil
+	}
+}
+
+func TestXEP0050_Matching(t *testing.T) {
+	r := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	x := New(&Config{SessionTimeout: time.Minute}, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.AppendElement(xmpp.NewElementNamespace("command", Namespace))
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0050_Execute(t *testing.T) {
+	r := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	x := New(&Config{SessionTimeout: time.Minute}, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	x.RegisterCommand(&testCommand{})
+
+	// unknown command
+	x.ProcessIQ(context.Background(), commandIQ(j, "http://jackal.im/commands#unknown", "", "", nil))
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	// first stage
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, "", "", nil))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	cmdEl := elem.Elements().ChildNamespace("command", Namespace)
+	require.NotNil(t, cmdEl)
+	require.Equal(t, Executing, cmdEl.Attributes().Get("status"))
+	require.Equal(t, Next, cmdEl.Elements().Child("actions").Attributes().Get("execute"))
+	sessionID := cmdEl.Attributes().Get("sessionid")
+	require.NotEmpty(t, sessionID)
+
+	// prev not allowed
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, sessionID, Prev, nil))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("bad-action", Namespace))
+
+	// second stage
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, sessionID, Next, submitForm("name", "noelia")))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	cmdEl = elem.Elements().ChildNamespace("command", Namespace)
+	require.Equal(t, Executing, cmdEl.Attributes().Get("status"))
+	require.NotNil(t, cmdEl.Elements().Child("actions").Elements().Child(Prev))
+
+	// back to first stage
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, sessionID, Prev, nil))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	cmdEl = elem.Elements().ChildNamespace("command", Namespace)
+	formEl := cmdEl.Elements().ChildNamespace("x", xep0004.FormNamespace)
+	require.NotNil(t, formEl)
+	require.Equal(t, "name", formEl.Elements().Child("field").Attributes().Get("var"))
+
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, sessionID, Next, submitForm("name", "noelia")))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// complete
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, sessionID, Complete, submitForm("greeting", "Hi")))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	cmdEl = elem.Elements().ChildNamespace("command", Namespace)
+	require.Equal(t, Completed, cmdEl.Attributes().Get("status"))
+	require.Equal(t, "Hi noelia", cmdEl.Elements().Child("note").Text())
+
+	// session is gone
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, sessionID, Complete, submitForm("greeting", "Hi")))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("bad-sessionid", Namespace))
+}
+
+func TestXEP0050_CancelAndExpire(t *testing.T) {
+	r := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	x := New(&Config{SessionTimeout: time.Millisecond * 50}, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	x.RegisterCommand(&testCommand{})
+
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, "", "", nil))
+	elem := stm.ReceiveElement()
+	sessionID := elem.Elements().ChildNamespace("command", Namespace).Attributes().Get("sessionid")
+
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, sessionID, Cancel, nil))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, Canceled, elem.Elements().ChildNamespace("command", Namespace).Attributes().Get("status"))
+
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, "", "", nil))
+	elem = stm.ReceiveElement()
+	sessionID = elem.Elements().ChildNamespace("command", Namespace).Attributes().Get("sessionid")
+
+	time.Sleep(time.Millisecond * 100)
+
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, sessionID, Next, submitForm("name", "noelia")))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrNotAllowed.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("session-expired", Namespace))
+}
+
+func TestXEP0050_PurgeExpiredSessions(t *testing.T) {
+	r := setupTest("jackal.im")
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetPresence(xmpp.NewPresence(j1, j1, xmpp.AvailableType))
+	r.Bind(context.Background(), stm1)
+
+	j2, _ := jid.New("noelia", "jackal.im", "yard", true)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm2.SetPresence(xmpp.NewPresence(j2, j2, xmpp.AvailableType))
+	r.Bind(context.Background(), stm2)
+
+	x := New(&Config{SessionTimeout: time.Millisecond * 50}, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	x.RegisterCommand(&testCommand{})
+
+	x.ProcessIQ(context.Background(), commandIQ(j1, testCommandNode, "", "", nil))
+	elem := stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	time.Sleep(time.Millisecond * 100)
+
+	// any command request sweeps abandoned sessions
+	x.ProcessIQ(context.Background(), commandIQ(j2, "unknown", "", "", nil))
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+
+	require.Eventually(t, func() bool {
+		x.mu.RLock()
+		defer x.mu.RUnlock()
+		return len(x.sessions) == 0
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestXEP0050_Forbidden(t *testing.T) {
+	r := setupTest("jackal.im")
+
+	j, _ := jid.New("noelia", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	x := New(&Config{SessionTimeout: time.Minute}, nil, r)
+	defer func() { _ = x.Shutdown() }()
+
+	x.RegisterCommand(&testCommand{})
+
+	x.ProcessIQ(context.Background(), commandIQ(j, testCommandNode, "", "", nil))
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0050_DiscoItems(t *testing.T) {
+	r := setupTest("jackal.im")
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j1)
+	stm.SetPresence(xmpp.NewPresence(j1, j1, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	disco := xep0030.New(r, memorystorage.NewRoster())
+	defer func() { _ = disco.Shutdown() }()
+
+	x := New(&Config{SessionTimeout: time.Minute}, disco, r)
+	defer func() { _ = x.Shutdown() }()
+
+	x.RegisterCommand(&testCommand{})
+
+	prov := &discoInfoProvider{adHoc: x}
+
+	items, sErr := prov.Items(context.Background(), srvJID, j1, Namespace)
+	require.Nil(t, sErr)
+	require.Equal(t, []xep0030.Item{{Jid: "jackal.im", Node: testCommandNode, Name: "Greet"}}, items)
+
+	items, _ = prov.Items(context.Background(), srvJID, j2, Namespace)
+	require.Len(t, items, 0)
+
+	features, sErr := prov.Features(context.Background(), srvJID, j1, testCommandNode)
+	require.Nil(t, sErr)
+	require.Equal(t, []xep0030.Feature{Namespace, xep0004.FormNamespace}, features)
+
+	_, sErr = prov.Features(context.Background(), srvJID, j2, testCommandNode)
+	require.Equal(t, xmpp.ErrForbidden, sErr)
+
+	// disco#items request
+	q := xmpp.NewElementNamespace("query", "http://jabber.org/protocol/disco#items")
+	q.SetAttribute("node", Namespace)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(q)
+
+	disco.ProcessIQ(context.Background(), iq)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	itemEls := elem.Elements().Child("query").Elements().Children("item")
+	require.Len(t, itemEls, 1)
+	require.Equal(t, testCommandNode, itemEls[0].Attributes().Get("node"))
+
+	x.UnregisterCommand(testCommandNode)
+
+	items, _ = prov.Items(context.Background(), srvJID, j1, Namespace)
+	require.Len(t, items, 0)
+}
+
+func commandIQ(j *jid.JID, node, sessionID, action string, form *xep0004.DataForm) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	srvJID, _ := jid.New("", j.Domain(), "", true)
+	iq.SetToJID(srvJID)
+
+	cmd := xmpp.NewElementNamespace("command", Namespace)
+	cmd.SetAttribute("node", node)
+	if len(sessionID) > 0 {
+		cmd.SetAttribute("sessionid", sessionID)
+	}
+	if len(action) > 0 {
+		cmd.SetAttribute("action", action)
+	}
+	if form != nil {
+		cmd.AppendElement(form.Element())
+	}
+	iq.AppendElement(cmd)
+	return iq
+}
+
+func submitForm(fieldVar, value string) *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Type:   xep0004.Submit,
+		Fields: xep0004.Fields{{Var: fieldVar, Values: []string{value}}},
+	}
+}
+
+func setupTest(domain string) router.Router {
+	hosts, _ := host.New([]host.Config{{Name: domain, Certificate: tls.Certificate{}}})
+	r, _ := router.New(
+		hosts,
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
+		nil,
+	)
+	return r
+}
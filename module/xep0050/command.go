@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"context"
+	"time"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	// Executing represents an 'executing' command status.
+	Executing = "executing"
+
+	// Completed represents a 'completed' command status.
+	Completed = "completed"
+
+	// Canceled represents a 'canceled' command status.
+	Canceled = "canceled"
+)
+
+const (
+	// Execute represents an 'execute' command action.
+	Execute = "execute"
+
+	// Cancel represents a 'cancel' command action.
+	Cancel = "cancel"
+
+	// Prev represents a 'prev' command action.
+	Prev = "prev"
+
+	// Next represents a 'next' command action.
+	Next = "next"
+
+	// Complete represents a 'complete' command action.
+	Complete = "complete"
+)
+
+const (
+	// InfoNote represents an 'info' note type.
+	InfoNote = "info"
+
+	// WarnNote represents a 'warn' note type.
+	WarnNote = "warn"
+
+	// ErrorNote represents an 'error' note type.
+	ErrorNote = "error"
+)
+
+// Command represents an ad-hoc command offered by the server.
+type Command interface {
+	// Node returns the node identifying the command.
+	Node() string
+
+	// Name returns the command human readable name.
+	Name() string
+
+	// IsAllowed tells whether or not an entity is allowed to discover and execute the command.
+	IsAllowed(fromJID, toJID *jid.JID) bool
+
+	// Execute is invoked once per command stage.
+	// form will be nil on the first stage unless the requester already submitted one.
+	// A proper stanza error should be returned in case an error occurs, terminating the session.
+	Execute(ctx context.Context, sess *Session, form *xep0004.DataForm) (*Response, *xmpp.StanzaError)
+}
+
+// Session represents a command execution session.
+type Session struct {
+	ID      string
+	Node    string
+	FromJID *jid.JID
+	ToJID   *jid.JID
+
+	// Stage contains the number of stages already completed by the requester.
+	Stage int
+
+	// Data can be used by commands to keep state across stages.
+	Data map[string]interface{}
+
+	responses    []*Response
+	lastActivity time.Time
+}
+
+// Note represents a command execution note.
+type Note struct {
+	Type string
+	Text string
+}
+
+// Response represents the outcome of a command stage.
+type Response struct {
+	// Status should be set to Executing in case more stages are pending, or to Completed otherwise.
+	Status string
+
+	// Actions contains the set of actions the requester can take on the next stage.
+	Actions []string
+
+	// DefaultAction is the action taken in case the requester just executes the command.
+	DefaultAction string
+
+	Notes []Note
+	Form  *xep0004.DataForm
+}
+
+func (r *Response) element(node, sessionID string) xmpp.XElement {
+	elem := xmpp.NewElementNamespace("command", Namespace)
+	elem.SetAttribute("node", node)
+	elem.SetAttribute("sessionid", sessionID)
+	elem.SetAttribute("status", r.Status)
+
+	if r.Status == Executing && len(r.Actions) > 0 {
+		actionsElem := xmpp.NewElementName("actions")
+		if len(r.DefaultAction) > 0 {
+			actionsElem.SetAttribute(Execute, r.DefaultAction)
+		}
+		for _, action := range r.Actions {
+			actionsElem.AppendElement(xmpp.NewElementName(action))
+		}
+		elem.AppendElement(actionsElem)
+	}
+	for _, note := range r.Notes {
+		noteElem := xmpp.NewElementName("note")
+		noteElem.SetAttribute("type", note.Type)
+		noteElem.SetText(note.Text)
+		elem.AppendElement(noteElem)
+	}
+	if r.Form != nil {
+		elem.AppendElement(r.Form.Element())
+	}
+	return elem
+}
+
+func (r *Response) allowsAction(action string) bool {
+	if action == Execute {
+		return true
+	}
+	for _, a := range r.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultSessionTimeout = time.Minute * 10
+
+// Config represents Ad-Hoc Commands module (XEP-0050) configuration.
+type Config struct {
+	// SessionTimeout specifies the amount of time a multi-stage command session is kept alive since its last interaction.
+	SessionTimeout time.Duration
+}
+
+type configProxy struct {
+	SessionTimeout int `yaml:"session_timeout"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.SessionTimeout < 0 {
+		return fmt.Errorf("xep0050.Config: session timeout must be positive")
+	}
+	cfg.SessionTimeout = time.Duration(p.SessionTimeout) * time.Second
+	if cfg.SessionTimeout == 0 {
+		cfg.SessionTimeout = defaultSessionTimeout
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte(`session_timeout: -1`), &cfg)
+	require.NotNil(t, err)
+
+	cfg = &Config{}
+	err = yaml.Unmarshal([]byte(`{}`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, defaultSessionTimeout, cfg.SessionTimeout)
+
+	cfg = &Config{}
+	err = yaml.Unmarshal([]byte(`session_timeout: 60`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, time.Minute, cfg.SessionTimeout)
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+type discoInfoProvider struct {
+	adHoc *AdHoc
+}
+
+func (p *discoInfoProvider) Identities(_ context.Context, toJID, fromJID *jid.JID, node string) []xep0030.Identity {
+	if node == Namespace {
+		return []xep0030.Identity{{Category: "automation", Type: "command-list"}}
+	}
+	cmd := p.adHoc.command(node)
+	if cmd == nil || !cmd.IsAllowed(fromJID, toJID) {
+		return nil
+	}
+	return []xep0030.Identity{{Category: "automation", Type: "command-node", Name: cmd.Name()}}
+}
+
+func (p *discoInfoProvider) Features(_ context.Context, toJID, fromJID *jid.JID, node string) ([]xep0030.Feature, *xmpp.StanzaError) {
+	if node == Namespace {
+		return []xep0030.Feature{Namespace}, nil
+	}
+	cmd := p.adHoc.command(node)
+	if cmd == nil {
+		return nil, nil
+	}
+	if !cmd.IsAllowed(fromJID, toJID) {
+		return nil, xmpp.ErrForbidden
+	}
+	return []xep0030.Feature{Namespace, xep0004.FormNamespace}, nil
+}
+
+func (p *discoInfoProvider) Form(_ context.Context, _, _ *jid.JID, _ string) (*xep0004.DataForm, *xmpp.StanzaError) {
+	return nil, nil
+}
+
+func (p *discoInfoProvider) Items(_ context.Context, toJID, fromJID *jid.JID, node string) ([]xep0030.Item, *xmpp.StanzaError) {
+	if node != Namespace {
+		return nil, nil
+	}
+	var items []xep0030.Item
+	for _, cmd := range p.adHoc.allowedCommands(fromJID, toJID) {
+		items = append(items, xep0030.Item{Jid: toJID.String(), Node: cmd.Node(), Name: cmd.Name()})
+	}
+	return items, nil
+}
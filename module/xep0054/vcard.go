@@ -7,6 +7,7 @@ package xep0054
 
 import (
 	"context"
+	"sync"
 
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/module/xep0030"
@@ -14,22 +15,28 @@ import (
 	"github.com/ortuman/jackal/storage/repository"
 	"github.com/ortuman/jackal/util/runqueue"
 	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
 )
 
 const vCardNamespace = "vcard-temp"
 
+// UpdateHandler is invoked every time a user stores a new vCard.
+type UpdateHandler func(ctx context.Context, userJID *jid.JID, vCard xmpp.XElement)
+
 // VCard represents a vCard server stream module.
 type VCard struct {
-	router   router.Router
-	runQueue *runqueue.RunQueue
-	rep      repository.VCard
+	router     router.Router
+	runQueue   *runqueue.ShardedRunQueue
+	rep        repository.VCard
+	handlersMu sync.RWMutex
+	handlers   []UpdateHandler
 }
 
 // New returns a vCard IQ handler module.
 func New(disco *xep0030.DiscoInfo, router router.Router, rep repository.VCard) *VCard {
 	v := &VCard{
 		router:   router,
-		runQueue: runqueue.New("xep0054"),
+		runQueue: runqueue.NewSharded("xep0054", 0),
 		rep:      rep,
 	}
 	if disco != nil {
@@ -47,11 +54,27 @@ func (x *VCard) MatchesIQ(iq *xmpp.IQ) bool {
 
 // ProcessIQ processes a vCard IQ taking according actions over the associated stream.
 func (x *VCard) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
-	x.runQueue.Run(func() {
+	x.runQueue.Run(iq.FromJID().ToBareJID().String(), func() {
 		x.processIQ(ctx, iq)
 	})
 }
 
+// RegisterUpdateHandler registers a handler to be invoked whenever a user updates its own vCard.
+func (x *VCard) RegisterUpdateHandler(h UpdateHandler) {
+	x.handlersMu.Lock()
+	x.handlers = append(x.handlers, h)
+	x.handlersMu.Unlock()
+}
+
+// UpdateVCard stores a user vCard on behalf of another module, invoking all registered update handlers.
+func (x *VCard) UpdateVCard(ctx context.Context, userJID *jid.JID, vCard xmpp.XElement) error {
+	if err := x.rep.UpsertVCard(ctx, vCard, userJID.ToBareJID().String()); err != nil {
+		return err
+	}
+	x.runUpdateHandlers(ctx, userJID.ToBareJID(), vCard)
+	return nil
+}
+
 // Shutdown shuts down vCard module.
 func (x *VCard) Shutdown() error {
 	c := make(chan struct{})
@@ -80,7 +103,7 @@ func (x *VCard) getVCard(ctx context.Context, vCard xmpp.XElement, iq *xmpp.IQ)
 		return
 	}
 	toJID := iq.ToJID()
-	resElem, err := x.rep.FetchVCard(ctx, toJID.Node())
+	resElem, err := x.rep.FetchVCard(ctx, toJID.ToBareJID().String())
 	if err != nil {
 		log.Errorf("%v", err)
 		_ = x.router.Route(ctx, iq.InternalServerError())
@@ -104,15 +127,28 @@ func (x *VCard) setVCard(ctx context.Context, vCard xmpp.XElement, iq *xmpp.IQ)
 	if toJID.IsServer() || (toJID.Node() == fromJID.Node()) {
 		log.Infof("saving vcard... (jid: %s)", toJID.String())
 
-		err := x.rep.UpsertVCard(ctx, vCard, toJID.Node())
+		err := x.rep.UpsertVCard(ctx, vCard, toJID.ToBareJID().String())
 		if err != nil {
 			log.Error(err)
 			_ = x.router.Route(ctx, iq.InternalServerError())
 			return
 
 		}
+		if !toJID.IsServer() {
+			x.runUpdateHandlers(ctx, toJID.ToBareJID(), vCard)
+		}
 		_ = x.router.Route(ctx, iq.ResultIQ())
 	} else {
 		_ = x.router.Route(ctx, iq.ForbiddenError())
 	}
 }
+
+func (x *VCard) runUpdateHandlers(ctx context.Context, userJID *jid.JID, vCard xmpp.XElement) {
+	x.handlersMu.RLock()
+	handlers := x.handlers
+	x.handlersMu.RUnlock()
+
+	for _, h := range handlers {
+		h(ctx, userJID, vCard)
+	}
+}
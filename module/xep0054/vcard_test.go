@@ -85,6 +85,41 @@ func TestXEP0054_Set(t *testing.T) {
 	require.Equal(t, iq2ID, elem.ID())
 }
 
+func TestXEP0054_UpdateHandler(t *testing.T) {
+	r, s := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+
+	r.Bind(context.Background(), stm)
+
+	x := New(nil, r, s)
+	defer func() { _ = x.Shutdown() }()
+
+	var updatedJID *jid.JID
+	var updatedVCard xmpp.XElement
+	x.RegisterUpdateHandler(func(_ context.Context, userJID *jid.JID, vCard xmpp.XElement) {
+		updatedJID = userJID
+		updatedVCard = vCard
+	})
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(testVCard())
+
+	x.ProcessIQ(context.Background(), iq)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	require.NotNil(t, updatedJID)
+	require.Equal(t, "ortuman@jackal.im", updatedJID.String())
+	require.NotNil(t, updatedVCard)
+	require.Equal(t, "Forrest Gump", updatedVCard.Elements().Child("FN").Text())
+}
+
 func TestXEP0054_SetError(t *testing.T) {
 	r, s := setupTest("jackal.im")
 
@@ -235,7 +270,7 @@ func setupTest(domain string) (router.Router, *memorystorage.VCard) {
 	s := memorystorage.NewVCard()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList()),
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
 		nil,
 	)
 	return r, s
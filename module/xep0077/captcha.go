@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0077
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/pborman/uuid"
+)
+
+const captchaNamespace = "urn:xmpp:captcha"
+
+const xep077CaptchaCtxKey = "xep0077:captcha"
+
+const captchaInstructions = "Solve the question below to complete your registration."
+
+// captchaChallenge represents a XEP-0158 question/answer challenge.
+type captchaChallenge struct {
+	id       string
+	question string
+	answer   string
+}
+
+func newCaptchaChallenge() *captchaChallenge {
+	a, b := randomInt(10)+1, randomInt(10)+1
+	return &captchaChallenge{
+		id:       uuid.New(),
+		question: fmt.Sprintf("What is %d plus %d?", a, b),
+		answer:   strconv.Itoa(a + b),
+	}
+}
+
+// form returns a registration data form including the challenge question.
+func (c *captchaChallenge) form(domain string) *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Type:         xep0004.Form,
+		Instructions: captchaInstructions,
+		Fields: xep0004.Fields{
+			{Var: xep0004.FormType, Type: xep0004.Hidden, Values: []string{captchaNamespace}},
+			{Var: "from", Type: xep0004.Hidden, Values: []string{domain}},
+			{Var: "challenge", Type: xep0004.Hidden, Values: []string{c.id}},
+			{Var: "username", Type: xep0004.TextSingle, Label: "Username", Required: true},
+			{Var: "password", Type: xep0004.TextPrivate, Label: "Password", Required: true},
+			{Var: "qa", Type: xep0004.TextSingle, Label: c.question, Required: true},
+		},
+	}
+}
+
+// verify checks a submitted form against the challenge.
+func (c *captchaChallenge) verify(form *xep0004.DataForm) bool {
+	if form == nil || form.Fields.ValueForField("challenge") != c.id {
+		return false
+	}
+	return strings.TrimSpace(form.Fields.ValueForField("qa")) == c.answer
+}
+
+func randomInt(max int64) int {
+	n, err := rand.Int(rand.Reader, big.NewInt(max))
+	if err != nil {
+		return 0
+	}
+	return int(n.Int64())
+}
+
+func submittedForm(query xmpp.XElement) *xep0004.DataForm {
+	x := query.Elements().ChildNamespace("x", xep0004.FormNamespace)
+	if x == nil {
+		return nil
+	}
+	form, err := xep0004.NewFormFromElement(x)
+	if err != nil || form.Type != xep0004.Submit {
+		return nil
+	}
+	return form
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0077
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const defaultIPQuotaPeriod = time.Hour
+
+// Config represents XMPP In-Band Registration module (XEP-0077) configuration.
+type Config struct {
+	AllowRegistration bool
+	AllowChange       bool
+	AllowCancel       bool
+
+	// Captcha requires new accounts to solve a XEP-0158 data form challenge.
+	Captcha bool
+
+	// InvitationOnly restricts registration to entities presenting a valid preauth token (XEP-0401).
+	InvitationOnly bool
+
+	// MaxRegistrationsPerIP limits the number of accounts that can be registered
+	// from a single IP address within IPQuotaPeriod.
+	MaxRegistrationsPerIP int
+	IPQuotaPeriod         time.Duration
+
+	UsernameBlacklist  []string
+	UsernameRegex      *regexp.Regexp
+	PasswordMinLength  int
+	PasswordMinClasses int
+}
+
+type configProxy struct {
+	AllowRegistration     bool     `yaml:"allow_registration"`
+	AllowChange           bool     `yaml:"allow_change"`
+	AllowCancel           bool     `yaml:"allow_cancel"`
+	Captcha               bool     `yaml:"captcha"`
+	InvitationOnly        bool     `yaml:"invitation_only"`
+	MaxRegistrationsPerIP int      `yaml:"max_registrations_per_ip"`
+	IPQuotaPeriod         int      `yaml:"ip_quota_period"`
+	UsernameBlacklist     []string `yaml:"username_blacklist"`
+	UsernameRegex         string   `yaml:"username_regex"`
+	PasswordMinLength     int      `yaml:"password_min_length"`
+	PasswordMinClasses    int      `yaml:"password_min_classes"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.MaxRegistrationsPerIP < 0 || p.IPQuotaPeriod < 0 || p.PasswordMinLength < 0 {
+		return fmt.Errorf("xep0077.Config: quota and length values must be positive")
+	}
+	if p.PasswordMinClasses < 0 || p.PasswordMinClasses > passwordCharClasses {
+		return fmt.Errorf("xep0077.Config: password min classes must be between 0 and %d", passwordCharClasses)
+	}
+	cfg.AllowRegistration = p.AllowRegistration
+	cfg.AllowChange = p.AllowChange
+	cfg.AllowCancel = p.AllowCancel
+	cfg.Captcha = p.Captcha
+	cfg.InvitationOnly = p.InvitationOnly
+	cfg.MaxRegistrationsPerIP = p.MaxRegistrationsPerIP
+	cfg.IPQuotaPeriod = time.Duration(p.IPQuotaPeriod) * time.Second
+	if cfg.IPQuotaPeriod == 0 {
+		cfg.IPQuotaPeriod = defaultIPQuotaPeriod
+	}
+	cfg.UsernameBlacklist = p.UsernameBlacklist
+	cfg.UsernameRegex = nil
+	if len(p.UsernameRegex) > 0 {
+		re, err := regexp.Compile(p.UsernameRegex)
+		if err != nil {
+			return fmt.Errorf("xep0077.Config: invalid username regex: %v", err)
+		}
+		cfg.UsernameRegex = re
+	}
+	cfg.PasswordMinLength = p.PasswordMinLength
+	cfg.PasswordMinClasses = p.PasswordMinClasses
+	return nil
+}
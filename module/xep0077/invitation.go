@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0077
+
+import (
+	"context"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/pborman/uuid"
+)
+
+const preauthNamespace = "urn:xmpp:pars:0"
+
+const xep077PreauthCtxKey = "xep0077:preauth"
+
+// invitations represents the set of currently issued registration tokens.
+// Tokens are persisted so that they survive server restarts and can be spent on any cluster node.
+type invitations struct {
+	rep   repository.Invitations
+	nowFn func() time.Time
+}
+
+func newInvitations(rep repository.Invitations) *invitations {
+	return &invitations{rep: rep, nowFn: time.Now}
+}
+
+func (i *invitations) issue(ctx context.Context, username string, ttl time.Duration) (*model.Invitation, error) {
+	inv := &model.Invitation{
+		Token:    uuid.New(),
+		Username: username,
+		Expires:  i.nowFn().Add(ttl),
+	}
+	if err := i.rep.InsertInvitation(ctx, inv); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (i *invitations) get(ctx context.Context, token string) (*model.Invitation, error) {
+	inv, err := i.rep.FetchInvitation(ctx, token)
+	if err != nil || inv == nil {
+		return nil, err
+	}
+	if inv.IsExpired(i.nowFn()) {
+		_, err := i.rep.DeleteInvitation(ctx, token)
+		return nil, err
+	}
+	return inv, nil
+}
+
+// consume validates an invitation token against the username to be registered,
+// removing it so it can't be used again.
+func (i *invitations) consume(ctx context.Context, token, username string) (*model.Invitation, error) {
+	inv, err := i.get(ctx, token)
+	if err != nil || inv == nil {
+		return nil, err
+	}
+	if len(inv.Username) > 0 && inv.Username != username {
+		return nil, nil
+	}
+	deleted, err := i.rep.DeleteInvitation(ctx, token)
+	if err != nil || !deleted {
+		return nil, err // already spent elsewhere
+	}
+	return inv, nil
+}
+
+// restore gives back a consumed invitation whose registration could not be completed.
+func (i *invitations) restore(ctx context.Context, inv *model.Invitation) error {
+	return i.rep.InsertInvitation(ctx, inv)
+}
+
+func (i *invitations) revoke(ctx context.Context, token string) (bool, error) {
+	inv, err := i.get(ctx, token)
+	if err != nil || inv == nil {
+		return false, err
+	}
+	return i.rep.DeleteInvitation(ctx, token)
+}
+
+func (i *invitations) list(ctx context.Context) ([]model.Invitation, error) {
+	invs, err := i.rep.FetchInvitations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := i.nowFn()
+
+	var ret []model.Invitation
+	for _, inv := range invs {
+		if inv.IsExpired(now) {
+			if _, err := i.rep.DeleteInvitation(ctx, inv.Token); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		ret = append(ret, inv)
+	}
+	return ret, nil
+}
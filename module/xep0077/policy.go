@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0077
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// number of character classes taken into account when evaluating password strength
+// (lowercase, uppercase, digits and symbols)
+const passwordCharClasses = 4
+
+func (x *Register) isValidUsername(username string) bool {
+	for _, banned := range x.cfg.UsernameBlacklist {
+		if strings.EqualFold(banned, username) {
+			return false
+		}
+	}
+	if re := x.cfg.UsernameRegex; re != nil && !re.MatchString(username) {
+		return false
+	}
+	return true
+}
+
+func (x *Register) isValidPassword(password string) bool {
+	if utf8.RuneCountInString(password) < x.cfg.PasswordMinLength {
+		return false
+	}
+	if x.cfg.PasswordMinClasses == 0 {
+		return true
+	}
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower+upper+digit+other >= x.cfg.PasswordMinClasses
+}
+
+// ipQuota keeps track of successful registrations per remote address
+// over a sliding time window.
+type ipQuota struct {
+	mu     sync.Mutex
+	max    int
+	period time.Duration
+	regs   map[string][]time.Time
+	nowFn  func() time.Time
+}
+
+func newIPQuota(max int, period time.Duration) *ipQuota {
+	return &ipQuota{
+		max:    max,
+		period: period,
+		regs:   make(map[string][]time.Time),
+		nowFn:  time.Now,
+	}
+}
+
+func (q *ipQuota) exceeded(ip string) bool {
+	if q.max == 0 || len(ip) == 0 {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.recent(ip)) >= q.max
+}
+
+func (q *ipQuota) register(ip string) {
+	if q.max == 0 || len(ip) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.regs[ip] = append(q.recent(ip), q.nowFn())
+}
+
+func (q *ipQuota) recent(ip string) []time.Time {
+	now := q.nowFn()
+	regs := q.regs[ip]
+	i := 0
+	for ; i < len(regs); i++ {
+		if now.Sub(regs[i]) < q.period {
+			break
+		}
+	}
+	regs = regs[i:]
+	if len(regs) == 0 {
+		delete(q.regs, ip)
+	} else {
+		q.regs[ip] = regs
+	}
+	return regs
+}
+
+func hostFromAddr(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	if a, ok := addr.(*net.TCPAddr); ok {
+		return a.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
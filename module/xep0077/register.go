@@ -7,7 +7,10 @@ package xep0077
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	streamerror "github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/module/xep0030"
@@ -23,28 +26,36 @@ const registerNamespace = "jabber:iq:register"
 
 const xep077RegisteredCtxKey = "xep0077:registered"
 
-// Config represents XMPP In-Band Registration module (XEP-0077) configuration.
-type Config struct {
-	AllowRegistration bool `yaml:"allow_registration"`
-	AllowChange       bool `yaml:"allow_change"`
-	AllowCancel       bool `yaml:"allow_cancel"`
+// AccountRemover defines the operation used to delete a user account along with all its associated data.
+type AccountRemover interface {
+	DeleteAccount(ctx context.Context, userJID *jid.JID) error
 }
 
 // Register represents an in-band server stream module.
 type Register struct {
-	cfg      *Config
-	router   router.Router
-	runQueue *runqueue.RunQueue
-	rep      repository.User
+	cfg         *Config
+	router      router.Router
+	runQueue    *runqueue.ShardedRunQueue
+	rep         repository.User
+	accRemover  AccountRemover
+	quota       *ipQuota
+	invitations *invitations
+
+	mu          sync.Mutex
+	registering map[string]struct{}
 }
 
 // New returns an in-band registration IQ handler.
-func New(config *Config, disco *xep0030.DiscoInfo, router router.Router, userRep repository.User) *Register {
+func New(config *Config, disco *xep0030.DiscoInfo, router router.Router, userRep repository.User, invitationsRep repository.Invitations, accRemover AccountRemover) *Register {
 	r := &Register{
-		cfg:      config,
-		router:   router,
-		runQueue: runqueue.New("xep0077"),
-		rep:      userRep,
+		cfg:         config,
+		router:      router,
+		runQueue:    runqueue.NewSharded("xep0077", 0),
+		rep:         userRep,
+		accRemover:  accRemover,
+		quota:       newIPQuota(config.MaxRegistrationsPerIP, config.IPQuotaPeriod),
+		invitations: newInvitations(invitationsRep),
+		registering: make(map[string]struct{}),
 	}
 	if disco != nil {
 		disco.RegisterServerFeature(registerNamespace)
@@ -54,13 +65,31 @@ func New(config *Config, disco *xep0030.DiscoInfo, router router.Router, userRep
 
 // MatchesIQ returns whether or not an IQ should be processed by the in-band registration module.
 func (x *Register) MatchesIQ(iq *xmpp.IQ) bool {
-	return iq.Elements().ChildNamespace("query", registerNamespace) != nil
+	return iq.Elements().ChildNamespace("query", registerNamespace) != nil ||
+		iq.Elements().ChildNamespace("preauth", preauthNamespace) != nil
+}
+
+// IssueInvitation issues a new registration token valid for ttl.
+// If username is not empty the token can only be used to register that account.
+func (x *Register) IssueInvitation(ctx context.Context, username string, ttl time.Duration) (*model.Invitation, error) {
+	return x.invitations.issue(ctx, username, ttl)
+}
+
+// Invitations returns all currently valid registration tokens.
+func (x *Register) Invitations(ctx context.Context) ([]model.Invitation, error) {
+	return x.invitations.list(ctx)
+}
+
+// RevokeInvitation invalidates a previously issued registration token.
+// It returns false if the token was not found or had already expired.
+func (x *Register) RevokeInvitation(ctx context.Context, token string) (bool, error) {
+	return x.invitations.revoke(ctx, token)
 }
 
 // ProcessIQ processes an in-band registration IQ taking according actions over the associated stream.
 func (x *Register) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
-	x.runQueue.Run(func() {
-		if stm := x.router.LocalStream(iq.FromJID().Node(), iq.FromJID().Resource()); stm != nil {
+	x.runQueue.Run(iq.FromJID().ToBareJID().String(), func() {
+		if stm := x.router.LocalStream(iq.FromJID()); stm != nil {
 			x.processIQ(ctx, iq, stm)
 		}
 	})
@@ -68,7 +97,8 @@ func (x *Register) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
 
 // ProcessIQWithStream processes an in-band registration IQ taking according actions over a referenced stream.
 func (x *Register) ProcessIQWithStream(ctx context.Context, iq *xmpp.IQ, stm stream.C2S) {
-	x.runQueue.Run(func() {
+	// sequence unauthenticated requests per remote address to keep registration quotas consistent
+	x.runQueue.Run(hostFromAddr(stm.RemoteAddr()), func() {
 		x.processIQ(ctx, iq, stm)
 	})
 }
@@ -86,6 +116,10 @@ func (x *Register) processIQ(ctx context.Context, iq *xmpp.IQ, stm stream.C2S) {
 		stm.SendElement(ctx, iq.ForbiddenError())
 		return
 	}
+	if preauth := iq.Elements().ChildNamespace("preauth", preauthNamespace); preauth != nil {
+		x.processPreauth(ctx, iq, preauth, stm)
+		return
+	}
 	q := iq.Elements().ChildNamespace("query", registerNamespace)
 	if !stm.IsAuthenticated() {
 		if iq.IsGet() {
@@ -133,20 +167,117 @@ func (x *Register) sendRegistrationFields(ctx context.Context, iq *xmpp.IQ, quer
 	}
 	result := iq.ResultIQ()
 	q := xmpp.NewElementNamespace("query", registerNamespace)
-	q.AppendElement(xmpp.NewElementName("username"))
-	q.AppendElement(xmpp.NewElementName("password"))
+	if x.cfg.Captcha {
+		challenge := newCaptchaChallenge()
+		stm.SetValue(xep077CaptchaCtxKey, challenge)
+
+		instructions := xmpp.NewElementName("instructions")
+		instructions.SetText(captchaInstructions)
+		q.AppendElement(instructions)
+		q.AppendElement(xmpp.NewElementName("username"))
+		q.AppendElement(xmpp.NewElementName("password"))
+		q.AppendElement(challenge.form(stm.Domain()).Element())
+	} else {
+		q.AppendElement(xmpp.NewElementName("username"))
+		q.AppendElement(xmpp.NewElementName("password"))
+	}
 	result.AppendElement(q)
 	stm.SendElement(ctx, result)
 }
 
+func (x *Register) processPreauth(ctx context.Context, iq *xmpp.IQ, preauth xmpp.XElement, stm stream.C2S) {
+	if !iq.IsSet() || stm.IsAuthenticated() {
+		stm.SendElement(ctx, iq.BadRequestError())
+		return
+	}
+	if !x.cfg.AllowRegistration {
+		stm.SendElement(ctx, iq.NotAllowedError())
+		return
+	}
+	token := preauth.Attributes().Get("token")
+	inv, err := x.invitations.get(ctx, token)
+	if err != nil {
+		log.Error(err)
+		stm.SendElement(ctx, iq.InternalServerError())
+		return
+	}
+	if inv == nil {
+		stm.SendElement(ctx, iq.ItemNotFoundError())
+		return
+	}
+	stm.SetValue(xep077PreauthCtxKey, token)
+	stm.SendElement(ctx, iq.ResultIQ())
+}
+
 func (x *Register) registerNewUser(ctx context.Context, iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S) {
-	userEl := query.Elements().Child("username")
-	passwordEl := query.Elements().Child("password")
-	if userEl == nil || passwordEl == nil || len(userEl.Text()) == 0 || len(passwordEl.Text()) == 0 {
+	if !x.cfg.AllowRegistration {
+		stm.SendElement(ctx, iq.NotAllowedError())
+		return
+	}
+	var username, password string
+	form := submittedForm(query)
+	if form != nil {
+		username = form.Fields.ValueForField("username")
+		password = form.Fields.ValueForField("password")
+	} else {
+		if userEl := query.Elements().Child("username"); userEl != nil {
+			username = userEl.Text()
+		}
+		if passwordEl := query.Elements().Child("password"); passwordEl != nil {
+			password = passwordEl.Text()
+		}
+	}
+	if len(username) == 0 || len(password) == 0 {
 		stm.SendElement(ctx, iq.BadRequestError())
 		return
 	}
-	exists, err := x.rep.UserExists(ctx, userEl.Text())
+	if x.cfg.Captcha {
+		// challenges are single use
+		challenge, _ := stm.Value(xep077CaptchaCtxKey).(*captchaChallenge)
+		stm.SetValue(xep077CaptchaCtxKey, nil)
+
+		if challenge == nil || !challenge.verify(form) {
+			stm.SendElement(ctx, iq.NotAcceptableError())
+			return
+		}
+	}
+	token, _ := stm.Value(xep077PreauthCtxKey).(string)
+	if x.cfg.InvitationOnly {
+		inv, err := x.invitations.get(ctx, token)
+		if err != nil {
+			log.Error(err)
+			stm.SendElement(ctx, iq.InternalServerError())
+			return
+		}
+		if inv == nil {
+			stm.SendElement(ctx, iq.NotAllowedError())
+			return
+		}
+		if len(inv.Username) > 0 && inv.Username != username {
+			stm.SendElement(ctx, iq.NotAcceptableError())
+			return
+		}
+	}
+	ip := hostFromAddr(stm.RemoteAddr())
+	if x.quota.exceeded(ip) {
+		log.Warnf("xep0077: registration quota exceeded... (ip: %s)", ip)
+		stm.SendElement(ctx, iq.ResourceConstraintError())
+		return
+	}
+	if !x.isValidUsername(username) || !x.isValidPassword(password) {
+		stm.SendElement(ctx, iq.NotAcceptableError())
+		return
+	}
+	// requests are sequenced per remote address, so concurrent registrations
+	// of the same account coming from different addresses must be serialized here
+	userJID := model.BareJID(username, stm.Domain())
+	if !x.reserve(userJID) {
+		stm.SendElement(ctx, iq.ConflictError())
+		return
+	}
+	defer x.release(userJID)
+
+	exists, err := x.rep.UserExists(ctx, userJID)
 	if err != nil {
 		log.Error(err)
 		stm.SendElement(ctx, iq.InternalServerError())
@@ -156,16 +287,37 @@ func (x *Register) registerNewUser(ctx context.Context, iq *xmpp.IQ, query xmpp.
 		stm.SendElement(ctx, iq.ConflictError())
 		return
 	}
+	var inv *model.Invitation
+	if len(token) > 0 {
+		// consume invitation before creating the account so that it can't be spent twice
+		inv, err = x.invitations.consume(ctx, token, username)
+		if err != nil {
+			log.Error(err)
+			stm.SendElement(ctx, iq.InternalServerError())
+			return
+		}
+		if inv == nil && x.cfg.InvitationOnly {
+			stm.SendElement(ctx, iq.NotAllowedError())
+			return
+		}
+	}
 	user := model.User{
-		Username:     userEl.Text(),
-		Password:     passwordEl.Text(),
+		Username:     username,
+		Domain:       stm.Domain(),
+		Password:     password,
 		LastPresence: xmpp.NewPresence(stm.JID(), stm.JID(), xmpp.UnavailableType),
 	}
 	if err := x.rep.UpsertUser(ctx, &user); err != nil {
+		if inv != nil {
+			if err := x.invitations.restore(ctx, inv); err != nil {
+				log.Error(err)
+			}
+		}
 		log.Error(err)
 		stm.SendElement(ctx, iq.InternalServerError())
 		return
 	}
+	x.quota.register(ip)
 	stm.SendElement(ctx, iq.ResultIQ())
 	stm.SetValue(xep077RegisteredCtxKey, true) // mark as registered
 }
@@ -179,12 +331,19 @@ func (x *Register) cancelRegistration(ctx context.Context, iq *xmpp.IQ, query xm
 		stm.SendElement(ctx, iq.BadRequestError())
 		return
 	}
-	if err := x.rep.DeleteUser(ctx, stm.Username()); err != nil {
+	if err := x.accRemover.DeleteAccount(ctx, stm.JID()); err != nil {
 		log.Error(err)
 		stm.SendElement(ctx, iq.InternalServerError())
 		return
 	}
 	stm.SendElement(ctx, iq.ResultIQ())
+
+	// close any other session bound to the removed account
+	for _, userStm := range x.router.LocalStreams(stm.JID()) {
+		if userStm != stm {
+			userStm.Disconnect(ctx, streamerror.ErrNotAuthorized)
+		}
+	}
 }
 
 func (x *Register) changePassword(ctx context.Context, password string, username string, iq *xmpp.IQ, stm stream.C2S) {
@@ -201,7 +360,11 @@ func (x *Register) changePassword(ctx context.Context, password string, username
 		stm.SendElement(ctx, iq.NotAuthorizedError())
 		return
 	}
-	user, err := x.rep.FetchUser(ctx, username)
+	if !x.isValidPassword(password) {
+		stm.SendElement(ctx, iq.NotAcceptableError())
+		return
+	}
+	user, err := x.rep.FetchUser(ctx, model.BareJID(username, stm.Domain()))
 	if err != nil {
 		log.Error(err)
 		stm.SendElement(ctx, iq.InternalServerError())
@@ -222,6 +385,22 @@ func (x *Register) changePassword(ctx context.Context, password string, username
 	stm.SendElement(ctx, iq.ResultIQ())
 }
 
+func (x *Register) reserve(userJID string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if _, ok := x.registering[userJID]; ok {
+		return false
+	}
+	x.registering[userJID] = struct{}{}
+	return true
+}
+
+func (x *Register) release(userJID string) {
+	x.mu.Lock()
+	delete(x.registering, userJID)
+	x.mu.Unlock()
+}
+
 func (x *Register) isValidToJid(j *jid.JID, stm stream.C2S) bool {
 	if stm.IsAuthenticated() && (j.IsBare() && j.Node() != stm.Username()) {
 		return false
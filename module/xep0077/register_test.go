@@ -8,19 +8,25 @@ package xep0077
 import (
 	"context"
 	"crypto/tls"
+	"net"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/ortuman/jackal/router/host"
 
 	c2srouter "github.com/ortuman/jackal/c2s/router"
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0004"
 	"github.com/ortuman/jackal/router"
 	memorystorage "github.com/ortuman/jackal/storage/memory"
+	"github.com/ortuman/jackal/storage/repository"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
 func TestXEP0077_Matching(t *testing.T) {
@@ -28,7 +34,7 @@ func TestXEP0077_Matching(t *testing.T) {
 
 	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
 
-	x := New(&Config{}, nil, r, s)
+	x := New(&Config{}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
 	defer func() { _ = x.Shutdown() }()
 
 	// test MatchesIQ
@@ -49,7 +55,7 @@ func TestXEP0077_InvalidToJID(t *testing.T) {
 	stm1 := stream.NewMockC2S(uuid.New(), j1)
 	r.Bind(context.Background(), stm1)
 
-	x := New(&Config{}, nil, r, s)
+	x := New(&Config{}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
 	defer func() { _ = x.Shutdown() }()
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
@@ -74,7 +80,7 @@ func TestXEP0077_NotAuthenticatedErrors(t *testing.T) {
 	stm := stream.NewMockC2S(uuid.New(), j)
 	r.Bind(context.Background(), stm)
 
-	x := New(&Config{}, nil, r, s)
+	x := New(&Config{}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
 	defer func() { _ = x.Shutdown() }()
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.ResultType)
@@ -91,7 +97,7 @@ func TestXEP0077_NotAuthenticatedErrors(t *testing.T) {
 	require.Equal(t, xmpp.ErrNotAllowed.Error(), elem.Error().Elements().All()[0].Name())
 
 	// allow registration...
-	x = New(&Config{AllowRegistration: true}, nil, r, s)
+	x = New(&Config{AllowRegistration: true}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
 	defer func() { _ = x.Shutdown() }()
 
 	q := xmpp.NewElementNamespace("query", registerNamespace)
@@ -122,7 +128,7 @@ func TestXEP0077_AuthenticatedErrors(t *testing.T) {
 
 	stm.SetAuthenticated(true)
 
-	x := New(&Config{}, nil, r, s)
+	x := New(&Config{}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
 	defer func() { _ = x.Shutdown() }()
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.ResultType)
@@ -150,7 +156,7 @@ func TestXEP0077_RegisterUser(t *testing.T) {
 	stm := stream.NewMockC2S(uuid.New(), j)
 	r.Bind(context.Background(), stm)
 
-	x := New(&Config{AllowRegistration: true}, nil, r, s)
+	x := New(&Config{AllowRegistration: true}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
 	defer func() { _ = x.Shutdown() }()
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
@@ -177,7 +183,7 @@ func TestXEP0077_RegisterUser(t *testing.T) {
 	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
 
 	// already existing user...
-	_ = s.UpsertUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"})
+	_ = s.UpsertUser(context.Background(), &model.User{Username: "ortuman", Domain: "jackal.im", Password: "1234"})
 	username.SetText("ortuman")
 	password.SetText("5678")
 	x.ProcessIQ(context.Background(), iq)
@@ -196,7 +202,7 @@ func TestXEP0077_RegisterUser(t *testing.T) {
 	elem = stm.ReceiveElement()
 	require.Equal(t, xmpp.ResultType, elem.Type())
 
-	usr, _ := s.FetchUser(context.Background(), "ortuman")
+	usr, _ := s.FetchUser(context.Background(), "ortuman@jackal.im")
 	require.NotNil(t, usr)
 }
 
@@ -211,10 +217,10 @@ func TestXEP0077_CancelRegistration(t *testing.T) {
 
 	stm.SetAuthenticated(true)
 
-	x := New(&Config{}, nil, r, s)
+	x := New(&Config{}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
 	defer func() { _ = x.Shutdown() }()
 
-	_ = s.UpsertUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"})
+	_ = s.UpsertUser(context.Background(), &model.User{Username: "ortuman", Domain: "jackal.im", Password: "1234"})
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
 	iq.SetFromJID(j)
@@ -228,7 +234,7 @@ func TestXEP0077_CancelRegistration(t *testing.T) {
 	elem := stm.ReceiveElement()
 	require.Equal(t, xmpp.ErrNotAllowed.Error(), elem.Error().Elements().All()[0].Name())
 
-	x = New(&Config{AllowCancel: true}, nil, r, s)
+	x = New(&Config{AllowCancel: true}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
 	defer func() { _ = x.Shutdown() }()
 
 	q.AppendElement(xmpp.NewElementName("remove2"))
@@ -249,7 +255,7 @@ func TestXEP0077_CancelRegistration(t *testing.T) {
 	elem = stm.ReceiveElement()
 	require.Equal(t, xmpp.ResultType, elem.Type())
 
-	usr, _ := s.FetchUser(context.Background(), "ortuman")
+	usr, _ := s.FetchUser(context.Background(), "ortuman@jackal.im")
 	require.Nil(t, usr)
 }
 
@@ -264,10 +270,10 @@ func TestXEP0077_ChangePassword(t *testing.T) {
 
 	stm.SetAuthenticated(true)
 
-	x := New(&Config{}, nil, r, s)
+	x := New(&Config{}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
 	defer func() { _ = x.Shutdown() }()
 
-	_ = s.UpsertUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"})
+	_ = s.UpsertUser(context.Background(), &model.User{Username: "ortuman", Domain: "jackal.im", Password: "1234"})
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
 	iq.SetFromJID(j)
@@ -286,7 +292,7 @@ func TestXEP0077_ChangePassword(t *testing.T) {
 	elem := stm.ReceiveElement()
 	require.Equal(t, xmpp.ErrNotAllowed.Error(), elem.Error().Elements().All()[0].Name())
 
-	x = New(&Config{AllowChange: true}, nil, r, s)
+	x = New(&Config{AllowChange: true}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
 	defer func() { _ = x.Shutdown() }()
 
 	x.ProcessIQ(context.Background(), iq)
@@ -312,17 +318,301 @@ func TestXEP0077_ChangePassword(t *testing.T) {
 	elem = stm.ReceiveElement()
 	require.Equal(t, xmpp.ResultType, elem.Type())
 
-	usr, _ := s.FetchUser(context.Background(), "ortuman")
+	usr, _ := s.FetchUser(context.Background(), "ortuman@jackal.im")
 	require.NotNil(t, usr)
 	require.Equal(t, "5678", usr.Password)
 }
 
+func TestXEP0077_Config(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte("{allow_registration: true, max_registrations_per_ip: 2, username_regex: \"^[a-z]+$\", password_min_classes: 2}"), &cfg)
+	require.Nil(t, err)
+	require.True(t, cfg.AllowRegistration)
+	require.Equal(t, 2, cfg.MaxRegistrationsPerIP)
+	require.Equal(t, defaultIPQuotaPeriod, cfg.IPQuotaPeriod)
+	require.NotNil(t, cfg.UsernameRegex)
+	require.Equal(t, 2, cfg.PasswordMinClasses)
+
+	err = yaml.Unmarshal([]byte("{username_regex: \"[a-z\"}"), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("{password_min_classes: 5}"), &cfg)
+	require.NotNil(t, err)
+}
+
+func TestXEP0077_RegistrationPolicies(t *testing.T) {
+	r, s := setupTest("jackal.im")
+
+	srvJid, _ := jid.New("", "jackal.im", "", true)
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	x := New(&Config{
+		AllowRegistration:     true,
+		MaxRegistrationsPerIP: 1,
+		IPQuotaPeriod:         time.Hour,
+		UsernameBlacklist:     []string{"admin"},
+		UsernameRegex:         regexp.MustCompile("^[a-z]+$"),
+		PasswordMinLength:     6,
+		PasswordMinClasses:    2,
+	}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
+	defer func() { _ = x.Shutdown() }()
+
+	register := func(username, password string) xmpp.XElement {
+		stm := stream.NewMockC2S(uuid.New(), j)
+		stm.SetRemoteAddr(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5222})
+
+		x.ProcessIQWithStream(context.Background(), tUtilRegisterIQ(j, srvJid, username, password), stm)
+		return stm.ReceiveElement()
+	}
+	elem := register("Admin", "s3cr3tpass")
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	elem = register("juliet1", "s3cr3tpass")
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	elem = register("juliet", "s3cr3") // too short
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	elem = register("juliet", "secretpass") // too weak
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	elem = register("juliet", "s3cr3tpass")
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// IP quota exceeded
+	elem = register("romeo", "s3cr3tpass")
+	require.Equal(t, xmpp.ErrResourceConstraint.Error(), elem.Error().Elements().All()[0].Name())
+
+	usr, _ := s.FetchUser(context.Background(), "romeo@jackal.im")
+	require.Nil(t, usr)
+}
+
+func TestXEP0077_IPQuota(t *testing.T) {
+	now := time.Now()
+	q := newIPQuota(2, time.Minute)
+	q.nowFn = func() time.Time { return now }
+
+	q.register("10.0.0.1")
+	require.False(t, q.exceeded("10.0.0.1"))
+	q.register("10.0.0.1")
+	require.True(t, q.exceeded("10.0.0.1"))
+	require.False(t, q.exceeded("10.0.0.2"))
+
+	now = now.Add(time.Minute)
+	require.False(t, q.exceeded("10.0.0.1"))
+	require.Len(t, q.regs, 0)
+}
+
+func TestXEP0077_Captcha(t *testing.T) {
+	r, s := setupTest("jackal.im")
+
+	srvJid, _ := jid.New("", "jackal.im", "", true)
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+
+	x := New(&Config{AllowRegistration: true, Captcha: true}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
+	defer func() { _ = x.Shutdown() }()
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJid)
+	iq.AppendElement(xmpp.NewElementNamespace("query", registerNamespace))
+
+	x.ProcessIQWithStream(context.Background(), iq, stm)
+	q := stm.ReceiveElement().Elements().ChildNamespace("query", registerNamespace)
+	require.NotNil(t, q.Elements().Child("instructions"))
+
+	form, err := xep0004.NewFormFromElement(q.Elements().ChildNamespace("x", xep0004.FormNamespace))
+	require.Nil(t, err)
+	require.Equal(t, captchaNamespace, form.Fields.ValueForFieldOfType(xep0004.FormType, xep0004.Hidden))
+
+	challengeID := form.Fields.ValueForFieldOfType("challenge", xep0004.Hidden)
+	challenge, _ := stm.Value(xep077CaptchaCtxKey).(*captchaChallenge)
+	require.NotNil(t, challenge)
+	require.Equal(t, challengeID, challenge.id)
+
+	// legacy registration is not accepted
+	x.ProcessIQWithStream(context.Background(), tUtilRegisterIQ(j, srvJid, "juliet", "1234"), stm)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// challenge already consumed
+	x.ProcessIQWithStream(context.Background(), tUtilCaptchaIQ(j, srvJid, challengeID, challenge.answer), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// wrong answer
+	stm.SetValue(xep077CaptchaCtxKey, challenge)
+	x.ProcessIQWithStream(context.Background(), tUtilCaptchaIQ(j, srvJid, challengeID, "-1"), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	stm.SetValue(xep077CaptchaCtxKey, challenge)
+	x.ProcessIQWithStream(context.Background(), tUtilCaptchaIQ(j, srvJid, challengeID, challenge.answer), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	usr, _ := s.FetchUser(context.Background(), "juliet@jackal.im")
+	require.NotNil(t, usr)
+}
+
+func TestXEP0077_Invitations(t *testing.T) {
+	r, s := setupTest("jackal.im")
+
+	srvJid, _ := jid.New("", "jackal.im", "", true)
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	x := New(&Config{AllowRegistration: true, InvitationOnly: true}, nil, r, s, memorystorage.NewInvitations(), &fakeAccountRemover{rep: s})
+	defer func() { _ = x.Shutdown() }()
+
+	ctx := context.Background()
+
+	inv, err := x.IssueInvitation(ctx, "juliet", time.Hour)
+	require.Nil(t, err)
+	invs, _ := x.Invitations(ctx)
+	require.Len(t, invs, 1)
+
+	preauthIQ := func(token string) *xmpp.IQ {
+		iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+		iq.SetFromJID(j)
+		iq.SetToJID(srvJid)
+		preauth := xmpp.NewElementNamespace("preauth", preauthNamespace)
+		preauth.SetAttribute("token", token)
+		iq.AppendElement(preauth)
+		return iq
+	}
+	require.True(t, x.MatchesIQ(preauthIQ(inv.Token)))
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+
+	// no token
+	x.ProcessIQWithStream(context.Background(), tUtilRegisterIQ(j, srvJid, "juliet", "1234"), stm)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAllowed.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessIQWithStream(context.Background(), preauthIQ("foo"), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessIQWithStream(context.Background(), preauthIQ(inv.Token), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// username reserved by the invitation
+	x.ProcessIQWithStream(context.Background(), tUtilRegisterIQ(j, srvJid, "romeo", "1234"), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// same account being concurrently registered from another address
+	require.True(t, x.reserve("juliet@jackal.im"))
+	x.ProcessIQWithStream(context.Background(), tUtilRegisterIQ(j, srvJid, "juliet", "1234"), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrConflict.Error(), elem.Error().Elements().All()[0].Name())
+	x.release("juliet@jackal.im")
+
+	// invitation is given back when account creation fails
+	x.rep = &failingUserRep{User: s}
+	x.ProcessIQWithStream(context.Background(), tUtilRegisterIQ(j, srvJid, "juliet", "1234"), stm)
+	elem = stm.ReceiveElement()
+	x.rep = s
+	require.Equal(t, xmpp.ErrInternalServerError.Error(), elem.Error().Elements().All()[0].Name())
+	invs, _ = x.Invitations(ctx)
+	require.Len(t, invs, 1)
+
+	// storage failure while validating the invitation
+	memorystorage.EnableMockedError()
+	x.ProcessIQWithStream(context.Background(), tUtilRegisterIQ(j, srvJid, "juliet", "1234"), stm)
+	elem = stm.ReceiveElement()
+	memorystorage.DisableMockedError()
+	require.Equal(t, xmpp.ErrInternalServerError.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessIQWithStream(context.Background(), tUtilRegisterIQ(j, srvJid, "juliet", "1234"), stm)
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// tokens are single use
+	invs, _ = x.Invitations(ctx)
+	require.Len(t, invs, 0)
+
+	inv, _ = x.IssueInvitation(ctx, "", time.Hour)
+	ok, _ := x.RevokeInvitation(ctx, inv.Token)
+	require.True(t, ok)
+	ok, _ = x.RevokeInvitation(ctx, inv.Token)
+	require.False(t, ok)
+
+	// expiration
+	now := time.Now()
+	x.invitations.nowFn = func() time.Time { return now }
+	inv, _ = x.IssueInvitation(ctx, "", time.Minute)
+	now = now.Add(time.Minute)
+	invs, _ = x.Invitations(ctx)
+	require.Len(t, invs, 0)
+
+	// expired tokens are purged from storage
+	stored, _ := x.invitations.rep.FetchInvitation(ctx, inv.Token)
+	require.Nil(t, stored)
+}
+
+func tUtilRegisterIQ(from, to *jid.JID, username, password string) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(to)
+
+	q := xmpp.NewElementNamespace("query", registerNamespace)
+	usernameEl := xmpp.NewElementName("username")
+	usernameEl.SetText(username)
+	passwordEl := xmpp.NewElementName("password")
+	passwordEl.SetText(password)
+	q.AppendElement(usernameEl)
+	q.AppendElement(passwordEl)
+	iq.AppendElement(q)
+	return iq
+}
+
+func tUtilCaptchaIQ(from, to *jid.JID, challengeID, answer string) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(to)
+
+	form := xep0004.DataForm{
+		Type: xep0004.Submit,
+		Fields: xep0004.Fields{
+			{Var: xep0004.FormType, Values: []string{captchaNamespace}},
+			{Var: "challenge", Values: []string{challengeID}},
+			{Var: "username", Values: []string{"juliet"}},
+			{Var: "password", Values: []string{"1234"}},
+			{Var: "qa", Values: []string{answer}},
+		},
+	}
+	q := xmpp.NewElementNamespace("query", registerNamespace)
+	q.AppendElement(form.Element())
+	iq.AppendElement(q)
+	return iq
+}
+
+type fakeAccountRemover struct {
+	rep *memorystorage.User
+}
+
+func (r *fakeAccountRemover) DeleteAccount(ctx context.Context, userJID *jid.JID) error {
+	return r.rep.DeleteUser(ctx, userJID.ToBareJID().String())
+}
+
+type failingUserRep struct {
+	repository.User
+}
+
+func (r *failingUserRep) UpsertUser(_ context.Context, _ *model.User) error {
+	return memorystorage.ErrMocked
+}
+
 func setupTest(domain string) (router.Router, *memorystorage.User) {
 	hosts, _ := host.New([]host.Config{{Name: domain, Certificate: tls.Certificate{}}})
 	userRep := memorystorage.NewUser()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(userRep, memorystorage.NewBlockList()),
+		c2srouter.New(userRep, memorystorage.NewBlockList(), nil),
 		nil,
 	)
 	return r, userRep
@@ -0,0 +1,308 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0084
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"image"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"strconv"
+
+	"github.com/ortuman/jackal/log"
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	"github.com/ortuman/jackal/module/xep0054"
+	"github.com/ortuman/jackal/module/xep0163"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/util/runqueue"
+	utilstring "github.com/ortuman/jackal/util/string"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	dataNamespace     = "urn:xmpp:avatar:data"
+	metadataNamespace = "urn:xmpp:avatar:metadata"
+
+	vCardNamespace       = "vcard-temp"
+	vCardUpdateNamespace = "vcard-temp:x:update"
+
+	// disabledItemID represents the item identifier used to publish an empty metadata element.
+	disabledItemID = "current"
+)
+
+// Avatar represents a user avatar module.
+// It keeps XEP-0084 PEP avatar nodes and vCard PHOTO element in sync, and announces
+// the current avatar hash in user presences as specified in XEP-0153.
+type Avatar struct {
+	pep       *xep0163.Pep
+	vCard     *xep0054.VCard
+	runQueue  *runqueue.ShardedRunQueue
+	vCardRep  repository.VCard
+	pubSubRep repository.PubSub
+}
+
+// New returns a user avatar module.
+func New(pep *xep0163.Pep, vCard *xep0054.VCard, vCardRep repository.VCard, pubSubRep repository.PubSub) *Avatar {
+	x := &Avatar{
+		pep:       pep,
+		vCard:     vCard,
+		runQueue:  runqueue.NewSharded("xep0084", 0),
+		vCardRep:  vCardRep,
+		pubSubRep: pubSubRep,
+	}
+	if pep != nil {
+		pep.RegisterPublishHandler(metadataNamespace, x.onMetadataPublished)
+	}
+	if vCard != nil {
+		vCard.RegisterUpdateHandler(x.onVCardUpdated)
+	}
+	return x
+}
+
+// UpdatePresence appends current user avatar hash to an available presence.
+// Presences announcing the client is not yet ready to advertise an avatar are left untouched.
+func (x *Avatar) UpdatePresence(ctx context.Context, presence *xmpp.Presence) {
+	if !presence.IsAvailable() {
+		return
+	}
+	if xu := presence.Elements().ChildNamespace("x", vCardUpdateNamespace); xu != nil && xu.Elements().Child("photo") == nil {
+		return
+	}
+	hash, err := x.storedHash(ctx, presence.FromJID().ToBareJID().String())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	photo := xmpp.NewElementName("photo")
+	photo.SetText(hash)
+	xu := xmpp.NewElementNamespace("x", vCardUpdateNamespace)
+	xu.AppendElement(photo)
+
+	presence.RemoveElementsNamespace("x", vCardUpdateNamespace)
+	presence.AppendElement(xu)
+}
+
+// Shutdown shuts down avatar module.
+func (x *Avatar) Shutdown() error {
+	c := make(chan struct{})
+	x.runQueue.Stop(func() { close(c) })
+	<-c
+	return nil
+}
+
+func (x *Avatar) onVCardUpdated(ctx context.Context, userJID *jid.JID, vCard xmpp.XElement) {
+	bareJID := userJID.ToBareJID().String()
+	x.runQueue.Run(bareJID, func() {
+		if err := x.syncFromVCard(ctx, bareJID, vCard); err != nil {
+			log.Error(err)
+		}
+	})
+}
+
+func (x *Avatar) onMetadataPublished(ctx context.Context, host string, item *pubsubmodel.Item) {
+	x.runQueue.Run(host, func() {
+		if err := x.syncFromMetadata(ctx, host, item); err != nil {
+			log.Error(err)
+		}
+	})
+}
+
+// syncFromVCard publishes vCard photo into XEP-0084 data and metadata nodes.
+func (x *Avatar) syncFromVCard(ctx context.Context, bareJID string, vCard xmpp.XElement) error {
+	data, mimeType, err := vCardPhoto(vCard)
+	if err != nil {
+		log.Warnf("avatar: invalid vCard photo encoding (jid: %s)", bareJID)
+		return nil
+	}
+	if data == nil && vCard.Elements().Child("PHOTO") != nil {
+		return nil // external photos can't be bridged
+	}
+	var hash string
+	if data != nil {
+		hash = photoHash(data)
+	}
+	currentHash, _, err := x.metadataHash(ctx, bareJID)
+	if err != nil {
+		return err
+	}
+	if currentHash != hash {
+		if len(hash) > 0 {
+			dataEl := xmpp.NewElementNamespace("data", dataNamespace)
+			dataEl.SetText(base64.StdEncoding.EncodeToString(data))
+			err := x.pep.Publish(ctx, bareJID, dataNamespace, &pubsubmodel.Item{ID: hash, Publisher: bareJID, Payload: dataEl}, nil)
+			if err != nil {
+				return err
+			}
+		}
+		metadataEl := metadataElement(hash, mimeType, data)
+		itemID := hash
+		if len(itemID) == 0 {
+			itemID = disabledItemID
+		}
+		err := x.pep.Publish(ctx, bareJID, metadataNamespace, &pubsubmodel.Item{ID: itemID, Publisher: bareJID, Payload: metadataEl}, nil)
+		if err != nil {
+			return err
+		}
+		log.Infof("avatar: published vCard photo (jid: %s, hash: %s)", bareJID, hash)
+	}
+	return nil
+}
+
+// syncFromMetadata stores the avatar announced by a XEP-0084 metadata item into the user vCard.
+func (x *Avatar) syncFromMetadata(ctx context.Context, bareJID string, item *pubsubmodel.Item) error {
+	var hash, mimeType, binVal string
+
+	if info := metadataInfo(item.Payload); info != nil {
+		hash = info.Attributes().Get("id")
+		mimeType = info.Attributes().Get("type")
+
+		items, err := x.pubSubRep.FetchNodeItemsWithIDs(ctx, bareJID, dataNamespace, []string{hash})
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 || items[0].Payload == nil {
+			log.Warnf("avatar: data item not found (jid: %s, hash: %s)", bareJID, hash)
+			return nil
+		}
+		binVal = items[0].Payload.Text()
+	}
+	vCard, err := x.vCardRep.FetchVCard(ctx, bareJID)
+	if err != nil {
+		return err
+	}
+	if vCard == nil && len(hash) == 0 {
+		return nil
+	}
+	newVCard := xmpp.NewElementNamespace("vCard", vCardNamespace)
+	if vCard != nil {
+		for _, el := range vCard.Elements().All() {
+			if el.Name() != "PHOTO" {
+				newVCard.AppendElement(el)
+			}
+		}
+	}
+	if len(hash) > 0 {
+		photo := xmpp.NewElementName("PHOTO")
+		if len(mimeType) > 0 {
+			photo.AppendElement(xmpp.NewElementName("TYPE").SetText(mimeType))
+		}
+		photo.AppendElement(xmpp.NewElementName("BINVAL").SetText(binVal))
+		newVCard.AppendElement(photo)
+	}
+	// store through vCard module so that the rest of update handlers get notified
+	userJID, err := jid.NewWithString(bareJID, true)
+	if err != nil {
+		return err
+	}
+	if err := x.vCard.UpdateVCard(ctx, userJID, newVCard); err != nil {
+		return err
+	}
+	log.Infof("avatar: updated vCard photo (jid: %s, hash: %s)", bareJID, hash)
+	return nil
+}
+
+// storedHash returns the avatar hash as found in storage, giving precedence to XEP-0084 metadata.
+func (x *Avatar) storedHash(ctx context.Context, bareJID string) (string, error) {
+	hash, ok, err := x.metadataHash(ctx, bareJID)
+	if err != nil || ok {
+		return hash, err
+	}
+	vCard, err := x.vCardRep.FetchVCard(ctx, bareJID)
+	if err != nil {
+		return "", err
+	}
+	if vCard == nil {
+		return "", nil
+	}
+	data, _, err := vCardPhoto(vCard)
+	if err != nil || data == nil {
+		return "", nil
+	}
+	return photoHash(data), nil
+}
+
+// metadataHash returns the hash announced by the last published metadata item.
+// Returned flag is false in case no metadata item has been published yet.
+func (x *Avatar) metadataHash(ctx context.Context, bareJID string) (string, bool, error) {
+	item, err := x.pubSubRep.FetchNodeLastItem(ctx, bareJID, metadataNamespace)
+	if err != nil {
+		return "", false, err
+	}
+	if item == nil {
+		return "", false, nil
+	}
+	if info := metadataInfo(item.Payload); info != nil {
+		return info.Attributes().Get("id"), true, nil
+	}
+	return "", true, nil
+}
+
+// metadataInfo returns the info element describing the PEP hosted avatar, if any.
+func metadataInfo(metadata xmpp.XElement) xmpp.XElement {
+	if metadata == nil || metadata.Name() != "metadata" || metadata.Namespace() != metadataNamespace {
+		return nil
+	}
+	for _, info := range metadata.Elements().Children("info") {
+		if len(info.Attributes().Get("url")) == 0 && len(info.Attributes().Get("id")) > 0 {
+			return info
+		}
+	}
+	return nil
+}
+
+func metadataElement(hash, mimeType string, data []byte) xmpp.XElement {
+	metadataEl := xmpp.NewElementNamespace("metadata", metadataNamespace)
+	if len(hash) == 0 {
+		return metadataEl
+	}
+	info := xmpp.NewElementName("info")
+	info.SetAttribute("id", hash)
+	info.SetAttribute("bytes", strconv.Itoa(len(data)))
+	if len(mimeType) > 0 {
+		info.SetAttribute("type", mimeType)
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		info.SetAttribute("width", strconv.Itoa(cfg.Width))
+		info.SetAttribute("height", strconv.Itoa(cfg.Height))
+	}
+	metadataEl.AppendElement(info)
+	return metadataEl
+}
+
+// vCardPhoto returns the decoded binary photo contained in a vCard along with its MIME type.
+func vCardPhoto(vCard xmpp.XElement) ([]byte, string, error) {
+	photo := vCard.Elements().Child("PHOTO")
+	if photo == nil {
+		return nil, "", nil
+	}
+	binVal := photo.Elements().Child("BINVAL")
+	if binVal == nil {
+		return nil, "", nil
+	}
+	data, err := base64.StdEncoding.DecodeString(utilstring.StripSpaces(binVal.Text()))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) == 0 {
+		return nil, "", nil
+	}
+	var mimeType string
+	if tp := photo.Elements().Child("TYPE"); tp != nil {
+		mimeType = tp.Text()
+	}
+	return data, mimeType, nil
+}
+
+func photoHash(data []byte) string {
+	h := sha1.Sum(data)
+	return hex.EncodeToString(h[:])
+}
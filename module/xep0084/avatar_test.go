@@ -0,0 +1,315 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0084
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	c2srouter "github.com/ortuman/jackal/c2s/router"
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	"github.com/ortuman/jackal/module/xep0054"
+	"github.com/ortuman/jackal/module/xep0163"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/router/host"
+	memorystorage "github.com/ortuman/jackal/storage/memory"
+	"github.com/ortuman/jackal/storage/mysql"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0084_VCardToPEP(t *testing.T) {
+	r, vCardRep, pubSubRep := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	pep := xep0163.New(&xep0163.Config{}, nil, nil, r, memorystorage.NewRoster(), pubSubRep)
+	vCard := xep0054.New(nil, r, vCardRep)
+	x := New(pep, vCard, vCardRep, pubSubRep)
+	defer func() { _ = x.Shutdown(); _ = vCard.Shutdown(); _ = pep.Shutdown() }()
+
+	img := testImage()
+	hash := photoHash(img)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(testVCard(img))
+
+	vCard.ProcessIQ(context.Background(), iq)
+	elem := stm.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	waitForSync(x)
+
+	// data node
+	items, _ := pubSubRep.FetchNodeItemsWithIDs(context.Background(), "ortuman@jackal.im", dataNamespace, []string{hash})
+	require.Len(t, items, 1)
+	require.Equal(t, base64.StdEncoding.EncodeToString(img), items[0].Payload.Text())
+
+	// metadata node
+	item, _ := pubSubRep.FetchNodeLastItem(context.Background(), "ortuman@jackal.im", metadataNamespace)
+	require.NotNil(t, item)
+	require.Equal(t, hash, item.ID)
+
+	info := metadataInfo(item.Payload)
+	require.NotNil(t, info)
+	require.Equal(t, "image/png", info.Attributes().Get("type"))
+	require.Equal(t, "1", info.Attributes().Get("width"))
+	require.Equal(t, "1", info.Attributes().Get("height"))
+
+	// remove photo
+	iq = xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(xmpp.NewElementNamespace("vCard", vCardNamespace))
+
+	vCard.ProcessIQ(context.Background(), iq)
+	receiveIQResult(t, stm)
+
+	waitForSync(x)
+
+	item, _ = pubSubRep.FetchNodeLastItem(context.Background(), "ortuman@jackal.im", metadataNamespace)
+	require.NotNil(t, item)
+	require.Equal(t, disabledItemID, item.ID)
+	require.Nil(t, metadataInfo(item.Payload))
+}
+
+func TestXEP0084_PEPToVCard(t *testing.T) {
+	r, vCardRep, pubSubRep := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	nickname := xmpp.NewElementName("NICKNAME")
+	nickname.SetText("ortuman")
+	vc := xmpp.NewElementNamespace("vCard", vCardNamespace)
+	vc.AppendElement(nickname)
+	_ = vCardRep.UpsertVCard(context.Background(), vc, "ortuman@jackal.im")
+
+	pep := xep0163.New(&xep0163.Config{}, nil, nil, r, memorystorage.NewRoster(), pubSubRep)
+	vCard := xep0054.New(nil, r, vCardRep)
+	x := New(pep, vCard, vCardRep, pubSubRep)
+	defer func() { _ = x.Shutdown(); _ = vCard.Shutdown(); _ = pep.Shutdown() }()
+
+	// vCard updates must reach the rest of vCard modules
+	var mu sync.Mutex
+	var updates int
+	vCard.RegisterUpdateHandler(func(_ context.Context, _ *jid.JID, _ xmpp.XElement) {
+		mu.Lock()
+		updates++
+		mu.Unlock()
+	})
+
+	img := testImage()
+	hash := photoHash(img)
+
+	dataEl := xmpp.NewElementNamespace("data", dataNamespace)
+	dataEl.SetText(base64.StdEncoding.EncodeToString(img))
+	pep.ProcessIQ(context.Background(), publishIQ(j, dataNamespace, hash, dataEl))
+	receiveIQResult(t, stm)
+
+	info := xmpp.NewElementName("info")
+	info.SetAttribute("id", hash)
+	info.SetAttribute("type", "image/png")
+	info.SetAttribute("bytes", "67")
+	metadataEl := xmpp.NewElementNamespace("metadata", metadataNamespace)
+	metadataEl.AppendElement(info)
+	pep.ProcessIQ(context.Background(), publishIQ(j, metadataNamespace, hash, metadataEl))
+	receiveIQResult(t, stm)
+
+	waitForSync(x)
+
+	stored, _ := vCardRep.FetchVCard(context.Background(), "ortuman@jackal.im")
+	require.NotNil(t, stored)
+	require.NotNil(t, stored.Elements().Child("NICKNAME"))
+
+	photo := stored.Elements().Child("PHOTO")
+	require.NotNil(t, photo)
+	require.Equal(t, "image/png", photo.Elements().Child("TYPE").Text())
+	require.Equal(t, base64.StdEncoding.EncodeToString(img), photo.Elements().Child("BINVAL").Text())
+
+	mu.Lock()
+	require.Equal(t, 1, updates)
+	mu.Unlock()
+
+	// presence hash is taken from stored metadata
+	pr := xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType)
+	x.UpdatePresence(context.Background(), pr)
+	require.Equal(t, hash, pr.Elements().ChildNamespace("x", vCardUpdateNamespace).Elements().Child("photo").Text())
+
+	// disable avatar
+	pep.ProcessIQ(context.Background(), publishIQ(j, metadataNamespace, disabledItemID, xmpp.NewElementNamespace("metadata", metadataNamespace)))
+	receiveIQResult(t, stm)
+
+	waitForSync(x)
+
+	stored, _ = vCardRep.FetchVCard(context.Background(), "ortuman@jackal.im")
+	require.NotNil(t, stored)
+	require.NotNil(t, stored.Elements().Child("NICKNAME"))
+	require.Nil(t, stored.Elements().Child("PHOTO"))
+}
+
+func TestXEP0084_PEPToVCardSQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.Nil(t, err)
+	defer func() { _ = db.Close() }()
+
+	vCardRep := memorystorage.NewVCard()
+	vCard := xep0054.New(nil, nil, vCardRep)
+	x := New(nil, vCard, vCardRep, mysql.NewPubSub(db))
+	defer func() { _ = x.Shutdown(); _ = vCard.Shutdown() }()
+
+	img := testImage()
+	hash := photoHash(img)
+
+	mock.ExpectQuery("SELECT item_id, publisher, payload, updated_at FROM pubsub_items WHERE \\(node_id = \\(SELECT id FROM pubsub_nodes WHERE host = \\? AND name = \\?\\) AND item_id IN \\(\\?\\)\\) ORDER BY created_at").
+		WithArgs("ortuman@jackal.im", dataNamespace, hash).
+		WillReturnRows(sqlmock.NewRows([]string{"item_id", "publisher", "payload", "updated_at"}).
+			AddRow(hash, "ortuman@jackal.im", "<data xmlns='urn:xmpp:avatar:data'>"+base64.StdEncoding.EncodeToString(img)+"</data>", time.Now()))
+
+	info := xmpp.NewElementName("info")
+	info.SetAttribute("id", hash)
+	info.SetAttribute("type", "image/png")
+	metadataEl := xmpp.NewElementNamespace("metadata", metadataNamespace)
+	metadataEl.AppendElement(info)
+
+	err = x.syncFromMetadata(context.Background(), "ortuman@jackal.im", &pubsubmodel.Item{ID: hash, Payload: metadataEl})
+	require.Nil(t, err)
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	stored, _ := vCardRep.FetchVCard(context.Background(), "ortuman@jackal.im")
+	require.NotNil(t, stored)
+
+	photo := stored.Elements().Child("PHOTO")
+	require.NotNil(t, photo)
+	require.Equal(t, "image/png", photo.Elements().Child("TYPE").Text())
+	require.Equal(t, base64.StdEncoding.EncodeToString(img), photo.Elements().Child("BINVAL").Text())
+}
+
+func TestXEP0084_UpdatePresence(t *testing.T) {
+	_, vCardRep, pubSubRep := setupTest("jackal.im")
+
+	img := testImage()
+	_ = vCardRep.UpsertVCard(context.Background(), testVCard(img), "ortuman@jackal.im")
+
+	x := New(nil, nil, vCardRep, pubSubRep)
+	defer func() { _ = x.Shutdown() }()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	// hash taken from vCard photo
+	pr := xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType)
+	x.UpdatePresence(context.Background(), pr)
+
+	xu := pr.Elements().ChildNamespace("x", vCardUpdateNamespace)
+	require.NotNil(t, xu)
+	require.Equal(t, photoHash(img), xu.Elements().Child("photo").Text())
+
+	// client provided hash gets replaced
+	_ = vCardRep.UpsertVCard(context.Background(), xmpp.NewElementNamespace("vCard", vCardNamespace), "ortuman@jackal.im")
+
+	pr = xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType)
+	clientXU := xmpp.NewElementNamespace("x", vCardUpdateNamespace)
+	clientXU.AppendElement(xmpp.NewElementName("photo").SetText("abcd"))
+	pr.AppendElement(clientXU)
+	x.UpdatePresence(context.Background(), pr)
+
+	xus := pr.Elements().ChildrenNamespace("x", vCardUpdateNamespace)
+	require.Len(t, xus, 1)
+	require.Equal(t, "", xus[0].Elements().Child("photo").Text())
+
+	// client not ready to advertise an avatar
+	pr = xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType)
+	pr.AppendElement(xmpp.NewElementNamespace("x", vCardUpdateNamespace))
+	x.UpdatePresence(context.Background(), pr)
+
+	xu = pr.Elements().ChildNamespace("x", vCardUpdateNamespace)
+	require.NotNil(t, xu)
+	require.Nil(t, xu.Elements().Child("photo"))
+
+	// unavailable presence
+	pr = xmpp.NewPresence(j, j.ToBareJID(), xmpp.UnavailableType)
+	x.UpdatePresence(context.Background(), pr)
+	require.Nil(t, pr.Elements().ChildNamespace("x", vCardUpdateNamespace))
+}
+
+func waitForSync(x *Avatar) {
+	c := make(chan struct{})
+	x.runQueue.Barrier(func() { close(c) })
+	<-c
+}
+
+func receiveIQResult(t *testing.T, stm *stream.MockC2S) {
+	for {
+		elem := stm.ReceiveElement()
+		if elem.Name() == "iq" {
+			require.Equal(t, xmpp.ResultType, elem.Type())
+			return
+		}
+	}
+}
+
+func publishIQ(j *jid.JID, nodeID, itemID string, payload xmpp.XElement) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	pubSubEl := xmpp.NewElementNamespace("pubsub", "http://jabber.org/protocol/pubsub")
+	publishEl := xmpp.NewElementName("publish")
+	publishEl.SetAttribute("node", nodeID)
+	itemEl := xmpp.NewElementName("item")
+	itemEl.SetAttribute("id", itemID)
+	itemEl.AppendElement(payload)
+	publishEl.AppendElement(itemEl)
+	pubSubEl.AppendElement(publishEl)
+	iq.AppendElement(pubSubEl)
+	return iq
+}
+
+func testVCard(img []byte) xmpp.XElement {
+	photo := xmpp.NewElementName("PHOTO")
+	photo.AppendElement(xmpp.NewElementName("TYPE").SetText("image/png"))
+	photo.AppendElement(xmpp.NewElementName("BINVAL").SetText(base64.StdEncoding.EncodeToString(img)))
+	vCard := xmpp.NewElementNamespace("vCard", vCardNamespace)
+	vCard.AppendElement(photo)
+	return vCard
+}
+
+func testImage() []byte {
+	buf := bytes.NewBuffer(nil)
+	_ = png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	return buf.Bytes()
+}
+
+func setupTest(domain string) (router.Router, repository.VCard, repository.PubSub) {
+	hosts, _ := host.New([]host.Config{{Name: domain, Certificate: tls.Certificate{}}})
+
+	r, _ := router.New(
+		hosts,
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
+		nil,
+	)
+	return r, memorystorage.NewVCard(), memorystorage.NewPubSub()
+}
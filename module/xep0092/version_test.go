@@ -83,7 +83,7 @@ func setupTest() router.Router {
 	hosts, _ := host.New([]host.Config{{Name: "jackal.im", Certificate: tls.Certificate{}}})
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList()),
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
 		nil,
 	)
 	return r
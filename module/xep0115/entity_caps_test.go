@@ -78,7 +78,7 @@ func setupTest(domain string) (router.Router, *memorystorage.Presences) {
 	s := memorystorage.NewPresences()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList()),
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
 		nil,
 	)
 	return r, s
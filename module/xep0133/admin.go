@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const adminNamespace = "http://jabber.org/protocol/admin"
+
+// AccountRemover defines the operation used to delete a user account along with all its associated data.
+type AccountRemover interface {
+	DeleteAccount(ctx context.Context, userJID *jid.JID) error
+}
+
+// ServiceAdmin represents a service administration module.
+// Administration commands are offered through XEP-0050 ad-hoc commands.
+type ServiceAdmin struct {
+	adHoc      *xep0050.AdHoc
+	router     router.Router
+	userRep    repository.User
+	rosterRep  repository.Roster
+	accRemover AccountRemover
+	admins     map[string]struct{}
+	commands   []*command
+}
+
+// New returns a service administration module registering all its commands into adHoc.
+func New(config *Config, adHoc *xep0050.AdHoc, router router.Router, userRep repository.User, rosterRep repository.Roster, accRemover AccountRemover) *ServiceAdmin {
+	x := &ServiceAdmin{
+		adHoc:      adHoc,
+		router:     router,
+		userRep:    userRep,
+		rosterRep:  rosterRep,
+		accRemover: accRemover,
+		admins:     make(map[string]struct{}, len(config.Admins)),
+	}
+	for _, admin := range config.Admins {
+		x.admins[admin] = struct{}{}
+	}
+	x.commands = []*command{
+		{node: adminNamespace + "#add-user", name: "Add User", form: addUserForm, submit: x.addUser},
+		{node: adminNamespace + "#delete-user", name: "Delete User", form: deleteUserForm, submit: x.deleteUser},
+		{node: adminNamespace + "#change-user-password", name: "Change User Password", form: changeUserPasswordForm, submit: x.changeUserPassword},
+		{node: adminNamespace + "#get-online-users-list", name: "Get List of Online Users", form: getOnlineUsersForm, submit: x.getOnlineUsers},
+		{node: adminNamespace + "#announce", name: "Send Announcement to Online Users", form: announceForm, submit: x.announce},
+		{node: adminNamespace + "#get-user-statistics", name: "Get User Statistics", form: getUserStatisticsForm, submit: x.getUserStatistics},
+	}
+	for _, cmd := range x.commands {
+		cmd.admin = x
+		adHoc.RegisterCommand(cmd)
+	}
+	return x
+}
+
+// Shutdown shuts down service administration module.
+func (x *ServiceAdmin) Shutdown() error {
+	for _, cmd := range x.commands {
+		x.adHoc.UnregisterCommand(cmd.node)
+	}
+	return nil
+}
+
+func (x *ServiceAdmin) isAdmin(j *jid.JID) bool {
+	_, ok := x.admins[j.ToBareJID().String()]
+	return ok
+}
+
+type command struct {
+	admin  *ServiceAdmin
+	node   string
+	name   string
+	form   func() *xep0004.DataForm
+	submit func(ctx context.Context, sess *xep0050.Session, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError)
+}
+
+func (c *command) Node() string { return c.node }
+func (c *command) Name() string { return c.name }
+
+func (c *command) IsAllowed(fromJID, toJID *jid.JID) bool {
+	hosts := c.admin.router.Hosts()
+	if !c.admin.isAdmin(fromJID) || !hosts.IsLocalHost(fromJID.Domain()) || !hosts.IsLocalHost(toJID.Domain()) {
+		return false
+	}
+	// only accept commands coming from a locally bound c2s stream
+	return c.admin.router.LocalStream(fromJID) != nil
+}
+
+func (c *command) Execute(ctx context.Context, sess *xep0050.Session, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	if form == nil {
+		if sess.Stage > 0 {
+			return nil, xmpp.ErrBadRequest
+		}
+		f := c.form()
+		f.Type = xep0004.Form
+		f.Title = c.name
+		f.Fields = append(xep0004.Fields{{Var: xep0004.FormType, Type: xep0004.Hidden, Values: []string{adminNamespace}}}, f.Fields...)
+		return &xep0050.Response{
+			Status:        xep0050.Executing,
+			Actions:       []string{xep0050.Complete},
+			DefaultAction: xep0050.Complete,
+			Form:          f,
+		}, nil
+	}
+	if form.Type != xep0004.Submit {
+		return nil, xmpp.ErrBadRequest
+	}
+	return c.submit(ctx, sess, form)
+}
+
+// accountJID parses an account JID submitted within a command form.
+// Only accounts belonging to the domain the command was addressed to can be managed.
+func accountJID(value string, sess *xep0050.Session) (*jid.JID, *xmpp.StanzaError) {
+	j, err := jid.NewWithString(value, false)
+	if err != nil || len(j.Node()) == 0 {
+		return nil, xmpp.ErrBadRequest
+	}
+	if j.Domain() != sess.ToJID.Domain() {
+		return nil, xmpp.ErrNotAllowed
+	}
+	return j.ToBareJID(), nil
+}
+
+func completed(note string) *xep0050.Response {
+	return &xep0050.Response{
+		Status: xep0050.Completed,
+		Notes:  []xep0050.Note{{Type: xep0050.InfoNote, Text: note}},
+	}
+}
+
+func resultForm(fields ...xep0004.Field) *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Type:   xep0004.Result,
+		Fields: append(xep0004.Fields{{Var: xep0004.FormType, Type: xep0004.Hidden, Values: []string{adminNamespace}}}, fields...),
+	}
+}
+
+// fieldValues returns all values submitted for a form field regardless of its type.
+func fieldValues(form *xep0004.DataForm, fieldVar string) []string {
+	for _, field := range form.Fields {
+		if field.Var == fieldVar {
+			return field.Values
+		}
+	}
+	return nil
+}
+
+func fieldValue(form *xep0004.DataForm, fieldVar string) string {
+	if values := fieldValues(form, fieldVar); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,378 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	c2srouter "github.com/ortuman/jackal/c2s/router"
+	"github.com/ortuman/jackal/model"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/router/host"
+	memorystorage "github.com/ortuman/jackal/storage/memory"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAccountRemover struct {
+	userRep repository.User
+}
+
+func (r *fakeAccountRemover) DeleteAccount(ctx context.Context, userJID *jid.JID) error {
+	return r.userRep.DeleteUser(ctx, userJID.ToBareJID().String())
+}
+
+type fakeCluster struct {
+	mu      sync.Mutex
+	remotes []router.ClusterResource
+	routed  map[string][]xmpp.Stanza
+}
+
+func (c *fakeCluster) Route(_ context.Context, stanza xmpp.Stanza, node string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.routed[node] = append(c.routed[node], stanza)
+	return nil
+}
+
+func (c *fakeCluster) Resources(j *jid.JID) []router.ClusterResource {
+	var ret []router.ClusterResource
+	for _, res := range c.remotes {
+		if res.JID == j.ToBareJID().String() {
+			ret = append(ret, res)
+		}
+	}
+	return ret
+}
+
+func (c *fakeCluster) AllResources() []router.ClusterResource    { return c.remotes }
+func (c *fakeCluster) BindResource(_ router.ClusterResource)     {}
+func (c *fakeCluster) UnbindResource(_ *jid.JID)                 {}
+func (c *fakeCluster) SetLocalDeliverer(_ router.LocalDeliverer) {}
+
+func (c *fakeCluster) routedTo(node string) []xmpp.Stanza {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.routed[node]
+}
+
+func TestXEP0133_Forbidden(t *testing.T) {
+	r, userRep, rosterRep := setupTest("jackal.im", nil)
+
+	j, _ := jid.New("noelia", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	adHoc := xep0050.New(&xep0050.Config{SessionTimeout: time.Minute}, nil, r)
+	defer func() { _ = adHoc.Shutdown() }()
+
+	x := New(&Config{Admins: []string{"ortuman@jackal.im"}}, adHoc, r, userRep, rosterRep, &fakeAccountRemover{userRep: userRep})
+	defer func() { _ = x.Shutdown() }()
+
+	adHoc.ProcessIQ(context.Background(), commandIQ(j, adminNamespace+"#add-user", "", "", nil))
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	cmd := x.commands[0]
+
+	// admin JID not bound to any local stream (e.g. spoofed over s2s)
+	adminJID, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	require.False(t, cmd.IsAllowed(adminJID, srvJID))
+
+	// admin JID belonging to a remote domain
+	remoteAdminJID, _ := jid.New("ortuman", "jabber.org", "balcony", true)
+	x.admins["ortuman@jabber.org"] = struct{}{}
+	require.False(t, cmd.IsAllowed(remoteAdminJID, srvJID))
+
+	_, _ = setupAdmin(r)
+	require.True(t, cmd.IsAllowed(adminJID, srvJID))
+}
+
+func TestXEP0133_AddUser(t *testing.T) {
+	r, userRep, rosterRep := setupTest("jackal.im", nil)
+
+	j, stm := setupAdmin(r)
+
+	adHoc := xep0050.New(&xep0050.Config{SessionTimeout: time.Minute}, nil, r)
+	defer func() { _ = adHoc.Shutdown() }()
+
+	x := New(&Config{Admins: []string{"ortuman@jackal.im"}}, adHoc, r, userRep, rosterRep, &fakeAccountRemover{userRep: userRep})
+	defer func() { _ = x.Shutdown() }()
+
+	node := adminNamespace + "#add-user"
+
+	// first stage
+	adHoc.ProcessIQ(context.Background(), commandIQ(j, node, "", "", nil))
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	cmdEl := elem.Elements().ChildNamespace("command", xep0050.Namespace)
+	require.Equal(t, xep0050.Executing, cmdEl.Attributes().Get("status"))
+	form, err := xep0004.NewFormFromElement(cmdEl.Elements().ChildNamespace("x", xep0004.FormNamespace))
+	require.Nil(t, err)
+	require.Equal(t, adminNamespace, fieldValue(form, xep0004.FormType))
+	require.Equal(t, xep0004.JidSingle, form.Fields[1].Type)
+
+	// password mismatch
+	elem = executeCommand(adHoc, stm, j, node, submitForm(map[string][]string{
+		"accountjid":      {"noelia@jackal.im"},
+		"password":        {"1234"},
+		"password-verify": {"4321"},
+	}))
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// foreign domain
+	elem = executeCommand(adHoc, stm, j, node, submitForm(map[string][]string{
+		"accountjid":      {"noelia@jabber.org"},
+		"password":        {"1234"},
+		"password-verify": {"1234"},
+	}))
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrNotAllowed.Error(), elem.Error().Elements().All()[0].Name())
+
+	elem = executeCommand(adHoc, stm, j, node, submitForm(map[string][]string{
+		"accountjid":      {"noelia@jackal.im"},
+		"password":        {"1234"},
+		"password-verify": {"1234"},
+	}))
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, xep0050.Completed, elem.Elements().ChildNamespace("command", xep0050.Namespace).Attributes().Get("status"))
+
+	usr, _ := userRep.FetchUser(context.Background(), "noelia@jackal.im")
+	require.NotNil(t, usr)
+	require.Equal(t, "1234", usr.Password)
+
+	// already registered
+	elem = executeCommand(adHoc, stm, j, node, submitForm(map[string][]string{
+		"accountjid":      {"noelia@jackal.im"},
+		"password":        {"1234"},
+		"password-verify": {"1234"},
+	}))
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrConflict.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0133_DeleteUserAndChangePassword(t *testing.T) {
+	r, userRep, rosterRep := setupTest("jackal.im", nil)
+
+	j, stm := setupAdmin(r)
+
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm2.SetPresence(xmpp.NewPresence(j2, j2, xmpp.AvailableType))
+	r.Bind(context.Background(), stm2)
+
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "noelia", Domain: "jackal.im", Password: "1234"})
+
+	adHoc := xep0050.New(&xep0050.Config{SessionTimeout: time.Minute}, nil, r)
+	defer func() { _ = adHoc.Shutdown() }()
+
+	x := New(&Config{Admins: []string{"ortuman@jackal.im"}}, adHoc, r, userRep, rosterRep, &fakeAccountRemover{userRep: userRep})
+	defer func() { _ = x.Shutdown() }()
+
+	elem := executeCommand(adHoc, stm, j, adminNamespace+"#change-user-password", submitForm(map[string][]string{
+		"accountjid": {"noelia@jackal.im"},
+		"password":   {"4321"},
+	}))
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	usr, _ := userRep.FetchUser(context.Background(), "noelia@jackal.im")
+	require.Equal(t, "4321", usr.Password)
+
+	elem = executeCommand(adHoc, stm, j, adminNamespace+"#change-user-password", submitForm(map[string][]string{
+		"accountjid": {"romeo@jackal.im"},
+		"password":   {"4321"},
+	}))
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	elem = executeCommand(adHoc, stm, j, adminNamespace+"#delete-user", submitForm(map[string][]string{
+		"accountjids": {"noelia@jackal.im"},
+	}))
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	usr, _ = userRep.FetchUser(context.Background(), "noelia@jackal.im")
+	require.Nil(t, usr)
+	require.True(t, stm2.IsDisconnected())
+}
+
+func TestXEP0133_OnlineUsersAndAnnounce(t *testing.T) {
+	cl := &fakeCluster{
+		remotes: []router.ClusterResource{
+			{Node: "node-b", JID: "romeo@jackal.im", Resource: "hall", Available: true},
+			{Node: "node-b", JID: "juliet@jabber.org", Resource: "hall", Available: true},
+		},
+		routed: make(map[string][]xmpp.Stanza),
+	}
+	r, userRep, rosterRep := setupTest("jackal.im", cl)
+
+	j, stm := setupAdmin(r)
+
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm2.SetPresence(xmpp.NewPresence(j2, j2, xmpp.AvailableType))
+	r.Bind(context.Background(), stm2)
+
+	adHoc := xep0050.New(&xep0050.Config{SessionTimeout: time.Minute}, nil, r)
+	defer func() { _ = adHoc.Shutdown() }()
+
+	x := New(&Config{Admins: []string{"ortuman@jackal.im"}}, adHoc, r, userRep, rosterRep, &fakeAccountRemover{userRep: userRep})
+	defer func() { _ = x.Shutdown() }()
+
+	elem := executeCommand(adHoc, stm, j, adminNamespace+"#get-online-users-list", submitForm(map[string][]string{
+		"max_items": {"none"},
+	}))
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	cmdEl := elem.Elements().ChildNamespace("command", xep0050.Namespace)
+	form, err := xep0004.NewFormFromElement(cmdEl.Elements().ChildNamespace("x", xep0004.FormNamespace))
+	require.Nil(t, err)
+	require.Equal(t, xep0004.Result, form.Type)
+	require.Equal(t, []string{"noelia@jackal.im", "ortuman@jackal.im", "romeo@jackal.im"}, fieldValues(form, "onlineuserjids"))
+
+	elem = executeCommand(adHoc, stm, j, adminNamespace+"#get-online-users-list", submitForm(map[string][]string{
+		"max_items": {"1"},
+	}))
+	cmdEl = elem.Elements().ChildNamespace("command", xep0050.Namespace)
+	form, _ = xep0004.NewFormFromElement(cmdEl.Elements().ChildNamespace("x", xep0004.FormNamespace))
+	require.Equal(t, []string{"noelia@jackal.im"}, fieldValues(form, "onlineuserjids"))
+
+	// announce
+	adHoc.ProcessIQ(context.Background(), commandIQ(j, adminNamespace+"#announce", "", "", nil))
+	elem = stm.ReceiveElement()
+	sessionID := elem.Elements().ChildNamespace("command", xep0050.Namespace).Attributes().Get("sessionid")
+
+	adHoc.ProcessIQ(context.Background(), commandIQ(j, adminNamespace+"#announce", sessionID, xep0050.Complete, submitForm(map[string][]string{
+		"subject":      {"Maintenance"},
+		"announcement": {"Server will restart", "in 5 minutes"},
+	})))
+
+	msg := stm2.ReceiveElement()
+	require.Equal(t, "message", msg.Name())
+	require.Equal(t, xmpp.HeadlineType, msg.Type())
+	require.Equal(t, "jackal.im", msg.From())
+	require.Equal(t, "Maintenance", msg.Elements().Child("subject").Text())
+	require.Equal(t, "Server will restart\nin 5 minutes", msg.Elements().Child("body").Text())
+
+	// admin receives both the announcement and the command result
+	var names []string
+	names = append(names, stm.ReceiveElement().Name(), stm.ReceiveElement().Name())
+	require.ElementsMatch(t, []string{"message", "iq"}, names)
+
+	// resources bound on other cluster nodes are reached through the cluster
+	routed := cl.routedTo("node-b")
+	require.Len(t, routed, 1)
+	require.Equal(t, "romeo@jackal.im/hall", routed[0].ToJID().String())
+	require.Equal(t, "Server will restart\nin 5 minutes", routed[0].Elements().Child("body").Text())
+}
+
+func TestXEP0133_UserStatistics(t *testing.T) {
+	r, userRep, rosterRep := setupTest("jackal.im", nil)
+
+	j, stm := setupAdmin(r)
+	stm.SetRemoteAddr(&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5222})
+
+	_ = userRep.UpsertUser(context.Background(), &model.User{Username: "ortuman", Domain: "jackal.im", Password: "1234"})
+	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
+		Username:     "ortuman",
+		Domain:       "jackal.im",
+		JID:          "noelia@jackal.im",
+		Subscription: "both",
+	})
+
+	adHoc := xep0050.New(&xep0050.Config{SessionTimeout: time.Minute}, nil, r)
+	defer func() { _ = adHoc.Shutdown() }()
+
+	x := New(&Config{Admins: []string{"ortuman@jackal.im"}}, adHoc, r, userRep, rosterRep, &fakeAccountRemover{userRep: userRep})
+	defer func() { _ = x.Shutdown() }()
+
+	elem := executeCommand(adHoc, stm, j, adminNamespace+"#get-user-statistics", submitForm(map[string][]string{
+		"accountjid": {"ortuman@jackal.im"},
+	}))
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	cmdEl := elem.Elements().ChildNamespace("command", xep0050.Namespace)
+	form, err := xep0004.NewFormFromElement(cmdEl.Elements().ChildNamespace("x", xep0004.FormNamespace))
+	require.Nil(t, err)
+	require.Equal(t, "1", fieldValue(form, "rostersize"))
+	require.Equal(t, []string{"ortuman@jackal.im/balcony"}, fieldValues(form, "onlineresources"))
+	require.Equal(t, []string{"127.0.0.1:5222"}, fieldValues(form, "ipaddresses"))
+}
+
+// executeCommand runs a single stage admin command submitting form and returns the final response.
+func executeCommand(adHoc *xep0050.AdHoc, stm *stream.MockC2S, j *jid.JID, node string, form *xep0004.DataForm) xmpp.XElement {
+	adHoc.ProcessIQ(context.Background(), commandIQ(j, node, "", "", nil))
+	elem := stm.ReceiveElement()
+	sessionID := elem.Elements().ChildNamespace("command", xep0050.Namespace).Attributes().Get("sessionid")
+
+	adHoc.ProcessIQ(context.Background(), commandIQ(j, node, sessionID, xep0050.Complete, form))
+	return stm.ReceiveElement()
+}
+
+func commandIQ(j *jid.JID, node, sessionID, action string, form *xep0004.DataForm) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	srvJID, _ := jid.New("", j.Domain(), "", true)
+	iq.SetToJID(srvJID)
+
+	cmd := xmpp.NewElementNamespace("command", xep0050.Namespace)
+	cmd.SetAttribute("node", node)
+	if len(sessionID) > 0 {
+		cmd.SetAttribute("sessionid", sessionID)
+	}
+	if len(action) > 0 {
+		cmd.SetAttribute("action", action)
+	}
+	if form != nil {
+		cmd.AppendElement(form.Element())
+	}
+	iq.AppendElement(cmd)
+	return iq
+}
+
+func submitForm(values map[string][]string) *xep0004.DataForm {
+	form := &xep0004.DataForm{Type: xep0004.Submit}
+	for fieldVar, vs := range values {
+		form.Fields = append(form.Fields, xep0004.Field{Var: fieldVar, Values: vs})
+	}
+	return form
+}
+
+func setupAdmin(r router.Router) (*jid.JID, *stream.MockC2S) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+	return j, stm
+}
+
+func setupTest(domain string, cluster router.ClusterRouter) (router.Router, repository.User, repository.Roster) {
+	hosts, _ := host.New([]host.Config{{Name: domain, Certificate: tls.Certificate{}}})
+
+	userRep := memorystorage.NewUser()
+	r, _ := router.New(
+		hosts,
+		c2srouter.New(userRep, memorystorage.NewBlockList(), cluster),
+		nil,
+	)
+	return r, userRep, memorystorage.NewRoster()
+}
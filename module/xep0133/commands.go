@@ -0,0 +1,321 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	streamerror "github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+func addUserForm() *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Instructions: "Fill out this form to add a user.",
+		Fields: xep0004.Fields{
+			{Var: "accountjid", Type: xep0004.JidSingle, Label: "The Jabber ID for the account to be added", Required: true},
+			{Var: "password", Type: xep0004.TextPrivate, Label: "The password for this account", Required: true},
+			{Var: "password-verify", Type: xep0004.TextPrivate, Label: "Retype password", Required: true},
+		},
+	}
+}
+
+func (x *ServiceAdmin) addUser(ctx context.Context, sess *xep0050.Session, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	accJID, sErr := accountJID(fieldValue(form, "accountjid"), sess)
+	if sErr != nil {
+		return nil, sErr
+	}
+	password := fieldValue(form, "password")
+	if len(password) == 0 || password != fieldValue(form, "password-verify") {
+		return nil, xmpp.ErrNotAcceptable
+	}
+	exists, err := x.userRep.UserExists(ctx, accJID.String())
+	if err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if exists {
+		return nil, xmpp.ErrConflict
+	}
+	user := model.User{
+		Username:     accJID.Node(),
+		Domain:       accJID.Domain(),
+		Password:     password,
+		LastPresence: xmpp.NewPresence(accJID, accJID, xmpp.UnavailableType),
+	}
+	if err := x.userRep.UpsertUser(ctx, &user); err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	log.Infof("xep0133: added user %s (admin: %s)", accJID.String(), sess.FromJID.ToBareJID().String())
+	return completed(fmt.Sprintf("User %s successfully added.", accJID.String())), nil
+}
+
+func deleteUserForm() *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Instructions: "Fill out this form to delete a user.",
+		Fields: xep0004.Fields{
+			{Var: "accountjids", Type: xep0004.JidMulti, Label: "The Jabber ID(s) to delete", Required: true},
+		},
+	}
+}
+
+func (x *ServiceAdmin) deleteUser(ctx context.Context, sess *xep0050.Session, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	values := fieldValues(form, "accountjids")
+	if len(values) == 0 {
+		return nil, xmpp.ErrBadRequest
+	}
+	accJIDs := make([]*jid.JID, 0, len(values))
+	for _, value := range values {
+		accJID, sErr := accountJID(value, sess)
+		if sErr != nil {
+			return nil, sErr
+		}
+		accJIDs = append(accJIDs, accJID)
+	}
+	for _, accJID := range accJIDs {
+		if err := x.accRemover.DeleteAccount(ctx, accJID); err != nil {
+			log.Error(err)
+			return nil, xmpp.ErrInternalServerError
+		}
+		// streams bound on other cluster nodes are not disconnected, but they
+		// won't be able to authenticate again once the account is gone.
+		for _, stm := range x.router.LocalStreams(accJID) {
+			stm.Disconnect(ctx, streamerror.ErrNotAuthorized)
+		}
+		log.Infof("xep0133: deleted user %s (admin: %s)", accJID.String(), sess.FromJID.ToBareJID().String())
+	}
+	return completed("Users successfully deleted."), nil
+}
+
+func changeUserPasswordForm() *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Instructions: "Fill out this form to change a user's password.",
+		Fields: xep0004.Fields{
+			{Var: "accountjid", Type: xep0004.JidSingle, Label: "The Jabber ID for this account", Required: true},
+			{Var: "password", Type: xep0004.TextPrivate, Label: "The password for this account", Required: true},
+		},
+	}
+}
+
+func (x *ServiceAdmin) changeUserPassword(ctx context.Context, sess *xep0050.Session, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	accJID, sErr := accountJID(fieldValue(form, "accountjid"), sess)
+	if sErr != nil {
+		return nil, sErr
+	}
+	password := fieldValue(form, "password")
+	if len(password) == 0 {
+		return nil, xmpp.ErrNotAcceptable
+	}
+	user, err := x.userRep.FetchUser(ctx, accJID.String())
+	if err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if user == nil {
+		return nil, xmpp.ErrItemNotFound
+	}
+	user.Password = password
+	if err := x.userRep.UpsertUser(ctx, user); err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	log.Infof("xep0133: changed password of user %s (admin: %s)", accJID.String(), sess.FromJID.ToBareJID().String())
+	return completed("Password successfully changed."), nil
+}
+
+func getOnlineUsersForm() *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Instructions: "Fill out this form to get a list of online users.",
+		Fields: xep0004.Fields{
+			{
+				Var:    "max_items",
+				Type:   xep0004.ListSingle,
+				Label:  "Maximum number of items to show",
+				Values: []string{"100"},
+				Options: []xep0004.Option{
+					{Label: "25", Value: "25"},
+					{Label: "50", Value: "50"},
+					{Label: "75", Value: "75"},
+					{Label: "100", Value: "100"},
+					{Label: "150", Value: "150"},
+					{Label: "200", Value: "200"},
+					{Label: "None", Value: "none"},
+				},
+			},
+		},
+	}
+}
+
+func (x *ServiceAdmin) getOnlineUsers(_ context.Context, sess *xep0050.Session, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	maxItems := -1
+	if v := fieldValue(form, "max_items"); len(v) > 0 && v != "none" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, xmpp.ErrBadRequest
+		}
+		maxItems = n
+	}
+	var onlineJIDs []*jid.JID
+	for _, stm := range x.onlineStreams(sess.ToJID.Domain()) {
+		onlineJIDs = append(onlineJIDs, stm.JID())
+	}
+	onlineJIDs = append(onlineJIDs, x.clusterResources(sess.ToJID.Domain())...)
+
+	seen := make(map[string]struct{})
+	var userJIDs []string
+	for _, j := range onlineJIDs {
+		bareJID := j.ToBareJID().String()
+		if _, ok := seen[bareJID]; ok {
+			continue
+		}
+		seen[bareJID] = struct{}{}
+		userJIDs = append(userJIDs, bareJID)
+	}
+	sort.Strings(userJIDs)
+	if maxItems >= 0 && len(userJIDs) > maxItems {
+		userJIDs = userJIDs[:maxItems]
+	}
+	return &xep0050.Response{
+		Status: xep0050.Completed,
+		Form: resultForm(xep0004.Field{
+			Var:    "onlineuserjids",
+			Type:   xep0004.JidMulti,
+			Label:  "The list of all online users",
+			Values: userJIDs,
+		}),
+	}, nil
+}
+
+func announceForm() *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Instructions: "Fill out this form to make an announcement to all active users of this service.",
+		Fields: xep0004.Fields{
+			{Var: "subject", Type: xep0004.TextSingle, Label: "Subject"},
+			{Var: "announcement", Type: xep0004.TextMulti, Label: "Announcement", Required: true},
+		},
+	}
+}
+
+func (x *ServiceAdmin) announce(ctx context.Context, sess *xep0050.Session, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	lines := fieldValues(form, "announcement")
+	if len(lines) == 0 {
+		return nil, xmpp.ErrBadRequest
+	}
+	body := strings.Join(lines, "\n")
+	subject := fieldValue(form, "subject")
+
+	serverJID, _ := jid.New("", sess.ToJID.Domain(), "", true)
+	for _, stm := range x.onlineStreams(sess.ToJID.Domain()) {
+		stm.SendElement(ctx, announcementMessage(serverJID, stm.JID(), subject, body))
+	}
+	// resources bound on other cluster nodes are reached through the router
+	for _, j := range x.clusterResources(sess.ToJID.Domain()) {
+		if err := x.router.MustRoute(ctx, announcementMessage(serverJID, j, subject, body)); err != nil {
+			log.Warnf("xep0133: failed to route announcement to %s: %v", j.String(), err)
+		}
+	}
+	log.Infof("xep0133: sent announcement to %s (admin: %s)", serverJID.String(), sess.FromJID.ToBareJID().String())
+	return completed("Announcement successfully sent."), nil
+}
+
+func announcementMessage(fromJID, toJID *jid.JID, subject, body string) *xmpp.Message {
+	msg := xmpp.NewMessageType(uuid.New().String(), xmpp.HeadlineType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(toJID)
+	if len(subject) > 0 {
+		subjectEl := xmpp.NewElementName("subject")
+		subjectEl.SetText(subject)
+		msg.AppendElement(subjectEl)
+	}
+	bodyEl := xmpp.NewElementName("body")
+	bodyEl.SetText(body)
+	msg.AppendElement(bodyEl)
+	return msg
+}
+
+func getUserStatisticsForm() *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Instructions: "Fill out this form to gather user statistics.",
+		Fields: xep0004.Fields{
+			{Var: "accountjid", Type: xep0004.JidSingle, Label: "The Jabber ID for statistics", Required: true},
+		},
+	}
+}
+
+func (x *ServiceAdmin) getUserStatistics(ctx context.Context, sess *xep0050.Session, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	accJID, sErr := accountJID(fieldValue(form, "accountjid"), sess)
+	if sErr != nil {
+		return nil, sErr
+	}
+	exists, err := x.userRep.UserExists(ctx, accJID.String())
+	if err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if !exists {
+		return nil, xmpp.ErrItemNotFound
+	}
+	rosterItems, _, err := x.rosterRep.FetchRosterItems(ctx, accJID.String())
+	if err != nil {
+		log.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	var resources, ipAddresses []string
+	for _, stm := range x.router.LocalStreams(accJID) {
+		resources = append(resources, stm.JID().String())
+		if addr := stm.RemoteAddr(); addr != nil {
+			ipAddresses = append(ipAddresses, addr.String())
+		}
+	}
+	sort.Strings(resources)
+	sort.Strings(ipAddresses)
+
+	return &xep0050.Response{
+		Status: xep0050.Completed,
+		Form: resultForm(
+			xep0004.Field{Var: "accountjid", Type: xep0004.JidSingle, Label: "The Jabber ID", Values: []string{accJID.String()}},
+			xep0004.Field{Var: "rostersize", Type: xep0004.TextSingle, Label: "Roster size", Values: []string{strconv.Itoa(len(rosterItems))}},
+			xep0004.Field{Var: "onlineresources", Type: xep0004.JidMulti, Label: "Online resources", Values: resources},
+			xep0004.Field{Var: "ipaddresses", Type: xep0004.TextMulti, Label: "IP addresses", Values: ipAddresses},
+		),
+	}, nil
+}
+
+// onlineStreams returns all locally bound streams belonging to domain.
+func (x *ServiceAdmin) onlineStreams(domain string) []stream.C2S {
+	var stms []stream.C2S
+	for _, stm := range x.router.AllLocalStreams() {
+		if stm.JID() != nil && stm.JID().Domain() == domain {
+			stms = append(stms, stm)
+		}
+	}
+	return stms
+}
+
+// clusterResources returns the full JIDs of every resource bound to domain on remote cluster nodes.
+func (x *ServiceAdmin) clusterResources(domain string) []*jid.JID {
+	var ret []*jid.JID
+	for _, res := range x.router.ClusterResources() {
+		j, err := jid.NewWithString(res.JID+"/"+res.Resource, true)
+		if err != nil || j.Domain() != domain {
+			continue
+		}
+		ret = append(ret, j)
+	}
+	return ret
+}
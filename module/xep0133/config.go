@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"fmt"
+
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// Config represents Service Administration module (XEP-0133) configuration.
+type Config struct {
+	// Admins contains the bare JIDs of the accounts allowed to execute administration commands.
+	Admins []string
+}
+
+type configProxy struct {
+	Admins []string `yaml:"admins"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	admins := make([]string, 0, len(p.Admins))
+	for _, admin := range p.Admins {
+		j, err := jid.NewWithString(admin, false)
+		if err != nil || len(j.Node()) == 0 || !j.IsBare() {
+			return fmt.Errorf("xep0133.Config: invalid admin JID: %s", admin)
+		}
+		admins = append(admins, j.String())
+	}
+	cfg.Admins = admins
+	return nil
+}
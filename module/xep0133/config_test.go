@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte(`admins: [jackal.im]`), &cfg)
+	require.NotNil(t, err)
+
+	cfg = &Config{}
+	err = yaml.Unmarshal([]byte(`admins: [ortuman@jackal.im/balcony]`), &cfg)
+	require.NotNil(t, err)
+
+	cfg = &Config{}
+	err = yaml.Unmarshal([]byte(`admins: [ortuman@jackal.im, noelia@jackal.im]`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, []string{"ortuman@jackal.im", "noelia@jackal.im"}, cfg.Admins)
+}
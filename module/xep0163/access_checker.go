@@ -78,7 +78,7 @@ func (ac *accessChecker) checkPresenceAccess(ctx context.Context, j string) (boo
 	userJID, _ := jid.NewWithString(ac.host, true)
 	contactJID, _ := jid.NewWithString(j, true)
 
-	ri, err := ac.rosterRep.FetchRosterItem(ctx, userJID.Node(), contactJID.ToBareJID().String())
+	ri, err := ac.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contactJID.ToBareJID().String())
 	if err != nil {
 		return false, err
 	}
@@ -90,7 +90,7 @@ func (ac *accessChecker) checkRosterAccess(ctx context.Context, j string) (bool,
 	userJID, _ := jid.NewWithString(ac.host, true)
 	contactJID, _ := jid.NewWithString(j, true)
 
-	ri, err := ac.rosterRep.FetchRosterItem(ctx, userJID.Node(), contactJID.ToBareJID().String())
+	ri, err := ac.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contactJID.ToBareJID().String())
 	if err != nil {
 		return false, err
 	}
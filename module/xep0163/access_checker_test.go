@@ -56,6 +56,7 @@ func TestAccessChecker_PresenceSubscription(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Subscription: rostermodel.SubscriptionFrom,
 	})
@@ -80,6 +81,7 @@ func TestAccessChecker_RosterGroup(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Groups:       []string{"Family"},
 		Subscription: rostermodel.SubscriptionFrom,
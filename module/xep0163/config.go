@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0163
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultExpirySweepInterval = time.Minute
+
+// Config represents Personal Eventing Protocol module (XEP-0163) configuration.
+type Config struct {
+	// MaxNodes limits the number of nodes a user can own.
+	MaxNodes int
+
+	// MaxItemsPerNode caps the number of items persisted by every user node,
+	// regardless of the node max_items configuration value.
+	MaxItemsPerNode int
+
+	// MaxBytes limits the overall size of the item payloads persisted on behalf of a user.
+	MaxBytes int
+
+	// ItemExpiry maps node identifiers to the amount of time their items are kept before being swept.
+	ItemExpiry          map[string]time.Duration
+	ExpirySweepInterval time.Duration
+}
+
+type configProxy struct {
+	MaxNodes            int            `yaml:"max_nodes"`
+	MaxItemsPerNode     int            `yaml:"max_items_per_node"`
+	MaxBytes            int            `yaml:"max_bytes"`
+	ItemExpiry          map[string]int `yaml:"item_expiry"`
+	ExpirySweepInterval int            `yaml:"expiry_sweep_interval"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.MaxNodes < 0 || p.MaxItemsPerNode < 0 || p.MaxBytes < 0 || p.ExpirySweepInterval < 0 {
+		return fmt.Errorf("xep0163.Config: quota and interval values must be positive")
+	}
+	cfg.MaxNodes = p.MaxNodes
+	cfg.MaxItemsPerNode = p.MaxItemsPerNode
+	cfg.MaxBytes = p.MaxBytes
+	cfg.ItemExpiry = nil
+	if len(p.ItemExpiry) > 0 {
+		cfg.ItemExpiry = make(map[string]time.Duration, len(p.ItemExpiry))
+		for nodeID, secs := range p.ItemExpiry {
+			if secs <= 0 {
+				return fmt.Errorf("xep0163.Config: item expiry must be 1 or higher (node: %s)", nodeID)
+			}
+			cfg.ItemExpiry[nodeID] = time.Duration(secs) * time.Second
+		}
+	}
+	cfg.ExpirySweepInterval = time.Duration(p.ExpirySweepInterval) * time.Second
+	if cfg.ExpirySweepInterval == 0 {
+		cfg.ExpirySweepInterval = defaultExpirySweepInterval
+	}
+	return nil
+}
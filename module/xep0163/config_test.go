@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0163
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	cfg := &Config{}
+	err := yaml.Unmarshal([]byte(`max_nodes: -1`), &cfg)
+	require.NotNil(t, err)
+
+	cfg = &Config{}
+	err = yaml.Unmarshal([]byte(`
+item_expiry:
+  "http://jabber.org/protocol/geoloc": 0
+`), &cfg)
+	require.NotNil(t, err)
+
+	cfg = &Config{}
+	err = yaml.Unmarshal([]byte(`
+max_nodes: 64
+max_items_per_node: 256
+max_bytes: 1048576
+item_expiry:
+  "http://jabber.org/protocol/geoloc": 3600
+`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 64, cfg.MaxNodes)
+	require.Equal(t, 256, cfg.MaxItemsPerNode)
+	require.Equal(t, 1048576, cfg.MaxBytes)
+	require.Equal(t, time.Hour, cfg.ItemExpiry["http://jabber.org/protocol/geoloc"])
+	require.Equal(t, defaultExpirySweepInterval, cfg.ExpirySweepInterval)
+}
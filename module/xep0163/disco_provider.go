@@ -27,7 +27,10 @@ var pepFeatures = []string{
 	"http://jabber.org/protocol/pubsub#filtered-notifications",
 	"http://jabber.org/protocol/pubsub#persistent-items",
 	"http://jabber.org/protocol/pubsub#publish",
+	"http://jabber.org/protocol/pubsub#publish-options",
+	"http://jabber.org/protocol/pubsub#retract-items",
 	"http://jabber.org/protocol/pubsub#retrieve-items",
+	"http://jabber.org/protocol/pubsub#rsm",
 	"http://jabber.org/protocol/pubsub#subscribe",
 }
 
@@ -117,7 +120,7 @@ func (p *discoInfoProvider) isSubscribedTo(ctx context.Context, contact *jid.JID
 	if contact.MatchesWithOptions(userJID, jid.MatchesBare) {
 		return true
 	}
-	ri, err := p.rosterRep.FetchRosterItem(ctx, userJID.Node(), contact.ToBareJID().String())
+	ri, err := p.rosterRep.FetchRosterItem(ctx, userJID.ToBareJID().String(), contact.ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		return false
@@ -65,6 +65,7 @@ func TestDiscoInfoProvider_Items(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "noelia",
+		Domain:       "jackal.im",
 		JID:          "ortuman@jackal.im",
 		Subscription: rostermodel.SubscriptionTo,
 	})
@@ -9,11 +9,14 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"strconv"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/ortuman/jackal/log"
 	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
 	rostermodel "github.com/ortuman/jackal/model/roster"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
 	"github.com/ortuman/jackal/module/xep0004"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/module/xep0115"
@@ -60,26 +63,41 @@ type commandContext struct {
 	accessChecker  *accessChecker
 }
 
+// PublishHandler is invoked every time a node owner publishes a new item.
+type PublishHandler func(ctx context.Context, host string, item *pubsubmodel.Item)
+
+// RetractHandler is invoked every time a node owner retracts an item.
+type RetractHandler func(ctx context.Context, host, itemID string)
+
 // Pep represents a Personal Eventing Protocol module.
 type Pep struct {
-	runQueue   *runqueue.RunQueue
-	router     router.Router
-	rosterRep  repository.Roster
-	pubSubRep  repository.PubSub
-	disco      *xep0030.DiscoInfo
-	entityCaps *xep0115.EntityCaps
-	hosts      []string
+	cfg             *Config
+	runQueue        *runqueue.ShardedRunQueue
+	router          router.Router
+	rosterRep       repository.Roster
+	pubSubRep       repository.PubSub
+	disco           *xep0030.DiscoInfo
+	entityCaps      *xep0115.EntityCaps
+	hostsMu         sync.Mutex
+	hosts           []string
+	handlersMu      sync.RWMutex
+	publishHandlers map[string][]PublishHandler
+	retractHandlers map[string][]RetractHandler
+	closeCh         chan struct{}
 }
 
 // New returns a PEP command IQ handler module.
-func New(disco *xep0030.DiscoInfo, presenceHub *xep0115.EntityCaps, router router.Router, rosterRep repository.Roster, pubSubRep repository.PubSub) *Pep {
+func New(config *Config, disco *xep0030.DiscoInfo, presenceHub *xep0115.EntityCaps, router router.Router, rosterRep repository.Roster, pubSubRep repository.PubSub) *Pep {
 	p := &Pep{
-		runQueue:   runqueue.New("xep0163"),
-		rosterRep:  rosterRep,
-		pubSubRep:  pubSubRep,
-		router:     router,
-		disco:      disco,
-		entityCaps: presenceHub,
+		cfg:             config,
+		runQueue:        runqueue.NewSharded("xep0163", 0),
+		rosterRep:       rosterRep,
+		pubSubRep:       pubSubRep,
+		router:          router,
+		disco:           disco,
+		entityCaps:      presenceHub,
+		publishHandlers: make(map[string][]PublishHandler),
+		retractHandlers: make(map[string][]RetractHandler),
 	}
 	// register account identity and features
 	if disco != nil {
@@ -89,6 +107,12 @@ func New(disco *xep0030.DiscoInfo, presenceHub *xep0115.EntityCaps, router route
 	}
 	// register disco items
 	p.registerDiscoItems(context.Background())
+
+	// start expired items sweeper
+	if len(config.ItemExpiry) > 0 {
+		p.closeCh = make(chan struct{})
+		go p.expiryLoop()
+	}
 	return p
 }
 
@@ -107,14 +131,14 @@ func (x *Pep) MatchesIQ(iq *xmpp.IQ) bool {
 
 // ProcessIQ processes a version IQ taking according actions over the associated stream
 func (x *Pep) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
-	x.runQueue.Run(func() {
+	x.runQueue.Run(iq.ToJID().ToBareJID().String(), func() {
 		x.processIQ(ctx, iq)
 	})
 }
 
 // SubscribeToAll subscribes a jid to all host nodes
 func (x *Pep) SubscribeToAll(ctx context.Context, host string, jid *jid.JID) {
-	x.runQueue.Run(func() {
+	x.runQueue.Run(host, func() {
 		if err := x.subscribeToAll(ctx, host, jid); err != nil {
 			log.Error(err)
 		}
@@ -123,7 +147,7 @@ func (x *Pep) SubscribeToAll(ctx context.Context, host string, jid *jid.JID) {
 
 // UnsubscribeFromAll unsubscribes a jid from all host nodes
 func (x *Pep) UnsubscribeFromAll(ctx context.Context, host string, jid *jid.JID) {
-	x.runQueue.Run(func() {
+	x.runQueue.Run(host, func() {
 		if err := x.unsubscribeFromAll(ctx, host, jid); err != nil {
 			log.Error(err)
 		}
@@ -132,15 +156,63 @@ func (x *Pep) UnsubscribeFromAll(ctx context.Context, host string, jid *jid.JID)
 
 // DeliverLastItems delivers last items from all those nodes to which the jid is subscribed
 func (x *Pep) DeliverLastItems(ctx context.Context, jid *jid.JID) {
-	x.runQueue.Run(func() {
+	x.runQueue.Run(jid.ToBareJID().String(), func() {
 		if err := x.deliverLastItems(ctx, jid); err != nil {
 			log.Error(err)
 		}
 	})
 }
 
+// RegisterPublishHandler registers a handler to be invoked whenever a node owner publishes an item on nodeID.
+func (x *Pep) RegisterPublishHandler(nodeID string, h PublishHandler) {
+	x.handlersMu.Lock()
+	x.publishHandlers[nodeID] = append(x.publishHandlers[nodeID], h)
+	x.handlersMu.Unlock()
+}
+
+// RegisterRetractHandler registers a handler to be invoked whenever a node owner retracts an item from nodeID.
+func (x *Pep) RegisterRetractHandler(nodeID string, h RetractHandler) {
+	x.handlersMu.Lock()
+	x.retractHandlers[nodeID] = append(x.retractHandlers[nodeID], h)
+	x.handlersMu.Unlock()
+}
+
+// Publish publishes an item on behalf of host, creating the node if it doesn't exist yet.
+// In case opts is nil default node options are applied on creation.
+// Registered publish handlers are not invoked for items published through this method.
+func (x *Pep) Publish(ctx context.Context, host, nodeID string, item *pubsubmodel.Item, opts *pubsubmodel.Options) error {
+	errCh := make(chan error, 1)
+	x.runQueue.Run(host, func() {
+		errCh <- x.publishItem(ctx, host, nodeID, item, opts)
+	})
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Retract retracts an item on behalf of host notifying node subscribers.
+// Registered retract handlers are not invoked for items retracted through this method.
+func (x *Pep) Retract(ctx context.Context, host, nodeID, itemID string) error {
+	errCh := make(chan error, 1)
+	x.runQueue.Run(host, func() {
+		errCh <- x.retractItem(ctx, host, nodeID, itemID)
+	})
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Shutdown shuts down version module.
 func (x *Pep) Shutdown() error {
+	if x.closeCh != nil {
+		close(x.closeCh)
+	}
 	c := make(chan struct{})
 	x.runQueue.Stop(func() { close(c) })
 	<-c
@@ -167,6 +239,9 @@ func (x *Pep) registerDiscoItems(ctx context.Context) {
 }
 
 func (x *Pep) registerDiscoItemHandlers(ctx context.Context) error {
+	x.hostsMu.Lock()
+	defer x.hostsMu.Unlock()
+
 	// unregister previous handlers
 	for _, h := range x.hosts {
 		x.disco.UnregisterProvider(h)
@@ -307,7 +382,19 @@ func (x *Pep) processRequest(ctx context.Context, iq *xmpp.IQ, pubSubEl xmpp.XEl
 			includeSubscriptions: true,
 		}
 		x.withCommandContext(ctx, opts, cmdEl, iq, func(cmdCtx *commandContext) {
-			x.publish(ctx, cmdCtx, cmdEl, iq)
+			x.publish(ctx, cmdCtx, pubSubEl, cmdEl, iq)
+		})
+		return
+	}
+	// Retract
+	if cmdEl := pubSubEl.Elements().Child("retract"); cmdEl != nil && iq.IsSet() {
+		opts := commandOptions{
+			allowedAffiliations:  []string{pubsubmodel.Owner, pubsubmodel.Member},
+			includeSubscriptions: true,
+			failOnNotFound:       true,
+		}
+		x.withCommandContext(ctx, opts, cmdEl, iq, func(cmdCtx *commandContext) {
+			x.retract(ctx, cmdCtx, cmdEl, iq)
 		})
 		return
 	}
@@ -343,7 +430,7 @@ func (x *Pep) processRequest(ctx context.Context, iq *xmpp.IQ, pubSubEl xmpp.XEl
 			failOnNotFound:       true,
 		}
 		x.withCommandContext(ctx, opts, cmdEl, iq, func(cmdCtx *commandContext) {
-			x.retrieveItems(ctx, cmdCtx, cmdEl, iq)
+			x.retrieveItems(ctx, cmdCtx, pubSubEl, cmdEl, iq)
 		})
 		return
 	}
@@ -387,7 +474,7 @@ func (x *Pep) processOwnerRequest(ctx context.Context, iq *xmpp.IQ, pubSub xmpp.
 				failOnNotFound:      true,
 			}
 			x.withCommandContext(ctx, opts, cmdEl, iq, func(cmdCtx *commandContext) {
-				x.retrieveAffiliations(ctx, cmdCtx, iq)
+				x.retrieveAffiliations(ctx, cmdCtx, pubSub, iq)
 			})
 		} else if iq.IsSet() {
 			opts := commandOptions{
@@ -411,7 +498,7 @@ func (x *Pep) processOwnerRequest(ctx context.Context, iq *xmpp.IQ, pubSub xmpp.
 				failOnNotFound:       true,
 			}
 			x.withCommandContext(ctx, opts, cmdEl, iq, func(cmdCtx *commandContext) {
-				x.retrieveSubscriptions(ctx, cmdCtx, iq)
+				x.retrieveSubscriptions(ctx, cmdCtx, pubSub, iq)
 			})
 		} else if iq.IsSet() {
 			opts := commandOptions{
@@ -467,6 +554,16 @@ func (x *Pep) create(ctx context.Context, cmdCtx *commandContext, pubSubEl xmpp.
 		// apply default configuration
 		node.Options = defaultNodeOptions
 	}
+	exceeded, err := x.nodeQuotaExceeded(ctx, cmdCtx.host)
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(ctx, iq.InternalServerError())
+		return
+	}
+	if exceeded {
+		_ = x.router.Route(ctx, iq.PolicyViolationError())
+		return
+	}
 	if err := x.createNode(ctx, node); err != nil {
 		log.Error(err)
 		_ = x.router.Route(ctx, iq.InternalServerError())
@@ -482,7 +579,7 @@ func (x *Pep) sendConfigurationForm(ctx context.Context, cmdCtx *commandContext,
 	configureNode := xmpp.NewElementName("configure")
 	configureNode.SetAttribute("node", cmdCtx.nodeID)
 
-	rosterGroups, err := x.rosterRep.FetchRosterGroups(ctx, iq.ToJID().Node())
+	rosterGroups, err := x.rosterRep.FetchRosterGroups(ctx, iq.ToJID().ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		_ = x.router.Route(ctx, iq.InternalServerError())
@@ -681,7 +778,7 @@ func (x *Pep) unsubscribe(ctx context.Context, cmdCtx *commandContext, cmdEl xmp
 	_ = x.router.Route(ctx, iqRes)
 }
 
-func (x *Pep) publish(ctx context.Context, cmdCtx *commandContext, cmdEl xmpp.XElement, iq *xmpp.IQ) {
+func (x *Pep) publish(ctx context.Context, cmdCtx *commandContext, pubSubEl, cmdEl xmpp.XElement, iq *xmpp.IQ) {
 	itemEl := cmdEl.Elements().Child("item")
 	if itemEl == nil || len(itemEl.Elements().All()) != 1 {
 		_ = x.router.Route(ctx, invalidPayloadError(iq))
@@ -692,22 +789,59 @@ func (x *Pep) publish(ctx context.Context, cmdCtx *commandContext, cmdEl xmpp.XE
 		// generate unique item identifier
 		itemID = uuid.New().String()
 	}
+	preconditions, err := publishOptions(pubSubEl)
+	if err != nil {
+		_ = x.router.Route(ctx, iq.BadRequestError())
+		return
+	}
+	item := &pubsubmodel.Item{
+		ID:        itemID,
+		Publisher: iq.FromJID().ToBareJID().String(),
+		Payload:   itemEl.Elements().All()[0],
+	}
 	// auto create node
-	if cmdCtx.node == nil {
+	isNewNode := cmdCtx.node == nil
+	if isNewNode {
 		if !cmdCtx.isAccountOwner {
 			_ = x.router.Route(ctx, iq.ForbiddenError())
 			return
 		}
+		nodeOpts := defaultNodeOptions
+		if len(preconditions) > 0 {
+			opts, err := applyPublishOptions(&defaultNodeOptions, preconditions)
+			if err != nil {
+				_ = x.router.Route(ctx, iq.BadRequestError())
+				return
+			}
+			nodeOpts = *opts
+		}
 		cmdCtx.node = &pubsubmodel.Node{
 			Host:    cmdCtx.host,
 			Name:    cmdCtx.nodeID,
-			Options: defaultNodeOptions,
+			Options: nodeOpts,
 		}
 		cmdCtx.subscriptions = []pubsubmodel.Subscription{{
 			JID:          cmdCtx.host,
 			SubID:        subscriptionID(cmdCtx.host, cmdCtx.host, cmdCtx.nodeID),
 			Subscription: pubsubmodel.Subscribed,
 		}}
+	} else if len(preconditions) > 0 && !publishOptionsMet(&cmdCtx.node.Options, preconditions) {
+		_ = x.router.Route(ctx, preconditionNotMetError(iq))
+		return
+	}
+	// check user quotas
+	switch err := x.checkPublishQuotas(ctx, cmdCtx.host, cmdCtx.nodeID, isNewNode, &cmdCtx.node.Options, item); err {
+	case nil:
+		break
+	case errQuotaExceeded:
+		_ = x.router.Route(ctx, iq.PolicyViolationError())
+		return
+	default:
+		log.Error(err)
+		_ = x.router.Route(ctx, iq.InternalServerError())
+		return
+	}
+	if isNewNode {
 		if err := x.createNode(ctx, cmdCtx.node); err != nil {
 			log.Error(err)
 			_ = x.router.Route(ctx, iq.InternalServerError())
@@ -717,13 +851,7 @@ func (x *Pep) publish(ctx context.Context, cmdCtx *commandContext, cmdEl xmpp.XE
 	// persist node item
 	opts := cmdCtx.node.Options
 	if opts.PersistItems {
-		err := x.pubSubRep.UpsertNodeItem(ctx, &pubsubmodel.Item{
-			ID:        itemID,
-			Publisher: iq.FromJID().ToBareJID().String(),
-			Payload:   itemEl.Elements().All()[0],
-		}, cmdCtx.host, cmdCtx.nodeID, int(opts.MaxItems))
-
-		if err != nil {
+		if err := x.pubSubRep.UpsertNodeItem(ctx, item, cmdCtx.host, cmdCtx.nodeID, x.maxNodeItems(&opts)); err != nil {
 			log.Error(err)
 			_ = x.router.Route(ctx, iq.InternalServerError())
 			return
@@ -731,6 +859,9 @@ func (x *Pep) publish(ctx context.Context, cmdCtx *commandContext, cmdEl xmpp.XE
 	}
 	log.Infof("pep: published item (host: %s, node_id: %s, item_id: %s)", cmdCtx.host, cmdCtx.nodeID, itemID)
 
+	if cmdCtx.isAccountOwner {
+		x.runPublishHandlers(ctx, cmdCtx.host, cmdCtx.nodeID, item)
+	}
 	// notify published item
 	itemsElem := xmpp.NewElementName("items")
 	itemsElem.SetAttribute("node", cmdCtx.nodeID)
@@ -766,7 +897,168 @@ func (x *Pep) publish(ctx context.Context, cmdCtx *commandContext, cmdEl xmpp.XE
 	_ = x.router.Route(ctx, iqRes)
 }
 
-func (x *Pep) retrieveItems(ctx context.Context, cmdCtx *commandContext, cmdEl xmpp.XElement, iq *xmpp.IQ) {
+func (x *Pep) publishItem(ctx context.Context, host, nodeID string, item *pubsubmodel.Item, opts *pubsubmodel.Options) error {
+	node, err := x.pubSubRep.FetchNode(ctx, host, nodeID)
+	if err != nil {
+		return err
+	}
+	isNewNode := node == nil
+	if isNewNode {
+		node = &pubsubmodel.Node{
+			Host:    host,
+			Name:    nodeID,
+			Options: defaultNodeOptions,
+		}
+		if opts != nil {
+			node.Options = *opts
+		}
+	}
+	if err := x.checkPublishQuotas(ctx, host, nodeID, isNewNode, &node.Options, item); err != nil {
+		return err
+	}
+	if isNewNode {
+		if err := x.createNode(ctx, node); err != nil {
+			return err
+		}
+	}
+	if node.Options.PersistItems {
+		if err := x.pubSubRep.UpsertNodeItem(ctx, item, host, nodeID, x.maxNodeItems(&node.Options)); err != nil {
+			return err
+		}
+	}
+	log.Infof("pep: published item (host: %s, node_id: %s, item_id: %s)", host, nodeID, item.ID)
+
+	itemsElem := xmpp.NewElementName("items")
+	itemsElem.SetAttribute("node", nodeID)
+
+	itemElem := xmpp.NewElementName("item")
+	itemElem.SetAttribute("id", item.ID)
+	if node.Options.DeliverPayloads || !node.Options.PersistItems {
+		itemElem.AppendElement(item.Payload)
+	}
+	itemsElem.AppendElement(itemElem)
+
+	return x.notifyOwnerEvent(ctx, node, itemsElem)
+}
+
+func (x *Pep) retractItem(ctx context.Context, host, nodeID, itemID string) error {
+	node, err := x.pubSubRep.FetchNode(ctx, host, nodeID)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return nil
+	}
+	if err := x.pubSubRep.DeleteNodeItem(ctx, host, nodeID, itemID); err != nil {
+		return err
+	}
+	log.Infof("pep: retracted item (host: %s, node_id: %s, item_id: %s)", host, nodeID, itemID)
+
+	return x.notifyOwnerEvent(ctx, node, retractElement(nodeID, itemID))
+}
+
+// notifyOwnerEvent notifies node subscribers about an event triggered by the node owner.
+func (x *Pep) notifyOwnerEvent(ctx context.Context, node *pubsubmodel.Node, notificationElem xmpp.XElement) error {
+	subscriptions, err := x.pubSubRep.FetchNodeSubscriptions(ctx, node.Host, node.Name)
+	if err != nil {
+		return err
+	}
+	aff, err := x.pubSubRep.FetchNodeAffiliation(ctx, node.Host, node.Name, node.Host)
+	if err != nil {
+		return err
+	}
+	accessChecker := &accessChecker{
+		host:                node.Host,
+		nodeID:              node.Name,
+		accessModel:         node.Options.AccessModel,
+		rosterAllowedGroups: node.Options.RosterGroupsAllowed,
+		affiliation:         aff,
+		rosterRep:           x.rosterRep,
+	}
+	x.notifySubscribers(ctx, notificationElem, subscriptions, accessChecker, node.Host, node.Name, node.Options.NotificationType)
+	return nil
+}
+
+func (x *Pep) runPublishHandlers(ctx context.Context, host, nodeID string, item *pubsubmodel.Item) {
+	x.handlersMu.RLock()
+	handlers := x.publishHandlers[nodeID]
+	x.handlersMu.RUnlock()
+
+	for _, h := range handlers {
+		h(ctx, host, item)
+	}
+}
+
+func (x *Pep) retract(ctx context.Context, cmdCtx *commandContext, cmdEl xmpp.XElement, iq *xmpp.IQ) {
+	itemEl := cmdEl.Elements().Child("item")
+	if itemEl == nil || len(itemEl.Attributes().Get("id")) == 0 {
+		_ = x.router.Route(ctx, itemRequiredError(iq))
+		return
+	}
+	itemID := itemEl.Attributes().Get("id")
+
+	items, err := x.pubSubRep.FetchNodeItemsWithIDs(ctx, cmdCtx.host, cmdCtx.nodeID, []string{itemID})
+	if err != nil {
+		log.Error(err)
+		_ = x.router.Route(ctx, iq.InternalServerError())
+		return
+	}
+	if len(items) == 0 {
+		_ = x.router.Route(ctx, iq.ItemNotFoundError())
+		return
+	}
+	if err := x.pubSubRep.DeleteNodeItem(ctx, cmdCtx.host, cmdCtx.nodeID, itemID); err != nil {
+		log.Error(err)
+		_ = x.router.Route(ctx, iq.InternalServerError())
+		return
+	}
+	log.Infof("pep: retracted item (host: %s, node_id: %s, item_id: %s)", cmdCtx.host, cmdCtx.nodeID, itemID)
+
+	if cmdCtx.isAccountOwner {
+		x.runRetractHandlers(ctx, cmdCtx.host, cmdCtx.nodeID, itemID)
+	}
+	// notify retracted item
+	if notify := cmdEl.Attributes().Get("notify"); notify == "true" || notify == "1" {
+		x.notifySubscribers(
+			ctx,
+			retractElement(cmdCtx.nodeID, itemID),
+			cmdCtx.subscriptions,
+			cmdCtx.accessChecker,
+			cmdCtx.host,
+			cmdCtx.nodeID,
+			cmdCtx.node.Options.NotificationType)
+	}
+	_ = x.router.Route(ctx, iq.ResultIQ())
+}
+
+func (x *Pep) runRetractHandlers(ctx context.Context, host, nodeID, itemID string) {
+	x.handlersMu.RLock()
+	handlers := x.retractHandlers[nodeID]
+	x.handlersMu.RUnlock()
+
+	for _, h := range handlers {
+		h(ctx, host, itemID)
+	}
+}
+
+func (x *Pep) retrieveItems(ctx context.Context, cmdCtx *commandContext, pubSubEl, cmdEl xmpp.XElement, iq *xmpp.IQ) {
+	rsmReq, err := resultSetRequest(pubSubEl)
+	if err != nil {
+		_ = x.router.Route(ctx, iq.BadRequestError())
+		return
+	}
+	includeResultSet := rsmReq != nil
+	if rsmReq == nil {
+		if maxItems := cmdEl.Attributes().Get("max_items"); len(maxItems) > 0 {
+			// return most recent items
+			n, err := strconv.Atoi(maxItems)
+			if err != nil || n < 0 {
+				_ = x.router.Route(ctx, iq.BadRequestError())
+				return
+			}
+			rsmReq = &rsmmodel.Request{Max: n, LastPage: true}
+		}
+	}
 	var itemIDs []string
 
 	itemElems := cmdEl.Elements().Children("item")
@@ -781,13 +1073,20 @@ func (x *Pep) retrieveItems(ctx context.Context, cmdCtx *commandContext, cmdEl x
 	}
 	// retrieve node items
 	var items []pubsubmodel.Item
-	var err error
+	var rsmRes *rsmmodel.Result
 
-	if len(itemIDs) > 0 {
+	switch {
+	case len(itemIDs) > 0:
 		items, err = x.pubSubRep.FetchNodeItemsWithIDs(ctx, cmdCtx.host, cmdCtx.nodeID, itemIDs)
-	} else {
+	case rsmReq != nil:
+		items, rsmRes, err = x.pubSubRep.FetchNodeItemsPage(ctx, cmdCtx.host, cmdCtx.nodeID, rsmReq)
+	default:
 		items, err = x.pubSubRep.FetchNodeItems(ctx, cmdCtx.host, cmdCtx.nodeID)
 	}
+	if err == rsmmodel.ErrPageNotFound {
+		_ = x.router.Route(ctx, iq.ItemNotFoundError())
+		return
+	}
 	if err != nil {
 		log.Error(err)
 		_ = x.router.Route(ctx, iq.InternalServerError())
@@ -809,16 +1108,27 @@ func (x *Pep) retrieveItems(ctx context.Context, cmdCtx *commandContext, cmdEl x
 		itemsElem.AppendElement(itemElem)
 	}
 	pubSubElem.AppendElement(itemsElem)
+	if includeResultSet && rsmRes != nil {
+		pubSubElem.AppendElement(rsmRes.Element())
+	}
 	iqRes.AppendElement(pubSubElem)
 
 	_ = x.router.Route(ctx, iqRes)
 }
 
-func (x *Pep) retrieveAffiliations(ctx context.Context, cmdCtx *commandContext, iq *xmpp.IQ) {
+func (x *Pep) retrieveAffiliations(ctx context.Context, cmdCtx *commandContext, pubSubEl xmpp.XElement, iq *xmpp.IQ) {
+	identifiers := make([]string, len(cmdCtx.affiliations))
+	for i, aff := range cmdCtx.affiliations {
+		identifiers[i] = aff.JID
+	}
+	from, to, rsmRes, ok := x.paginate(ctx, identifiers, pubSubEl, iq)
+	if !ok {
+		return
+	}
 	affiliationsElem := xmpp.NewElementName("affiliations")
 	affiliationsElem.SetAttribute("node", cmdCtx.nodeID)
 
-	for _, aff := range cmdCtx.affiliations {
+	for _, aff := range cmdCtx.affiliations[from:to] {
 		affElem := xmpp.NewElementName("affiliation")
 		affElem.SetAttribute("jid", aff.JID)
 		affElem.SetAttribute("affiliation", aff.Affiliation)
@@ -831,6 +1141,9 @@ func (x *Pep) retrieveAffiliations(ctx context.Context, cmdCtx *commandContext,
 	iqRes := iq.ResultIQ()
 	pubSubElem := xmpp.NewElementNamespace("pubsub", pubSubOwnerNamespace)
 	pubSubElem.AppendElement(affiliationsElem)
+	if rsmRes != nil {
+		pubSubElem.AppendElement(rsmRes.Element())
+	}
 	iqRes.AppendElement(pubSubElem)
 
 	_ = x.router.Route(ctx, iqRes)
@@ -868,11 +1181,19 @@ func (x *Pep) updateAffiliations(ctx context.Context, cmdCtx *commandContext, cm
 	_ = x.router.Route(ctx, iq.ResultIQ())
 }
 
-func (x *Pep) retrieveSubscriptions(ctx context.Context, cmdCtx *commandContext, iq *xmpp.IQ) {
+func (x *Pep) retrieveSubscriptions(ctx context.Context, cmdCtx *commandContext, pubSubEl xmpp.XElement, iq *xmpp.IQ) {
+	identifiers := make([]string, len(cmdCtx.subscriptions))
+	for i, sub := range cmdCtx.subscriptions {
+		identifiers[i] = sub.JID
+	}
+	from, to, rsmRes, ok := x.paginate(ctx, identifiers, pubSubEl, iq)
+	if !ok {
+		return
+	}
 	subscriptionsElem := xmpp.NewElementName("subscriptions")
 	subscriptionsElem.SetAttribute("node", cmdCtx.nodeID)
 
-	for _, sub := range cmdCtx.subscriptions {
+	for _, sub := range cmdCtx.subscriptions[from:to] {
 		subElem := xmpp.NewElementName("subscription")
 		subElem.SetAttribute("subid", sub.SubID)
 		subElem.SetAttribute("jid", sub.JID)
@@ -886,11 +1207,42 @@ func (x *Pep) retrieveSubscriptions(ctx context.Context, cmdCtx *commandContext,
 	iqRes := iq.ResultIQ()
 	pubSubElem := xmpp.NewElementNamespace("pubsub", pubSubOwnerNamespace)
 	pubSubElem.AppendElement(subscriptionsElem)
+	if rsmRes != nil {
+		pubSubElem.AppendElement(rsmRes.Element())
+	}
 	iqRes.AppendElement(pubSubElem)
 
 	_ = x.router.Route(ctx, iqRes)
 }
 
+// resultSetRequest returns the result set management request contained in pubSubEl, or nil if not present.
+func resultSetRequest(pubSubEl xmpp.XElement) (*rsmmodel.Request, error) {
+	setEl := pubSubEl.Elements().ChildNamespace("set", rsmmodel.Namespace)
+	if setEl == nil {
+		return nil, nil
+	}
+	return rsmmodel.NewRequestFromElement(setEl)
+}
+
+// paginate applies the result set management request contained in pubSubEl (if any) over a list of identifiers.
+// In case the request can't be satisfied a proper error response is routed and ok is set to false.
+func (x *Pep) paginate(ctx context.Context, identifiers []string, pubSubEl xmpp.XElement, iq *xmpp.IQ) (from, to int, res *rsmmodel.Result, ok bool) {
+	rsmReq, err := resultSetRequest(pubSubEl)
+	if err != nil {
+		_ = x.router.Route(ctx, iq.BadRequestError())
+		return 0, 0, nil, false
+	}
+	if rsmReq == nil {
+		return 0, len(identifiers), nil, true
+	}
+	from, to, res, err = rsmmodel.Paginate(identifiers, rsmReq)
+	if err != nil {
+		_ = x.router.Route(ctx, iq.ItemNotFoundError())
+		return 0, 0, nil, false
+	}
+	return from, to, res, true
+}
+
 func (x *Pep) updateSubscriptions(ctx context.Context, cmdCtx *commandContext, cmdElem xmpp.XElement, iq *xmpp.IQ) {
 	// update subscriptions
 	for _, subElem := range cmdElem.Elements().Children("subscription") {
@@ -1151,7 +1503,7 @@ func (x *Pep) createNode(ctx context.Context, node *pubsubmodel.Node) error {
 	if err != nil {
 		return err
 	}
-	rosterItems, _, err := x.rosterRep.FetchRosterItems(ctx, j.Node())
+	rosterItems, _, err := x.rosterRep.FetchRosterItems(ctx, j.ToBareJID().String())
 	if err != nil {
 		return err
 	}
@@ -1203,6 +1555,15 @@ func (x *Pep) sendLastPublishedItem(ctx context.Context, toJID *jid.JID, accessC
 	return nil
 }
 
+func retractElement(nodeID, itemID string) xmpp.XElement {
+	itemsElem := xmpp.NewElementName("items")
+	itemsElem.SetAttribute("node", nodeID)
+	retractElem := xmpp.NewElementName("retract")
+	retractElem.SetAttribute("id", itemID)
+	itemsElem.AppendElement(retractElem)
+	return itemsElem
+}
+
 func eventMessage(payloadElem xmpp.XElement, hostJID, toJID *jid.JID, notificationType string) *xmpp.Message {
 	msg := xmpp.NewMessageType(uuid.New().String(), notificationType)
 	msg.SetFromJID(hostJID)
@@ -1244,6 +1605,16 @@ func notOnWhitelistError(stanza xmpp.Stanza) xmpp.Stanza {
 	return xmpp.NewErrorStanzaFromStanza(stanza, xmpp.ErrNotAllowed, errorElements)
 }
 
+func itemRequiredError(stanza xmpp.Stanza) xmpp.Stanza {
+	errorElements := []xmpp.XElement{xmpp.NewElementNamespace("item-required", pubSubErrorNamespace)}
+	return xmpp.NewErrorStanzaFromStanza(stanza, xmpp.ErrBadRequest, errorElements)
+}
+
+func preconditionNotMetError(stanza xmpp.Stanza) xmpp.Stanza {
+	errorElements := []xmpp.XElement{xmpp.NewElementNamespace("precondition-not-met", pubSubErrorNamespace)}
+	return xmpp.NewErrorStanzaFromStanza(stanza, xmpp.ErrConflict, errorElements)
+}
+
 func notSubscribedError(stanza xmpp.Stanza) xmpp.Stanza {
 	errorElements := []xmpp.XElement{xmpp.NewElementNamespace("not-subscribed", pubSubErrorNamespace)}
 	return xmpp.NewErrorStanzaFromStanza(stanza, xmpp.ErrUnexpectedRequest, errorElements)
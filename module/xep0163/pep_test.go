@@ -14,6 +14,7 @@ import (
 	capsmodel "github.com/ortuman/jackal/model/capabilities"
 	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
 	rostermodel "github.com/ortuman/jackal/model/roster"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
 	"github.com/ortuman/jackal/module/xep0004"
 	"github.com/ortuman/jackal/module/xep0115"
 	"github.com/ortuman/jackal/router"
@@ -37,7 +38,7 @@ func TestXEP0163_Matching(t *testing.T) {
 
 	r.Bind(context.Background(), stm)
 
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	// test MatchesIQ
 	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
@@ -58,7 +59,7 @@ func TestXEP163_CreateNode(t *testing.T) {
 
 	r.Bind(context.Background(), stm)
 
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.SetType)
@@ -104,7 +105,7 @@ func TestXEP163_GetNodeConfiguration(t *testing.T) {
 		Affiliation: pubsubmodel.Owner,
 	}, "ortuman@jackal.im", "princely_musings")
 
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.GetType)
@@ -177,12 +178,13 @@ func TestXEP163_SetNodeConfiguration(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Subscription: "both",
 	})
 
 	// process pubsub command
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.SetType)
@@ -273,12 +275,13 @@ func TestXEP163_DeleteNode(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Subscription: "both",
 	})
 
 	// process pubsub command
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.SetType)
@@ -341,7 +344,7 @@ func TestXEP163_UpdateAffiliations(t *testing.T) {
 	}, "ortuman@jackal.im", "princely_musings")
 
 	// process pubsub command
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	// create new affiliation
 	iqID := uuid.New()
@@ -412,7 +415,7 @@ func TestXEP163_RetrieveAffiliations(t *testing.T) {
 	}, "ortuman@jackal.im", "princely_musings")
 
 	// process pubsub command
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.GetType)
@@ -443,6 +446,26 @@ func TestXEP163_RetrieveAffiliations(t *testing.T) {
 	require.Equal(t, pubsubmodel.Owner, affiliations[0].Attributes().Get("affiliation"))
 	require.Equal(t, "noelia@jackal.im", affiliations[1].Attributes().Get("jid"))
 	require.Equal(t, pubsubmodel.Owner, affiliations[1].Attributes().Get("affiliation"))
+
+	// retrieve last page
+	setElem := xmpp.NewElementNamespace("set", rsmmodel.Namespace)
+	setElem.AppendElement(xmpp.NewElementName("max").SetText("1"))
+	setElem.AppendElement(xmpp.NewElementName("before"))
+	pubSub.AppendElement(setElem)
+
+	p.ProcessIQ(context.Background(), iq)
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	pubSubElem = elem.Elements().ChildNamespace("pubsub", pubSubOwnerNamespace)
+	affiliations = pubSubElem.Elements().Child("affiliations").Elements().Children("affiliation")
+	require.Len(t, affiliations, 1)
+	require.Equal(t, "noelia@jackal.im", affiliations[0].Attributes().Get("jid"))
+
+	resSetElem := pubSubElem.Elements().ChildNamespace("set", rsmmodel.Namespace)
+	require.NotNil(t, resSetElem)
+	require.Equal(t, "1", resSetElem.Elements().Child("first").Attributes().Get("index"))
+	require.Equal(t, "2", resSetElem.Elements().Child("count").Text())
 }
 
 func TestXEP163_UpdateSubscriptions(t *testing.T) {
@@ -467,7 +490,7 @@ func TestXEP163_UpdateSubscriptions(t *testing.T) {
 	}, "ortuman@jackal.im", "princely_musings")
 
 	// process pubsub command
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	// create new subscription
 	iqID := uuid.New()
@@ -540,7 +563,7 @@ func TestXEP163_RetrieveSubscriptions(t *testing.T) {
 	}, "ortuman@jackal.im", "princely_musings")
 
 	// process pubsub command
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.GetType)
@@ -602,12 +625,13 @@ func TestXEP163_Subscribe(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Subscription: "both",
 	})
 
 	// process pubsub command
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.SetType)
@@ -683,6 +707,7 @@ func TestXEP163_Unsubscribe(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Subscription: "both",
 	})
@@ -694,7 +719,7 @@ func TestXEP163_Unsubscribe(t *testing.T) {
 	}, "ortuman@jackal.im", "princely_musings")
 
 	// process pubsub command
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.SetType)
@@ -746,6 +771,7 @@ func TestXEP163_RetrieveItems(t *testing.T) {
 	}, "ortuman@jackal.im", "princely_musings")
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Subscription: "both",
 	})
@@ -763,7 +789,7 @@ func TestXEP163_RetrieveItems(t *testing.T) {
 		Payload:   xmpp.NewElementName("m2"),
 	}, "ortuman@jackal.im", "princely_musings", 2)
 
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	// retrieve all items
 	iqID := uuid.New()
@@ -810,6 +836,50 @@ func TestXEP163_RetrieveItems(t *testing.T) {
 	require.Len(t, items, 1)
 
 	require.Equal(t, "i2", items[0].Attributes().Get("id"))
+
+	// retrieve most recent item
+	itemsCmdElem.RemoveElements("item")
+	itemsCmdElem.SetAttribute("max_items", "1")
+
+	p.ProcessIQ(context.Background(), iq)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	pubSubElem = elem.Elements().ChildNamespace("pubsub", pubSubNamespace)
+	items = pubSubElem.Elements().Child("items").Elements().Children("item")
+	require.Len(t, items, 1)
+	require.Equal(t, "i2", items[0].Attributes().Get("id"))
+	require.Nil(t, pubSubElem.Elements().ChildNamespace("set", rsmmodel.Namespace))
+
+	// retrieve first page
+	itemsCmdElem.RemoveAttribute("max_items")
+
+	setElem := xmpp.NewElementNamespace("set", rsmmodel.Namespace)
+	setElem.AppendElement(xmpp.NewElementName("max").SetText("1"))
+	pubSub.AppendElement(setElem)
+
+	p.ProcessIQ(context.Background(), iq)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	pubSubElem = elem.Elements().ChildNamespace("pubsub", pubSubNamespace)
+	items = pubSubElem.Elements().Child("items").Elements().Children("item")
+	require.Len(t, items, 1)
+	require.Equal(t, "i1", items[0].Attributes().Get("id"))
+
+	resSetElem := pubSubElem.Elements().ChildNamespace("set", rsmmodel.Namespace)
+	require.NotNil(t, resSetElem)
+	require.Equal(t, "i1", resSetElem.Elements().Child("first").Text())
+	require.Equal(t, "i1", resSetElem.Elements().Child("last").Text())
+	require.Equal(t, "2", resSetElem.Elements().Child("count").Text())
+
+	// unknown page
+	setElem.AppendElement(xmpp.NewElementName("after").SetText("i3"))
+
+	p.ProcessIQ(context.Background(), iq)
+	elem = stm2.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
 }
 
 func TestXEP163_SubscribeToAll(t *testing.T) {
@@ -836,10 +906,11 @@ func TestXEP163_SubscribeToAll(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "noelia",
+		Domain:       "jackal.im",
 		JID:          "ortuman@jackal.im",
 		Subscription: "both",
 	})
-	p := New(nil, nil, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
 
 	err := p.subscribeToAll(context.Background(), "noelia@jackal.im", j1)
 	require.Nil(t, err)
@@ -881,6 +952,7 @@ func TestXEP163_FilteredNotifications(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "noelia@jackal.im",
 		Subscription: "both",
 	})
@@ -910,7 +982,7 @@ func TestXEP163_FilteredNotifications(t *testing.T) {
 	_, _ = caps.RegisterPresence(context.Background(), pr2)
 
 	// process pubsub command
-	p := New(nil, caps, r, rosterRep, pubSubRep)
+	p := New(&Config{}, nil, caps, r, rosterRep, pubSubRep)
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.SetType)
@@ -943,6 +1015,241 @@ func TestXEP163_FilteredNotifications(t *testing.T) {
 	require.Equal(t, "bnd81g37d61f49fgn581", itemsEl.Elements().Child("item").Attributes().Get("id"))
 }
 
+func TestXEP163_PublishHandlers(t *testing.T) {
+	r, _, rosterRep, pubSubRep := setupTest("jackal.im")
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetPresence(xmpp.NewPresence(j1, j1, xmpp.AvailableType))
+	r.Bind(context.Background(), stm1)
+
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
+
+	handledCh := make(chan *pubsubmodel.Item, 1)
+	p.RegisterPublishHandler("princely_musings", func(_ context.Context, host string, item *pubsubmodel.Item) {
+		require.Equal(t, "ortuman@jackal.im", host)
+		handledCh <- item
+	})
+
+	// publish through IQ
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(j1.ToBareJID())
+
+	pubSubEl := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	publishEl := xmpp.NewElementName("publish")
+	publishEl.SetAttribute("node", "princely_musings")
+	itemEl := xmpp.NewElementName("item")
+	itemEl.SetAttribute("id", "i1")
+	itemEl.AppendElement(xmpp.NewElementNamespace("entry", "http://www.w3.org/2005/Atom"))
+	publishEl.AppendElement(itemEl)
+	pubSubEl.AppendElement(publishEl)
+	iq.AppendElement(pubSubEl)
+
+	p.ProcessIQ(context.Background(), iq)
+
+	item := <-handledCh
+	require.Equal(t, "i1", item.ID)
+
+	// owner notification + IQ result
+	elem := stm1.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	elem = stm1.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// publish on behalf of host
+	err := p.Publish(context.Background(), "ortuman@jackal.im", "princely_musings", &pubsubmodel.Item{
+		ID:        "i2",
+		Publisher: "ortuman@jackal.im",
+		Payload:   xmpp.NewElementNamespace("entry", "http://www.w3.org/2005/Atom"),
+	}, nil)
+	require.Nil(t, err)
+
+	elem = stm1.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	eventEl := elem.Elements().ChildNamespace("event", pubSubEventNamespace)
+	require.NotNil(t, eventEl)
+	require.Equal(t, "i2", eventEl.Elements().Child("items").Elements().Child("item").Attributes().Get("id"))
+
+	lastItem, _ := pubSubRep.FetchNodeLastItem(context.Background(), "ortuman@jackal.im", "princely_musings")
+	require.NotNil(t, lastItem)
+	require.Equal(t, "i2", lastItem.ID)
+
+	select {
+	case <-handledCh:
+		require.Fail(t, "unexpected publish handler invocation")
+	default:
+		break
+	}
+}
+
+func TestXEP163_PublishOptions(t *testing.T) {
+	r, _, rosterRep, pubSubRep := setupTest("jackal.im")
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetPresence(xmpp.NewPresence(j1, j1, xmpp.AvailableType))
+	r.Bind(context.Background(), stm1)
+
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
+
+	// auto create node applying preconditions
+	p.ProcessIQ(context.Background(), publishOptionsIQ(j1, "i1", pubsubmodel.WhiteList))
+	receiveIQ(stm1)
+
+	n, _ := pubSubRep.FetchNode(context.Background(), "ortuman@jackal.im", "storage:bookmarks")
+	require.NotNil(t, n)
+	require.Equal(t, pubsubmodel.WhiteList, n.Options.AccessModel)
+	require.Equal(t, int64(pubsubmodel.MaxItemsLimit), n.Options.MaxItems)
+
+	// preconditions met
+	p.ProcessIQ(context.Background(), publishOptionsIQ(j1, "i2", pubsubmodel.WhiteList))
+	elem := receiveIQ(stm1)
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// preconditions not met
+	p.ProcessIQ(context.Background(), publishOptionsIQ(j1, "i3", pubsubmodel.Presence))
+	elem = receiveIQ(stm1)
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrConflict.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("precondition-not-met", pubSubErrorNamespace))
+
+	items, _ := pubSubRep.FetchNodeItems(context.Background(), "ortuman@jackal.im", "storage:bookmarks")
+	require.Len(t, items, 2)
+}
+
+func TestXEP163_Retract(t *testing.T) {
+	r, _, rosterRep, pubSubRep := setupTest("jackal.im")
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetPresence(xmpp.NewPresence(j1, j1, xmpp.AvailableType))
+	r.Bind(context.Background(), stm1)
+
+	p := New(&Config{}, nil, nil, r, rosterRep, pubSubRep)
+
+	retractedCh := make(chan string, 1)
+	p.RegisterRetractHandler("princely_musings", func(_ context.Context, host, itemID string) {
+		require.Equal(t, "ortuman@jackal.im", host)
+		retractedCh <- itemID
+	})
+
+	nodeOpts := defaultNodeOptions
+	nodeOpts.MaxItems = 10
+
+	for _, itemID := range []string{"i1", "i2"} {
+		err := p.Publish(context.Background(), "ortuman@jackal.im", "princely_musings", &pubsubmodel.Item{
+			ID:        itemID,
+			Publisher: "ortuman@jackal.im",
+			Payload:   xmpp.NewElementNamespace("entry", "http://www.w3.org/2005/Atom"),
+		}, &nodeOpts)
+		require.Nil(t, err)
+		_ = stm1.ReceiveElement() // owner notification
+	}
+
+	// retract through IQ
+	p.ProcessIQ(context.Background(), retractIQ(j1, "i1"))
+
+	require.Equal(t, "i1", <-retractedCh)
+
+	elem := stm1.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	eventEl := elem.Elements().ChildNamespace("event", pubSubEventNamespace)
+	require.NotNil(t, eventEl)
+	require.Equal(t, "i1", eventEl.Elements().Child("items").Elements().Child("retract").Attributes().Get("id"))
+
+	elem = stm1.ReceiveElement()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	items, _ := pubSubRep.FetchNodeItems(context.Background(), "ortuman@jackal.im", "princely_musings")
+	require.Len(t, items, 1)
+	require.Equal(t, "i2", items[0].ID)
+
+	// item not found
+	p.ProcessIQ(context.Background(), retractIQ(j1, "i1"))
+	elem = stm1.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	// retract on behalf of host
+	require.Nil(t, p.Retract(context.Background(), "ortuman@jackal.im", "princely_musings", "i2"))
+
+	elem = stm1.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+
+	items, _ = pubSubRep.FetchNodeItems(context.Background(), "ortuman@jackal.im", "princely_musings")
+	require.Len(t, items, 0)
+
+	select {
+	case <-retractedCh:
+		require.Fail(t, "unexpected retract handler invocation")
+	default:
+		break
+	}
+}
+
+func receiveIQ(stm *stream.MockC2S) xmpp.XElement {
+	for {
+		elem := stm.ReceiveElement()
+		if elem.Name() == "iq" {
+			return elem
+		}
+	}
+}
+
+func publishOptionsIQ(j *jid.JID, itemID, accessModel string) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	pubSubEl := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	publishEl := xmpp.NewElementName("publish")
+	publishEl.SetAttribute("node", "storage:bookmarks")
+	itemEl := xmpp.NewElementName("item")
+	itemEl.SetAttribute("id", itemID)
+	itemEl.AppendElement(xmpp.NewElementNamespace("storage", "storage:bookmarks"))
+	publishEl.AppendElement(itemEl)
+	pubSubEl.AppendElement(publishEl)
+
+	form := xep0004.DataForm{
+		Type: xep0004.Submit,
+		Fields: xep0004.Fields{
+			{Var: xep0004.FormType, Type: xep0004.Hidden, Values: []string{publishOptionsFormType}},
+			{Var: "pubsub#persist_items", Values: []string{"1"}},
+			{Var: "pubsub#max_items", Values: []string{pubsubmodel.Max}},
+			{Var: "pubsub#access_model", Values: []string{accessModel}},
+		},
+	}
+	publishOptionsEl := xmpp.NewElementName("publish-options")
+	publishOptionsEl.AppendElement(form.Element())
+	pubSubEl.AppendElement(publishOptionsEl)
+
+	iq.AppendElement(pubSubEl)
+	return iq
+}
+
+func retractIQ(j *jid.JID, itemID string) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	pubSubEl := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	retractEl := xmpp.NewElementName("retract")
+	retractEl.SetAttribute("node", "princely_musings")
+	retractEl.SetAttribute("notify", "true")
+	itemEl := xmpp.NewElementName("item")
+	itemEl.SetAttribute("id", itemID)
+	retractEl.AppendElement(itemEl)
+	pubSubEl.AppendElement(retractEl)
+	iq.AppendElement(pubSubEl)
+	return iq
+}
+
 func setupTest(domain string) (router.Router, repository.Presences, repository.Roster, repository.PubSub) {
 	hosts, _ := host.New([]host.Config{{Name: domain, Certificate: tls.Certificate{}}})
 
@@ -951,7 +1258,7 @@ func setupTest(domain string) (router.Router, repository.Presences, repository.R
 	pubSubRep := memorystorage.NewPubSub()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList()),
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
 		nil,
 	)
 	return r, presencesRep, rosterRep, pubSubRep
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0163
+
+import (
+	"encoding/json"
+	"errors"
+
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+const publishOptionsFormType = "http://jabber.org/protocol/pubsub#publish-options"
+
+const rosterGroupsAllowedFieldVar = "pubsub#roster_groups_allowed"
+
+// publishOptions returns the set of preconditions contained in a publish-options form.
+func publishOptions(pubSubEl xmpp.XElement) (map[string]string, error) {
+	publishOptionsEl := pubSubEl.Elements().Child("publish-options")
+	if publishOptionsEl == nil {
+		return nil, nil
+	}
+	formEl := publishOptionsEl.Elements().ChildNamespace("x", xep0004.FormNamespace)
+	if formEl == nil {
+		return nil, nil
+	}
+	form, err := xep0004.NewFormFromElement(formEl)
+	if err != nil {
+		return nil, err
+	}
+	formType := form.Fields.ValueForFieldOfType(xep0004.FormType, xep0004.Hidden)
+	if form.Type != xep0004.Submit || formType != publishOptionsFormType {
+		return nil, errors.New("invalid form type")
+	}
+	preconditions := make(map[string]string)
+	for _, field := range form.Fields {
+		if field.Var == xep0004.FormType {
+			continue
+		}
+		if field.Var == rosterGroupsAllowedFieldVar {
+			b, err := json.Marshal(&field.Values)
+			if err != nil {
+				return nil, err
+			}
+			preconditions[field.Var] = string(b)
+			continue
+		}
+		if len(field.Values) > 0 {
+			preconditions[field.Var] = field.Values[0]
+		}
+	}
+	return preconditions, nil
+}
+
+// applyPublishOptions returns the result of applying a set of preconditions on top of base node options.
+func applyPublishOptions(base *pubsubmodel.Options, preconditions map[string]string) (*pubsubmodel.Options, error) {
+	m, err := base.Map()
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range preconditions {
+		if _, ok := m[k]; !ok {
+			return nil, errors.New("unknown node option: " + k)
+		}
+		m[k] = v
+	}
+	return pubsubmodel.NewOptionsFromMap(m)
+}
+
+// publishOptionsMet tells whether or not node options satisfy a set of publish preconditions.
+func publishOptionsMet(opts *pubsubmodel.Options, preconditions map[string]string) bool {
+	expected, err := applyPublishOptions(opts, preconditions)
+	if err != nil {
+		return false
+	}
+	m1, err := opts.Map()
+	if err != nil {
+		return false
+	}
+	m2, err := expected.Map()
+	if err != nil {
+		return false
+	}
+	for k, v := range m1 {
+		if m2[k] != v {
+			return false
+		}
+	}
+	return true
+}
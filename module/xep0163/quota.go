@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0163
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+)
+
+var errQuotaExceeded = errors.New("pep: quota exceeded")
+
+// nodeQuotaExceeded tells whether or not host already owns the maximum number of allowed nodes.
+func (x *Pep) nodeQuotaExceeded(ctx context.Context, host string) (bool, error) {
+	if x.cfg.MaxNodes == 0 {
+		return false, nil
+	}
+	nodes, err := x.pubSubRep.FetchNodes(ctx, host)
+	if err != nil {
+		return false, err
+	}
+	return len(nodes) >= x.cfg.MaxNodes, nil
+}
+
+// bytesQuotaExceeded tells whether or not persisting item would exceed host overall payload size quota.
+func (x *Pep) bytesQuotaExceeded(ctx context.Context, host, nodeID string, item *pubsubmodel.Item) (bool, error) {
+	if x.cfg.MaxBytes == 0 || item.Payload == nil {
+		return false, nil
+	}
+	size, err := x.pubSubRep.FetchHostItemsSize(ctx, host)
+	if err != nil {
+		return false, err
+	}
+	// discount item being replaced
+	items, err := x.pubSubRep.FetchNodeItemsWithIDs(ctx, host, nodeID, []string{item.ID})
+	if err != nil {
+		return false, err
+	}
+	for _, itm := range items {
+		if itm.Payload != nil {
+			size -= len(itm.Payload.String())
+		}
+	}
+	return size+len(item.Payload.String()) > x.cfg.MaxBytes, nil
+}
+
+// checkPublishQuotas returns errQuotaExceeded in case publishing item would exceed any of host quotas.
+func (x *Pep) checkPublishQuotas(ctx context.Context, host, nodeID string, isNewNode bool, opts *pubsubmodel.Options, item *pubsubmodel.Item) error {
+	if isNewNode {
+		exceeded, err := x.nodeQuotaExceeded(ctx, host)
+		if err != nil {
+			return err
+		}
+		if exceeded {
+			return errQuotaExceeded
+		}
+	}
+	if !opts.PersistItems {
+		return nil
+	}
+	exceeded, err := x.bytesQuotaExceeded(ctx, host, nodeID, item)
+	if err != nil {
+		return err
+	}
+	if exceeded {
+		return errQuotaExceeded
+	}
+	return nil
+}
+
+// maxNodeItems returns the maximum number of items to be persisted by a node.
+func (x *Pep) maxNodeItems(opts *pubsubmodel.Options) int {
+	maxItems := int(opts.MaxItems)
+	if x.cfg.MaxItemsPerNode > 0 && maxItems > x.cfg.MaxItemsPerNode {
+		return x.cfg.MaxItemsPerNode
+	}
+	return maxItems
+}
+
+func (x *Pep) expiryLoop() {
+	tc := time.NewTicker(x.cfg.ExpirySweepInterval)
+	defer tc.Stop()
+	for {
+		select {
+		case <-tc.C:
+			x.sweepExpiredItems(context.Background())
+		case <-x.closeCh:
+			return
+		}
+	}
+}
+
+// sweepExpiredItems retracts expired items, notifying node subscribers as an explicit retraction would do.
+func (x *Pep) sweepExpiredItems(ctx context.Context) {
+	now := time.Now()
+	for nodeID, expiry := range x.cfg.ItemExpiry {
+		expiredItems, err := x.pubSubRep.FetchExpiredNodeItems(ctx, nodeID, now.Add(-expiry))
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		for host, itemIDs := range expiredItems {
+			for _, itemID := range itemIDs {
+				if err := x.Retract(ctx, host, nodeID, itemID); err != nil {
+					log.Error(err)
+				}
+			}
+		}
+		log.Debugf("pep: swept expired items (node_id: %s)", nodeID)
+	}
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0163
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	"github.com/ortuman/jackal/storage/mysql"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP163_NodesQuota(t *testing.T) {
+	r, _, rosterRep, pubSubRep := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+
+	r.Bind(context.Background(), stm)
+
+	p := New(&Config{MaxNodes: 1}, nil, nil, r, rosterRep, pubSubRep)
+	defer func() { _ = p.Shutdown() }()
+
+	p.ProcessIQ(context.Background(), createIQ(j, "princely_musings"))
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// create node
+	p.ProcessIQ(context.Background(), createIQ(j, "princely_musings_2"))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrPolicyViolation.Error(), elem.Error().Elements().All()[0].Name())
+
+	// auto create node
+	p.ProcessIQ(context.Background(), publishIQ(j, "princely_musings_3", "i1", xmpp.NewElementName("entry")))
+	elem = stm.ReceiveElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrPolicyViolation.Error(), elem.Error().Elements().All()[0].Name())
+
+	n, _ := pubSubRep.FetchNode(context.Background(), "ortuman@jackal.im", "princely_musings_3")
+	require.Nil(t, n)
+
+	// server side publish
+	err := p.Publish(context.Background(), "ortuman@jackal.im", "princely_musings_4", &pubsubmodel.Item{
+		ID:        "i1",
+		Publisher: "ortuman@jackal.im",
+		Payload:   xmpp.NewElementName("entry"),
+	}, nil)
+	require.Equal(t, errQuotaExceeded, err)
+}
+
+func TestXEP163_BytesQuota(t *testing.T) {
+	r, _, rosterRep, pubSubRep := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+
+	r.Bind(context.Background(), stm)
+
+	payload := xmpp.NewElementName("entry")
+	payload.SetText("Soliloquy")
+
+	p := New(&Config{MaxBytes: len(payload.String()) + 1}, nil, nil, r, rosterRep, pubSubRep)
+	defer func() { _ = p.Shutdown() }()
+
+	p.ProcessIQ(context.Background(), publishIQ(j, "princely_musings", "i1", payload))
+	elem := receiveIQ(stm)
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// replace item
+	p.ProcessIQ(context.Background(), publishIQ(j, "princely_musings", "i1", payload))
+	elem = receiveIQ(stm)
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// exceed quota
+	p.ProcessIQ(context.Background(), publishIQ(j, "princely_musings", "i2", payload))
+	elem = receiveIQ(stm)
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrPolicyViolation.Error(), elem.Error().Elements().All()[0].Name())
+
+	items, _ := pubSubRep.FetchNodeItems(context.Background(), "ortuman@jackal.im", "princely_musings")
+	require.Len(t, items, 1)
+	require.Equal(t, "i1", items[0].ID)
+}
+
+func TestXEP163_MaxItemsPerNode(t *testing.T) {
+	r, _, rosterRep, pubSubRep := setupTest("jackal.im")
+
+	p := New(&Config{MaxItemsPerNode: 2}, nil, nil, r, rosterRep, pubSubRep)
+	defer func() { _ = p.Shutdown() }()
+
+	opts := defaultNodeOptions
+	opts.MaxItems = pubsubmodel.MaxItemsLimit
+
+	for _, itemID := range []string{"i1", "i2", "i3"} {
+		err := p.Publish(context.Background(), "ortuman@jackal.im", "princely_musings", &pubsubmodel.Item{
+			ID:        itemID,
+			Publisher: "ortuman@jackal.im",
+			Payload:   xmpp.NewElementName("entry"),
+		}, &opts)
+		require.Nil(t, err)
+	}
+	items, _ := pubSubRep.FetchNodeItems(context.Background(), "ortuman@jackal.im", "princely_musings")
+	require.Len(t, items, 2)
+	require.Equal(t, "i2", items[0].ID)
+	require.Equal(t, "i3", items[1].ID)
+}
+
+func TestXEP163_ItemExpiry(t *testing.T) {
+	r, _, rosterRep, pubSubRep := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+
+	r.Bind(context.Background(), stm)
+
+	cfg := &Config{
+		ItemExpiry: map[string]time.Duration{
+			"http://jabber.org/protocol/geoloc": time.Millisecond,
+		},
+		ExpirySweepInterval: time.Hour,
+	}
+	p := New(cfg, nil, nil, r, rosterRep, pubSubRep)
+	defer func() { _ = p.Shutdown() }()
+
+	for _, nodeID := range []string{"http://jabber.org/protocol/geoloc", "http://jabber.org/protocol/tune"} {
+		err := p.Publish(context.Background(), "ortuman@jackal.im", nodeID, &pubsubmodel.Item{
+			ID:        "i1",
+			Publisher: "ortuman@jackal.im",
+			Payload:   xmpp.NewElementName("entry"),
+		}, nil)
+		require.Nil(t, err)
+		_ = stm.ReceiveElement() // owner notification
+	}
+	time.Sleep(time.Millisecond * 5)
+
+	p.sweepExpiredItems(context.Background())
+
+	// expect retract notification
+	elem := stm.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	itemsEl := elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items")
+	require.Equal(t, "http://jabber.org/protocol/geoloc", itemsEl.Attributes().Get("node"))
+	require.Equal(t, "i1", itemsEl.Elements().Child("retract").Attributes().Get("id"))
+
+	items, _ := pubSubRep.FetchNodeItems(context.Background(), "ortuman@jackal.im", "http://jabber.org/protocol/geoloc")
+	require.Len(t, items, 0)
+
+	items, _ = pubSubRep.FetchNodeItems(context.Background(), "ortuman@jackal.im", "http://jabber.org/protocol/tune")
+	require.Len(t, items, 1)
+}
+
+func createIQ(j *jid.JID, nodeID string) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	pubSub := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	create := xmpp.NewElementName("create")
+	create.SetAttribute("node", nodeID)
+	pubSub.AppendElement(create)
+	iq.AppendElement(pubSub)
+	return iq
+}
+
+func publishIQ(j *jid.JID, nodeID, itemID string, payload xmpp.XElement) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	pubSub := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	publish := xmpp.NewElementName("publish")
+	publish.SetAttribute("node", nodeID)
+	item := xmpp.NewElementName("item")
+	item.SetAttribute("id", itemID)
+	item.AppendElement(payload)
+	publish.AppendElement(item)
+	pubSub.AppendElement(publish)
+	iq.AppendElement(pubSub)
+	return iq
+}
+
+func TestXEP163_BytesQuotaSQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.Nil(t, err)
+	defer func() { _ = db.Close() }()
+
+	payload := xmpp.NewElementName("entry")
+	payload.SetText("Soliloquy")
+	payloadSize := len(payload.String())
+
+	p := &Pep{cfg: &Config{MaxBytes: payloadSize + 1}, pubSubRep: mysql.NewPubSub(db)}
+
+	itemsQuery := "SELECT item_id, publisher, payload, updated_at FROM pubsub_items WHERE \\(node_id = \\(SELECT id FROM pubsub_nodes WHERE host = \\? AND name = \\?\\) AND item_id IN \\(\\?\\)\\) ORDER BY created_at"
+
+	// replacing a stored item discounts its payload
+	mock.ExpectQuery("SELECT COALESCE\\(SUM\\(OCTET_LENGTH\\(payload\\)\\), 0\\) FROM pubsub_items WHERE node_id IN \\(SELECT id FROM pubsub_nodes WHERE host = \\?\\)").
+		WithArgs("ortuman@jackal.im").
+		WillReturnRows(sqlmock.NewRows([]string{"size"}).AddRow(payloadSize))
+	mock.ExpectQuery(itemsQuery).
+		WithArgs("ortuman@jackal.im", "princely_musings", "i1").
+		WillReturnRows(sqlmock.NewRows([]string{"item_id", "publisher", "payload", "updated_at"}).
+			AddRow("i1", "ortuman@jackal.im", payload.String(), time.Now()))
+
+	exceeded, err := p.bytesQuotaExceeded(context.Background(), "ortuman@jackal.im", "princely_musings", &pubsubmodel.Item{ID: "i1", Payload: payload})
+	require.Nil(t, err)
+	require.False(t, exceeded)
+
+	// a new item adds up to the stored payloads
+	mock.ExpectQuery("SELECT COALESCE\\(SUM\\(OCTET_LENGTH\\(payload\\)\\), 0\\) FROM pubsub_items WHERE node_id IN \\(SELECT id FROM pubsub_nodes WHERE host = \\?\\)").
+		WithArgs("ortuman@jackal.im").
+		WillReturnRows(sqlmock.NewRows([]string{"size"}).AddRow(payloadSize))
+	mock.ExpectQuery(itemsQuery).
+		WithArgs("ortuman@jackal.im", "princely_musings", "i2").
+		WillReturnRows(sqlmock.NewRows([]string{"item_id", "publisher", "payload", "updated_at"}))
+
+	exceeded, err = p.bytesQuotaExceeded(context.Background(), "ortuman@jackal.im", "princely_musings", &pubsubmodel.Item{ID: "i2", Payload: payload})
+	require.Nil(t, err)
+	require.True(t, exceeded)
+
+	require.Nil(t, mock.ExpectationsWereMet())
+}
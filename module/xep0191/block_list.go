@@ -30,7 +30,7 @@ const (
 
 // BlockingCommand represents a blocking command IQ handler module.
 type BlockingCommand struct {
-	runQueue     *runqueue.RunQueue
+	runQueue     *runqueue.ShardedRunQueue
 	router       router.Router
 	blockListRep repository.BlockList
 	rosterRep    repository.Roster
@@ -40,7 +40,7 @@ type BlockingCommand struct {
 // New returns a blocking command IQ handler module.
 func New(disco *xep0030.DiscoInfo, entityCaps *xep0115.EntityCaps, router router.Router, rosterRep repository.Roster, blockListRep repository.BlockList) *BlockingCommand {
 	b := &BlockingCommand{
-		runQueue:     runqueue.New("xep0191"),
+		runQueue:     runqueue.NewSharded("xep0191", 0),
 		router:       router,
 		blockListRep: blockListRep,
 		rosterRep:    rosterRep,
@@ -64,8 +64,8 @@ func (x *BlockingCommand) MatchesIQ(iq *xmpp.IQ) bool {
 
 // ProcessIQ processes a blocking command IQ taking according actions over the associated stream.
 func (x *BlockingCommand) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
-	x.runQueue.Run(func() {
-		stm := x.router.LocalStream(iq.FromJID().Node(), iq.FromJID().Resource())
+	x.runQueue.Run(iq.FromJID().ToBareJID().String(), func() {
+		stm := x.router.LocalStream(iq.FromJID())
 		if stm == nil {
 			return
 		}
@@ -96,7 +96,7 @@ func (x *BlockingCommand) processIQ(ctx context.Context, iq *xmpp.IQ, stm stream
 
 func (x *BlockingCommand) sendBlockList(ctx context.Context, iq *xmpp.IQ, stm stream.C2S) {
 	fromJID := iq.FromJID()
-	blItems, err := x.blockListRep.FetchBlockListItems(ctx, fromJID.Node())
+	blItems, err := x.blockListRep.FetchBlockListItems(ctx, fromJID.ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		stm.SendElement(ctx, iq.InternalServerError())
@@ -127,19 +127,19 @@ func (x *BlockingCommand) block(ctx context.Context, iq *xmpp.IQ, block xmpp.XEl
 		stm.SendElement(ctx, iq.JidMalformedError())
 		return
 	}
-	blItems, ris, err := x.fetchBlockListAndRosterItems(ctx, stm.Username())
+	blItems, ris, err := x.fetchBlockListAndRosterItems(ctx, stm.JID().ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		stm.SendElement(ctx, iq.InternalServerError())
 		return
 	}
-	username := stm.Username()
 	for _, j := range jds {
 		if x.isJIDInBlockList(j, blItems) {
 			continue
 		}
 		err := x.blockListRep.InsertBlockListItem(ctx, &model.BlockListItem{
-			Username: username,
+			Username: stm.Username(),
+			Domain:   stm.Domain(),
 			JID:      j.String(),
 		})
 		if err != nil {
@@ -162,9 +162,7 @@ func (x *BlockingCommand) unblock(ctx context.Context, iq *xmpp.IQ, unblock xmpp
 		stm.SendElement(ctx, iq.JidMalformedError())
 		return
 	}
-	username := stm.Username()
-
-	blItems, ris, err := x.fetchBlockListAndRosterItems(ctx, username)
+	blItems, ris, err := x.fetchBlockListAndRosterItems(ctx, stm.JID().ToBareJID().String())
 	if err != nil {
 		log.Error(err)
 		stm.SendElement(ctx, iq.InternalServerError())
@@ -176,7 +174,8 @@ func (x *BlockingCommand) unblock(ctx context.Context, iq *xmpp.IQ, unblock xmpp
 				continue
 			}
 			if err := x.blockListRep.DeleteBlockListItem(ctx, &model.BlockListItem{
-				Username: username,
+				Username: stm.Username(),
+				Domain:   stm.Domain(),
 				JID:      j.String(),
 			}); err != nil {
 				log.Error(err)
@@ -203,7 +202,7 @@ func (x *BlockingCommand) unblock(ctx context.Context, iq *xmpp.IQ, unblock xmpp
 }
 
 func (x *BlockingCommand) pushIQ(ctx context.Context, elem xmpp.XElement, stm stream.C2S) {
-	streams := x.router.LocalStreams(stm.Username())
+	streams := x.router.LocalStreams(stm.JID())
 	for _, stm := range streams {
 		requested, _ := stm.Value(xep191RequestedContextKey).(bool)
 		if !requested {
@@ -256,12 +255,12 @@ func (x *BlockingCommand) isSubscribedTo(jid *jid.JID, ris []rostermodel.Item) b
 	return false
 }
 
-func (x *BlockingCommand) fetchBlockListAndRosterItems(ctx context.Context, username string) ([]model.BlockListItem, []rostermodel.Item, error) {
-	blItems, err := x.blockListRep.FetchBlockListItems(ctx, username)
+func (x *BlockingCommand) fetchBlockListAndRosterItems(ctx context.Context, userJID string) ([]model.BlockListItem, []rostermodel.Item, error) {
+	blItems, err := x.blockListRep.FetchBlockListItems(ctx, userJID)
 	if err != nil {
 		return nil, nil, err
 	}
-	ris, _, err := x.rosterRep.FetchRosterItems(ctx, username)
+	ris, _, err := x.rosterRep.FetchRosterItems(ctx, userJID)
 	if err != nil {
 		return nil, nil, err
 	}
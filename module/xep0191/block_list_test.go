@@ -76,10 +76,12 @@ func TestXEP0191_GetBlockList(t *testing.T) {
 
 	_ = blockListRep.InsertBlockListItem(context.Background(), &model.BlockListItem{
 		Username: "ortuman",
+		Domain:   "jackal.im",
 		JID:      "hamlet@jackal.im/garden",
 	})
 	_ = blockListRep.InsertBlockListItem(context.Background(), &model.BlockListItem{
 		Username: "ortuman",
+		Domain:   "jackal.im",
 		JID:      "jabber.org",
 	})
 
@@ -154,6 +156,7 @@ func TestXEP191_BlockAndUnblock(t *testing.T) {
 
 	_, _ = rosterRep.UpsertRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
+		Domain:       "jackal.im",
 		JID:          "romeo@jackal.im",
 		Subscription: "both",
 	})
@@ -212,7 +215,7 @@ func TestXEP191_BlockAndUnblock(t *testing.T) {
 	require.Equal(t, xmpp.SetType, elem.Type())
 
 	// check storage
-	bl, _ := blockListRep.FetchBlockListItems(context.Background(), "ortuman")
+	bl, _ := blockListRep.FetchBlockListItems(context.Background(), "ortuman@jackal.im")
 	require.NotNil(t, bl)
 	require.Equal(t, 1, len(bl))
 	require.Equal(t, "jackal.im/jail", bl[0].JID)
@@ -261,10 +264,12 @@ func TestXEP191_BlockAndUnblock(t *testing.T) {
 	// test full unblock
 	_ = blockListRep.InsertBlockListItem(context.Background(), &model.BlockListItem{
 		Username: "ortuman",
+		Domain:   "jackal.im",
 		JID:      "hamlet@jackal.im/garden",
 	})
 	_ = blockListRep.InsertBlockListItem(context.Background(), &model.BlockListItem{
 		Username: "ortuman",
+		Domain:   "jackal.im",
 		JID:      "jabber.org",
 	})
 
@@ -279,7 +284,7 @@ func TestXEP191_BlockAndUnblock(t *testing.T) {
 
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	blItems, _ := blockListRep.FetchBlockListItems(context.Background(), "ortuman")
+	blItems, _ := blockListRep.FetchBlockListItems(context.Background(), "ortuman@jackal.im")
 	require.Equal(t, 0, len(blItems))
 }
 
@@ -291,7 +296,7 @@ func setupTest(domain string) (router.Router, repository.Presences, repository.B
 	rosterRep := memorystorage.NewRoster()
 	r, _ := router.New(
 		hosts,
-		c2srouter.New(memorystorage.NewUser(), blockListRep),
+		c2srouter.New(memorystorage.NewUser(), blockListRep, nil),
 		nil,
 	)
 	return r, presencesRep, blockListRep, rosterRep
@@ -91,7 +91,7 @@ func (x *Ping) MatchesIQ(iq *xmpp.IQ) bool {
 // ProcessIQ processes a ping IQ taking according actions over the associated stream.
 func (x *Ping) ProcessIQ(ctx context.Context, iq *xmpp.IQ) {
 	x.runQueue.Run(func() {
-		stm := x.router.LocalStream(iq.FromJID().Node(), iq.FromJID().Resource())
+		stm := x.router.LocalStream(iq.FromJID())
 		if stm == nil {
 			return
 		}
@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0292
+
+import (
+	"strings"
+
+	utilstring "github.com/ortuman/jackal/util/string"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+// nameFields maps vcard-temp N sub-elements to their vCard4 counterparts.
+var nameFields = [][2]string{
+	{"FAMILY", "surname"},
+	{"GIVEN", "given"},
+	{"MIDDLE", "additional"},
+	{"PREFIX", "prefix"},
+	{"SUFFIX", "suffix"},
+}
+
+// adrFields maps vcard-temp ADR sub-elements to their vCard4 counterparts.
+var adrFields = [][2]string{
+	{"POBOX", "pobox"},
+	{"EXTADD", "ext"},
+	{"STREET", "street"},
+	{"LOCALITY", "locality"},
+	{"REGION", "region"},
+	{"PCODE", "code"},
+	{"CTRY", "country"},
+}
+
+// telTypes maps vcard-temp TEL flags to vCard4 type parameter values.
+var telTypes = [][2]string{
+	{"HOME", "home"},
+	{"WORK", "work"},
+	{"VOICE", "voice"},
+	{"FAX", "fax"},
+	{"PAGER", "pager"},
+	{"MSG", "text"},
+	{"CELL", "cell"},
+	{"VIDEO", "video"},
+}
+
+// locationTypes maps vcard-temp EMAIL and ADR flags to vCard4 type parameter values.
+var locationTypes = [][2]string{
+	{"HOME", "home"},
+	{"WORK", "work"},
+}
+
+// convertedVCardTempFields contains all vcard-temp fields handled by the conversion.
+var convertedVCardTempFields = map[string]bool{
+	"FN": true, "N": true, "NICKNAME": true, "EMAIL": true, "TEL": true, "ADR": true, "PHOTO": true,
+}
+
+// convertedVCard4Fields contains all vCard4 properties handled by the conversion.
+var convertedVCard4Fields = map[string]bool{
+	"fn": true, "n": true, "nickname": true, "email": true, "tel": true, "adr": true, "photo": true,
+}
+
+// toVCard4 converts a vcard-temp element into its vCard4 representation.
+// Properties not handled by the conversion are taken from base, if any.
+func toVCard4(vCardTemp, base xmpp.XElement) xmpp.XElement {
+	vCard4 := xmpp.NewElementNamespace("vcard", vCard4Namespace)
+	if base != nil {
+		for _, el := range base.Elements().All() {
+			if !convertedVCard4Fields[el.Name()] {
+				vCard4.AppendElement(el)
+			}
+		}
+	}
+	for _, el := range vCardTemp.Elements().All() {
+		switch el.Name() {
+		case "FN":
+			vCard4.AppendElement(textProperty("fn", "text", text(el)))
+
+		case "NICKNAME":
+			vCard4.AppendElement(textProperty("nickname", "text", text(el)))
+
+		case "N":
+			n := xmpp.NewElementName("n")
+			for _, f := range nameFields {
+				n.AppendElement(xmpp.NewElementName(f[1]).SetText(childText(el, f[0])))
+			}
+			vCard4.AppendElement(n)
+
+		case "EMAIL":
+			email := xmpp.NewElementName("email")
+			appendParameters(email, el, locationTypes)
+			email.AppendElement(xmpp.NewElementName("text").SetText(childText(el, "USERID")))
+			vCard4.AppendElement(email)
+
+		case "TEL":
+			tel := xmpp.NewElementName("tel")
+			appendParameters(tel, el, telTypes)
+			tel.AppendElement(xmpp.NewElementName("uri").SetText("tel:" + childText(el, "NUMBER")))
+			vCard4.AppendElement(tel)
+
+		case "ADR":
+			adr := xmpp.NewElementName("adr")
+			appendParameters(adr, el, locationTypes)
+			for _, f := range adrFields {
+				adr.AppendElement(xmpp.NewElementName(f[1]).SetText(childText(el, f[0])))
+			}
+			vCard4.AppendElement(adr)
+
+		case "PHOTO":
+			var uri string
+			if binVal := el.Elements().Child("BINVAL"); binVal != nil {
+				uri = "data:" + childText(el, "TYPE") + ";base64," + utilstring.StripSpaces(binVal.Text())
+			} else {
+				uri = childText(el, "EXTVAL")
+			}
+			if len(uri) > 0 {
+				vCard4.AppendElement(textProperty("photo", "uri", uri))
+			}
+		}
+	}
+	return vCard4
+}
+
+// toVCardTemp converts a vCard4 element into its vcard-temp representation.
+// Fields not handled by the conversion are taken from base, if any.
+func toVCardTemp(vCard4, base xmpp.XElement) xmpp.XElement {
+	vCardTemp := xmpp.NewElementNamespace("vCard", vCardNamespace)
+	if base != nil {
+		for _, el := range base.Elements().All() {
+			if !convertedVCardTempFields[el.Name()] {
+				vCardTemp.AppendElement(el)
+			}
+		}
+	}
+	for _, el := range vCard4.Elements().All() {
+		switch el.Name() {
+		case "fn":
+			vCardTemp.AppendElement(xmpp.NewElementName("FN").SetText(childText(el, "text")))
+
+		case "nickname":
+			vCardTemp.AppendElement(xmpp.NewElementName("NICKNAME").SetText(childText(el, "text")))
+
+		case "n":
+			n := xmpp.NewElementName("N")
+			for _, f := range nameFields {
+				n.AppendElement(xmpp.NewElementName(f[0]).SetText(childText(el, f[1])))
+			}
+			vCardTemp.AppendElement(n)
+
+		case "email":
+			email := xmpp.NewElementName("EMAIL")
+			appendFlags(email, el, locationTypes)
+			email.AppendElement(xmpp.NewElementName("INTERNET"))
+			email.AppendElement(xmpp.NewElementName("USERID").SetText(childText(el, "text")))
+			vCardTemp.AppendElement(email)
+
+		case "tel":
+			number := childText(el, "uri")
+			if len(number) == 0 {
+				number = childText(el, "text")
+			}
+			tel := xmpp.NewElementName("TEL")
+			appendFlags(tel, el, telTypes)
+			tel.AppendElement(xmpp.NewElementName("NUMBER").SetText(strings.TrimPrefix(number, "tel:")))
+			vCardTemp.AppendElement(tel)
+
+		case "adr":
+			adr := xmpp.NewElementName("ADR")
+			appendFlags(adr, el, locationTypes)
+			for _, f := range adrFields {
+				adr.AppendElement(xmpp.NewElementName(f[0]).SetText(childText(el, f[1])))
+			}
+			vCardTemp.AppendElement(adr)
+
+		case "photo":
+			uri := childText(el, "uri")
+			if len(uri) == 0 {
+				continue
+			}
+			photo := xmpp.NewElementName("PHOTO")
+			if mimeType, data, ok := parseDataURI(uri); ok {
+				if len(mimeType) > 0 {
+					photo.AppendElement(xmpp.NewElementName("TYPE").SetText(mimeType))
+				}
+				photo.AppendElement(xmpp.NewElementName("BINVAL").SetText(data))
+			} else {
+				photo.AppendElement(xmpp.NewElementName("EXTVAL").SetText(uri))
+			}
+			vCardTemp.AppendElement(photo)
+		}
+	}
+	return vCardTemp
+}
+
+// appendParameters appends vCard4 type and pref parameters derived from vcard-temp flag elements.
+func appendParameters(prop *xmpp.Element, vCardTempEl xmpp.XElement, types [][2]string) {
+	typeEl := xmpp.NewElementName("type")
+	for _, t := range types {
+		if vCardTempEl.Elements().Child(t[0]) != nil {
+			typeEl.AppendElement(xmpp.NewElementName("text").SetText(t[1]))
+		}
+	}
+	isPref := vCardTempEl.Elements().Child("PREF") != nil
+	if typeEl.Elements().Count() == 0 && !isPref {
+		return
+	}
+	params := xmpp.NewElementName("parameters")
+	if typeEl.Elements().Count() > 0 {
+		params.AppendElement(typeEl)
+	}
+	if isPref {
+		pref := xmpp.NewElementName("pref")
+		pref.AppendElement(xmpp.NewElementName("integer").SetText("1"))
+		params.AppendElement(pref)
+	}
+	prop.AppendElement(params)
+}
+
+// appendFlags appends vcard-temp flag elements derived from vCard4 type and pref parameters.
+func appendFlags(el *xmpp.Element, vCard4Prop xmpp.XElement, types [][2]string) {
+	params := vCard4Prop.Elements().Child("parameters")
+	if params == nil {
+		return
+	}
+	if typeEl := params.Elements().Child("type"); typeEl != nil {
+		for _, t := range types {
+			for _, txt := range typeEl.Elements().Children("text") {
+				if strings.EqualFold(strings.TrimSpace(txt.Text()), t[1]) {
+					el.AppendElement(xmpp.NewElementName(t[0]))
+					break
+				}
+			}
+		}
+	}
+	if pref := params.Elements().Child("pref"); pref != nil && childText(pref, "integer") == "1" {
+		el.AppendElement(xmpp.NewElementName("PREF"))
+	}
+}
+
+func textProperty(name, valueType, value string) xmpp.XElement {
+	prop := xmpp.NewElementName(name)
+	prop.AppendElement(xmpp.NewElementName(valueType).SetText(value))
+	return prop
+}
+
+// parseDataURI splits a base64 encoded data URI into its MIME type and payload.
+func parseDataURI(uri string) (mimeType string, data string, ok bool) {
+	if !strings.HasPrefix(uri, "data:") {
+		return "", "", false
+	}
+	idx := strings.Index(uri, ",")
+	if idx == -1 {
+		return "", "", false
+	}
+	meta := uri[len("data:"):idx]
+	if !strings.HasSuffix(meta, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(meta, ";base64"), uri[idx+1:], true
+}
+
+func childText(el xmpp.XElement, name string) string {
+	child := el.Elements().Child(name)
+	if child == nil {
+		return ""
+	}
+	return text(child)
+}
+
+func text(el xmpp.XElement) string {
+	return strings.TrimSpace(el.Text())
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0292
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0292_ToVCard4(t *testing.T) {
+	vCardTemp := loadFixture(t, "vcard_temp.xml")
+	expected := loadFixture(t, "vcard4.xml")
+
+	vCard4 := toVCard4(vCardTemp, nil)
+	require.Equal(t, "vcard", vCard4.Name())
+	require.Equal(t, vCard4Namespace, vCard4.Namespace())
+	require.Equal(t, convertedFields(expected, convertedVCard4Fields), convertedFields(vCard4, convertedVCard4Fields))
+
+	// unhandled vcard-temp fields are discarded
+	require.Nil(t, vCard4.Elements().Child("URL"))
+	require.Nil(t, vCard4.Elements().Child("bday"))
+
+	// unhandled vCard4 properties are preserved
+	vCard4 = toVCard4(vCardTemp, expected)
+	require.NotNil(t, vCard4.Elements().Child("bday"))
+	require.Equal(t, convertedFields(expected, convertedVCard4Fields), convertedFields(vCard4, convertedVCard4Fields))
+}
+
+func TestXEP0292_ToVCardTemp(t *testing.T) {
+	vCard4 := loadFixture(t, "vcard4.xml")
+	expected := loadFixture(t, "vcard_temp.xml")
+
+	vCardTemp := toVCardTemp(vCard4, nil)
+	require.Equal(t, "vCard", vCardTemp.Name())
+	require.Equal(t, vCardNamespace, vCardTemp.Namespace())
+	require.Equal(t, convertedFields(expected, convertedVCardTempFields), convertedFields(vCardTemp, convertedVCardTempFields))
+
+	require.Nil(t, vCardTemp.Elements().Child("URL"))
+
+	// unhandled vcard-temp fields are preserved
+	vCardTemp = toVCardTemp(vCard4, expected)
+	require.Equal(t, "http://www.xmpp.org/xsf/people/stpeter.shtml", childText(vCardTemp, "URL"))
+	require.Equal(t, convertedFields(expected, convertedVCardTempFields), convertedFields(vCardTemp, convertedVCardTempFields))
+}
+
+func TestXEP0292_ConvertPhoto(t *testing.T) {
+	extVal := xmpp.NewElementName("EXTVAL").SetText("https://jackal.im/avatar.png")
+	photo := xmpp.NewElementName("PHOTO")
+	photo.AppendElement(extVal)
+	vCardTemp := xmpp.NewElementNamespace("vCard", vCardNamespace)
+	vCardTemp.AppendElement(photo)
+
+	vCard4 := toVCard4(vCardTemp, nil)
+	require.Equal(t, "https://jackal.im/avatar.png", childText(vCard4.Elements().Child("photo"), "uri"))
+
+	vCardTemp2 := toVCardTemp(vCard4, nil)
+	require.Equal(t, "https://jackal.im/avatar.png", childText(vCardTemp2.Elements().Child("PHOTO"), "EXTVAL"))
+	require.Nil(t, vCardTemp2.Elements().Child("PHOTO").Elements().Child("BINVAL"))
+
+	mimeType, data, ok := parseDataURI("data:image/jpeg;base64,AAAA")
+	require.True(t, ok)
+	require.Equal(t, "image/jpeg", mimeType)
+	require.Equal(t, "AAAA", data)
+
+	_, _, ok = parseDataURI("data:text/plain,hello")
+	require.False(t, ok)
+}
+
+var interElementSpaces = regexp.MustCompile(`>\s+<`)
+
+func loadFixture(t *testing.T, name string) xmpp.XElement {
+	b, err := ioutil.ReadFile("testdata/" + name)
+	require.Nil(t, err)
+	b = interElementSpaces.ReplaceAll(b, []byte("><"))
+
+	p := xmpp.NewParser(bytes.NewReader(b), xmpp.DefaultMode, 0)
+	elem, err := p.ParseElement()
+	require.Nil(t, err)
+	require.NotNil(t, elem)
+	return elem
+}
+
+// convertedFields returns the normalized representation of all converted elements.
+func convertedFields(vCard xmpp.XElement, fields map[string]bool) []string {
+	var ret []string
+	for _, el := range vCard.Elements().All() {
+		if fields[el.Name()] {
+			ret = append(ret, normalize(el).String())
+		}
+	}
+	return ret
+}
+
+func normalize(el xmpp.XElement) xmpp.XElement {
+	ret := xmpp.NewElementName(el.Name())
+	if el.Elements().Count() == 0 {
+		ret.SetText(strings.TrimSpace(el.Text()))
+	}
+	for _, child := range el.Elements().All() {
+		ret.AppendElement(normalize(child))
+	}
+	return ret
+}
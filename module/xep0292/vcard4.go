@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0292
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ortuman/jackal/log"
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/module/xep0054"
+	"github.com/ortuman/jackal/module/xep0163"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/util/runqueue"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	vCardNamespace  = "vcard-temp"
+	vCard4Namespace = "urn:ietf:params:xml:ns:vcard-4.0"
+
+	vCard4NodeID = "urn:xmpp:vcard4"
+
+	conversionFeature = "urn:xmpp:pep-vcard-conversion:0"
+
+	// currentItemID represents the identifier of the item holding the user vCard4.
+	currentItemID = "current"
+)
+
+// VCard4 represents a vCard4 over PubSub module.
+// It keeps the urn:xmpp:vcard4 PEP node and the vcard-temp storage in sync.
+type VCard4 struct {
+	pep       *xep0163.Pep
+	vCard     *xep0054.VCard
+	runQueue  *runqueue.ShardedRunQueue
+	vCardRep  repository.VCard
+	pubSubRep repository.PubSub
+
+	mu      sync.Mutex
+	storing map[string]xmpp.XElement // converted vcard-temp elements being stored
+}
+
+// New returns a vCard4 over PubSub module.
+func New(disco *xep0030.DiscoInfo, pep *xep0163.Pep, vCard *xep0054.VCard, vCardRep repository.VCard, pubSubRep repository.PubSub) *VCard4 {
+	x := &VCard4{
+		pep:       pep,
+		vCard:     vCard,
+		runQueue:  runqueue.NewSharded("xep0292", 0),
+		vCardRep:  vCardRep,
+		pubSubRep: pubSubRep,
+		storing:   make(map[string]xmpp.XElement),
+	}
+	if disco != nil {
+		disco.RegisterAccountFeature(conversionFeature)
+	}
+	if pep != nil {
+		pep.RegisterPublishHandler(vCard4NodeID, x.onVCard4Published)
+	}
+	if vCard != nil {
+		vCard.RegisterUpdateHandler(x.onVCardUpdated)
+	}
+	return x
+}
+
+// Shutdown shuts down vCard4 module.
+func (x *VCard4) Shutdown() error {
+	c := make(chan struct{})
+	x.runQueue.Stop(func() { close(c) })
+	<-c
+	return nil
+}
+
+func (x *VCard4) onVCardUpdated(ctx context.Context, userJID *jid.JID, vCard xmpp.XElement) {
+	bareJID := userJID.ToBareJID().String()
+
+	x.mu.Lock()
+	isConverted := x.storing[bareJID] == vCard
+	x.mu.Unlock()
+	if isConverted {
+		return // already published as vCard4
+	}
+	x.runQueue.Run(bareJID, func() {
+		if err := x.publishVCard4(ctx, bareJID, vCard); err != nil {
+			log.Error(err)
+		}
+	})
+}
+
+func (x *VCard4) onVCard4Published(ctx context.Context, host string, item *pubsubmodel.Item) {
+	x.runQueue.Run(host, func() {
+		if err := x.storeVCardTemp(ctx, host, item.Payload); err != nil {
+			log.Error(err)
+		}
+	})
+}
+
+// publishVCard4 publishes the vCard4 representation of a vcard-temp element.
+func (x *VCard4) publishVCard4(ctx context.Context, bareJID string, vCardTemp xmpp.XElement) error {
+	var current xmpp.XElement
+
+	item, err := x.pubSubRep.FetchNodeLastItem(ctx, bareJID, vCard4NodeID)
+	if err != nil {
+		return err
+	}
+	if item != nil {
+		current = item.Payload
+	}
+	vCard4 := toVCard4(vCardTemp, current)
+	if current != nil && current.String() == vCard4.String() {
+		return nil // nothing changed
+	}
+	err = x.pep.Publish(ctx, bareJID, vCard4NodeID, &pubsubmodel.Item{
+		ID:        currentItemID,
+		Publisher: bareJID,
+		Payload:   vCard4,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	log.Infof("vcard4: published converted vcard-temp (jid: %s)", bareJID)
+	return nil
+}
+
+// storeVCardTemp stores the vcard-temp representation of a published vCard4 element.
+func (x *VCard4) storeVCardTemp(ctx context.Context, bareJID string, vCard4 xmpp.XElement) error {
+	if vCard4 == nil || vCard4.Name() != "vcard" || vCard4.Namespace() != vCard4Namespace {
+		log.Warnf("vcard4: invalid published payload (jid: %s)", bareJID)
+		return nil
+	}
+	current, err := x.vCardRep.FetchVCard(ctx, bareJID)
+	if err != nil {
+		return err
+	}
+	vCardTemp := toVCardTemp(vCard4, current)
+	if current != nil && current.String() == vCardTemp.String() {
+		return nil // nothing changed
+	}
+	// store through vCard module so that the rest of update handlers get notified
+	userJID, err := jid.NewWithString(bareJID, true)
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	x.storing[bareJID] = vCardTemp
+	x.mu.Unlock()
+
+	err = x.vCard.UpdateVCard(ctx, userJID, vCardTemp)
+
+	x.mu.Lock()
+	delete(x.storing, bareJID)
+	x.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	log.Infof("vcard4: stored converted vcard-temp (jid: %s)", bareJID)
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0292
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"testing"
+
+	c2srouter "github.com/ortuman/jackal/c2s/router"
+	"github.com/ortuman/jackal/module/xep0054"
+	"github.com/ortuman/jackal/module/xep0163"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/router/host"
+	memorystorage "github.com/ortuman/jackal/storage/memory"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0292_VCardTempToVCard4(t *testing.T) {
+	r, vCardRep, pubSubRep := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	pep := xep0163.New(&xep0163.Config{}, nil, nil, r, memorystorage.NewRoster(), pubSubRep)
+	vCard := xep0054.New(nil, r, vCardRep)
+	x := New(nil, pep, vCard, vCardRep, pubSubRep)
+	defer func() { _ = x.Shutdown(); _ = vCard.Shutdown(); _ = pep.Shutdown() }()
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(loadFixture(t, "vcard_temp.xml"))
+
+	vCard.ProcessIQ(context.Background(), iq)
+	receiveIQResult(t, stm)
+
+	waitForSync(x)
+
+	item, _ := pubSubRep.FetchNodeLastItem(context.Background(), "ortuman@jackal.im", vCard4NodeID)
+	require.NotNil(t, item)
+	require.Equal(t, currentItemID, item.ID)
+	require.Equal(t, "vcard", item.Payload.Name())
+	require.Equal(t, "stpeter", childText(item.Payload.Elements().Child("nickname"), "text"))
+
+	// owner gets notified
+	elem := stm.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	require.NotNil(t, elem.Elements().ChildNamespace("event", "http://jabber.org/protocol/pubsub#event"))
+}
+
+func TestXEP0292_VCard4ToVCardTemp(t *testing.T) {
+	r, vCardRep, pubSubRep := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	url := xmpp.NewElementName("URL").SetText("https://jackal.im")
+	vc := xmpp.NewElementNamespace("vCard", vCardNamespace)
+	vc.AppendElement(url)
+	_ = vCardRep.UpsertVCard(context.Background(), vc, "ortuman@jackal.im")
+
+	pep := xep0163.New(&xep0163.Config{}, nil, nil, r, memorystorage.NewRoster(), pubSubRep)
+	vCard := xep0054.New(nil, r, vCardRep)
+	x := New(nil, pep, vCard, vCardRep, pubSubRep)
+	defer func() { _ = x.Shutdown(); _ = vCard.Shutdown(); _ = pep.Shutdown() }()
+
+	// vCard updates must reach the rest of vCard modules
+	var mu sync.Mutex
+	var updates int
+	vCard.RegisterUpdateHandler(func(_ context.Context, _ *jid.JID, _ xmpp.XElement) {
+		mu.Lock()
+		updates++
+		mu.Unlock()
+	})
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	pubSubEl := xmpp.NewElementNamespace("pubsub", "http://jabber.org/protocol/pubsub")
+	publishEl := xmpp.NewElementName("publish")
+	publishEl.SetAttribute("node", vCard4NodeID)
+	itemEl := xmpp.NewElementName("item")
+	itemEl.SetAttribute("id", currentItemID)
+	itemEl.AppendElement(loadFixture(t, "vcard4.xml"))
+	publishEl.AppendElement(itemEl)
+	pubSubEl.AppendElement(publishEl)
+	iq.AppendElement(pubSubEl)
+
+	pep.ProcessIQ(context.Background(), iq)
+	receiveIQResult(t, stm)
+
+	waitForSync(x)
+	waitForSync(x) // stored vcard-temp is converted back without being republished
+
+	mu.Lock()
+	require.Equal(t, 1, updates)
+	mu.Unlock()
+
+	stored, _ := vCardRep.FetchVCard(context.Background(), "ortuman@jackal.im")
+	require.NotNil(t, stored)
+	require.Equal(t, "https://jackal.im", childText(stored, "URL"))
+	require.Equal(t, "Peter Saint-Andre", childText(stored, "FN"))
+	require.Len(t, stored.Elements().Children("TEL"), 2)
+
+	// vCard get returns converted fields
+	getIQ := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	getIQ.SetFromJID(j)
+	getIQ.SetToJID(j.ToBareJID())
+	getIQ.AppendElement(xmpp.NewElementNamespace("vCard", vCardNamespace))
+
+	vCard.ProcessIQ(context.Background(), getIQ)
+	elem := stm.ReceiveElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, "stpeter", childText(elem.Elements().ChildNamespace("vCard", vCardNamespace), "NICKNAME"))
+}
+
+func waitForSync(x *VCard4) {
+	c := make(chan struct{})
+	x.runQueue.Barrier(func() { close(c) })
+	<-c
+}
+
+func receiveIQResult(t *testing.T, stm *stream.MockC2S) {
+	for {
+		elem := stm.ReceiveElement()
+		if elem.Name() == "iq" {
+			require.Equal(t, xmpp.ResultType, elem.Type())
+			return
+		}
+	}
+}
+
+func setupTest(domain string) (router.Router, repository.VCard, repository.PubSub) {
+	hosts, _ := host.New([]host.Config{{Name: domain, Certificate: tls.Certificate{}}})
+
+	r, _ := router.New(
+		hosts,
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
+		nil,
+	)
+	return r, memorystorage.NewVCard(), memorystorage.NewPubSub()
+}
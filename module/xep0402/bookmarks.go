@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0402
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/log"
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/module/xep0049"
+	"github.com/ortuman/jackal/module/xep0163"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/util/runqueue"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	bookmarksNodeID = "urn:xmpp:bookmarks:1"
+
+	compatFeature = "urn:xmpp:bookmarks:1#compat"
+
+	legacyNamespace = "storage:bookmarks"
+)
+
+// nodeOptions contains the configuration applied to bookmarks node as specified in XEP-0223.
+var nodeOptions = pubsubmodel.Options{
+	DeliverNotifications:  true,
+	DeliverPayloads:       true,
+	PersistItems:          true,
+	MaxItems:              pubsubmodel.MaxItemsLimit,
+	AccessModel:           pubsubmodel.WhiteList,
+	SendLastPublishedItem: pubsubmodel.Never,
+	NotificationType:      xmpp.HeadlineType,
+}
+
+// Bookmarks represents a bookmarks compatibility module.
+// It keeps storage:bookmarks private XML and urn:xmpp:bookmarks:1 PEP node in sync.
+type Bookmarks struct {
+	pep        *xep0163.Pep
+	runQueue   *runqueue.ShardedRunQueue
+	privateRep repository.Private
+	pubSubRep  repository.PubSub
+}
+
+// New returns a bookmarks compatibility module.
+func New(disco *xep0030.DiscoInfo, pep *xep0163.Pep, private *xep0049.Private, privateRep repository.Private, pubSubRep repository.PubSub) *Bookmarks {
+	x := &Bookmarks{
+		pep:        pep,
+		runQueue:   runqueue.NewSharded("xep0402", 0),
+		privateRep: privateRep,
+		pubSubRep:  pubSubRep,
+	}
+	if disco != nil {
+		disco.RegisterAccountFeature(compatFeature)
+	}
+	if pep != nil {
+		pep.RegisterPublishHandler(bookmarksNodeID, x.onBookmarkPublished)
+		pep.RegisterRetractHandler(bookmarksNodeID, x.onBookmarkRetracted)
+	}
+	if private != nil {
+		private.RegisterUpdateHandler(legacyNamespace, x.onPrivateUpdated)
+	}
+	return x
+}
+
+// Shutdown shuts down bookmarks module.
+func (x *Bookmarks) Shutdown() error {
+	c := make(chan struct{})
+	x.runQueue.Stop(func() { close(c) })
+	<-c
+	return nil
+}
+
+func (x *Bookmarks) onPrivateUpdated(ctx context.Context, userJID *jid.JID, elements []xmpp.XElement) {
+	bareJID := userJID.ToBareJID().String()
+	x.runQueue.Run(bareJID, func() {
+		if err := x.publishBookmarks(ctx, bareJID, elements); err != nil {
+			log.Error(err)
+		}
+	})
+}
+
+func (x *Bookmarks) onBookmarkPublished(ctx context.Context, host string, _ *pubsubmodel.Item) {
+	x.runQueue.Run(host, func() {
+		if err := x.storeLegacyBookmarks(ctx, host); err != nil {
+			log.Error(err)
+		}
+	})
+}
+
+func (x *Bookmarks) onBookmarkRetracted(ctx context.Context, host, _ string) {
+	x.runQueue.Run(host, func() {
+		if err := x.storeLegacyBookmarks(ctx, host); err != nil {
+			log.Error(err)
+		}
+	})
+}
+
+// publishBookmarks mirrors legacy private XML bookmarks into bookmarks PEP node.
+func (x *Bookmarks) publishBookmarks(ctx context.Context, bareJID string, elements []xmpp.XElement) error {
+	items, err := x.pubSubRep.FetchNodeItems(ctx, bareJID, bookmarksNodeID)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]string, len(items))
+	for _, item := range items {
+		if item.Payload != nil {
+			current[item.ID] = item.Payload.String()
+		}
+	}
+	conferences := fromLegacy(elements)
+
+	for _, roomJID := range conferences.roomJIDs {
+		payload := conferences.elements[roomJID]
+		if s, ok := current[roomJID]; ok && s == payload.String() {
+			continue // nothing changed
+		}
+		err := x.pep.Publish(ctx, bareJID, bookmarksNodeID, &pubsubmodel.Item{
+			ID:        roomJID,
+			Publisher: bareJID,
+			Payload:   payload,
+		}, &nodeOptions)
+		if err != nil {
+			return err
+		}
+		log.Infof("bookmarks: published legacy bookmark (jid: %s, room: %s)", bareJID, roomJID)
+	}
+	for _, item := range items {
+		if _, ok := conferences.elements[item.ID]; ok {
+			continue
+		}
+		if err := x.pep.Retract(ctx, bareJID, bookmarksNodeID, item.ID); err != nil {
+			return err
+		}
+		log.Infof("bookmarks: retracted legacy bookmark (jid: %s, room: %s)", bareJID, item.ID)
+	}
+	return nil
+}
+
+// storeLegacyBookmarks mirrors bookmarks PEP node items into legacy private XML storage.
+func (x *Bookmarks) storeLegacyBookmarks(ctx context.Context, bareJID string) error {
+	items, err := x.pubSubRep.FetchNodeItems(ctx, bareJID, bookmarksNodeID)
+	if err != nil {
+		return err
+	}
+	current, err := x.privateRep.FetchPrivateXML(ctx, legacyNamespace, bareJID)
+	if err != nil {
+		return err
+	}
+	storage := toLegacy(items, current)
+
+	if len(current) == 1 && current[0].String() == storage.String() {
+		return nil // nothing changed
+	}
+	if err := x.privateRep.UpsertPrivateXML(ctx, []xmpp.XElement{storage}, legacyNamespace, bareJID); err != nil {
+		return err
+	}
+	log.Infof("bookmarks: stored legacy bookmarks (jid: %s)", bareJID)
+	return nil
+}
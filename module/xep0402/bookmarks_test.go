@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0402
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	c2srouter "github.com/ortuman/jackal/c2s/router"
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	"github.com/ortuman/jackal/module/xep0049"
+	"github.com/ortuman/jackal/module/xep0163"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/router/host"
+	memorystorage "github.com/ortuman/jackal/storage/memory"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0402_PrivateToPEP(t *testing.T) {
+	r, privateRep, pubSubRep := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	pep := xep0163.New(&xep0163.Config{}, nil, nil, r, memorystorage.NewRoster(), pubSubRep)
+	private := xep0049.New(r, privateRep)
+	x := New(nil, pep, private, privateRep, pubSubRep)
+	defer func() { _ = x.Shutdown(); _ = private.Shutdown(); _ = pep.Shutdown() }()
+
+	storage := legacyStorage(
+		legacyConference("council@conference.jackal.im", "The Council", "true", "ortuman"),
+		legacyConference("theplay@conference.jackal.im", "The Play", "false", ""),
+	)
+	private.ProcessIQ(context.Background(), privateIQ(j, storage))
+	receiveIQResult(t, stm)
+
+	waitForSync(x)
+
+	n, _ := pubSubRep.FetchNode(context.Background(), "ortuman@jackal.im", bookmarksNodeID)
+	require.NotNil(t, n)
+	require.Equal(t, pubsubmodel.WhiteList, n.Options.AccessModel)
+	require.Equal(t, int64(pubsubmodel.MaxItemsLimit), n.Options.MaxItems)
+
+	items, _ := pubSubRep.FetchNodeItems(context.Background(), "ortuman@jackal.im", bookmarksNodeID)
+	require.Len(t, items, 2)
+	require.Equal(t, "council@conference.jackal.im", items[0].ID)
+	require.Equal(t, bookmarksNodeID, items[0].Payload.Namespace())
+	require.Equal(t, "The Council", items[0].Payload.Attributes().Get("name"))
+	require.Equal(t, "true", items[0].Payload.Attributes().Get("autojoin"))
+	require.Equal(t, "ortuman", items[0].Payload.Elements().Child("nick").Text())
+	require.Equal(t, "", items[1].Payload.Attributes().Get("autojoin"))
+
+	// remove a bookmark
+	storage = legacyStorage(legacyConference("council@conference.jackal.im", "The Council", "true", "ortuman"))
+	private.ProcessIQ(context.Background(), privateIQ(j, storage))
+	receiveIQResult(t, stm)
+
+	waitForSync(x)
+
+	items, _ = pubSubRep.FetchNodeItems(context.Background(), "ortuman@jackal.im", bookmarksNodeID)
+	require.Len(t, items, 1)
+	require.Equal(t, "council@conference.jackal.im", items[0].ID)
+}
+
+func TestXEP0402_PEPToPrivate(t *testing.T) {
+	r, privateRep, pubSubRep := setupTest("jackal.im")
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm.SetPresence(xmpp.NewPresence(j, j, xmpp.AvailableType))
+	r.Bind(context.Background(), stm)
+
+	url := xmpp.NewElementName("url")
+	url.SetAttribute("name", "jackal")
+	url.SetAttribute("url", "https://github.com/ortuman/jackal")
+	_ = privateRep.UpsertPrivateXML(context.Background(), []xmpp.XElement{legacyStorage(url)}, legacyNamespace, "ortuman@jackal.im")
+
+	pep := xep0163.New(&xep0163.Config{}, nil, nil, r, memorystorage.NewRoster(), pubSubRep)
+	private := xep0049.New(r, privateRep)
+	x := New(nil, pep, private, privateRep, pubSubRep)
+	defer func() { _ = x.Shutdown(); _ = private.Shutdown(); _ = pep.Shutdown() }()
+
+	conference := xmpp.NewElementNamespace("conference", bookmarksNodeID)
+	conference.SetAttribute("name", "The Council")
+	conference.SetAttribute("autojoin", "1")
+	conference.AppendElement(xmpp.NewElementName("nick").SetText("ortuman"))
+
+	pep.ProcessIQ(context.Background(), pubSubIQ(j, "publish", "council@conference.jackal.im", conference))
+	receiveIQResult(t, stm)
+
+	waitForSync(x)
+
+	elements, _ := privateRep.FetchPrivateXML(context.Background(), legacyNamespace, "ortuman@jackal.im")
+	require.Len(t, elements, 1)
+	require.NotNil(t, elements[0].Elements().Child("url"))
+
+	conferences := elements[0].Elements().Children("conference")
+	require.Len(t, conferences, 1)
+	require.Equal(t, "council@conference.jackal.im", conferences[0].Attributes().Get("jid"))
+	require.Equal(t, "The Council", conferences[0].Attributes().Get("name"))
+	require.Equal(t, "true", conferences[0].Attributes().Get("autojoin"))
+	require.Equal(t, "ortuman", conferences[0].Elements().Child("nick").Text())
+
+	// retract bookmark
+	pep.ProcessIQ(context.Background(), pubSubIQ(j, "retract", "council@conference.jackal.im", nil))
+	receiveIQResult(t, stm)
+
+	waitForSync(x)
+
+	elements, _ = privateRep.FetchPrivateXML(context.Background(), legacyNamespace, "ortuman@jackal.im")
+	require.Len(t, elements, 1)
+	require.NotNil(t, elements[0].Elements().Child("url"))
+	require.Len(t, elements[0].Elements().Children("conference"), 0)
+}
+
+func waitForSync(x *Bookmarks) {
+	c := make(chan struct{})
+	x.runQueue.Barrier(func() { close(c) })
+	<-c
+}
+
+func receiveIQResult(t *testing.T, stm *stream.MockC2S) {
+	for {
+		elem := stm.ReceiveElement()
+		if elem.Name() == "iq" {
+			require.Equal(t, xmpp.ResultType, elem.Type())
+			return
+		}
+	}
+}
+
+func privateIQ(j *jid.JID, storage xmpp.XElement) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	q := xmpp.NewElementNamespace("query", "jabber:iq:private")
+	q.AppendElement(storage)
+	iq.AppendElement(q)
+	return iq
+}
+
+func pubSubIQ(j *jid.JID, command, itemID string, payload xmpp.XElement) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	pubSubEl := xmpp.NewElementNamespace("pubsub", "http://jabber.org/protocol/pubsub")
+	cmdEl := xmpp.NewElementName(command)
+	cmdEl.SetAttribute("node", bookmarksNodeID)
+	itemEl := xmpp.NewElementName("item")
+	itemEl.SetAttribute("id", itemID)
+	if payload != nil {
+		itemEl.AppendElement(payload)
+	}
+	cmdEl.AppendElement(itemEl)
+	pubSubEl.AppendElement(cmdEl)
+	iq.AppendElement(pubSubEl)
+	return iq
+}
+
+func legacyStorage(elements ...xmpp.XElement) xmpp.XElement {
+	storage := xmpp.NewElementNamespace("storage", legacyNamespace)
+	storage.AppendElements(elements)
+	return storage
+}
+
+func legacyConference(roomJID, name, autoJoin, nick string) xmpp.XElement {
+	conference := xmpp.NewElementName("conference")
+	conference.SetAttribute("jid", roomJID)
+	conference.SetAttribute("name", name)
+	conference.SetAttribute("autojoin", autoJoin)
+	if len(nick) > 0 {
+		conference.AppendElement(xmpp.NewElementName("nick").SetText(nick))
+	}
+	return conference
+}
+
+func setupTest(domain string) (router.Router, repository.Private, repository.PubSub) {
+	hosts, _ := host.New([]host.Config{{Name: domain, Certificate: tls.Certificate{}}})
+
+	r, _ := router.New(
+		hosts,
+		c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil),
+		nil,
+	)
+	return r, memorystorage.NewPrivate(), memorystorage.NewPubSub()
+}
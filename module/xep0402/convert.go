@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0402
+
+import (
+	"github.com/ortuman/jackal/log"
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// conferenceSet represents an ordered set of bookmarked conferences keyed by room JID.
+type conferenceSet struct {
+	roomJIDs []string
+	elements map[string]xmpp.XElement
+}
+
+// fromLegacy extracts the set of XEP-0402 conference elements contained in legacy storage elements.
+func fromLegacy(elements []xmpp.XElement) *conferenceSet {
+	set := &conferenceSet{elements: make(map[string]xmpp.XElement)}
+	for _, storage := range elements {
+		if storage.Name() != "storage" || storage.Namespace() != legacyNamespace {
+			continue
+		}
+		for _, conference := range storage.Elements().Children("conference") {
+			roomJID, err := jid.NewWithString(conference.Attributes().Get("jid"), false)
+			if err != nil {
+				log.Warnf("bookmarks: invalid conference jid: %s", conference.Attributes().Get("jid"))
+				continue
+			}
+			key := roomJID.ToBareJID().String()
+			if _, ok := set.elements[key]; !ok {
+				set.roomJIDs = append(set.roomJIDs, key)
+			}
+			set.elements[key] = conferenceElement(bookmarksNodeID, "", conference)
+		}
+	}
+	return set
+}
+
+// toLegacy returns the legacy storage representation of a set of bookmarks node items.
+// Non conference elements (such as URL bookmarks) are taken from base, if any.
+func toLegacy(items []pubsubmodel.Item, base []xmpp.XElement) xmpp.XElement {
+	storage := xmpp.NewElementNamespace("storage", legacyNamespace)
+	for _, el := range base {
+		if el.Name() != "storage" || el.Namespace() != legacyNamespace {
+			continue
+		}
+		for _, child := range el.Elements().All() {
+			if child.Name() != "conference" {
+				storage.AppendElement(child)
+			}
+		}
+	}
+	for _, item := range items {
+		if item.Payload == nil || item.Payload.Name() != "conference" || item.Payload.Namespace() != bookmarksNodeID {
+			continue
+		}
+		storage.AppendElement(conferenceElement("", item.ID, item.Payload))
+	}
+	return storage
+}
+
+// conferenceElement returns a normalized conference element qualified by namespace.
+// In case roomJID is not empty it is set as conference jid attribute.
+func conferenceElement(namespace, roomJID string, src xmpp.XElement) xmpp.XElement {
+	var conference *xmpp.Element
+	if len(namespace) > 0 {
+		conference = xmpp.NewElementNamespace("conference", namespace)
+	} else {
+		conference = xmpp.NewElementName("conference")
+	}
+	if len(roomJID) > 0 {
+		conference.SetAttribute("jid", roomJID)
+	}
+	if name := src.Attributes().Get("name"); len(name) > 0 {
+		conference.SetAttribute("name", name)
+	}
+	if autoJoin := src.Attributes().Get("autojoin"); autoJoin == "true" || autoJoin == "1" {
+		conference.SetAttribute("autojoin", "true")
+	}
+	if nick := src.Elements().Child("nick"); nick != nil && len(nick.Text()) > 0 {
+		conference.AppendElement(xmpp.NewElementName("nick").SetText(nick.Text()))
+	}
+	if password := src.Elements().Child("password"); password != nil && len(password.Text()) > 0 {
+		conference.AppendElement(xmpp.NewElementName("password").SetText(password.Text()))
+	}
+	return conference
+}
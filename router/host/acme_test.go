@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package host
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeACMEServer is a minimal RFC 8555 stand-in (pebble-like) that
+// authorizes every challenge and issues certificates signed by a test CA.
+type fakeACMEServer struct {
+	srv    *httptest.Server
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	mu     sync.Mutex
+	orders map[string]*fakeOrder
+	nonce  int
+	issued int
+}
+
+type fakeOrder struct {
+	domain string
+	status string
+	cert   []byte
+}
+
+func newFakeACMEServer(t *testing.T) *fakeACMEServer {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake acme ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	require.Nil(t, err)
+	caCert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+
+	s := &fakeACMEServer{caKey: caKey, caCert: caCert, orders: make(map[string]*fakeOrder)}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *fakeACMEServer) directoryURL() string { return s.srv.URL + "/directory" }
+
+func (s *fakeACMEServer) issuedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued
+}
+
+func (s *fakeACMEServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", s.nonce))
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch parts[0] {
+	case "directory":
+		s.writeJSON(w, http.StatusOK, map[string]string{
+			"newNonce":   s.srv.URL + "/new-nonce",
+			"newAccount": s.srv.URL + "/new-account",
+			"newOrder":   s.srv.URL + "/new-order",
+			"revokeCert": s.srv.URL + "/revoke-cert",
+		})
+	case "new-nonce":
+		w.WriteHeader(http.StatusOK)
+	case "new-account":
+		w.Header().Set("Location", s.srv.URL+"/account/1")
+		s.writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case "new-order":
+		var req struct {
+			Identifiers []struct{ Value string }
+		}
+		if err := decodeJWSPayload(r, &req); err != nil || len(req.Identifiers) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		id := fmt.Sprintf("%d", len(s.orders)+1)
+		s.orders[id] = &fakeOrder{domain: req.Identifiers[0].Value, status: "pending"}
+		s.writeOrder(w, http.StatusCreated, id)
+	case "order":
+		s.writeOrder(w, http.StatusOK, parts[1])
+	case "authz":
+		o := s.orders[parts[1]]
+		status := "pending"
+		if o.status != "pending" {
+			status = "valid"
+		}
+		s.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"identifier": map[string]string{"type": "dns", "value": o.domain},
+			"status":     status,
+			"challenges": []map[string]string{
+				{"type": "tls-alpn-01", "url": s.srv.URL + "/chal/" + parts[1], "token": "token-" + parts[1], "status": status},
+			},
+		})
+	case "chal":
+		// every challenge is considered fulfilled
+		s.orders[parts[1]].status = "ready"
+		s.writeJSON(w, http.StatusOK, map[string]string{
+			"type": "tls-alpn-01", "url": s.srv.URL + "/chal/" + parts[1], "token": "token-" + parts[1], "status": "valid",
+		})
+	case "finalize":
+		var req struct{ CSR string }
+		if err := decodeJWSPayload(r, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		csrDER, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		cert, err := s.issue(csrDER)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		o := s.orders[parts[1]]
+		o.status = "valid"
+		o.cert = cert
+		s.issued++
+		s.writeOrder(w, http.StatusOK, parts[1])
+	case "cert":
+		o := s.orders[parts[1]]
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.WriteHeader(http.StatusOK)
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: o.cert})
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: s.caCert.Raw})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *fakeACMEServer) writeOrder(w http.ResponseWriter, statusCode int, id string) {
+	o := s.orders[id]
+	resp := map[string]interface{}{
+		"status":         o.status,
+		"identifiers":    []map[string]string{{"type": "dns", "value": o.domain}},
+		"authorizations": []string{s.srv.URL + "/authz/" + id},
+		"finalize":       s.srv.URL + "/finalize/" + id,
+	}
+	if o.status == "valid" {
+		resp["certificate"] = s.srv.URL + "/cert/" + id
+	}
+	w.Header().Set("Location", s.srv.URL+"/order/"+id)
+	s.writeJSON(w, statusCode, resp)
+}
+
+func (s *fakeACMEServer) writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *fakeACMEServer) issue(csrDER []byte) ([]byte, error) {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, err
+	}
+	dnsNames := csr.DNSNames
+	if len(dnsNames) == 0 {
+		dnsNames = []string{csr.Subject.CommonName}
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		DNSNames:     dnsNames,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	return x509.CreateCertificate(rand.Reader, tmpl, s.caCert, csr.PublicKey, s.caKey)
+}
+
+func decodeJWSPayload(r *http.Request, v interface{}) error {
+	var jws struct{ Payload string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return err
+	}
+	b, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func TestHosts_ACME(t *testing.T) {
+	ca := newFakeACMEServer(t)
+	defer ca.srv.Close()
+
+	cacheDir, err := ioutil.TempDir("", "acme_test")
+	require.Nil(t, err)
+	defer func() { _ = os.RemoveAll(cacheDir) }()
+
+	h, err := New([]Config{{Name: "xmpp.jackal.im", ACME: true}})
+	require.Nil(t, err)
+	err = h.Start(&CertificatesConfig{
+		ACME: &ACMEConfig{
+			DirectoryURL: ca.directoryURL(),
+			CacheDir:     cacheDir,
+			HTTPAddress:  "127.0.0.1:0",
+			RenewBefore:  defaultACMERenewBefore,
+		},
+	})
+	require.Nil(t, err)
+	defer func() { _ = h.Close() }()
+
+	cer, err := h.GetCertificate(acmeHello("xmpp.jackal.im"))
+	require.Nil(t, err)
+	require.Equal(t, "xmpp.jackal.im", leafName(t, cer))
+
+	leaf, _ := x509.ParseCertificate(cer.Certificate[0])
+	require.Nil(t, leaf.CheckSignatureFrom(ca.caCert))
+
+	// certificate is cached once obtained
+	cer2, err := h.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:       "xmpp.jackal.im",
+		CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+	})
+	require.Nil(t, err)
+	require.Equal(t, cer.Certificate[0], cer2.Certificate[0])
+	require.Equal(t, 1, ca.issuedCount())
+}
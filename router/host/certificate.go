@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package host
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificate holds a host TLS certificate that can be reloaded from its PEM files.
+type certificate struct {
+	certFile string
+	keyFile  string
+	acme     bool
+
+	mu      sync.RWMutex
+	cer     *tls.Certificate
+	modTime time.Time
+}
+
+func newCertificate(cfg *Config) *certificate {
+	c := &certificate{
+		certFile: cfg.CertFile,
+		keyFile:  cfg.PrivateKeyFile,
+		acme:     cfg.ACME,
+	}
+	if !cfg.ACME {
+		cer := cfg.Certificate
+		c.cer = &cer
+		c.modTime, _ = c.filesModTime()
+	}
+	return c
+}
+
+func (c *certificate) get() *tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cer
+}
+
+// reload loads again certificate key pair in case any of its files has been
+// modified since last load. Current certificate is kept on failure.
+func (c *certificate) reload() (bool, error) {
+	if c.acme || len(c.certFile) == 0 || len(c.keyFile) == 0 {
+		return false, nil
+	}
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	modified := modTime.After(c.modTime)
+	c.mu.RUnlock()
+	if !modified {
+		return false, nil
+	}
+	cer, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	c.cer = &cer
+	c.modTime = modTime
+	c.mu.Unlock()
+	return true, nil
+}
+
+func (c *certificate) filesModTime() (time.Time, error) {
+	var modTime time.Time
+	for _, f := range []string{c.certFile, c.keyFile} {
+		if len(f) == 0 {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	return modTime, nil
+}
@@ -7,18 +7,31 @@ package host
 
 import (
 	"crypto/tls"
+	"errors"
+	"time"
 
 	utiltls "github.com/ortuman/jackal/util/tls"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	defaultCertReloadInterval = time.Duration(60) * time.Second
+	defaultACMECacheDir       = "./.acme"
+	defaultACMERenewBefore    = time.Duration(30*24) * time.Hour
 )
 
 type TLSConfig struct {
 	CertFile       string `yaml:"cert_path"`
 	PrivateKeyFile string `yaml:"privkey_path"`
+	ACME           bool   `yaml:"acme"`
 }
 
 type Config struct {
-	Name        string
-	Certificate tls.Certificate
+	Name           string
+	Certificate    tls.Certificate
+	CertFile       string
+	PrivateKeyFile string
+	ACME           bool
 }
 
 type configProxy struct {
@@ -33,10 +46,88 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 	c.Name = p.Name
+	if p.TLS.ACME {
+		// certificate will be obtained from ACME server
+		if len(p.TLS.CertFile) > 0 || len(p.TLS.PrivateKeyFile) > 0 {
+			return errors.New("host.Config: cannot combine acme with certificate files")
+		}
+		c.ACME = true
+		return nil
+	}
 	cer, err := utiltls.LoadCertificate(p.TLS.PrivateKeyFile, p.TLS.CertFile, c.Name)
 	if err != nil {
 		return err
 	}
 	c.Certificate = cer
+	c.CertFile = p.TLS.CertFile
+	c.PrivateKeyFile = p.TLS.PrivateKeyFile
+	return nil
+}
+
+// ACMEConfig represents ACME client configuration.
+type ACMEConfig struct {
+	DirectoryURL string
+	Email        string
+	CacheDir     string
+	HTTPAddress  string
+	RenewBefore  time.Duration
+}
+
+type acmeConfigProxy struct {
+	DirectoryURL    string `yaml:"directory_url"`
+	Email           string `yaml:"email"`
+	CacheDir        string `yaml:"cache_dir"`
+	HTTPAddress     string `yaml:"http_address"`
+	RenewBeforeDays int    `yaml:"renew_before_days"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *ACMEConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := acmeConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.DirectoryURL = p.DirectoryURL
+	if len(c.DirectoryURL) == 0 {
+		c.DirectoryURL = autocert.DefaultACMEDirectory
+	}
+	c.Email = p.Email
+	c.CacheDir = p.CacheDir
+	if len(c.CacheDir) == 0 {
+		c.CacheDir = defaultACMECacheDir
+	}
+	c.HTTPAddress = p.HTTPAddress
+	if len(c.HTTPAddress) == 0 {
+		return errors.New("host.ACMEConfig: http_address is required to serve http-01 challenges")
+	}
+	c.RenewBefore = time.Duration(p.RenewBeforeDays*24) * time.Hour
+	if c.RenewBefore == 0 {
+		c.RenewBefore = defaultACMERenewBefore
+	}
+	return nil
+}
+
+// CertificatesConfig represents host certificates management configuration.
+type CertificatesConfig struct {
+	ReloadInterval time.Duration
+	ACME           *ACMEConfig
+}
+
+type certificatesConfigProxy struct {
+	ReloadInterval *int        `yaml:"reload_interval"`
+	ACME           *ACMEConfig `yaml:"acme"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *CertificatesConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := certificatesConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.ReloadInterval = defaultCertReloadInterval
+	if p.ReloadInterval != nil {
+		c.ReloadInterval = time.Duration(*p.ReloadInterval) * time.Second
+	}
+	c.ACME = p.ACME
 	return nil
 }
@@ -6,29 +6,46 @@
 package host
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/ortuman/jackal/log"
 	utiltls "github.com/ortuman/jackal/util/tls"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 const defaultDomain = "localhost"
 
 type Hosts struct {
 	defaultHostname string
-	hosts           map[string]tls.Certificate
+	hosts           map[string]*certificate
+
+	acmeMng   *autocert.Manager
+	acmeSrv   *http.Server
+	closeCh   chan struct{}
+	closeOnce sync.Once
 }
 
 func New(hostsConfig []Config) (*Hosts, error) {
 	h := &Hosts{
-		hosts: make(map[string]tls.Certificate),
+		hosts:   make(map[string]*certificate),
+		closeCh: make(chan struct{}),
 	}
 	if len(hostsConfig) > 0 {
 		for i, host := range hostsConfig {
 			if i == 0 {
 				h.defaultHostname = host.Name
 			}
-			h.hosts[host.Name] = host.Certificate
+			h.hosts[host.Name] = newCertificate(&hostsConfig[i])
 		}
 	} else {
 		cer, err := utiltls.LoadCertificate("", "", defaultDomain)
@@ -36,11 +53,47 @@ func New(hostsConfig []Config) (*Hosts, error) {
 			return nil, err
 		}
 		h.defaultHostname = defaultDomain
-		h.hosts[defaultDomain] = cer
+		h.hosts[defaultDomain] = newCertificate(&Config{Name: defaultDomain, Certificate: cer})
 	}
 	return h, nil
 }
 
+// Start begins certificates management: file-based certificates are periodically
+// reloaded and ACME certificates are obtained and renewed in background.
+func (h *Hosts) Start(cfg *CertificatesConfig) error {
+	if cfg == nil {
+		cfg = &CertificatesConfig{ReloadInterval: defaultCertReloadInterval}
+	}
+	acmeHosts := h.acmeHostNames()
+	if len(acmeHosts) > 0 {
+		if cfg.ACME == nil {
+			return errors.New("host: acme configuration required")
+		}
+		if len(cfg.ACME.HTTPAddress) == 0 {
+			return errors.New("host: acme http address required")
+		}
+		if err := h.startACME(cfg.ACME, acmeHosts); err != nil {
+			return err
+		}
+	}
+	if cfg.ReloadInterval > 0 {
+		go h.reloadLoop(cfg.ReloadInterval)
+	}
+	return nil
+}
+
+// Close stops certificates management.
+func (h *Hosts) Close() error {
+	var err error
+	h.closeOnce.Do(func() {
+		close(h.closeCh)
+		if h.acmeSrv != nil {
+			err = h.acmeSrv.Shutdown(context.Background())
+		}
+	})
+	return err
+}
+
 func (h *Hosts) DefaultHostName() string {
 	return h.defaultHostname
 }
@@ -61,8 +114,115 @@ func (h *Hosts) HostNames() []string {
 
 func (h *Hosts) Certificates() []tls.Certificate {
 	var certs []tls.Certificate
-	for _, cer := range h.hosts {
-		certs = append(certs, cer)
+	for _, c := range h.hosts {
+		if cer := c.get(); cer != nil {
+			certs = append(certs, *cer)
+		}
 	}
 	return certs
 }
+
+// GetCertificate returns the certificate associated to the host requested via SNI,
+// falling back to default host certificate if no matching host is found.
+// It is meant to be used as tls.Config GetCertificate callback.
+func (h *Hosts) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	c, ok := h.hosts[name]
+	if !ok {
+		name = h.defaultHostname
+		c = h.hosts[name]
+	}
+	if c.acme {
+		if h.acmeMng == nil {
+			return nil, fmt.Errorf("host: acme not started for host %s", name)
+		}
+		acmeHello := *hello
+		acmeHello.ServerName = name
+		return h.acmeMng.GetCertificate(&acmeHello)
+	}
+	if cer := c.get(); cer != nil {
+		return cer, nil
+	}
+	return nil, fmt.Errorf("host: no certificate available for host %s", name)
+}
+
+func (h *Hosts) startACME(cfg *ACMEConfig, hostNames []string) error {
+	h.acmeMng = &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       autocert.DirCache(cfg.CacheDir),
+		HostPolicy:  autocert.HostWhitelist(hostNames...),
+		RenewBefore: cfg.RenewBefore,
+		Email:       cfg.Email,
+		Client:      &acme.Client{DirectoryURL: cfg.DirectoryURL},
+	}
+	// serve http-01 challenges
+	ln, err := net.Listen("tcp", cfg.HTTPAddress)
+	if err != nil {
+		return err
+	}
+	h.acmeSrv = &http.Server{Handler: h.acmeMng.HTTPHandler(nil)}
+	go func() {
+		if err := h.acmeSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Errorf("host: acme http server error: %v", err)
+		}
+	}()
+	// obtain certificates in advance so that first connections don't have to wait
+	for _, hostName := range hostNames {
+		go func(hostName string) {
+			if _, err := h.acmeMng.GetCertificate(acmeHello(hostName)); err != nil {
+				log.Errorf("host: failed to obtain acme certificate for %s: %v", hostName, err)
+				return
+			}
+			log.Infof("host: obtained acme certificate for %s", hostName)
+		}(hostName)
+	}
+	return nil
+}
+
+func (h *Hosts) acmeHostNames() []string {
+	var ret []string
+	for n, c := range h.hosts {
+		if c.acme {
+			ret = append(ret, n)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (h *Hosts) reloadLoop(interval time.Duration) {
+	tc := time.NewTicker(interval)
+	defer tc.Stop()
+	for {
+		select {
+		case <-tc.C:
+			h.reloadCertificates()
+		case <-h.closeCh:
+			return
+		}
+	}
+}
+
+func (h *Hosts) reloadCertificates() {
+	for n, c := range h.hosts {
+		reloaded, err := c.reload()
+		if err != nil {
+			log.Warnf("host: failed to reload certificate for %s: %v", n, err)
+			continue
+		}
+		if reloaded {
+			log.Infof("host: reloaded certificate for %s", n)
+		}
+	}
+}
+
+// acmeHello returns a client hello used to request ECDSA certificates,
+// as supported by any modern TLS client.
+func acmeHello(hostName string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		ServerName:       hostName,
+		CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedCurves:  []tls.CurveID{tls.CurveP256},
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package host
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestHosts_GetCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hosts_test")
+	require.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	cfg0 := writeHostConfig(t, dir, "jackal.im")
+	cfg1 := writeHostConfig(t, dir, "example.org")
+
+	h, err := New([]Config{cfg0, cfg1})
+	require.Nil(t, err)
+
+	cer, err := h.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"})
+	require.Nil(t, err)
+	require.Equal(t, "example.org", leafName(t, cer))
+
+	cer, err = h.GetCertificate(&tls.ClientHelloInfo{ServerName: "JACKAL.IM."})
+	require.Nil(t, err)
+	require.Equal(t, "jackal.im", leafName(t, cer))
+
+	// fallback to default host
+	cer, err = h.GetCertificate(&tls.ClientHelloInfo{})
+	require.Nil(t, err)
+	require.Equal(t, "jackal.im", leafName(t, cer))
+
+	require.Len(t, h.Certificates(), 2)
+}
+
+func TestHosts_ReloadCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hosts_test")
+	require.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	cfg := writeHostConfig(t, dir, "jackal.im")
+
+	h, err := New([]Config{cfg})
+	require.Nil(t, err)
+
+	cer0, _ := h.GetCertificate(&tls.ClientHelloInfo{ServerName: "jackal.im"})
+
+	// not modified
+	h.reloadCertificates()
+	cer1, _ := h.GetCertificate(&tls.ClientHelloInfo{ServerName: "jackal.im"})
+	require.True(t, cer0 == cer1)
+
+	// renewed certificate
+	writeHostConfig(t, dir, "jackal.im")
+	future := time.Now().Add(time.Minute)
+	require.Nil(t, os.Chtimes(cfg.CertFile, future, future))
+
+	h.reloadCertificates()
+	cer2, _ := h.GetCertificate(&tls.ClientHelloInfo{ServerName: "jackal.im"})
+	require.False(t, cer0 == cer2)
+	require.NotEqual(t, cer0.Certificate[0], cer2.Certificate[0])
+
+	// broken certificate keeps serving the previous one
+	require.Nil(t, ioutil.WriteFile(cfg.CertFile, []byte("garbage"), 0600))
+	future = future.Add(time.Minute)
+	require.Nil(t, os.Chtimes(cfg.CertFile, future, future))
+
+	h.reloadCertificates()
+	cer3, _ := h.GetCertificate(&tls.ClientHelloInfo{ServerName: "jackal.im"})
+	require.True(t, cer2 == cer3)
+}
+
+func TestHosts_StartWithoutACMEConfig(t *testing.T) {
+	h, err := New([]Config{{Name: "jackal.im", ACME: true}})
+	require.Nil(t, err)
+	require.NotNil(t, h.Start(&CertificatesConfig{}))
+
+	// http-01 challenges can't be served
+	require.NotNil(t, h.Start(&CertificatesConfig{ACME: &ACMEConfig{CacheDir: defaultACMECacheDir}}))
+
+	var cfg CertificatesConfig
+	require.NotNil(t, yaml.Unmarshal([]byte("acme:\n  email: admin@jackal.im\n"), &cfg))
+	require.Nil(t, yaml.Unmarshal([]byte("acme:\n  http_address: \":80\"\n"), &cfg))
+	require.Equal(t, ":80", cfg.ACME.HTTPAddress)
+
+	_, err = h.GetCertificate(&tls.ClientHelloInfo{ServerName: "jackal.im"})
+	require.NotNil(t, err)
+}
+
+func writeHostConfig(t *testing.T, dir, domain string) Config {
+	certFile := filepath.Join(dir, domain+".crt")
+	keyFile := filepath.Join(dir, domain+".key")
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{domain},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	require.Nil(t, err)
+
+	require.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	cer, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.Nil(t, err)
+	return Config{Name: domain, Certificate: cer, CertFile: certFile, PrivateKeyFile: keyFile}
+}
+
+func leafName(t *testing.T, cer *tls.Certificate) string {
+	require.NotNil(t, cer)
+	leaf, err := x509.ParseCertificate(cer.Certificate[0])
+	require.Nil(t, err)
+	return leaf.DNSNames[0]
+}
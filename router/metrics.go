@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package router
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var stanzasRouted = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "jackal",
+	Subsystem: "router",
+	Name:      "stanzas_routed_total",
+	Help:      "Number of routed stanzas by type and result.",
+}, []string{"type", "result"})
+
+func init() {
+	prometheus.MustRegister(stanzasRouted)
+}
+
+func routeResult(err error) string {
+	switch err {
+	case nil:
+		return "ok"
+	case ErrNotExistingAccount:
+		return "not_existing_account"
+	case ErrResourceNotFound:
+		return "resource_not_found"
+	case ErrNotAuthenticated:
+		return "not_authenticated"
+	case ErrBlockedJID:
+		return "blocked_jid"
+	case ErrFailedRemoteConnect:
+		return "failed_remote_connect"
+	default:
+		return "error"
+	}
+}
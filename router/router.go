@@ -32,11 +32,20 @@ type Router interface {
 	// Unbind unbinds a previously bound c2s stream.
 	Unbind(ctx context.Context, j *jid.JID)
 
-	// LocalStream returns the stream associated to a given username and resource.
-	LocalStream(username, resource string) stream.C2S
+	// LocalStream returns the stream associated to a given full JID.
+	LocalStream(j *jid.JID) stream.C2S
 
-	// LocalStreams returns all streams associated to a given username.
-	LocalStreams(username string) []stream.C2S
+	// LocalStreams returns all streams associated to a given JID bare representation.
+	LocalStreams(j *jid.JID) []stream.C2S
+
+	// AllLocalStreams returns every locally bound stream.
+	AllLocalStreams() []stream.C2S
+
+	// ClusterResources returns every resource bound on remote cluster nodes.
+	ClusterResources() []ClusterResource
+
+	// UpdatePresence notifies the router that a bound c2s stream presence has changed.
+	UpdatePresence(ctx context.Context, stm stream.C2S)
 }
 
 type C2SRouter interface {
@@ -48,13 +57,57 @@ type C2SRouter interface {
 	Bind(stm stream.C2S)
 
 	// Unbind unbinds a previously bound c2s stream.
-	Unbind(username, resource string)
+	Unbind(j *jid.JID)
+
+	// Stream returns the stream associated to a given full JID.
+	Stream(j *jid.JID) stream.C2S
 
-	// Stream returns the stream associated to a given username and resource.
-	Stream(username, resource string) stream.C2S
+	// Streams returns all streams associated to a given JID bare representation.
+	Streams(j *jid.JID) []stream.C2S
 
-	// Streams returns all streams associated to a given username.
-	Streams(username string) []stream.C2S
+	// AllStreams returns every bound stream.
+	AllStreams() []stream.C2S
+
+	// ClusterResources returns every resource bound on remote cluster nodes.
+	ClusterResources() []ClusterResource
+
+	// UpdatePresence notifies that a bound stream presence has changed.
+	UpdatePresence(stm stream.C2S)
+}
+
+// ClusterResource represents a c2s resource bound on a cluster node.
+type ClusterResource struct {
+	Node      string `json:"node"`
+	JID       string `json:"jid"`
+	Resource  string `json:"resource"`
+	Available bool   `json:"available"`
+	Priority  int8   `json:"priority"`
+}
+
+// LocalDeliverer delivers stanzas to locally bound c2s streams exclusively.
+type LocalDeliverer interface {
+	// DeliverLocal routes a stanza to local streams without forwarding it to any other cluster node.
+	DeliverLocal(ctx context.Context, stanza xmpp.Stanza) error
+}
+
+type ClusterRouter interface {
+	// Route forwards a stanza to a cluster node in order to be delivered to its locally bound streams.
+	Route(ctx context.Context, stanza xmpp.Stanza, node string) error
+
+	// Resources returns all resources bound to a given bare JID on remote cluster nodes.
+	Resources(j *jid.JID) []ClusterResource
+
+	// AllResources returns every resource bound on remote cluster nodes.
+	AllResources() []ClusterResource
+
+	// BindResource announces a locally bound resource (or its presence update) to the rest of the cluster.
+	BindResource(res ClusterResource)
+
+	// UnbindResource announces a locally unbound resource to the rest of the cluster.
+	UnbindResource(j *jid.JID)
+
+	// SetLocalDeliverer sets the deliverer used to route stanzas forwarded by other cluster nodes.
+	SetLocalDeliverer(d LocalDeliverer)
 }
 
 type S2SRouter interface {
@@ -95,18 +148,36 @@ func (r *router) Bind(ctx context.Context, stm stream.C2S) {
 }
 
 func (r *router) Unbind(ctx context.Context, j *jid.JID) {
-	r.c2s.Unbind(j.Node(), j.Resource())
+	r.c2s.Unbind(j)
+}
+
+func (r *router) LocalStreams(j *jid.JID) []stream.C2S {
+	return r.c2s.Streams(j)
 }
 
-func (r *router) LocalStreams(username string) []stream.C2S {
-	return r.c2s.Streams(username)
+func (r *router) AllLocalStreams() []stream.C2S {
+	return r.c2s.AllStreams()
 }
 
-func (r *router) LocalStream(username, resource string) stream.C2S {
-	return r.c2s.Stream(username, resource)
+func (r *router) ClusterResources() []ClusterResource {
+	return r.c2s.ClusterResources()
+}
+
+func (r *router) LocalStream(j *jid.JID) stream.C2S {
+	return r.c2s.Stream(j)
+}
+
+func (r *router) UpdatePresence(ctx context.Context, stm stream.C2S) {
+	r.c2s.UpdatePresence(stm)
 }
 
 func (r *router) route(ctx context.Context, stanza xmpp.Stanza, validateStanza bool) error {
+	err := r.doRoute(ctx, stanza, validateStanza)
+	stanzasRouted.WithLabelValues(stanza.Name(), routeResult(err)).Inc()
+	return err
+}
+
+func (r *router) doRoute(ctx context.Context, stanza xmpp.Stanza, validateStanza bool) error {
 	toJID := stanza.ToJID()
 	if !r.hosts.IsLocalHost(toJID.Domain()) {
 		if r.s2s == nil {
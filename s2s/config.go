@@ -6,10 +6,14 @@
 package s2s
 
 import (
+	"context"
 	"crypto/tls"
 	"time"
 
 	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/util/proxyproto"
+	"github.com/ortuman/jackal/util/ratelimit"
+	"github.com/ortuman/jackal/xmpp"
 	"github.com/pkg/errors"
 
 	"github.com/netsec-ethz/scion-apps/pkg/appnet"
@@ -24,18 +28,26 @@ const (
 	defaultDialTimeout        = time.Duration(15) * time.Second
 	defaultConnectTimeout     = time.Duration(5) * time.Second
 	defaultTimeout            = time.Duration(20) * time.Second
+	defaultOutIdleTimeout     = time.Duration(5) * time.Minute
 	defaultMaxStanzaSize      = 131072
+
+	defaultOutQueueSize       = 1000
+	defaultOutQueueMaxRetries = 3
+	defaultOutQueueBackoff    = time.Duration(2) * time.Second
+	defaultOutQueueMaxBackoff = time.Duration(60) * time.Second
 )
 
 // TransportConfig represents s2s transport configuration.
 type TransportConfig struct {
-	BindAddress string
-	Port        int
+	BindAddress   string
+	Port          int
+	ProxyProtocol *proxyproto.Config
 }
 
 type transportConfigProxy struct {
-	BindAddress string `yaml:"bind_addr"`
-	Port        int    `yaml:"port"`
+	BindAddress   string             `yaml:"bind_addr"`
+	Port          int                `yaml:"port"`
+	ProxyProtocol *proxyproto.Config `yaml:"proxy_protocol"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -46,6 +58,7 @@ func (c *TransportConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	}
 	c.BindAddress = p.BindAddress
 	c.Port = p.Port
+	c.ProxyProtocol = p.ProxyProtocol
 	if c.Port == 0 {
 		c.Port = defaultTransportPort
 	}
@@ -70,6 +83,8 @@ type scionConfigProxy struct {
 	Compress   bool   `yaml:"compress"`
 	Key        string `yaml:"privkey_path"`
 	Cert       string `yaml:"cert_path"`
+
+	ProxyProtocol *proxyproto.Config `yaml:"proxy_protocol"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -78,6 +93,10 @@ func (c *ScionConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err := unmarshal(&p); err != nil {
 		return err
 	}
+	// PROXY protocol headers are only read from TCP socket connections
+	if p.ProxyProtocol != nil {
+		return errors.New("s2s: proxy_protocol not supported by SCION transport")
+	}
 	c.Address = p.Address
 	if len(c.Address) == 0 {
 		return errors.New("s2s: specify SCION listening address")
@@ -121,29 +140,85 @@ type TLSConfig struct {
 	PrivKeyFile string `yaml:"privkey_path"`
 }
 
+// OutQueueConfig represents an s2s outgoing queue configuration.
+// Stanzas are queued while a remote connection is being established, and bounced back to its
+// senders once all connection attempts have failed.
+type OutQueueConfig struct {
+	Size       int
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+type outQueueConfigProxy struct {
+	Size       int `yaml:"size"`
+	MaxRetries int `yaml:"max_retries"`
+	Backoff    int `yaml:"backoff"`
+	MaxBackoff int `yaml:"max_backoff"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *OutQueueConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := outQueueConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.Size = p.Size
+	c.MaxRetries = p.MaxRetries
+	c.Backoff = time.Duration(p.Backoff) * time.Second
+	c.MaxBackoff = time.Duration(p.MaxBackoff) * time.Second
+	c.setDefaults()
+	return nil
+}
+
+func (c *OutQueueConfig) setDefaults() {
+	if c.Size == 0 {
+		c.Size = defaultOutQueueSize
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = defaultOutQueueMaxRetries
+	}
+	if c.Backoff == 0 {
+		c.Backoff = defaultOutQueueBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultOutQueueMaxBackoff
+	}
+}
+
 // Config represents an s2s configuration.
 type Config struct {
 	ID             string
 	DialTimeout    time.Duration
 	ConnectTimeout time.Duration
 	KeepAlive      time.Duration
+	IdleTimeout    time.Duration
 	Timeout        time.Duration
 	DialbackSecret string
 	MaxStanzaSize  int
+	Bidi           bool
 	Transport      TransportConfig
 	Scion          *ScionConfig
+	RateLimit      *ratelimit.Config
+	OutQueue       OutQueueConfig
+	Federation     FederationConfig
 }
 
 type configProxy struct {
-	ID             string          `yaml:"id"`
-	DialTimeout    int             `yaml:"dial_timeout"`
-	ConnectTimeout int             `yaml:"connect_timeout"`
-	KeepAlive      int             `yaml:"keep_alive"`
-	Timeout        int             `yaml:"timeout"`
-	DialbackSecret string          `yaml:"dialback_secret"`
-	MaxStanzaSize  int             `yaml:"max_stanza_size"`
-	Transport      TransportConfig `yaml:"transport"`
-	Scion          *ScionConfig    `yaml:"scion_transport"`
+	ID             string            `yaml:"id"`
+	DialTimeout    int               `yaml:"dial_timeout"`
+	ConnectTimeout int               `yaml:"connect_timeout"`
+	KeepAlive      int               `yaml:"keep_alive"`
+	IdleTimeout    int               `yaml:"idle_timeout"`
+	Timeout        int               `yaml:"timeout"`
+	DialbackSecret string            `yaml:"dialback_secret"`
+	MaxStanzaSize  int               `yaml:"max_stanza_size"`
+	Bidi           bool              `yaml:"bidi"`
+	Transport      TransportConfig   `yaml:"transport"`
+	Scion          *ScionConfig      `yaml:"scion_transport"`
+	RateLimit      *ratelimit.Config `yaml:"rate_limit"`
+	OutQueue       *OutQueueConfig   `yaml:"out_queue"`
+	Federation     *FederationConfig `yaml:"federation"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -170,6 +245,11 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	} else {
 		c.KeepAlive = defaultTransportKeepAlive
 	}
+	if p.IdleTimeout > 0 {
+		c.IdleTimeout = time.Duration(p.IdleTimeout) * time.Second
+	} else {
+		c.IdleTimeout = defaultOutIdleTimeout
+	}
 	c.Timeout = time.Duration(p.Timeout) * time.Second
 	if c.Timeout == 0 {
 		c.Timeout = defaultTimeout
@@ -179,7 +259,19 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if c.MaxStanzaSize == 0 {
 		c.MaxStanzaSize = defaultMaxStanzaSize
 	}
+	c.Bidi = p.Bidi
 	c.Scion = p.Scion
+	c.RateLimit = p.RateLimit
+	if p.OutQueue != nil {
+		c.OutQueue = *p.OutQueue
+	} else {
+		c.OutQueue.setDefaults()
+	}
+	if p.Federation != nil {
+		c.Federation = *p.Federation
+	} else {
+		c.Federation = FederationConfig{Mode: OpenFederation}
+	}
 	return nil
 }
 
@@ -190,7 +282,10 @@ type inConfig struct {
 	keepAlive      time.Duration
 	tls            *tls.Config
 	maxStanzaSize  int
+	rateLimit      *ratelimit.Config
 	onDisconnect   func(s stream.S2SIn)
+	onBidi         func(s *inStream, localDomain, remoteDomain string)
+	federation     *FederationConfig
 }
 
 type outConfig struct {
@@ -199,6 +294,15 @@ type outConfig struct {
 	remoteDomain  string
 	timeout       time.Duration
 	keepAlive     time.Duration
+	idleTimeout   time.Duration
 	tls           *tls.Config
 	maxStanzaSize int
+	requireCert   bool
+	outQueue      OutQueueConfig
+	onBounce      func(ctx context.Context, stanza xmpp.Stanza)
+	onDisconnect  func(s *outStream)
+	onReroute     func(ctx context.Context, elem xmpp.XElement)
+	bidi          bool
+	processor     *stanzaProcessor
+	path          string
 }
@@ -39,6 +39,20 @@ port: 5999
 	require.Equal(t, 5999, trCfg.Port)
 }
 
+func TestScionConfig_ProxyProtocol(t *testing.T) {
+	rawCfg := `
+addr: 1-ff00:0:110,127.0.0.1
+privkey_path: key.pem
+cert_path: cert.pem
+proxy_protocol:
+  trusted_cidrs: ["10.0.0.0/8"]
+`
+	scionCfg := ScionConfig{}
+	err := yaml.Unmarshal([]byte(rawCfg), &scionCfg)
+	require.NotNil(t, err)
+	require.Equal(t, "s2s: proxy_protocol not supported by SCION transport", err.Error())
+}
+
 func TestConfig(t *testing.T) {
 	cfg := Config{}
 	rawCfg := `
@@ -57,6 +71,7 @@ dialback_secret: s3cr3t
 	require.Equal(t, defaultDialTimeout, cfg.DialTimeout)
 	require.Equal(t, defaultConnectTimeout, cfg.ConnectTimeout)
 	require.Equal(t, defaultMaxStanzaSize, cfg.MaxStanzaSize)
+	require.Equal(t, OpenFederation, cfg.Federation.Mode)
 
 	rawCfg = `
 dialback_secret: s3cr3t
@@ -69,4 +84,55 @@ max_stanza_size: 8192
 	require.Equal(t, time.Duration(300)*time.Second, cfg.DialTimeout)
 	require.Equal(t, time.Duration(250)*time.Second, cfg.ConnectTimeout)
 	require.Equal(t, 8192, cfg.MaxStanzaSize)
+	require.Nil(t, cfg.RateLimit)
+
+	require.False(t, cfg.Bidi)
+
+	rawCfg = `
+dialback_secret: s3cr3t
+bidi: true
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.True(t, cfg.Bidi)
+
+	rawCfg = `
+dialback_secret: s3cr3t
+rate_limit:
+  bytes_per_sec: 65536
+  stanzas_per_sec: 200
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.NotNil(t, cfg.RateLimit)
+	require.Equal(t, 65536, cfg.RateLimit.BytesPerSec)
+	require.Equal(t, 200, cfg.RateLimit.StanzasPerSec)
+}
+
+func TestOutQueueConfig(t *testing.T) {
+	cfg := Config{}
+	rawCfg := `
+dialback_secret: s3cr3t
+`
+	err := yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, defaultOutQueueSize, cfg.OutQueue.Size)
+	require.Equal(t, defaultOutQueueMaxRetries, cfg.OutQueue.MaxRetries)
+	require.Equal(t, defaultOutQueueBackoff, cfg.OutQueue.Backoff)
+	require.Equal(t, defaultOutQueueMaxBackoff, cfg.OutQueue.MaxBackoff)
+
+	rawCfg = `
+dialback_secret: s3cr3t
+out_queue:
+  size: 50
+  max_retries: 5
+  backoff: 1
+  max_backoff: 30
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 50, cfg.OutQueue.Size)
+	require.Equal(t, 5, cfg.OutQueue.MaxRetries)
+	require.Equal(t, time.Second, cfg.OutQueue.Backoff)
+	require.Equal(t, time.Duration(30)*time.Second, cfg.OutQueue.MaxBackoff)
 }
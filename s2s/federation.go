@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// OpenFederation allows federating with any remote domain not explicitly denied.
+	OpenFederation = "open"
+
+	// ClosedFederation only allows federating with explicitly allowed remote domains.
+	ClosedFederation = "closed"
+)
+
+// DomainPolicy represents a set of federation requirements applied to remote domains matching its pattern.
+type DomainPolicy struct {
+	Domain        string `yaml:"domain"`
+	RequireTLS    bool   `yaml:"require_tls"`
+	RequireCert   bool   `yaml:"require_cert"`
+	MaxStanzaSize int    `yaml:"max_stanza_size"`
+}
+
+// FederationConfig represents s2s federation policies.
+// Domain patterns may start with a '*.' wildcard in order to match any subdomain, or be a single '*' to match all domains.
+type FederationConfig struct {
+	Mode     string
+	Allow    []string
+	Deny     []string
+	Policies []DomainPolicy
+}
+
+type federationConfigProxy struct {
+	Mode     string         `yaml:"mode"`
+	Allow    []string       `yaml:"allow"`
+	Deny     []string       `yaml:"deny"`
+	Policies []DomainPolicy `yaml:"domains"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *FederationConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := federationConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	switch p.Mode {
+	case "":
+		c.Mode = OpenFederation
+	case OpenFederation, ClosedFederation:
+		c.Mode = p.Mode
+	default:
+		return fmt.Errorf("s2s.FederationConfig: unrecognized federation mode: %s", p.Mode)
+	}
+	for _, pl := range p.Policies {
+		if len(pl.Domain) == 0 {
+			return fmt.Errorf("s2s.FederationConfig: domain policy must specify a domain")
+		}
+	}
+	c.Allow = p.Allow
+	c.Deny = p.Deny
+	c.Policies = p.Policies
+	return nil
+}
+
+// IsAllowed returns whether or not federating with a remote domain is allowed.
+// Deny list always takes precedence over allow list.
+func (c *FederationConfig) IsAllowed(remoteDomain string) bool {
+	if c == nil {
+		return true
+	}
+	if matchesAnyDomain(c.Deny, remoteDomain) {
+		return false
+	}
+	if c.Mode == ClosedFederation {
+		return matchesAnyDomain(c.Allow, remoteDomain)
+	}
+	return true
+}
+
+// Policy returns the policy associated to a remote domain, or an empty one if none matches.
+// Exact domain policies take precedence over wildcard ones.
+func (c *FederationConfig) Policy(remoteDomain string) DomainPolicy {
+	if c == nil {
+		return DomainPolicy{}
+	}
+	var ret *DomainPolicy
+	for i, pl := range c.Policies {
+		if pl.Domain == remoteDomain {
+			return pl
+		}
+		if ret == nil && matchesDomain(pl.Domain, remoteDomain) {
+			ret = &c.Policies[i]
+		}
+	}
+	if ret == nil {
+		return DomainPolicy{}
+	}
+	return *ret
+}
+
+func matchesAnyDomain(patterns []string, domain string) bool {
+	for _, pattern := range patterns {
+		if matchesDomain(pattern, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesDomain(pattern, domain string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(domain, pattern[1:])
+	default:
+		return pattern == domain
+	}
+}
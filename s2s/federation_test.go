@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestFederationConfig(t *testing.T) {
+	cfg := FederationConfig{}
+	err := yaml.Unmarshal([]byte(`mode: half-open`), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte(`
+domains:
+  - require_cert: true
+`), &cfg)
+	require.NotNil(t, err) // missing domain
+
+	err = yaml.Unmarshal([]byte(`
+allow: ["jabber.org"]
+`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, OpenFederation, cfg.Mode)
+
+	err = yaml.Unmarshal([]byte(`
+mode: closed
+allow: ["jabber.org", "*.example.com"]
+deny: ["spam.example.com"]
+domains:
+  - domain: "*.bank.com"
+    require_tls: true
+    max_stanza_size: 4096
+  - domain: "secure.bank.com"
+    require_cert: true
+`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, ClosedFederation, cfg.Mode)
+	require.Len(t, cfg.Policies, 2)
+}
+
+func TestFederationConfig_IsAllowed(t *testing.T) {
+	var cfg *FederationConfig
+	require.True(t, cfg.IsAllowed("jabber.org"))
+
+	cfg = &FederationConfig{
+		Mode: OpenFederation,
+		Deny: []string{"spam.org", "*.spam.net"},
+	}
+	require.True(t, cfg.IsAllowed("jabber.org"))
+	require.False(t, cfg.IsAllowed("spam.org"))
+	require.False(t, cfg.IsAllowed("xmpp.spam.net"))
+	require.True(t, cfg.IsAllowed("spam.net"))
+
+	cfg = &FederationConfig{
+		Mode:  ClosedFederation,
+		Allow: []string{"jabber.org", "*.example.com"},
+		Deny:  []string{"spam.example.com"},
+	}
+	require.True(t, cfg.IsAllowed("jabber.org"))
+	require.True(t, cfg.IsAllowed("xmpp.example.com"))
+	require.False(t, cfg.IsAllowed("spam.example.com"))
+	require.False(t, cfg.IsAllowed("jabber.net"))
+
+	cfg = &FederationConfig{Mode: ClosedFederation, Allow: []string{"*"}}
+	require.True(t, cfg.IsAllowed("jabber.net"))
+}
+
+func TestFederationConfig_Policy(t *testing.T) {
+	cfg := &FederationConfig{
+		Policies: []DomainPolicy{
+			{Domain: "*.bank.com", RequireTLS: true, MaxStanzaSize: 4096},
+			{Domain: "secure.bank.com", RequireCert: true},
+		},
+	}
+	p := cfg.Policy("xmpp.bank.com")
+	require.True(t, p.RequireTLS)
+	require.False(t, p.RequireCert)
+	require.Equal(t, 4096, p.MaxStanzaSize)
+
+	p = cfg.Policy("secure.bank.com")
+	require.True(t, p.RequireCert)
+	require.False(t, p.RequireTLS)
+
+	require.Equal(t, DomainPolicy{}, cfg.Policy("jabber.org"))
+}
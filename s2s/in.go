@@ -9,6 +9,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -19,6 +20,7 @@ import (
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/session"
 	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/util/ratelimit"
 	"github.com/ortuman/jackal/util/runqueue"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
@@ -30,6 +32,11 @@ const (
 	inDisconnected
 )
 
+const (
+	bidiFeatureNamespace = "urn:xmpp:features:bidi"
+	bidiNamespace        = "urn:xmpp:bidi"
+)
+
 type inStream struct {
 	id            string
 	cfg           *inConfig
@@ -37,6 +44,7 @@ type inStream struct {
 	mods          *module.Modules
 	localDomain   string
 	remoteDomain  string
+	authDomain    string // remote domain verified through SASL EXTERNAL or dialback
 	state         uint32
 	tr            transport.Transport
 	mu            sync.RWMutex
@@ -45,7 +53,10 @@ type inStream struct {
 	sess          *session.Session
 	secured       uint32
 	authenticated uint32
+	bidi          uint32
+	preauthd      bool
 	newOut        newOutFunc
+	limiter       *ratelimit.Limiter
 	runQueue      *runqueue.RunQueue
 }
 
@@ -63,6 +74,12 @@ func newInStream(config *inConfig, tr transport.Transport, mods *module.Modules,
 	if alreadySecuredAndAuthd {
 		s.secured = 1
 		s.authenticated = 1
+		s.preauthd = true
+	}
+	// shape inbound traffic
+	if config.rateLimit != nil {
+		s.limiter = ratelimit.New(config.rateLimit)
+		s.tr = transport.NewRateLimitedTransport(tr, s.limiter)
 	}
 	// start s2s in session
 	s.restartSession()
@@ -78,6 +95,19 @@ func (s *inStream) ID() string {
 	return s.id
 }
 
+// RemoteAddr returns the network address of the initiating server.
+func (s *inStream) RemoteAddr() net.Addr {
+	return s.tr.RemoteAddr()
+}
+
+// SendElement writes an element back to the initiating server.
+// Only used once a bidirectional stream has been negotiated.
+func (s *inStream) SendElement(ctx context.Context, elem xmpp.XElement) {
+	s.runQueue.Run(func() {
+		s.writeElement(ctx, elem)
+	})
+}
+
 func (s *inStream) Disconnect(ctx context.Context, err error) {
 	if s.getState() == inDisconnected {
 		return
@@ -103,6 +133,12 @@ func (s *inStream) doRead() {
 	elem, sErr := s.sess.Receive()
 	s.cancelReadTimeout()
 
+	if sErr == nil && elem != nil && elem.IsStanza() && s.limiter != nil {
+		if err := s.limiter.WaitStanza(); err != nil {
+			log.Infof("s2s stanza rate limit exceeded... id: %s", s.id)
+			sErr = &session.Error{UnderlyingErr: streamerror.ErrPolicyViolation}
+		}
+	}
 	ctx, _ := context.WithTimeout(context.Background(), s.cfg.timeout)
 	if sErr == nil {
 		s.runQueue.Run(func() {
@@ -137,12 +173,27 @@ func (s *inStream) handleConnecting(ctx context.Context, elem xmpp.XElement) {
 	s.localDomain = s.router.Hosts().DefaultHostName()
 	s.remoteDomain = elem.From()
 
+	if s.preauthd && len(s.authenticatedDomain()) == 0 {
+		s.setAuthenticated(s.remoteDomain)
+	}
+	if authDomain := s.authenticatedDomain(); len(authDomain) > 0 && authDomain != s.remoteDomain {
+		// a restarted stream cannot switch to a domain other than the authenticated one
+		log.Infof("s2s in stream domain mismatch... (authenticated: %s, remote: %s)", authDomain, s.remoteDomain)
+		s.disconnectWithStreamError(ctx, streamerror.ErrInvalidFrom)
+		return
+	}
+
 	// open stream session
 	s.sess.SetRemoteDomain(s.remoteDomain)
 
 	j, _ := jid.New("", s.localDomain, "", true)
 	s.sess.SetJID(j)
 
+	if err := s.checkFederationPolicy(); err != nil {
+		log.Infof("s2s in stream rejected by federation policy... (remote: %s)", s.remoteDomain)
+		s.disconnectWithStreamError(ctx, err)
+		return
+	}
 	features := xmpp.NewElementName("stream:features")
 	features.SetAttribute("xmlns:stream", streamNamespace)
 	features.SetAttribute("version", "1.0")
@@ -158,6 +209,11 @@ func (s *inStream) handleConnecting(ctx context.Context, elem xmpp.XElement) {
 
 	_ = s.sess.Open(ctx, nil)
 
+	if s.cfg.onBidi != nil && !s.isBidi() {
+		// offer bidirectional stream (XEP-0288)
+		features.AppendElement(xmpp.NewElementNamespace("bidi", bidiFeatureNamespace))
+	}
+
 	if !s.isAuthenticated() {
 		// offer external authentication
 		mechanisms := xmpp.NewElementName("mechanisms")
@@ -167,9 +223,11 @@ func (s *inStream) handleConnecting(ctx context.Context, elem xmpp.XElement) {
 		mechanisms.AppendElement(extMech)
 		features.AppendElement(mechanisms)
 	}
-	dbBack := xmpp.NewElementNamespace("dialback", dialbackNamespace)
-	dbBack.AppendElement(xmpp.NewElementName("errors"))
-	features.AppendElement(dbBack)
+	if !s.cfg.federation.Policy(s.remoteDomain).RequireCert {
+		dbBack := xmpp.NewElementNamespace("dialback", dialbackNamespace)
+		dbBack.AppendElement(xmpp.NewElementName("errors"))
+		features.AppendElement(dbBack)
+	}
 
 	s.setState(inConnected)
 	s.writeElement(ctx, features)
@@ -184,6 +242,10 @@ func (s *inStream) handleConnected(ctx context.Context, elem xmpp.XElement) {
 		s.startAuthentication(ctx, elem)
 		return
 	}
+	if elem.Name() == "bidi" && elem.Namespace() == bidiNamespace {
+		s.enableBidi()
+		return
+	}
 	switch elem.Name() {
 	case "db:result":
 		s.authorizeDialbackKey(ctx, elem)
@@ -194,75 +256,43 @@ func (s *inStream) handleConnected(ctx context.Context, elem xmpp.XElement) {
 	default:
 		switch elem := elem.(type) {
 		case xmpp.Stanza:
+			if !s.isAuthenticated() {
+				s.disconnectWithStreamError(ctx, streamerror.ErrNotAuthorized)
+				return
+			}
+			fromDomain := elem.FromJID().Domain()
+			if fromDomain != s.authenticatedDomain() || !s.cfg.federation.IsAllowed(fromDomain) {
+				log.Infof("s2s in stream discarded stanza from unauthorized domain: %s (id: %s)", fromDomain, s.id)
+				return
+			}
 			s.processStanza(ctx, elem)
 		}
 	}
 }
 
 func (s *inStream) processStanza(ctx context.Context, stanza xmpp.Stanza) {
-	switch stanza := stanza.(type) {
-	case *xmpp.Presence:
-		s.processPresence(ctx, stanza)
-	case *xmpp.IQ:
-		s.processIQ(ctx, stanza)
-	case *xmpp.Message:
-		s.processMessage(ctx, stanza)
-	}
-}
-
-func (s *inStream) processPresence(ctx context.Context, presence *xmpp.Presence) {
-	// process roster presence
-	if presence.ToJID().IsBare() {
-		if r := s.mods.Roster; r != nil {
-			r.ProcessPresence(ctx, presence)
-			return
-		}
-	}
-	_ = s.router.Route(ctx, presence)
+	p := &stanzaProcessor{router: s.router, mods: s.mods}
+	p.process(ctx, stanza, s.writeElement)
 }
 
-func (s *inStream) processIQ(ctx context.Context, iq *xmpp.IQ) {
-	toJID := iq.ToJID()
-
-	replyOnBehalf := !toJID.IsFullWithUser() && s.router.Hosts().IsLocalHost(toJID.Domain())
-	if !replyOnBehalf {
-		switch s.router.Route(ctx, iq) {
-		case router.ErrResourceNotFound:
-			s.writeElement(ctx, iq.ServiceUnavailableError())
-		case router.ErrFailedRemoteConnect:
-			s.writeElement(ctx, iq.RemoteServerNotFoundError())
-		case router.ErrBlockedJID:
-			// Destination user is a blocked JID
-			if iq.IsGet() || iq.IsSet() {
-				s.writeElement(ctx, iq.ServiceUnavailableError())
-			}
-		}
+// enableBidi marks stream as bidirectional, making it available for outgoing traffic once authenticated.
+func (s *inStream) enableBidi() {
+	if s.cfg.onBidi == nil || !atomic.CompareAndSwapUint32(&s.bidi, 0, 1) {
 		return
 	}
-	s.mods.ProcessIQ(ctx, iq)
+	log.Infof("s2s in stream bidirectional... id: %s", s.id)
+	if s.isAuthenticated() {
+		s.registerBidi(s.localDomain)
+	}
 }
 
-func (s *inStream) processMessage(ctx context.Context, message *xmpp.Message) {
-	msg := message
-
-sendMessage:
-	err := s.router.Route(ctx, msg)
-	switch err {
-	case nil:
-		break
-	case router.ErrResourceNotFound:
-		// treat the stanza as if it were addressed to <node@domain>
-		msg, _ = xmpp.NewMessageFromElement(msg, msg.FromJID(), msg.ToJID().ToBareJID())
-		goto sendMessage
-	case router.ErrNotAuthenticated:
-		if off := s.mods.Offline; off != nil {
-			off.ArchiveMessage(ctx, message)
-			return
-		}
-	default:
-		// silently ignore it...
-		break
+// registerBidi makes the stream available for outgoing traffic toward the authenticated remote domain.
+func (s *inStream) registerBidi(localDomain string) {
+	authDomain := s.authenticatedDomain()
+	if !s.isBidi() || len(authDomain) == 0 {
+		return
 	}
+	s.cfg.onBidi(s, localDomain, authDomain)
 }
 
 func (s *inStream) proceedStartTLS(ctx context.Context, elem xmpp.XElement) {
@@ -277,9 +307,9 @@ func (s *inStream) proceedStartTLS(ctx context.Context, elem xmpp.XElement) {
 	s.writeElement(ctx, xmpp.NewElementNamespace("proceed", tlsNamespace))
 
 	s.tr.StartTLS(&tls.Config{
-		ServerName:   s.localDomain,
-		ClientAuth:   tls.VerifyClientCertIfGiven,
-		Certificates: s.router.Hosts().Certificates(),
+		ServerName:     s.localDomain,
+		ClientAuth:     tls.VerifyClientCertIfGiven,
+		GetCertificate: s.router.Hosts().GetCertificate,
 	}, false)
 	atomic.StoreUint32(&s.secured, 1)
 
@@ -301,7 +331,7 @@ func (s *inStream) startAuthentication(ctx context.Context, elem xmpp.XElement)
 	for _, cert := range certs {
 		for _, dnsName := range cert.DNSNames {
 			if dnsName == s.remoteDomain {
-				s.finishAuthentication(ctx)
+				s.finishAuthentication(ctx, dnsName)
 				return
 			}
 		}
@@ -309,13 +339,15 @@ func (s *inStream) startAuthentication(ctx context.Context, elem xmpp.XElement)
 	s.failAuthentication(ctx, "bad-protocol", "failed to get peer certificate")
 }
 
-func (s *inStream) finishAuthentication(ctx context.Context) {
-	log.Infof("s2s in stream authenticated")
-	atomic.StoreUint32(&s.authenticated, 1)
+func (s *inStream) finishAuthentication(ctx context.Context, domain string) {
+	log.Infof("s2s in stream authenticated... (domain: %s)", domain)
+	s.setAuthenticated(domain)
 
 	success := xmpp.NewElementNamespace("success", saslNamespace)
 	s.writeElement(ctx, success)
 	s.restartSession()
+
+	s.registerBidi(s.localDomain)
 }
 
 func (s *inStream) failAuthentication(ctx context.Context, reason, text string) {
@@ -335,6 +367,15 @@ func (s *inStream) authorizeDialbackKey(ctx context.Context, elem xmpp.XElement)
 		s.writeStanzaErrorResponse(ctx, elem, xmpp.ErrItemNotFound)
 		return
 	}
+	if elem.From() != s.remoteDomain {
+		// dialback key must be bound to the domain the stream was opened for
+		s.disconnectWithStreamError(ctx, streamerror.ErrInvalidFrom)
+		return
+	}
+	if !s.cfg.federation.IsAllowed(elem.From()) || s.cfg.federation.Policy(elem.From()).RequireCert {
+		s.writeStanzaErrorResponse(ctx, elem, xmpp.ErrNotAuthorized)
+		return
+	}
 	log.Infof("authorizing dialback key: %s...", elem.Text())
 
 	// verify stream
@@ -350,7 +391,7 @@ func (s *inStream) authorizeDialbackKey(ctx context.Context, elem xmpp.XElement)
 		reply.SetTo(elem.From())
 		if valid {
 			reply.SetType("valid")
-			atomic.StoreUint32(&s.authenticated, 1)
+			s.setAuthenticated(elem.From())
 
 		} else {
 			reply.SetType("invalid")
@@ -358,6 +399,10 @@ func (s *inStream) authorizeDialbackKey(ctx context.Context, elem xmpp.XElement)
 		s.writeElement(ctx, reply)
 		outStm.Disconnect(ctx, nil)
 
+		if valid {
+			s.registerBidi(elem.To())
+		}
+
 	case <-outStm.done():
 		// remote server closed connection unexpectedly
 		s.writeStanzaErrorResponse(ctx, elem, xmpp.ErrRemoteServerTimeout)
@@ -386,6 +431,29 @@ func (s *inStream) verifyDialbackKey(ctx context.Context, elem xmpp.XElement) {
 	s.writeElement(ctx, dbVerify)
 }
 
+// checkFederationPolicy verifies remote domain is allowed to federate and that its stream
+// satisfies domain requirements.
+func (s *inStream) checkFederationPolicy() *streamerror.Error {
+	if !s.cfg.federation.IsAllowed(s.remoteDomain) {
+		return streamerror.ErrPolicyViolation
+	}
+	policy := s.cfg.federation.Policy(s.remoteDomain)
+	if s.preauthd && (policy.RequireTLS || policy.RequireCert) {
+		// pre-secured streams never negotiate TLS nor authenticate peer certificate
+		return streamerror.ErrPolicyViolation
+	}
+	return nil
+}
+
+func (s *inStream) maxStanzaSize() int {
+	if len(s.remoteDomain) > 0 {
+		if size := s.cfg.federation.Policy(s.remoteDomain).MaxStanzaSize; size > 0 {
+			return size
+		}
+	}
+	return s.cfg.maxStanzaSize
+}
+
 func (s *inStream) writeStanzaErrorResponse(ctx context.Context, elem xmpp.XElement, stanzaErr *xmpp.StanzaError) {
 	resp := xmpp.NewElementFromElement(elem)
 	resp.SetType(xmpp.ErrorType)
@@ -467,7 +535,7 @@ func (s *inStream) restartSession() {
 	j, _ := jid.New("", s.localDomain, "", true)
 	s.sess = session.New(s.id, &session.Config{
 		JID:           j,
-		MaxStanzaSize: s.cfg.maxStanzaSize,
+		MaxStanzaSize: s.maxStanzaSize(),
 		RemoteDomain:  s.remoteDomain,
 		IsServer:      true,
 	}, s.tr, s.router.Hosts())
@@ -501,6 +569,24 @@ func (s *inStream) isAuthenticated() bool {
 	return atomic.LoadUint32(&s.authenticated) == 1
 }
 
+// setAuthenticated marks the stream as authenticated on behalf of domain.
+func (s *inStream) setAuthenticated(domain string) {
+	s.mu.Lock()
+	s.authDomain = domain
+	s.mu.Unlock()
+	atomic.StoreUint32(&s.authenticated, 1)
+}
+
+func (s *inStream) authenticatedDomain() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.authDomain
+}
+
+func (s *inStream) isBidi() bool {
+	return atomic.LoadUint32(&s.bidi) == 1
+}
+
 func (s *inStream) setState(state uint32) {
 	atomic.StoreUint32(&s.state, state)
 }
@@ -252,7 +252,7 @@ func TestStream_DialbackAuthorize(t *testing.T) {
 	atomic.StoreUint32(&stm.secured, 1)
 	atomic.StoreUint32(&stm.authenticated, 1)
 
-	_, _ = conn.inboundWriteString(`<db:result to="jackal.im">abcd</db:result>`)
+	_, _ = conn.inboundWriteString(`<db:result from="localhost" to="jackal.im">abcd</db:result>`)
 	_ = outConn.Close()
 	elem = conn.outboundRead()
 	require.Equal(t, "db:result", elem.Name())
@@ -274,7 +274,7 @@ func TestStream_DialbackAuthorize(t *testing.T) {
 	atomic.StoreUint32(&stm.secured, 1)
 	atomic.StoreUint32(&stm.authenticated, 1)
 
-	_, _ = conn.inboundWriteString(`<db:result to="jackal.im">abcd</db:result>`)
+	_, _ = conn.inboundWriteString(`<db:result from="localhost" to="jackal.im">abcd</db:result>`)
 
 	_, _ = outConn.inboundWriteString(`
 <?xml version="1.0"?>
@@ -334,7 +334,7 @@ func TestStream_SendElement(t *testing.T) {
 	_ = conn.outboundRead() // read stream opening...
 	_ = conn.outboundRead() // read stream features...
 	atomic.StoreUint32(&stm.secured, 1)
-	atomic.StoreUint32(&stm.authenticated, 1)
+	stm.setAuthenticated("localhost")
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.ResultType)
@@ -353,6 +353,198 @@ func TestStream_SendElement(t *testing.T) {
 	require.True(t, conn.waitClose())
 }
 
+func TestStream_UnauthorizedStanza(t *testing.T) {
+	r, h := setupTestRouter(jackaDomain)
+
+	op := NewOutProvider(&Config{KeepAlive: time.Second}, h)
+
+	fromJID, _ := jid.New("ortuman", "localhost", "garden", true)
+	toJID, _ := jid.New("ortuman", "jackal.im", "garden", true)
+
+	stm2 := stream.NewMockC2S("abcd7890", toJID)
+	stm2.SetPresence(xmpp.NewPresence(toJID, toJID, xmpp.AvailableType))
+	r.Bind(context.Background(), stm2)
+
+	// stanza received before authenticating
+	stm, conn := tUtilInStreamInit(t, r, op, false)
+	tUtilInStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+	atomic.StoreUint32(&stm.secured, 1)
+
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(toJID)
+	_, _ = conn.inboundWriteString(msg.String())
+
+	require.True(t, conn.waitClose())
+	require.Equal(t, inDisconnected, stm.getState())
+
+	// stanza from a domain other than the authenticated one
+	stm, conn = tUtilInStreamInit(t, r, op, false)
+	tUtilInStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+	atomic.StoreUint32(&stm.secured, 1)
+	stm.setAuthenticated("jabber.org")
+
+	_, _ = conn.inboundWriteString(msg.String())
+
+	// wait until discarded stanza has been processed
+	_, _ = conn.inboundWriteString(`<db:verify id="abcde" from="localhost" to="jackal.im">abcd</db:verify>`)
+	elem := conn.outboundRead()
+	require.Equal(t, "db:verify", elem.Name())
+
+	// discarded stanzas are never routed, while authorized ones are
+	stm.setAuthenticated("localhost")
+
+	msgID := uuid.New()
+	msg = xmpp.NewMessageType(msgID, xmpp.ChatType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(toJID)
+	_, _ = conn.inboundWriteString(msg.String())
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, msgID, elem.ID())
+}
+
+func TestStream_Bidi(t *testing.T) {
+	r, h := setupTestRouter(jackaDomain)
+
+	op := NewOutProvider(&Config{KeepAlive: time.Second}, h)
+
+	cfg, tr, conn := tUtilInStreamDefaultConfig(t, true)
+	cfg.onBidi = op.registerBidi
+	stm := newInStream(cfg, tr, &module.Modules{}, op.newOut, r, false)
+	atomic.StoreUint32(&stm.secured, 1)
+
+	tUtilInStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+	require.NotNil(t, elem.Elements().ChildNamespace("bidi", bidiFeatureNamespace))
+
+	_, _ = conn.inboundWriteString(`<bidi xmlns="urn:xmpp:bidi"/>`)
+	_, _ = conn.inboundWriteString(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="EXTERNAL">=</auth>`)
+	elem = conn.outboundRead()
+	require.Equal(t, "success", elem.Name())
+
+	// in stream is reused instead of dialing the initiating server
+	require.Eventually(t, func() bool {
+		return op.GetOut("jackal.im", "localhost") == stream.S2SOut(stm)
+	}, time.Second, time.Millisecond*10)
+
+	fromJID, _ := jid.New("ortuman", "jackal.im", "garden", true)
+	toJID, _ := jid.New("noelia", "localhost", "yard", true)
+
+	msgID := uuid.New()
+	msg := xmpp.NewMessageType(msgID, xmpp.ChatType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(toJID)
+	op.GetOut("jackal.im", "localhost").SendElement(context.Background(), msg)
+
+	elem = conn.outboundRead()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, msgID, elem.ID())
+
+	op.unregisterBidi(stm)
+
+	op.mu.RLock()
+	require.Len(t, op.bidiConnections, 0)
+	op.mu.RUnlock()
+}
+
+func TestStream_BidiAuthenticatedDomain(t *testing.T) {
+	r, h := setupTestRouter(jackaDomain)
+
+	op := NewOutProvider(&Config{KeepAlive: time.Second}, h)
+
+	// dialback key for a domain other than the stream one
+	cfg, tr, conn := tUtilInStreamDefaultConfig(t, false)
+	cfg.onBidi = op.registerBidi
+	stm := newInStream(cfg, tr, &module.Modules{}, op.newOut, r, false)
+	atomic.StoreUint32(&stm.secured, 1)
+
+	tUtilInStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	_, _ = conn.inboundWriteString(`<bidi xmlns="urn:xmpp:bidi"/>`)
+	_, _ = conn.inboundWriteString(`<db:result from="victim.org" to="jackal.im">abcd</db:result>`)
+	require.True(t, conn.waitClose())
+
+	// restarted stream cannot switch to another domain once authenticated
+	cfg, tr, conn = tUtilInStreamDefaultConfig(t, true)
+	cfg.onBidi = op.registerBidi
+	stm = newInStream(cfg, tr, &module.Modules{}, op.newOut, r, false)
+	atomic.StoreUint32(&stm.secured, 1)
+
+	tUtilInStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	_, _ = conn.inboundWriteString(`<bidi xmlns="urn:xmpp:bidi"/>`)
+	_, _ = conn.inboundWriteString(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="EXTERNAL">=</auth>`)
+	elem := conn.outboundRead()
+	require.Equal(t, "success", elem.Name())
+	require.Equal(t, "localhost", stm.authenticatedDomain())
+
+	_, _ = conn.inboundWriteString(`<?xml version="1.0"?>
+	<stream:stream xmlns:stream="http://etherx.jabber.org/streams"
+	version="1.0" xmlns="jabber:server" to="jackal.im" from="victim.org" xmlns:xml="http://www.w3.org/XML/1998/namespace">
+`)
+	require.True(t, conn.waitClose())
+
+	op.mu.RLock()
+	require.Nil(t, op.bidiConnections[getDomainPair("jackal.im", "victim.org")])
+	op.mu.RUnlock()
+}
+
+func TestStream_FederationPolicy(t *testing.T) {
+	r, h := setupTestRouter(jackaDomain)
+
+	op := NewOutProvider(&Config{KeepAlive: time.Second}, h)
+
+	// denied remote domain
+	cfg, tr, conn := tUtilInStreamDefaultConfig(t, false)
+	cfg.federation = &FederationConfig{Mode: ClosedFederation, Allow: []string{"jabber.org"}}
+	stm := newInStream(cfg, tr, &module.Modules{}, op.newOut, r, false)
+
+	tUtilInStreamOpen(conn)
+	require.True(t, conn.waitClose())
+	require.Equal(t, inDisconnected, stm.getState())
+
+	// certificate authentication required
+	cfg, tr, conn = tUtilInStreamDefaultConfig(t, false)
+	cfg.federation = &FederationConfig{Mode: OpenFederation, Policies: []DomainPolicy{{Domain: "localhost", RequireCert: true}}}
+	stm = newInStream(cfg, tr, &module.Modules{}, op.newOut, r, false)
+	atomic.StoreUint32(&stm.secured, 1)
+
+	tUtilInStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+
+	elem := conn.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+	require.NotNil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
+	require.Nil(t, elem.Elements().ChildNamespace("dialback", dialbackNamespace))
+
+	_, _ = conn.inboundWriteString(`<db:result from="localhost" to="jackal.im">abcd</db:result>`)
+	elem = conn.outboundRead()
+	require.Equal(t, "db:result", elem.Name())
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Elements().Child("error").Elements().Child("not-authorized"))
+
+	// pre-authenticated streams don't satisfy certificate requirement
+	cfg, tr, conn = tUtilInStreamDefaultConfig(t, false)
+	cfg.federation = &FederationConfig{Mode: OpenFederation, Policies: []DomainPolicy{{Domain: "*", RequireCert: true}}}
+	stm = newInStream(cfg, tr, &module.Modules{}, op.newOut, r, true)
+
+	tUtilInStreamOpen(conn)
+	require.True(t, conn.waitClose())
+	require.Equal(t, inDisconnected, stm.getState())
+}
+
 func tUtilInStreamInit(t *testing.T, router router.Router, outProvider *OutProvider, loadPeerCertificate bool) (*inStream, *fakeSocketConn) {
 	cfg, tr, conn := tUtilInStreamDefaultConfig(t, loadPeerCertificate)
 	stm := newInStream(cfg, tr, &module.Modules{}, outProvider.newOut, router, false)
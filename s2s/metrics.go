@@ -0,0 +1,26 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	tcpPath   = "tcp"
+	scionPath = "scion"
+)
+
+var outStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "jackal",
+	Subsystem: "s2s",
+	Name:      "out_streams",
+	Help:      "Number of s2s out streams by transport path and state.",
+}, []string{"path", "state"})
+
+func init() {
+	prometheus.MustRegister(outStreams)
+}
@@ -33,6 +33,27 @@ const (
 	outDisconnected
 )
 
+var outStateNames = map[uint32]string{
+	outConnecting:             "connecting",
+	outConnected:              "connected",
+	outSecuring:               "securing",
+	outAuthenticating:         "authenticating",
+	outValidatingDialbackKey:  "validating_dialback_key",
+	outAuthorizingDialbackKey: "authorizing_dialback_key",
+	outVerified:               "verified",
+	outDisconnected:           "disconnected",
+}
+
+// OutStreamInfo describes the state of an s2s out stream.
+type OutStreamInfo struct {
+	DomainPair   string    `json:"domain_pair"`
+	State        string    `json:"state"`
+	Pending      int       `json:"pending"`
+	Retries      int       `json:"retries"`
+	Bidi         bool      `json:"bidi"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
 type outStream struct {
 	id            string
 	cfg           *outConfig
@@ -46,7 +67,13 @@ type outStream struct {
 	readTimeoutTm *time.Timer
 	secured       uint32
 	authenticated uint32
+	bidi          uint32
+	unregistered  uint32
 	pendingSendQ  []xmpp.XElement
+	retries       int
+	retryTm       *time.Timer
+	idleTm        *time.Timer
+	lastActivity  time.Time
 	dbVerify      xmpp.XElement
 	verifyCh      chan bool
 	discCh        chan *streamerror.Error
@@ -74,6 +101,20 @@ func (s *outStream) ID() string {
 	return s.cfg.localDomain + ":" + s.cfg.remoteDomain
 }
 
+// Info returns a snapshot of stream state.
+func (s *outStream) Info() OutStreamInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return OutStreamInfo{
+		DomainPair:   s.ID(),
+		State:        outStateNames[s.getState()],
+		Pending:      len(s.pendingSendQ),
+		Retries:      s.retries,
+		Bidi:         s.isBidi(),
+		LastActivity: s.lastActivity,
+	}
+}
+
 func (s *outStream) SendElement(ctx context.Context, elem xmpp.XElement) {
 	s.runQueue.Run(func() {
 		s.sendElement(ctx, elem)
@@ -84,29 +125,137 @@ func (s *outStream) Disconnect(ctx context.Context, err error) {
 	waitCh := make(chan struct{})
 	s.runQueue.Stop(func() {
 		defer close(waitCh)
-		if s.getState() == outDisconnected {
-			return
+		if s.getState() != outDisconnected {
+			s.disconnect(ctx, err)
 		}
-		s.disconnect(ctx, err)
+		// no more connection attempts will be made
+		s.bounceAll(ctx, xmpp.ErrRemoteServerTimeout)
+		s.cancelIdleTimeout()
+		s.notifyDisconnect()
 	})
 	<-waitCh
 }
 
 func (s *outStream) sendElement(ctx context.Context, elem xmpp.XElement) {
+	if s.isUnregistered() && s.cfg.onReroute != nil {
+		// stream was unregistered after element had been dispatched
+		s.cfg.onReroute(ctx, elem)
+		return
+	}
 	switch s.getState() {
 	case outVerified:
 		s.writeElement(ctx, elem)
 	case outDisconnected:
+		if !s.enqueue(ctx, elem) || s.retryTm != nil {
+			return // waiting for next connection attempt
+		}
 		if err := s.start(ctx); err != nil {
 			log.Error(err)
-			return
+			s.handleConnectFailure(ctx, xmpp.ErrRemoteServerNotFound)
 		}
-		fallthrough
 	default:
 		// send element after verification has been completed
-		s.pendingSendQ = append(s.pendingSendQ, elem)
+		s.enqueue(ctx, elem)
+	}
+}
+
+// enqueue appends an element to the pending queue, bouncing it back to its sender in case queue is full.
+func (s *outStream) enqueue(ctx context.Context, elem xmpp.XElement) bool {
+	if size := s.cfg.outQueue.Size; size > 0 && len(s.pendingSendQ) >= size {
+		log.Warnf("s2s out stream queue is full... (domainpair: %s)", s.ID())
+		s.bounce(ctx, elem, xmpp.ErrResourceConstraint)
+		return false
+	}
+	s.mu.Lock()
+	s.pendingSendQ = append(s.pendingSendQ, elem)
+	s.mu.Unlock()
+	return true
+}
+
+// handleConnectFailure schedules a new connection attempt, or bounces all pending elements
+// in case no more attempts are allowed.
+func (s *outStream) handleConnectFailure(ctx context.Context, stanzaErr *xmpp.StanzaError) {
+	if len(s.pendingSendQ) == 0 {
+		s.cancelRetry()
+		s.notifyDisconnect()
+		return
+	}
+	if s.retries >= s.cfg.outQueue.MaxRetries {
+		log.Infof("giving up s2s out stream connection... (domainpair: %s)", s.ID())
+		s.bounceAll(ctx, stanzaErr)
+		s.notifyDisconnect()
 		return
 	}
+	backoff := s.cfg.outQueue.Backoff << uint(s.retries)
+	if maxBackoff := s.cfg.outQueue.MaxBackoff; maxBackoff > 0 && (backoff > maxBackoff || backoff <= 0) {
+		backoff = maxBackoff
+	}
+	s.mu.Lock()
+	s.retries++
+	s.mu.Unlock()
+	log.Infof("retrying s2s out stream connection in %v... (domainpair: %s)", backoff, s.ID())
+
+	s.retryTm = time.AfterFunc(backoff, func() {
+		s.runQueue.Run(func() {
+			s.retryTm = nil
+			if s.getState() != outDisconnected {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), s.cfg.timeout)
+			defer cancel()
+			if err := s.start(ctx); err != nil {
+				log.Error(err)
+				s.handleConnectFailure(ctx, xmpp.ErrRemoteServerNotFound)
+			}
+		})
+	})
+}
+
+func (s *outStream) cancelRetry() {
+	if s.retryTm != nil {
+		s.retryTm.Stop()
+		s.retryTm = nil
+	}
+	s.mu.Lock()
+	s.retries = 0
+	s.mu.Unlock()
+}
+
+func (s *outStream) bounceAll(ctx context.Context, stanzaErr *xmpp.StanzaError) {
+	for _, elem := range s.pendingSendQ {
+		s.bounce(ctx, elem, stanzaErr)
+	}
+	s.mu.Lock()
+	s.pendingSendQ = nil
+	s.mu.Unlock()
+	s.cancelRetry()
+}
+
+// notifyDisconnect reports that stream is disconnected and has no pending work,
+// so that it can be replaced by a new one on next use.
+func (s *outStream) notifyDisconnect() {
+	if s.getState() != outDisconnected || s.retryTm != nil || len(s.pendingSendQ) > 0 {
+		return
+	}
+	if s.cfg.onDisconnect != nil {
+		s.cfg.onDisconnect(s)
+	}
+}
+
+func (s *outStream) bounce(ctx context.Context, elem xmpp.XElement, stanzaErr *xmpp.StanzaError) {
+	stanza, ok := elem.(xmpp.Stanza)
+	if !ok || s.cfg.onBounce == nil || stanza.FromJID() == nil || stanza.ToJID() == nil {
+		return
+	}
+	switch stanza.Type() {
+	case xmpp.ErrorType:
+		return // never bounce an error
+	case xmpp.ResultType:
+		if stanza.Name() == xmpp.IQName {
+			return
+		}
+	}
+	s.cfg.onBounce(ctx, xmpp.NewErrorStanzaFromStanza(stanza, stanzaErr, nil))
 }
 
 func (s *outStream) verify(ctx context.Context, streamID, from, to, key string) <-chan bool {
@@ -188,6 +337,8 @@ func (s *outStream) handleElement(ctx context.Context, elem xmpp.XElement) {
 		s.handleValidatingDialbackKey(ctx, elem)
 	case outAuthorizingDialbackKey:
 		s.handleAuthorizingDialbackKey(ctx, elem)
+	case outVerified:
+		s.handleVerified(ctx, elem)
 	}
 }
 
@@ -216,6 +367,11 @@ func (s *outStream) handleConnected(ctx context.Context, elem xmpp.XElement) {
 			s.writeElement(ctx, s.dbVerify)
 			return
 		}
+		if s.cfg.bidi && !s.isBidi() && elem.Elements().ChildNamespace("bidi", bidiFeatureNamespace) != nil {
+			// request bidirectional stream (XEP-0288)
+			s.writeElement(ctx, xmpp.NewElementNamespace("bidi", bidiNamespace))
+			atomic.StoreUint32(&s.bidi, 1)
+		}
 		if !s.isAuthenticated() {
 			var hasExternalAuth bool
 			if mechanisms := elem.Elements().ChildNamespace("mechanisms", saslNamespace); mechanisms != nil {
@@ -233,6 +389,11 @@ func (s *outStream) handleConnected(ctx context.Context, elem xmpp.XElement) {
 				auth.SetText("=")
 				s.writeElement(ctx, auth)
 
+			} else if s.cfg.requireCert {
+				// remote domain policy doesn't allow falling back to dialback
+				log.Infof("s2s out stream certificate authentication not available... (domainpair: %s)", s.ID())
+				s.disconnectWithStreamError(ctx, streamerror.ErrPolicyViolation)
+
 			} else if elem.Elements().ChildrenNamespace("dialback", dialbackNamespace) != nil {
 				s.setState(outValidatingDialbackKey)
 				db := xmpp.NewElementName("db:result")
@@ -315,14 +476,33 @@ func (s *outStream) handleAuthorizingDialbackKey(ctx context.Context, elem xmpp.
 	}
 }
 
+func (s *outStream) handleVerified(ctx context.Context, elem xmpp.XElement) {
+	stanza, ok := elem.(xmpp.Stanza)
+	if !ok || !s.isBidi() || s.cfg.processor == nil {
+		return
+	}
+	if stanza.FromJID().Domain() != s.cfg.remoteDomain {
+		// only the authenticated remote domain is allowed to send traffic back
+		log.Infof("s2s out stream discarded stanza from unauthenticated domain: %s", stanza.FromJID().Domain())
+		return
+	}
+	s.cfg.processor.process(ctx, stanza, s.writeElement)
+}
+
 func (s *outStream) finishVerification(ctx context.Context) {
 	s.setState(outVerified)
+	s.cancelRetry()
 
 	// send pending elements...
 	for _, el := range s.pendingSendQ {
 		s.writeElement(ctx, el)
 	}
+	s.mu.Lock()
 	s.pendingSendQ = nil
+	s.lastActivity = time.Now()
+	s.mu.Unlock()
+
+	s.scheduleIdleTimeout(s.cfg.idleTimeout)
 }
 
 func (s *outStream) writeStanzaErrorResponse(ctx context.Context, elem xmpp.XElement, stanzaErr *xmpp.StanzaError) {
@@ -338,6 +518,9 @@ func (s *outStream) writeElement(ctx context.Context, elem xmpp.XElement) {
 	if err := s.sess.Send(ctx, elem); err != nil {
 		log.Error(err)
 	}
+	s.mu.Lock()
+	s.lastActivity = time.Now()
+	s.mu.Unlock()
 }
 
 func (s *outStream) readElement(ctx context.Context, elem xmpp.XElement) {
@@ -367,12 +550,14 @@ func (s *outStream) disconnect(ctx context.Context, err error) {
 	switch err {
 	case nil:
 		s.disconnectClosingSession(ctx, false)
+		s.handleDisconnectError(ctx, nil)
 	default:
 		if stmErr, ok := err.(*streamerror.Error); ok {
 			s.disconnectWithStreamError(ctx, stmErr)
 		} else {
 			log.Error(err)
 			s.disconnectClosingSession(ctx, false)
+			s.handleDisconnectError(ctx, nil)
 		}
 	}
 }
@@ -387,6 +572,7 @@ func (s *outStream) disconnectWithStreamError(ctx context.Context, err *streamer
 	}
 	s.writeElement(ctx, err.Element())
 	s.disconnectClosingSession(ctx, true)
+	s.handleDisconnectError(ctx, err)
 }
 
 func (s *outStream) disconnectClosingSession(ctx context.Context, closeSession bool) {
@@ -395,11 +581,32 @@ func (s *outStream) disconnectClosingSession(ctx context.Context, closeSession b
 	}
 	atomic.StoreUint32(&s.secured, 0)
 	atomic.StoreUint32(&s.authenticated, 0)
+	atomic.StoreUint32(&s.bidi, 0)
 
 	s.setState(outDisconnected)
+	s.cancelIdleTimeout()
 	_ = s.tr.Close()
 }
 
+// handleDisconnectError decides what to do with pending elements after a disconnection
+// produced before stream verification.
+func (s *outStream) handleDisconnectError(ctx context.Context, err *streamerror.Error) {
+	if len(s.pendingSendQ) == 0 {
+		s.notifyDisconnect()
+		return
+	}
+	switch err {
+	case streamerror.ErrConnectionTimeout:
+		s.handleConnectFailure(ctx, xmpp.ErrRemoteServerTimeout)
+	case nil:
+		s.handleConnectFailure(ctx, xmpp.ErrRemoteServerNotFound)
+	default:
+		// authentication failures, policy violations and protocol errors won't be fixed by retrying
+		s.bounceAll(ctx, xmpp.ErrRemoteServerNotFound)
+		s.notifyDisconnect()
+	}
+}
+
 func (s *outStream) restartSession() {
 	j, _ := jid.New("", s.cfg.localDomain, "", true)
 	s.sess = session.New(s.id, &session.Config{
@@ -431,6 +638,52 @@ func (s *outStream) readTimeout() {
 	})
 }
 
+func (s *outStream) scheduleIdleTimeout(timeout time.Duration) {
+	if s.cfg.idleTimeout <= 0 {
+		return
+	}
+	s.cancelIdleTimeout()
+	s.idleTm = time.AfterFunc(timeout, func() {
+		s.runQueue.Run(s.idleTimeout)
+	})
+}
+
+func (s *outStream) cancelIdleTimeout() {
+	if s.idleTm != nil {
+		s.idleTm.Stop()
+		s.idleTm = nil
+	}
+}
+
+func (s *outStream) idleTimeout() {
+	s.idleTm = nil
+	if s.getState() != outVerified {
+		return
+	}
+	s.mu.RLock()
+	idle := time.Since(s.lastActivity)
+	s.mu.RUnlock()
+
+	if remaining := s.cfg.idleTimeout - idle; remaining > 0 {
+		s.scheduleIdleTimeout(remaining)
+		return
+	}
+	log.Infof("closing idle s2s out stream... (domainpair: %s)", s.ID())
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.timeout)
+	defer cancel()
+	s.disconnectClosingSession(ctx, true)
+	s.notifyDisconnect()
+}
+
+func (s *outStream) setUnregistered() {
+	atomic.StoreUint32(&s.unregistered, 1)
+}
+
+func (s *outStream) isUnregistered() bool {
+	return atomic.LoadUint32(&s.unregistered) == 1
+}
+
 func (s *outStream) isSecured() bool {
 	return atomic.LoadUint32(&s.secured) == 1
 }
@@ -439,8 +692,22 @@ func (s *outStream) isAuthenticated() bool {
 	return atomic.LoadUint32(&s.authenticated) == 1
 }
 
+func (s *outStream) isBidi() bool {
+	return atomic.LoadUint32(&s.bidi) == 1
+}
+
 func (s *outStream) setState(state uint32) {
-	atomic.StoreUint32(&s.state, state)
+	prev := atomic.SwapUint32(&s.state, state)
+	if prev == state {
+		return
+	}
+	// disconnected streams are not accounted
+	if prev != outDisconnected {
+		outStreams.WithLabelValues(s.cfg.path, outStateNames[prev]).Dec()
+	}
+	if state != outDisconnected {
+		outStreams.WithLabelValues(s.cfg.path, outStateNames[state]).Inc()
+	}
 }
 
 func (s *outStream) getState() uint32 {
@@ -7,14 +7,19 @@ package s2s
 
 import (
 	"context"
+	"errors"
 	"net"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router/host"
+	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/pborman/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -284,3 +289,252 @@ func tUtilOutStreamDefaultConfig() (*outConfig, Dialer, *fakeSocketConn) {
 		keyGen:        &keyGen{secret: "s3cr3t"},
 	}, d, conn
 }
+
+func TestOutStream_BounceOnConnectFailure(t *testing.T) {
+	h := setupTestHosts(jackaDomain)
+
+	var dials int32
+	d := newDialer()
+	d.srvResolve = func(_, _, _ string) (string, []*net.SRV, error) { return "", nil, errors.New("no srv") }
+	d.dialContext = func(_ context.Context, _, _ string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return nil, errors.New("connection refused")
+	}
+	bounceCh := make(chan xmpp.Stanza, 8)
+	cfg := &outConfig{
+		localDomain:   "jackal.im",
+		remoteDomain:  "jabber.org",
+		maxStanzaSize: 8192,
+		timeout:       time.Second,
+		keepAlive:     time.Second,
+		keyGen:        &keyGen{secret: "s3cr3t"},
+		outQueue:      OutQueueConfig{Size: 2, MaxRetries: 2, Backoff: time.Millisecond * 10, MaxBackoff: time.Millisecond * 20},
+		onBounce:      func(_ context.Context, stanza xmpp.Stanza) { bounceCh <- stanza },
+	}
+	stm := newOutStream(cfg, h, d, false)
+
+	from, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	to, _ := jid.NewWithString("noelia@jabber.org", true)
+	for i := 0; i < 3; i++ {
+		msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+		msg.SetFromJID(from)
+		msg.SetToJID(to)
+		stm.SendElement(context.Background(), msg)
+	}
+	// queue overflow
+	bounced := tUtilReceiveBounce(t, bounceCh)
+	require.Equal(t, xmpp.ErrorType, bounced.Type())
+	require.Equal(t, from.String(), bounced.To())
+	require.NotNil(t, bounced.Elements().Child("error").Elements().Child("resource-constraint"))
+
+	// retries exhausted
+	for i := 0; i < 2; i++ {
+		bounced = tUtilReceiveBounce(t, bounceCh)
+		require.Equal(t, from.String(), bounced.To())
+		require.Equal(t, to.String(), bounced.From())
+		require.NotNil(t, bounced.Elements().Child("error").Elements().Child("remote-server-not-found"))
+	}
+	require.Equal(t, int32(3), atomic.LoadInt32(&dials))
+}
+
+func TestOutStream_BounceOnDialbackFailure(t *testing.T) {
+	h := setupTestHosts(jackaDomain)
+
+	bounceCh := make(chan xmpp.Stanza, 8)
+	cfg, _, conn := tUtilOutStreamDefaultConfig()
+	cfg.outQueue = OutQueueConfig{Size: 10, MaxRetries: 3, Backoff: time.Second}
+	cfg.onBounce = func(_ context.Context, stanza xmpp.Stanza) { bounceCh <- stanza }
+
+	stm := tUtilOutStreamInitWithConfig(t, h, cfg, conn)
+	tUtilOutStreamOpen(conn)
+	atomic.StoreUint32(&stm.secured, 1)
+	_, _ = conn.inboundWriteString(securedFeatures)
+	_ = conn.outboundRead()
+
+	from, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	to, _ := jid.NewWithString("jabber.org", true)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(to)
+	stm.SendElement(context.Background(), iq)
+
+	// error responses are never bounced
+	errIQ := xmpp.NewIQType(uuid.New(), xmpp.ErrorType)
+	errIQ.SetFromJID(from)
+	errIQ.SetToJID(to)
+	stm.SendElement(context.Background(), errIQ)
+
+	_, _ = conn.inboundWriteString(`
+<db:result from="jabber.org" to="jackal.im" type="failed"/>
+`)
+	require.True(t, conn.waitClose())
+
+	// authentication failures are not retried
+	bounced := tUtilReceiveBounce(t, bounceCh)
+	require.Equal(t, iq.ID(), bounced.ID())
+	require.NotNil(t, bounced.Elements().Child("error").Elements().Child("remote-server-not-found"))
+
+	select {
+	case <-bounceCh:
+		require.Fail(t, "unexpected bounced stanza")
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestOutStream_BounceOnTimeout(t *testing.T) {
+	h := setupTestHosts(jackaDomain)
+
+	bounceCh := make(chan xmpp.Stanza, 8)
+	cfg, _, conn := tUtilOutStreamDefaultConfig()
+	cfg.keepAlive = time.Millisecond * 100
+	cfg.onBounce = func(_ context.Context, stanza xmpp.Stanza) { bounceCh <- stanza }
+
+	stm := tUtilOutStreamInitWithConfig(t, h, cfg, conn)
+
+	from, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	to, _ := jid.NewWithString("jabber.org", true)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(from)
+	iq.SetToJID(to)
+	stm.SendElement(context.Background(), iq)
+
+	require.True(t, conn.waitClose())
+
+	bounced := tUtilReceiveBounce(t, bounceCh)
+	require.Equal(t, iq.ID(), bounced.ID())
+	require.NotNil(t, bounced.Elements().Child("error").Elements().Child("remote-server-timeout"))
+}
+
+func tUtilReceiveBounce(t *testing.T, bounceCh <-chan xmpp.Stanza) xmpp.Stanza {
+	select {
+	case stanza := <-bounceCh:
+		return stanza
+	case <-time.After(time.Second * 5):
+		require.Fail(t, "bounce timed out")
+		return nil
+	}
+}
+
+func TestOutStream_IdleTimeout(t *testing.T) {
+	h := setupTestHosts(jackaDomain)
+
+	discCh := make(chan *outStream, 1)
+	cfg, d, conn := tUtilOutStreamDefaultConfig()
+	cfg.timeout = time.Second
+	cfg.idleTimeout = time.Millisecond * 100
+	cfg.onDisconnect = func(s *outStream) { discCh <- s }
+
+	stm := newOutStream(cfg, h, d, true)
+	_ = stm.start(context.Background())
+	_ = conn.outboundRead() // stream:stream
+
+	tUtilOutStreamOpen(conn)
+	_, _ = conn.inboundWriteString(`<stream:features/>`)
+
+	require.True(t, conn.waitClose())
+	require.Equal(t, outDisconnected, stm.getState())
+
+	select {
+	case s := <-discCh:
+		require.Equal(t, stm, s)
+	case <-time.After(time.Second):
+		require.Fail(t, "out stream disconnection not notified")
+	}
+	info := stm.Info()
+	require.Equal(t, "disconnected", info.State)
+	require.Equal(t, 0, info.Pending)
+	require.False(t, info.LastActivity.IsZero())
+}
+
+func TestOutStream_Metrics(t *testing.T) {
+	h := setupTestHosts(jackaDomain)
+
+	cfg, d, conn := tUtilOutStreamDefaultConfig()
+	cfg.timeout = time.Second
+	cfg.path = scionPath
+
+	verified := outStreams.WithLabelValues(scionPath, "verified")
+	n := testutil.ToFloat64(verified)
+
+	stm := newOutStream(cfg, h, d, true)
+	_ = stm.start(context.Background())
+	_ = conn.outboundRead() // stream:stream
+
+	tUtilOutStreamOpen(conn)
+	_, _ = conn.inboundWriteString(`<stream:features/>`)
+
+	require.Eventually(t, func() bool { return testutil.ToFloat64(verified) == n+1 }, time.Second, time.Millisecond*10)
+
+	stm.Disconnect(context.Background(), nil)
+	require.Equal(t, n, testutil.ToFloat64(verified))
+}
+
+func TestOutStream_Bidi(t *testing.T) {
+	r, h := setupTestRouter(jackaDomain)
+
+	toJID, _ := jid.New("ortuman", "jackal.im", "garden", true)
+	stm2 := stream.NewMockC2S("abcd7890", toJID)
+	stm2.SetPresence(xmpp.NewPresence(toJID, toJID, xmpp.AvailableType))
+	r.Bind(context.Background(), stm2)
+
+	cfg, d, conn := tUtilOutStreamDefaultConfig()
+	cfg.localDomain = "jackal.im"
+	cfg.bidi = true
+	cfg.processor = &stanzaProcessor{router: r, mods: &module.Modules{}}
+
+	stm := newOutStream(cfg, h, d, true)
+	_ = stm.start(context.Background())
+	_ = conn.outboundRead() // stream:stream
+
+	tUtilOutStreamOpen(conn)
+	_, _ = conn.inboundWriteString(`<stream:features><bidi xmlns="urn:xmpp:features:bidi"/></stream:features>`)
+
+	elem := conn.outboundRead()
+	require.Equal(t, "bidi", elem.Name())
+	require.Equal(t, bidiNamespace, elem.Namespace())
+
+	require.Eventually(t, func() bool { return stm.getState() == outVerified }, time.Second, time.Millisecond*10)
+	require.True(t, stm.Info().Bidi)
+
+	// stanzas sent back by remote server are routed
+	fromJID, _ := jid.New("noelia", "jabber.org", "yard", true)
+	msgID := uuid.New()
+	msg := xmpp.NewMessageType(msgID, xmpp.ChatType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(toJID)
+	_, _ = conn.inboundWriteString(msg.String())
+
+	elem = stm2.ReceiveElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, msgID, elem.ID())
+
+	// stanzas from any other domain are never routed
+	spoofedJID, _ := jid.New("noelia", "victim.org", "yard", true)
+	msg = xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(spoofedJID)
+	msg.SetToJID(toJID)
+	_, _ = conn.inboundWriteString(msg.String())
+
+	require.True(t, conn.waitClose())
+}
+
+func TestOutStream_RequireCert(t *testing.T) {
+	h := setupTestHosts(jackaDomain)
+
+	cfg, d, conn := tUtilOutStreamDefaultConfig()
+	cfg.requireCert = true
+
+	stm := newOutStream(cfg, h, d, false)
+	atomic.StoreUint32(&stm.secured, 1)
+	_ = stm.start(context.Background())
+	_ = conn.outboundRead() // stream:stream
+
+	// only dialback offered
+	tUtilOutStreamOpen(conn)
+	_, _ = conn.inboundWriteString(`<stream:features><dialback xmlns="urn:xmpp:features:dialback"/></stream:features>`)
+
+	require.True(t, conn.waitClose())
+	require.Equal(t, outDisconnected, stm.getState())
+}
@@ -8,73 +8,188 @@ package s2s
 import (
 	"context"
 	"crypto/tls"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/router/host"
 	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
 )
 
+const flushCheckInterval = time.Millisecond * 100
+
 type newOutFunc = func(localDomain, remoteDomain string, alreadySecuredAndAuthd bool) *outStream
 
 type OutProvider struct {
-	cfg            *Config
-	hosts          *host.Hosts
-	dialer         Dialer
-	mu             sync.RWMutex
-	outConnections map[string]stream.S2SOut
+	cfg             *Config
+	hosts           *host.Hosts
+	dialer          Dialer
+	router          router.Router
+	mods            *module.Modules
+	mu              sync.RWMutex
+	outConnections  map[string]stream.S2SOut
+	bidiConnections map[string]*inStream
 }
 
 func NewOutProvider(config *Config, hosts *host.Hosts) *OutProvider {
 	return &OutProvider{
-		cfg:            config,
-		hosts:          hosts,
-		dialer:         newDialer(),
-		outConnections: make(map[string]stream.S2SOut),
+		cfg:             config,
+		hosts:           hosts,
+		dialer:          newDialer(),
+		outConnections:  make(map[string]stream.S2SOut),
+		bidiConnections: make(map[string]*inStream),
 	}
 }
 
-func (p *OutProvider) GetOut(localDomain, remoteDomain string, alreadySecuredAndAuthd bool) stream.S2SOut {
+func (p *OutProvider) GetOut(localDomain, remoteDomain string) stream.S2SOut {
 	domainPair := getDomainPair(localDomain, remoteDomain)
 	p.mu.RLock()
-	outStm := p.outConnections[domainPair]
+	stm := p.lookupOut(domainPair)
 	p.mu.RUnlock()
 
-	if outStm != nil {
-		return outStm
+	if stm != nil {
+		return stm
 	}
+	proc := p.processor()
+
 	p.mu.Lock()
-	outStm = p.outConnections[domainPair] // 2nd check
-	if outStm != nil {
-		p.mu.Unlock()
+	defer p.mu.Unlock()
+	return p.lookupOrRegisterOut(localDomain, remoteDomain, proc)
+}
+
+// SendElement sends an element through the stream associated to a domain pair, dialing a new one if needed.
+// Stream lookup and dispatch are done under the same lock used to unregister disconnected streams,
+// so that no element is handed to a stream that has already been unregistered.
+func (p *OutProvider) SendElement(ctx context.Context, localDomain, remoteDomain string, elem xmpp.XElement) {
+	domainPair := getDomainPair(localDomain, remoteDomain)
+	p.mu.RLock()
+	if stm := p.lookupOut(domainPair); stm != nil {
+		stm.SendElement(ctx, elem)
+		p.mu.RUnlock()
+		return
+	}
+	p.mu.RUnlock()
+
+	proc := p.processor()
+
+	p.mu.Lock()
+	p.lookupOrRegisterOut(localDomain, remoteDomain, proc).SendElement(ctx, elem)
+	p.mu.Unlock()
+}
+
+// lookupOut returns the stream registered for a domain pair, if any.
+// Must be called holding provider lock.
+func (p *OutProvider) lookupOut(domainPair string) stream.S2SOut {
+	if outStm := p.outConnections[domainPair]; outStm != nil {
 		return outStm
 	}
-	outStm = p.newOut(localDomain, remoteDomain, alreadySecuredAndAuthd)
+	if bidiStm := p.bidiConnections[domainPair]; bidiStm != nil {
+		return bidiStm // reuse remote server initiated stream
+	}
+	return nil
+}
+
+// lookupOrRegisterOut returns the stream registered for a domain pair, registering a new out stream if none.
+// Must be called holding provider write lock.
+func (p *OutProvider) lookupOrRegisterOut(localDomain, remoteDomain string, proc *stanzaProcessor) stream.S2SOut {
+	domainPair := getDomainPair(localDomain, remoteDomain)
+	if stm := p.lookupOut(domainPair); stm != nil {
+		return stm
+	}
+	isScionAddress, _ := scionLookup(remoteDomain)
+	outStm := p.newOutStream(localDomain, remoteDomain, isScionAddress, proc, p.unregister)
+	outStm.cfg.onReroute = func(ctx context.Context, elem xmpp.XElement) {
+		p.SendElement(ctx, localDomain, remoteDomain, elem)
+	}
 	p.outConnections[domainPair] = outStm
-	p.mu.Unlock()
 
 	log.Infof("registered s2s out stream... (domainpair: %s)", domainPair)
 
 	return outStm
 }
 
+// OutStreams returns a snapshot of every registered out stream state, sorted by domain pair.
+func (p *OutProvider) OutStreams() []OutStreamInfo {
+	p.mu.RLock()
+	ret := make([]OutStreamInfo, 0, len(p.outConnections))
+	for _, outStm := range p.outConnections {
+		if stm, ok := outStm.(*outStream); ok {
+			ret = append(ret, stm.Info())
+		}
+	}
+	for domainPair := range p.bidiConnections {
+		ret = append(ret, OutStreamInfo{DomainPair: domainPair, State: "bidi", Bidi: true})
+	}
+	p.mu.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].DomainPair < ret[j].DomainPair })
+	return ret
+}
+
+// Flush waits until every out stream pending queue has been delivered or ctx is done.
+// Elements still pending on shutdown are bounced back to their senders.
+func (p *OutProvider) Flush(ctx context.Context) error {
+	tc := time.NewTicker(flushCheckInterval)
+	defer tc.Stop()
+	for {
+		pending := 0
+		for _, info := range p.OutStreams() {
+			pending += info.Pending
+		}
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-tc.C:
+		case <-ctx.Done():
+			log.Warnf("s2s: %d element(s) still pending after flush", pending)
+			return ctx.Err()
+		}
+	}
+}
+
 func (p *OutProvider) Shutdown(ctx context.Context) error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	for _, conn := range p.outConnections {
+	conns := p.outConnections
+	p.outConnections = make(map[string]stream.S2SOut)
+	p.bidiConnections = make(map[string]*inStream) // closed along with s2s in streams
+	p.mu.Unlock()
+
+	for _, conn := range conns {
 		conn.Disconnect(ctx, nil)
 	}
-	p.outConnections = nil
-
-	log.Infof("closed %d out connection(s)", len(p.outConnections))
+	log.Infof("closed %d out connection(s)", len(conns))
 
 	return nil
 }
 
 func (p *OutProvider) newOut(localDomain, remoteDomain string, alreadySecuredAndAuthd bool) *outStream {
+	return p.newOutStream(localDomain, remoteDomain, alreadySecuredAndAuthd, p.processor(), nil)
+}
+
+func (p *OutProvider) newOutStream(localDomain, remoteDomain string, alreadySecuredAndAuthd bool, proc *stanzaProcessor, onDisconnect func(s *outStream)) *outStream {
+	path := tcpPath
+	if alreadySecuredAndAuthd {
+		// SCION paths are already secured and authenticated
+		path = scionPath
+	}
+	policy := p.cfg.Federation.Policy(remoteDomain)
+	if policy.RequireTLS || policy.RequireCert {
+		alreadySecuredAndAuthd = false
+	}
+	maxStanzaSize := p.cfg.MaxStanzaSize
+	if policy.MaxStanzaSize > 0 {
+		maxStanzaSize = policy.MaxStanzaSize
+	}
 	tlsConfig := &tls.Config{
-		ServerName:   remoteDomain,
-		Certificates: p.hosts.Certificates(),
+		ServerName: remoteDomain,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return p.hosts.GetCertificate(&tls.ClientHelloInfo{ServerName: localDomain})
+		},
 	}
 	cfg := &outConfig{
 		keyGen:        &keyGen{secret: p.cfg.DialbackSecret},
@@ -82,12 +197,89 @@ func (p *OutProvider) newOut(localDomain, remoteDomain string, alreadySecuredAnd
 		localDomain:   localDomain,
 		remoteDomain:  remoteDomain,
 		keepAlive:     p.cfg.KeepAlive,
+		idleTimeout:   p.cfg.IdleTimeout,
 		tls:           tlsConfig,
-		maxStanzaSize: p.cfg.MaxStanzaSize,
+		maxStanzaSize: maxStanzaSize,
+		requireCert:   policy.RequireCert,
+		outQueue:      p.cfg.OutQueue,
+		onBounce:      p.bounce,
+		onDisconnect:  onDisconnect,
+		bidi:          p.cfg.Bidi,
+		processor:     proc,
+		path:          path,
 	}
 	return newOutStream(cfg, p.hosts, p.dialer, alreadySecuredAndAuthd)
 }
 
+// unregister removes a disconnected out stream, so that a new one will be dialed on next use.
+func (p *OutProvider) unregister(stm *outStream) {
+	domainPair := stm.ID()
+
+	p.mu.Lock()
+	if p.outConnections[domainPair] != stm {
+		p.mu.Unlock()
+		return // already replaced
+	}
+	delete(p.outConnections, domainPair)
+	stm.setUnregistered()
+	p.mu.Unlock()
+
+	log.Infof("unregistered s2s out stream... (domainpair: %s)", domainPair)
+}
+
+// registerBidi makes a bidirectional in stream available for outgoing traffic toward its initiating server.
+func (p *OutProvider) registerBidi(stm *inStream, localDomain, remoteDomain string) {
+	domainPair := getDomainPair(localDomain, remoteDomain)
+
+	p.mu.Lock()
+	p.bidiConnections[domainPair] = stm
+	p.mu.Unlock()
+
+	log.Infof("registered s2s bidi stream... (domainpair: %s)", domainPair)
+}
+
+func (p *OutProvider) unregisterBidi(stm *inStream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for domainPair, bidiStm := range p.bidiConnections {
+		if bidiStm == stm {
+			delete(p.bidiConnections, domainPair)
+			log.Infof("unregistered s2s bidi stream... (domainpair: %s)", domainPair)
+		}
+	}
+}
+
+func (p *OutProvider) setRouter(router router.Router, mods *module.Modules) {
+	p.mu.Lock()
+	p.router = router
+	p.mods = mods
+	p.mu.Unlock()
+}
+
+func (p *OutProvider) processor() *stanzaProcessor {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.router == nil || p.mods == nil {
+		return nil
+	}
+	return &stanzaProcessor{router: p.router, mods: p.mods}
+}
+
+// bounce routes an undeliverable stanza error back to its local sender.
+func (p *OutProvider) bounce(ctx context.Context, stanza xmpp.Stanza) {
+	p.mu.RLock()
+	r := p.router
+	p.mu.RUnlock()
+
+	if r == nil {
+		return
+	}
+	if err := r.Route(ctx, stanza); err != nil {
+		log.Warnf("failed to bounce s2s stanza to %s: %v", stanza.ToJID(), err)
+	}
+}
+
 func getDomainPair(localDomain, remoteDomain string) string {
 	return localDomain + ":" + remoteDomain
 }
@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ortuman/jackal/xmpp"
 	"github.com/stretchr/testify/require"
 )
 
@@ -25,7 +26,7 @@ func TestOutProvider_GetOut(t *testing.T) {
 	op.dialer.(*dialer).dialContext = func(_ context.Context, _, _ string) (net.Conn, error) {
 		return newFakeSocketConn(), nil
 	}
-	out := op.GetOut("jackal.im", "jabber.org", false)
+	out := op.GetOut("jackal.im", "jabber.org")
 
 	require.NotNil(t, out)
 
@@ -45,7 +46,7 @@ func TestOutProvider_Shutdown(t *testing.T) {
 	op.dialer.(*dialer).dialContext = func(_ context.Context, _, _ string) (net.Conn, error) {
 		return newFakeSocketConn(), nil
 	}
-	out := op.GetOut("jackal.im", "jabber.org", false)
+	out := op.GetOut("jackal.im", "jabber.org")
 	_ = out.(*outStream).start(context.Background()) // start transport
 
 	require.NotNil(t, out)
@@ -61,3 +62,100 @@ func TestOutProvider_Shutdown(t *testing.T) {
 	require.Len(t, op.outConnections, 0)
 	op.mu.RUnlock()
 }
+
+func TestOutProvider_Unregister(t *testing.T) {
+	hosts := setupTestHosts(jackaDomain)
+
+	op := NewOutProvider(&Config{}, hosts)
+
+	op.dialer.(*dialer).srvResolve = func(service, proto, name string) (cname string, addrs []*net.SRV, err error) {
+		return "", []*net.SRV{{Target: "xmpp.jabber.org", Port: 5269}}, nil
+	}
+	op.dialer.(*dialer).dialContext = func(_ context.Context, _, _ string) (net.Conn, error) {
+		return newFakeSocketConn(), nil
+	}
+	out := op.GetOut("jackal.im", "jabber.org")
+	_ = out.(*outStream).start(context.Background()) // start transport
+
+	infos := op.OutStreams()
+	require.Len(t, infos, 1)
+	require.Equal(t, "jackal.im:jabber.org", infos[0].DomainPair)
+	require.Equal(t, "connecting", infos[0].State)
+
+	out.Disconnect(context.Background(), nil)
+
+	op.mu.RLock()
+	require.Len(t, op.outConnections, 0)
+	op.mu.RUnlock()
+
+	// a new stream is dialed on next use
+	out2 := op.GetOut("jackal.im", "jabber.org")
+	require.NotEqual(t, out, out2)
+
+	// stale stream unregistration doesn't remove its replacement
+	op.unregister(out.(*outStream))
+
+	op.mu.RLock()
+	require.Len(t, op.outConnections, 1)
+	op.mu.RUnlock()
+}
+
+func TestOutProvider_RerouteUnregistered(t *testing.T) {
+	hosts := setupTestHosts(jackaDomain)
+
+	op := NewOutProvider(&Config{}, hosts)
+
+	op.dialer.(*dialer).srvResolve = func(service, proto, name string) (cname string, addrs []*net.SRV, err error) {
+		return "", []*net.SRV{{Target: "xmpp.jabber.org", Port: 5269}}, nil
+	}
+	op.dialer.(*dialer).dialContext = func(_ context.Context, _, _ string) (net.Conn, error) {
+		return newFakeSocketConn(), nil
+	}
+	out := op.GetOut("jackal.im", "jabber.org").(*outStream)
+
+	op.unregister(out)
+	require.True(t, out.isUnregistered())
+
+	// elements dispatched before unregistration are handed over to a new stream
+	out.sendElement(context.Background(), xmpp.NewElementName("message"))
+
+	op.mu.RLock()
+	out2 := op.outConnections["jackal.im:jabber.org"]
+	op.mu.RUnlock()
+
+	require.NotNil(t, out2)
+	require.False(t, out2.(*outStream) == out)
+	require.Len(t, out.pendingSendQ, 0)
+}
+
+func TestOutProvider_Flush(t *testing.T) {
+	hosts := setupTestHosts(jackaDomain)
+
+	op := NewOutProvider(&Config{}, hosts)
+
+	op.dialer.(*dialer).srvResolve = func(service, proto, name string) (cname string, addrs []*net.SRV, err error) {
+		return "", []*net.SRV{{Target: "xmpp.jabber.org", Port: 5269}}, nil
+	}
+	op.dialer.(*dialer).dialContext = func(_ context.Context, _, _ string) (net.Conn, error) {
+		return newFakeSocketConn(), nil
+	}
+	out := op.GetOut("jackal.im", "jabber.org").(*outStream)
+
+	require.Nil(t, op.Flush(context.Background()))
+
+	out.mu.Lock()
+	out.pendingSendQ = append(out.pendingSendQ, xmpp.NewElementName("message"))
+	out.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*250)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, op.Flush(ctx))
+
+	go func() {
+		time.Sleep(time.Millisecond * 150)
+		out.mu.Lock()
+		out.pendingSendQ = nil
+		out.mu.Unlock()
+	}()
+	require.Nil(t, op.Flush(context.Background()))
+}
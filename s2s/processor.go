@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+// stanzaProcessor processes stanzas received from a remote server, regardless of
+// whether they arrived through an in stream or a bidirectional out stream.
+type stanzaProcessor struct {
+	router router.Router
+	mods   *module.Modules
+}
+
+func (p *stanzaProcessor) process(ctx context.Context, stanza xmpp.Stanza, reply func(ctx context.Context, elem xmpp.XElement)) {
+	switch stanza := stanza.(type) {
+	case *xmpp.Presence:
+		p.processPresence(ctx, stanza)
+	case *xmpp.IQ:
+		p.processIQ(ctx, stanza, reply)
+	case *xmpp.Message:
+		p.processMessage(ctx, stanza)
+	}
+}
+
+func (p *stanzaProcessor) processPresence(ctx context.Context, presence *xmpp.Presence) {
+	// process roster presence
+	if presence.ToJID().IsBare() {
+		if r := p.mods.Roster; r != nil {
+			r.ProcessPresence(ctx, presence)
+			return
+		}
+	}
+	_ = p.router.Route(ctx, presence)
+}
+
+func (p *stanzaProcessor) processIQ(ctx context.Context, iq *xmpp.IQ, reply func(ctx context.Context, elem xmpp.XElement)) {
+	toJID := iq.ToJID()
+
+	replyOnBehalf := !toJID.IsFullWithUser() && p.router.Hosts().IsLocalHost(toJID.Domain())
+	if !replyOnBehalf {
+		switch p.router.Route(ctx, iq) {
+		case router.ErrResourceNotFound:
+			reply(ctx, iq.ServiceUnavailableError())
+		case router.ErrFailedRemoteConnect:
+			reply(ctx, iq.RemoteServerNotFoundError())
+		case router.ErrBlockedJID:
+			// Destination user is a blocked JID
+			if iq.IsGet() || iq.IsSet() {
+				reply(ctx, iq.ServiceUnavailableError())
+			}
+		}
+		return
+	}
+	p.mods.ProcessIQ(ctx, iq)
+}
+
+func (p *stanzaProcessor) processMessage(ctx context.Context, message *xmpp.Message) {
+	msg := message
+
+sendMessage:
+	err := p.router.Route(ctx, msg)
+	switch err {
+	case nil:
+		break
+	case router.ErrResourceNotFound:
+		// treat the stanza as if it were addressed to <node@domain>
+		msg, _ = xmpp.NewMessageFromElement(msg, msg.FromJID(), msg.ToJID().ToBareJID())
+		goto sendMessage
+	case router.ErrNotAuthenticated:
+		if off := p.mods.Offline; off != nil {
+			off.ArchiveMessage(ctx, message)
+			return
+		}
+	default:
+		// silently ignore it...
+		break
+	}
+}
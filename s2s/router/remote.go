@@ -7,22 +7,20 @@ package s2srouter
 
 import (
 	"context"
-	"sync"
 
-	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
 )
 
+// OutProvider sends elements through the out stream associated to a domain pair.
+// Used stream may be a new one in case the previous one was disconnected.
 type OutProvider interface {
-	GetOut(localDomain, remoteDomain string) stream.S2SOut
+	SendElement(ctx context.Context, localDomain, remoteDomain string, elem xmpp.XElement)
 }
 
 type remoteRouter struct {
-	mu           sync.RWMutex
 	localDomain  string
 	remoteDomain string
 	outProvider  OutProvider
-	outStm       stream.S2SOut
 }
 
 func newRemoteRouter(localDomain, remoteDomain string, outProvider OutProvider) *remoteRouter {
@@ -34,16 +32,6 @@ func newRemoteRouter(localDomain, remoteDomain string, outProvider OutProvider)
 }
 
 func (r *remoteRouter) route(ctx context.Context, stanza xmpp.Stanza) {
-	r.mu.RLock()
-	ready := r.outStm != nil
-	r.mu.RUnlock()
-
-	if !ready {
-		r.mu.Lock()
-		if r.outStm == nil {
-			r.outStm = r.outProvider.GetOut(r.localDomain, r.remoteDomain)
-		}
-		r.mu.Unlock()
-	}
-	r.outStm.SendElement(ctx, stanza)
+	// never cache out stream, as it's unregistered from provider once disconnected
+	r.outProvider.SendElement(ctx, r.localDomain, r.remoteDomain, stanza)
 }
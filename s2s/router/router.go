@@ -13,21 +13,31 @@ import (
 	"github.com/ortuman/jackal/xmpp"
 )
 
+// FederationPolicy decides whether or not stanzas can be routed to a remote domain.
+type FederationPolicy interface {
+	IsAllowed(remoteDomain string) bool
+}
+
 type s2sRouter struct {
 	mu          sync.RWMutex
 	outProvider OutProvider
+	policy      FederationPolicy
 	remotes     map[string]*remoteRouter
 }
 
-func New(outProvider OutProvider) router.S2SRouter {
+func New(outProvider OutProvider, policy FederationPolicy) router.S2SRouter {
 	return &s2sRouter{
 		outProvider: outProvider,
+		policy:      policy,
 		remotes:     make(map[string]*remoteRouter),
 	}
 }
 
 func (r *s2sRouter) Route(ctx context.Context, stanza xmpp.Stanza, localDomain string) error {
 	remoteDomain := stanza.ToJID().Domain()
+	if r.policy != nil && !r.policy.IsAllowed(remoteDomain) {
+		return router.ErrFailedRemoteConnect
+	}
 
 	r.mu.RLock()
 	rr := r.remotes[remoteDomain]
@@ -10,7 +10,7 @@ import (
 	"sync/atomic"
 	"testing"
 
-	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/stretchr/testify/require"
@@ -30,13 +30,15 @@ type mockedOutProvider struct {
 	outStm *mockedOutS2S
 }
 
-func (p *mockedOutProvider) GetOut(_, _ string) stream.S2SOut { return p.outStm }
+func (p *mockedOutProvider) SendElement(ctx context.Context, _, _ string, elem xmpp.XElement) {
+	p.outStm.SendElement(ctx, elem)
+}
 
 func TestS2SRouter_Route(t *testing.T) {
 	outStm := &mockedOutS2S{}
 	p := &mockedOutProvider{outStm: outStm}
 
-	r := New(p)
+	r := New(p, nil)
 
 	j1, _ := jid.NewWithString("ortuman@jackal.im", true)
 	j2, _ := jid.NewWithString("noelia@jabber.org/yard", true)
@@ -47,3 +49,26 @@ func TestS2SRouter_Route(t *testing.T) {
 
 	require.Equal(t, int32(2), atomic.LoadInt32(&outStm.sentTimes))
 }
+
+type deniedPolicy struct{ domain string }
+
+func (p *deniedPolicy) IsAllowed(remoteDomain string) bool { return remoteDomain != p.domain }
+
+func TestS2SRouter_RouteDenied(t *testing.T) {
+	outStm := &mockedOutS2S{}
+	p := &mockedOutProvider{outStm: outStm}
+
+	r := New(p, &deniedPolicy{domain: "jabber.org"})
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im", true)
+	j2, _ := jid.NewWithString("noelia@jabber.org/yard", true)
+	j3, _ := jid.NewWithString("noelia@jabber.net/yard", true)
+
+	err := r.Route(context.Background(), xmpp.NewPresence(j1, j2, xmpp.AvailableType), "jackal.im")
+	require.Equal(t, router.ErrFailedRemoteConnect, err)
+
+	err = r.Route(context.Background(), xmpp.NewPresence(j1, j3, xmpp.AvailableType), "jackal.im")
+	require.Nil(t, err)
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&outStm.sentTimes))
+}
@@ -24,14 +24,15 @@ const (
 type s2sServer interface {
 	start()
 	// startScion()
+	stopListening() error
 	shutdown(ctx context.Context) error
 }
 
-var createS2SServer = func(config *Config, mods *module.Modules, newOutFn newOutFunc, router router.Router) s2sServer {
+var createS2SServer = func(config *Config, mods *module.Modules, outProvider *OutProvider, router router.Router) s2sServer {
 	s := newServer(
 		config,
 		mods,
-		newOutFn,
+		outProvider,
 		router,
 	)
 	if config.Scion != nil {
@@ -50,8 +51,10 @@ type S2S struct {
 }
 
 // New returns a new instance of an s2s connection manager.
+// Undeliverable outgoing stanzas will be bounced back to its senders through router.
 func New(config *Config, mods *module.Modules, outProvider *OutProvider, router router.Router) *S2S {
-	return &S2S{srv: createS2SServer(config, mods, outProvider.newOut, router)}
+	outProvider.setRouter(router, mods)
+	return &S2S{srv: createS2SServer(config, mods, outProvider, router)}
 }
 
 // Start initializes s2s manager.
@@ -61,6 +64,14 @@ func (s *S2S) Start() {
 	}
 }
 
+// Drain stops accepting new incoming connections, keeping the established ones open.
+func (s *S2S) Drain() error {
+	if atomic.LoadUint32(&s.started) == 0 {
+		return nil
+	}
+	return s.srv.stopListening()
+}
+
 // Shutdown gracefully shuts down s2s manager.
 func (s *S2S) Shutdown(ctx context.Context) {
 	if atomic.CompareAndSwapUint32(&s.started, 1, 0) {
@@ -193,7 +193,7 @@ func (a fakeAddr) String() string  { return "str" }
 
 func setupTestRouter(domain string) (router.Router, *host.Hosts) {
 	hosts := setupTestHosts(domain)
-	r, _ := router.New(hosts, c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList()), nil)
+	r, _ := router.New(hosts, c2srouter.New(memorystorage.NewUser(), memorystorage.NewBlockList(), nil), nil)
 	return r, hosts
 }
 
@@ -205,6 +205,7 @@ func setupTestHosts(domain string) *host.Hosts {
 type fakeS2SServer struct {
 	startCh    chan struct{}
 	shutdownCh chan struct{}
+	stopped    uint32
 }
 
 func newFakeS2SServer() *fakeS2SServer {
@@ -218,6 +219,11 @@ func (s *fakeS2SServer) start() {
 	s.startCh <- struct{}{}
 }
 
+func (s *fakeS2SServer) stopListening() error {
+	atomic.StoreUint32(&s.stopped, 1)
+	return nil
+}
+
 func (s *fakeS2SServer) shutdown(_ context.Context) error {
 	s.shutdownCh <- struct{}{}
 	return nil
@@ -243,9 +249,26 @@ func TestS2S_StartAndShutdown(t *testing.T) {
 	}
 }
 
+func TestS2S_Drain(t *testing.T) {
+	s2s, fakeSrv := setupTestS2S()
+
+	// not started
+	require.Nil(t, s2s.Drain())
+	require.Equal(t, uint32(0), atomic.LoadUint32(&fakeSrv.stopped))
+
+	s2s.Start()
+	<-fakeSrv.startCh
+
+	require.Nil(t, s2s.Drain())
+	require.Equal(t, uint32(1), atomic.LoadUint32(&fakeSrv.stopped))
+
+	s2s.Shutdown(context.Background())
+	<-fakeSrv.shutdownCh
+}
+
 func setupTestS2S() (*S2S, *fakeS2SServer) {
 	srv := newFakeS2SServer()
-	createS2SServer = func(_ *Config, _ *module.Modules, _ newOutFunc, _ router.Router) s2sServer {
+	createS2SServer = func(_ *Config, _ *module.Modules, _ *OutProvider, _ router.Router) s2sServer {
 		return srv
 	}
 	r, _ := router.New(nil, nil, nil)
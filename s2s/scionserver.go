@@ -84,11 +84,14 @@ func (s *scionServer) startInStream(tr transport.Transport) {
 			keepAlive:      s.cfg.KeepAlive,
 			timeout:        s.cfg.Timeout,
 			maxStanzaSize:  s.cfg.MaxStanzaSize,
+			rateLimit:      s.cfg.RateLimit,
 			onDisconnect:   s.unregisterInStream,
+			onBidi:         s.bidiHandler(),
+			federation:     &s.cfg.Federation,
 		},
 		tr,
 		s.mods,
-		s.newOutFn,
+		s.outProvider.newOut,
 		s.router,
 		true,
 	)
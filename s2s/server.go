@@ -18,6 +18,7 @@ import (
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/util/proxyproto"
 )
 
 var listenerProvider = net.Listen
@@ -27,18 +28,18 @@ type server struct {
 	cfg           *Config
 	router        router.Router
 	mods          *module.Modules
-	newOutFn      newOutFunc
+	outProvider   *OutProvider
 	inConnections map[string]stream.S2SIn
 	ln            net.Listener
 	listening     uint32
 }
 
-func newServer(config *Config, mods *module.Modules, newOutFn newOutFunc, router router.Router) *server {
+func newServer(config *Config, mods *module.Modules, outProvider *OutProvider, router router.Router) *server {
 	return &server{
 		cfg:           config,
 		router:        router,
 		mods:          mods,
-		newOutFn:      newOutFn,
+		outProvider:   outProvider,
 		inConnections: make(map[string]stream.S2SIn),
 	}
 }
@@ -56,17 +57,22 @@ func (s *server) start() {
 }
 
 func (s *server) shutdown(ctx context.Context) error {
+	// stop listening...
+	if err := s.stopListening(); err != nil {
+		return err
+	}
+	// close all connections...
+	c, err := s.closeConnections(ctx)
+	if err != nil {
+		return err
+	}
+	log.Infof("%s: closed %d in connection(s)", s.cfg.ID, c)
+	return nil
+}
+
+func (s *server) stopListening() error {
 	if atomic.CompareAndSwapUint32(&s.listening, 1, 0) {
-		// stop listening...
-		if err := s.ln.Close(); err != nil {
-			return err
-		}
-		// close all connections...
-		c, err := s.closeConnections(ctx)
-		if err != nil {
-			return err
-		}
-		log.Infof("%s: closed %d in connection(s)", s.cfg.ID, c)
+		return s.ln.Close()
 	}
 	return nil
 }
@@ -82,13 +88,23 @@ func (s *server) listenConn(address string) error {
 	for atomic.LoadUint32(&s.listening) == 1 {
 		conn, err := ln.Accept()
 		if err == nil {
-			go s.startInStream(transport.NewSocketTransport(conn))
+			go s.acceptConn(conn)
 			continue
 		}
 	}
 	return nil
 }
 
+func (s *server) acceptConn(conn net.Conn) {
+	pConn, err := proxyproto.Accept(conn, s.cfg.Transport.ProxyProtocol)
+	if err != nil {
+		log.Warnf("s2s_in: failed to read proxy protocol header from %s: %v", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	s.startInStream(transport.NewSocketTransport(pConn))
+}
+
 // TODO this file need amendments to support SCION
 
 func (s *server) startInStream(tr transport.Transport) {
@@ -99,11 +115,14 @@ func (s *server) startInStream(tr transport.Transport) {
 			keepAlive:      s.cfg.KeepAlive,
 			timeout:        s.cfg.Timeout,
 			maxStanzaSize:  s.cfg.MaxStanzaSize,
+			rateLimit:      s.cfg.RateLimit,
 			onDisconnect:   s.unregisterInStream,
+			onBidi:         s.bidiHandler(),
+			federation:     &s.cfg.Federation,
 		},
 		tr,
 		s.mods,
-		s.newOutFn,
+		s.outProvider.newOut,
 		s.router,
 		false,
 	)
@@ -123,9 +142,21 @@ func (s *server) unregisterInStream(stm stream.S2SIn) {
 	delete(s.inConnections, stm.ID())
 	s.mu.Unlock()
 
+	if inStm, ok := stm.(*inStream); ok && s.outProvider != nil {
+		s.outProvider.unregisterBidi(inStm)
+	}
+
 	log.Infof("unregistered s2s in stream... (id: %s)", stm.ID())
 }
 
+// bidiHandler returns the function used to register bidirectional in streams, or nil if XEP-0288 is disabled.
+func (s *server) bidiHandler() func(s *inStream, localDomain, remoteDomain string) {
+	if !s.cfg.Bidi || s.outProvider == nil {
+		return nil
+	}
+	return s.outProvider.registerBidi
+}
+
 func (s *server) closeConnections(ctx context.Context) (count int, err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -18,6 +18,7 @@ import (
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/router/host"
 	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/util/ratelimit"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/pborman/uuid"
@@ -391,7 +392,7 @@ func (s *Session) mapErrorToSessionError(err error) *Error {
 	case xmpp.ErrStreamClosedByPeer:
 		_ = s.Close(context.Background())
 
-	case xmpp.ErrTooLargeStanza:
+	case xmpp.ErrTooLargeStanza, ratelimit.ErrLimitExceeded:
 		return &Error{UnderlyingErr: streamerror.ErrPolicyViolation}
 
 	default:
@@ -13,6 +13,7 @@ import (
 	stdxml "encoding/xml"
 	"errors"
 	"io"
+	"net"
 	"testing"
 	"time"
 
@@ -47,6 +48,7 @@ func (t *fakeTransport) StartTLS(_ *tls.Config, _ bool)
 func (t *fakeTransport) EnableCompression(compress.Level)                             {}
 func (t *fakeTransport) ChannelBindingBytes(transport.ChannelBindingMechanism) []byte { return nil }
 func (t *fakeTransport) PeerCertificates() []*x509.Certificate                        { return nil }
+func (t *fakeTransport) RemoteAddr() net.Addr                                         { return nil }
 
 func TestSession_Open(t *testing.T) {
 	hosts := setupTest("jackal.im")
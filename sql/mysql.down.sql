@@ -12,6 +12,10 @@ DROP TABLE IF EXISTS offline_messages;
 DROP TABLE IF EXISTS vcards;
 DROP TABLE IF EXISTS private_storage;
 DROP TABLE IF EXISTS blocklist_items;
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS shared_groups;
+DROP TABLE IF EXISTS roster_permissions;
+DROP TABLE IF EXISTS roster_changes;
 DROP TABLE IF EXISTS roster_versions;
 DROP TABLE IF EXISTS roster_groups;
 DROP TABLE IF EXISTS roster_items;
@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+-- Migrates user related entities created by previous versions, keyed by username,
+-- to bare JID keys. Set @domain to the virtual host existing accounts belong to.
+
+SET @domain = 'localhost';
+
+START TRANSACTION;
+
+UPDATE users SET username = CONCAT(username, '@', @domain) WHERE username NOT LIKE '%@%';
+UPDATE roster_notifications SET contact = CONCAT(contact, '@', @domain) WHERE contact NOT LIKE '%@%';
+UPDATE roster_items SET username = CONCAT(username, '@', @domain) WHERE username NOT LIKE '%@%';
+UPDATE roster_groups SET username = CONCAT(username, '@', @domain) WHERE username NOT LIKE '%@%';
+UPDATE roster_versions SET username = CONCAT(username, '@', @domain) WHERE username NOT LIKE '%@%';
+UPDATE blocklist_items SET username = CONCAT(username, '@', @domain) WHERE username NOT LIKE '%@%';
+UPDATE private_storage SET username = CONCAT(username, '@', @domain) WHERE username NOT LIKE '%@%';
+UPDATE vcards SET username = CONCAT(username, '@', @domain) WHERE username NOT LIKE '%@%';
+UPDATE offline_messages SET username = CONCAT(username, '@', @domain) WHERE username NOT LIKE '%@%';
+
+-- PEP nodes are owned by user accounts, so their hosts, affiliations, subscriptions
+-- and publishers are keyed by bare JID as well.
+UPDATE pubsub_nodes SET host = CONCAT(host, '@', @domain) WHERE host NOT LIKE '%@%' AND host <> @domain;
+UPDATE pubsub_affiliations SET jid = CONCAT(jid, '@', @domain) WHERE jid NOT LIKE '%@%' AND jid <> @domain;
+UPDATE pubsub_subscriptions SET jid = CONCAT(jid, '@', @domain) WHERE jid NOT LIKE '%@%' AND jid <> @domain;
+UPDATE pubsub_items SET publisher = CONCAT(publisher, '@', @domain) WHERE publisher NOT LIKE '%@%' AND publisher <> @domain;
+
+-- presences are transient and get republished once clients reconnect.
+DELETE FROM presences;
+
+COMMIT;
@@ -3,15 +3,21 @@
  * See the LICENSE file for more information.
  */
 
+-- User related entities (users, rosters, block lists, private storage, vCards and offline messages)
+-- are keyed by their owner bare JID (user@domain), so that each virtual host has its own user namespace.
+
 -- users
 
 CREATE TABLE IF NOT EXISTS users (
     username         VARCHAR(256) PRIMARY KEY,
+    domain           VARCHAR(256) NOT NULL DEFAULT '',
     password         TEXT NOT NULL,
     last_presence    TEXT NOT NULL,
     last_presence_at DATETIME NOT NULL,
     updated_at       DATETIME NOT NULL,
-    created_at       DATETIME NOT NULL
+    created_at       DATETIME NOT NULL,
+
+    INDEX i_users_domain(domain)
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
 
 -- presences
@@ -72,6 +78,7 @@ CREATE TABLE IF NOT EXISTS roster_items (
     subscription TEXT NOT NULL,
     `groups`     TEXT NOT NULL,
     ask          BOOL NOT NULL,
+    approved     BOOL NOT NULL DEFAULT FALSE,
     ver          INT NOT NULL DEFAULT 0,
     updated_at   DATETIME NOT NULL,
     created_at   DATETIME NOT NULL,
@@ -107,6 +114,53 @@ CREATE TABLE IF NOT EXISTS roster_versions (
     PRIMARY KEY (username)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- roster_changes
+
+CREATE TABLE IF NOT EXISTS roster_changes (
+    username     VARCHAR(256) NOT NULL,
+    jid          VARCHAR(512) NOT NULL,
+    ver          INT NOT NULL,
+    updated_at   DATETIME NOT NULL,
+    created_at   DATETIME NOT NULL,
+
+    PRIMARY KEY (username, jid),
+
+    INDEX i_roster_changes_username_ver (username, ver)
+
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+-- roster_permissions
+
+CREATE TABLE IF NOT EXISTS roster_permissions (
+    username     VARCHAR(256) NOT NULL,
+    jid          VARCHAR(512) NOT NULL,
+    updated_at   DATETIME NOT NULL,
+    created_at   DATETIME NOT NULL,
+
+    PRIMARY KEY (username, jid)
+
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+-- shared_groups
+
+CREATE TABLE IF NOT EXISTS shared_groups (
+    name        VARCHAR(256) PRIMARY KEY,
+    description TEXT NOT NULL,
+    hosts       TEXT NOT NULL,
+    members     MEDIUMTEXT NOT NULL,
+    updated_at  DATETIME NOT NULL,
+    created_at  DATETIME NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+-- invitations
+
+CREATE TABLE IF NOT EXISTS invitations (
+    token      VARCHAR(64) PRIMARY KEY,
+    username   VARCHAR(256) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
 -- blocklist_items
 
 CREATE TABLE IF NOT EXISTS blocklist_items (
@@ -0,0 +1,32 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage/repository"
+)
+
+type measuredBlockListRep struct {
+	rep repository.BlockList
+}
+
+func (m *measuredBlockListRep) InsertBlockListItem(ctx context.Context, item *model.BlockListItem) error {
+	defer newTimer("block_list", "InsertBlockListItem").ObserveDuration()
+	return m.rep.InsertBlockListItem(ctx, item)
+}
+
+func (m *measuredBlockListRep) DeleteBlockListItem(ctx context.Context, item *model.BlockListItem) error {
+	defer newTimer("block_list", "DeleteBlockListItem").ObserveDuration()
+	return m.rep.DeleteBlockListItem(ctx, item)
+}
+
+func (m *measuredBlockListRep) FetchBlockListItems(ctx context.Context, userJID string) ([]model.BlockListItem, error) {
+	defer newTimer("block_list", "FetchBlockListItems").ObserveDuration()
+	return m.rep.FetchBlockListItems(ctx, userJID)
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage/repository"
+)
+
+type measuredInvitationsRep struct {
+	rep repository.Invitations
+}
+
+func (m *measuredInvitationsRep) InsertInvitation(ctx context.Context, inv *model.Invitation) error {
+	defer newTimer("invitations", "InsertInvitation").ObserveDuration()
+	return m.rep.InsertInvitation(ctx, inv)
+}
+
+func (m *measuredInvitationsRep) DeleteInvitation(ctx context.Context, token string) (bool, error) {
+	defer newTimer("invitations", "DeleteInvitation").ObserveDuration()
+	return m.rep.DeleteInvitation(ctx, token)
+}
+
+func (m *measuredInvitationsRep) FetchInvitation(ctx context.Context, token string) (*model.Invitation, error) {
+	defer newTimer("invitations", "FetchInvitation").ObserveDuration()
+	return m.rep.FetchInvitation(ctx, token)
+}
+
+func (m *measuredInvitationsRep) FetchInvitations(ctx context.Context) ([]model.Invitation, error) {
+	defer newTimer("invitations", "FetchInvitations").ObserveDuration()
+	return m.rep.FetchInvitations(ctx)
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var opDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "jackal",
+	Subsystem: "storage",
+	Name:      "operation_duration_seconds",
+	Help:      "Storage operation latency by repository and method.",
+	Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+}, []string{"repository", "method"})
+
+func init() {
+	prometheus.MustRegister(opDuration)
+}
+
+func newTimer(repository, method string) *prometheus.Timer {
+	return prometheus.NewTimer(opDuration.WithLabelValues(repository, method))
+}
+
+type measuredContainer struct {
+	rep       repository.Container
+	user      *measuredUserRep
+	roster    *measuredRosterRep
+	presences *measuredPresencesRep
+	vCard     *measuredVCardRep
+	priv      *measuredPrivateRep
+	blockList *measuredBlockListRep
+	pubSub    *measuredPubSubRep
+	offline   *measuredOfflineRep
+	shGroups  *measuredSharedGroupsRep
+	invs      *measuredInvitationsRep
+}
+
+// New wraps a repository container, recording every storage operation latency.
+func New(rep repository.Container) repository.Container {
+	return &measuredContainer{
+		rep:       rep,
+		user:      &measuredUserRep{rep: rep.User()},
+		roster:    &measuredRosterRep{rep: rep.Roster()},
+		presences: &measuredPresencesRep{rep: rep.Presences()},
+		vCard:     &measuredVCardRep{rep: rep.VCard()},
+		priv:      &measuredPrivateRep{rep: rep.Private()},
+		blockList: &measuredBlockListRep{rep: rep.BlockList()},
+		pubSub:    &measuredPubSubRep{rep: rep.PubSub()},
+		offline:   &measuredOfflineRep{rep: rep.Offline()},
+		shGroups:  &measuredSharedGroupsRep{rep: rep.SharedGroups()},
+		invs:      &measuredInvitationsRep{rep: rep.Invitations()},
+	}
+}
+
+func (c *measuredContainer) User() repository.User                 { return c.user }
+func (c *measuredContainer) Roster() repository.Roster             { return c.roster }
+func (c *measuredContainer) Presences() repository.Presences       { return c.presences }
+func (c *measuredContainer) VCard() repository.VCard               { return c.vCard }
+func (c *measuredContainer) Private() repository.Private           { return c.priv }
+func (c *measuredContainer) BlockList() repository.BlockList       { return c.blockList }
+func (c *measuredContainer) PubSub() repository.PubSub             { return c.pubSub }
+func (c *measuredContainer) Offline() repository.Offline           { return c.offline }
+func (c *measuredContainer) SharedGroups() repository.SharedGroups { return c.shGroups }
+func (c *measuredContainer) Invitations() repository.Invitations   { return c.invs }
+
+func (c *measuredContainer) DeleteAccount(ctx context.Context, userJID *jid.JID) error {
+	defer newTimer("container", "DeleteAccount").ObserveDuration()
+	return c.rep.DeleteAccount(ctx, userJID)
+}
+
+func (c *measuredContainer) Close(ctx context.Context) error {
+	return c.rep.Close(ctx)
+}
+
+func (c *measuredContainer) IsClusterCompatible() bool {
+	return c.rep.IsClusterCompatible()
+}
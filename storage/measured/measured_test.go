@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	memorystorage "github.com/ortuman/jackal/storage/memory"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasured_Container(t *testing.T) {
+	memRep, _ := memorystorage.New()
+	rep := New(memRep)
+
+	require.Equal(t, memRep.IsClusterCompatible(), rep.IsClusterCompatible())
+
+	count := sampleCount(t, "user", "UpsertUser")
+
+	ctx := context.Background()
+	require.Nil(t, rep.User().UpsertUser(ctx, &model.User{Username: "ortuman", Domain: "jackal.im", Password: "1234"}))
+
+	usr, err := rep.User().FetchUser(ctx, "ortuman@jackal.im")
+	require.Nil(t, err)
+	require.NotNil(t, usr)
+	require.Equal(t, count+1, sampleCount(t, "user", "UpsertUser"))
+
+	// errors are measured as well
+	memorystorage.EnableMockedError()
+	_, err = rep.Offline().CountOfflineMessages(ctx, "ortuman@jackal.im")
+	memorystorage.DisableMockedError()
+	require.Equal(t, memorystorage.ErrMocked, err)
+	require.True(t, sampleCount(t, "offline", "CountOfflineMessages") > 0)
+}
+
+func sampleCount(t *testing.T, repository, method string) uint64 {
+	m := &dto.Metric{}
+	require.Nil(t, opDuration.WithLabelValues(repository, method).(prometheus.Histogram).Write(m))
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+type measuredOfflineRep struct {
+	rep repository.Offline
+}
+
+func (m *measuredOfflineRep) InsertOfflineMessage(ctx context.Context, message *xmpp.Message, userJID string) error {
+	defer newTimer("offline", "InsertOfflineMessage").ObserveDuration()
+	return m.rep.InsertOfflineMessage(ctx, message, userJID)
+}
+
+func (m *measuredOfflineRep) CountOfflineMessages(ctx context.Context, userJID string) (int, error) {
+	defer newTimer("offline", "CountOfflineMessages").ObserveDuration()
+	return m.rep.CountOfflineMessages(ctx, userJID)
+}
+
+func (m *measuredOfflineRep) FetchOfflineMessages(ctx context.Context, userJID string) ([]xmpp.Message, error) {
+	defer newTimer("offline", "FetchOfflineMessages").ObserveDuration()
+	return m.rep.FetchOfflineMessages(ctx, userJID)
+}
+
+func (m *measuredOfflineRep) DeleteOfflineMessages(ctx context.Context, userJID string) error {
+	defer newTimer("offline", "DeleteOfflineMessages").ObserveDuration()
+	return m.rep.DeleteOfflineMessages(ctx, userJID)
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+
+	capsmodel "github.com/ortuman/jackal/model/capabilities"
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+type measuredPresencesRep struct {
+	rep repository.Presences
+}
+
+func (m *measuredPresencesRep) UpsertPresence(ctx context.Context, presence *xmpp.Presence, jid *jid.JID, allocationID string) (inserted bool, err error) {
+	defer newTimer("presences", "UpsertPresence").ObserveDuration()
+	return m.rep.UpsertPresence(ctx, presence, jid, allocationID)
+}
+
+func (m *measuredPresencesRep) FetchPresence(ctx context.Context, jid *jid.JID) (*capsmodel.PresenceCaps, error) {
+	defer newTimer("presences", "FetchPresence").ObserveDuration()
+	return m.rep.FetchPresence(ctx, jid)
+}
+
+func (m *measuredPresencesRep) FetchPresencesMatchingJID(ctx context.Context, jid *jid.JID) ([]capsmodel.PresenceCaps, error) {
+	defer newTimer("presences", "FetchPresencesMatchingJID").ObserveDuration()
+	return m.rep.FetchPresencesMatchingJID(ctx, jid)
+}
+
+func (m *measuredPresencesRep) DeletePresence(ctx context.Context, jid *jid.JID) error {
+	defer newTimer("presences", "DeletePresence").ObserveDuration()
+	return m.rep.DeletePresence(ctx, jid)
+}
+
+func (m *measuredPresencesRep) DeleteAllocationPresences(ctx context.Context, allocationID string) error {
+	defer newTimer("presences", "DeleteAllocationPresences").ObserveDuration()
+	return m.rep.DeleteAllocationPresences(ctx, allocationID)
+}
+
+func (m *measuredPresencesRep) ClearPresences(ctx context.Context) error {
+	defer newTimer("presences", "ClearPresences").ObserveDuration()
+	return m.rep.ClearPresences(ctx)
+}
+
+func (m *measuredPresencesRep) UpsertCapabilities(ctx context.Context, caps *capsmodel.Capabilities) error {
+	defer newTimer("presences", "UpsertCapabilities").ObserveDuration()
+	return m.rep.UpsertCapabilities(ctx, caps)
+}
+
+func (m *measuredPresencesRep) FetchCapabilities(ctx context.Context, node, ver string) (*capsmodel.Capabilities, error) {
+	defer newTimer("presences", "FetchCapabilities").ObserveDuration()
+	return m.rep.FetchCapabilities(ctx, node, ver)
+}
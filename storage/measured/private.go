@@ -0,0 +1,27 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+type measuredPrivateRep struct {
+	rep repository.Private
+}
+
+func (m *measuredPrivateRep) FetchPrivateXML(ctx context.Context, namespace string, userJID string) ([]xmpp.XElement, error) {
+	defer newTimer("private", "FetchPrivateXML").ObserveDuration()
+	return m.rep.FetchPrivateXML(ctx, namespace, userJID)
+}
+
+func (m *measuredPrivateRep) UpsertPrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, userJID string) error {
+	defer newTimer("private", "UpsertPrivateXML").ObserveDuration()
+	return m.rep.UpsertPrivateXML(ctx, privateXML, namespace, userJID)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+	"time"
+
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
+	"github.com/ortuman/jackal/storage/repository"
+)
+
+type measuredPubSubRep struct {
+	rep repository.PubSub
+}
+
+func (m *measuredPubSubRep) FetchHosts(ctx context.Context) (hosts []string, err error) {
+	defer newTimer("pubsub", "FetchHosts").ObserveDuration()
+	return m.rep.FetchHosts(ctx)
+}
+
+func (m *measuredPubSubRep) UpsertNode(ctx context.Context, node *pubsubmodel.Node) error {
+	defer newTimer("pubsub", "UpsertNode").ObserveDuration()
+	return m.rep.UpsertNode(ctx, node)
+}
+
+func (m *measuredPubSubRep) FetchNode(ctx context.Context, host, name string) (*pubsubmodel.Node, error) {
+	defer newTimer("pubsub", "FetchNode").ObserveDuration()
+	return m.rep.FetchNode(ctx, host, name)
+}
+
+func (m *measuredPubSubRep) FetchNodes(ctx context.Context, host string) ([]pubsubmodel.Node, error) {
+	defer newTimer("pubsub", "FetchNodes").ObserveDuration()
+	return m.rep.FetchNodes(ctx, host)
+}
+
+func (m *measuredPubSubRep) FetchSubscribedNodes(ctx context.Context, jid string) ([]pubsubmodel.Node, error) {
+	defer newTimer("pubsub", "FetchSubscribedNodes").ObserveDuration()
+	return m.rep.FetchSubscribedNodes(ctx, jid)
+}
+
+func (m *measuredPubSubRep) DeleteNode(ctx context.Context, host, name string) error {
+	defer newTimer("pubsub", "DeleteNode").ObserveDuration()
+	return m.rep.DeleteNode(ctx, host, name)
+}
+
+func (m *measuredPubSubRep) UpsertNodeItem(ctx context.Context, item *pubsubmodel.Item, host, name string, maxNodeItems int) error {
+	defer newTimer("pubsub", "UpsertNodeItem").ObserveDuration()
+	return m.rep.UpsertNodeItem(ctx, item, host, name, maxNodeItems)
+}
+
+func (m *measuredPubSubRep) FetchNodeItems(ctx context.Context, host, name string) ([]pubsubmodel.Item, error) {
+	defer newTimer("pubsub", "FetchNodeItems").ObserveDuration()
+	return m.rep.FetchNodeItems(ctx, host, name)
+}
+
+func (m *measuredPubSubRep) FetchNodeItemsPage(ctx context.Context, host, name string, req *rsmmodel.Request) ([]pubsubmodel.Item, *rsmmodel.Result, error) {
+	defer newTimer("pubsub", "FetchNodeItemsPage").ObserveDuration()
+	return m.rep.FetchNodeItemsPage(ctx, host, name, req)
+}
+
+func (m *measuredPubSubRep) FetchNodeItemsWithIDs(ctx context.Context, host, name string, identifiers []string) ([]pubsubmodel.Item, error) {
+	defer newTimer("pubsub", "FetchNodeItemsWithIDs").ObserveDuration()
+	return m.rep.FetchNodeItemsWithIDs(ctx, host, name, identifiers)
+}
+
+func (m *measuredPubSubRep) FetchNodeLastItem(ctx context.Context, host, name string) (*pubsubmodel.Item, error) {
+	defer newTimer("pubsub", "FetchNodeLastItem").ObserveDuration()
+	return m.rep.FetchNodeLastItem(ctx, host, name)
+}
+
+func (m *measuredPubSubRep) DeleteNodeItem(ctx context.Context, host, name, identifier string) error {
+	defer newTimer("pubsub", "DeleteNodeItem").ObserveDuration()
+	return m.rep.DeleteNodeItem(ctx, host, name, identifier)
+}
+
+func (m *measuredPubSubRep) FetchExpiredNodeItems(ctx context.Context, name string, publishedBefore time.Time) (map[string][]string, error) {
+	defer newTimer("pubsub", "FetchExpiredNodeItems").ObserveDuration()
+	return m.rep.FetchExpiredNodeItems(ctx, name, publishedBefore)
+}
+
+func (m *measuredPubSubRep) FetchHostItemsSize(ctx context.Context, host string) (int, error) {
+	defer newTimer("pubsub", "FetchHostItemsSize").ObserveDuration()
+	return m.rep.FetchHostItemsSize(ctx, host)
+}
+
+func (m *measuredPubSubRep) UpsertNodeAffiliation(ctx context.Context, affiliation *pubsubmodel.Affiliation, host, name string) error {
+	defer newTimer("pubsub", "UpsertNodeAffiliation").ObserveDuration()
+	return m.rep.UpsertNodeAffiliation(ctx, affiliation, host, name)
+}
+
+func (m *measuredPubSubRep) FetchNodeAffiliation(ctx context.Context, host, name, jid string) (*pubsubmodel.Affiliation, error) {
+	defer newTimer("pubsub", "FetchNodeAffiliation").ObserveDuration()
+	return m.rep.FetchNodeAffiliation(ctx, host, name, jid)
+}
+
+func (m *measuredPubSubRep) FetchNodeAffiliations(ctx context.Context, host, name string) ([]pubsubmodel.Affiliation, error) {
+	defer newTimer("pubsub", "FetchNodeAffiliations").ObserveDuration()
+	return m.rep.FetchNodeAffiliations(ctx, host, name)
+}
+
+func (m *measuredPubSubRep) DeleteNodeAffiliation(ctx context.Context, jid, host, name string) error {
+	defer newTimer("pubsub", "DeleteNodeAffiliation").ObserveDuration()
+	return m.rep.DeleteNodeAffiliation(ctx, jid, host, name)
+}
+
+func (m *measuredPubSubRep) UpsertNodeSubscription(ctx context.Context, subscription *pubsubmodel.Subscription, host, name string) error {
+	defer newTimer("pubsub", "UpsertNodeSubscription").ObserveDuration()
+	return m.rep.UpsertNodeSubscription(ctx, subscription, host, name)
+}
+
+func (m *measuredPubSubRep) FetchNodeSubscriptions(ctx context.Context, host, name string) ([]pubsubmodel.Subscription, error) {
+	defer newTimer("pubsub", "FetchNodeSubscriptions").ObserveDuration()
+	return m.rep.FetchNodeSubscriptions(ctx, host, name)
+}
+
+func (m *measuredPubSubRep) DeleteNodeSubscription(ctx context.Context, jid, host, name string) error {
+	defer newTimer("pubsub", "DeleteNodeSubscription").ObserveDuration()
+	return m.rep.DeleteNodeSubscription(ctx, jid, host, name)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/storage/repository"
+)
+
+type measuredRosterRep struct {
+	rep repository.Roster
+}
+
+func (m *measuredRosterRep) UpsertRosterItem(ctx context.Context, ri *rostermodel.Item) (rostermodel.Version, error) {
+	defer newTimer("roster", "UpsertRosterItem").ObserveDuration()
+	return m.rep.UpsertRosterItem(ctx, ri)
+}
+
+func (m *measuredRosterRep) DeleteRosterItem(ctx context.Context, userJID, jid string) (rostermodel.Version, error) {
+	defer newTimer("roster", "DeleteRosterItem").ObserveDuration()
+	return m.rep.DeleteRosterItem(ctx, userJID, jid)
+}
+
+func (m *measuredRosterRep) FetchRosterItems(ctx context.Context, userJID string) ([]rostermodel.Item, rostermodel.Version, error) {
+	defer newTimer("roster", "FetchRosterItems").ObserveDuration()
+	return m.rep.FetchRosterItems(ctx, userJID)
+}
+
+func (m *measuredRosterRep) FetchRosterItemsInGroups(ctx context.Context, userJID string, groups []string) ([]rostermodel.Item, rostermodel.Version, error) {
+	defer newTimer("roster", "FetchRosterItemsInGroups").ObserveDuration()
+	return m.rep.FetchRosterItemsInGroups(ctx, userJID, groups)
+}
+
+func (m *measuredRosterRep) FetchRosterChanges(ctx context.Context, userJID string, sinceVer int) ([]rostermodel.Item, error) {
+	defer newTimer("roster", "FetchRosterChanges").ObserveDuration()
+	return m.rep.FetchRosterChanges(ctx, userJID, sinceVer)
+}
+
+func (m *measuredRosterRep) FetchRosterItem(ctx context.Context, userJID, jid string) (*rostermodel.Item, error) {
+	defer newTimer("roster", "FetchRosterItem").ObserveDuration()
+	return m.rep.FetchRosterItem(ctx, userJID, jid)
+}
+
+func (m *measuredRosterRep) UpsertRosterNotification(ctx context.Context, rn *rostermodel.Notification) error {
+	defer newTimer("roster", "UpsertRosterNotification").ObserveDuration()
+	return m.rep.UpsertRosterNotification(ctx, rn)
+}
+
+func (m *measuredRosterRep) DeleteRosterNotification(ctx context.Context, contactJID, jid string) error {
+	defer newTimer("roster", "DeleteRosterNotification").ObserveDuration()
+	return m.rep.DeleteRosterNotification(ctx, contactJID, jid)
+}
+
+func (m *measuredRosterRep) FetchRosterNotification(ctx context.Context, contactJID string, jid string) (*rostermodel.Notification, error) {
+	defer newTimer("roster", "FetchRosterNotification").ObserveDuration()
+	return m.rep.FetchRosterNotification(ctx, contactJID, jid)
+}
+
+func (m *measuredRosterRep) FetchRosterNotifications(ctx context.Context, contactJID string) ([]rostermodel.Notification, error) {
+	defer newTimer("roster", "FetchRosterNotifications").ObserveDuration()
+	return m.rep.FetchRosterNotifications(ctx, contactJID)
+}
+
+func (m *measuredRosterRep) FetchRosterGroups(ctx context.Context, userJID string) ([]string, error) {
+	defer newTimer("roster", "FetchRosterGroups").ObserveDuration()
+	return m.rep.FetchRosterGroups(ctx, userJID)
+}
+
+func (m *measuredRosterRep) UpsertRosterPermission(ctx context.Context, userJID, jid string) error {
+	defer newTimer("roster", "UpsertRosterPermission").ObserveDuration()
+	return m.rep.UpsertRosterPermission(ctx, userJID, jid)
+}
+
+func (m *measuredRosterRep) DeleteRosterPermission(ctx context.Context, userJID, jid string) error {
+	defer newTimer("roster", "DeleteRosterPermission").ObserveDuration()
+	return m.rep.DeleteRosterPermission(ctx, userJID, jid)
+}
+
+func (m *measuredRosterRep) FetchRosterPermission(ctx context.Context, userJID, jid string) (bool, error) {
+	defer newTimer("roster", "FetchRosterPermission").ObserveDuration()
+	return m.rep.FetchRosterPermission(ctx, userJID, jid)
+}
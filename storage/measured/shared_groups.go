@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/storage/repository"
+)
+
+type measuredSharedGroupsRep struct {
+	rep repository.SharedGroups
+}
+
+func (m *measuredSharedGroupsRep) UpsertSharedGroup(ctx context.Context, group *rostermodel.SharedGroup) error {
+	defer newTimer("shared_groups", "UpsertSharedGroup").ObserveDuration()
+	return m.rep.UpsertSharedGroup(ctx, group)
+}
+
+func (m *measuredSharedGroupsRep) DeleteSharedGroup(ctx context.Context, name string) error {
+	defer newTimer("shared_groups", "DeleteSharedGroup").ObserveDuration()
+	return m.rep.DeleteSharedGroup(ctx, name)
+}
+
+func (m *measuredSharedGroupsRep) FetchSharedGroup(ctx context.Context, name string) (*rostermodel.SharedGroup, error) {
+	defer newTimer("shared_groups", "FetchSharedGroup").ObserveDuration()
+	return m.rep.FetchSharedGroup(ctx, name)
+}
+
+func (m *measuredSharedGroupsRep) FetchSharedGroups(ctx context.Context) ([]rostermodel.SharedGroup, error) {
+	defer newTimer("shared_groups", "FetchSharedGroups").ObserveDuration()
+	return m.rep.FetchSharedGroups(ctx)
+}
+
+func (m *measuredSharedGroupsRep) FetchSharedGroupMembers(ctx context.Context, name string) ([]string, error) {
+	defer newTimer("shared_groups", "FetchSharedGroupMembers").ObserveDuration()
+	return m.rep.FetchSharedGroupMembers(ctx, name)
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage/repository"
+)
+
+type measuredUserRep struct {
+	rep repository.User
+}
+
+func (m *measuredUserRep) UpsertUser(ctx context.Context, user *model.User) error {
+	defer newTimer("user", "UpsertUser").ObserveDuration()
+	return m.rep.UpsertUser(ctx, user)
+}
+
+func (m *measuredUserRep) DeleteUser(ctx context.Context, userJID string) error {
+	defer newTimer("user", "DeleteUser").ObserveDuration()
+	return m.rep.DeleteUser(ctx, userJID)
+}
+
+func (m *measuredUserRep) FetchUser(ctx context.Context, userJID string) (*model.User, error) {
+	defer newTimer("user", "FetchUser").ObserveDuration()
+	return m.rep.FetchUser(ctx, userJID)
+}
+
+func (m *measuredUserRep) UserExists(ctx context.Context, userJID string) (bool, error) {
+	defer newTimer("user", "UserExists").ObserveDuration()
+	return m.rep.UserExists(ctx, userJID)
+}
@@ -0,0 +1,27 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package measured
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+type measuredVCardRep struct {
+	rep repository.VCard
+}
+
+func (m *measuredVCardRep) UpsertVCard(ctx context.Context, vCard xmpp.XElement, userJID string) error {
+	defer newTimer("vcard", "UpsertVCard").ObserveDuration()
+	return m.rep.UpsertVCard(ctx, vCard, userJID)
+}
+
+func (m *measuredVCardRep) FetchVCard(ctx context.Context, userJID string) (xmpp.XElement, error) {
+	defer newTimer("vcard", "FetchVCard").ObserveDuration()
+	return m.rep.FetchVCard(ctx, userJID)
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memorystorage
+
+import (
+	"context"
+	"strings"
+
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/model/serializer"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// DeleteAccount deletes a user along with every entity associated to it.
+// In-memory deletion is not atomic across repositories.
+func (c *memoryContainer) DeleteAccount(_ context.Context, userJID *jid.JID) error {
+	bareJID := userJID.ToBareJID().String()
+
+	if err := c.roster.deleteAccount(bareJID); err != nil {
+		return err
+	}
+	if err := c.pubSub.deleteAccount(bareJID); err != nil {
+		return err
+	}
+	if err := c.blockList.deleteKey(blockListItemKey(bareJID)); err != nil {
+		return err
+	}
+	if err := c.priv.deleteKeysWithPrefix(privateStorageKey(bareJID, "")); err != nil {
+		return err
+	}
+	if err := c.vCard.deleteKey(vCardKey(bareJID)); err != nil {
+		return err
+	}
+	if err := c.offline.deleteKey(offlineMessageKey(bareJID)); err != nil {
+		return err
+	}
+	if err := c.presences.deleteKeysWithPrefix(presenceKey(userJID.ToBareJID()) + "/"); err != nil {
+		return err
+	}
+	return c.user.deleteKey(userKey(bareJID))
+}
+
+func (m *Roster) deleteAccount(bareJID string) error {
+	return m.inWriteLock(func() error {
+		delete(m.b, rosterItemsKey(bareJID))
+		delete(m.b, rosterVersionKey(bareJID))
+		delete(m.b, rosterChangesKey(bareJID))
+		delete(m.b, rosterGroupsKey(bareJID))
+		delete(m.b, rosterNotificationsKey(bareJID))
+
+		for k := range m.b {
+			switch {
+			case strings.HasPrefix(k, rosterPermissionKey(bareJID, "")):
+				delete(m.b, k)
+			case strings.HasPrefix(k, rosterItemsKey("")):
+				if err := m.deleteContactItem(strings.TrimPrefix(k, rosterItemsKey("")), bareJID); err != nil {
+					return err
+				}
+			case strings.HasPrefix(k, rosterNotificationsKey("")):
+				contact := strings.TrimPrefix(k, rosterNotificationsKey(""))
+				rns, err := m.fetchRosterNotifications(contact)
+				if err != nil {
+					return err
+				}
+				var filtered []rostermodel.Notification
+				for _, rn := range rns {
+					if rn.JID != bareJID {
+						filtered = append(filtered, rn)
+					}
+				}
+				if len(filtered) == len(rns) {
+					continue
+				}
+				if err := m.upsertRosterNotifications(filtered, contact); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Roster) deleteContactItem(user, contact string) error {
+	ris, err := m.fetchRosterItems(user)
+	if err != nil {
+		return err
+	}
+	var filtered []rostermodel.Item
+	for _, ri := range ris {
+		if ri.JID != contact {
+			filtered = append(filtered, ri)
+		}
+	}
+	if len(filtered) == len(ris) {
+		return nil
+	}
+	if err := m.upsertRosterItems(filtered, user); err != nil {
+		return err
+	}
+	if err := m.upsertRosterGroups(user, filtered); err != nil {
+		return err
+	}
+	rv, err := m.fetchRosterVersion(user)
+	if err != nil {
+		return err
+	}
+	rv.Ver++
+	rv.DeletionVer = rv.Ver
+	return m.upsertRosterVersion(rv, user)
+}
+
+func (m *PubSub) deleteAccount(bareJID string) error {
+	return m.inWriteLock(func() error {
+		// delete user owned nodes
+		var nodes []pubsubmodel.Node
+		if b := m.b[pubSubHostNodesKey(bareJID)]; b != nil {
+			if err := serializer.DeserializeSlice(b, &nodes); err != nil {
+				return err
+			}
+		}
+		for _, n := range nodes {
+			delete(m.b, pubSubNodesKey(n.Host, n.Name))
+			delete(m.b, pubSubItemsKey(n.Host, n.Name))
+			delete(m.b, pubSubAffiliationsKey(n.Host, n.Name))
+			delete(m.b, pubSubSubscriptionsKey(n.Host, n.Name))
+		}
+		delete(m.b, pubSubHostNodesKey(bareJID))
+
+		// delete user affiliations and subscriptions to other nodes
+		for k, b := range m.b {
+			switch {
+			case strings.HasPrefix(k, "pubSubAffiliations:"):
+				var affiliations, filtered []pubsubmodel.Affiliation
+				if err := serializer.DeserializeSlice(b, &affiliations); err != nil {
+					return err
+				}
+				for _, aff := range affiliations {
+					if aff.JID != bareJID {
+						filtered = append(filtered, aff)
+					}
+				}
+				if len(filtered) == len(affiliations) {
+					continue
+				}
+				b, err := serializer.SerializeSlice(&filtered)
+				if err != nil {
+					return err
+				}
+				m.b[k] = b
+
+			case strings.HasPrefix(k, "pubSubSubscriptions:"):
+				var subs, filtered []pubsubmodel.Subscription
+				if err := serializer.DeserializeSlice(b, &subs); err != nil {
+					return err
+				}
+				for _, sub := range subs {
+					if sub.JID != bareJID {
+						filtered = append(filtered, sub)
+					}
+				}
+				if len(filtered) == len(subs) {
+					continue
+				}
+				b, err := serializer.SerializeSlice(&filtered)
+				if err != nil {
+					return err
+				}
+				m.b[k] = b
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memorystorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_DeleteAccount(t *testing.T) {
+	ctx := context.Background()
+	c, _ := New()
+
+	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	contactJID, _ := jid.NewWithString("noelia@jackal.im", true)
+
+	_ = c.User().UpsertUser(ctx, &model.User{Username: "ortuman", Domain: "jackal.im", Password: "1234"})
+	_ = c.User().UpsertUser(ctx, &model.User{Username: "noelia", Domain: "jackal.im", Password: "1234"})
+	_, _ = c.Roster().UpsertRosterItem(ctx, &rostermodel.Item{Username: "ortuman", Domain: "jackal.im", JID: "noelia@jackal.im", Subscription: "both"})
+	_, _ = c.Roster().UpsertRosterItem(ctx, &rostermodel.Item{Username: "noelia", Domain: "jackal.im", JID: "ortuman@jackal.im", Subscription: "both"})
+	_, _ = c.Roster().UpsertRosterItem(ctx, &rostermodel.Item{Username: "noelia", Domain: "jackal.im", JID: "romeo@jackal.im", Subscription: "both"})
+	_ = c.Roster().UpsertRosterNotification(ctx, &rostermodel.Notification{Contact: "romeo", Domain: "jackal.im", JID: "ortuman@jackal.im", Presence: xmpp.NewPresence(j, contactJID, xmpp.SubscribeType)})
+	_ = c.Roster().UpsertRosterPermission(ctx, "ortuman@jackal.im", "gateway.jackal.im")
+	_ = c.BlockList().InsertBlockListItem(ctx, &model.BlockListItem{Username: "ortuman", Domain: "jackal.im", JID: "romeo@jackal.im"})
+	_ = c.Private().UpsertPrivateXML(ctx, []xmpp.XElement{xmpp.NewElementNamespace("exodus", "exodus:ns")}, "exodus:ns", "ortuman@jackal.im")
+	_ = c.VCard().UpsertVCard(ctx, xmpp.NewElementNamespace("vCard", "vcard-temp"), "ortuman@jackal.im")
+	_ = c.Offline().InsertOfflineMessage(ctx, xmpp.NewMessageType("id", xmpp.NormalType), "ortuman@jackal.im")
+	_, _ = c.Presences().UpsertPresence(ctx, xmpp.NewPresence(j, j, xmpp.AvailableType), j, "alloc")
+
+	_ = c.PubSub().UpsertNode(ctx, &pubsubmodel.Node{Host: "ortuman@jackal.im", Name: "princely_musings"})
+	_ = c.PubSub().UpsertNode(ctx, &pubsubmodel.Node{Host: "noelia@jackal.im", Name: "princely_musings"})
+	_ = c.PubSub().UpsertNodeSubscription(ctx, &pubsubmodel.Subscription{JID: "ortuman@jackal.im", Subscription: pubsubmodel.Subscribed}, "noelia@jackal.im", "princely_musings")
+	_ = c.PubSub().UpsertNodeAffiliation(ctx, &pubsubmodel.Affiliation{JID: "ortuman@jackal.im", Affiliation: pubsubmodel.Member}, "noelia@jackal.im", "princely_musings")
+
+	_, cntVer, _ := c.Roster().FetchRosterItems(ctx, "noelia@jackal.im")
+
+	require.Nil(t, c.DeleteAccount(ctx, j))
+
+	usr, _ := c.User().FetchUser(ctx, "ortuman@jackal.im")
+	require.Nil(t, usr)
+	usr, _ = c.User().FetchUser(ctx, "noelia@jackal.im")
+	require.NotNil(t, usr)
+
+	ris, _, _ := c.Roster().FetchRosterItems(ctx, "ortuman@jackal.im")
+	require.Len(t, ris, 0)
+	ris, ver, _ := c.Roster().FetchRosterItems(ctx, "noelia@jackal.im")
+	require.Len(t, ris, 1)
+	require.Equal(t, "romeo@jackal.im", ris[0].JID)
+	require.Equal(t, cntVer.Ver+1, ver.Ver)
+	require.Equal(t, ver.Ver, ver.DeletionVer)
+
+	rns, _ := c.Roster().FetchRosterNotifications(ctx, "romeo@jackal.im")
+	require.Len(t, rns, 0)
+	granted, _ := c.Roster().FetchRosterPermission(ctx, "ortuman@jackal.im", "gateway.jackal.im")
+	require.False(t, granted)
+
+	bl, _ := c.BlockList().FetchBlockListItems(ctx, "ortuman@jackal.im")
+	require.Len(t, bl, 0)
+	priv, _ := c.Private().FetchPrivateXML(ctx, "exodus:ns", "ortuman@jackal.im")
+	require.Len(t, priv, 0)
+	vCard, _ := c.VCard().FetchVCard(ctx, "ortuman@jackal.im")
+	require.Nil(t, vCard)
+	msgs, _ := c.Offline().FetchOfflineMessages(ctx, "ortuman@jackal.im")
+	require.Len(t, msgs, 0)
+	p, _ := c.Presences().FetchPresence(ctx, j)
+	require.Nil(t, p)
+
+	n, _ := c.PubSub().FetchNode(ctx, "ortuman@jackal.im", "princely_musings")
+	require.Nil(t, n)
+	n, _ = c.PubSub().FetchNode(ctx, "noelia@jackal.im", "princely_musings")
+	require.NotNil(t, n)
+	subs, _ := c.PubSub().FetchNodeSubscriptions(ctx, "noelia@jackal.im", "princely_musings")
+	require.Len(t, subs, 0)
+	affs, _ := c.PubSub().FetchNodeAffiliations(ctx, "noelia@jackal.im", "princely_musings")
+	require.Len(t, affs, 0)
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memorystorage
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/serializer"
+)
+
+// Invitations represents an in-memory registration invitations storage.
+type Invitations struct {
+	*memoryStorage
+}
+
+// NewInvitations returns an instance of Invitations in-memory storage.
+func NewInvitations() *Invitations {
+	return &Invitations{memoryStorage: newStorage()}
+}
+
+// InsertInvitation inserts a new invitation entity into storage.
+func (m *Invitations) InsertInvitation(_ context.Context, inv *model.Invitation) error {
+	return m.saveEntity(invitationKey(inv.Token), inv)
+}
+
+// DeleteInvitation deletes an invitation entity from storage, returning whether or not it was present.
+func (m *Invitations) DeleteInvitation(_ context.Context, token string) (bool, error) {
+	var deleted bool
+	err := m.inWriteLock(func() error {
+		k := invitationKey(token)
+		if _, ok := m.b[k]; ok {
+			delete(m.b, k)
+			deleted = true
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// FetchInvitation retrieves from storage an invitation entity.
+func (m *Invitations) FetchInvitation(_ context.Context, token string) (*model.Invitation, error) {
+	var inv model.Invitation
+	ok, err := m.getEntity(invitationKey(token), &inv)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &inv, nil
+}
+
+// FetchInvitations retrieves from storage all invitation entities.
+func (m *Invitations) FetchInvitations(_ context.Context) ([]model.Invitation, error) {
+	var invs []model.Invitation
+	err := m.inReadLock(func() error {
+		for k, b := range m.b {
+			if !strings.HasPrefix(k, invitationKey("")) {
+				continue
+			}
+			var inv model.Invitation
+			if err := serializer.Deserialize(b, &inv); err != nil {
+				return err
+			}
+			invs = append(invs, inv)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(invs, func(i, j int) bool { return invs[i].Expires.Before(invs[j].Expires) })
+	return invs, nil
+}
+
+func invitationKey(token string) string {
+	return "invitations:" + token
+}
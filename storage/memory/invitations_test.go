@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memorystorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_Invitations(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	inv1 := &model.Invitation{Token: "abcd", Username: "ortuman", Expires: now.Add(time.Hour)}
+	inv2 := &model.Invitation{Token: "efgh", Expires: now.Add(time.Minute)}
+
+	s := NewInvitations()
+
+	EnableMockedError()
+	require.Equal(t, ErrMocked, s.InsertInvitation(ctx, inv1))
+	DisableMockedError()
+
+	require.Nil(t, s.InsertInvitation(ctx, inv1))
+	require.Nil(t, s.InsertInvitation(ctx, inv2))
+
+	inv, err := s.FetchInvitation(ctx, "abcd")
+	require.Nil(t, err)
+	require.Equal(t, "ortuman", inv.Username)
+	require.True(t, inv1.Expires.Equal(inv.Expires))
+
+	inv, err = s.FetchInvitation(ctx, "ijkl")
+	require.Nil(t, err)
+	require.Nil(t, inv)
+
+	invs, err := s.FetchInvitations(ctx)
+	require.Nil(t, err)
+	require.Len(t, invs, 2)
+	require.Equal(t, "efgh", invs[0].Token)
+	require.Equal(t, "abcd", invs[1].Token)
+
+	// an invitation can only be deleted once
+	deleted, err := s.DeleteInvitation(ctx, "abcd")
+	require.Nil(t, err)
+	require.True(t, deleted)
+
+	deleted, err = s.DeleteInvitation(ctx, "abcd")
+	require.Nil(t, err)
+	require.False(t, deleted)
+
+	invs, _ = s.FetchInvitations(ctx)
+	require.Len(t, invs, 1)
+}
@@ -20,6 +20,8 @@ type memoryContainer struct {
 	blockList *BlockList
 	pubSub    *PubSub
 	offline   *Offline
+	shGroups  *SharedGroups
+	invs      *Invitations
 }
 
 // New initializes in-memory storage and returns associated container.
@@ -34,18 +36,22 @@ func New() (repository.Container, error) {
 	c.blockList = NewBlockList()
 	c.pubSub = NewPubSub()
 	c.offline = NewOffline()
+	c.shGroups = NewSharedGroups(c.user)
+	c.invs = NewInvitations()
 
 	return &c, nil
 }
 
-func (c *memoryContainer) User() repository.User           { return c.user }
-func (c *memoryContainer) Roster() repository.Roster       { return c.roster }
-func (c *memoryContainer) Presences() repository.Presences { return c.presences }
-func (c *memoryContainer) VCard() repository.VCard         { return c.vCard }
-func (c *memoryContainer) Private() repository.Private     { return c.priv }
-func (c *memoryContainer) BlockList() repository.BlockList { return c.blockList }
-func (c *memoryContainer) PubSub() repository.PubSub       { return c.pubSub }
-func (c *memoryContainer) Offline() repository.Offline     { return c.offline }
+func (c *memoryContainer) User() repository.User                 { return c.user }
+func (c *memoryContainer) Roster() repository.Roster             { return c.roster }
+func (c *memoryContainer) Presences() repository.Presences       { return c.presences }
+func (c *memoryContainer) VCard() repository.VCard               { return c.vCard }
+func (c *memoryContainer) Private() repository.Private           { return c.priv }
+func (c *memoryContainer) BlockList() repository.BlockList       { return c.blockList }
+func (c *memoryContainer) PubSub() repository.PubSub             { return c.pubSub }
+func (c *memoryContainer) Offline() repository.Offline           { return c.offline }
+func (c *memoryContainer) SharedGroups() repository.SharedGroups { return c.shGroups }
+func (c *memoryContainer) Invitations() repository.Invitations   { return c.invs }
 
 func (c *memoryContainer) Close(_ context.Context) error { return nil }
 
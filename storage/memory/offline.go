@@ -23,8 +23,8 @@ func NewOffline() *Offline {
 }
 
 // InsertOfflineMessage inserts a new message element into user's offline queue.
-func (m *Offline) InsertOfflineMessage(_ context.Context, message *xmpp.Message, username string) error {
-	return m.updateInWriteLock(offlineMessageKey(username), func(b []byte) ([]byte, error) {
+func (m *Offline) InsertOfflineMessage(_ context.Context, message *xmpp.Message, userJID string) error {
+	return m.updateInWriteLock(offlineMessageKey(userJID), func(b []byte) ([]byte, error) {
 		var messages []xmpp.Message
 		if len(b) > 0 {
 			if err := serializer.DeserializeSlice(b, &messages); err != nil {
@@ -42,9 +42,9 @@ func (m *Offline) InsertOfflineMessage(_ context.Context, message *xmpp.Message,
 }
 
 // CountOfflineMessages returns current length of user's offline queue.
-func (m *Offline) CountOfflineMessages(_ context.Context, username string) (int, error) {
+func (m *Offline) CountOfflineMessages(_ context.Context, userJID string) (int, error) {
 	var messages []xmpp.Message
-	_, err := m.getEntities(offlineMessageKey(username), &messages)
+	_, err := m.getEntities(offlineMessageKey(userJID), &messages)
 	if err != nil {
 		return 0, err
 	}
@@ -52,9 +52,9 @@ func (m *Offline) CountOfflineMessages(_ context.Context, username string) (int,
 }
 
 // FetchOfflineMessages retrieves from storage current user offline queue.
-func (m *Offline) FetchOfflineMessages(_ context.Context, username string) ([]xmpp.Message, error) {
+func (m *Offline) FetchOfflineMessages(_ context.Context, userJID string) ([]xmpp.Message, error) {
 	var messages []xmpp.Message
-	_, err := m.getEntities(offlineMessageKey(username), &messages)
+	_, err := m.getEntities(offlineMessageKey(userJID), &messages)
 	switch err {
 	case nil:
 		return messages, nil
@@ -64,10 +64,10 @@ func (m *Offline) FetchOfflineMessages(_ context.Context, username string) ([]xm
 }
 
 // DeleteOfflineMessages clears a user offline queue.
-func (m *Offline) DeleteOfflineMessages(_ context.Context, username string) error {
-	return m.deleteKey(offlineMessageKey(username))
+func (m *Offline) DeleteOfflineMessages(_ context.Context, userJID string) error {
+	return m.deleteKey(offlineMessageKey(userJID))
 }
 
-func offlineMessageKey(username string) string {
-	return "offlineMessages:" + username
+func offlineMessageKey(userJID string) string {
+	return "offlineMessages:" + userJID
 }
@@ -22,20 +22,20 @@ func NewPrivate() *Private {
 }
 
 // UpsertPrivateXML inserts a new private element into storage, or updates it in case it's been previously inserted.
-func (m *Private) UpsertPrivateXML(_ context.Context, privateXML []xmpp.XElement, namespace string, username string) error {
+func (m *Private) UpsertPrivateXML(_ context.Context, privateXML []xmpp.XElement, namespace string, userJID string) error {
 	var priv []xmpp.Element
 
 	// convert to concrete type
 	for _, el := range privateXML {
 		priv = append(priv, *xmpp.NewElementFromElement(el))
 	}
-	return m.saveEntities(privateStorageKey(username, namespace), &priv)
+	return m.saveEntities(privateStorageKey(userJID, namespace), &priv)
 }
 
 // FetchPrivateXML retrieves from storage a private element.
-func (m *Private) FetchPrivateXML(_ context.Context, namespace string, username string) ([]xmpp.XElement, error) {
+func (m *Private) FetchPrivateXML(_ context.Context, namespace string, userJID string) ([]xmpp.XElement, error) {
 	var priv []xmpp.Element
-	_, err := m.getEntities(privateStorageKey(username, namespace), &priv)
+	_, err := m.getEntities(privateStorageKey(userJID, namespace), &priv)
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +46,6 @@ func (m *Private) FetchPrivateXML(_ context.Context, namespace string, username
 	return ret, nil
 }
 
-func privateStorageKey(username, namespace string) string {
-	return "privateElements:" + username + ":" + namespace
+func privateStorageKey(userJID, namespace string) string {
+	return "privateElements:" + userJID + ":" + namespace
 }
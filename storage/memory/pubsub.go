@@ -8,8 +8,10 @@ package memorystorage
 import (
 	"context"
 	"strings"
+	"time"
 
 	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
 	"github.com/ortuman/jackal/model/serializer"
 )
 
@@ -175,16 +177,19 @@ func (m *PubSub) UpsertNodeItem(_ context.Context, item *pubsubmodel.Item, host,
 				return err
 			}
 		}
+		newItem := *item
+		newItem.PublishedAt = time.Now()
+
 		var updated bool
 		for i, itm := range items {
 			if itm.ID == item.ID {
-				items[i] = *item
+				items[i] = newItem
 				updated = true
 				break
 			}
 		}
 		if !updated {
-			items = append(items, *item)
+			items = append(items, newItem)
 		}
 		if len(items) > maxNodeItems {
 			items = items[len(items)-maxNodeItems:] // remove oldest elements
@@ -217,6 +222,23 @@ func (m *PubSub) FetchNodeItems(_ context.Context, host, name string) ([]pubsubm
 	return items, nil
 }
 
+// FetchNodeItemsPage retrieves a page of node items as requested by a result set management request.
+func (m *PubSub) FetchNodeItemsPage(ctx context.Context, host, name string, req *rsmmodel.Request) ([]pubsubmodel.Item, *rsmmodel.Result, error) {
+	items, err := m.FetchNodeItems(ctx, host, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	identifiers := make([]string, len(items))
+	for i, itm := range items {
+		identifiers[i] = itm.ID
+	}
+	from, to, res, err := rsmmodel.Paginate(identifiers, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items[from:to], res, nil
+}
+
 // FetchNodeItemsWithIDs retrieves all items matching any of the passed identifiers.
 func (m *PubSub) FetchNodeItemsWithIDs(_ context.Context, host, name string, identifiers []string) ([]pubsubmodel.Item, error) {
 	var b []byte
@@ -261,9 +283,99 @@ func (m *PubSub) FetchNodeLastItem(_ context.Context, host, name string) (*pubsu
 	if err := serializer.DeserializeSlice(b, &items); err != nil {
 		return nil, err
 	}
+	if len(items) == 0 {
+		return nil, nil
+	}
 	return &items[len(items)-1], nil
 }
 
+// DeleteNodeItem deletes a pubsub node item from storage.
+func (m *PubSub) DeleteNodeItem(_ context.Context, host, name, identifier string) error {
+	return m.inWriteLock(func() error {
+		var items []pubsubmodel.Item
+
+		b := m.b[pubSubItemsKey(host, name)]
+		if b == nil {
+			return nil
+		}
+		if err := serializer.DeserializeSlice(b, &items); err != nil {
+			return err
+		}
+		for i, itm := range items {
+			if itm.ID == identifier {
+				items = append(items[:i], items[i+1:]...)
+				break
+			}
+		}
+		if len(items) == 0 {
+			delete(m.b, pubSubItemsKey(host, name))
+			return nil
+		}
+		b, err := serializer.SerializeSlice(&items)
+		if err != nil {
+			return err
+		}
+		m.b[pubSubItemsKey(host, name)] = b
+		return nil
+	})
+}
+
+// FetchExpiredNodeItems retrieves the identifiers of every item published before a given time
+// in all nodes named name, indexed by node host.
+func (m *PubSub) FetchExpiredNodeItems(_ context.Context, name string, publishedBefore time.Time) (map[string][]string, error) {
+	ret := make(map[string][]string)
+	if err := m.inReadLock(func() error {
+		for k, b := range m.b {
+			if !strings.HasPrefix(k, "pubSubItems:") {
+				continue
+			}
+			keySplits := strings.SplitN(k, ":", 3)
+			if len(keySplits) != 3 || keySplits[2] != name {
+				continue
+			}
+			var items []pubsubmodel.Item
+			if err := serializer.DeserializeSlice(b, &items); err != nil {
+				return err
+			}
+			for _, itm := range items {
+				if itm.PublishedAt.Before(publishedBefore) {
+					ret[keySplits[1]] = append(ret[keySplits[1]], itm.ID)
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// FetchHostItemsSize returns the overall size in bytes of all item payloads stored in host nodes.
+func (m *PubSub) FetchHostItemsSize(_ context.Context, host string) (int, error) {
+	var size int
+	if err := m.inReadLock(func() error {
+		prefix := pubSubItemsKey(host, "")
+		for k, b := range m.b {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			var items []pubsubmodel.Item
+			if err := serializer.DeserializeSlice(b, &items); err != nil {
+				return err
+			}
+			for _, itm := range items {
+				if itm.Payload != nil {
+					size += len(itm.Payload.String())
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
 // UpsertNodeAffiliation inserts a new pubsub node affiliation into storage, or updates it if previously inserted.
 func (m *PubSub) UpsertNodeAffiliation(_ context.Context, affiliation *pubsubmodel.Affiliation, host, name string) error {
 	return m.inWriteLock(func() error {
@@ -9,8 +9,10 @@ import (
 	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/stretchr/testify/require"
 )
@@ -95,6 +97,9 @@ func TestStorage_PubSubNodeItem(t *testing.T) {
 	require.NotNil(t, items)
 
 	require.Len(t, items, 1)
+	require.False(t, items[0].PublishedAt.IsZero())
+
+	items[0].PublishedAt = time.Time{}
 	require.True(t, reflect.DeepEqual(&items[0], item2))
 
 	// update item
@@ -105,8 +110,8 @@ func TestStorage_PubSubNodeItem(t *testing.T) {
 	require.NotNil(t, items)
 
 	require.Len(t, items, 2)
-	require.True(t, reflect.DeepEqual(&items[0], item2))
-	require.True(t, reflect.DeepEqual(&items[1], item3))
+	require.Equal(t, "id2", items[0].ID)
+	require.Equal(t, "id3", items[1].ID)
 
 	items, err = s.FetchNodeItemsWithIDs(context.Background(), "ortuman@jackal.im", "princely_musings", []string{"id3"})
 	require.Nil(t, err)
@@ -114,6 +119,65 @@ func TestStorage_PubSubNodeItem(t *testing.T) {
 
 	require.Len(t, items, 1)
 	require.Equal(t, "id3", items[0].ID)
+
+	items, res, err := s.FetchNodeItemsPage(context.Background(), "ortuman@jackal.im", "princely_musings", &rsmmodel.Request{Max: 1, LastPage: true})
+	require.Nil(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, "id3", items[0].ID)
+	require.Equal(t, &rsmmodel.Result{First: "id3", FirstIndex: 1, Last: "id3", Count: 2}, res)
+
+	_, _, err = s.FetchNodeItemsPage(context.Background(), "ortuman@jackal.im", "princely_musings", &rsmmodel.Request{Max: 1, Before: "id1"})
+	require.Equal(t, rsmmodel.ErrPageNotFound, err)
+
+	// delete item
+	require.Nil(t, s.DeleteNodeItem(context.Background(), "ortuman@jackal.im", "princely_musings", "id3"))
+
+	lastItem, err := s.FetchNodeLastItem(context.Background(), "ortuman@jackal.im", "princely_musings")
+	require.Nil(t, err)
+	require.NotNil(t, lastItem)
+	require.Equal(t, "id2", lastItem.ID)
+
+	require.Nil(t, s.DeleteNodeItem(context.Background(), "ortuman@jackal.im", "princely_musings", "id2"))
+
+	lastItem, err = s.FetchNodeLastItem(context.Background(), "ortuman@jackal.im", "princely_musings")
+	require.Nil(t, err)
+	require.Nil(t, lastItem)
+}
+
+func TestStorage_PubSubNodeItemsExpiry(t *testing.T) {
+	s := NewPubSub()
+	item1 := &pubsubmodel.Item{
+		ID:        "id1",
+		Publisher: "ortuman@jackal.im",
+		Payload:   xmpp.NewElementName("a"),
+	}
+	item2 := &pubsubmodel.Item{
+		ID:        "id2",
+		Publisher: "ortuman@jackal.im",
+		Payload:   xmpp.NewElementName("b"),
+	}
+	require.Nil(t, s.UpsertNodeItem(context.Background(), item1, "ortuman@jackal.im", "princely_musings", 10))
+	require.Nil(t, s.UpsertNodeItem(context.Background(), item1, "ortuman@jackal.im", "x:princely_musings", 10))
+	require.Nil(t, s.UpsertNodeItem(context.Background(), item2, "noelia@jackal.im", "princely_musings", 10))
+
+	size, err := s.FetchHostItemsSize(context.Background(), "ortuman@jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 2*len(item1.Payload.String()), size)
+
+	expired, err := s.FetchExpiredNodeItems(context.Background(), "princely_musings", time.Now().Add(-time.Hour))
+	require.Nil(t, err)
+	require.Len(t, expired, 0)
+
+	expired, err = s.FetchExpiredNodeItems(context.Background(), "princely_musings", time.Now().Add(time.Second))
+	require.Nil(t, err)
+	require.Equal(t, map[string][]string{
+		"ortuman@jackal.im": {"id1"},
+		"noelia@jackal.im":  {"id2"},
+	}, expired)
+
+	// expired items are not deleted
+	items, _ := s.FetchNodeItems(context.Background(), "ortuman@jackal.im", "princely_musings")
+	require.Len(t, items, 1)
 }
 
 func TestStorage_PubSubNodeAffiliation(t *testing.T) {
@@ -10,6 +10,7 @@ import (
 	"context"
 	"encoding/gob"
 
+	"github.com/ortuman/jackal/model"
 	rostermodel "github.com/ortuman/jackal/model/roster"
 	"github.com/ortuman/jackal/model/serializer"
 )
@@ -28,7 +29,7 @@ func NewRoster() *Roster {
 func (m *Roster) UpsertRosterItem(_ context.Context, ri *rostermodel.Item) (rostermodel.Version, error) {
 	var rv rostermodel.Version
 	err := m.inWriteLock(func() error {
-		ris, fnErr := m.fetchRosterItems(ri.Username)
+		ris, fnErr := m.fetchRosterItems(ri.UserJID())
 		if fnErr != nil {
 			return fnErr
 		}
@@ -45,19 +46,24 @@ func (m *Roster) UpsertRosterItem(_ context.Context, ri *rostermodel.Item) (rost
 		}
 
 	done:
-		if fnErr := m.upsertRosterGroups(ri.Username, ris); fnErr != nil {
+		if fnErr := m.upsertRosterGroups(ri.UserJID(), ris); fnErr != nil {
 			return fnErr
 		}
-		rv, fnErr = m.fetchRosterVersion(ri.Username)
+		rv, fnErr = m.fetchRosterVersion(ri.UserJID())
 		if fnErr != nil {
 			return fnErr
 		}
 		rv.Ver++
-		if err := m.upsertRosterVersion(rv, ri.Username); err != nil {
+		if err := m.upsertRosterVersion(rv, ri.UserJID()); err != nil {
 			return err
 		}
 		ris[len(ris)-1].Ver = rv.Ver
-		return m.upsertRosterItems(ris, ri.Username)
+		if err := m.upsertRosterItems(ris, ri.UserJID()); err != nil {
+			return err
+		}
+		change := *ri
+		change.Ver = rv.Ver
+		return m.appendRosterChange(change, ri.UserJID())
 	})
 	return rv, err
 }
@@ -88,8 +94,17 @@ func (m *Roster) DeleteRosterItem(_ context.Context, user, contact string) (rost
 			return fnErr
 		}
 		rv.Ver++
-		rv.DeletionVer = rv.Ver
-		return m.upsertRosterVersion(rv, user)
+		if err := m.upsertRosterVersion(rv, user); err != nil {
+			return err
+		}
+		username, domain := model.SplitBareJID(user)
+		return m.appendRosterChange(rostermodel.Item{
+			Username:     username,
+			Domain:       domain,
+			JID:          contact,
+			Subscription: rostermodel.SubscriptionRemove,
+			Ver:          rv.Ver,
+		}, user)
 	}); err != nil {
 		return rostermodel.Version{}, err
 	}
@@ -116,7 +131,7 @@ func (m *Roster) FetchRosterItems(_ context.Context, user string) ([]rostermodel
 }
 
 // FetchRosterItemsInGroups retrieves from storage all roster item entities associated to a given user and a set of groups.
-func (m *Roster) FetchRosterItemsInGroups(_ context.Context, username string, groups []string) ([]rostermodel.Item, rostermodel.Version, error) {
+func (m *Roster) FetchRosterItemsInGroups(_ context.Context, userJID string, groups []string) ([]rostermodel.Item, rostermodel.Version, error) {
 	var ris []rostermodel.Item
 	var rv rostermodel.Version
 
@@ -125,7 +140,7 @@ func (m *Roster) FetchRosterItemsInGroups(_ context.Context, username string, gr
 		groupSet[group] = struct{}{}
 	}
 	if err := m.inReadLock(func() error {
-		fnRis, fnErr := m.fetchRosterItems(username)
+		fnRis, fnErr := m.fetchRosterItems(userJID)
 		if fnErr != nil {
 			return fnErr
 		}
@@ -137,7 +152,7 @@ func (m *Roster) FetchRosterItemsInGroups(_ context.Context, username string, gr
 				}
 			}
 		}
-		rv, fnErr = m.fetchRosterVersion(username)
+		rv, fnErr = m.fetchRosterVersion(userJID)
 		return fnErr
 	}); err != nil {
 		return nil, rostermodel.Version{}, err
@@ -145,6 +160,26 @@ func (m *Roster) FetchRosterItemsInGroups(_ context.Context, username string, gr
 	return ris, rv, nil
 }
 
+// FetchRosterChanges retrieves from storage all roster items changed after a given roster version, sorted by version.
+func (m *Roster) FetchRosterChanges(_ context.Context, userJID string, sinceVer int) ([]rostermodel.Item, error) {
+	var ris []rostermodel.Item
+	if err := m.inReadLock(func() error {
+		changes, fnErr := m.fetchRosterChanges(userJID)
+		if fnErr != nil {
+			return fnErr
+		}
+		for _, change := range changes {
+			if change.Ver > sinceVer {
+				ris = append(ris, change)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ris, nil
+}
+
 // FetchRosterItem retrieves from storage a roster item entity.
 func (m *Roster) FetchRosterItem(_ context.Context, user, contact string) (*rostermodel.Item, error) {
 	var ret *rostermodel.Item
@@ -167,7 +202,7 @@ func (m *Roster) FetchRosterItem(_ context.Context, user, contact string) (*rost
 // UpsertRosterNotification inserts a new roster notification entity into storage, or updates it if previously inserted.
 func (m *Roster) UpsertRosterNotification(_ context.Context, rn *rostermodel.Notification) error {
 	return m.inWriteLock(func() error {
-		rns, fnErr := m.fetchRosterNotifications(rn.Contact)
+		rns, fnErr := m.fetchRosterNotifications(rn.ContactJID())
 		if fnErr != nil {
 			return fnErr
 		}
@@ -183,7 +218,7 @@ func (m *Roster) UpsertRosterNotification(_ context.Context, rn *rostermodel.Not
 			rns = []rostermodel.Notification{*rn}
 		}
 	done:
-		return m.upsertRosterNotifications(rns, rn.Contact)
+		return m.upsertRosterNotifications(rns, rn.ContactJID())
 	})
 }
 
@@ -237,11 +272,11 @@ func (m *Roster) FetchRosterNotifications(_ context.Context, contact string) ([]
 }
 
 // FetchRosterGroups retrieves all groups associated to a user roster.
-func (m *Roster) FetchRosterGroups(_ context.Context, username string) ([]string, error) {
+func (m *Roster) FetchRosterGroups(_ context.Context, userJID string) ([]string, error) {
 	var groups []string
 	if err := m.inReadLock(func() error {
 		var fnErr error
-		groups, fnErr = m.fetchRosterGroups(username)
+		groups, fnErr = m.fetchRosterGroups(userJID)
 		return fnErr
 	}); err != nil {
 		return nil, err
@@ -249,6 +284,23 @@ func (m *Roster) FetchRosterGroups(_ context.Context, username string) ([]string
 	return groups, nil
 }
 
+// UpsertRosterPermission grants an entity permission to manage a user's roster (XEP-0321).
+func (m *Roster) UpsertRosterPermission(_ context.Context, userJID, jid string) error {
+	return m.updateInWriteLock(rosterPermissionKey(userJID, jid), func(_ []byte) ([]byte, error) {
+		return []byte{1}, nil
+	})
+}
+
+// DeleteRosterPermission revokes a previously granted roster management permission.
+func (m *Roster) DeleteRosterPermission(_ context.Context, userJID, jid string) error {
+	return m.deleteKey(rosterPermissionKey(userJID, jid))
+}
+
+// FetchRosterPermission tells whether or not an entity has been granted permission to manage a user's roster.
+func (m *Roster) FetchRosterPermission(_ context.Context, userJID, jid string) (bool, error) {
+	return m.keyExists(rosterPermissionKey(userJID, jid))
+}
+
 func (m *Roster) upsertRosterItems(ris []rostermodel.Item, user string) error {
 	b, err := serializer.SerializeSlice(&ris)
 	if err != nil {
@@ -291,6 +343,40 @@ func (m *Roster) fetchRosterVersion(user string) (rostermodel.Version, error) {
 	return rv, nil
 }
 
+// appendRosterChange records a roster change, keeping only the latest change per contact.
+func (m *Roster) appendRosterChange(change rostermodel.Item, user string) error {
+	changes, err := m.fetchRosterChanges(user)
+	if err != nil {
+		return err
+	}
+	for i, c := range changes {
+		if c.JID == change.JID {
+			changes = append(changes[:i], changes[i+1:]...)
+			break
+		}
+	}
+	changes = append(changes, change)
+
+	b, err := serializer.SerializeSlice(&changes)
+	if err != nil {
+		return err
+	}
+	m.b[rosterChangesKey(user)] = b
+	return nil
+}
+
+func (m *Roster) fetchRosterChanges(user string) ([]rostermodel.Item, error) {
+	b := m.b[rosterChangesKey(user)]
+	if b == nil {
+		return nil, nil
+	}
+	var changes []rostermodel.Item
+	if err := serializer.DeserializeSlice(b, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
 func (m *Roster) upsertRosterNotifications(rns []rostermodel.Notification, contact string) error {
 	b, err := serializer.SerializeSlice(&rns)
 	if err != nil {
@@ -367,14 +453,22 @@ func rosterItemsKey(user string) string {
 	return "rosterItems:" + user
 }
 
-func rosterVersionKey(username string) string {
-	return "rosterVersions:" + username
+func rosterVersionKey(userJID string) string {
+	return "rosterVersions:" + userJID
+}
+
+func rosterChangesKey(userJID string) string {
+	return "rosterChanges:" + userJID
 }
 
 func rosterNotificationsKey(contact string) string {
 	return "rosterNotifications:" + contact
 }
 
-func rosterGroupsKey(username string) string {
-	return "rosterGroups:" + username
+func rosterGroupsKey(userJID string) string {
+	return "rosterGroups:" + userJID
+}
+
+func rosterPermissionKey(userJID, jid string) string {
+	return "rosterPermissions:" + userJID + ":" + jid
 }
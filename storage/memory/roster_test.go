@@ -159,6 +159,33 @@ func TestMemoryStorage_DeleteRosterItem(t *testing.T) {
 	require.Len(t, gr, 0)
 }
 
+func TestMemoryStorage_FetchRosterChanges(t *testing.T) {
+	s := NewRoster()
+	ri1 := rostermodel.Item{Username: "ortuman", Domain: "jackal.im", JID: "romeo@jackal.im", Subscription: "both"}
+	ri2 := rostermodel.Item{Username: "ortuman", Domain: "jackal.im", JID: "juliet@jackal.im", Subscription: "none"}
+
+	_, _ = s.UpsertRosterItem(context.Background(), &ri1)                                   // v1
+	_, _ = s.UpsertRosterItem(context.Background(), &ri2)                                   // v2
+	_, _ = s.DeleteRosterItem(context.Background(), "ortuman@jackal.im", "romeo@jackal.im") // v3
+
+	ris, err := s.FetchRosterChanges(context.Background(), "ortuman@jackal.im", 1)
+	require.Nil(t, err)
+	require.Len(t, ris, 2)
+	require.Equal(t, "juliet@jackal.im", ris[0].JID)
+	require.Equal(t, 2, ris[0].Ver)
+	require.Equal(t, "romeo@jackal.im", ris[1].JID)
+	require.Equal(t, rostermodel.SubscriptionRemove, ris[1].Subscription)
+	require.Equal(t, 3, ris[1].Ver)
+
+	ris, _ = s.FetchRosterChanges(context.Background(), "ortuman@jackal.im", 3)
+	require.Len(t, ris, 0)
+
+	// deletions are tracked by the change log
+	_, rv, _ := s.FetchRosterItems(context.Background(), "ortuman@jackal.im")
+	require.Equal(t, 3, rv.Ver)
+	require.Equal(t, 0, rv.DeletionVer)
+}
+
 func TestMemoryStorage_InsertRosterNotification(t *testing.T) {
 	rn := rostermodel.Notification{
 		Contact:  "ortuman",
@@ -226,3 +253,27 @@ func TestMemoryStorage_DeleteRosterNotification(t *testing.T) {
 	// delete not existing roster notification...
 	require.Nil(t, s.DeleteRosterNotification(context.Background(), "ortuman2", "romeo@jackal.im"))
 }
+
+func TestMemoryStorage_RosterPermissions(t *testing.T) {
+	s := NewRoster()
+
+	EnableMockedError()
+	require.Equal(t, ErrMocked, s.UpsertRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im"))
+	_, err := s.FetchRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.Equal(t, ErrMocked, err)
+	DisableMockedError()
+
+	require.Nil(t, s.UpsertRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im"))
+
+	granted, err := s.FetchRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.Nil(t, err)
+	require.True(t, granted)
+
+	granted, _ = s.FetchRosterPermission(context.Background(), "noelia@jackal.im", "gateway.jackal.im")
+	require.False(t, granted)
+
+	require.Nil(t, s.DeleteRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im"))
+
+	granted, _ = s.FetchRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.False(t, granted)
+}
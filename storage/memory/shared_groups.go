@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memorystorage
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/ortuman/jackal/model/serializer"
+)
+
+// SharedGroups represents an in-memory shared roster groups storage.
+type SharedGroups struct {
+	*memoryStorage
+	user *User
+}
+
+// NewSharedGroups returns an instance of SharedGroups in-memory storage.
+// User storage is used to resolve host wide group members.
+func NewSharedGroups(user *User) *SharedGroups {
+	return &SharedGroups{memoryStorage: newStorage(), user: user}
+}
+
+// UpsertSharedGroup inserts a new shared group entity into storage, or updates it if previously inserted.
+func (m *SharedGroups) UpsertSharedGroup(_ context.Context, group *rostermodel.SharedGroup) error {
+	return m.saveEntity(sharedGroupKey(group.Name), group)
+}
+
+// DeleteSharedGroup deletes a shared group entity from storage.
+func (m *SharedGroups) DeleteSharedGroup(_ context.Context, name string) error {
+	return m.deleteKey(sharedGroupKey(name))
+}
+
+// FetchSharedGroup retrieves from storage a shared group entity.
+func (m *SharedGroups) FetchSharedGroup(_ context.Context, name string) (*rostermodel.SharedGroup, error) {
+	var group rostermodel.SharedGroup
+	ok, err := m.getEntity(sharedGroupKey(name), &group)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &group, nil
+}
+
+// FetchSharedGroups retrieves from storage all shared group entities.
+func (m *SharedGroups) FetchSharedGroups(_ context.Context) ([]rostermodel.SharedGroup, error) {
+	var groups []rostermodel.SharedGroup
+	err := m.inReadLock(func() error {
+		for k, b := range m.b {
+			if !strings.HasPrefix(k, sharedGroupKey("")) {
+				continue
+			}
+			var group rostermodel.SharedGroup
+			if err := serializer.Deserialize(b, &group); err != nil {
+				return err
+			}
+			groups = append(groups, group)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// FetchSharedGroupMembers retrieves the bare JIDs of all shared group members.
+func (m *SharedGroups) FetchSharedGroupMembers(ctx context.Context, name string) ([]string, error) {
+	group, err := m.FetchSharedGroup(ctx, name)
+	if err != nil || group == nil {
+		return nil, err
+	}
+	set := make(map[string]struct{})
+	for _, member := range group.Members {
+		set[member] = struct{}{}
+	}
+	if len(group.Hosts) > 0 {
+		err := m.user.inReadLock(func() error {
+			for k := range m.user.b {
+				if !strings.HasPrefix(k, userKey("")) {
+					continue
+				}
+				userJID := strings.TrimPrefix(k, userKey(""))
+				for _, host := range group.Hosts {
+					if strings.HasSuffix(userJID, "@"+host) {
+						set[userJID] = struct{}{}
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func sharedGroupKey(name string) string {
+	return "sharedGroups:" + name
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memorystorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_SharedGroups(t *testing.T) {
+	ctx := context.Background()
+
+	u := NewUser()
+	_ = u.UpsertUser(ctx, &model.User{Username: "romeo", Domain: "dev.jackal.im"})
+	_ = u.UpsertUser(ctx, &model.User{Username: "juliet", Domain: "dev.jackal.im"})
+	_ = u.UpsertUser(ctx, &model.User{Username: "noelia", Domain: "jackal.im"})
+
+	s := NewSharedGroups(u)
+
+	g1 := &rostermodel.SharedGroup{Name: "Engineering", Members: []string{"ortuman@jackal.im"}, Hosts: []string{"dev.jackal.im"}}
+	g2 := &rostermodel.SharedGroup{Name: "Everyone", Hosts: []string{"jackal.im"}}
+
+	EnableMockedError()
+	require.Equal(t, ErrMocked, s.UpsertSharedGroup(ctx, g1))
+	DisableMockedError()
+
+	require.Nil(t, s.UpsertSharedGroup(ctx, g1))
+	require.Nil(t, s.UpsertSharedGroup(ctx, g2))
+
+	g, err := s.FetchSharedGroup(ctx, "Engineering")
+	require.Nil(t, err)
+	require.Equal(t, g1, g)
+
+	g, err = s.FetchSharedGroup(ctx, "Sales")
+	require.Nil(t, err)
+	require.Nil(t, g)
+
+	groups, err := s.FetchSharedGroups(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []rostermodel.SharedGroup{*g1, *g2}, groups)
+
+	members, err := s.FetchSharedGroupMembers(ctx, "Engineering")
+	require.Nil(t, err)
+	require.Equal(t, []string{"juliet@dev.jackal.im", "ortuman@jackal.im", "romeo@dev.jackal.im"}, members)
+
+	members, err = s.FetchSharedGroupMembers(ctx, "Everyone")
+	require.Nil(t, err)
+	require.Equal(t, []string{"noelia@jackal.im"}, members)
+
+	require.Nil(t, s.DeleteSharedGroup(ctx, "Engineering"))
+	groups, _ = s.FetchSharedGroups(ctx)
+	require.Len(t, groups, 1)
+
+	EnableMockedError()
+	_, err = s.FetchSharedGroups(ctx)
+	require.Equal(t, ErrMocked, err)
+	DisableMockedError()
+}
@@ -7,6 +7,7 @@ package memorystorage
 
 import (
 	"errors"
+	"strings"
 	"sync"
 
 	"github.com/ortuman/jackal/model/serializer"
@@ -146,6 +147,17 @@ func (m *memoryStorage) deleteKey(k string) error {
 	})
 }
 
+func (m *memoryStorage) deleteKeysWithPrefix(prefix string) error {
+	return m.inWriteLock(func() error {
+		for k := range m.b {
+			if strings.HasPrefix(k, prefix) {
+				delete(m.b, k)
+			}
+		}
+		return nil
+	})
+}
+
 func (m *memoryStorage) keyExists(k string) (bool, error) {
 	var b []byte
 	if err := m.inReadLock(func() error {
@@ -23,18 +23,18 @@ func NewUser() *User {
 
 // UpsertUser inserts a new user entity into storage, or updates it in case it's been previously inserted.
 func (m *User) UpsertUser(_ context.Context, user *model.User) error {
-	return m.saveEntity(userKey(user.Username), user)
+	return m.saveEntity(userKey(user.BareJID()), user)
 }
 
 // DeleteUser deletes a user entity from storage.
-func (m *User) DeleteUser(_ context.Context, username string) error {
-	return m.deleteKey(userKey(username))
+func (m *User) DeleteUser(_ context.Context, userJID string) error {
+	return m.deleteKey(userKey(userJID))
 }
 
 // FetchUser retrieves from storage a user entity.
-func (m *User) FetchUser(_ context.Context, username string) (*model.User, error) {
+func (m *User) FetchUser(_ context.Context, userJID string) (*model.User, error) {
 	var user model.User
-	ok, err := m.getEntity(userKey(username), &user)
+	ok, err := m.getEntity(userKey(userJID), &user)
 	switch err {
 	case nil:
 		if ok {
@@ -47,10 +47,10 @@ func (m *User) FetchUser(_ context.Context, username string) (*model.User, error
 }
 
 // UserExists returns whether or not a user exists within storage.
-func (m *User) UserExists(_ context.Context, username string) (bool, error) {
-	return m.keyExists(userKey(username))
+func (m *User) UserExists(_ context.Context, userJID string) (bool, error) {
+	return m.keyExists(userKey(userJID))
 }
 
-func userKey(username string) string {
-	return "users:" + username
+func userKey(userJID string) string {
+	return "users:" + userJID
 }
@@ -65,3 +65,21 @@ func TestMemoryStorage_DeleteUser(t *testing.T) {
 	usr, _ := s.FetchUser(context.Background(), "ortuman")
 	require.Nil(t, usr)
 }
+
+func TestMemoryStorage_UserDomainIsolation(t *testing.T) {
+	s := NewUser()
+	_ = s.UpsertUser(context.Background(), &model.User{Username: "alice", Domain: "a.example", Password: "1234"})
+	_ = s.UpsertUser(context.Background(), &model.User{Username: "alice", Domain: "b.example", Password: "5678"})
+
+	usr, _ := s.FetchUser(context.Background(), "alice@a.example")
+	require.NotNil(t, usr)
+	require.Equal(t, "a.example", usr.Domain)
+	require.Equal(t, "1234", usr.Password)
+
+	require.Nil(t, s.DeleteUser(context.Background(), "alice@b.example"))
+
+	ok, _ := s.UserExists(context.Background(), "alice@a.example")
+	require.True(t, ok)
+	ok, _ = s.UserExists(context.Background(), "alice@b.example")
+	require.False(t, ok)
+}
@@ -27,22 +27,22 @@ func (s *mySQLBlockList) InsertBlockListItem(ctx context.Context, item *model.Bl
 	_, err := sq.Insert("blocklist_items").
 		Options("IGNORE").
 		Columns("username", "jid", "created_at").
-		Values(item.Username, item.JID, nowExpr).
+		Values(item.UserJID(), item.JID, nowExpr).
 		RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
 func (s *mySQLBlockList) DeleteBlockListItem(ctx context.Context, item *model.BlockListItem) error {
 	_, err := sq.Delete("blocklist_items").
-		Where(sq.And{sq.Eq{"username": item.Username}, sq.Eq{"jid": item.JID}}).
+		Where(sq.And{sq.Eq{"username": item.UserJID()}, sq.Eq{"jid": item.JID}}).
 		RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
-func (s *mySQLBlockList) FetchBlockListItems(ctx context.Context, username string) ([]model.BlockListItem, error) {
+func (s *mySQLBlockList) FetchBlockListItems(ctx context.Context, userJID string) ([]model.BlockListItem, error) {
 	q := sq.Select("username", "jid").
 		From("blocklist_items").
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"username": userJID}).
 		OrderBy("created_at")
 
 	rows, err := q.RunWith(s.db).QueryContext(ctx)
@@ -57,9 +57,11 @@ func scanBlockListItemEntities(scanner rowsScanner) ([]model.BlockListItem, erro
 	var ret []model.BlockListItem
 	for scanner.Next() {
 		var it model.BlockListItem
-		if err := scanner.Scan(&it.Username, &it.JID); err != nil {
+		var userJID string
+		if err := scanner.Scan(&userJID, &it.JID); err != nil {
 			return nil, err
 		}
+		it.Username, it.Domain = model.SplitBareJID(userJID)
 		ret = append(ret, it)
 	}
 	return ret, nil
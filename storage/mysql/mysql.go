@@ -14,6 +14,7 @@ import (
 	_ "github.com/go-sql-driver/mysql" // SQL driver
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/xmpp/jid"
 )
 
 type mySQLContainer struct {
@@ -25,6 +26,8 @@ type mySQLContainer struct {
 	blockList *mySQLBlockList
 	pubSub    *mySQLPubSub
 	offline   *mySQLOffline
+	shGroups  *mySQLSharedGroups
+	invs      *mySQLInvitations
 
 	h      *sql.DB
 	doneCh chan chan bool
@@ -60,18 +63,26 @@ func New(cfg *Config) (repository.Container, error) {
 	c.blockList = newBlockList(c.h)
 	c.pubSub = newPubSub(c.h)
 	c.offline = newOffline(c.h)
+	c.shGroups = newSharedGroups(c.h)
+	c.invs = newInvitations(c.h)
 
 	return c, nil
 }
 
-func (c *mySQLContainer) User() repository.User           { return c.user }
-func (c *mySQLContainer) Roster() repository.Roster       { return c.roster }
-func (c *mySQLContainer) Presences() repository.Presences { return c.presences }
-func (c *mySQLContainer) VCard() repository.VCard         { return c.vCard }
-func (c *mySQLContainer) Private() repository.Private     { return c.priv }
-func (c *mySQLContainer) BlockList() repository.BlockList { return c.blockList }
-func (c *mySQLContainer) PubSub() repository.PubSub       { return c.pubSub }
-func (c *mySQLContainer) Offline() repository.Offline     { return c.offline }
+func (c *mySQLContainer) User() repository.User                 { return c.user }
+func (c *mySQLContainer) Roster() repository.Roster             { return c.roster }
+func (c *mySQLContainer) Presences() repository.Presences       { return c.presences }
+func (c *mySQLContainer) VCard() repository.VCard               { return c.vCard }
+func (c *mySQLContainer) Private() repository.Private           { return c.priv }
+func (c *mySQLContainer) BlockList() repository.BlockList       { return c.blockList }
+func (c *mySQLContainer) PubSub() repository.PubSub             { return c.pubSub }
+func (c *mySQLContainer) Offline() repository.Offline           { return c.offline }
+func (c *mySQLContainer) SharedGroups() repository.SharedGroups { return c.shGroups }
+func (c *mySQLContainer) Invitations() repository.Invitations   { return c.invs }
+
+func (c *mySQLContainer) DeleteAccount(ctx context.Context, userJID *jid.JID) error {
+	return c.user.deleteAccount(ctx, userJID)
+}
 
 func (c *mySQLContainer) Close(ctx context.Context) error {
 	ch := make(chan bool)
@@ -27,18 +27,18 @@ func newOffline(db *sql.DB) *mySQLOffline {
 	}
 }
 
-func (s *mySQLOffline) InsertOfflineMessage(ctx context.Context, message *xmpp.Message, username string) error {
+func (s *mySQLOffline) InsertOfflineMessage(ctx context.Context, message *xmpp.Message, userJID string) error {
 	q := sq.Insert("offline_messages").
 		Columns("username", "data", "created_at").
-		Values(username, message.String(), nowExpr)
+		Values(userJID, message.String(), nowExpr)
 	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
-func (s *mySQLOffline) CountOfflineMessages(ctx context.Context, username string) (int, error) {
+func (s *mySQLOffline) CountOfflineMessages(ctx context.Context, userJID string) (int, error) {
 	q := sq.Select("COUNT(*)").
 		From("offline_messages").
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"username": userJID}).
 		OrderBy("created_at")
 
 	var count int
@@ -51,10 +51,10 @@ func (s *mySQLOffline) CountOfflineMessages(ctx context.Context, username string
 	}
 }
 
-func (s *mySQLOffline) FetchOfflineMessages(ctx context.Context, username string) ([]xmpp.Message, error) {
+func (s *mySQLOffline) FetchOfflineMessages(ctx context.Context, userJID string) ([]xmpp.Message, error) {
 	q := sq.Select("data").
 		From("offline_messages").
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"username": userJID}).
 		OrderBy("created_at")
 
 	rows, err := q.RunWith(s.db).QueryContext(ctx)
@@ -97,8 +97,8 @@ func (s *mySQLOffline) FetchOfflineMessages(ctx context.Context, username string
 	return messages, nil
 }
 
-func (s *mySQLOffline) DeleteOfflineMessages(ctx context.Context, username string) error {
-	q := sq.Delete("offline_messages").Where(sq.Eq{"username": username})
+func (s *mySQLOffline) DeleteOfflineMessages(ctx context.Context, userJID string) error {
+	q := sq.Delete("offline_messages").Where(sq.Eq{"username": userJID})
 	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
@@ -26,7 +26,7 @@ func newPrivate(db *sql.DB) *mySQLPrivate {
 	}
 }
 
-func (s *mySQLPrivate) UpsertPrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, username string) error {
+func (s *mySQLPrivate) UpsertPrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, userJID string) error {
 	buf := s.pool.Get()
 	defer s.pool.Put(buf)
 	for _, elem := range privateXML {
@@ -38,17 +38,17 @@ func (s *mySQLPrivate) UpsertPrivateXML(ctx context.Context, privateXML []xmpp.X
 
 	q := sq.Insert("private_storage").
 		Columns("username", "namespace", "data", "updated_at", "created_at").
-		Values(username, namespace, rawXML, nowExpr, nowExpr).
+		Values(userJID, namespace, rawXML, nowExpr, nowExpr).
 		Suffix("ON DUPLICATE KEY UPDATE data = ?, updated_at = NOW()", rawXML)
 
 	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
-func (s *mySQLPrivate) FetchPrivateXML(ctx context.Context, namespace string, username string) ([]xmpp.XElement, error) {
+func (s *mySQLPrivate) FetchPrivateXML(ctx context.Context, namespace string, userJID string) ([]xmpp.XElement, error) {
 	q := sq.Select("data").
 		From("private_storage").
-		Where(sq.And{sq.Eq{"username": username}, sq.Eq{"namespace": namespace}})
+		Where(sq.And{sq.Eq{"username": userJID}, sq.Eq{"namespace": namespace}})
 
 	var privateXML string
 	err := q.RunWith(s.db).QueryRowContext(ctx).Scan(&privateXML)
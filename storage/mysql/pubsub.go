@@ -9,9 +9,12 @@ import (
 	"context"
 	"database/sql"
 	"strings"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
+	"github.com/ortuman/jackal/storage/repository"
 	"github.com/ortuman/jackal/xmpp"
 )
 
@@ -25,6 +28,11 @@ func newPubSub(db *sql.DB) *mySQLPubSub {
 	}
 }
 
+// NewPubSub returns a MySQL pubsub repository running its queries against db.
+func NewPubSub(db *sql.DB) repository.PubSub {
+	return newPubSub(db)
+}
+
 func (s *mySQLPubSub) FetchHosts(ctx context.Context) ([]string, error) {
 	rows, err := sq.Select("DISTINCT(host)").
 		From("pubsub_nodes").
@@ -279,7 +287,7 @@ func (s *mySQLPubSub) UpsertNodeItem(ctx context.Context, item *pubsubmodel.Item
 }
 
 func (s *mySQLPubSub) FetchNodeItems(ctx context.Context, host, name string) ([]pubsubmodel.Item, error) {
-	rows, err := sq.Select("item_id", "publisher", "payload").
+	rows, err := sq.Select("item_id", "publisher", "payload", "updated_at").
 		From("pubsub_items").
 		Where("node_id = (SELECT id FROM pubsub_nodes WHERE host = ? AND name = ?)", host, name).
 		OrderBy("created_at").
@@ -292,10 +300,104 @@ func (s *mySQLPubSub) FetchNodeItems(ctx context.Context, host, name string) ([]
 	return scanPubSubNodeItems(rows)
 }
 
+func (s *mySQLPubSub) FetchNodeItemsPage(ctx context.Context, host, name string, req *rsmmodel.Request) ([]pubsubmodel.Item, *rsmmodel.Result, error) {
+	nodeExpr := sq.Expr("node_id = (SELECT id FROM pubsub_nodes WHERE host = ? AND name = ?)", host, name)
+
+	var count int
+	err := sq.Select("COUNT(*)").
+		From("pubsub_items").
+		Where(nodeExpr).
+		RunWith(s.db).QueryRowContext(ctx).Scan(&count)
+	if err != nil {
+		return nil, nil, err
+	}
+	max := req.Max
+	if max < 0 {
+		max = count
+	}
+	// items are paged using (created_at, item_id) as keyset
+	q := sq.Select("item_id", "publisher", "payload", "updated_at").
+		From("pubsub_items").
+		Where(nodeExpr).
+		Limit(uint64(max))
+
+	var firstIndex int
+	var reversed bool
+	switch {
+	case len(req.After) > 0:
+		pos, err := s.countNodeItemsUpTo(ctx, host, name, req.After)
+		if err != nil {
+			return nil, nil, err
+		}
+		q = q.Where(nodeItemKeysetExpr(">", host, name, req.After)).OrderBy("created_at", "item_id")
+		firstIndex = pos
+
+	case len(req.Before) > 0:
+		pos, err := s.countNodeItemsUpTo(ctx, host, name, req.Before)
+		if err != nil {
+			return nil, nil, err
+		}
+		q = q.Where(nodeItemKeysetExpr("<", host, name, req.Before)).OrderBy("created_at DESC", "item_id DESC")
+		firstIndex = pos - 1
+		reversed = true
+
+	case req.LastPage:
+		q = q.OrderBy("created_at DESC", "item_id DESC")
+		firstIndex = count
+		reversed = true
+
+	default:
+		q = q.OrderBy("created_at", "item_id").Offset(uint64(req.Index))
+		firstIndex = req.Index
+	}
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	items, err := scanPubSubNodeItems(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reversed {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+		firstIndex -= len(items)
+	}
+	res := &rsmmodel.Result{Count: count}
+	if len(items) > 0 {
+		res.First = items[0].ID
+		res.FirstIndex = firstIndex
+		res.Last = items[len(items)-1].ID
+	}
+	return items, res, nil
+}
+
+// countNodeItemsUpTo returns the number of node items preceding a given one, including itself.
+func (s *mySQLPubSub) countNodeItemsUpTo(ctx context.Context, host, name, itemID string) (int, error) {
+	var count int
+	err := sq.Select("COUNT(*)").
+		From("pubsub_items").
+		Where(sq.And{
+			sq.Expr("node_id = (SELECT id FROM pubsub_nodes WHERE host = ? AND name = ?)", host, name),
+			nodeItemKeysetExpr("<=", host, name, itemID),
+		}).
+		RunWith(s.db).QueryRowContext(ctx).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, rsmmodel.ErrPageNotFound // anchor item not found
+	}
+	return count, nil
+}
+
 func (s *mySQLPubSub) FetchNodeItemsWithIDs(ctx context.Context, host, name string, identifiers []string) ([]pubsubmodel.Item, error) {
-	rows, err := sq.Select("item_id", "publisher", "payload").
+	rows, err := sq.Select("item_id", "publisher", "payload", "updated_at").
 		From("pubsub_items").
-		Where(sq.And{sq.Expr("node_id = (SELECT id FROM pubsub_nodes WHERE host = ? AND name = ?)", host, name), sq.Eq{"id": identifiers}}).
+		Where(sq.And{sq.Expr("node_id = (SELECT id FROM pubsub_nodes WHERE host = ? AND name = ?)", host, name), sq.Eq{"item_id": identifiers}}).
 		OrderBy("created_at").
 		RunWith(s.db).QueryContext(ctx)
 	if err != nil {
@@ -307,7 +409,7 @@ func (s *mySQLPubSub) FetchNodeItemsWithIDs(ctx context.Context, host, name stri
 }
 
 func (s *mySQLPubSub) FetchNodeLastItem(ctx context.Context, host, name string) (*pubsubmodel.Item, error) {
-	row := sq.Select("item_id", "publisher", "payload").
+	row := sq.Select("item_id", "publisher", "payload", "updated_at").
 		From("pubsub_items").
 		Where("node_id = (SELECT id FROM pubsub_nodes WHERE host = ? AND name = ?)", host, name).
 		OrderBy("created_at DESC").
@@ -325,6 +427,47 @@ func (s *mySQLPubSub) FetchNodeLastItem(ctx context.Context, host, name string)
 	}
 }
 
+func (s *mySQLPubSub) DeleteNodeItem(ctx context.Context, host, name, identifier string) error {
+	_, err := sq.Delete("pubsub_items").
+		Where("item_id = ? AND node_id = (SELECT id FROM pubsub_nodes WHERE host = ? AND name = ?)", identifier, host, name).
+		RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+func (s *mySQLPubSub) FetchExpiredNodeItems(ctx context.Context, name string, publishedBefore time.Time) (map[string][]string, error) {
+	rows, err := sq.Select("n.host", "i.item_id").
+		From("pubsub_items i").
+		Join("pubsub_nodes n ON i.node_id = n.id").
+		Where("i.updated_at < ? AND n.name = ?", publishedBefore, name).
+		RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	ret := make(map[string][]string)
+	for rows.Next() {
+		var host, itemID string
+		if err := rows.Scan(&host, &itemID); err != nil {
+			return nil, err
+		}
+		ret[host] = append(ret[host], itemID)
+	}
+	return ret, nil
+}
+
+func (s *mySQLPubSub) FetchHostItemsSize(ctx context.Context, host string) (int, error) {
+	var size int
+	err := sq.Select("COALESCE(SUM(OCTET_LENGTH(payload)), 0)").
+		From("pubsub_items").
+		Where("node_id IN (SELECT id FROM pubsub_nodes WHERE host = ?)", host).
+		RunWith(s.db).QueryRowContext(ctx).Scan(&size)
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
 func (s *mySQLPubSub) UpsertNodeAffiliation(ctx context.Context, affiliation *pubsubmodel.Affiliation, host, name string) error {
 	return s.inTransaction(ctx, func(tx *sql.Tx) error {
 
@@ -494,6 +637,10 @@ func scanPubSubNodeSubscriptions(scanner rowsScanner) ([]pubsubmodel.Subscriptio
 	return subscriptions, nil
 }
 
+func nodeItemKeysetExpr(op, host, name, itemID string) sq.Sqlizer {
+	return sq.Expr("(created_at, item_id) "+op+" (SELECT created_at, item_id FROM pubsub_items WHERE node_id = (SELECT id FROM pubsub_nodes WHERE host = ? AND name = ?) AND item_id = ?)", host, name, itemID)
+}
+
 func scanPubSubNodeItems(scanner rowsScanner) ([]pubsubmodel.Item, error) {
 	var items []pubsubmodel.Item
 
@@ -512,7 +659,7 @@ func scanPubSubNodeItem(scanner rowScanner) (*pubsubmodel.Item, error) {
 	var item pubsubmodel.Item
 	var err error
 
-	if err = scanner.Scan(&item.ID, &item.Publisher, &payload); err != nil {
+	if err = scanner.Scan(&item.ID, &item.Publisher, &payload, &item.PublishedAt); err != nil {
 		return nil, err
 	}
 	parser := xmpp.NewParser(strings.NewReader(payload), xmpp.DefaultMode, 0)
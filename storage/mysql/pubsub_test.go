@@ -8,10 +8,12 @@ package mysql
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/stretchr/testify/require"
 )
@@ -247,11 +249,11 @@ func TestMySQLUpsertPubSubNodeItem(t *testing.T) {
 
 func TestMySQLFetchPubSubNodeItems(t *testing.T) {
 	s, mock := newPubSubMock()
-	rows := sqlmock.NewRows([]string{"item_id", "publisher", "payload"})
-	rows.AddRow("1234", "ortuman@jackal.im", "<message/>")
-	rows.AddRow("5678", "noelia@jackal.im", "<iq type='get'/>")
+	rows := sqlmock.NewRows([]string{"item_id", "publisher", "payload", "updated_at"})
+	rows.AddRow("1234", "ortuman@jackal.im", "<message/>", time.Now())
+	rows.AddRow("5678", "noelia@jackal.im", "<iq type='get'/>", time.Now())
 
-	mock.ExpectQuery("SELECT item_id, publisher, payload FROM pubsub_items WHERE node_id = (.+)").
+	mock.ExpectQuery("SELECT item_id, publisher, payload, updated_at FROM pubsub_items WHERE node_id = (.+)").
 		WithArgs("ortuman@jackal.im", "princely_musings").
 		WillReturnRows(rows)
 
@@ -266,7 +268,7 @@ func TestMySQLFetchPubSubNodeItems(t *testing.T) {
 
 	// error case
 	s, mock = newPubSubMock()
-	mock.ExpectQuery("SELECT item_id, publisher, payload FROM pubsub_items WHERE node_id = (.+)").
+	mock.ExpectQuery("SELECT item_id, publisher, payload, updated_at FROM pubsub_items WHERE node_id = (.+)").
 		WithArgs("ortuman@jackal.im", "princely_musings").
 		WillReturnError(errMySQLStorage)
 
@@ -280,13 +282,13 @@ func TestMySQLFetchPubSubNodeItems(t *testing.T) {
 
 func TestMySQLFetchPubSubNodeItemsWithID(t *testing.T) {
 	s, mock := newPubSubMock()
-	rows := sqlmock.NewRows([]string{"item_id", "publisher", "payload"})
-	rows.AddRow("1234", "ortuman@jackal.im", "<message/>")
-	rows.AddRow("5678", "noelia@jackal.im", "<iq type='get'/>")
+	rows := sqlmock.NewRows([]string{"item_id", "publisher", "payload", "updated_at"})
+	rows.AddRow("1234", "ortuman@jackal.im", "<message/>", time.Now())
+	rows.AddRow("5678", "noelia@jackal.im", "<iq type='get'/>", time.Now())
 
 	identifiers := []string{"1234", "5678"}
 
-	mock.ExpectQuery("SELECT item_id, publisher, payload FROM pubsub_items WHERE (.+ IN (.+)) ORDER BY created_at").
+	mock.ExpectQuery("SELECT item_id, publisher, payload, updated_at FROM pubsub_items WHERE \\(node_id = \\(SELECT id FROM pubsub_nodes WHERE host = \\? AND name = \\?\\) AND item_id IN \\(\\?,\\?\\)\\) ORDER BY created_at").
 		WithArgs("ortuman@jackal.im", "princely_musings", "1234", "5678").
 		WillReturnRows(rows)
 
@@ -301,7 +303,7 @@ func TestMySQLFetchPubSubNodeItemsWithID(t *testing.T) {
 
 	// error case
 	s, mock = newPubSubMock()
-	mock.ExpectQuery("SELECT item_id, publisher, payload FROM pubsub_items WHERE (.+ IN (.+)) ORDER BY created_at").
+	mock.ExpectQuery("SELECT item_id, publisher, payload, updated_at FROM pubsub_items WHERE \\(node_id = \\(SELECT id FROM pubsub_nodes WHERE host = \\? AND name = \\?\\) AND item_id IN \\(\\?,\\?\\)\\) ORDER BY created_at").
 		WithArgs("ortuman@jackal.im", "princely_musings", "1234", "5678").
 		WillReturnError(errMySQLStorage)
 
@@ -313,6 +315,79 @@ func TestMySQLFetchPubSubNodeItemsWithID(t *testing.T) {
 	require.Equal(t, errMySQLStorage, err)
 }
 
+func TestMySQLFetchPubSubNodeItemsPage(t *testing.T) {
+	s, mock := newPubSubMock()
+	rows := sqlmock.NewRows([]string{"item_id", "publisher", "payload", "updated_at"})
+	rows.AddRow("5678", "noelia@jackal.im", "<iq type='get'/>", time.Now())
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM pubsub_items WHERE node_id = (.+)").
+		WithArgs("ortuman@jackal.im", "princely_musings").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM pubsub_items WHERE \\(node_id = (.+) AND \\(created_at, item_id\\) <= (.+)\\)").
+		WithArgs("ortuman@jackal.im", "princely_musings", "ortuman@jackal.im", "princely_musings", "1234").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT item_id, publisher, payload, updated_at FROM pubsub_items WHERE node_id = (.+) AND \\(created_at, item_id\\) > (.+) ORDER BY created_at, item_id LIMIT 1").
+		WithArgs("ortuman@jackal.im", "princely_musings", "ortuman@jackal.im", "princely_musings", "1234").
+		WillReturnRows(rows)
+
+	items, res, err := s.FetchNodeItemsPage(context.Background(), "ortuman@jackal.im", "princely_musings", &rsmmodel.Request{Max: 1, After: "1234"})
+
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "5678", items[0].ID)
+	require.Equal(t, &rsmmodel.Result{First: "5678", FirstIndex: 1, Last: "5678", Count: 3}, res)
+
+	// last page
+	s, mock = newPubSubMock()
+	rows = sqlmock.NewRows([]string{"item_id", "publisher", "payload", "updated_at"})
+	rows.AddRow("9012", "noelia@jackal.im", "<iq type='get'/>", time.Now())
+	rows.AddRow("5678", "noelia@jackal.im", "<iq type='get'/>", time.Now())
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM pubsub_items WHERE node_id = (.+)").
+		WithArgs("ortuman@jackal.im", "princely_musings").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT item_id, publisher, payload, updated_at FROM pubsub_items WHERE node_id = (.+) ORDER BY created_at DESC, item_id DESC LIMIT 2").
+		WithArgs("ortuman@jackal.im", "princely_musings").
+		WillReturnRows(rows)
+
+	items, res, err = s.FetchNodeItemsPage(context.Background(), "ortuman@jackal.im", "princely_musings", &rsmmodel.Request{Max: 2, LastPage: true})
+
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	require.Nil(t, err)
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "5678", items[0].ID)
+	require.Equal(t, "9012", items[1].ID)
+	require.Equal(t, &rsmmodel.Result{First: "5678", FirstIndex: 1, Last: "9012", Count: 3}, res)
+
+	// page not found
+	s, mock = newPubSubMock()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM pubsub_items WHERE node_id = (.+)").
+		WithArgs("ortuman@jackal.im", "princely_musings").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM pubsub_items WHERE \\(node_id = (.+) AND \\(created_at, item_id\\) <= (.+)\\)").
+		WithArgs("ortuman@jackal.im", "princely_musings", "ortuman@jackal.im", "princely_musings", "5678").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	_, _, err = s.FetchNodeItemsPage(context.Background(), "ortuman@jackal.im", "princely_musings", &rsmmodel.Request{Max: 1, After: "5678"})
+
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, rsmmodel.ErrPageNotFound, err)
+
+	// error case
+	s, mock = newPubSubMock()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM pubsub_items WHERE node_id = (.+)").
+		WithArgs("ortuman@jackal.im", "princely_musings").
+		WillReturnError(errMySQLStorage)
+
+	_, _, err = s.FetchNodeItemsPage(context.Background(), "ortuman@jackal.im", "princely_musings", &rsmmodel.Request{Max: 1})
+
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
 func TestMySQLUpsertPubSubNodeAffiliation(t *testing.T) {
 	s, mock := newPubSubMock()
 
@@ -391,6 +466,96 @@ func TestPgSQLDeletePubSubNodeAffiliation(t *testing.T) {
 	require.Equal(t, errMySQLStorage, err)
 }
 
+func TestMySQLDeletePubSubNodeItem(t *testing.T) {
+	s, mock := newPubSubMock()
+	mock.ExpectExec("DELETE FROM pubsub_items WHERE (.+)").
+		WithArgs("i1", "ortuman@jackal.im", "princely_musings").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.DeleteNodeItem(context.Background(), "ortuman@jackal.im", "princely_musings", "i1")
+
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	require.Nil(t, err)
+
+	// error case
+	s, mock = newPubSubMock()
+	mock.ExpectExec("DELETE FROM pubsub_items WHERE (.+)").
+		WithArgs("i1", "ortuman@jackal.im", "princely_musings").
+		WillReturnError(errMySQLStorage)
+
+	err = s.DeleteNodeItem(context.Background(), "ortuman@jackal.im", "princely_musings", "i1")
+
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	require.NotNil(t, err)
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLFetchExpiredPubSubNodeItems(t *testing.T) {
+	publishedBefore := time.Now()
+
+	s, mock := newPubSubMock()
+	rows := sqlmock.NewRows([]string{"host", "item_id"})
+	rows.AddRow("ortuman@jackal.im", "1234")
+	rows.AddRow("ortuman@jackal.im", "5678")
+	rows.AddRow("noelia@jackal.im", "9012")
+
+	mock.ExpectQuery("SELECT n.host, i.item_id FROM pubsub_items i JOIN pubsub_nodes n ON i.node_id = n.id WHERE (.+)").
+		WithArgs(publishedBefore, "http://jabber.org/protocol/geoloc").
+		WillReturnRows(rows)
+
+	expired, err := s.FetchExpiredNodeItems(context.Background(), "http://jabber.org/protocol/geoloc", publishedBefore)
+
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	require.Nil(t, err)
+	require.Equal(t, map[string][]string{
+		"ortuman@jackal.im": {"1234", "5678"},
+		"noelia@jackal.im":  {"9012"},
+	}, expired)
+
+	// error case
+	s, mock = newPubSubMock()
+	mock.ExpectQuery("SELECT n.host, i.item_id FROM pubsub_items i JOIN pubsub_nodes n ON i.node_id = n.id WHERE (.+)").
+		WithArgs(publishedBefore, "http://jabber.org/protocol/geoloc").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchExpiredNodeItems(context.Background(), "http://jabber.org/protocol/geoloc", publishedBefore)
+
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	require.NotNil(t, err)
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLFetchPubSubHostItemsSize(t *testing.T) {
+	s, mock := newPubSubMock()
+	mock.ExpectQuery("SELECT COALESCE(.+) FROM pubsub_items WHERE (.+)").
+		WithArgs("ortuman@jackal.im").
+		WillReturnRows(sqlmock.NewRows([]string{"size"}).AddRow(1024))
+
+	size, err := s.FetchHostItemsSize(context.Background(), "ortuman@jackal.im")
+
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	require.Nil(t, err)
+	require.Equal(t, 1024, size)
+
+	// error case
+	s, mock = newPubSubMock()
+	mock.ExpectQuery("SELECT COALESCE(.+) FROM pubsub_items WHERE (.+)").
+		WithArgs("ortuman@jackal.im").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchHostItemsSize(context.Background(), "ortuman@jackal.im")
+
+	require.Nil(t, mock.ExpectationsWereMet())
+
+	require.NotNil(t, err)
+	require.Equal(t, errMySQLStorage, err)
+}
+
 func TestMySQLUpsertPubSubNodeSubscription(t *testing.T) {
 	s, mock := newPubSubMock()
 
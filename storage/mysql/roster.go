@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
 	rostermodel "github.com/ortuman/jackal/model/roster"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
@@ -33,7 +34,7 @@ func (s *mySQLRoster) UpsertRosterItem(ctx context.Context, ri *rostermodel.Item
 	err := s.inTransaction(ctx, func(tx *sql.Tx) error {
 		q := sq.Insert("roster_versions").
 			Columns("username", "created_at", "updated_at").
-			Values(ri.Username, nowExpr, nowExpr).
+			Values(ri.UserJID(), nowExpr, nowExpr).
 			Suffix("ON DUPLICATE KEY UPDATE ver = ver + 1, updated_at = NOW()")
 		if _, err := q.RunWith(tx).ExecContext(ctx); err != nil {
 			return err
@@ -43,18 +44,18 @@ func (s *mySQLRoster) UpsertRosterItem(ctx context.Context, ri *rostermodel.Item
 			return err
 		}
 
-		verExpr := sq.Expr("(SELECT ver FROM roster_versions WHERE username = ?)", ri.Username)
+		verExpr := sq.Expr("(SELECT ver FROM roster_versions WHERE username = ?)", ri.UserJID())
 		q = sq.Insert("roster_items").
-			Columns("username", "jid", "name", "subscription", "`groups`", "ask", "ver", "created_at", "updated_at").
-			Values(ri.Username, ri.JID, ri.Name, ri.Subscription, groupsBytes, ri.Ask, verExpr, nowExpr, nowExpr).
-			Suffix("ON DUPLICATE KEY UPDATE name = ?, subscription = ?, `groups` = ?, ask = ?, ver = ver + 1, updated_at = NOW()", ri.Name, ri.Subscription, groupsBytes, ri.Ask)
+			Columns("username", "jid", "name", "subscription", "`groups`", "ask", "approved", "ver", "created_at", "updated_at").
+			Values(ri.UserJID(), ri.JID, ri.Name, ri.Subscription, groupsBytes, ri.Ask, ri.Approved, verExpr, nowExpr, nowExpr).
+			Suffix("ON DUPLICATE KEY UPDATE name = ?, subscription = ?, `groups` = ?, ask = ?, approved = ?, ver = ver + 1, updated_at = NOW()", ri.Name, ri.Subscription, groupsBytes, ri.Ask, ri.Approved)
 		_, err = q.RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
 		// delete previous groups
 		_, err = sq.Delete("roster_groups").
-			Where(sq.And{sq.Eq{"username": ri.Username}, sq.Eq{"jid": ri.JID}}).
+			Where(sq.And{sq.Eq{"username": ri.UserJID()}, sq.Eq{"jid": ri.JID}}).
 			RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
@@ -63,15 +64,18 @@ func (s *mySQLRoster) UpsertRosterItem(ctx context.Context, ri *rostermodel.Item
 		for _, group := range ri.Groups {
 			q = sq.Insert("roster_groups").
 				Columns("username", "jid", "`group`", "created_at", "updated_at").
-				Values(ri.Username, ri.JID, group, nowExpr, nowExpr)
+				Values(ri.UserJID(), ri.JID, group, nowExpr, nowExpr)
 			_, err := q.RunWith(tx).ExecContext(ctx)
 			if err != nil {
 				return err
 			}
 		}
 		// fetch new roster version
-		ver, err = fetchRosterVer(ctx, ri.Username, tx)
-		return err
+		ver, err = fetchRosterVer(ctx, ri.UserJID(), tx)
+		if err != nil {
+			return err
+		}
+		return upsertRosterChange(ctx, ri.UserJID(), ri.JID, ver.Ver, tx)
 	})
 	if err != nil {
 		return rostermodel.Version{}, err
@@ -79,36 +83,39 @@ func (s *mySQLRoster) UpsertRosterItem(ctx context.Context, ri *rostermodel.Item
 	return ver, nil
 }
 
-func (s *mySQLRoster) DeleteRosterItem(ctx context.Context, username, jid string) (rostermodel.Version, error) {
+func (s *mySQLRoster) DeleteRosterItem(ctx context.Context, userJID, jid string) (rostermodel.Version, error) {
 	var ver rostermodel.Version
 
 	err := s.inTransaction(ctx, func(tx *sql.Tx) error {
 		q := sq.Insert("roster_versions").
 			Columns("username", "created_at", "updated_at").
-			Values(username, nowExpr, nowExpr).
-			Suffix("ON DUPLICATE KEY UPDATE ver = ver + 1, last_deletion_ver = ver, updated_at = NOW()")
+			Values(userJID, nowExpr, nowExpr).
+			Suffix("ON DUPLICATE KEY UPDATE ver = ver + 1, updated_at = NOW()")
 
 		if _, err := q.RunWith(tx).ExecContext(ctx); err != nil {
 			return err
 		}
 		// delete groups
 		_, err := sq.Delete("roster_groups").
-			Where(sq.And{sq.Eq{"username": username}, sq.Eq{"jid": jid}}).
+			Where(sq.And{sq.Eq{"username": userJID}, sq.Eq{"jid": jid}}).
 			RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
 		// delete items
 		_, err = sq.Delete("roster_items").
-			Where(sq.And{sq.Eq{"username": username}, sq.Eq{"jid": jid}}).
+			Where(sq.And{sq.Eq{"username": userJID}, sq.Eq{"jid": jid}}).
 			RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
 
 		// fetch new roster version
-		ver, err = fetchRosterVer(ctx, username, tx)
-		return err
+		ver, err = fetchRosterVer(ctx, userJID, tx)
+		if err != nil {
+			return err
+		}
+		return upsertRosterChange(ctx, userJID, jid, ver.Ver, tx)
 	})
 	if err != nil {
 		return rostermodel.Version{}, err
@@ -116,10 +123,10 @@ func (s *mySQLRoster) DeleteRosterItem(ctx context.Context, username, jid string
 	return ver, nil
 }
 
-func (s *mySQLRoster) FetchRosterItems(ctx context.Context, username string) ([]rostermodel.Item, rostermodel.Version, error) {
-	q := sq.Select("username", "jid", "name", "subscription", "`groups`", "ask", "ver").
+func (s *mySQLRoster) FetchRosterItems(ctx context.Context, userJID string) ([]rostermodel.Item, rostermodel.Version, error) {
+	q := sq.Select("username", "jid", "name", "subscription", "`groups`", "ask", "approved", "ver").
 		From("roster_items").
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"username": userJID}).
 		OrderBy("created_at DESC")
 
 	rows, err := q.RunWith(s.db).QueryContext(ctx)
@@ -132,18 +139,18 @@ func (s *mySQLRoster) FetchRosterItems(ctx context.Context, username string) ([]
 	if err != nil {
 		return nil, rostermodel.Version{}, err
 	}
-	ver, err := fetchRosterVer(ctx, username, s.db)
+	ver, err := fetchRosterVer(ctx, userJID, s.db)
 	if err != nil {
 		return nil, rostermodel.Version{}, err
 	}
 	return items, ver, nil
 }
 
-func (s *mySQLRoster) FetchRosterItemsInGroups(ctx context.Context, username string, groups []string) ([]rostermodel.Item, rostermodel.Version, error) {
-	q := sq.Select("ris.username", "ris.jid", "ris.name", "ris.subscription", "ris.`groups`", "ris.ask", "ris.ver").
+func (s *mySQLRoster) FetchRosterItemsInGroups(ctx context.Context, userJID string, groups []string) ([]rostermodel.Item, rostermodel.Version, error) {
+	q := sq.Select("ris.username", "ris.jid", "ris.name", "ris.subscription", "ris.`groups`", "ris.ask", "ris.approved", "ris.ver").
 		From("roster_items ris").
 		LeftJoin("roster_groups g ON ris.username = g.username").
-		Where(sq.And{sq.Eq{"ris.username": username}, sq.Eq{"g.group": groups}}).
+		Where(sq.And{sq.Eq{"ris.username": userJID}, sq.Eq{"g.group": groups}}).
 		OrderBy("ris.created_at DESC")
 
 	rows, err := q.RunWith(s.db).QueryContext(ctx)
@@ -156,17 +163,34 @@ func (s *mySQLRoster) FetchRosterItemsInGroups(ctx context.Context, username str
 	if err != nil {
 		return nil, rostermodel.Version{}, err
 	}
-	ver, err := fetchRosterVer(ctx, username, s.db)
+	ver, err := fetchRosterVer(ctx, userJID, s.db)
 	if err != nil {
 		return nil, rostermodel.Version{}, err
 	}
 	return items, ver, nil
 }
 
-func (s *mySQLRoster) FetchRosterItem(ctx context.Context, username, jid string) (*rostermodel.Item, error) {
-	q := sq.Select("username", "jid", "name", "subscription", "`groups`", "ask", "ver").
+func (s *mySQLRoster) FetchRosterChanges(ctx context.Context, userJID string, sinceVer int) ([]rostermodel.Item, error) {
+	// items no longer present in roster are reported as removed
+	q := sq.Select("rc.username", "rc.jid", "IFNULL(ri.name, '')", "IFNULL(ri.subscription, 'remove')", "IFNULL(ri.`groups`, '')", "IFNULL(ri.ask, FALSE)", "IFNULL(ri.approved, FALSE)", "rc.ver").
+		From("roster_changes rc").
+		LeftJoin("roster_items ri ON rc.username = ri.username AND rc.jid = ri.jid").
+		Where(sq.And{sq.Eq{"rc.username": userJID}, sq.Gt{"rc.ver": sinceVer}}).
+		OrderBy("rc.ver")
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	return scanRosterItemEntities(rows)
+}
+
+func (s *mySQLRoster) FetchRosterItem(ctx context.Context, userJID, jid string) (*rostermodel.Item, error) {
+	q := sq.Select("username", "jid", "name", "subscription", "`groups`", "ask", "approved", "ver").
 		From("roster_items").
-		Where(sq.And{sq.Eq{"username": username}, sq.Eq{"jid": jid}})
+		Where(sq.And{sq.Eq{"username": userJID}, sq.Eq{"jid": jid}})
 
 	var ri rostermodel.Item
 	err := scanRosterItemEntity(&ri, q.RunWith(s.db).QueryRowContext(ctx))
@@ -184,16 +208,16 @@ func (s *mySQLRoster) UpsertRosterNotification(ctx context.Context, rn *rostermo
 	presenceXML := rn.Presence.String()
 	q := sq.Insert("roster_notifications").
 		Columns("contact", "jid", "elements", "updated_at", "created_at").
-		Values(rn.Contact, rn.JID, presenceXML, nowExpr, nowExpr).
+		Values(rn.ContactJID(), rn.JID, presenceXML, nowExpr, nowExpr).
 		Suffix("ON DUPLICATE KEY UPDATE elements = ?, updated_at = NOW()", presenceXML)
 	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
-func (s *mySQLRoster) FetchRosterNotifications(ctx context.Context, contact string) ([]rostermodel.Notification, error) {
+func (s *mySQLRoster) FetchRosterNotifications(ctx context.Context, contactJID string) ([]rostermodel.Notification, error) {
 	q := sq.Select("contact", "jid", "elements").
 		From("roster_notifications").
-		Where(sq.Eq{"contact": contact}).
+		Where(sq.Eq{"contact": contactJID}).
 		OrderBy("created_at")
 
 	rows, err := q.RunWith(s.db).QueryContext(ctx)
@@ -213,10 +237,10 @@ func (s *mySQLRoster) FetchRosterNotifications(ctx context.Context, contact stri
 	return ret, nil
 }
 
-func (s *mySQLRoster) FetchRosterNotification(ctx context.Context, contact string, jid string) (*rostermodel.Notification, error) {
+func (s *mySQLRoster) FetchRosterNotification(ctx context.Context, contactJID string, jid string) (*rostermodel.Notification, error) {
 	q := sq.Select("contact", "jid", "elements").
 		From("roster_notifications").
-		Where(sq.And{sq.Eq{"contact": contact}, sq.Eq{"jid": jid}})
+		Where(sq.And{sq.Eq{"contact": contactJID}, sq.Eq{"jid": jid}})
 
 	var rn rostermodel.Notification
 	err := scanRosterNotificationEntity(&rn, q.RunWith(s.db).QueryRowContext(ctx))
@@ -230,16 +254,16 @@ func (s *mySQLRoster) FetchRosterNotification(ctx context.Context, contact strin
 	}
 }
 
-func (s *mySQLRoster) DeleteRosterNotification(ctx context.Context, contact, jid string) error {
-	q := sq.Delete("roster_notifications").Where(sq.And{sq.Eq{"contact": contact}, sq.Eq{"jid": jid}})
+func (s *mySQLRoster) DeleteRosterNotification(ctx context.Context, contactJID, jid string) error {
+	q := sq.Delete("roster_notifications").Where(sq.And{sq.Eq{"contact": contactJID}, sq.Eq{"jid": jid}})
 	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
-func (s *mySQLRoster) FetchRosterGroups(ctx context.Context, username string) ([]string, error) {
+func (s *mySQLRoster) FetchRosterGroups(ctx context.Context, userJID string) ([]string, error) {
 	q := sq.Select("`group`").
 		From("roster_groups").
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"username": userJID}).
 		GroupBy("`group`")
 
 	rows, err := q.RunWith(s.db).QueryContext(ctx)
@@ -259,11 +283,39 @@ func (s *mySQLRoster) FetchRosterGroups(ctx context.Context, username string) ([
 	return groups, nil
 }
 
+func (s *mySQLRoster) UpsertRosterPermission(ctx context.Context, userJID, jid string) error {
+	q := sq.Insert("roster_permissions").
+		Columns("username", "jid", "updated_at", "created_at").
+		Values(userJID, jid, nowExpr, nowExpr).
+		Suffix("ON DUPLICATE KEY UPDATE updated_at = NOW()")
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+func (s *mySQLRoster) DeleteRosterPermission(ctx context.Context, userJID, jid string) error {
+	q := sq.Delete("roster_permissions").Where(sq.And{sq.Eq{"username": userJID}, sq.Eq{"jid": jid}})
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+func (s *mySQLRoster) FetchRosterPermission(ctx context.Context, userJID, jid string) (bool, error) {
+	q := sq.Select("COUNT(*)").
+		From("roster_permissions").
+		Where(sq.And{sq.Eq{"username": userJID}, sq.Eq{"jid": jid}})
+
+	var count int
+	if err := q.RunWith(s.db).QueryRowContext(ctx).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func scanRosterNotificationEntity(rn *rostermodel.Notification, scanner rowScanner) error {
-	var presenceXML string
-	if err := scanner.Scan(&rn.Contact, &rn.JID, &presenceXML); err != nil {
+	var contactJID, presenceXML string
+	if err := scanner.Scan(&contactJID, &rn.JID, &presenceXML); err != nil {
 		return err
 	}
+	rn.Contact, rn.Domain = model.SplitBareJID(contactJID)
 	parser := xmpp.NewParser(strings.NewReader(presenceXML), xmpp.DefaultMode, 0)
 	elem, err := parser.ParseElement()
 	if err != nil {
@@ -276,10 +328,11 @@ func scanRosterNotificationEntity(rn *rostermodel.Notification, scanner rowScann
 }
 
 func scanRosterItemEntity(ri *rostermodel.Item, scanner rowScanner) error {
-	var groupsBytes string
-	if err := scanner.Scan(&ri.Username, &ri.JID, &ri.Name, &ri.Subscription, &groupsBytes, &ri.Ask, &ri.Ver); err != nil {
+	var userJID, groupsBytes string
+	if err := scanner.Scan(&userJID, &ri.JID, &ri.Name, &ri.Subscription, &groupsBytes, &ri.Ask, &ri.Approved, &ri.Ver); err != nil {
 		return err
 	}
+	ri.Username, ri.Domain = model.SplitBareJID(userJID)
 	if len(groupsBytes) > 0 {
 		if err := json.NewDecoder(strings.NewReader(groupsBytes)).Decode(&ri.Groups); err != nil {
 			return err
@@ -300,10 +353,19 @@ func scanRosterItemEntities(scanner rowsScanner) ([]rostermodel.Item, error) {
 	return ret, nil
 }
 
-func fetchRosterVer(ctx context.Context, username string, runner sq.BaseRunner) (rostermodel.Version, error) {
+func upsertRosterChange(ctx context.Context, userJID, jid string, ver int, runner sq.BaseRunner) error {
+	q := sq.Insert("roster_changes").
+		Columns("username", "jid", "ver", "created_at", "updated_at").
+		Values(userJID, jid, ver, nowExpr, nowExpr).
+		Suffix("ON DUPLICATE KEY UPDATE ver = ?, updated_at = NOW()", ver)
+	_, err := q.RunWith(runner).ExecContext(ctx)
+	return err
+}
+
+func fetchRosterVer(ctx context.Context, userJID string, runner sq.BaseRunner) (rostermodel.Version, error) {
 	q := sq.Select("IFNULL(MAX(ver), 0)", "IFNULL(MAX(last_deletion_ver), 0)").
 		From("roster_versions").
-		Where(sq.Eq{"username": username})
+		Where(sq.Eq{"username": userJID})
 
 	var ver rostermodel.Version
 	row := q.RunWith(runner).QueryRowContext(ctx)
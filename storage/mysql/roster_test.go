@@ -37,11 +37,13 @@ func TestMySQLStorageInsertRosterItem(t *testing.T) {
 		ri.Subscription,
 		groupsBytes,
 		ri.Ask,
+		ri.Approved,
 		ri.Username,
 		ri.Name,
 		ri.Subscription,
 		groupsBytes,
 		ri.Ask,
+		ri.Approved,
 	}
 
 	s, mock := newRosterMock()
@@ -71,6 +73,10 @@ func TestMySQLStorageInsertRosterItem(t *testing.T) {
 		WithArgs("user").
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(1, 0))
 
+	mock.ExpectExec("INSERT INTO roster_changes (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("user", "contact@jid", 1, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
 	mock.ExpectCommit()
 
 	_, err := s.UpsertRosterItem(context.Background(), &ri)
@@ -90,6 +96,8 @@ func TestMySQLStorageDeleteRosterItem(t *testing.T) {
 	mock.ExpectQuery("SELECT (.+) FROM roster_versions (.+)").
 		WithArgs("user").
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(1, 0))
+	mock.ExpectExec("INSERT INTO roster_changes (.+)").
+		WithArgs("user", "contact", 1, 1).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
 	_, err := s.DeleteRosterItem(context.Background(), "user", "contact")
@@ -108,12 +116,12 @@ func TestMySQLStorageDeleteRosterItem(t *testing.T) {
 }
 
 func TestMySQLStorageFetchRosterItems(t *testing.T) {
-	var riColumns = []string{"user", "contact", "name", "subscription", "`groups`", "ask", "ver"}
+	var riColumns = []string{"user", "contact", "name", "subscription", "`groups`", "ask", "approved", "ver"}
 
 	s, mock := newRosterMock()
 	mock.ExpectQuery("SELECT (.+) FROM roster_items (.+)").
 		WithArgs("ortuman").
-		WillReturnRows(sqlmock.NewRows(riColumns).AddRow("ortuman", "romeo", "Romeo", "both", "", false, 0))
+		WillReturnRows(sqlmock.NewRows(riColumns).AddRow("ortuman", "romeo", "Romeo", "both", "", false, false, 0))
 	mock.ExpectQuery("SELECT (.+) FROM roster_versions (.+)").
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(0, 0))
@@ -135,7 +143,7 @@ func TestMySQLStorageFetchRosterItems(t *testing.T) {
 	s, mock = newRosterMock()
 	mock.ExpectQuery("SELECT (.+) FROM roster_items (.+)").
 		WithArgs("ortuman", "romeo").
-		WillReturnRows(sqlmock.NewRows(riColumns).AddRow("ortuman", "romeo", "Romeo", "both", "", false, 0))
+		WillReturnRows(sqlmock.NewRows(riColumns).AddRow("ortuman", "romeo", "Romeo", "both", "", false, false, 0))
 
 	_, err = s.FetchRosterItem(context.Background(), "ortuman", "romeo")
 	require.Nil(t, mock.ExpectationsWereMet())
@@ -168,11 +176,11 @@ func TestMySQLStorageFetchRosterItems(t *testing.T) {
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 
-	var riColumns2 = []string{"ris.user", "ris.contact", "ris.name", "ris.subscription", "ris.`groups`", "ris.ask", "ris.ver"}
+	var riColumns2 = []string{"ris.user", "ris.contact", "ris.name", "ris.subscription", "ris.`groups`", "ris.ask", "ris.approved", "ris.ver"}
 	s, mock = newRosterMock()
 	mock.ExpectQuery("SELECT (.+) FROM roster_items ris LEFT JOIN roster_groups g ON ris.username = g.username (.+)").
 		WithArgs("ortuman", "Family").
-		WillReturnRows(sqlmock.NewRows(riColumns2).AddRow("ortuman", "romeo", "Romeo", "both", `["Family"]`, false, 0))
+		WillReturnRows(sqlmock.NewRows(riColumns2).AddRow("ortuman", "romeo", "Romeo", "both", `["Family"]`, false, false, 0))
 	mock.ExpectQuery("SELECT (.+) FROM roster_versions (.+)").
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(0, 0))
@@ -182,6 +190,34 @@ func TestMySQLStorageFetchRosterItems(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestMySQLStorageFetchRosterChanges(t *testing.T) {
+	var rcColumns = []string{"username", "jid", "name", "subscription", "groups", "ask", "approved", "ver"}
+
+	s, mock := newRosterMock()
+	mock.ExpectQuery("SELECT (.+) FROM roster_changes rc LEFT JOIN roster_items ri (.+)").
+		WithArgs("ortuman", 2).
+		WillReturnRows(sqlmock.NewRows(rcColumns).
+			AddRow("ortuman", "romeo", "Romeo", "both", `["Family"]`, false, false, 3).
+			AddRow("ortuman", "juliet", "", "remove", "", false, false, 4))
+
+	ris, err := s.FetchRosterChanges(context.Background(), "ortuman", 2)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Len(t, ris, 2)
+	require.Equal(t, []string{"Family"}, ris[0].Groups)
+	require.Equal(t, rostermodel.SubscriptionRemove, ris[1].Subscription)
+	require.Equal(t, 4, ris[1].Ver)
+
+	s, mock = newRosterMock()
+	mock.ExpectQuery("SELECT (.+) FROM roster_changes (.+)").
+		WithArgs("ortuman", 2).
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchRosterChanges(context.Background(), "ortuman", 2)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
 func TestMySQLStorageInsertRosterNotification(t *testing.T) {
 	rn := rostermodel.Notification{
 		Contact:  "ortuman",
@@ -275,6 +311,43 @@ func TestMySQLStorageFetchRosterNotifications(t *testing.T) {
 	require.NotNil(t, err)
 }
 
+func TestMySQLStorageRosterPermissions(t *testing.T) {
+	s, mock := newRosterMock()
+	mock.ExpectExec("INSERT INTO roster_permissions (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("ortuman@jackal.im", "gateway.jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.UpsertRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = newRosterMock()
+	mock.ExpectQuery("SELECT COUNT(.+) FROM roster_permissions (.+)").
+		WithArgs("ortuman@jackal.im", "gateway.jackal.im").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	granted, err := s.FetchRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.True(t, granted)
+
+	s, mock = newRosterMock()
+	mock.ExpectQuery("SELECT COUNT(.+) FROM roster_permissions (.+)").
+		WithArgs("ortuman@jackal.im", "gateway.jackal.im").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+
+	s, mock = newRosterMock()
+	mock.ExpectExec("DELETE FROM roster_permissions (.+)").
+		WithArgs("ortuman@jackal.im", "gateway.jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = s.DeleteRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+}
+
 func TestMySQLStorageFetchRosterGroups(t *testing.T) {
 	s, mock := newRosterMock()
 	mock.ExpectQuery("SELECT `group` FROM roster_groups WHERE username = (.+) GROUP BY (.+)").
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	sq "github.com/Masterminds/squirrel"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+)
+
+type mySQLSharedGroups struct {
+	*mySQLStorage
+}
+
+func newSharedGroups(db *sql.DB) *mySQLSharedGroups {
+	return &mySQLSharedGroups{
+		mySQLStorage: newStorage(db),
+	}
+}
+
+func (s *mySQLSharedGroups) UpsertSharedGroup(ctx context.Context, group *rostermodel.SharedGroup) error {
+	hostsBytes, err := json.Marshal(group.Hosts)
+	if err != nil {
+		return err
+	}
+	membersBytes, err := json.Marshal(group.Members)
+	if err != nil {
+		return err
+	}
+	_, err = sq.Insert("shared_groups").
+		Columns("name", "description", "hosts", "members", "updated_at", "created_at").
+		Values(group.Name, group.Description, hostsBytes, membersBytes, nowExpr, nowExpr).
+		Suffix("ON DUPLICATE KEY UPDATE description = ?, hosts = ?, members = ?, updated_at = NOW()", group.Description, hostsBytes, membersBytes).
+		RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+func (s *mySQLSharedGroups) DeleteSharedGroup(ctx context.Context, name string) error {
+	_, err := sq.Delete("shared_groups").
+		Where(sq.Eq{"name": name}).
+		RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+func (s *mySQLSharedGroups) FetchSharedGroup(ctx context.Context, name string) (*rostermodel.SharedGroup, error) {
+	q := sq.Select("name", "description", "hosts", "members").
+		From("shared_groups").
+		Where(sq.Eq{"name": name})
+
+	var group rostermodel.SharedGroup
+	err := scanSharedGroupEntity(&group, q.RunWith(s.db).QueryRowContext(ctx))
+	switch err {
+	case nil:
+		return &group, nil
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func (s *mySQLSharedGroups) FetchSharedGroups(ctx context.Context) ([]rostermodel.SharedGroup, error) {
+	q := sq.Select("name", "description", "hosts", "members").
+		From("shared_groups").
+		OrderBy("name")
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ret []rostermodel.SharedGroup
+	for rows.Next() {
+		var group rostermodel.SharedGroup
+		if err := scanSharedGroupEntity(&group, rows); err != nil {
+			return nil, err
+		}
+		ret = append(ret, group)
+	}
+	return ret, nil
+}
+
+func (s *mySQLSharedGroups) FetchSharedGroupMembers(ctx context.Context, name string) ([]string, error) {
+	group, err := s.FetchSharedGroup(ctx, name)
+	if err != nil || group == nil {
+		return nil, err
+	}
+	set := make(map[string]struct{})
+	for _, member := range group.Members {
+		set[member] = struct{}{}
+	}
+	if len(group.Hosts) > 0 {
+		rows, err := sq.Select("username").
+			From("users").
+			Where(sq.Eq{"domain": group.Hosts}).
+			RunWith(s.db).QueryContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = rows.Close() }()
+
+		for rows.Next() {
+			var userJID string
+			if err := rows.Scan(&userJID); err != nil {
+				return nil, err
+			}
+			set[userJID] = struct{}{}
+		}
+	}
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func scanSharedGroupEntity(group *rostermodel.SharedGroup, scanner rowScanner) error {
+	var hostsBytes, membersBytes string
+	if err := scanner.Scan(&group.Name, &group.Description, &hostsBytes, &membersBytes); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(hostsBytes), &group.Hosts); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(membersBytes), &group.Members)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package mysql
+
+import (
+	"context"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	rostermodel "github.com/ortuman/jackal/model/roster"
+	"github.com/stretchr/testify/require"
+)
+
+var sharedGroupColumns = []string{"name", "description", "hosts", "members"}
+
+func TestMySQLStorageUpsertSharedGroup(t *testing.T) {
+	g := &rostermodel.SharedGroup{Name: "Engineering", Members: []string{"ortuman@jackal.im"}}
+
+	s, mock := newSharedGroupsMock()
+	mock.ExpectExec("INSERT INTO shared_groups (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("Engineering", "", []byte("null"), []byte(`["ortuman@jackal.im"]`), "", []byte("null"), []byte(`["ortuman@jackal.im"]`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.UpsertSharedGroup(context.Background(), g)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = newSharedGroupsMock()
+	mock.ExpectExec("INSERT INTO shared_groups (.+)").WillReturnError(errMySQLStorage)
+
+	err = s.UpsertSharedGroup(context.Background(), g)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageDeleteSharedGroup(t *testing.T) {
+	s, mock := newSharedGroupsMock()
+	mock.ExpectExec("DELETE FROM shared_groups (.+)").
+		WithArgs("Engineering").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.Nil(t, s.DeleteSharedGroup(context.Background(), "Engineering"))
+	require.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLStorageFetchSharedGroups(t *testing.T) {
+	s, mock := newSharedGroupsMock()
+	mock.ExpectQuery("SELECT (.+) FROM shared_groups ORDER BY name").
+		WillReturnRows(sqlmock.NewRows(sharedGroupColumns).
+			AddRow("Engineering", "", `null`, `["ortuman@jackal.im"]`).
+			AddRow("Everyone", "All users", `["jackal.im"]`, `null`))
+
+	groups, err := s.FetchSharedGroups(context.Background())
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, []string{"ortuman@jackal.im"}, groups[0].Members)
+	require.Equal(t, []string{"jackal.im"}, groups[1].Hosts)
+
+	s, mock = newSharedGroupsMock()
+	mock.ExpectQuery("SELECT (.+) FROM shared_groups (.+)").
+		WithArgs("Sales").
+		WillReturnRows(sqlmock.NewRows(sharedGroupColumns))
+
+	g, err := s.FetchSharedGroup(context.Background(), "Sales")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Nil(t, g)
+
+	s, mock = newSharedGroupsMock()
+	mock.ExpectQuery("SELECT (.+) FROM shared_groups (.+)").WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchSharedGroups(context.Background())
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchSharedGroupMembers(t *testing.T) {
+	s, mock := newSharedGroupsMock()
+	mock.ExpectQuery("SELECT (.+) FROM shared_groups (.+)").
+		WithArgs("Everyone").
+		WillReturnRows(sqlmock.NewRows(sharedGroupColumns).AddRow("Everyone", "", `["jackal.im","jackal_100%.im"]`, `["romeo@example.org"]`))
+	mock.ExpectQuery("SELECT username FROM users WHERE domain IN \\(\\?,\\?\\)").
+		WithArgs("jackal.im", "jackal_100%.im").
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("ortuman@jackal.im").AddRow("noelia@jackal.im"))
+
+	members, err := s.FetchSharedGroupMembers(context.Background(), "Everyone")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, []string{"noelia@jackal.im", "ortuman@jackal.im", "romeo@example.org"}, members)
+}
+
+func newSharedGroupsMock() (*mySQLSharedGroups, sqlmock.Sqlmock) {
+	s, sqlMock := newStorageMock()
+	return &mySQLSharedGroups{
+		mySQLStorage: s,
+	}, sqlMock
+}
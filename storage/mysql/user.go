@@ -40,8 +40,8 @@ func (u *mySQLUser) UpsertUser(ctx context.Context, usr *model.User) error {
 		presenceXML = buf.String()
 		u.pool.Put(buf)
 	}
-	columns := []string{"username", "password", "updated_at", "created_at"}
-	values := []interface{}{usr.Username, usr.Password, nowExpr, nowExpr}
+	columns := []string{"username", "domain", "password", "updated_at", "created_at"}
+	values := []interface{}{usr.BareJID(), usr.Domain, usr.Password, nowExpr, nowExpr}
 
 	if len(presenceXML) > 0 {
 		columns = append(columns, []string{"last_presence", "last_presence_at"}...)
@@ -65,20 +65,21 @@ func (u *mySQLUser) UpsertUser(ctx context.Context, usr *model.User) error {
 	return err
 }
 
-func (u *mySQLUser) FetchUser(ctx context.Context, username string) (*model.User, error) {
+func (u *mySQLUser) FetchUser(ctx context.Context, userJID string) (*model.User, error) {
 	q := sq.Select("username", "password", "last_presence", "last_presence_at").
 		From("users").
-		Where(sq.Eq{"username": username})
+		Where(sq.Eq{"username": userJID})
 
-	var presenceXML string
+	var bareJID, presenceXML string
 	var presenceAt time.Time
 	var usr model.User
 
 	err := q.RunWith(u.db).
 		QueryRowContext(ctx).
-		Scan(&usr.Username, &usr.Password, &presenceXML, &presenceAt)
+		Scan(&bareJID, &usr.Password, &presenceXML, &presenceAt)
 	switch err {
 	case nil:
+		usr.Username, usr.Domain = model.SplitBareJID(bareJID)
 		if len(presenceXML) > 0 {
 			parser := xmpp.NewParser(strings.NewReader(presenceXML), xmpp.DefaultMode, 0)
 			lastPresence, err := parser.ParseElement()
@@ -98,30 +99,34 @@ func (u *mySQLUser) FetchUser(ctx context.Context, username string) (*model.User
 	}
 }
 
-func (u *mySQLUser) DeleteUser(ctx context.Context, username string) error {
+func (u *mySQLUser) DeleteUser(ctx context.Context, userJID string) error {
 	return u.inTransaction(ctx, func(tx *sql.Tx) error {
 		var err error
-		_, err = sq.Delete("offline_messages").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("offline_messages").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = sq.Delete("roster_items").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("roster_items").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("roster_versions").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("roster_versions").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("roster_changes").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("private_storage").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("private_storage").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("vcards").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("vcards").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("users").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("users").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
@@ -129,10 +134,54 @@ func (u *mySQLUser) DeleteUser(ctx context.Context, username string) error {
 	})
 }
 
-func (u *mySQLUser) UserExists(ctx context.Context, username string) (bool, error) {
+// deleteAccount deletes a user along with every entity associated to it in a single transaction.
+func (u *mySQLUser) deleteAccount(ctx context.Context, userJID *jid.JID) error {
+	bareJID := userJID.ToBareJID().String()
+	userNodeIDs := sq.Expr("node_id IN (SELECT id FROM pubsub_nodes WHERE host = ?)", bareJID)
+
+	stmts := []sq.Sqlizer{
+		// bump roster version of every contact referencing the user
+		// (MySQL evaluates assignments left to right, so ver already holds the bumped value)
+		sq.Update("roster_versions").
+			Set("ver", sq.Expr("ver + 1")).
+			Set("last_deletion_ver", sq.Expr("ver")).
+			Set("updated_at", nowExpr).
+			Where(sq.Expr("username IN (SELECT username FROM roster_items WHERE jid = ?)", bareJID)),
+		sq.Delete("roster_groups").Where(sq.Or{sq.Eq{"username": bareJID}, sq.Eq{"jid": bareJID}}),
+		sq.Delete("roster_items").Where(sq.Or{sq.Eq{"username": bareJID}, sq.Eq{"jid": bareJID}}),
+		sq.Delete("roster_versions").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("roster_changes").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("roster_notifications").Where(sq.Or{sq.Eq{"contact": bareJID}, sq.Eq{"jid": bareJID}}),
+		sq.Delete("roster_permissions").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("blocklist_items").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("private_storage").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("vcards").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("offline_messages").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("presences").Where(sq.Eq{"username": userJID.Node(), "domain": userJID.Domain()}),
+
+		// user owned pubsub nodes
+		sq.Delete("pubsub_node_options").Where(userNodeIDs),
+		sq.Delete("pubsub_items").Where(userNodeIDs),
+		sq.Delete("pubsub_affiliations").Where(sq.Or{userNodeIDs, sq.Eq{"jid": bareJID}}),
+		sq.Delete("pubsub_subscriptions").Where(sq.Or{userNodeIDs, sq.Eq{"jid": bareJID}}),
+		sq.Delete("pubsub_nodes").Where(sq.Eq{"host": bareJID}),
+
+		sq.Delete("users").Where(sq.Eq{"username": bareJID}),
+	}
+	return u.inTransaction(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := sq.ExecContextWith(ctx, tx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (u *mySQLUser) UserExists(ctx context.Context, userJID string) (bool, error) {
 	q := sq.Select("COUNT(*)").
 		From("users").
-		Where(sq.Eq{"username": username})
+		Where(sq.Eq{"username": userJID})
 
 	var count int
 	err := q.RunWith(u.db).QueryRowContext(ctx).Scan(&count)
@@ -23,11 +23,11 @@ func TestMySQLStorageInsertUser(t *testing.T) {
 	to, _ := jid.NewWithString("ortuman@jackal.im", true)
 	p := xmpp.NewPresence(from, to, xmpp.UnavailableType)
 
-	user := model.User{Username: "ortuman", Password: "1234", LastPresence: p}
+	user := model.User{Username: "ortuman", Domain: "jackal.im", Password: "1234", LastPresence: p}
 
 	s, mock := newUserMock()
-	mock.ExpectExec("INSERT INTO users (.+) ON DUPLICATE KEY UPDATE (.+)").
-		WithArgs("ortuman", "1234", p.String(), "1234", p.String()).
+	mock.ExpectExec("INSERT INTO users \\(username,domain,password,updated_at,created_at,last_presence,last_presence_at\\) (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("ortuman@jackal.im", "jackal.im", "1234", p.String(), "1234", p.String()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err := s.UpsertUser(context.Background(), &user)
@@ -36,7 +36,7 @@ func TestMySQLStorageInsertUser(t *testing.T) {
 
 	s, mock = newUserMock()
 	mock.ExpectExec("INSERT INTO users (.+) ON DUPLICATE KEY UPDATE (.+)").
-		WithArgs("ortuman", "1234", p.String(), "1234", p.String()).
+		WithArgs("ortuman@jackal.im", "jackal.im", "1234", p.String(), "1234", p.String()).
 		WillReturnError(errMocked)
 
 	err = s.UpsertUser(context.Background(), &user)
@@ -53,6 +53,8 @@ func TestMySQLStorageDeleteUser(t *testing.T) {
 		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec("DELETE FROM roster_versions (.+)").
 		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM roster_changes (.+)").
+		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec("DELETE FROM private_storage (.+)").
 		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec("DELETE FROM vcards (.+)").
@@ -130,6 +132,67 @@ func TestMySQLStorageUserExists(t *testing.T) {
 	require.Equal(t, errMocked, err)
 }
 
+func TestMySQLStorageDeleteAccount(t *testing.T) {
+	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+
+	s, mock := newUserMock()
+	mock.ExpectBegin()
+	// deletion version must match the bumped roster version
+	mock.ExpectExec(`UPDATE roster_versions SET ver = ver \+ 1, last_deletion_ver = ver, (.+)`).
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM roster_groups (.+)").
+		WithArgs("ortuman@jackal.im", "ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM roster_items (.+)").
+		WithArgs("ortuman@jackal.im", "ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM roster_versions (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM roster_changes (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM roster_notifications (.+)").
+		WithArgs("ortuman@jackal.im", "ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM roster_permissions (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM blocklist_items (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM private_storage (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM vcards (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM offline_messages (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM presences (.+)").
+		WithArgs("jackal.im", "ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM pubsub_node_options (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM pubsub_items (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM pubsub_affiliations (.+)").
+		WithArgs("ortuman@jackal.im", "ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM pubsub_subscriptions (.+)").
+		WithArgs("ortuman@jackal.im", "ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM pubsub_nodes (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM users (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := s.deleteAccount(context.Background(), j)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = newUserMock()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE roster_versions (.+)").
+		WithArgs("ortuman@jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM roster_groups (.+)").
+		WithArgs("ortuman@jackal.im", "ortuman@jackal.im").WillReturnError(errMocked)
+	mock.ExpectRollback()
+
+	err = s.deleteAccount(context.Background(), j)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMocked, err)
+}
+
 func newUserMock() (*mySQLUser, sqlmock.Sqlmock) {
 	s, sqlMock := newStorageMock()
 	return &mySQLUser{
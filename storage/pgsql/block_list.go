@@ -26,7 +26,7 @@ func newBlockList(db *sql.DB) *pgSQLBlockList {
 func (s *pgSQLBlockList) InsertBlockListItem(ctx context.Context, item *model.BlockListItem) error {
 	q := sq.Insert("blocklist_items").
 		Columns("username", "jid").
-		Values(item.Username, item.JID).
+		Values(item.UserJID(), item.JID).
 		RunWith(s.db)
 	_, err := q.ExecContext(ctx)
 	return err
@@ -34,16 +34,16 @@ func (s *pgSQLBlockList) InsertBlockListItem(ctx context.Context, item *model.Bl
 
 func (s *pgSQLBlockList) DeleteBlockListItem(ctx context.Context, item *model.BlockListItem) error {
 	q := sq.Delete("blocklist_items").
-		Where(sq.And{sq.Eq{"username": item.Username}, sq.Eq{"jid": item.JID}}).
+		Where(sq.And{sq.Eq{"username": item.UserJID()}, sq.Eq{"jid": item.JID}}).
 		RunWith(s.db)
 	_, err := q.ExecContext(ctx)
 	return err
 }
 
-func (s *pgSQLBlockList) FetchBlockListItems(ctx context.Context, username string) ([]model.BlockListItem, error) {
+func (s *pgSQLBlockList) FetchBlockListItems(ctx context.Context, userJID string) ([]model.BlockListItem, error) {
 	q := sq.Select("username", "jid").
 		From("blocklist_items").
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"username": userJID}).
 		OrderBy("created_at")
 
 	rows, err := q.RunWith(s.db).QueryContext(ctx)
@@ -60,9 +60,11 @@ func scanBlockListItemEntities(scanner rowsScanner) ([]model.BlockListItem, erro
 
 	for scanner.Next() {
 		var it model.BlockListItem
-		if err := scanner.Scan(&it.Username, &it.JID); err != nil {
+		var userJID string
+		if err := scanner.Scan(&userJID, &it.JID); err != nil {
 			return nil, err
 		}
+		it.Username, it.Domain = model.SplitBareJID(userJID)
 		ret = append(ret, it)
 	}
 	return ret, nil
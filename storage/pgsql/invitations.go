@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pgsql
+
+import (
+	"context"
+	"database/sql"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
+)
+
+type pgSQLInvitations struct {
+	*pgSQLStorage
+}
+
+func newInvitations(db *sql.DB) *pgSQLInvitations {
+	return &pgSQLInvitations{
+		pgSQLStorage: newStorage(db),
+	}
+}
+
+func (s *pgSQLInvitations) InsertInvitation(ctx context.Context, inv *model.Invitation) error {
+	_, err := sq.Insert("invitations").
+		Columns("token", "username", "expires_at").
+		Values(inv.Token, inv.Username, inv.Expires).
+		RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+func (s *pgSQLInvitations) DeleteInvitation(ctx context.Context, token string) (bool, error) {
+	res, err := sq.Delete("invitations").
+		Where(sq.Eq{"token": token}).
+		RunWith(s.db).ExecContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	// only one of the concurrent deleters gets to spend the invitation
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affectedRows > 0, nil
+}
+
+func (s *pgSQLInvitations) FetchInvitation(ctx context.Context, token string) (*model.Invitation, error) {
+	var inv model.Invitation
+	err := sq.Select("token", "username", "expires_at").
+		From("invitations").
+		Where(sq.Eq{"token": token}).
+		RunWith(s.db).
+		QueryRowContext(ctx).
+		Scan(&inv.Token, &inv.Username, &inv.Expires)
+	switch err {
+	case nil:
+		return &inv, nil
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func (s *pgSQLInvitations) FetchInvitations(ctx context.Context) ([]model.Invitation, error) {
+	rows, err := sq.Select("token", "username", "expires_at").
+		From("invitations").
+		OrderBy("expires_at").
+		RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ret []model.Invitation
+	for rows.Next() {
+		var inv model.Invitation
+		if err := rows.Scan(&inv.Token, &inv.Username, &inv.Expires); err != nil {
+			return nil, err
+		}
+		ret = append(ret, inv)
+	}
+	return ret, nil
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pgsql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+var invitationColumns = []string{"token", "username", "expires_at"}
+
+func TestPgSQLStorageInsertInvitation(t *testing.T) {
+	inv := &model.Invitation{Token: "abcd", Username: "ortuman", Expires: time.Now()}
+
+	s, mock := newInvitationsMock()
+	mock.ExpectExec("INSERT INTO invitations \\(token,username,expires_at\\) VALUES \\(\\?,\\?,\\?\\)").
+		WithArgs("abcd", "ortuman", inv.Expires).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.InsertInvitation(context.Background(), inv)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = newInvitationsMock()
+	mock.ExpectExec("INSERT INTO invitations (.+)").WillReturnError(errGeneric)
+
+	err = s.InsertInvitation(context.Background(), inv)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errGeneric, err)
+}
+
+func TestPgSQLStorageDeleteInvitation(t *testing.T) {
+	s, mock := newInvitationsMock()
+	mock.ExpectExec("DELETE FROM invitations WHERE token = \\?").
+		WithArgs("abcd").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	deleted, err := s.DeleteInvitation(context.Background(), "abcd")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.True(t, deleted)
+
+	s, mock = newInvitationsMock()
+	mock.ExpectExec("DELETE FROM invitations WHERE token = \\?").
+		WithArgs("abcd").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	deleted, err = s.DeleteInvitation(context.Background(), "abcd")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.False(t, deleted)
+}
+
+func TestPgSQLStorageFetchInvitation(t *testing.T) {
+	expires := time.Now()
+
+	s, mock := newInvitationsMock()
+	mock.ExpectQuery("SELECT token, username, expires_at FROM invitations WHERE token = \\?").
+		WithArgs("abcd").
+		WillReturnRows(sqlmock.NewRows(invitationColumns).AddRow("abcd", "ortuman", expires))
+
+	inv, err := s.FetchInvitation(context.Background(), "abcd")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, &model.Invitation{Token: "abcd", Username: "ortuman", Expires: expires}, inv)
+
+	s, mock = newInvitationsMock()
+	mock.ExpectQuery("SELECT (.+) FROM invitations (.+)").
+		WithArgs("abcd").
+		WillReturnRows(sqlmock.NewRows(invitationColumns))
+
+	inv, err = s.FetchInvitation(context.Background(), "abcd")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Nil(t, inv)
+}
+
+func TestPgSQLStorageFetchInvitations(t *testing.T) {
+	expires := time.Now()
+
+	s, mock := newInvitationsMock()
+	mock.ExpectQuery("SELECT token, username, expires_at FROM invitations ORDER BY expires_at").
+		WillReturnRows(sqlmock.NewRows(invitationColumns).
+			AddRow("efgh", "", expires).
+			AddRow("abcd", "ortuman", expires.Add(time.Hour)))
+
+	invs, err := s.FetchInvitations(context.Background())
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Len(t, invs, 2)
+	require.Equal(t, "efgh", invs[0].Token)
+	require.Equal(t, "ortuman", invs[1].Username)
+
+	s, mock = newInvitationsMock()
+	mock.ExpectQuery("SELECT (.+) FROM invitations (.+)").WillReturnError(errGeneric)
+
+	invs, err = s.FetchInvitations(context.Background())
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errGeneric, err)
+	require.Nil(t, invs)
+}
+
+func newInvitationsMock() (*pgSQLInvitations, sqlmock.Sqlmock) {
+	s, sqlMock := newStorageMock()
+	return &pgSQLInvitations{
+		pgSQLStorage: s,
+	}, sqlMock
+}
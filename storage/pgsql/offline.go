@@ -28,10 +28,10 @@ func newOffline(db *sql.DB) *pgSQLOffline {
 }
 
 // InsertOfflineMessage inserts a new message element into user's offline queue.
-func (s *pgSQLOffline) InsertOfflineMessage(ctx context.Context, message *xmpp.Message, username string) error {
+func (s *pgSQLOffline) InsertOfflineMessage(ctx context.Context, message *xmpp.Message, userJID string) error {
 	q := sq.Insert("offline_messages").
 		Columns("username", "data").
-		Values(username, message.String())
+		Values(userJID, message.String())
 
 	_, err := q.RunWith(s.db).ExecContext(ctx)
 
@@ -39,12 +39,12 @@ func (s *pgSQLOffline) InsertOfflineMessage(ctx context.Context, message *xmpp.M
 }
 
 // CountOfflineMessages returns current length of user's offline queue.
-func (s *pgSQLOffline) CountOfflineMessages(ctx context.Context, username string) (int, error) {
+func (s *pgSQLOffline) CountOfflineMessages(ctx context.Context, userJID string) (int, error) {
 	var count int
 
 	q := sq.Select("COUNT(*)").
 		From("offline_messages").
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"username": userJID}).
 		OrderBy("created_at")
 
 	if err := q.RunWith(s.db).QueryRowContext(ctx).Scan(&count); err != nil {
@@ -54,10 +54,10 @@ func (s *pgSQLOffline) CountOfflineMessages(ctx context.Context, username string
 }
 
 // FetchOfflineMessages retrieves from storage current user offline queue.
-func (s *pgSQLOffline) FetchOfflineMessages(ctx context.Context, username string) ([]xmpp.Message, error) {
+func (s *pgSQLOffline) FetchOfflineMessages(ctx context.Context, userJID string) ([]xmpp.Message, error) {
 	q := sq.Select("data").
 		From("offline_messages").
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"username": userJID}).
 		OrderBy("created_at")
 
 	rows, err := q.RunWith(s.db).QueryContext(ctx)
@@ -102,8 +102,8 @@ func (s *pgSQLOffline) FetchOfflineMessages(ctx context.Context, username string
 }
 
 // DeleteOfflineMessages clears a user offline queue.
-func (s *pgSQLOffline) DeleteOfflineMessages(ctx context.Context, username string) error {
-	q := sq.Delete("offline_messages").Where(sq.Eq{"username": username})
+func (s *pgSQLOffline) DeleteOfflineMessages(ctx context.Context, userJID string) error {
+	q := sq.Delete("offline_messages").Where(sq.Eq{"username": userJID})
 	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
@@ -15,6 +15,7 @@ import (
 	_ "github.com/lib/pq" // PostgreSQL driver
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/storage/repository"
+	"github.com/ortuman/jackal/xmpp/jid"
 )
 
 // pingInterval defines how often to check the connection
@@ -32,6 +33,8 @@ type pgSQLContainer struct {
 	blockList *pgSQLBlockList
 	pubSub    *pgSQLPubSub
 	offline   *pgSQLOffline
+	shGroups  *pgSQLSharedGroups
+	invs      *pgSQLInvitations
 
 	h          *sql.DB
 	cancelPing context.CancelFunc
@@ -69,18 +72,26 @@ func New(cfg *Config) (repository.Container, error) {
 	c.blockList = newBlockList(c.h)
 	c.pubSub = newPubSub(c.h)
 	c.offline = newOffline(c.h)
+	c.shGroups = newSharedGroups(c.h)
+	c.invs = newInvitations(c.h)
 
 	return c, nil
 }
 
-func (c *pgSQLContainer) User() repository.User           { return c.user }
-func (c *pgSQLContainer) Roster() repository.Roster       { return c.roster }
-func (c *pgSQLContainer) Presences() repository.Presences { return c.presences }
-func (c *pgSQLContainer) VCard() repository.VCard         { return c.vCard }
-func (c *pgSQLContainer) Private() repository.Private     { return c.priv }
-func (c *pgSQLContainer) BlockList() repository.BlockList { return c.blockList }
-func (c *pgSQLContainer) PubSub() repository.PubSub       { return c.pubSub }
-func (c *pgSQLContainer) Offline() repository.Offline     { return c.offline }
+func (c *pgSQLContainer) User() repository.User                 { return c.user }
+func (c *pgSQLContainer) Roster() repository.Roster             { return c.roster }
+func (c *pgSQLContainer) Presences() repository.Presences       { return c.presences }
+func (c *pgSQLContainer) VCard() repository.VCard               { return c.vCard }
+func (c *pgSQLContainer) Private() repository.Private           { return c.priv }
+func (c *pgSQLContainer) BlockList() repository.BlockList       { return c.blockList }
+func (c *pgSQLContainer) PubSub() repository.PubSub             { return c.pubSub }
+func (c *pgSQLContainer) Offline() repository.Offline           { return c.offline }
+func (c *pgSQLContainer) SharedGroups() repository.SharedGroups { return c.shGroups }
+func (c *pgSQLContainer) Invitations() repository.Invitations   { return c.invs }
+
+func (c *pgSQLContainer) DeleteAccount(ctx context.Context, userJID *jid.JID) error {
+	return c.user.deleteAccount(ctx, userJID)
+}
 
 func (c *pgSQLContainer) Close(ctx context.Context) error {
 	ch := make(chan bool)
@@ -28,7 +28,7 @@ func newPrivate(db *sql.DB) *pgSQLPrivate {
 
 // UpsertPrivateXML inserts a new private element into storage,
 // or updates it in case it's been previously inserted.
-func (s *pgSQLPrivate) UpsertPrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, username string) error {
+func (s *pgSQLPrivate) UpsertPrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, userJID string) error {
 	buf := s.pool.Get()
 	defer s.pool.Put(buf)
 
@@ -42,7 +42,7 @@ func (s *pgSQLPrivate) UpsertPrivateXML(ctx context.Context, privateXML []xmpp.X
 
 	q := sq.Insert("private_storage").
 		Columns("username", "namespace", "data").
-		Values(username, namespace, rawXML).
+		Values(userJID, namespace, rawXML).
 		Suffix("ON CONFLICT (username, namespace) DO UPDATE SET data = $4", rawXML)
 
 	_, err := q.RunWith(s.db).ExecContext(ctx)
@@ -50,10 +50,10 @@ func (s *pgSQLPrivate) UpsertPrivateXML(ctx context.Context, privateXML []xmpp.X
 }
 
 // FetchPrivateXML retrieves from storage a private element.
-func (s *pgSQLPrivate) FetchPrivateXML(ctx context.Context, namespace string, username string) ([]xmpp.XElement, error) {
+func (s *pgSQLPrivate) FetchPrivateXML(ctx context.Context, namespace string, userJID string) ([]xmpp.XElement, error) {
 	q := sq.Select("data").
 		From("private_storage").
-		Where(sq.And{sq.Eq{"username": username}, sq.Eq{"namespace": namespace}})
+		Where(sq.And{sq.Eq{"username": userJID}, sq.Eq{"namespace": namespace}})
 
 	var privateXML string
 	err := q.RunWith(s.db).QueryRowContext(ctx).Scan(&privateXML)
@@ -37,6 +37,7 @@ func TestInsertRosterItem(t *testing.T) {
 		ri.Subscription,
 		groupsBytes,
 		ri.Ask,
+		ri.Approved,
 		ri.Username,
 	}
 
@@ -68,6 +69,10 @@ func TestInsertRosterItem(t *testing.T) {
 		WithArgs(ri.Username).
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(1, 0))
 
+	mock.ExpectExec("INSERT INTO roster_changes (.+) ON CONFLICT (.+) DO UPDATE SET (.+)").
+		WithArgs("user", "contact@jid", 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
 	mock.ExpectCommit()
 
 	_, err := s.UpsertRosterItem(context.Background(), &ri)
@@ -87,6 +92,8 @@ func TestDeleteRosterItem(t *testing.T) {
 	mock.ExpectQuery("SELECT (.+) FROM roster_versions (.+)").
 		WithArgs("user").
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(1, 0))
+	mock.ExpectExec("INSERT INTO roster_changes (.+)").
+		WithArgs("user", "contact", 1).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
 	_, err := s.DeleteRosterItem(context.Background(), "user", "contact")
@@ -105,12 +112,12 @@ func TestDeleteRosterItem(t *testing.T) {
 }
 
 func TestFetchRosterItems(t *testing.T) {
-	var riColumns = []string{"user", "contact", "name", "subscription", "`groups`", "ask", "ver"}
+	var riColumns = []string{"user", "contact", "name", "subscription", "`groups`", "ask", "approved", "ver"}
 
 	s, mock := newRosterMock()
 	mock.ExpectQuery("SELECT (.+) FROM roster_items (.+)").
 		WithArgs("ortuman").
-		WillReturnRows(sqlmock.NewRows(riColumns).AddRow("ortuman", "romeo", "Romeo", "both", "", false, 0))
+		WillReturnRows(sqlmock.NewRows(riColumns).AddRow("ortuman", "romeo", "Romeo", "both", "", false, false, 0))
 	mock.ExpectQuery("SELECT (.+) FROM roster_versions (.+)").
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(0, 0))
@@ -132,7 +139,7 @@ func TestFetchRosterItems(t *testing.T) {
 	s, mock = newRosterMock()
 	mock.ExpectQuery("SELECT (.+) FROM roster_items (.+)").
 		WithArgs("ortuman", "romeo").
-		WillReturnRows(sqlmock.NewRows(riColumns).AddRow("ortuman", "romeo", "Romeo", "both", "", false, 0))
+		WillReturnRows(sqlmock.NewRows(riColumns).AddRow("ortuman", "romeo", "Romeo", "both", "", false, false, 0))
 
 	_, err = s.FetchRosterItem(context.Background(), "ortuman", "romeo")
 	require.Nil(t, mock.ExpectationsWereMet())
@@ -156,11 +163,11 @@ func TestFetchRosterItems(t *testing.T) {
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errGeneric, err)
 
-	var riColumns2 = []string{"ris.user", "ris.contact", "ris.name", "ris.subscription", "ris.groups", "ris.ask", "ris.ver"}
+	var riColumns2 = []string{"ris.user", "ris.contact", "ris.name", "ris.subscription", "ris.groups", "ris.ask", "ris.approved", "ris.ver"}
 	s, mock = newRosterMock()
 	mock.ExpectQuery("SELECT (.+) FROM roster_items ris LEFT JOIN roster_groups g ON ris.username = g.username (.+)").
 		WithArgs("ortuman", "Family").
-		WillReturnRows(sqlmock.NewRows(riColumns2).AddRow("ortuman", "romeo", "Romeo", "both", `["Family"]`, false, 0))
+		WillReturnRows(sqlmock.NewRows(riColumns2).AddRow("ortuman", "romeo", "Romeo", "both", `["Family"]`, false, false, 0))
 	mock.ExpectQuery("SELECT (.+) FROM roster_versions (.+)").
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(0, 0))
@@ -170,6 +177,34 @@ func TestFetchRosterItems(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestFetchRosterChanges(t *testing.T) {
+	var rcColumns = []string{"username", "jid", "name", "subscription", "groups", "ask", "approved", "ver"}
+
+	s, mock := newRosterMock()
+	mock.ExpectQuery("SELECT (.+) FROM roster_changes rc LEFT JOIN roster_items ri (.+)").
+		WithArgs("ortuman", 2).
+		WillReturnRows(sqlmock.NewRows(rcColumns).
+			AddRow("ortuman", "romeo", "Romeo", "both", `["Family"]`, false, false, 3).
+			AddRow("ortuman", "juliet", "", "remove", "", false, false, 4))
+
+	ris, err := s.FetchRosterChanges(context.Background(), "ortuman", 2)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Len(t, ris, 2)
+	require.Equal(t, []string{"Family"}, ris[0].Groups)
+	require.Equal(t, rostermodel.SubscriptionRemove, ris[1].Subscription)
+	require.Equal(t, 4, ris[1].Ver)
+
+	s, mock = newRosterMock()
+	mock.ExpectQuery("SELECT (.+) FROM roster_changes (.+)").
+		WithArgs("ortuman", 2).
+		WillReturnError(errGeneric)
+
+	_, err = s.FetchRosterChanges(context.Background(), "ortuman", 2)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errGeneric, err)
+}
+
 func TestInsertRosterNotification(t *testing.T) {
 	rn := rostermodel.Notification{
 		Contact:  "ortuman",
@@ -263,6 +298,43 @@ func TestFetchRosterNotifications(t *testing.T) {
 	require.NotNil(t, err)
 }
 
+func TestStorageRosterPermissions(t *testing.T) {
+	s, mock := newRosterMock()
+	mock.ExpectExec("INSERT INTO roster_permissions (.+) ON CONFLICT (.+) DO NOTHING").
+		WithArgs("ortuman@jackal.im", "gateway.jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.UpsertRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = newRosterMock()
+	mock.ExpectQuery("SELECT COUNT(.+) FROM roster_permissions (.+)").
+		WithArgs("ortuman@jackal.im", "gateway.jackal.im").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	granted, err := s.FetchRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.True(t, granted)
+
+	s, mock = newRosterMock()
+	mock.ExpectQuery("SELECT COUNT(.+) FROM roster_permissions (.+)").
+		WithArgs("ortuman@jackal.im", "gateway.jackal.im").
+		WillReturnError(errGeneric)
+
+	_, err = s.FetchRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errGeneric, err)
+
+	s, mock = newRosterMock()
+	mock.ExpectExec("DELETE FROM roster_permissions (.+)").
+		WithArgs("ortuman@jackal.im", "gateway.jackal.im").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = s.DeleteRosterPermission(context.Background(), "ortuman@jackal.im", "gateway.jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+}
+
 func TestStorageFetchRosterGroups(t *testing.T) {
 	s, mock := newRosterMock()
 	mock.ExpectQuery("SELECT `group` FROM roster_groups WHERE username = (.+) GROUP BY (.+)").
@@ -46,12 +46,12 @@ func (u *pgSQLUser) UpsertUser(ctx context.Context, usr *model.User) error {
 	q := sq.Insert("users")
 
 	if len(presenceXML) > 0 {
-		q = q.Columns("username", "password", "last_presence", "last_presence_at").
-			Values(usr.Username, usr.Password, presenceXML, nowExpr).
+		q = q.Columns("username", "password", "last_presence", "last_presence_at", "domain").
+			Values(usr.BareJID(), usr.Password, presenceXML, nowExpr, usr.Domain).
 			Suffix("ON CONFLICT (username) DO UPDATE SET password = $2, last_presence = $3, last_presence_at = NOW()")
 	} else {
-		q = q.Columns("username", "password").
-			Values(usr.Username, usr.Password).
+		q = q.Columns("username", "password", "domain").
+			Values(usr.BareJID(), usr.Password, usr.Domain).
 			Suffix("ON CONFLICT (username) DO UPDATE SET password = $2")
 	}
 	_, err := q.RunWith(u.db).ExecContext(ctx)
@@ -59,18 +59,19 @@ func (u *pgSQLUser) UpsertUser(ctx context.Context, usr *model.User) error {
 }
 
 // FetchUser retrieves from storage a user entity.
-func (u *pgSQLUser) FetchUser(ctx context.Context, username string) (*model.User, error) {
+func (u *pgSQLUser) FetchUser(ctx context.Context, userJID string) (*model.User, error) {
 	q := sq.Select("username", "password", "last_presence", "last_presence_at").
 		From("users").
-		Where(sq.Eq{"username": username})
+		Where(sq.Eq{"username": userJID})
 
-	var presenceXML string
+	var bareJID, presenceXML string
 	var presenceAt time.Time
 	var usr model.User
 
-	err := q.RunWith(u.db).QueryRowContext(ctx).Scan(&usr.Username, &usr.Password, &presenceXML, &presenceAt)
+	err := q.RunWith(u.db).QueryRowContext(ctx).Scan(&bareJID, &usr.Password, &presenceXML, &presenceAt)
 	switch err {
 	case nil:
+		usr.Username, usr.Domain = model.SplitBareJID(bareJID)
 		if len(presenceXML) > 0 {
 			parser := xmpp.NewParser(strings.NewReader(presenceXML), xmpp.DefaultMode, 0)
 			lastPresence, err := parser.ParseElement()
@@ -91,30 +92,34 @@ func (u *pgSQLUser) FetchUser(ctx context.Context, username string) (*model.User
 }
 
 // DeleteUser deletes a user entity from storage.
-func (u *pgSQLUser) DeleteUser(ctx context.Context, username string) error {
+func (u *pgSQLUser) DeleteUser(ctx context.Context, userJID string) error {
 	return u.inTransaction(ctx, func(tx *sql.Tx) error {
 		var err error
-		_, err = sq.Delete("offline_messages").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("offline_messages").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = sq.Delete("roster_items").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("roster_items").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("roster_versions").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("roster_versions").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("roster_changes").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("private_storage").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("private_storage").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("vcards").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("vcards").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("users").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		_, err = sq.Delete("users").Where(sq.Eq{"username": userJID}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
@@ -122,11 +127,54 @@ func (u *pgSQLUser) DeleteUser(ctx context.Context, username string) error {
 	})
 }
 
+// deleteAccount deletes a user along with every entity associated to it in a single transaction.
+func (u *pgSQLUser) deleteAccount(ctx context.Context, userJID *jid.JID) error {
+	bareJID := userJID.ToBareJID().String()
+	userNodeIDs := sq.Expr("node_id IN (SELECT id FROM pubsub_nodes WHERE host = ?)", bareJID)
+
+	stmts := []sq.Sqlizer{
+		// bump roster version of every contact referencing the user
+		// (right hand side expressions are evaluated against the old row values)
+		sq.Update("roster_versions").
+			Set("ver", sq.Expr("ver + 1")).
+			Set("last_deletion_ver", sq.Expr("ver + 1")).
+			Where(sq.Expr("username IN (SELECT username FROM roster_items WHERE jid = ?)", bareJID)),
+		sq.Delete("roster_groups").Where(sq.Or{sq.Eq{"username": bareJID}, sq.Eq{"jid": bareJID}}),
+		sq.Delete("roster_items").Where(sq.Or{sq.Eq{"username": bareJID}, sq.Eq{"jid": bareJID}}),
+		sq.Delete("roster_versions").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("roster_changes").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("roster_notifications").Where(sq.Or{sq.Eq{"contact": bareJID}, sq.Eq{"jid": bareJID}}),
+		sq.Delete("roster_permissions").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("blocklist_items").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("private_storage").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("vcards").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("offline_messages").Where(sq.Eq{"username": bareJID}),
+		sq.Delete("presences").Where(sq.Eq{"username": userJID.Node(), "domain": userJID.Domain()}),
+
+		// user owned pubsub nodes
+		sq.Delete("pubsub_node_options").Where(userNodeIDs),
+		sq.Delete("pubsub_items").Where(userNodeIDs),
+		sq.Delete("pubsub_affiliations").Where(sq.Or{userNodeIDs, sq.Eq{"jid": bareJID}}),
+		sq.Delete("pubsub_subscriptions").Where(sq.Or{userNodeIDs, sq.Eq{"jid": bareJID}}),
+		sq.Delete("pubsub_nodes").Where(sq.Eq{"host": bareJID}),
+
+		sq.Delete("users").Where(sq.Eq{"username": bareJID}),
+	}
+	return u.inTransaction(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := sq.ExecContextWith(ctx, tx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // UserExists returns whether or not a user exists within storage.
-func (u *pgSQLUser) UserExists(ctx context.Context, username string) (bool, error) {
+func (u *pgSQLUser) UserExists(ctx context.Context, userJID string) (bool, error) {
 	var count int
 
-	q := sq.Select("COUNT(*)").From("users").Where(sq.Eq{"username": username})
+	q := sq.Select("COUNT(*)").From("users").Where(sq.Eq{"username": userJID})
 	err := q.RunWith(u.db).QueryRowContext(ctx).Scan(&count)
 	switch err {
 	case nil:
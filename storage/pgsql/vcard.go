@@ -25,12 +25,12 @@ func newVCard(db *sql.DB) *pgSQLVCard {
 }
 
 // UpsertVCard inserts a new vCard element into storage, or updates it in case it's been previously inserted.
-func (s *pgSQLVCard) UpsertVCard(ctx context.Context, vCard xmpp.XElement, username string) error {
+func (s *pgSQLVCard) UpsertVCard(ctx context.Context, vCard xmpp.XElement, userJID string) error {
 	rawXML := vCard.String()
 
 	q := sq.Insert("vcards").
 		Columns("username", "vcard").
-		Values(username, rawXML).
+		Values(userJID, rawXML).
 		Suffix("ON CONFLICT (username) DO UPDATE SET vcard = $3", rawXML)
 
 	_, err := q.RunWith(s.db).ExecContext(ctx)
@@ -38,8 +38,8 @@ func (s *pgSQLVCard) UpsertVCard(ctx context.Context, vCard xmpp.XElement, usern
 }
 
 // FetchVCard retrieves from storage a vCard element associated to a given user.
-func (s *pgSQLVCard) FetchVCard(ctx context.Context, username string) (xmpp.XElement, error) {
-	q := sq.Select("vcard").From("vcards").Where(sq.Eq{"username": username})
+func (s *pgSQLVCard) FetchVCard(ctx context.Context, userJID string) (xmpp.XElement, error) {
+	q := sq.Select("vcard").From("vcards").Where(sq.Eq{"username": userJID})
 
 	var vCard string
 
@@ -20,5 +20,5 @@ type BlockList interface {
 	DeleteBlockListItem(ctx context.Context, item *model.BlockListItem) error
 
 	// FetchBlockListItems retrieves from storage all block list item entities associated to a given user.
-	FetchBlockListItems(ctx context.Context, username string) ([]model.BlockListItem, error)
+	FetchBlockListItems(ctx context.Context, userJID string) ([]model.BlockListItem, error)
 }
@@ -5,7 +5,11 @@
 
 package repository
 
-import "context"
+import (
+	"context"
+
+	"github.com/ortuman/jackal/xmpp/jid"
+)
 
 // Container interface brings together all repository instances.
 type Container interface {
@@ -33,6 +37,15 @@ type Container interface {
 	// Offline method returns repository.Offline concrete implementation.
 	Offline() Offline
 
+	// SharedGroups method returns repository.SharedGroups concrete implementation.
+	SharedGroups() SharedGroups
+
+	// Invitations method returns repository.Invitations concrete implementation.
+	Invitations() Invitations
+
+	// DeleteAccount deletes a user along with every entity associated to it across all repositories.
+	DeleteAccount(ctx context.Context, userJID *jid.JID) error
+
 	// Close closes underlying storage resources, commonly shared across repositories.
 	Close(ctx context.Context) error
 
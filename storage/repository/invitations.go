@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package repository
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/model"
+)
+
+// Invitations defines storage operations for in-band registration invitations.
+type Invitations interface {
+	// InsertInvitation inserts a new invitation entity into storage.
+	InsertInvitation(ctx context.Context, inv *model.Invitation) error
+
+	// DeleteInvitation deletes an invitation entity from storage,
+	// returning whether or not it was present.
+	DeleteInvitation(ctx context.Context, token string) (bool, error)
+
+	// FetchInvitation retrieves from storage an invitation entity.
+	FetchInvitation(ctx context.Context, token string) (*model.Invitation, error)
+
+	// FetchInvitations retrieves from storage all invitation entities.
+	FetchInvitations(ctx context.Context) ([]model.Invitation, error)
+}
@@ -14,14 +14,14 @@ import (
 // Offline defines storage operations for offline messages
 type Offline interface {
 	// InsertOfflineMessage inserts a new message element into user's offline queue.
-	InsertOfflineMessage(ctx context.Context, message *xmpp.Message, username string) error
+	InsertOfflineMessage(ctx context.Context, message *xmpp.Message, userJID string) error
 
 	// CountOfflineMessages returns current length of user's offline queue.
-	CountOfflineMessages(ctx context.Context, username string) (int, error)
+	CountOfflineMessages(ctx context.Context, userJID string) (int, error)
 
 	// FetchOfflineMessages retrieves from storage current user offline queue.
-	FetchOfflineMessages(ctx context.Context, username string) ([]xmpp.Message, error)
+	FetchOfflineMessages(ctx context.Context, userJID string) ([]xmpp.Message, error)
 
 	// DeleteOfflineMessages clears a user offline queue.
-	DeleteOfflineMessages(ctx context.Context, username string) error
+	DeleteOfflineMessages(ctx context.Context, userJID string) error
 }
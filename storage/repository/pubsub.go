@@ -7,8 +7,10 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	pubsubmodel "github.com/ortuman/jackal/model/pubsub"
+	rsmmodel "github.com/ortuman/jackal/model/rsm"
 )
 
 // PubSub defines storage operations for pubsub management.
@@ -37,12 +39,25 @@ type PubSub interface {
 	// FetchNodeItems retrieves all items associated to a node.
 	FetchNodeItems(ctx context.Context, host, name string) ([]pubsubmodel.Item, error)
 
+	// FetchNodeItemsPage retrieves a page of node items as requested by a result set management request.
+	FetchNodeItemsPage(ctx context.Context, host, name string, req *rsmmodel.Request) ([]pubsubmodel.Item, *rsmmodel.Result, error)
+
 	// FetchNodeItemsWithIDs retrieves all items matching any of the passed identifiers.
 	FetchNodeItemsWithIDs(ctx context.Context, host, name string, identifiers []string) ([]pubsubmodel.Item, error)
 
 	// FetchNodeLastItem retrieves last published node item.
 	FetchNodeLastItem(ctx context.Context, host, name string) (*pubsubmodel.Item, error)
 
+	// DeleteNodeItem deletes a pubsub node item from storage.
+	DeleteNodeItem(ctx context.Context, host, name, identifier string) error
+
+	// FetchExpiredNodeItems retrieves the identifiers of every item published before a given time
+	// in all nodes named name, indexed by node host.
+	FetchExpiredNodeItems(ctx context.Context, name string, publishedBefore time.Time) (map[string][]string, error)
+
+	// FetchHostItemsSize returns the overall size in bytes of all item payloads stored in host nodes.
+	FetchHostItemsSize(ctx context.Context, host string) (int, error)
+
 	// UpsertNodeAffiliation inserts a new pubsub node affiliation into storage, or updates it if previously inserted.
 	UpsertNodeAffiliation(ctx context.Context, affiliation *pubsubmodel.Affiliation, host, name string) error
 
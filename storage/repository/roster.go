@@ -12,34 +12,48 @@ import (
 )
 
 // Roster defines storage operations for user's roster.
+// Roster owners and notified contacts are identified by their bare JID.
 type Roster interface {
 	// UpsertRosterItem inserts a new roster item entity into storage, or updates it if previously inserted.
 	UpsertRosterItem(ctx context.Context, ri *rostermodel.Item) (rostermodel.Version, error)
 
 	// DeleteRosterItem deletes a roster item entity from storage.
-	DeleteRosterItem(ctx context.Context, username, jid string) (rostermodel.Version, error)
+	DeleteRosterItem(ctx context.Context, userJID, jid string) (rostermodel.Version, error)
 
 	// FetchRosterItems retrieves from storage all roster item entities associated to a given user.
-	FetchRosterItems(ctx context.Context, username string) ([]rostermodel.Item, rostermodel.Version, error)
+	FetchRosterItems(ctx context.Context, userJID string) ([]rostermodel.Item, rostermodel.Version, error)
 
 	// FetchRosterItemsInGroups retrieves from storage all roster item entities associated to a given user and a set of groups.
-	FetchRosterItemsInGroups(ctx context.Context, username string, groups []string) ([]rostermodel.Item, rostermodel.Version, error)
+	FetchRosterItemsInGroups(ctx context.Context, userJID string, groups []string) ([]rostermodel.Item, rostermodel.Version, error)
+
+	// FetchRosterChanges retrieves from storage all roster items changed after a given roster version, sorted by version.
+	// Removed items are returned with a 'remove' subscription value.
+	FetchRosterChanges(ctx context.Context, userJID string, sinceVer int) ([]rostermodel.Item, error)
 
 	// FetchRosterItem retrieves from storage a roster item entity.
-	FetchRosterItem(ctx context.Context, username, jid string) (*rostermodel.Item, error)
+	FetchRosterItem(ctx context.Context, userJID, jid string) (*rostermodel.Item, error)
 
 	// UpsertRosterNotification inserts a new roster notification entity into storage, or updates it if previously inserted.
 	UpsertRosterNotification(ctx context.Context, rn *rostermodel.Notification) error
 
 	// DeleteRosterNotification deletes a roster notification entity from storage.
-	DeleteRosterNotification(ctx context.Context, contact, jid string) error
+	DeleteRosterNotification(ctx context.Context, contactJID, jid string) error
 
 	// FetchRosterNotification retrieves from storage a roster notification entity.
-	FetchRosterNotification(ctx context.Context, contact string, jid string) (*rostermodel.Notification, error)
+	FetchRosterNotification(ctx context.Context, contactJID string, jid string) (*rostermodel.Notification, error)
 
 	// FetchRosterNotifications retrieves from storage all roster notifications associated to a given user.
-	FetchRosterNotifications(ctx context.Context, contact string) ([]rostermodel.Notification, error)
+	FetchRosterNotifications(ctx context.Context, contactJID string) ([]rostermodel.Notification, error)
 
 	// FetchRosterGroups retrieves all groups associated to a user roster.
-	FetchRosterGroups(ctx context.Context, username string) ([]string, error)
+	FetchRosterGroups(ctx context.Context, userJID string) ([]string, error)
+
+	// UpsertRosterPermission grants an entity permission to manage a user's roster (XEP-0321).
+	UpsertRosterPermission(ctx context.Context, userJID, jid string) error
+
+	// DeleteRosterPermission revokes a previously granted roster management permission.
+	DeleteRosterPermission(ctx context.Context, userJID, jid string) error
+
+	// FetchRosterPermission tells whether or not an entity has been granted permission to manage a user's roster.
+	FetchRosterPermission(ctx context.Context, userJID, jid string) (bool, error)
 }
@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package repository
+
+import (
+	"context"
+
+	rostermodel "github.com/ortuman/jackal/model/roster"
+)
+
+// SharedGroups defines storage operations for administrator defined shared roster groups.
+type SharedGroups interface {
+	// UpsertSharedGroup inserts a new shared group entity into storage, or updates it if previously inserted.
+	UpsertSharedGroup(ctx context.Context, group *rostermodel.SharedGroup) error
+
+	// DeleteSharedGroup deletes a shared group entity from storage.
+	DeleteSharedGroup(ctx context.Context, name string) error
+
+	// FetchSharedGroup retrieves from storage a shared group entity.
+	FetchSharedGroup(ctx context.Context, name string) (*rostermodel.SharedGroup, error)
+
+	// FetchSharedGroups retrieves from storage all shared group entities.
+	FetchSharedGroups(ctx context.Context) ([]rostermodel.SharedGroup, error)
+
+	// FetchSharedGroupMembers retrieves the bare JIDs of all shared group members,
+	// including every user registered on the group hosts.
+	FetchSharedGroupMembers(ctx context.Context, name string) ([]string, error)
+}
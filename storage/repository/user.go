@@ -11,17 +11,18 @@ import (
 	"github.com/ortuman/jackal/model"
 )
 
-// User defines user repository operations
+// User defines user repository operations.
+// Users are keyed by their bare JID, so that equally named users from different virtual hosts don't collide.
 type User interface {
 	// UpsertUser inserts a new user entity into storage, or updates it if previously inserted.
 	UpsertUser(ctx context.Context, user *model.User) error
 
 	// DeleteUser deletes a user entity from storage.
-	DeleteUser(ctx context.Context, username string) error
+	DeleteUser(ctx context.Context, userJID string) error
 
 	// FetchUser retrieves a user entity from storage.
-	FetchUser(ctx context.Context, username string) (*model.User, error)
+	FetchUser(ctx context.Context, userJID string) (*model.User, error)
 
 	// UserExists tells whether or not a user exists within storage.
-	UserExists(ctx context.Context, username string) (bool, error)
+	UserExists(ctx context.Context, userJID string) (bool, error)
 }
@@ -8,6 +8,7 @@ package storage
 import (
 	"fmt"
 
+	"github.com/ortuman/jackal/storage/measured"
 	memorystorage "github.com/ortuman/jackal/storage/memory"
 	"github.com/ortuman/jackal/storage/mysql"
 	"github.com/ortuman/jackal/storage/pgsql"
@@ -15,15 +16,22 @@ import (
 )
 
 // New initializes configured storage type and returns associated container.
+// Every repository operation latency is recorded into the storage metrics.
 func New(config *Config) (repository.Container, error) {
+	var rep repository.Container
+	var err error
 	switch config.Type {
 	case MySQL:
-		return mysql.New(config.MySQL)
+		rep, err = mysql.New(config.MySQL)
 	case PostgreSQL:
-		return pgsql.New(config.PostgreSQL)
+		rep, err = pgsql.New(config.PostgreSQL)
 	case Memory:
-		return memorystorage.New()
+		rep, err = memorystorage.New()
 	default:
 		return nil, fmt.Errorf("storage: unrecognized storage type: %d", config.Type)
 	}
+	if err != nil {
+		return nil, err
+	}
+	return measured.New(rep), nil
 }
@@ -8,6 +8,7 @@ package stream
 import (
 	"context"
 	"errors"
+	"net"
 	"sync"
 	"time"
 
@@ -24,6 +25,7 @@ type MockC2S struct {
 	isCompressed    bool
 	isDisconnected  bool
 	jid             *jid.JID
+	remoteAddr      net.Addr
 	presence        *xmpp.Presence
 	elemCh          chan xmpp.XElement
 	actorCh         chan func()
@@ -97,6 +99,20 @@ func (m *MockC2S) JID() *jid.JID {
 	return m.jid
 }
 
+// SetRemoteAddr sets the mocked stream remote peer address.
+func (m *MockC2S) SetRemoteAddr(addr net.Addr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remoteAddr = addr
+}
+
+// RemoteAddr returns the mocked stream remote peer address.
+func (m *MockC2S) RemoteAddr() net.Addr {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.remoteAddr
+}
+
 // SetSecured sets whether or not the a mocked stream
 // has been secured.
 func (m *MockC2S) SetSecured(secured bool) {
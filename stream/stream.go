@@ -7,6 +7,7 @@ package stream
 
 import (
 	"context"
+	"net"
 
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
@@ -39,6 +40,8 @@ type C2S interface {
 
 	JID() *jid.JID
 
+	RemoteAddr() net.Addr
+
 	IsSecured() bool
 	IsAuthenticated() bool
 
@@ -48,6 +51,8 @@ type C2S interface {
 // S2SIn represents an incoming server-to-server XMPP stream.
 type S2SIn interface {
 	InStream
+
+	RemoteAddr() net.Addr
 }
 
 // S2SOut represents an outgoing server-to-server XMPP stream.
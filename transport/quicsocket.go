@@ -8,6 +8,7 @@ package transport
 import (
 	"bufio"
 	"crypto/tls"
+	"net"
 
 	"github.com/lucas-clemente/quic-go"
 )
@@ -39,3 +40,7 @@ func (s *quicSocketTransport) Read(p []byte) (n int, err error) {
 
 func (s *quicSocketTransport) StartTLS(cfg *tls.Config, asClient bool) {
 }
+
+func (s *quicSocketTransport) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package transport
+
+import "github.com/ortuman/jackal/util/ratelimit"
+
+type rateLimitedTransport struct {
+	Transport
+	limiter *ratelimit.Limiter
+}
+
+// NewRateLimitedTransport wraps a transport throttling its inbound throughput.
+func NewRateLimitedTransport(tr Transport, limiter *ratelimit.Limiter) Transport {
+	return &rateLimitedTransport{Transport: tr, limiter: limiter}
+}
+
+func (t *rateLimitedTransport) Read(p []byte) (int, error) {
+	n, err := t.Transport.Read(p)
+	if n > 0 {
+		if lErr := t.limiter.WaitBytes(n); lErr != nil {
+			return n, lErr
+		}
+	}
+	return n, err
+}
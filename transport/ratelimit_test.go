@@ -0,0 +1,27 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/util/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitedTransport(t *testing.T) {
+	buff := make([]byte, 64)
+	conn := newFakeSocketConn()
+	conn.r.WriteString("<elem/>")
+
+	tr := NewRateLimitedTransport(NewSocketTransport(conn), ratelimit.New(&ratelimit.Config{BytesPerSec: 1, MaxThrottle: time.Second}))
+	require.Equal(t, Socket, tr.Type())
+
+	n, err := tr.Read(buff)
+	require.Equal(t, 7, n)
+	require.Equal(t, ratelimit.ErrLimitExceeded, err)
+}
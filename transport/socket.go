@@ -70,7 +70,7 @@ func (s *socketTransport) SetWriteDeadline(d time.Time) error {
 }
 
 func (s *socketTransport) StartTLS(cfg *tls.Config, asClient bool) {
-	if _, ok := s.conn.(*net.TCPConn); ok {
+	if isTCPConn(s.conn) {
 		if asClient {
 			s.conn = tls.Client(s.conn, cfg)
 		} else {
@@ -111,3 +111,22 @@ func (s *socketTransport) PeerCertificates() []*x509.Certificate {
 	}
 	return nil
 }
+
+func (s *socketTransport) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// underlyingConn is implemented by connections wrapping a network connection (e.g. PROXY protocol).
+type underlyingConn interface {
+	Underlying() net.Conn
+}
+
+func isTCPConn(conn net.Conn) bool {
+	switch c := conn.(type) {
+	case *net.TCPConn:
+		return true
+	case underlyingConn:
+		return isTCPConn(c.Underlying())
+	}
+	return false
+}
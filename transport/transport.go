@@ -9,6 +9,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"io"
+	"net"
 	"time"
 
 	"github.com/ortuman/jackal/transport/compress"
@@ -66,6 +67,9 @@ type Transport interface {
 
 	// PeerCertificates returns the certificate chain presented by remote peer.
 	PeerCertificates() []*x509.Certificate
+
+	// RemoteAddr returns the network address of the remote peer.
+	RemoteAddr() net.Addr
 }
 
 type tlsStateQueryable interface {
@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultHeaderTimeout = time.Duration(5) * time.Second
+
+const (
+	v1Prefix       = "PROXY "
+	v1MaxHeaderLen = 107
+
+	v2HeaderLen = 16
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidHeader is returned when a trusted peer sends a malformed PROXY protocol header.
+var ErrInvalidHeader = errors.New("proxyproto: invalid header")
+
+// Config represents a PROXY protocol listener configuration.
+type Config struct {
+	TrustedCIDRs  []*net.IPNet
+	HeaderTimeout time.Duration
+}
+
+type configProxy struct {
+	TrustedCIDRs  []string `yaml:"trusted_cidrs"`
+	HeaderTimeout int      `yaml:"header_timeout"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if len(p.TrustedCIDRs) == 0 {
+		return errors.New("proxyproto.Config: at least one trusted cidr must be specified")
+	}
+	c.TrustedCIDRs = nil
+	for _, cidr := range p.TrustedCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("proxyproto.Config: invalid cidr: %s", cidr)
+		}
+		c.TrustedCIDRs = append(c.TrustedCIDRs, ipNet)
+	}
+	c.HeaderTimeout = time.Duration(p.HeaderTimeout) * time.Second
+	if c.HeaderTimeout == 0 {
+		c.HeaderTimeout = defaultHeaderTimeout
+	}
+	return nil
+}
+
+// IsTrusted tells whether a remote address belongs to any of the trusted networks.
+func (c *Config) IsTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range c.TrustedCIDRs {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn represents a connection accepted through a PROXY protocol speaking peer.
+type Conn struct {
+	net.Conn
+	br         *bufio.Reader
+	remoteAddr net.Addr
+}
+
+// Read reads data from the connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	return c.br.Read(p)
+}
+
+// RemoteAddr returns the original client address as announced by the proxy.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// ProxyAddr returns the address of the proxy the connection was accepted from.
+func (c *Conn) ProxyAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
+
+// Underlying returns the wrapped network connection.
+func (c *Conn) Underlying() net.Conn {
+	return c.Conn
+}
+
+// Accept reads the PROXY protocol header from a connection accepted from a trusted peer,
+// returning a connection reporting the original client address.
+// Connections from untrusted peers are returned unmodified.
+func Accept(conn net.Conn, cfg *Config) (net.Conn, error) {
+	if cfg == nil || !cfg.IsTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	if cfg.HeaderTimeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(cfg.HeaderTimeout)); err != nil {
+			return nil, err
+		}
+	}
+	br := bufio.NewReader(conn)
+	remoteAddr, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.HeaderTimeout > 0 {
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	if remoteAddr == nil {
+		// LOCAL or UNKNOWN: keep proxy address
+		remoteAddr = conn.RemoteAddr()
+	}
+	return &Conn{Conn: conn, br: br, remoteAddr: remoteAddr}, nil
+}
+
+func readHeader(br *bufio.Reader) (net.Addr, error) {
+	b, err := br.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	switch b[0] {
+	case v1Prefix[0]:
+		return readV1Header(br)
+	case v2Signature[0]:
+		return readV2Header(br)
+	default:
+		return nil, ErrInvalidHeader
+	}
+}
+
+// readV1Header parses a human-readable header, e.g. 'PROXY TCP4 192.0.2.1 192.0.2.2 56324 5222\r\n'.
+func readV1Header(br *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+		if len(line) >= v1MaxHeaderLen {
+			return nil, ErrInvalidHeader
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) || !bytes.HasPrefix(line, []byte(v1Prefix)) {
+		return nil, ErrInvalidHeader
+	}
+	fields := strings.Fields(string(line[len(v1Prefix) : len(line)-2]))
+	if len(fields) == 0 {
+		return nil, ErrInvalidHeader
+	}
+	switch fields[0] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+		if len(fields) != 5 {
+			return nil, ErrInvalidHeader
+		}
+		ip := net.ParseIP(fields[1])
+		if ip == nil || (fields[0] == "TCP4") != (ip.To4() != nil) {
+			return nil, ErrInvalidHeader
+		}
+		port, err := strconv.ParseUint(fields[3], 10, 16)
+		if err != nil {
+			return nil, ErrInvalidHeader
+		}
+		return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+	default:
+		return nil, ErrInvalidHeader
+	}
+}
+
+// readV2Header parses a binary header as described in section 2.2 of the PROXY protocol specification.
+func readV2Header(br *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, v2HeaderLen)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hdr[:12], v2Signature) || hdr[12]>>4 != 0x2 {
+		return nil, ErrInvalidHeader
+	}
+	cmd := hdr[12] & 0x0f
+	family := hdr[13]
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, err
+	}
+	switch cmd {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+		break
+	default:
+		return nil, ErrInvalidHeader
+	}
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, ErrInvalidHeader
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, ErrInvalidHeader
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		// unsupported address family: keep proxy address
+		return nil, nil
+	}
+}
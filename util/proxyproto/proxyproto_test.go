@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package proxyproto
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type fakeConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+func (c *fakeConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+func newFakeConn(remoteIP string, data []byte) net.Conn {
+	c0, c1 := net.Pipe()
+	go func() {
+		_, _ = c1.Write(data)
+		_ = c1.Close()
+	}()
+	return &fakeConn{Conn: c0, remoteAddr: &net.TCPAddr{IP: net.ParseIP(remoteIP), Port: 41234}}
+}
+
+func testConfig(t *testing.T) *Config {
+	var cfg Config
+	require.Nil(t, yaml.Unmarshal([]byte("trusted_cidrs: [10.0.0.0/8, \"fd00::/8\"]"), &cfg))
+	return &cfg
+}
+
+func TestConfig(t *testing.T) {
+	cfg := testConfig(t)
+	require.Len(t, cfg.TrustedCIDRs, 2)
+	require.Equal(t, defaultHeaderTimeout, cfg.HeaderTimeout)
+
+	var badCfg Config
+	require.NotNil(t, yaml.Unmarshal([]byte("header_timeout: 2"), &badCfg))
+	require.NotNil(t, yaml.Unmarshal([]byte("trusted_cidrs: [10.0.0.0]"), &badCfg))
+
+	require.True(t, cfg.IsTrusted(&net.TCPAddr{IP: net.ParseIP("10.1.2.3")}))
+	require.True(t, cfg.IsTrusted(&net.TCPAddr{IP: net.ParseIP("fd00::1")}))
+	require.False(t, cfg.IsTrusted(&net.TCPAddr{IP: net.ParseIP("192.168.1.1")}))
+}
+
+func TestAccept_V1(t *testing.T) {
+	cfg := testConfig(t)
+
+	conn, err := Accept(newFakeConn("10.0.0.1", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 5222\r\n<stream>")), cfg)
+	require.Nil(t, err)
+	require.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+	require.Equal(t, "10.0.0.1:41234", conn.(*Conn).ProxyAddr().String())
+
+	b, _ := ioutil.ReadAll(conn)
+	require.Equal(t, "<stream>", string(b))
+
+	conn, err = Accept(newFakeConn("10.0.0.1", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 5222\r\n")), cfg)
+	require.Nil(t, err)
+	require.Equal(t, "[2001:db8::1]:56324", conn.RemoteAddr().String())
+
+	conn, err = Accept(newFakeConn("10.0.0.1", []byte("PROXY UNKNOWN\r\n")), cfg)
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.1:41234", conn.RemoteAddr().String())
+
+	_, err = Accept(newFakeConn("10.0.0.1", []byte("PROXY TCP4 2001:db8::1 192.0.2.2 56324 5222\r\n")), cfg)
+	require.Equal(t, ErrInvalidHeader, err)
+
+	_, err = Accept(newFakeConn("10.0.0.1", []byte("<stream:stream>")), cfg)
+	require.Equal(t, ErrInvalidHeader, err)
+}
+
+func TestAccept_V2(t *testing.T) {
+	cfg := testConfig(t)
+
+	hdr := func(cmd, family byte, payload []byte) []byte {
+		b := append([]byte{}, v2Signature...)
+		b = append(b, 0x20|cmd, family, 0, 0)
+		binary.BigEndian.PutUint16(b[14:16], uint16(len(payload)))
+		return append(b, payload...)
+	}
+	ipv4 := []byte{192, 0, 2, 1, 192, 0, 2, 2, 0xdc, 0x04, 0x14, 0x66}
+	ipv4 = append(ipv4, 0x04, 0x00, 0x01, 0xff) // TLV to be skipped
+
+	conn, err := Accept(newFakeConn("10.0.0.1", append(hdr(0x1, 0x11, ipv4), []byte("<stream>")...)), cfg)
+	require.Nil(t, err)
+	require.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+
+	b, _ := ioutil.ReadAll(conn)
+	require.Equal(t, "<stream>", string(b))
+
+	// LOCAL command
+	conn, err = Accept(newFakeConn("10.0.0.1", hdr(0x0, 0x00, nil)), cfg)
+	require.Nil(t, err)
+	require.Equal(t, "10.0.0.1:41234", conn.RemoteAddr().String())
+
+	// truncated addresses
+	_, err = Accept(newFakeConn("10.0.0.1", hdr(0x1, 0x11, ipv4[:6])), cfg)
+	require.Equal(t, ErrInvalidHeader, err)
+}
+
+func TestAccept_Untrusted(t *testing.T) {
+	cfg := testConfig(t)
+
+	// untrusted peers are not allowed to spoof their address
+	c := newFakeConn("192.168.1.1", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 5222\r\n"))
+	conn, err := Accept(c, cfg)
+	require.Nil(t, err)
+	require.Equal(t, c, conn)
+
+	conn, err = Accept(c, nil)
+	require.Nil(t, err)
+	require.Equal(t, c, conn)
+}
+
+func TestAccept_Timeout(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.HeaderTimeout = time.Millisecond * 100
+
+	c0, c1 := net.Pipe()
+	defer func() { _ = c1.Close() }()
+
+	_, err := Accept(&fakeConn{Conn: c0, remoteAddr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1")}}, cfg)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package ratelimit
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultMaxThrottle = time.Duration(30) * time.Second
+
+// ErrLimitExceeded is returned when a peer has been exceeding its rate limits
+// for longer than the configured maximum throttling time.
+var ErrLimitExceeded = errors.New("ratelimit: limit exceeded")
+
+// Config represents a rate limiting configuration.
+type Config struct {
+	BytesPerSec   int
+	StanzasPerSec int
+	MaxThrottle   time.Duration
+}
+
+type configProxy struct {
+	BytesPerSec   int `yaml:"bytes_per_sec"`
+	StanzasPerSec int `yaml:"stanzas_per_sec"`
+	MaxThrottle   int `yaml:"max_throttle"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.BytesPerSec < 0 || p.StanzasPerSec < 0 {
+		return errors.New("ratelimit.Config: rate values must be positive")
+	}
+	c.BytesPerSec = p.BytesPerSec
+	c.StanzasPerSec = p.StanzasPerSec
+	c.MaxThrottle = time.Duration(p.MaxThrottle) * time.Second
+	if c.MaxThrottle == 0 {
+		c.MaxThrottle = defaultMaxThrottle
+	}
+	return nil
+}
+
+// Bucket represents a token bucket which gets refilled at a constant rate.
+type Bucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	nowFn    func() time.Time
+}
+
+// NewBucket returns a full token bucket refilled at rate tokens per second.
+func NewBucket(rate int) *Bucket {
+	return newBucket(rate, time.Now)
+}
+
+func newBucket(rate int, nowFn func() time.Time) *Bucket {
+	return &Bucket{
+		rate:     float64(rate),
+		capacity: float64(rate),
+		tokens:   float64(rate),
+		last:     nowFn(),
+		nowFn:    nowFn,
+	}
+}
+
+// Take consumes n tokens from the bucket returning the time
+// that the caller should wait until they become available.
+func (b *Bucket) Take(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.nowFn()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type shaper struct {
+	bucket         *Bucket
+	mu             sync.Mutex
+	throttledSince time.Time
+}
+
+// Limiter shapes inbound traffic in terms of bytes and stanzas per second.
+type Limiter struct {
+	cfg     *Config
+	bytes   *shaper
+	stanzas *shaper
+	nowFn   func() time.Time
+	sleepFn func(time.Duration)
+}
+
+// New returns a new Limiter instance.
+func New(cfg *Config) *Limiter {
+	return newLimiter(cfg, time.Now, time.Sleep)
+}
+
+func newLimiter(cfg *Config, nowFn func() time.Time, sleepFn func(time.Duration)) *Limiter {
+	l := &Limiter{cfg: cfg, nowFn: nowFn, sleepFn: sleepFn}
+	if cfg.BytesPerSec > 0 {
+		l.bytes = &shaper{bucket: newBucket(cfg.BytesPerSec, nowFn)}
+	}
+	if cfg.StanzasPerSec > 0 {
+		l.stanzas = &shaper{bucket: newBucket(cfg.StanzasPerSec, nowFn)}
+	}
+	return l
+}
+
+// WaitBytes blocks until n bytes can be accepted.
+func (l *Limiter) WaitBytes(n int) error {
+	return l.wait(l.bytes, n)
+}
+
+// WaitStanza blocks until a new stanza can be accepted.
+func (l *Limiter) WaitStanza() error {
+	return l.wait(l.stanzas, 1)
+}
+
+func (l *Limiter) wait(s *shaper, n int) error {
+	if s == nil {
+		return nil
+	}
+	d := s.bucket.Take(n)
+
+	s.mu.Lock()
+	if d == 0 {
+		s.throttledSince = time.Time{}
+		s.mu.Unlock()
+		return nil
+	}
+	now := l.nowFn()
+	if s.throttledSince.IsZero() {
+		s.throttledSince = now
+	}
+	abusing := now.Add(d).Sub(s.throttledSince) > l.cfg.MaxThrottle
+	s.mu.Unlock()
+
+	if abusing {
+		return ErrLimitExceeded
+	}
+	l.sleepFn(d)
+	return nil
+}
+
+type registryEntry struct {
+	limiter *Limiter
+	refs    int
+}
+
+// Registry keeps a set of shared limiters indexed by key.
+type Registry struct {
+	cfg      *Config
+	mu       sync.Mutex
+	limiters map[string]*registryEntry
+}
+
+// NewRegistry returns a new limiter registry.
+func NewRegistry(cfg *Config) *Registry {
+	return &Registry{cfg: cfg, limiters: make(map[string]*registryEntry)}
+}
+
+// Acquire returns the limiter associated to key, creating it if needed.
+func (r *Registry) Acquire(key string) *Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.limiters[key]
+	if e == nil {
+		e = &registryEntry{limiter: New(r.cfg)}
+		r.limiters[key] = e
+	}
+	e.refs++
+	return e.limiter
+}
+
+// Release releases a limiter previously obtained by means of Acquire.
+func (r *Registry) Release(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.limiters[key]
+	if e == nil {
+		return
+	}
+	e.refs--
+	if e.refs <= 0 {
+		delete(r.limiters, key)
+	}
+}
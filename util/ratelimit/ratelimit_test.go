@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte("{bytes_per_sec: 1024, stanzas_per_sec: 10}"), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 1024, cfg.BytesPerSec)
+	require.Equal(t, 10, cfg.StanzasPerSec)
+	require.Equal(t, defaultMaxThrottle, cfg.MaxThrottle)
+
+	err = yaml.Unmarshal([]byte("{stanzas_per_sec: -1}"), &cfg)
+	require.NotNil(t, err)
+}
+
+func TestBucket_Take(t *testing.T) {
+	now := time.Now()
+	b := newBucket(10, func() time.Time { return now })
+
+	require.Equal(t, time.Duration(0), b.Take(10))
+	require.Equal(t, time.Millisecond*100, b.Take(1))
+
+	now = now.Add(time.Second)
+	require.Equal(t, time.Duration(0), b.Take(9))
+
+	// never refilled above capacity
+	now = now.Add(time.Hour)
+	require.Equal(t, time.Duration(0), b.Take(10))
+	require.Equal(t, time.Second, b.Take(10))
+}
+
+func TestLimiter_Wait(t *testing.T) {
+	now := time.Now()
+	var slept time.Duration
+	l := newLimiter(&Config{StanzasPerSec: 2, MaxThrottle: time.Second * 2}, func() time.Time { return now }, func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	})
+	require.Nil(t, l.WaitBytes(1<<20)) // unlimited
+
+	require.Nil(t, l.WaitStanza())
+	require.Nil(t, l.WaitStanza())
+	require.Equal(t, time.Duration(0), slept)
+
+	require.Nil(t, l.WaitStanza())
+	require.Equal(t, time.Millisecond*500, slept)
+
+	// sustained abuse
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = l.WaitStanza()
+	}
+	require.Equal(t, ErrLimitExceeded, err)
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(&Config{StanzasPerSec: 1})
+
+	l1 := r.Acquire("ortuman")
+	l2 := r.Acquire("ortuman")
+	require.True(t, l1 == l2)
+
+	r.Release("ortuman")
+	require.Len(t, r.limiters, 1)
+	r.Release("ortuman")
+	require.Len(t, r.limiters, 0)
+
+	require.False(t, r.Acquire("ortuman") == l1)
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package runqueue
+
+import (
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+// ShardedRunQueue represents a set of lock-free operation queues.
+// Operations sharing the same key are executed sequentially, while those associated to different keys
+// might run in parallel.
+type ShardedRunQueue struct {
+	shards []*RunQueue
+}
+
+// NewSharded returns an initialized sharded operation queue.
+// If shardCount is not positive, the number of logical CPUs is used.
+func NewSharded(name string, shardCount int) *ShardedRunQueue {
+	if shardCount <= 0 {
+		shardCount = runtime.NumCPU()
+	}
+	s := &ShardedRunQueue{shards: make([]*RunQueue, shardCount)}
+	for i := 0; i < shardCount; i++ {
+		s.shards[i] = New(name + ":" + strconv.Itoa(i))
+	}
+	return s
+}
+
+// Run pushes a new operation function into the queue associated to key.
+func (s *ShardedRunQueue) Run(key string, fn func()) {
+	s.shard(key).Run(fn)
+}
+
+// Barrier invokes fn once every operation previously pushed into any of the queues has been executed.
+func (s *ShardedRunQueue) Barrier(fn func()) {
+	remaining := int32(len(s.shards))
+	for _, rq := range s.shards {
+		rq.Run(func() {
+			if atomic.AddInt32(&remaining, -1) == 0 {
+				fn()
+			}
+		})
+	}
+}
+
+// Stop signals every queue to stop running.
+//
+// Callback function represented by 'stopCb' is executed once all queues have been stopped.
+func (s *ShardedRunQueue) Stop(stopCb func()) {
+	remaining := int32(len(s.shards))
+	for _, rq := range s.shards {
+		rq.Stop(func() {
+			if atomic.AddInt32(&remaining, -1) == 0 && stopCb != nil {
+				stopCb()
+			}
+		})
+	}
+}
+
+func (s *ShardedRunQueue) shard(key string) *RunQueue {
+	// 32-bit FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return s.shards[h%uint32(len(s.shards))]
+}
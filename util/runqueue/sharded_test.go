@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2020 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package runqueue
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedRunQueueOrdering(t *testing.T) {
+	const users = 32
+	const opsPerUser = 200
+
+	var mu sync.Mutex
+	seqs := make(map[string][]int)
+
+	var wg sync.WaitGroup
+	rq := NewSharded("test", 4)
+	for i := 0; i < opsPerUser; i++ {
+		for u := 0; u < users; u++ {
+			key := fmt.Sprintf("user%d@jackal.im", u)
+			seq := i
+
+			wg.Add(1)
+			rq.Run(key, func() {
+				mu.Lock()
+				seqs[key] = append(seqs[key], seq)
+				mu.Unlock()
+				wg.Done()
+			})
+		}
+	}
+	wg.Wait()
+
+	require.Len(t, seqs, users)
+	for _, seq := range seqs {
+		require.Len(t, seq, opsPerUser)
+		for i := range seq {
+			require.Equal(t, i, seq[i]) // per key order is preserved
+		}
+	}
+}
+
+func TestShardedRunQueueBarrier(t *testing.T) {
+	var mu sync.Mutex
+	var executed int
+
+	rq := NewSharded("test", 8)
+	for i := 0; i < 100; i++ {
+		rq.Run(fmt.Sprintf("user%d", i), func() {
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			executed++
+			mu.Unlock()
+		})
+	}
+	c := make(chan struct{})
+	rq.Barrier(func() { close(c) })
+
+	select {
+	case <-c:
+		mu.Lock()
+		require.Equal(t, 100, executed)
+		mu.Unlock()
+	case <-time.After(time.Second * 5):
+		require.Fail(t, "barrier timeout")
+	}
+}
+
+func TestShardedRunQueueStop(t *testing.T) {
+	rq := NewSharded("test", 0)
+	require.True(t, len(rq.shards) > 0)
+
+	rq.Run("ortuman@jackal.im", func() { time.Sleep(time.Millisecond * 500) })
+
+	c := make(chan struct{})
+	rq.Stop(func() { close(c) })
+
+	select {
+	case <-c:
+	case <-time.NewTimer(time.Second).C:
+		require.Fail(t, "close channel timeout")
+	}
+}
+
+// simulates a storage round trip
+const benchmarkOpLatency = time.Microsecond * 100
+
+const benchmarkUsers = 1000
+
+func BenchmarkRunQueue(b *testing.B) {
+	rq := New("bench")
+
+	var wg sync.WaitGroup
+	wg.Add(b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq.Run(func() {
+			time.Sleep(benchmarkOpLatency)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+}
+
+func BenchmarkShardedRunQueue(b *testing.B) {
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			rq := NewSharded("bench", shards)
+
+			keys := make([]string, benchmarkUsers)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("user%d@jackal.im", i)
+			}
+			var wg sync.WaitGroup
+			wg.Add(b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rq.Run(keys[i%benchmarkUsers], func() {
+					time.Sleep(benchmarkOpLatency)
+					wg.Done()
+				})
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -5,6 +5,8 @@
 
 package utilstring
 
+import "strings"
+
 // SplitKeyAndValue splits a string between 'key' and 'value' sub elements.
 func SplitKeyAndValue(str string, sep byte) (key string, value string) {
 	j := -1
@@ -21,3 +23,15 @@ func SplitKeyAndValue(str string, sep byte) (key string, value string) {
 	value = str[j+1:]
 	return
 }
+
+// StripSpaces removes all whitespace characters from a string, such as
+// those used to wrap long base64 encoded values.
+func StripSpaces(str string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, str)
+}
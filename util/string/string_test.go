@@ -20,3 +20,7 @@ func TestSplitKeyAndValue(t *testing.T) {
 	require.Equal(t, "", key)
 	require.Equal(t, "", value)
 }
+
+func TestStripSpaces(t *testing.T) {
+	require.Equal(t, "AAAABBBB", StripSpaces(" AAAA\r\n\tBBBB\n"))
+}
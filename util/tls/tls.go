@@ -13,6 +13,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"time"
@@ -54,6 +55,19 @@ func LoadCertificate(keyFile, certFile, domain string) (tls.Certificate, error)
 	return cer, nil
 }
 
+// LoadCertPool loads a certificate pool from a PEM encoded CA bundle file.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no valid certificates found in '%s'", caFile)
+	}
+	return pool, nil
+}
+
 func generateSelfSignedCertificate(keyFile, certFile, domain string) error {
 	if err := os.MkdirAll(selfSignedCertFolder, os.ModePerm); err != nil {
 		return err
@@ -33,3 +33,15 @@ func TestLoadCertificate(t *testing.T) {
 		require.Equal(t, "must specify a private key and a server certificate for the domain 'jackal.im'", err.Error())
 	})
 }
+
+func TestLoadCertPool(t *testing.T) {
+	pool, err := LoadCertPool("../../testdata/cert/test.server.crt")
+	require.Nil(t, err)
+	require.NotNil(t, pool)
+
+	_, err = LoadCertPool("../../testdata/cert/test.server.key")
+	require.NotNil(t, err)
+
+	_, err = LoadCertPool("../../testdata/cert/missing.crt")
+	require.NotNil(t, err)
+}
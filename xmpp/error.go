@@ -59,6 +59,7 @@ const (
 	notAllowedErrorReason            = "not-allowed"
 	notAuthroizedErrorReason         = "not-authorized"
 	paymentRequiredErrorReason       = "payment-required"
+	policyViolationErrorReason       = "policy-violation"
 	recipientUnavailableErrorReason  = "recipient-unavailable"
 	redirectErrorReason              = "redirect"
 	registrationRequiredErrorReason  = "registration-required"
@@ -126,6 +127,10 @@ var (
 	// is not authorized to access the requested service because payment is required.
 	ErrPaymentRequired = newStanzaError(402, authErrorType, paymentRequiredErrorReason)
 
+	// ErrPolicyViolation is returned by the stream when the entity has violated
+	// some local service policy (e.g., a storage quota).
+	ErrPolicyViolation = newStanzaError(400, modifyErrorType, policyViolationErrorReason)
+
 	// ErrRecipientUnavailable is returned by the stream when the intended
 	// recipient is temporarily unavailable.
 	ErrRecipientUnavailable = newStanzaError(404, waitErrorType, recipientUnavailableErrorReason)
@@ -244,6 +249,12 @@ func (s *stanzaElement) PaymentRequiredError() Stanza {
 	return NewErrorStanzaFromStanza(s, ErrPaymentRequired, nil)
 }
 
+// PolicyViolationError returns an error copy of the element
+// attaching 'policy-violation' error sub element.
+func (s *stanzaElement) PolicyViolationError() Stanza {
+	return NewErrorStanzaFromStanza(s, ErrPolicyViolation, nil)
+}
+
 // RecipientUnavailableError returns an error copy of the element
 // attaching 'recipient-unavailable' error sub element.
 func (s *stanzaElement) RecipientUnavailableError() Stanza {
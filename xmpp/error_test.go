@@ -53,6 +53,7 @@ func TestError(t *testing.T) {
 	require.NotNil(t, e.NotAllowedError().Error().Elements().Child(notAllowedErrorReason))
 	require.NotNil(t, e.NotAuthorizedError().Error().Elements().Child(notAuthroizedErrorReason))
 	require.NotNil(t, e.PaymentRequiredError().Error().Elements().Child(paymentRequiredErrorReason))
+	require.NotNil(t, e.PolicyViolationError().Error().Elements().Child(policyViolationErrorReason))
 	require.NotNil(t, e.RecipientUnavailableError().Error().Elements().Child(recipientUnavailableErrorReason))
 	require.NotNil(t, e.RedirectError().Error().Elements().Child(redirectErrorReason))
 	require.NotNil(t, e.RegistrationRequiredError().Error().Elements().Child(registrationRequiredErrorReason))